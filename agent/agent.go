@@ -0,0 +1,505 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+	"github.com/aws/amazon-vpc-cni-plugins/cleanup"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// DefaultSocketPath is the default path of the agent's unix domain socket.
+	DefaultSocketPath = "/var/run/vpc-cni-agent.sock"
+
+	// DefaultMaxRetries is the default number of times a failed operation is retried.
+	DefaultMaxRetries = 2
+
+	// DefaultRetryInterval is the default interval before the first retry of a failed operation.
+	DefaultRetryInterval = time.Second
+
+	// DefaultMaxRetryInterval is the default cap of the exponentially increasing interval
+	// between retries.
+	DefaultMaxRetryInterval = 8 * time.Second
+
+	// DefaultHealthCheckInterval is the default interval between health checks of ENIs with
+	// a standby ENI.
+	DefaultHealthCheckInterval = 5 * time.Second
+
+	// DefaultFailureThreshold is the default number of consecutive failed health checks
+	// after which an ENI fails over to its standby ENI.
+	DefaultFailureThreshold = 3
+
+	// DefaultReapInterval is the default interval between deletions of networks that plugins
+	// marked for deletion.
+	DefaultReapInterval = time.Minute
+
+	// serviceName is the name of the RPC service served by the agent.
+	serviceName = "Agent"
+
+	// endpointsFileName is the name of the file storing the attached endpoints.
+	endpointsFileName = "endpoints.json"
+)
+
+// Config is the configuration of the agent.
+type Config struct {
+	// StateDir is the directory where attached endpoints and counters are persisted.
+	StateDir string
+	// SocketPath is the path of the unix domain socket the agent listens on.
+	SocketPath string
+	// MaxRetries is the number of times a failed network builder operation is retried.
+	MaxRetries int
+	// RetryInterval is the interval before the first retry, doubled after every retry.
+	RetryInterval time.Duration
+	// MaxRetryInterval is the cap of the interval between retries.
+	MaxRetryInterval time.Duration
+	// HealthCheckInterval is the interval between health checks of ENIs with a standby ENI.
+	HealthCheckInterval time.Duration
+	// FailureThreshold is the number of consecutive failed health checks that trigger failover.
+	FailureThreshold int
+	// ReapStateDir is the state directory of the plugin whose networks marked for deletion are
+	// deleted by the agent. Networks are not reaped if empty.
+	ReapStateDir string
+	// ReapInterval is the interval between deletions of networks marked for deletion.
+	ReapInterval time.Duration
+	// Reconcile is the configuration of the cleanup of resources of dead sandboxes when the
+	// agent starts. No cleanup runs if nil.
+	Reconcile *cleanup.Config
+	// AllowedPeers are the identities of the processes allowed to connect, such as the container
+	// agent or kubelet: user IDs on Linux and security identifiers on Windows. Any process with
+	// access to the socket is allowed if empty.
+	AllowedPeers []string
+}
+
+// AttachEndpointArgs are the arguments of an endpoint attach request.
+// The shared ENI is identified by its link name and MAC address, and resolved by the agent.
+// The optional standby ENI takes over the endpoints of the network if the shared ENI fails.
+type AttachEndpointArgs struct {
+	ENIName              string
+	ENIMACAddress        string
+	StandbyENIName       string
+	StandbyENIMACAddress string
+	Network              network.Network
+	Endpoint             network.Endpoint
+}
+
+// AttachEndpointReply is the reply to an endpoint attach request.
+type AttachEndpointReply struct {
+	MACAddress string
+}
+
+// DetachEndpointArgs are the arguments of an endpoint detach request.
+type DetachEndpointArgs struct {
+	ENIName       string
+	ENIMACAddress string
+	Network       network.Network
+	Endpoint      network.Endpoint
+}
+
+// DetachEndpointReply is the reply to an endpoint detach request.
+type DetachEndpointReply struct{}
+
+// ListEndpointsArgs are the arguments of an endpoint list request.
+type ListEndpointsArgs struct{}
+
+// ListEndpointsReply is the reply to an endpoint list request.
+type ListEndpointsReply struct {
+	Endpoints []EndpointInfo
+}
+
+// EndpointInfo describes an endpoint attached by the agent.
+type EndpointInfo struct {
+	NetworkName string    `json:"networkName"`
+	ContainerID string    `json:"containerID"`
+	IfName      string    `json:"ifName"`
+	IPAddress   string    `json:"ipAddress,omitempty"`
+	MACAddress  string    `json:"macAddress,omitempty"`
+	AttachedAt  time.Time `json:"attachedAt"`
+}
+
+// Agent centralizes network builder operations of CNI plugins on a node in one process, which
+// serializes operations per network, caches created networks, retries failed operations and
+// fails over endpoints to standby ENIs.
+type Agent struct {
+	config         Config
+	nb             network.Builder
+	resolveENI     func(name string, macAddress string) (*eni.ENI, error)
+	checkENI       func(name string, macAddress string) error
+	listEndpoints  func() ([]network.EndpointRecord, error)
+	runCleanup     func(config *cleanup.Config) (*cleanup.Report, error)
+	lock           sync.Mutex
+	networkLocks   map[string]*sync.Mutex
+	networks       map[string]int
+	failoverGroups map[string]*failoverGroup
+	listener       net.Listener
+	done           chan struct{}
+}
+
+// service is the RPC service exported by the agent.
+type service struct {
+	agent *Agent
+}
+
+// NewAgent creates a new Agent object that builds networks with the given builder.
+func NewAgent(config Config, nb network.Builder) *Agent {
+	if config.SocketPath == "" {
+		config.SocketPath = DefaultSocketPath
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if config.MaxRetryInterval == 0 {
+		config.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+	if config.HealthCheckInterval == 0 {
+		config.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = DefaultFailureThreshold
+	}
+	if config.ReapInterval == 0 {
+		config.ReapInterval = DefaultReapInterval
+	}
+
+	return &Agent{
+		config:         config,
+		nb:             nb,
+		resolveENI:     findENI,
+		checkENI:       checkENI,
+		listEndpoints:  network.ListEndpoints,
+		runCleanup:     cleanup.Run,
+		networkLocks:   make(map[string]*sync.Mutex),
+		networks:       make(map[string]int),
+		failoverGroups: make(map[string]*failoverGroup),
+		done:           make(chan struct{}),
+	}
+}
+
+// Start starts listening for requests.
+func (agent *Agent) Start() error {
+	server := rpc.NewServer()
+	err := server.RegisterName(serviceName, &service{agent: agent})
+	if err != nil {
+		return err
+	}
+
+	if agent.config.Reconcile != nil {
+		agent.reconcile()
+	}
+
+	// Remove the socket left behind by a previous instance.
+	os.Remove(agent.config.SocketPath)
+
+	agent.listener, err = net.Listen("unix", agent.config.SocketPath)
+	if err != nil {
+		return fmt.Errorf("agent: failed to listen on %s: %v", agent.config.SocketPath, err)
+	}
+
+	err = os.Chmod(agent.config.SocketPath, 0600)
+	if err != nil {
+		agent.listener.Close()
+		return err
+	}
+
+	go agent.serve(server)
+	go agent.monitorENIs()
+	if agent.config.ReapStateDir != "" {
+		go agent.reapNetworks()
+	}
+
+	log.Infof("Listening on %s.", agent.config.SocketPath)
+	return nil
+}
+
+// Stop stops the agent.
+func (agent *Agent) Stop() {
+	close(agent.done)
+	agent.listener.Close()
+}
+
+// serve accepts connections and serves requests on them.
+func (agent *Agent) serve(server *rpc.Server) {
+	for {
+		conn, err := agent.listener.Accept()
+		if err != nil {
+			select {
+			case <-agent.done:
+				return
+			default:
+			}
+			log.Errorf("Failed to accept connection: %v.", err)
+			continue
+		}
+
+		err = agent.authorizePeer(conn)
+		if err != nil {
+			log.Errorf("Rejected connection: %v.", err)
+			agent.incrementCounter(state.CounterRejectedConnections)
+			conn.Close()
+			continue
+		}
+
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// lockNetwork acquires the lock of the given network and returns a function that releases it.
+// Operations on different networks proceed concurrently.
+func (agent *Agent) lockNetwork(name string) func() {
+	agent.lock.Lock()
+	networkLock, ok := agent.networkLocks[name]
+	if !ok {
+		networkLock = &sync.Mutex{}
+		agent.networkLocks[name] = networkLock
+	}
+	agent.lock.Unlock()
+
+	networkLock.Lock()
+	return networkLock.Unlock
+}
+
+// retry calls fn until it succeeds or the maximum number of retries is reached, backing off
+// exponentially with jitter. Network builder errors are not classified, so all are retried.
+func (agent *Agent) retry(op string, fn func() error) error {
+	policy := backoff.Policy{
+		MaxAttempts:     agent.config.MaxRetries + 1,
+		InitialInterval: agent.config.RetryInterval,
+		MaxInterval:     agent.config.MaxRetryInterval,
+	}
+
+	attempt := 0
+	return policy.Retry(op, func() error {
+		if attempt > 0 {
+			agent.incrementCounter(state.CounterAttachRetries)
+		}
+		attempt++
+		return fn()
+	}, func(error) bool { return true })
+}
+
+// findOrCreateNetwork finds or creates the given network, skipping the builder if the network
+// was already created by this agent. Must be called with the network lock held.
+func (agent *Agent) findOrCreateNetwork(nw *network.Network) error {
+	if bridgeIndex, ok := agent.networks[nw.Name]; ok {
+		nw.BridgeIndex = bridgeIndex
+		return nil
+	}
+
+	err := agent.retry("FindOrCreateNetwork", func() error {
+		return agent.nb.FindOrCreateNetwork(nw)
+	})
+	if err != nil {
+		return err
+	}
+
+	agent.networks[nw.Name] = nw.BridgeIndex
+	return nil
+}
+
+// recordNetworkResult updates the persistent counter of consecutive network builder failures.
+func (agent *Agent) recordNetworkResult(opErr error) {
+	err := state.UpdateCounters(agent.config.StateDir, func(counters state.Counters) {
+		if opErr != nil {
+			counters[state.CounterConsecutiveNetworkFailures]++
+		} else {
+			counters[state.CounterConsecutiveNetworkFailures] = 0
+		}
+	})
+	if err != nil {
+		log.Errorf("Failed to update counters: %v.", err)
+	}
+}
+
+// incrementCounter increments the named persistent counter.
+func (agent *Agent) incrementCounter(name string) {
+	err := state.IncrementCounter(agent.config.StateDir, name)
+	if err != nil {
+		log.Errorf("Failed to update counters: %v.", err)
+	}
+}
+
+// updateEndpoints atomically applies the given update to the persisted endpoints.
+func (agent *Agent) updateEndpoints(update func(map[string]EndpointInfo)) error {
+	endpoints := make(map[string]EndpointInfo)
+	path := filepath.Join(agent.config.StateDir, endpointsFileName)
+	return state.UpdateJournaledFile(path, &endpoints, func() error {
+		update(endpoints)
+		return nil
+	})
+}
+
+// endpointKey returns the key of an endpoint in the persisted endpoints.
+func endpointKey(ep *network.Endpoint) string {
+	return ep.ContainerID + "/" + ep.IfName
+}
+
+// findENI finds the shared ENI with the given link name or MAC address.
+func findENI(name string, macAddress string) (*eni.ENI, error) {
+	var mac net.HardwareAddr
+	var err error
+	if macAddress != "" {
+		mac, err = net.ParseMAC(macAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sharedENI, err := eni.NewENI(name, mac)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sharedENI.AttachToLink()
+	if err != nil {
+		return nil, err
+	}
+
+	return sharedENI, nil
+}
+
+// AttachEndpoint finds or creates the network and attaches the endpoint to it.
+func (svc *service) AttachEndpoint(args *AttachEndpointArgs, reply *AttachEndpointReply) error {
+	agent := svc.agent
+	nw := &args.Network
+	ep := &args.Endpoint
+
+	unlock := agent.lockNetwork(nw.Name)
+	defer unlock()
+
+	// Endpoints are attached to the standby ENI after failover.
+	eniName, eniMACAddress := agent.activeENI(nw.Name, args.ENIName, args.ENIMACAddress)
+	sharedENI, err := agent.resolveENI(eniName, eniMACAddress)
+	if err != nil {
+		log.Errorf("Failed to find ENI %s: %v.", eniName, err)
+		return err
+	}
+	nw.SharedENI = sharedENI
+
+	err = agent.findOrCreateNetwork(nw)
+	if err == nil {
+		err = agent.retry("FindOrCreateEndpoint", func() error {
+			return agent.nb.FindOrCreateEndpoint(nw, ep)
+		})
+		if err != nil {
+			// The network may have been deleted underneath. Find it again next time.
+			delete(agent.networks, nw.Name)
+		}
+	}
+	agent.recordNetworkResult(err)
+	if err != nil {
+		log.Errorf("Failed to attach endpoint for container %s: %v.", ep.ContainerID, err)
+		return err
+	}
+
+	log.Infof("Attached endpoint for container %s to network %s.", ep.ContainerID, nw.Name)
+	reply.MACAddress = ep.MACAddress.String()
+
+	if args.StandbyENIName != "" || args.StandbyENIMACAddress != "" {
+		agent.addFailoverEndpoint(args, nw, ep)
+	}
+
+	err = agent.updateEndpoints(func(endpoints map[string]EndpointInfo) {
+		info := EndpointInfo{
+			NetworkName: nw.Name,
+			ContainerID: ep.ContainerID,
+			IfName:      ep.IfName,
+			MACAddress:  reply.MACAddress,
+			AttachedAt:  time.Now(),
+		}
+		if ep.IPAddress != nil {
+			info.IPAddress = ep.IPAddress.String()
+		}
+		endpoints[endpointKey(ep)] = info
+	})
+	if err != nil {
+		log.Errorf("Failed to record endpoint for container %s: %v.", ep.ContainerID, err)
+	}
+
+	return nil
+}
+
+// DetachEndpoint detaches the endpoint from the network.
+func (svc *service) DetachEndpoint(args *DetachEndpointArgs, reply *DetachEndpointReply) error {
+	agent := svc.agent
+	nw := &args.Network
+	ep := &args.Endpoint
+
+	unlock := agent.lockNetwork(nw.Name)
+	defer unlock()
+
+	eniName, eniMACAddress := agent.activeENI(nw.Name, args.ENIName, args.ENIMACAddress)
+	sharedENI, err := agent.resolveENI(eniName, eniMACAddress)
+	if err != nil {
+		log.Errorf("Failed to find ENI %s: %v.", eniName, err)
+		return err
+	}
+	nw.SharedENI = sharedENI
+
+	if bridgeIndex, ok := agent.networks[nw.Name]; ok {
+		nw.BridgeIndex = bridgeIndex
+	}
+
+	err = agent.retry("DeleteEndpoint", func() error {
+		return agent.nb.DeleteEndpoint(nw, ep)
+	})
+	if err != nil {
+		log.Errorf("Failed to detach endpoint for container %s: %v.", ep.ContainerID, err)
+		return err
+	}
+
+	log.Infof("Detached endpoint for container %s from network %s.", ep.ContainerID, nw.Name)
+	agent.removeFailoverEndpoint(nw.Name, ep)
+
+	err = agent.updateEndpoints(func(endpoints map[string]EndpointInfo) {
+		delete(endpoints, endpointKey(ep))
+	})
+	if err != nil {
+		log.Errorf("Failed to forget endpoint for container %s: %v.", ep.ContainerID, err)
+	}
+
+	return nil
+}
+
+// ListEndpoints lists the endpoints attached by the agent.
+func (svc *service) ListEndpoints(args *ListEndpointsArgs, reply *ListEndpointsReply) error {
+	endpoints := make(map[string]EndpointInfo)
+	path := filepath.Join(svc.agent.config.StateDir, endpointsFileName)
+	_, err := state.ReadJournaledFile(path, &endpoints)
+	if err != nil {
+		return err
+	}
+
+	reply.Endpoints = []EndpointInfo{}
+	for _, info := range endpoints {
+		reply.Endpoints = append(reply.Endpoints, info)
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cleanup"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAgent(t *testing.T) (*Agent, *fake.Builder, func()) {
+	dir, err := ioutil.TempDir("", "agent")
+	require.NoError(t, err)
+
+	fb := fake.NewBuilder()
+	agent := NewAgent(Config{
+		StateDir:      dir,
+		SocketPath:    filepath.Join(dir, "agent.sock"),
+		RetryInterval: time.Millisecond,
+	}, fb)
+	agent.resolveENI = func(name string, macAddress string) (*eni.ENI, error) {
+		return eni.NewENI(name, nil)
+	}
+
+	require.NoError(t, agent.Start())
+
+	return agent, fb, func() {
+		agent.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestEndpoint(containerID string) (*network.Network, *network.Endpoint) {
+	sharedENI, _ := eni.NewENI("eth1", nil)
+	ip, ipNet, _ := net.ParseCIDR("10.0.1.20/24")
+	ipNet.IP = ip
+
+	nw := &network.Network{Name: "vpc", SharedENI: sharedENI}
+	ep := &network.Endpoint{ContainerID: containerID, IfName: "eth0", IPAddress: ipNet}
+	return nw, ep
+}
+
+func TestAttachDetachAndListEndpoints(t *testing.T) {
+	agent, fb, cleanup := newTestAgent(t)
+	defer cleanup()
+
+	nb := NewBuilder(agent.config.SocketPath)
+
+	nw, ep := newTestEndpoint("container1")
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	assert.NotNil(t, ep.MACAddress)
+	assert.True(t, fb.HasEndpoint("container1"))
+
+	// The network is cached after the first attach.
+	nw, ep = newTestEndpoint("container2")
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	var networkCalls int
+	for _, call := range fb.Calls() {
+		if call.Op == fake.OpFindOrCreateNetwork {
+			networkCalls++
+		}
+	}
+	assert.Equal(t, 1, networkCalls)
+
+	endpoints, err := nb.client.ListEndpoints()
+	require.NoError(t, err)
+	assert.Len(t, endpoints, 2)
+
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	assert.False(t, fb.HasEndpoint("container2"))
+
+	endpoints, err = nb.client.ListEndpoints()
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "container1", endpoints[0].ContainerID)
+	assert.Equal(t, "10.0.1.20/24", endpoints[0].IPAddress)
+}
+
+func TestAttachEndpointRetries(t *testing.T) {
+	agent, fb, cleanup := newTestAgent(t)
+	defer cleanup()
+
+	fb.Failures[fake.OpFindOrCreateNetwork] = fmt.Errorf("injected failure")
+
+	nw, ep := newTestEndpoint("container1")
+	err := NewBuilder(agent.config.SocketPath).FindOrCreateEndpoint(nw, ep)
+	assert.Error(t, err)
+	assert.Len(t, fb.Calls(), DefaultMaxRetries+1)
+
+	counters, err := state.LoadCounters(agent.config.StateDir)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(DefaultMaxRetries), counters[state.CounterAttachRetries])
+	assert.Equal(t, uint64(1), counters[state.CounterConsecutiveNetworkFailures])
+}
+
+func TestClientFailsWithoutAgent(t *testing.T) {
+	_, err := NewClient("/nonexistent/agent.sock").ListEndpoints()
+	assert.Error(t, err)
+}
+
+func TestFailoverToStandbyENI(t *testing.T) {
+	agent, fb, cleanup := newTestAgent(t)
+	defer cleanup()
+
+	var resolved []string
+	agent.resolveENI = func(name string, macAddress string) (*eni.ENI, error) {
+		resolved = append(resolved, name)
+		return eni.NewENI(name, nil)
+	}
+	agent.checkENI = func(name string, macAddress string) error {
+		if name == "eth1" {
+			return fmt.Errorf("link %s is down", name)
+		}
+		return nil
+	}
+
+	nb := NewBuilder(agent.config.SocketPath)
+	nw, ep := newTestEndpoint("container1")
+	nw.StandbyENI, _ = eni.NewENI("eth2", nil)
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	// The ENI fails over after the threshold of consecutive failed health checks.
+	for i := 0; i < DefaultFailureThreshold-1; i++ {
+		agent.checkFailoverGroups()
+	}
+	assert.Len(t, fb.Calls(), 2)
+
+	agent.checkFailoverGroups()
+	calls := fb.Calls()
+	require.Len(t, calls, 5)
+	assert.Equal(t, fake.OpFindOrCreateNetwork, calls[2].Op)
+	assert.Equal(t, fake.OpDeleteEndpoint, calls[3].Op)
+	assert.Equal(t, fake.OpFindOrCreateEndpoint, calls[4].Op)
+	assert.Equal(t, "container1", calls[4].ContainerID)
+	assert.Equal(t, []string{"eth1", "eth2"}, resolved)
+
+	counters, err := state.LoadCounters(agent.config.StateDir)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), counters[state.CounterENIFailovers])
+
+	// Healthy standby ENIs stay active.
+	agent.checkFailoverGroups()
+	assert.Len(t, fb.Calls(), 5)
+
+	// Endpoints are detached from the active ENI.
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	assert.Equal(t, "eth2", resolved[len(resolved)-1])
+	assert.Nil(t, agent.getFailoverGroup("vpc"))
+}
+
+func TestReapNetworks(t *testing.T) {
+	agent, fb, cleanup := newTestAgent(t)
+	defer cleanup()
+	agent.listEndpoints = fb.ListEndpoints
+
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	require.NotEmpty(t, interfaces)
+	sharedENI, err := eni.NewENI(interfaces[0].Name, nil)
+	require.NoError(t, err)
+	require.NoError(t, sharedENI.AttachToLink())
+
+	pluginStateDir, err := ioutil.TempDir("", "plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(pluginStateDir)
+	agent.config.ReapStateDir = pluginStateDir
+
+	// Mark an unused and a used network for deletion.
+	for _, name := range []string{"unused", "used"} {
+		nw := &network.Network{Name: name, SharedENI: sharedENI}
+		require.NoError(t, fb.FindOrCreateNetwork(nw))
+		require.NoError(t, network.MarkForDeletion(pluginStateDir, nw))
+	}
+	require.NoError(t, fb.FindOrCreateEndpoint(&network.Network{Name: "used"}, &network.Endpoint{ContainerID: "c1"}))
+
+	agent.reapNetworksOnce()
+	assert.False(t, fb.HasNetwork("unused"))
+	assert.True(t, fb.HasNetwork("used"))
+
+	// Networks in use are no longer marked for deletion.
+	pending := make(map[string]network.PendingDeletion)
+	_, err = state.ReadJSONFile(filepath.Join(pluginStateDir, network.PendingDeletionsFileName), &pending)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestReconcile(t *testing.T) {
+	agent, fb, done := newTestAgent(t)
+	defer done()
+	agent.listEndpoints = fb.ListEndpoints
+
+	var cleaned *cleanup.Config
+	agent.config.Reconcile = &cleanup.Config{Runtime: "cri"}
+	agent.runCleanup = func(config *cleanup.Config) (*cleanup.Report, error) {
+		cleaned = config
+		return &cleanup.Report{}, nil
+	}
+
+	nw, ep := newTestEndpoint("container1")
+	require.NoError(t, fb.FindOrCreateNetwork(nw))
+	require.NoError(t, fb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, agent.updateEndpoints(func(endpoints map[string]EndpointInfo) {
+		endpoints["container1/eth0"] = EndpointInfo{ContainerID: "container1"}
+		endpoints["container2/eth0"] = EndpointInfo{ContainerID: "container2"}
+	}))
+
+	agent.reconcile()
+	assert.Equal(t, agent.config.Reconcile, cleaned)
+
+	// Only endpoints that still exist are remembered.
+	endpoints := make(map[string]EndpointInfo)
+	_, err := state.ReadJournaledFile(filepath.Join(agent.config.StateDir, endpointsFileName), &endpoints)
+	require.NoError(t, err)
+	assert.Contains(t, endpoints, "container1/eth0")
+	assert.NotContains(t, endpoints, "container2/eth0")
+}
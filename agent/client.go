@@ -0,0 +1,154 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/rpc/jsonrpc"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+)
+
+const (
+	// dialTimeout is the timeout for connecting to the agent.
+	dialTimeout = 5 * time.Second
+)
+
+// Client is a client for the agent used by CNI plugins.
+type Client struct {
+	socketPath string
+}
+
+// Builder implements network.Builder by delegating operations to the agent, so that CNI
+// plugins remain thin executables while the agent owns the host network configuration.
+type Builder struct {
+	client *Client
+}
+
+// NewClient creates a new Client object for the agent listening on the given socket.
+func NewClient(socketPath string) *Client {
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+
+	return &Client{socketPath: socketPath}
+}
+
+// NewBuilder creates a new Builder object for the agent listening on the given socket.
+func NewBuilder(socketPath string) *Builder {
+	return &Builder{client: NewClient(socketPath)}
+}
+
+// AttachEndpoint requests the agent to attach an endpoint to a network, creating the network
+// if necessary. It returns the MAC address of the endpoint.
+func (c *Client) AttachEndpoint(nw *network.Network, ep *network.Endpoint) (net.HardwareAddr, error) {
+	args := AttachEndpointArgs{Network: *nw, Endpoint: *ep}
+	args.ENIName, args.ENIMACAddress = eniArgs(nw.SharedENI)
+	args.StandbyENIName, args.StandbyENIMACAddress = eniArgs(nw.StandbyENI)
+
+	var reply AttachEndpointReply
+	err := c.call("AttachEndpoint", &args, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	macAddress, err := net.ParseMAC(reply.MACAddress)
+	if err != nil {
+		return nil, fmt.Errorf("agent: invalid endpoint MAC address %s", reply.MACAddress)
+	}
+
+	return macAddress, nil
+}
+
+// DetachEndpoint requests the agent to detach an endpoint from a network.
+func (c *Client) DetachEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	args := DetachEndpointArgs{Network: *nw, Endpoint: *ep}
+	args.ENIName, args.ENIMACAddress = eniArgs(nw.SharedENI)
+
+	var reply DetachEndpointReply
+	return c.call("DetachEndpoint", &args, &reply)
+}
+
+// ListEndpoints returns the endpoints attached by the agent.
+func (c *Client) ListEndpoints() ([]EndpointInfo, error) {
+	var reply ListEndpointsReply
+	err := c.call("ListEndpoints", &ListEndpointsArgs{}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Endpoints, nil
+}
+
+// call invokes a method of the agent's RPC service.
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	conn, err := net.DialTimeout("unix", c.socketPath, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("agent: failed to connect to %s: %v", c.socketPath, err)
+	}
+
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
+
+	err = client.Call(serviceName+"."+method, args, reply)
+	if err != nil {
+		return fmt.Errorf("agent: %s failed: %v", method, err)
+	}
+
+	return nil
+}
+
+// eniArgs returns the link name and MAC address identifying an ENI.
+func eniArgs(sharedENI *eni.ENI) (string, string) {
+	if sharedENI == nil {
+		return "", ""
+	}
+
+	var macAddress string
+	if sharedENI.GetMACAddress() != nil {
+		macAddress = sharedENI.GetMACAddress().String()
+	}
+
+	return sharedENI.GetLinkName(), macAddress
+}
+
+// FindOrCreateNetwork is a no-op, as the agent finds or creates the network when attaching
+// an endpoint to it.
+func (nb *Builder) FindOrCreateNetwork(nw *network.Network) error {
+	return nil
+}
+
+// DeleteNetwork is not supported, as networks are shared by all endpoints the agent manages.
+func (nb *Builder) DeleteNetwork(nw *network.Network) error {
+	return fmt.Errorf("agent: deleting networks is not supported")
+}
+
+// FindOrCreateEndpoint attaches the endpoint through the agent.
+func (nb *Builder) FindOrCreateEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	macAddress, err := nb.client.AttachEndpoint(nw, ep)
+	if err != nil {
+		return err
+	}
+
+	ep.MACAddress = macAddress
+	return nil
+}
+
+// DeleteEndpoint detaches the endpoint through the agent.
+func (nb *Builder) DeleteEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	return nb.client.DetachEndpoint(nw, ep)
+}
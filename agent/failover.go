@@ -0,0 +1,248 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+)
+
+// eniID identifies an ENI by its link name and MAC address.
+type eniID struct {
+	name       string
+	macAddress string
+}
+
+// failoverGroup is a network wired to an active ENI, with a standby ENI that takes over its
+// endpoints when the active ENI fails health checks. Failover re-attaches every endpoint to
+// the standby ENI, which must be able to carry the endpoint IP addresses. Groups are kept in
+// memory and are guarded by the network lock.
+type failoverGroup struct {
+	active    eniID
+	standby   eniID
+	failures  int
+	network   network.Network
+	endpoints map[string]network.Endpoint
+}
+
+// getFailoverGroup returns the failover group of the given network, if any.
+func (agent *Agent) getFailoverGroup(name string) *failoverGroup {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	return agent.failoverGroups[name]
+}
+
+// activeENI returns the ENI that currently carries the endpoints of the given network.
+// Must be called with the network lock held.
+func (agent *Agent) activeENI(networkName string, name string, macAddress string) (string, string) {
+	group := agent.getFailoverGroup(networkName)
+	if group == nil {
+		return name, macAddress
+	}
+
+	return group.active.name, group.active.macAddress
+}
+
+// addFailoverEndpoint adds an attached endpoint to the failover group of its network, creating
+// the group if necessary. Must be called with the network lock held.
+func (agent *Agent) addFailoverEndpoint(args *AttachEndpointArgs, nw *network.Network, ep *network.Endpoint) {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	group, ok := agent.failoverGroups[nw.Name]
+	if !ok {
+		group = &failoverGroup{
+			active:    eniID{name: args.ENIName, macAddress: args.ENIMACAddress},
+			standby:   eniID{name: args.StandbyENIName, macAddress: args.StandbyENIMACAddress},
+			endpoints: make(map[string]network.Endpoint),
+		}
+		agent.failoverGroups[nw.Name] = group
+		log.Infof("Monitoring ENI %s of network %s with standby ENI %s.",
+			group.active, nw.Name, group.standby)
+	}
+
+	group.network = *nw
+	group.endpoints[endpointKey(ep)] = *ep
+}
+
+// removeFailoverEndpoint removes a detached endpoint from the failover group of its network,
+// deleting the group when it becomes empty. Must be called with the network lock held.
+func (agent *Agent) removeFailoverEndpoint(networkName string, ep *network.Endpoint) {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	group, ok := agent.failoverGroups[networkName]
+	if !ok {
+		return
+	}
+
+	delete(group.endpoints, endpointKey(ep))
+	if len(group.endpoints) == 0 {
+		delete(agent.failoverGroups, networkName)
+	}
+}
+
+// monitorENIs periodically checks the health of the active ENIs of failover groups.
+func (agent *Agent) monitorENIs() {
+	ticker := time.NewTicker(agent.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-agent.done:
+			return
+		case <-ticker.C:
+			agent.checkFailoverGroups()
+		}
+	}
+}
+
+// checkFailoverGroups checks the health of the active ENI of every failover group.
+func (agent *Agent) checkFailoverGroups() {
+	agent.lock.Lock()
+	names := make([]string, 0, len(agent.failoverGroups))
+	for name := range agent.failoverGroups {
+		names = append(names, name)
+	}
+	agent.lock.Unlock()
+
+	for _, name := range names {
+		agent.checkFailoverGroup(name)
+	}
+}
+
+// checkFailoverGroup checks the health of the active ENI of a network, and fails over to the
+// standby ENI after the configured number of consecutive failed checks.
+func (agent *Agent) checkFailoverGroup(networkName string) {
+	unlock := agent.lockNetwork(networkName)
+	defer unlock()
+
+	group := agent.getFailoverGroup(networkName)
+	if group == nil {
+		return
+	}
+
+	err := agent.checkENI(group.active.name, group.active.macAddress)
+	if err == nil {
+		group.failures = 0
+		return
+	}
+
+	group.failures++
+	log.Warnf("ENI %s of network %s failed health check %d of %d: %v.",
+		group.active, networkName, group.failures, agent.config.FailureThreshold, err)
+	if group.failures < agent.config.FailureThreshold {
+		return
+	}
+
+	// A failed failover is attempted again on the next check.
+	err = agent.failover(group)
+	if err != nil {
+		log.Errorf("Failed to fail over network %s to ENI %s: %v.", networkName, group.standby, err)
+	}
+}
+
+// failover re-attaches the endpoints of a failover group to its standby ENI, which becomes
+// the active ENI. Must be called with the network lock held.
+func (agent *Agent) failover(group *failoverGroup) error {
+	standbyENI, err := agent.resolveENI(group.standby.name, group.standby.macAddress)
+	if err != nil {
+		return err
+	}
+
+	oldNw := group.network
+	nw := group.network
+	nw.SharedENI = standbyENI
+	nw.BridgeIndex = 0
+
+	err = agent.retry("FindOrCreateNetwork", func() error {
+		return agent.nb.FindOrCreateNetwork(&nw)
+	})
+	if err != nil {
+		return err
+	}
+	agent.networks[nw.Name] = nw.BridgeIndex
+
+	for key, ep := range group.endpoints {
+		// The endpoint may have gone away with the failed ENI.
+		err = agent.nb.DeleteEndpoint(&oldNw, &ep)
+		if err != nil {
+			log.Errorf("Failed to delete endpoint for container %s, ignoring: %v.", ep.ContainerID, err)
+		}
+
+		err = agent.retry("FindOrCreateEndpoint", func() error {
+			return agent.nb.FindOrCreateEndpoint(&nw, &ep)
+		})
+		if err != nil {
+			log.Errorf("Failed to move endpoint for container %s to ENI %s: %v.",
+				ep.ContainerID, group.standby, err)
+			continue
+		}
+		group.endpoints[key] = ep
+
+		err = agent.updateEndpoints(func(endpoints map[string]EndpointInfo) {
+			if info, ok := endpoints[key]; ok {
+				info.MACAddress = ep.MACAddress.String()
+				endpoints[key] = info
+			}
+		})
+		if err != nil {
+			log.Errorf("Failed to record endpoint for container %s: %v.", ep.ContainerID, err)
+		}
+	}
+
+	log.Infof("Failed over network %s from ENI %s to ENI %s.", nw.Name, group.active, group.standby)
+
+	group.network = nw
+	group.active, group.standby = group.standby, group.active
+	group.failures = 0
+	agent.incrementCounter(state.CounterENIFailovers)
+
+	return nil
+}
+
+// checkENI returns an error if the link of the ENI with the given link name or MAC address
+// is missing or down.
+func checkENI(name string, macAddress string) error {
+	sharedENI, err := findENI(name, macAddress)
+	if err != nil {
+		return err
+	}
+
+	iface, err := net.InterfaceByIndex(sharedENI.GetLinkIndex())
+	if err != nil {
+		return err
+	}
+
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("link %s is down", iface.Name)
+	}
+
+	return nil
+}
+
+// String returns a string representation of the ENI identifier.
+func (id eniID) String() string {
+	if id.name != "" {
+		return id.name
+	}
+	return id.macAddress
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// authorizePeer returns an error if the peer process of the given connection is not allowed to
+// drive endpoint operations. All peers are allowed if no allowed peers are configured.
+func (agent *Agent) authorizePeer(conn net.Conn) error {
+	if len(agent.config.AllowedPeers) == 0 {
+		return nil
+	}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("agent: unexpected connection type %T", conn)
+	}
+
+	identity, err := peerIdentity(unixConn)
+	if err != nil {
+		return fmt.Errorf("agent: failed to get peer identity: %v", err)
+	}
+
+	// Windows security identifiers are case-insensitive.
+	for _, allowed := range agent.config.AllowedPeers {
+		if strings.EqualFold(identity, allowed) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("agent: peer %s is not allowed", identity)
+}
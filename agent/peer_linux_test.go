@@ -0,0 +1,69 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedPeers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	uid := strconv.Itoa(os.Getuid())
+	otherUID := strconv.Itoa(os.Getuid() + 1)
+
+	testCases := []struct {
+		allowedPeers []string
+		allowed      bool
+	}{
+		{nil, true},
+		{[]string{otherUID}, false},
+		{[]string{otherUID, uid}, true},
+	}
+
+	for _, tc := range testCases {
+		agent := NewAgent(Config{
+			StateDir:     dir,
+			SocketPath:   filepath.Join(dir, "agent.sock"),
+			AllowedPeers: tc.allowedPeers,
+		}, fake.NewBuilder())
+		require.NoError(t, agent.Start())
+
+		_, err = NewClient(agent.config.SocketPath).ListEndpoints()
+		agent.Stop()
+
+		if tc.allowed {
+			assert.NoError(t, err, "allowed peers: %v", tc.allowedPeers)
+		} else {
+			assert.Error(t, err, "allowed peers: %v", tc.allowedPeers)
+		}
+	}
+
+	// Rejected connections are counted.
+	counters, err := state.LoadCounters(dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), counters[state.CounterRejectedConnections])
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// sioAFUnixGetPeerPID is the socket I/O control code returning the process ID of the peer
+	// of a unix domain socket.
+	sioAFUnixGetPeerPID = 0x58000100
+
+	// processQueryLimitedInformation is the process access right to query its token.
+	processQueryLimitedInformation = 0x1000
+)
+
+// peerIdentity returns the security identifier of the user of the peer process of the given
+// connection.
+func peerIdentity(conn *net.UnixConn) (string, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+
+	var pid uint32
+	var ioctlErr error
+	err = rawConn.Control(func(fd uintptr) {
+		var bytesReturned uint32
+		ioctlErr = windows.WSAIoctl(windows.Handle(fd), sioAFUnixGetPeerPID, nil, 0,
+			(*byte)(unsafe.Pointer(&pid)), uint32(unsafe.Sizeof(pid)), &bytesReturned, nil, 0)
+	})
+	if err != nil {
+		return "", err
+	}
+	if ioctlErr != nil {
+		return "", ioctlErr
+	}
+
+	process, err := windows.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(process)
+
+	var token windows.Token
+	err = windows.OpenProcessToken(process, windows.TOKEN_QUERY, &token)
+	if err != nil {
+		return "", err
+	}
+	defer token.Close()
+
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+
+	return user.User.Sid.String(), nil
+}
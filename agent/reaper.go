@@ -0,0 +1,60 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	log "github.com/cihub/seelog"
+)
+
+// reapNetworks periodically deletes the networks that plugins marked for deletion after their
+// last endpoint was deleted, off the path of CNI commands.
+func (agent *Agent) reapNetworks() {
+	ticker := time.NewTicker(agent.config.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-agent.done:
+			return
+		case <-ticker.C:
+			agent.reapNetworksOnce()
+		}
+	}
+}
+
+// reapNetworksOnce deletes the networks marked for deletion that are still unused.
+func (agent *Agent) reapNetworksOnce() {
+	reaper := &network.Reaper{
+		StateDir:      agent.config.ReapStateDir,
+		Builder:       agent.nb,
+		ListEndpoints: agent.listEndpoints,
+	}
+
+	deleted, err := reaper.Reap(nil)
+	if err != nil {
+		log.Errorf("Failed to delete networks marked for deletion: %v.", err)
+	}
+
+	// Find or create deleted networks again when they are used next.
+	for _, name := range deleted {
+		log.Infof("Deleted network %s marked for deletion.", name)
+		unlock := agent.lockNetwork(name)
+		delete(agent.networks, name)
+		unlock()
+	}
+}
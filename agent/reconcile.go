@@ -0,0 +1,59 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agent
+
+import (
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// reconcile removes the plugin resources of sandboxes that the container runtime no longer
+// knows, which leak when the node reboots uncleanly or sandboxes die while the agent is down.
+// Endpoints that no longer exist are also forgotten. It runs once before the agent serves
+// requests, so that it does not race with endpoint attaches.
+func (agent *Agent) reconcile() {
+	report, err := agent.runCleanup(agent.config.Reconcile)
+	if err != nil {
+		log.Errorf("Failed to clean up resources of dead sandboxes: %v.", err)
+		return
+	}
+	log.Infof("Cleaned up resources of dead sandboxes %s.", report)
+
+	records, err := agent.listEndpoints()
+	if err != nil {
+		log.Errorf("Failed to list endpoints: %v.", err)
+		return
+	}
+
+	err = agent.updateEndpoints(func(endpoints map[string]EndpointInfo) {
+		for key, info := range endpoints {
+			found := false
+			for _, record := range records {
+				// Container IDs may be truncated in interface names.
+				if record.ContainerID != "" && strings.HasPrefix(info.ContainerID, record.ContainerID) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				log.Infof("Forgetting endpoint for container %s, it no longer exists.", info.ContainerID)
+				delete(endpoints, key)
+			}
+		}
+	})
+	if err != nil {
+		log.Errorf("Failed to forget endpoints: %v.", err)
+	}
+}
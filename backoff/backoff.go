@@ -0,0 +1,175 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package backoff retries operations that fail transiently, with exponentially increasing and
+// jittered intervals, so that sub-second hiccups in HNS, IMDS, netlink or external commands do
+// not turn into task launch failures.
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// DefaultMaxAttempts is the default maximum number of attempts of an operation.
+	DefaultMaxAttempts = 4
+	// DefaultInitialInterval is the default interval before the first retry.
+	DefaultInitialInterval = 100 * time.Millisecond
+	// DefaultMaxInterval is the default cap of the interval between retries.
+	DefaultMaxInterval = 2 * time.Second
+)
+
+// Policy is an exponential backoff policy. Intervals double after every attempt up to the cap,
+// and are randomized between half and all of their nominal value to spread out retries of
+// concurrent callers.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialInterval is the interval before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval is the cap of the interval between retries.
+	MaxInterval time.Duration
+}
+
+var (
+	// defaultPolicy is the policy used by operations that do not have their own.
+	defaultPolicy = Policy{
+		MaxAttempts:     DefaultMaxAttempts,
+		InitialInterval: DefaultInitialInterval,
+		MaxInterval:     DefaultMaxInterval,
+	}
+	defaultPolicyMutex sync.RWMutex
+
+	// random is the source of jitter.
+	random      = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomMutex sync.Mutex
+
+	// sleep is replaced in tests.
+	sleep = time.Sleep
+)
+
+// Default returns the default policy.
+func Default() Policy {
+	defaultPolicyMutex.RLock()
+	defer defaultPolicyMutex.RUnlock()
+	return defaultPolicy
+}
+
+// SetDefault sets the default policy. Zero fields keep their current values.
+func SetDefault(policy Policy) {
+	defaultPolicyMutex.Lock()
+	defer defaultPolicyMutex.Unlock()
+	defaultPolicy = defaultPolicy.merge(policy)
+}
+
+// Retry calls fn with the default policy until it succeeds, fails permanently or runs out of
+// attempts. Errors are classified with IsTransient.
+func Retry(op string, fn func() error) error {
+	return Default().Retry(op, fn, IsTransient)
+}
+
+// Retry calls fn until it succeeds, fails with an error that isTransient does not classify as
+// transient, or runs out of attempts. It returns the last error.
+func (policy Policy) Retry(op string, fn func() error, isTransient func(error) bool) error {
+	policy = Default().merge(policy)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= policy.MaxAttempts || !isTransient(err) {
+			break
+		}
+
+		interval := policy.Interval(attempt)
+		log.Infof("Retrying %s in %v after transient failure: %v.", op, interval, err)
+		sleep(interval)
+	}
+
+	return unwrap(err)
+}
+
+// Interval returns the jittered interval before the retry following the given attempt.
+func (policy Policy) Interval(attempt int) time.Duration {
+	interval := policy.InitialInterval
+	for i := 1; i < attempt && interval < policy.MaxInterval; i++ {
+		interval *= 2
+	}
+	if interval > policy.MaxInterval {
+		interval = policy.MaxInterval
+	}
+	if interval <= 0 {
+		return 0
+	}
+
+	randomMutex.Lock()
+	jitter := time.Duration(random.Int63n(int64(interval)/2 + 1))
+	randomMutex.Unlock()
+
+	return interval/2 + jitter
+}
+
+// merge returns the policy with its zero fields set from the given policy.
+func (policy Policy) merge(other Policy) Policy {
+	if other.MaxAttempts != 0 {
+		policy.MaxAttempts = other.MaxAttempts
+	}
+	if other.InitialInterval != 0 {
+		policy.InitialInterval = other.InitialInterval
+	}
+	if other.MaxInterval != 0 {
+		policy.MaxInterval = other.MaxInterval
+	}
+	return policy
+}
+
+// transientError marks an error as transient.
+type transientError struct {
+	err error
+}
+
+// Error returns the string representation of the wrapped error.
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+// Transient marks an error as transient, so that it is retried by Retry.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient returns whether the given error is transient. Errors marked with Transient, and
+// errors that report themselves as temporary, such as network timeouts, are transient.
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case *transientError:
+		return true
+	case interface{ Temporary() bool }:
+		return e.Temporary()
+	}
+	return false
+}
+
+// unwrap strips the transient marker from an error.
+func unwrap(err error) error {
+	if e, ok := err.(*transientError); ok {
+		return e.err
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package backoff
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noSleep replaces sleep with a recorder of the intervals slept.
+func noSleep() *[]time.Duration {
+	var intervals []time.Duration
+	sleep = func(d time.Duration) { intervals = append(intervals, d) }
+	return &intervals
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	intervals := noSleep()
+	defer func() { sleep = time.Sleep }()
+
+	attempts := 0
+	err := Retry("test", func() error {
+		attempts++
+		if attempts < 3 {
+			return Transient(fmt.Errorf("busy"))
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, *intervals, 2)
+}
+
+func TestRetryStopsOnPermanentError(t *testing.T) {
+	noSleep()
+	defer func() { sleep = time.Sleep }()
+
+	attempts := 0
+	err := Retry("test", func() error {
+		attempts++
+		return fmt.Errorf("not found")
+	})
+	assert.EqualError(t, err, "not found")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	noSleep()
+	defer func() { sleep = time.Sleep }()
+
+	attempts := 0
+	err := Policy{MaxAttempts: 2}.Retry("test", func() error {
+		attempts++
+		return Transient(fmt.Errorf("busy"))
+	}, IsTransient)
+	assert.EqualError(t, err, "busy")
+	assert.False(t, IsTransient(err))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestIntervalIsCappedAndJittered(t *testing.T) {
+	policy := Policy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second}
+	for attempt, nominal := range []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second,
+	} {
+		interval := policy.Interval(attempt + 1)
+		assert.True(t, interval >= nominal/2 && interval <= nominal, "%v %v", interval, nominal)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procStatPath is the path of the kernel statistics file that holds the boot time.
+const procStatPath = "/proc/stat"
+
+// BootTime returns the time the system booted.
+func BootTime() (time.Time, error) {
+	data, err := ioutil.ReadFile(procStatPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cleanup: failed to read %s: %v", procStatPath, err)
+	}
+
+	return parseBootTime(string(data))
+}
+
+// parseBootTime parses the boot time from the contents of /proc/stat.
+func parseBootTime(stat string) (time.Time, error) {
+	for _, line := range strings.Split(stat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cleanup: invalid boot time %s: %v", fields[1], err)
+		}
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("cleanup: boot time not found in %s", procStatPath)
+}
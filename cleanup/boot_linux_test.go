@@ -0,0 +1,37 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBootTime(t *testing.T) {
+	bootTime, err := parseBootTime("cpu  1 2 3 4\nintr 5 6\nctxt 7\nbtime 1570000000\nprocesses 8\n")
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1570000000, 0), bootTime)
+
+	_, err = parseBootTime("cpu  1 2 3 4\n")
+	assert.Error(t, err)
+}
+
+func TestBootTime(t *testing.T) {
+	bootTime, err := BootTime()
+	require.NoError(t, err)
+	assert.True(t, bootTime.Before(time.Now()))
+}
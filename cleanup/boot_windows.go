@@ -0,0 +1,35 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"syscall"
+	"time"
+)
+
+var (
+	// procGetTickCount64 returns the number of milliseconds since the system booted.
+	procGetTickCount64 = syscall.NewLazyDLL("kernel32.dll").NewProc("GetTickCount64")
+)
+
+// BootTime returns the time the system booted.
+func BootTime() (time.Time, error) {
+	err := procGetTickCount64.Find()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	ticks, _, _ := procGetTickCount64.Call()
+	return time.Now().Add(-time.Duration(ticks) * time.Millisecond), nil
+}
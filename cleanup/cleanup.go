@@ -0,0 +1,150 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// DefaultMinAge is the default minimum age of plugin state before it is considered orphaned.
+	DefaultMinAge = 5 * time.Minute
+)
+
+// Config is the configuration for a cleanup run.
+type Config struct {
+	// Runtime is the container runtime queried for live sandboxes.
+	Runtime string
+	// StateRootDir is the root directory of plugin state.
+	StateRootDir string
+	// MinAge is the minimum age of plugin state before it is considered orphaned, which
+	// protects resources of sandboxes that are still being set up.
+	MinAge time.Duration
+	// BootTime is the time the system booted, if set. Sandboxes cannot be set up across reboots,
+	// so state created before the boot is considered orphaned regardless of its age.
+	BootTime time.Time
+	// DryRun logs orphans without removing them.
+	DryRun bool
+	// OwnerID is the ID of the CNI stack whose resources are cleaned up. Resources of other
+	// CNI stacks on the node are never removed.
+	OwnerID string
+}
+
+// Report summarizes the orphans found, and removed unless in dry-run mode, in a cleanup run.
+type Report struct {
+	Allocations int
+	Endpoints   int
+	Networks    int
+	Routes      int
+}
+
+// cleaner removes resources that do not belong to any live sandbox.
+type cleaner struct {
+	config *Config
+	live   sandboxSet
+	report Report
+}
+
+// Run compares plugin state and the host network configuration with the live sandboxes of the
+// container runtime, and removes orphaned IP address allocations, endpoints, networks and routes.
+func Run(config *Config) (*Report, error) {
+	// Never remove anything without an authoritative list of live sandboxes.
+	live, err := ListSandboxes(config.Runtime)
+	if err != nil {
+		return nil, fmt.Errorf("cleanup: failed to list sandboxes: %v", err)
+	}
+
+	log.Infof("Found %d live sandboxes.", len(live))
+
+	c := &cleaner{
+		config: config,
+		live:   live,
+	}
+
+	released := c.cleanState()
+	c.cleanNetworks(released)
+
+	return &c.report, nil
+}
+
+// String returns a summary of the report.
+func (report *Report) String() string {
+	return fmt.Sprintf("allocations:%d endpoints:%d networks:%d routes:%d",
+		report.Allocations, report.Endpoints, report.Networks, report.Routes)
+}
+
+// cleanState releases IP address allocations of sandboxes that no longer exist from the IPAM
+// pools of all plugins. Returns the released addresses.
+func (c *cleaner) cleanState() []*net.IPNet {
+	var released []*net.IPNet
+
+	dirs, err := ioutil.ReadDir(c.config.StateRootDir)
+	if err != nil {
+		log.Infof("Failed to read state directory %s, skipping: %v.", c.config.StateRootDir, err)
+		return nil
+	}
+
+	now := time.Now()
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		stateDir := filepath.Join(c.config.StateRootDir, dir.Name())
+		names, err := ipam.ListPools(stateDir)
+		if err != nil {
+			log.Errorf("Failed to list IPAM pools in %s: %v.", stateDir, err)
+			continue
+		}
+
+		for _, name := range names {
+			pool := ipam.NewPool(stateDir, name, nil)
+			pool.SetOwner(c.config.OwnerID)
+			orphans, err := pool.ReleaseIf(func(containerID string, allocatedAt time.Time) bool {
+				orphaned := !c.live.contains(containerID) &&
+					(now.Sub(allocatedAt) >= c.config.MinAge || allocatedAt.Before(c.config.BootTime))
+				if orphaned {
+					c.report.Allocations++
+					log.Infof("Found orphaned allocation for container %s in pool %s/%s.",
+						containerID, dir.Name(), name)
+				}
+				return orphaned && !c.config.DryRun
+			})
+			if err != nil {
+				log.Errorf("Failed to release orphaned allocations in pool %s/%s: %v.",
+					dir.Name(), name, err)
+				continue
+			}
+
+			for _, address := range orphans {
+				ipAddress, ipNet, err := net.ParseCIDR(address)
+				if err != nil {
+					continue
+				}
+				ipNet.IP = ipAddress
+				released = append(released, ipNet)
+			}
+		}
+	}
+
+	return released
+}
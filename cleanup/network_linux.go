@@ -0,0 +1,168 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+
+	log "github.com/cihub/seelog"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// Link name formats used by the vpc-shared-eni and vpc-bridge plugins.
+	bridgeNameSeparator = "br"
+	dummyNameFormat     = "%sdummy"
+	vethLinkNamePrefix  = "veth"
+	vethLinkIDLength    = 8
+)
+
+// cleanNetworks removes bridges of ENIs that no longer exist, veth links of sandboxes that no
+// longer exist, and routes to the released IP addresses of those sandboxes.
+func (c *cleaner) cleanNetworks(released []*net.IPNet) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		log.Errorf("Failed to list links: %v.", err)
+		return
+	}
+
+	// Find the bridges created by the plugins, identified by their dummy links, and owned by
+	// the CNI stack being cleaned up.
+	bridges := make(map[int]netlink.Link)
+	names := make(map[string]bool)
+	for _, link := range links {
+		names[link.Attrs().Name] = true
+	}
+	for _, link := range links {
+		if link.Type() == "bridge" && names[fmt.Sprintf(dummyNameFormat, link.Attrs().Name)] &&
+			c.owns(link) {
+			bridges[link.Attrs().Index] = link
+		}
+	}
+
+	for _, link := range links {
+		if link.Type() != "veth" || bridges[link.Attrs().MasterIndex] == nil || !c.owns(link) {
+			continue
+		}
+
+		id := strings.TrimPrefix(link.Attrs().Name, vethLinkNamePrefix)
+		if len(id) != vethLinkIDLength || c.live.contains(id) {
+			continue
+		}
+
+		log.Infof("Found orphaned veth link %s.", link.Attrs().Name)
+		c.report.Endpoints++
+		if !c.config.DryRun {
+			err = netlink.LinkDel(link)
+			if err != nil {
+				log.Errorf("Failed to delete veth link %s: %v.", link.Attrs().Name, err)
+			}
+		}
+	}
+
+	for _, bridge := range bridges {
+		if c.isOrphanedBridge(bridge) {
+			c.deleteBridge(bridge)
+			continue
+		}
+		c.deleteRoutes(bridge, released)
+	}
+}
+
+// owns returns whether the given link is owned by the CNI stack being cleaned up.
+func (c *cleaner) owns(link netlink.Link) bool {
+	return owner.FromAlias(link.Attrs().Alias) == c.config.OwnerID
+}
+
+// isOrphanedBridge returns whether the ENI that the given bridge was created for no longer exists.
+func (c *cleaner) isOrphanedBridge(bridge netlink.Link) bool {
+	name := bridge.Attrs().Name
+	i := strings.LastIndex(name, bridgeNameSeparator)
+	if i < 0 {
+		return false
+	}
+
+	eniIndex, err := strconv.Atoi(name[i+len(bridgeNameSeparator):])
+	if err != nil {
+		return false
+	}
+
+	_, err = netlink.LinkByIndex(eniIndex)
+	_, notFound := err.(netlink.LinkNotFoundError)
+	return notFound
+}
+
+// deleteBridge deletes an orphaned bridge and its dummy link.
+func (c *cleaner) deleteBridge(bridge netlink.Link) {
+	name := bridge.Attrs().Name
+	log.Infof("Found orphaned bridge %s.", name)
+	c.report.Networks++
+	if c.config.DryRun {
+		return
+	}
+
+	dummy, err := netlink.LinkByName(fmt.Sprintf(dummyNameFormat, name))
+	if err == nil {
+		err = netlink.LinkDel(dummy)
+	}
+	if err == nil {
+		err = netlink.LinkDel(bridge)
+	}
+	if err != nil {
+		log.Errorf("Failed to delete bridge %s: %v.", name, err)
+	}
+}
+
+// deleteRoutes deletes host routes to the given released IP addresses from the given bridge.
+func (c *cleaner) deleteRoutes(bridge netlink.Link, released []*net.IPNet) {
+	if len(released) == 0 {
+		return
+	}
+
+	routes, err := netlink.RouteList(bridge, netlink.FAMILY_ALL)
+	if err != nil {
+		log.Errorf("Failed to list routes of bridge %s: %v.", bridge.Attrs().Name, err)
+		return
+	}
+
+	for _, route := range routes {
+		if route.Dst == nil {
+			continue
+		}
+		ones, bits := route.Dst.Mask.Size()
+		if ones != bits {
+			continue
+		}
+
+		for _, ipAddress := range released {
+			if !route.Dst.IP.Equal(ipAddress.IP) {
+				continue
+			}
+
+			log.Infof("Found orphaned route %s dev %s.", route.Dst, bridge.Attrs().Name)
+			c.report.Routes++
+			if !c.config.DryRun {
+				err = netlink.RouteDel(&route)
+				if err != nil {
+					log.Errorf("Failed to delete route %s: %v.", route.Dst, err)
+				}
+			}
+		}
+	}
+}
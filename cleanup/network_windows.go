@@ -0,0 +1,126 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+
+	"github.com/Microsoft/hcsshim"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// hnsEndpointNamePrefix is the prefix of the names of HNS endpoints created by the plugins.
+	hnsEndpointNamePrefix = "cid-"
+)
+
+var (
+	// hnsNetworkNameRegexp matches the names of HNS networks created by the plugins, which end
+	// with the MAC address of the shared ENI before the owner ID suffix.
+	hnsNetworkNameRegexp = regexp.MustCompile(`br([0-9a-f]{12})$`)
+)
+
+// cleanNetworks removes HNS endpoints of sandboxes that no longer exist, and HNS networks of
+// ENIs that no longer exist. Routes are HNS endpoint policies and are removed with endpoints.
+func (c *cleaner) cleanNetworks(released []*net.IPNet) {
+	networks, err := hcsshim.HNSListNetworkRequest("GET", "", "")
+	if err != nil {
+		log.Errorf("Failed to list HNS networks: %v.", err)
+		return
+	}
+
+	endpoints, err := hcsshim.HNSListEndpointRequest()
+	if err != nil {
+		log.Errorf("Failed to list HNS endpoints: %v.", err)
+		return
+	}
+
+	// Find the networks created by the plugins and owned by the CNI stack being cleaned up.
+	ours := make(map[string]bool)
+	for _, network := range networks {
+		baseName, ownerID := owner.SplitName(network.Name)
+		if hnsNetworkNameRegexp.MatchString(baseName) && ownerID == c.config.OwnerID {
+			ours[network.Name] = true
+		}
+	}
+
+	inUse := make(map[string]bool)
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		if !ours[endpoint.VirtualNetworkName] {
+			continue
+		}
+
+		endpointName, ownerID := owner.SplitName(endpoint.Name)
+		id := strings.TrimPrefix(endpointName, hnsEndpointNamePrefix)
+		if id == endpointName || id == "" || ownerID != c.config.OwnerID || c.live.contains(id) {
+			inUse[endpoint.VirtualNetworkName] = true
+			continue
+		}
+
+		log.Infof("Found orphaned HNS endpoint %s.", endpoint.Name)
+		c.report.Endpoints++
+		if !c.config.DryRun {
+			_, err = endpoint.Delete()
+			if err != nil {
+				log.Errorf("Failed to delete HNS endpoint %s: %v.", endpoint.Name, err)
+				inUse[endpoint.VirtualNetworkName] = true
+			}
+		}
+	}
+
+	macAddresses := c.listMACAddresses()
+	for i := range networks {
+		network := &networks[i]
+		if !ours[network.Name] || inUse[network.Name] {
+			continue
+		}
+
+		baseName, _ := owner.SplitName(network.Name)
+		match := hnsNetworkNameRegexp.FindStringSubmatch(baseName)
+		if macAddresses == nil || macAddresses[match[1]] {
+			continue
+		}
+
+		log.Infof("Found orphaned HNS network %s.", network.Name)
+		c.report.Networks++
+		if !c.config.DryRun {
+			_, err = network.Delete()
+			if err != nil {
+				log.Errorf("Failed to delete HNS network %s: %v.", network.Name, err)
+			}
+		}
+	}
+}
+
+// listMACAddresses returns the MAC addresses of the host's network interfaces, formatted as in
+// HNS network names. Returns nil if the interfaces cannot be listed.
+func (c *cleaner) listMACAddresses() map[string]bool {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Errorf("Failed to list network interfaces: %v.", err)
+		return nil
+	}
+
+	macAddresses := make(map[string]bool)
+	for _, iface := range ifaces {
+		macAddresses[strings.Replace(iface.HardwareAddr.String(), ":", "", -1)] = true
+	}
+
+	return macAddresses
+}
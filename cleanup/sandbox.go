@@ -0,0 +1,85 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+)
+
+const (
+	// Supported container runtimes.
+	RuntimeCRI    = "cri"
+	RuntimeDocker = "docker"
+)
+
+var (
+	// runtimeCommands are the commands that list the IDs of all sandboxes of a runtime,
+	// including stopped ones that the orchestrator may still tear down through CNI DEL.
+	runtimeCommands = map[string][]string{
+		RuntimeCRI:    {"crictl", "pods", "--quiet", "--no-trunc"},
+		RuntimeDocker: {"docker", "ps", "--all", "--quiet", "--no-trunc"},
+	}
+)
+
+// sandboxSet is a set of live sandbox IDs.
+type sandboxSet map[string]bool
+
+// ListSandboxes returns the IDs of the sandboxes known to the given container runtime.
+func ListSandboxes(runtime string) (sandboxSet, error) {
+	cmd, ok := runtimeCommands[runtime]
+	if !ok {
+		return nil, fmt.Errorf("unsupported runtime %s", runtime)
+	}
+
+	output, err := command.Run(cmd[0], cmd[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSandboxes(output), nil
+}
+
+// parseSandboxes parses a list of sandbox IDs, one per line. Lines that are not valid container
+// IDs, such as warnings printed by runtime clients, are skipped, so that they cannot match the
+// truncated IDs of orphans and keep them alive.
+func parseSandboxes(output string) sandboxSet {
+	live := make(sandboxSet)
+	for _, line := range strings.Split(output, "\n") {
+		id := strings.TrimSpace(line)
+		if cni.ValidateContainerID(id) == nil {
+			live[id] = true
+		}
+	}
+	return live
+}
+
+// contains returns whether the given sandbox ID, which may be truncated as in the names of
+// network interfaces, belongs to a live sandbox.
+func (live sandboxSet) contains(id string) bool {
+	if live[id] {
+		return true
+	}
+
+	for liveID := range live {
+		if strings.HasPrefix(liveID, id) {
+			return true
+		}
+	}
+
+	return false
+}
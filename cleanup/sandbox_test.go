@@ -0,0 +1,60 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cleanup
+
+import (
+	"testing"
+	"testing/quick"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSandboxes(t *testing.T) {
+	live := parseSandboxes("0123456789abcdef\nfedcba9876543210\n\n")
+
+	assert.Len(t, live, 2)
+	assert.True(t, live.contains("0123456789abcdef"))
+	assert.True(t, live.contains("fedcba98"))
+	assert.False(t, live.contains("00000000"))
+	assert.False(t, live.contains("0123456789abcdef0"))
+}
+
+func TestParseSandboxesSkipsInvalidLines(t *testing.T) {
+	live := parseSandboxes("WARN[0000] runtime connect using default endpoints\n0123456789abcdef\n")
+
+	assert.Len(t, live, 1)
+	assert.False(t, live.contains("WARN"))
+}
+
+// TestParseSandboxesFuzz tests that parsing arbitrary output never panics and returns only
+// valid container IDs.
+func TestParseSandboxesFuzz(t *testing.T) {
+	f := func(output string) bool {
+		for id := range parseSandboxes(output) {
+			if cni.ValidateContainerID(id) != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	assert.NoError(t, quick.Check(f, &quick.Config{MaxCount: 10000}))
+}
+
+func TestListSandboxesUnsupportedRuntime(t *testing.T) {
+	_, err := ListSandboxes("rkt")
+	assert.Error(t, err)
+}
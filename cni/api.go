@@ -14,6 +14,8 @@
 package cni
 
 import (
+	"io"
+
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniVersion "github.com/containernetworking/cni/pkg/version"
 )
@@ -25,3 +27,81 @@ type API interface {
 	Del(args *cniSkel.CmdArgs) error
 	GetVersion() cniVersion.PluginInfo
 }
+
+// Checker is implemented by CNI plugins that support the CNI CHECK command, which verifies
+// that the container is still connected as configured by a previous ADD command.
+type Checker interface {
+	Check(args *cniSkel.CmdArgs) error
+}
+
+// StatusReporter is implemented by CNI plugins that support the CNI STATUS command, which reports
+// whether the plugin is ready to connect containers to the network in the given configuration.
+type StatusReporter interface {
+	Status(args *cniSkel.CmdArgs) error
+}
+
+// GarbageCollector is implemented by CNI plugins that support the CNI GC command, which deletes
+// the resources of attachments to the network in the given configuration that are not in its
+// list of valid attachments.
+type GarbageCollector interface {
+	GC(args *cniSkel.CmdArgs) error
+}
+
+// StateReconciler is implemented by CNI plugins that can rebuild their persistent state
+// from the live network configuration after the state is lost or corrupted.
+type StateReconciler interface {
+	ReconcileState() error
+}
+
+// EndpointMigrator is implemented by CNI plugins that can move the endpoint of an existing
+// container to a different network without replacing the container.
+type EndpointMigrator interface {
+	MigrateEndpoint(fromArgs *cniSkel.CmdArgs, toArgs *cniSkel.CmdArgs) error
+}
+
+// Prewarmer is implemented by CNI plugins that can prepare the host for the first container,
+// e.g. at instance boot, so that the first ADD command does not pay for cold caches.
+type Prewarmer interface {
+	Prewarm(args *cniSkel.CmdArgs) error
+}
+
+// StateAdopter is implemented by CNI plugins that sign their state files, and can adopt the
+// unsigned state files written before the host's signing key was set.
+type StateAdopter interface {
+	AdoptUnsignedState() error
+}
+
+// EndpointLister is implemented by CNI plugins that can list the container endpoints they
+// created, along with the container and pod each endpoint belongs to.
+type EndpointLister interface {
+	ListEndpoints(w io.Writer) error
+}
+
+// Soaker is implemented by CNI plugins that can create synthetic sandboxes and inject faults
+// into the network stack, for soak tests that qualify new hosts before fleet rollout.
+type Soaker interface {
+	// CreateSandbox creates a synthetic sandbox and returns its network namespace.
+	CreateSandbox(name string) (string, error)
+	// DeleteSandbox deletes a sandbox created by CreateSandbox.
+	DeleteSandbox(netns string) error
+	// SoakFaults returns the names of the faults that InjectFault supports.
+	SoakFaults() []string
+	// InjectFault injects the named fault while a command runs in the given sandbox.
+	InjectFault(fault string, netns string) error
+	// CountEndpoints returns the number of container endpoints on the host.
+	CountEndpoints() (int, error)
+}
+
+// ConfigGenerator is implemented by CNI plugins that can generate a network configuration list
+// for the host from the given command line arguments.
+type ConfigGenerator interface {
+	GenerateConfig(args []string, w io.Writer) error
+}
+
+// ConfigValidator is implemented by CNI plugins that can validate their network configuration
+// offline. ConfigSchema returns the JSON schema of the network configuration, and ValidateConfig
+// validates the constraints between fields of a configuration that matches the schema.
+type ConfigValidator interface {
+	ConfigSchema() string
+	ValidateConfig(netConfig []byte) error
+}
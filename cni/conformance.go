@@ -0,0 +1,377 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// conformanceSandbox is a sandbox that conformance scenarios connect to the network.
+type conformanceSandbox struct {
+	Netns  string
+	IfName string
+}
+
+// conformanceResult is the outcome of a conformance scenario.
+type conformanceResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// conformanceReport is the outcome of all conformance scenarios.
+type conformanceReport struct {
+	Plugin    string              `json:"plugin"`
+	Version   string              `json:"version"`
+	Passed    bool                `json:"passed"`
+	Scenarios []conformanceResult `json:"scenarios"`
+}
+
+// conformanceRunner runs the CNI interaction patterns of container runtimes against a plugin.
+type conformanceRunner struct {
+	plugin     *Plugin
+	stdinData  []byte
+	sandboxes  []conformanceSandbox
+	runID      string
+	containers map[string]*cniSkel.CmdArgs
+}
+
+// conformanceScenario is a scripted set of CNI commands. It returns an error if the plugin does
+// not behave as runtimes expect, and errSkipped if the plugin does not support the scenario.
+type conformanceScenario struct {
+	name string
+	run  func(r *conformanceRunner) error
+}
+
+// errSkipped is returned by conformance scenarios that the plugin does not support.
+var errSkipped = fmt.Errorf("skipped")
+
+// conformanceScenarios are the CNI interaction patterns of container runtimes.
+var conformanceScenarios = []conformanceScenario{
+	{
+		// Runtimes retry ADD commands that timed out, and expect the same result.
+		name: "duplicate ADD",
+		run: func(r *conformanceRunner) error {
+			first, err := r.add(0)
+			if err != nil {
+				return err
+			}
+			second, err := r.add(0)
+			if err != nil {
+				return fmt.Errorf("second ADD failed: %v", err)
+			}
+			if !reflect.DeepEqual(first, second) {
+				return fmt.Errorf("second ADD returned %s, expected %s", second, first)
+			}
+			return r.del(0)
+		},
+	},
+	{
+		// Runtimes send DEL commands for sandboxes whose ADD never ran or failed.
+		name: "DEL without ADD",
+		run: func(r *conformanceRunner) error {
+			return r.del(0)
+		},
+	},
+	{
+		// Runtimes send DEL commands again after restarting.
+		name: "duplicate DEL",
+		run: func(r *conformanceRunner) error {
+			_, err := r.add(0)
+			if err != nil {
+				return err
+			}
+			err = r.del(0)
+			if err != nil {
+				return err
+			}
+			err = r.del(0)
+			if err != nil {
+				return fmt.Errorf("second DEL failed: %v", err)
+			}
+			return nil
+		},
+	},
+	{
+		// Runtimes check sandboxes after restarting, in a new plugin process that only has the
+		// persistent state of the plugin.
+		name: "CHECK after restart",
+		run: func(r *conformanceRunner) error {
+			if _, ok := r.plugin.Commands.(Checker); !ok {
+				return errSkipped
+			}
+			_, err := r.add(0)
+			if err != nil {
+				return err
+			}
+			err = r.check(0)
+			if err != nil {
+				return err
+			}
+			err = r.del(0)
+			if err != nil {
+				return err
+			}
+			if r.check(0) == nil {
+				return fmt.Errorf("CHECK after DEL succeeded")
+			}
+			return nil
+		},
+	},
+	{
+		// Runtimes create and destroy sandboxes concurrently, so commands of different sandboxes
+		// interleave.
+		name: "interleaved sandboxes",
+		run: func(r *conformanceRunner) error {
+			_, err := r.add(0)
+			if err != nil {
+				return err
+			}
+			_, err = r.add(1)
+			if err != nil {
+				return err
+			}
+			err = r.del(0)
+			if err != nil {
+				return err
+			}
+			if _, ok := r.plugin.Commands.(Checker); ok {
+				err = r.check(1)
+				if err != nil {
+					return fmt.Errorf("sandbox was disrupted by DEL of another sandbox: %v", err)
+				}
+			}
+			_, err = r.add(0)
+			if err != nil {
+				return fmt.Errorf("ADD after DEL failed: %v", err)
+			}
+			err = r.del(1)
+			if err != nil {
+				return err
+			}
+			return r.del(0)
+		},
+	},
+}
+
+// runConformance runs the conformance scenarios against the plugin with the network
+// configuration on stdin, in the given comma-separated network namespaces, and returns an exit
+// code. Each scenario uses new container IDs and cleans up the sandboxes it connected.
+func (plugin *Plugin) runConformance(netnsList string) int {
+	stdinData, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to read network config from stdin: %v", err))
+		return 1
+	}
+
+	ifName := os.Getenv("CNI_IFNAME")
+	if ifName == "" {
+		ifName = "eth0"
+	}
+
+	var sandboxes []conformanceSandbox
+	for _, netns := range strings.Split(netnsList, ",") {
+		sandboxes = append(sandboxes, conformanceSandbox{Netns: netns, IfName: ifName})
+	}
+	if len(sandboxes) == 1 {
+		// Both sandboxes share the network namespace, under different interface names.
+		sandboxes = append(sandboxes, conformanceSandbox{Netns: sandboxes[0].Netns, IfName: ifName + "1"})
+	}
+
+	// Endpoint operations enter network namespaces, so keep this goroutine on the same OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	log.Infof("Plugin %s version %s running conformance scenarios.", plugin.Name, version.Version)
+	report := plugin.conformance(stdinData, sandboxes)
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to print conformance report: %v", err))
+		return 1
+	}
+	fmt.Println(string(reportJSON))
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// conformance runs the conformance scenarios and returns the report.
+func (plugin *Plugin) conformance(stdinData []byte, sandboxes []conformanceSandbox) *conformanceReport {
+	report := &conformanceReport{
+		Plugin:  plugin.Name,
+		Version: version.Version,
+		Passed:  true,
+	}
+
+	for _, scenario := range conformanceScenarios {
+		r := &conformanceRunner{
+			plugin:     plugin,
+			stdinData:  stdinData,
+			sandboxes:  sandboxes,
+			runID:      newRunID(),
+			containers: make(map[string]*cniSkel.CmdArgs),
+		}
+
+		result := conformanceResult{Name: scenario.name, Passed: true}
+		err := scenario.run(r)
+		if err == errSkipped {
+			result.Skipped = true
+		} else if err != nil {
+			result.Passed = false
+			result.Error = err.Error()
+			report.Passed = false
+		}
+		log.Infof("Conformance scenario %s: %+v.", scenario.name, result)
+
+		r.cleanup()
+		report.Scenarios = append(report.Scenarios, result)
+	}
+
+	return report
+}
+
+// args returns the CNI arguments of the given sandbox in the scenario.
+func (r *conformanceRunner) args(sandbox int) *cniSkel.CmdArgs {
+	return &cniSkel.CmdArgs{
+		ContainerID: fmt.Sprintf("conformance-%s-%d", r.runID, sandbox),
+		Netns:       r.sandboxes[sandbox].Netns,
+		IfName:      r.sandboxes[sandbox].IfName,
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+		StdinData:   r.stdinData,
+	}
+}
+
+// add runs an ADD command for the given sandbox and returns the addresses in its result.
+func (r *conformanceRunner) add(sandbox int) (string, error) {
+	args := r.args(sandbox)
+	r.containers[args.ContainerID] = args
+
+	var output []byte
+	err := captureStdout(&output, func() error {
+		return r.plugin.recoverCmd(validateCmd(r.plugin.Commands.Add))(args)
+	})
+	if err != nil {
+		return "", fmt.Errorf("ADD failed: %v", err)
+	}
+
+	var result struct {
+		IPs []struct {
+			Address string `json:"address"`
+		} `json:"ips"`
+	}
+	err = json.Unmarshal(output, &result)
+	if err != nil || len(result.IPs) == 0 {
+		return "", fmt.Errorf("ADD returned invalid result %q", output)
+	}
+
+	var addresses []string
+	for _, ip := range result.IPs {
+		addresses = append(addresses, ip.Address)
+	}
+	return strings.Join(addresses, ","), nil
+}
+
+// del runs a DEL command for the given sandbox.
+func (r *conformanceRunner) del(sandbox int) error {
+	args := r.args(sandbox)
+	err := captureStdout(nil, func() error {
+		return r.plugin.recoverCmd(validateCmd(r.plugin.Commands.Del))(args)
+	})
+	if err != nil {
+		return fmt.Errorf("DEL failed: %v", err)
+	}
+
+	delete(r.containers, args.ContainerID)
+	return nil
+}
+
+// check runs a CHECK command for the given sandbox.
+func (r *conformanceRunner) check(sandbox int) error {
+	checker := r.plugin.Commands.(Checker)
+	err := captureStdout(nil, func() error {
+		return r.plugin.recoverCmd(validateCmd(checker.Check))(r.args(sandbox))
+	})
+	if err != nil {
+		return fmt.Errorf("CHECK failed: %v", err)
+	}
+
+	return nil
+}
+
+// cleanup deletes the sandboxes left connected by a failed scenario.
+func (r *conformanceRunner) cleanup() {
+	for _, args := range r.containers {
+		err := captureStdout(nil, func() error { return r.plugin.Commands.Del(args) })
+		if err != nil {
+			log.Errorf("Failed to clean up container %s: %v.", args.ContainerID, err)
+		}
+	}
+}
+
+// captureStdout runs fn with stdout redirected, so that CNI results do not interleave with
+// the conformance report, and stores the output in output if not nil.
+func captureStdout(output *[]byte, fn func() error) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+
+	err = fn()
+
+	os.Stdout = stdout
+	w.Close()
+	data := <-done
+	r.Close()
+	if output != nil {
+		*output = data
+	}
+
+	return err
+}
+
+// newRunID returns a random ID that makes the container IDs of a scenario unique.
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
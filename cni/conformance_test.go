@@ -0,0 +1,116 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"fmt"
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conformanceAPI is a CNI plugin with in-memory state for conformance tests.
+type conformanceAPI struct {
+	endpoints   map[string]string
+	next        int
+	strictDel   bool
+	leakOnCheck bool
+}
+
+func (api *conformanceAPI) Add(args *cniSkel.CmdArgs) error {
+	key := args.ContainerID + "/" + args.IfName
+	address, ok := api.endpoints[key]
+	if !ok {
+		api.next++
+		address = fmt.Sprintf("10.0.1.%d/24", api.next)
+		api.endpoints[key] = address
+	}
+
+	ipNet, err := cniTypes.ParseCIDR(address)
+	if err != nil {
+		return err
+	}
+	return cniTypes.PrintResult(&cniTypesCurrent.Result{
+		IPs: []*cniTypesCurrent.IPConfig{{Version: "4", Address: *ipNet}},
+	}, "0.3.1")
+}
+
+func (api *conformanceAPI) Del(args *cniSkel.CmdArgs) error {
+	key := args.ContainerID + "/" + args.IfName
+	if _, ok := api.endpoints[key]; !ok && api.strictDel {
+		return fmt.Errorf("container %s not found", args.ContainerID)
+	}
+	delete(api.endpoints, key)
+	return nil
+}
+
+func (api *conformanceAPI) Check(args *cniSkel.CmdArgs) error {
+	if _, ok := api.endpoints[args.ContainerID+"/"+args.IfName]; !ok && !api.leakOnCheck {
+		return fmt.Errorf("container %s not found", args.ContainerID)
+	}
+	return nil
+}
+
+func (api *conformanceAPI) GetVersion() cniVersion.PluginInfo {
+	return cniVersion.All
+}
+
+func runTestConformance(t *testing.T, api *conformanceAPI) map[string]conformanceResult {
+	plugin, cleanup := newTestPlugin(t)
+	defer cleanup()
+	plugin.Commands = api
+
+	report := plugin.conformance([]byte("{}"), []conformanceSandbox{
+		{Netns: "/var/run/netns/ns1", IfName: "eth0"},
+		{Netns: "/var/run/netns/ns1", IfName: "eth1"},
+	})
+
+	results := make(map[string]conformanceResult)
+	for _, result := range report.Scenarios {
+		results[result.Name] = result
+	}
+	require.Len(t, results, len(conformanceScenarios))
+
+	// Every scenario cleans up the sandboxes it connected.
+	assert.Empty(t, api.endpoints)
+	return results
+}
+
+func TestConformancePassed(t *testing.T) {
+	results := runTestConformance(t, &conformanceAPI{endpoints: make(map[string]string)})
+
+	for name, result := range results {
+		assert.True(t, result.Passed, "%s: %s", name, result.Error)
+		assert.False(t, result.Skipped, name)
+	}
+}
+
+func TestConformanceFailed(t *testing.T) {
+	results := runTestConformance(t, &conformanceAPI{
+		endpoints:   make(map[string]string),
+		strictDel:   true,
+		leakOnCheck: true,
+	})
+
+	assert.False(t, results["DEL without ADD"].Passed)
+	assert.False(t, results["duplicate DEL"].Passed)
+	assert.False(t, results["CHECK after restart"].Passed)
+	assert.True(t, results["duplicate ADD"].Passed)
+	assert.True(t, results["interleaved sandboxes"].Passed)
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// crashDirName is the name of the directory under the state directory for crash reports.
+	crashDirName = "crash"
+
+	// crashFileFormat is the format of crash report file names.
+	crashFileFormat = "crash-%s-%d.json"
+
+	// crashErrorCode is the CNI error code returned when a command handler panics.
+	crashErrorCode = 100
+
+	// maxStackSize is the maximum size of the stack trace captured in crash reports.
+	maxStackSize = 1 << 16
+)
+
+// crashReport is a structured report of a panic in a CNI command handler.
+type crashReport struct {
+	Time        string            `json:"time"`
+	Plugin      string            `json:"plugin"`
+	Version     string            `json:"version"`
+	Command     string            `json:"command"`
+	ContainerID string            `json:"containerID"`
+	Netns       string            `json:"netns"`
+	IfName      string            `json:"ifName"`
+	Args        string            `json:"args"`
+	ConfigHash  string            `json:"configHash"`
+	Env         map[string]string `json:"env"`
+	Panic       string            `json:"panic"`
+	Stack       string            `json:"stack"`
+}
+
+// CmdFunc is the signature of CNI command handlers.
+type CmdFunc func(args *cniSkel.CmdArgs) error
+
+// PanicError is a panic recovered in a goroutine started by a command handler. Handlers return
+// it like any other error, so that they clean up, and recoverCmd reports it as a panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// NewPanicError creates a PanicError for the given recovered value. It must be called from the
+// deferred function that recovered the panic, so that the stack trace includes the panic site.
+func NewPanicError(r interface{}) *PanicError {
+	return &PanicError{Value: r, Stack: stack()}
+}
+
+// Error returns the description of the panic.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverCmd wraps a CNI command handler so that a panic in the handler writes a crash report
+// and returns a CNI error, instead of terminating the plugin with an empty stdout.
+func (plugin *Plugin) recoverCmd(cmd CmdFunc) CmdFunc {
+	return func(args *cniSkel.CmdArgs) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			err = plugin.reportCrash(args, r, stack())
+		}()
+
+		err = cmd(args)
+		if panicErr, ok := err.(*PanicError); ok {
+			err = plugin.reportCrash(args, panicErr.Value, panicErr.Stack)
+		}
+
+		return err
+	}
+}
+
+// reportCrash writes a crash report for a panic in a CNI command handler and returns the CNI
+// error describing it.
+func (plugin *Plugin) reportCrash(args *cniSkel.CmdArgs, r interface{}, trace []byte) error {
+	report := plugin.newCrashReport(args, r, trace)
+	log.Errorf("Recovered panic: %v %s", report.Panic, report.Stack)
+
+	cniErr := &cniTypes.Error{
+		Code: crashErrorCode,
+		Msg:  fmt.Sprintf("plugin panicked: %v", r),
+	}
+
+	path, err := plugin.writeCrashReport(report)
+	if err != nil {
+		log.Errorf("Failed to write crash report: %v.", err)
+		cniErr.Details = report.Stack
+	} else {
+		log.Errorf("Wrote crash report to %s.", path)
+		cniErr.Details = fmt.Sprintf("crash report written to %s", path)
+	}
+
+	return cniErr
+}
+
+// stack returns the stack trace of the calling goroutine.
+func stack() []byte {
+	buf := make([]byte, maxStackSize)
+	return buf[:runtime.Stack(buf, false)]
+}
+
+// newCrashReport creates a crash report for a panic in a CNI command handler.
+func (plugin *Plugin) newCrashReport(args *cniSkel.CmdArgs, r interface{}, trace []byte) *crashReport {
+	report := &crashReport{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Plugin:  plugin.Name,
+		Version: version.Version,
+		Command: os.Getenv("CNI_COMMAND"),
+		Env:     make(map[string]string),
+		Panic:   fmt.Sprintf("%v", r),
+		Stack:   string(trace),
+	}
+
+	if args != nil {
+		hash := sha256.Sum256(args.StdinData)
+		report.ContainerID = args.ContainerID
+		report.Netns = args.Netns
+		report.IfName = args.IfName
+		report.Args = args.Args
+		report.ConfigHash = hex.EncodeToString(hash[:])
+	}
+
+	// Capture the CNI and plugin settings in effect.
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "CNI_") || strings.HasPrefix(kv, "VPC_CNI_") {
+			pair := strings.SplitN(kv, "=", 2)
+			report.Env[pair[0]] = pair[1]
+		}
+	}
+
+	return report
+}
+
+// writeCrashReport writes a crash report to the plugin state directory and returns its path.
+func (plugin *Plugin) writeCrashReport(report *crashReport) (string, error) {
+	dir := filepath.Join(plugin.StateDirPath, crashDirName)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf(crashFileFormat, time.Now().UTC().Format("20060102T150405Z"), os.Getpid())
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
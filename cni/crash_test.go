@@ -0,0 +1,103 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPlugin(t *testing.T) (*Plugin, func()) {
+	dir, err := ioutil.TempDir("", "cni")
+	require.NoError(t, err)
+
+	plugin := &Plugin{Name: "test", StateDirPath: dir}
+
+	return plugin, func() { os.RemoveAll(dir) }
+}
+
+func TestRecoverCmdWritesCrashReport(t *testing.T) {
+	plugin, cleanup := newTestPlugin(t)
+	defer cleanup()
+
+	args := &cniSkel.CmdArgs{ContainerID: "container1", IfName: "eth0", StdinData: []byte("{}")}
+	cmd := plugin.recoverCmd(func(args *cniSkel.CmdArgs) error {
+		panic("boom")
+	})
+
+	err := cmd(args)
+	require.Error(t, err)
+	cniErr, ok := err.(*cniTypes.Error)
+	require.True(t, ok)
+	assert.Equal(t, uint(crashErrorCode), cniErr.Code)
+	assert.Equal(t, "plugin panicked: boom", cniErr.Msg)
+
+	files, err := filepath.Glob(filepath.Join(plugin.StateDirPath, crashDirName, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+
+	var report crashReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, "test", report.Plugin)
+	assert.Equal(t, "container1", report.ContainerID)
+	assert.Equal(t, "boom", report.Panic)
+	assert.Contains(t, report.Stack, "TestRecoverCmdWritesCrashReport")
+	assert.Len(t, report.ConfigHash, 64)
+}
+
+func TestRecoverCmdReportsPanicError(t *testing.T) {
+	plugin, cleanup := newTestPlugin(t)
+	defer cleanup()
+
+	cmd := plugin.recoverCmd(func(args *cniSkel.CmdArgs) error {
+		return NewPanicError("boom")
+	})
+
+	err := cmd(&cniSkel.CmdArgs{ContainerID: "container1"})
+	cniErr, ok := err.(*cniTypes.Error)
+	require.True(t, ok)
+	assert.Equal(t, uint(crashErrorCode), cniErr.Code)
+	assert.Equal(t, "plugin panicked: boom", cniErr.Msg)
+
+	files, err := filepath.Glob(filepath.Join(plugin.StateDirPath, crashDirName, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestRecoverCmdPassesThroughResult(t *testing.T) {
+	plugin, cleanup := newTestPlugin(t)
+	defer cleanup()
+
+	expectedErr := fmt.Errorf("failed")
+	cmd := plugin.recoverCmd(func(args *cniSkel.CmdArgs) error {
+		return expectedErr
+	})
+
+	assert.Equal(t, expectedErr, cmd(&cniSkel.CmdArgs{}))
+
+	_, err := os.Stat(filepath.Join(plugin.StateDirPath, crashDirName))
+	assert.True(t, os.IsNotExist(err))
+}
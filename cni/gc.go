@@ -0,0 +1,76 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// ValidAttachmentsKey is the key of the valid attachments in the network configuration of
+	// CNI GC commands.
+	ValidAttachmentsKey = "cni.dev/valid-attachments"
+)
+
+// Attachment identifies a container interface attached to a network.
+type Attachment struct {
+	ContainerID string `json:"containerID"`
+	IfName      string `json:"ifname"`
+}
+
+// Attachments is a list of attachments.
+type Attachments []Attachment
+
+// ValidAttachments returns the valid attachments in the network configuration of a CNI GC
+// command. It returns an error if the configuration does not list them, so that a malformed
+// GC command does not delete every attachment.
+func ValidAttachments(netConfig []byte) (Attachments, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(netConfig, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network configuration: %v", err)
+	}
+
+	raw, ok := fields[ValidAttachmentsKey]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", ValidAttachmentsKey)
+	}
+
+	var attachments Attachments
+	err = json.Unmarshal(raw, &attachments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ValidAttachmentsKey, err)
+	}
+
+	return attachments, nil
+}
+
+// HasContainer returns whether the given container has a valid attachment. Container IDs
+// recovered from interface names may be truncated, so any valid container ID with the given
+// prefix matches.
+func (attachments Attachments) HasContainer(containerID string) bool {
+	if containerID == "" {
+		return false
+	}
+
+	for _, attachment := range attachments {
+		if strings.HasPrefix(attachment.ContainerID, containerID) {
+			return true
+		}
+	}
+
+	return false
+}
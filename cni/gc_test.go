@@ -0,0 +1,59 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidAttachments(t *testing.T) {
+	attachments, err := ValidAttachments([]byte(`{
+	  "cniVersion": "1.1.0",
+	  "name": "vpc",
+	  "cni.dev/valid-attachments": [
+	    {"containerID": "0123456789abcdef", "ifname": "eth0"},
+	    {"containerID": "fedcba9876543210", "ifname": "eth1"}
+	  ]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, Attachments{
+		{ContainerID: "0123456789abcdef", IfName: "eth0"},
+		{ContainerID: "fedcba9876543210", IfName: "eth1"},
+	}, attachments)
+
+	assert.True(t, attachments.HasContainer("0123456789abcdef"))
+	assert.True(t, attachments.HasContainer("01234567"))
+	assert.False(t, attachments.HasContainer("abcdef"))
+	assert.False(t, attachments.HasContainer(""))
+}
+
+func TestValidAttachmentsEmpty(t *testing.T) {
+	attachments, err := ValidAttachments([]byte(`{"name": "vpc", "cni.dev/valid-attachments": []}`))
+	require.NoError(t, err)
+	assert.Empty(t, attachments)
+}
+
+func TestValidAttachmentsInvalid(t *testing.T) {
+	for _, netConfig := range []string{
+		`{"name": "vpc"}`,
+		`{"name": "vpc", "cni.dev/valid-attachments": {}}`,
+		`not json`,
+	} {
+		_, err := ValidAttachments([]byte(netConfig))
+		assert.Error(t, err, netConfig)
+	}
+}
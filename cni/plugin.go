@@ -16,11 +16,15 @@ package cni
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
+	"strconv"
 
 	"github.com/aws/amazon-vpc-cni-plugins/capabilities"
+	"github.com/aws/amazon-vpc-cni-plugins/health"
 	"github.com/aws/amazon-vpc-cni-plugins/logger"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
 	"github.com/aws/amazon-vpc-cni-plugins/version"
 
 	log "github.com/cihub/seelog"
@@ -29,13 +33,62 @@ import (
 	cniVersion "github.com/containernetworking/cni/pkg/version"
 )
 
+const (
+	// ExplainCommand is the command line flag for running a CNI command in explain mode.
+	ExplainCommand = "explain"
+
+	// ReconcileStateCommand is the command line flag for rebuilding plugin state from live inventory.
+	ReconcileStateCommand = "reconcile-state"
+
+	// MigrateEndpointCommand is the command line flag for moving an endpoint to a new network.
+	MigrateEndpointCommand = "migrate-endpoint"
+
+	// PrewarmCommand is the command line flag for preparing the host for the first container.
+	PrewarmCommand = "prewarm"
+
+	// AdoptStateCommand is the command line flag for signing the state files written before the
+	// host's state signing key was set.
+	AdoptStateCommand = "adopt-unsigned-state"
+
+	// ListEndpointsCommand is the command line flag for listing the endpoints of containers.
+	ListEndpointsCommand = "list-endpoints"
+
+	// GenConfigCommand is the subcommand for generating a network configuration list.
+	GenConfigCommand = "genconfig"
+
+	// ConformanceCommand is the command line flag for running the CRI conformance scenarios.
+	ConformanceCommand = "conformance"
+
+	// ValidateConfigCommand is the command line flag for validating a network configuration offline.
+	ValidateConfigCommand = "validate-config"
+
+	// SoakCommand is the subcommand for repeatedly creating and deleting synthetic sandboxes.
+	SoakCommand = "soak"
+
+	// envExplain is the environment variable for running CNI commands in explain mode.
+	envExplain = "VPC_CNI_EXPLAIN"
+
+	// ErrCodeNotAvailable is the CNI error code of a STATUS command when the plugin cannot
+	// connect new containers.
+	ErrCodeNotAvailable uint = 50
+	// ErrCodeNotAvailableLimitedConnectivity is the CNI error code of a STATUS command when the
+	// plugin cannot connect new containers, and existing containers may have limited connectivity.
+	ErrCodeNotAvailableLimitedConnectivity uint = 51
+)
+
 // Plugin is the base class to all CNI plugins.
 type Plugin struct {
 	Name         string
 	SpecVersions cniVersion.PluginInfo
 	LogFilePath  string
+	StateDirPath string
+	Explain      bool
 	Commands     API
 	Capability   *capabilities.Capability
+
+	// SeparatePrivileges runs CNI commands without effective capabilities, except in sections
+	// wrapped with Privileged. Commands fail if privileges cannot be limited.
+	SeparatePrivileges bool
 }
 
 // NewPlugin creates a new CNI Plugin object.
@@ -45,10 +98,15 @@ func NewPlugin(
 	logFilePath string,
 	cmds API) (*Plugin, error) {
 
+	// Explain mode plans operations without executing them.
+	explain, _ := strconv.ParseBool(os.Getenv(envExplain))
+
 	return &Plugin{
 		Name:         name,
 		SpecVersions: specVersions,
 		LogFilePath:  logFilePath,
+		StateDirPath: state.GetDir(name),
+		Explain:      explain,
 		Commands:     cmds,
 		Capability:   capabilities.New(),
 	}, nil
@@ -70,10 +128,55 @@ func (plugin *Plugin) Uninitialize() {
 func (plugin *Plugin) Run() *cniTypes.Error {
 	defer log.Flush()
 
+	// Subcommands take their own command line arguments.
+	if len(os.Args) > 1 && os.Args[1] == GenConfigCommand {
+		exitCode := plugin.runGenConfig(os.Args[2:])
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == SoakCommand {
+		// Soak tests change the network configuration, so they require the debug token.
+		err := state.AuthorizeDebugCommand(SoakCommand)
+		if err != nil {
+			log.Errorf("Unauthorized debug command: %v.", err)
+			os.Stderr.WriteString(fmt.Sprintf("Unauthorized debug command: %v", err))
+			log.Flush()
+			os.Exit(1)
+		}
+
+		exitCode := plugin.runSoak(os.Args[2:])
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
 	// Parse command line arguments.
-	var printVersion, printCapabilities bool
+	var printVersion, printCapabilities, runHealthCheck, printCounters, printMetrics, reconcileState, prewarm, listEndpoints, adoptState bool
+	var migrateFromConfig, conformanceNetns, validateConfigPath string
 	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
 	flag.BoolVar(&printCapabilities, capabilities.Command, false, "prints capabilities and exits")
+	flag.BoolVar(&runHealthCheck, health.Command, false, "runs health checks and exits with a status code")
+	flag.BoolVar(&printCounters, state.CountersCommand, false, "prints persistent counters and exits")
+	flag.BoolVar(&printMetrics, state.MetricsCommand, false, "prints persistent counters as metrics and exits")
+	flag.BoolVar(&reconcileState, ReconcileStateCommand, false,
+		"rebuilds plugin state from live network inventory and exits with a status code")
+	flag.StringVar(&migrateFromConfig, MigrateEndpointCommand, "",
+		"moves the endpoint of the container in CNI_CONTAINERID from the network config in the given file "+
+			"to the network config on stdin and exits with a status code")
+	flag.BoolVar(&prewarm, PrewarmCommand, false,
+		"prepares the host for the first container on the network config on stdin and exits with a status code")
+	flag.BoolVar(&adoptState, AdoptStateCommand, false,
+		"signs the state files written before the host's state signing key was set and exits with a status code")
+	flag.BoolVar(&listEndpoints, ListEndpointsCommand, false,
+		"prints the endpoints of containers with their pod metadata and exits with a status code")
+	flag.StringVar(&conformanceNetns, ConformanceCommand, "",
+		"runs the CNI interaction patterns of container runtimes in the given comma-separated network "+
+			"namespaces on the network config on stdin, prints a conformance report and exits with a status code")
+	flag.StringVar(&validateConfigPath, ValidateConfigCommand, "",
+		"validates the network configuration or network configuration list in the given file offline, "+
+			"prints the errors and exits with a status code")
+	flag.BoolVar(&plugin.Explain, ExplainCommand, plugin.Explain,
+		"prints the operations a CNI command would perform without executing them")
 	flag.Parse()
 
 	if printVersion {
@@ -94,32 +197,133 @@ func (plugin *Plugin) Run() *cniTypes.Error {
 		return nil
 	}
 
+	if printCounters || printMetrics {
+		err := plugin.printCounters(printMetrics)
+		if err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Failed to print counters: %v", err))
+			return nil
+		}
+		return nil
+	}
+
+	if runHealthCheck {
+		exitCode := plugin.runHealthCheck()
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if listEndpoints {
+		exitCode := plugin.runListEndpoints()
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if validateConfigPath != "" {
+		exitCode := plugin.runValidateConfig(validateConfigPath)
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	// Debug commands that change the network configuration or the trusted state require the
+	// debug token.
+	for command, requested := range map[string]bool{
+		ReconcileStateCommand:  reconcileState,
+		MigrateEndpointCommand: migrateFromConfig != "",
+		PrewarmCommand:         prewarm,
+		ConformanceCommand:     conformanceNetns != "",
+		AdoptStateCommand:      adoptState,
+	} {
+		if !requested {
+			continue
+		}
+		err := state.AuthorizeDebugCommand(command)
+		if err != nil {
+			log.Errorf("Unauthorized debug command: %v.", err)
+			os.Stderr.WriteString(fmt.Sprintf("Unauthorized debug command: %v", err))
+			log.Flush()
+			os.Exit(1)
+		}
+	}
+
+	if reconcileState {
+		exitCode := plugin.runReconcileState()
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if adoptState {
+		exitCode := plugin.runAdoptState()
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if migrateFromConfig != "" {
+		exitCode := plugin.runMigrateEndpoint(migrateFromConfig)
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if prewarm {
+		exitCode := plugin.runPrewarm()
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
+	if conformanceNetns != "" {
+		exitCode := plugin.runConformance(conformanceNetns)
+		log.Flush()
+		os.Exit(exitCode)
+	}
+
 	// Ensure that goroutines do not change OS threads during namespace operations.
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	// Recover from panics.
-	defer func() {
-		if r := recover(); r != nil {
-			buf := make([]byte, 1<<12)
-			len := runtime.Stack(buf, false)
-
-			cniErr := &cniTypes.Error{
-				Code:    100,
-				Msg:     fmt.Sprintf("%v", r),
-				Details: string(buf[:len]),
-			}
-			cniErr.Print()
+	log.Infof("Plugin %s version %s executing CNI command.", plugin.Name, version.Version)
+	if plugin.Explain {
+		log.Infof("Running in explain mode, no changes will be made.")
+	}
 
-			log.Errorf("Recovered panic: %v %v\n", cniErr.Msg, cniErr.Details)
+	// Limit the blast radius of vulnerabilities in parsing and result emission. Plugins that
+	// separate privileges do not run commands with full privileges.
+	if plugin.SeparatePrivileges {
+		err := limitPrivileges()
+		if err != nil {
+			log.Errorf("Failed to limit privileges: %v.", err)
+			return toCNIError(err)
 		}
-	}()
+	}
 
-	log.Infof("Plugin %s version %s executing CNI command.", plugin.Name, version.Version)
+	// The CNI library does not dispatch CHECK, STATUS and GC commands yet.
+	if checker, ok := plugin.Commands.(Checker); ok && os.Getenv("CNI_COMMAND") == "CHECK" {
+		return plugin.runCheck(checker)
+	}
+
+	if reporter, ok := plugin.Commands.(StatusReporter); ok && os.Getenv("CNI_COMMAND") == "STATUS" {
+		return plugin.runStatus(reporter)
+	}
+
+	if collector, ok := plugin.Commands.(GarbageCollector); ok && os.Getenv("CNI_COMMAND") == "GC" {
+		return plugin.runGC(collector)
+	}
+
+	// The CNI library only reads the single CNI spec version in network configurations.
+	switch os.Getenv("CNI_COMMAND") {
+	case "VERSION":
+		return plugin.runVersion()
+	case "ADD", "DEL":
+		cniErr := plugin.negotiateStdinVersion()
+		if cniErr != nil {
+			log.Errorf("CNI command failed: %+v", cniErr)
+			return cniErr
+		}
+	}
 
 	// Execute CNI command handlers.
 	cniErr := cniSkel.PluginMainWithError(
-		plugin.Commands.Add, plugin.Commands.Del, plugin.Commands.GetVersion())
+		plugin.recoverCmd(validateCmd(plugin.Commands.Add)),
+		plugin.recoverCmd(validateCmd(plugin.Commands.Del)),
+		plugin.Commands.GetVersion())
 	if cniErr != nil {
 		log.Errorf("CNI command failed: %+v", cniErr)
 	}
@@ -127,6 +331,79 @@ func (plugin *Plugin) Run() *cniTypes.Error {
 	return cniErr
 }
 
+// runCheck executes the CNI CHECK command.
+func (plugin *Plugin) runCheck(checker Checker) *cniTypes.Error {
+	args := &cniSkel.CmdArgs{
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		IfName:      os.Getenv("CNI_IFNAME"),
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+	}
+
+	var err error
+	args.StdinData, err = ioutil.ReadAll(os.Stdin)
+	if err == nil {
+		err = plugin.recoverCmd(validateCmd(checker.Check))(args)
+	}
+	if err == nil {
+		return nil
+	}
+
+	return toCNIError(err)
+}
+
+// runStatus executes the CNI STATUS command. STATUS commands carry the network configuration
+// only, and no container arguments.
+func (plugin *Plugin) runStatus(reporter StatusReporter) *cniTypes.Error {
+	args := &cniSkel.CmdArgs{
+		Args: os.Getenv("CNI_ARGS"),
+		Path: os.Getenv("CNI_PATH"),
+	}
+
+	var err error
+	args.StdinData, err = ioutil.ReadAll(os.Stdin)
+	if err == nil {
+		err = plugin.recoverCmd(reporter.Status)(args)
+	}
+	if err == nil {
+		return nil
+	}
+
+	return toCNIError(err)
+}
+
+// runGC executes the CNI GC command. Like STATUS commands, GC commands carry the network
+// configuration only, which lists the valid attachments.
+func (plugin *Plugin) runGC(collector GarbageCollector) *cniTypes.Error {
+	args := &cniSkel.CmdArgs{
+		Args: os.Getenv("CNI_ARGS"),
+		Path: os.Getenv("CNI_PATH"),
+	}
+
+	var err error
+	args.StdinData, err = ioutil.ReadAll(os.Stdin)
+	if err == nil {
+		err = plugin.recoverCmd(collector.GC)(args)
+	}
+	if err == nil {
+		return nil
+	}
+
+	return toCNIError(err)
+}
+
+// toCNIError logs the error of a CNI command and converts it to a CNI error.
+func toCNIError(err error) *cniTypes.Error {
+	log.Errorf("CNI command failed: %v", err)
+	cniErr, ok := err.(*cniTypes.Error)
+	if !ok {
+		cniErr = &cniTypes.Error{Code: 100, Msg: err.Error()}
+	}
+
+	return cniErr
+}
+
 // Add is an empty CNI ADD command handler to ensure all CNI plugins implement CNIAPI.
 func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
 	return nil
@@ -153,3 +430,212 @@ func (plugin *Plugin) printVersionInfo() error {
 
 	return nil
 }
+
+// printCounters prints the persistent counters as JSON or as metrics.
+func (plugin *Plugin) printCounters(asMetrics bool) error {
+	counters, err := state.LoadCounters(plugin.StateDirPath)
+	if err != nil {
+		return err
+	}
+
+	if asMetrics {
+		return counters.WriteMetrics(os.Stdout, plugin.Name)
+	}
+
+	countersJSON, err := counters.String()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(countersJSON)
+
+	return nil
+}
+
+// runHealthCheck runs the plugin health checks, prints the report and returns the exit code.
+func (plugin *Plugin) runHealthCheck() int {
+	report := health.Run(health.DefaultChecks(plugin.StateDirPath))
+
+	if report.Healthy {
+		log.Infof("Plugin %s health check passed.", plugin.Name)
+	} else {
+		log.Errorf("Plugin %s health check failed: %+v", plugin.Name, report.Results)
+	}
+
+	reportJSON, err := report.String()
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to print health report: %v", err))
+	} else {
+		fmt.Println(reportJSON)
+	}
+
+	return report.ExitCode
+}
+
+// runListEndpoints prints the endpoints of containers and returns an exit code.
+func (plugin *Plugin) runListEndpoints() int {
+	lister, ok := plugin.Commands.(EndpointLister)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support listing endpoints", plugin.Name))
+		return 1
+	}
+
+	err := lister.ListEndpoints(os.Stdout)
+	if err != nil {
+		log.Errorf("Failed to list endpoints: %v.", err)
+		os.Stderr.WriteString(fmt.Sprintf("Failed to list endpoints: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// runGenConfig generates a network configuration list for the host and returns an exit code.
+func (plugin *Plugin) runGenConfig(args []string) int {
+	generator, ok := plugin.Commands.(ConfigGenerator)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support generating configuration", plugin.Name))
+		return 1
+	}
+
+	err := generator.GenerateConfig(args, os.Stdout)
+	if err != nil {
+		log.Errorf("Failed to generate configuration: %v.", err)
+		os.Stderr.WriteString(fmt.Sprintf("Failed to generate configuration: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// runReconcileState rebuilds the plugin state from live network inventory and returns an exit code.
+func (plugin *Plugin) runReconcileState() int {
+	reconciler, ok := plugin.Commands.(StateReconciler)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support state reconciliation", plugin.Name))
+		return 1
+	}
+
+	// Inventory walks network namespaces, so keep this goroutine on the same OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	log.Infof("Plugin %s version %s reconciling state.", plugin.Name, version.Version)
+	err := reconciler.ReconcileState()
+	if err != nil {
+		log.Errorf("Failed to reconcile state: %v.", err)
+		os.Stderr.WriteString(fmt.Sprintf("Failed to reconcile state: %v", err))
+		return 1
+	}
+
+	log.Infof("Plugin %s state reconciled.", plugin.Name)
+	return 0
+}
+
+// runAdoptState signs the state files written before the host's state signing key was set, and
+// returns an exit code.
+func (plugin *Plugin) runAdoptState() int {
+	adopter, ok := plugin.Commands.(StateAdopter)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support adopting unsigned state", plugin.Name))
+		return 1
+	}
+
+	log.Infof("Plugin %s version %s adopting unsigned state.", plugin.Name, version.Version)
+	err := adopter.AdoptUnsignedState()
+	if err != nil {
+		log.Errorf("Failed to adopt unsigned state: %v.", err)
+		os.Stderr.WriteString(fmt.Sprintf("Failed to adopt unsigned state: %v", err))
+		return 1
+	}
+
+	log.Infof("Plugin %s unsigned state adopted.", plugin.Name)
+	return 0
+}
+
+// runMigrateEndpoint moves the endpoint of a container from the network in the given network
+// configuration file to the network in the configuration on stdin, and returns an exit code.
+// The container is identified by the CNI environment variables, as in CNI commands.
+func (plugin *Plugin) runMigrateEndpoint(fromConfigPath string) int {
+	migrator, ok := plugin.Commands.(EndpointMigrator)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support endpoint migration", plugin.Name))
+		return 1
+	}
+
+	toArgs := &cniSkel.CmdArgs{
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		IfName:      os.Getenv("CNI_IFNAME"),
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+	}
+	if toArgs.ContainerID == "" || toArgs.IfName == "" {
+		os.Stderr.WriteString("Missing CNI_CONTAINERID or CNI_IFNAME")
+		return 1
+	}
+
+	var err error
+	toArgs.StdinData, err = ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to read network config from stdin: %v", err))
+		return 1
+	}
+
+	fromArgs := *toArgs
+	fromArgs.StdinData, err = ioutil.ReadFile(fromConfigPath)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to read network config: %v", err))
+		return 1
+	}
+
+	// Endpoint operations enter network namespaces, so keep this goroutine on the same OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	log.Infof("Plugin %s version %s migrating endpoint.", plugin.Name, version.Version)
+	err = migrator.MigrateEndpoint(&fromArgs, toArgs)
+	if err != nil {
+		log.Errorf("Failed to migrate endpoint: %v.", err)
+		os.Stderr.WriteString(fmt.Sprintf("Failed to migrate endpoint: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// runPrewarm prepares the host for the first container on the network in the configuration on
+// stdin, and returns an exit code.
+func (plugin *Plugin) runPrewarm() int {
+	prewarmer, ok := plugin.Commands.(Prewarmer)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support prewarming", plugin.Name))
+		return 1
+	}
+
+	args := &cniSkel.CmdArgs{
+		Args: os.Getenv("CNI_ARGS"),
+		Path: os.Getenv("CNI_PATH"),
+	}
+
+	var err error
+	args.StdinData, err = ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to read network config from stdin: %v", err))
+		return 1
+	}
+
+	// Network operations may enter network namespaces, so keep this goroutine on the same OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	log.Infof("Plugin %s version %s prewarming.", plugin.Name, version.Version)
+	err = prewarmer.Prewarm(args)
+	if err != nil {
+		log.Errorf("Failed to prewarm: %v.", err)
+		os.Stderr.WriteString(fmt.Sprintf("Failed to prewarm: %v", err))
+		return 1
+	}
+
+	return 0
+}
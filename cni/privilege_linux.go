@@ -0,0 +1,181 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	log "github.com/cihub/seelog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// linuxCapabilityVersion3 is the version of the kernel interface for 64-bit capability sets.
+	linuxCapabilityVersion3 = 0x20080522
+
+	// Capabilities used by privileged sections and the helper programs they execute.
+	capNetBindService = 10
+	capNetAdmin       = 12
+	capNetRaw         = 13
+	capSysAdmin       = 21
+
+	// requiredCapabilities is the set of capabilities retained for privileged sections. Network
+	// configuration requires CAP_NET_ADMIN, and entering network namespaces CAP_SYS_ADMIN.
+	// Helper programs are limited to the same set, so it also includes CAP_NET_RAW for iptables,
+	// ebtables and dhclient, and CAP_NET_BIND_SERVICE for dhclient to bind the DHCP client port.
+	requiredCapabilities = capabilitySet(
+		1<<capNetBindService | 1<<capNetAdmin | 1<<capNetRaw | 1<<capSysAdmin)
+)
+
+// capabilitySet is a set of Linux capabilities, one bit per capability.
+type capabilitySet uint64
+
+// capSets are the capability sets of a thread.
+type capSets struct {
+	effective   capabilitySet
+	permitted   capabilitySet
+	inheritable capabilitySet
+}
+
+// capHeader is the header of capget and capset system calls.
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+// capData is the 32-bit half of capability sets in capget and capset system calls.
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// limitPrivileges reduces the permitted capabilities of the calling thread to those required by
+// privileged sections, and clears its effective, inheritable and ambient capabilities. It also
+// sets no_new_privs, so that programs it executes cannot gain privileges through setuid bits or
+// file capabilities.
+//
+// This is defence in depth only. Capabilities are per-thread on Linux, so the caller must be
+// locked to its OS thread, and other threads of the process keep their capabilities. Because of
+// no_new_privs, helper programs executed from the thread, such as iptables, run with at most the
+// required capabilities, even as root.
+func limitPrivileges() error {
+	caps, err := getCapSets()
+	if err != nil {
+		return err
+	}
+
+	caps.effective = 0
+	caps.permitted &= requiredCapabilities
+	caps.inheritable = 0
+
+	err = setCapSets(caps)
+	if err != nil {
+		return err
+	}
+
+	// Kernels before 4.3 do not support ambient capabilities.
+	err = unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+	if err != nil && err != unix.EINVAL {
+		return fmt.Errorf("cni: failed to clear ambient capabilities: %v", err)
+	}
+
+	err = unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("cni: failed to set no_new_privs: %v", err)
+	}
+
+	return nil
+}
+
+// Privileged runs the given function with the permitted capabilities of the calling thread
+// raised to its effective set, and clears the effective set again when the function returns.
+// Plugins that separate privileges wrap operations on the host network configuration with it,
+// so that parsing, logging and result emission run without effective capabilities.
+func Privileged(fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	caps, err := getCapSets()
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do if the thread is not running with separated privileges.
+	lowered := caps.effective
+	if lowered == caps.permitted {
+		return fn()
+	}
+
+	caps.effective = caps.permitted
+	err = setCapSets(caps)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		caps.effective = lowered
+		err := setCapSets(caps)
+		if err != nil {
+			log.Errorf("Failed to lower capabilities: %v.", err)
+		}
+	}()
+
+	return fn()
+}
+
+// getCapSets returns the capability sets of the calling thread.
+func getCapSets() (*capSets, error) {
+	hdr := capHeader{version: linuxCapabilityVersion3}
+	var data [2]capData
+
+	_, _, errno := unix.RawSyscall(unix.SYS_CAPGET,
+		uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("cni: failed to get capabilities: %v", errno)
+	}
+
+	return &capSets{
+		effective:   capabilitySet(data[0].effective) | capabilitySet(data[1].effective)<<32,
+		permitted:   capabilitySet(data[0].permitted) | capabilitySet(data[1].permitted)<<32,
+		inheritable: capabilitySet(data[0].inheritable) | capabilitySet(data[1].inheritable)<<32,
+	}, nil
+}
+
+// setCapSets sets the capability sets of the calling thread.
+func setCapSets(caps *capSets) error {
+	hdr := capHeader{version: linuxCapabilityVersion3}
+	data := [2]capData{
+		{
+			effective:   uint32(caps.effective),
+			permitted:   uint32(caps.permitted),
+			inheritable: uint32(caps.inheritable),
+		},
+		{
+			effective:   uint32(caps.effective >> 32),
+			permitted:   uint32(caps.permitted >> 32),
+			inheritable: uint32(caps.inheritable >> 32),
+		},
+	}
+
+	_, _, errno := unix.RawSyscall(unix.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return fmt.Errorf("cni: failed to set capabilities: %v", errno)
+	}
+
+	return nil
+}
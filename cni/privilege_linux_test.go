@@ -0,0 +1,122 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// inLockedThread runs the given function in a goroutine locked to an OS thread that exits
+// afterwards, so that capability changes do not leak to other tests.
+func inLockedThread(fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		fn()
+	}()
+	<-done
+}
+
+func TestLimitPrivileges(t *testing.T) {
+	inLockedThread(func() {
+		before, err := getCapSets()
+		require.NoError(t, err)
+
+		err = limitPrivileges()
+		require.NoError(t, err)
+
+		caps, err := getCapSets()
+		require.NoError(t, err)
+		assert.Equal(t, capabilitySet(0), caps.effective)
+		assert.Equal(t, capabilitySet(0), caps.inheritable)
+		assert.Equal(t, before.permitted&requiredCapabilities, caps.permitted)
+
+		// Executed programs cannot gain privileges.
+		noNewPrivs, _, errno := unix.RawSyscall(unix.SYS_PRCTL, unix.PR_GET_NO_NEW_PRIVS, 0, 0)
+		require.Zero(t, errno)
+		assert.Equal(t, uintptr(1), noNewPrivs)
+
+		// Privileged sections run with the retained capabilities.
+		err = Privileged(func() error {
+			caps, err := getCapSets()
+			require.NoError(t, err)
+			assert.Equal(t, before.permitted&requiredCapabilities, caps.effective)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		caps, err = getCapSets()
+		require.NoError(t, err)
+		assert.Equal(t, capabilitySet(0), caps.effective)
+	})
+}
+
+// capHelperEnv is the environment variable that makes the helper process report its capabilities.
+const capHelperEnv = "CNI_TEST_CAP_HELPER"
+
+func TestLimitPrivilegesExec(t *testing.T) {
+	inLockedThread(func() {
+		before, err := getCapSets()
+		require.NoError(t, err)
+
+		err = limitPrivileges()
+		require.NoError(t, err)
+
+		// Helper programs executed as root run with the required capabilities.
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLimitPrivilegesHelperProcess$")
+		cmd.Env = append(os.Environ(), capHelperEnv+"=1")
+		output, err := cmd.Output()
+		require.NoError(t, err)
+
+		effective, err := strconv.ParseUint(strings.TrimSpace(string(output)), 16, 64)
+		require.NoError(t, err)
+		assert.Equal(t, before.permitted&requiredCapabilities, capabilitySet(effective))
+		if before.permitted&(1<<capNetRaw) != 0 {
+			assert.NotZero(t, effective&(1<<capNetRaw))
+		}
+	})
+}
+
+// TestLimitPrivilegesHelperProcess writes its effective capabilities to stdout, when run as a
+// helper process by TestLimitPrivilegesExec.
+func TestLimitPrivilegesHelperProcess(t *testing.T) {
+	if os.Getenv(capHelperEnv) == "" {
+		return
+	}
+
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "CapEff:") {
+			fmt.Println(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")))
+			os.Exit(0)
+		}
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+// ResultVersions are the CNI spec versions of results newer than the CNI library implements.
+// Plugins that support them convert their results with MarshalResult or PrintResult.
+var ResultVersions = []string{"0.4.0", "1.0.0", "1.1.0"}
+
+// MarshalResult returns the JSON encoding of the result in the given CNI spec version.
+//
+// The 0.4.0 result format is the same as 0.3.1. The 1.0.0 format drops the version of IP
+// configurations, and the 1.1.0 format only adds optional fields to the 1.0.0 format.
+func MarshalResult(result cniTypes.Result, version string) ([]byte, error) {
+	if !containsString(ResultVersions, version) {
+		versioned, err := result.GetAsVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(versioned)
+	}
+
+	current, err := cniTypesCurrent.NewResultFromResult(result)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	fields["cniVersion"], _ = json.Marshal(version)
+
+	if !strings.HasPrefix(version, "0.") && fields["ips"] != nil {
+		var ips []map[string]json.RawMessage
+		err = json.Unmarshal(fields["ips"], &ips)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert IP configurations: %v", err)
+		}
+		for _, ip := range ips {
+			delete(ip, "version")
+		}
+		fields["ips"], err = json.Marshal(ips)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// PrintResult writes the result in the given CNI spec version to stdout.
+func PrintResult(result cniTypes.Result, version string) error {
+	return WriteResult(os.Stdout, result, version)
+}
+
+// WriteResult writes the result in the given CNI spec version to the given writer.
+func WriteResult(w io.Writer, result cniTypes.Result, version string) error {
+	data, err := MarshalResult(result, version)
+	if err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	err = json.Indent(&indented, data, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = indented.WriteTo(w)
+	return err
+}
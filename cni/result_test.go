@@ -0,0 +1,90 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"net"
+	"testing"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResult(t *testing.T) *cniTypesCurrent.Result {
+	address, err := cniTypes.ParseCIDR("10.0.1.20/24")
+	require.NoError(t, err)
+	index := 0
+
+	return &cniTypesCurrent.Result{
+		CNIVersion: "0.3.1",
+		Interfaces: []*cniTypesCurrent.Interface{{Name: "eth0", Mac: "0a:58:0a:00:01:14", Sandbox: "/var/run/netns/ns1"}},
+		IPs: []*cniTypesCurrent.IPConfig{{
+			Version:   "4",
+			Interface: &index,
+			Address:   *address,
+			Gateway:   net.ParseIP("10.0.1.1"),
+		}},
+	}
+}
+
+func TestMarshalResult(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{
+			version: "0.3.1",
+			expected: `{"cniVersion":"0.3.1",
+			  "interfaces":[{"name":"eth0","mac":"0a:58:0a:00:01:14","sandbox":"/var/run/netns/ns1"}],
+			  "ips":[{"version":"4","interface":0,"address":"10.0.1.20/24","gateway":"10.0.1.1"}],
+			  "dns":{}}`,
+		},
+		{
+			version: "0.4.0",
+			expected: `{"cniVersion":"0.4.0",
+			  "interfaces":[{"name":"eth0","mac":"0a:58:0a:00:01:14","sandbox":"/var/run/netns/ns1"}],
+			  "ips":[{"version":"4","interface":0,"address":"10.0.1.20/24","gateway":"10.0.1.1"}],
+			  "dns":{}}`,
+		},
+		{
+			version: "1.0.0",
+			expected: `{"cniVersion":"1.0.0",
+			  "interfaces":[{"name":"eth0","mac":"0a:58:0a:00:01:14","sandbox":"/var/run/netns/ns1"}],
+			  "ips":[{"interface":0,"address":"10.0.1.20/24","gateway":"10.0.1.1"}],
+			  "dns":{}}`,
+		},
+		{
+			version: "1.1.0",
+			expected: `{"cniVersion":"1.1.0",
+			  "interfaces":[{"name":"eth0","mac":"0a:58:0a:00:01:14","sandbox":"/var/run/netns/ns1"}],
+			  "ips":[{"interface":0,"address":"10.0.1.20/24","gateway":"10.0.1.1"}],
+			  "dns":{}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			data, err := MarshalResult(newTestResult(t), test.version)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(data))
+		})
+	}
+}
+
+func TestMarshalResultUnsupportedVersion(t *testing.T) {
+	_, err := MarshalResult(newTestResult(t), "9.9.9")
+	assert.Error(t, err)
+}
@@ -0,0 +1,356 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+const (
+	// soakDelRetries is how many times a soak cycle retries a failed DEL command, as runtimes do
+	// until the sandbox is gone.
+	soakDelRetries = 5
+
+	// soakDelRetryInterval is how long a soak cycle waits before retrying a failed DEL command,
+	// e.g. while the network stack recovers from an injected fault.
+	soakDelRetryInterval = time.Second
+
+	// maxSoakErrors is how many command errors a soak report keeps.
+	maxSoakErrors = 20
+)
+
+// soakOptions configure a soak test.
+type soakOptions struct {
+	// Rate is the number of sandbox cycles started per second.
+	Rate float64
+	// Duration is how long the soak test runs.
+	Duration time.Duration
+	// Cycles is the maximum number of sandbox cycles, or zero for no limit.
+	Cycles int
+	// IfName is the name of the container interface.
+	IfName string
+	// Fault is the name of the fault injected into the network stack, if any.
+	Fault string
+	// FaultInterval is how often the fault is injected.
+	FaultInterval time.Duration
+}
+
+// soakLatency summarizes the latencies of a command in a soak test.
+type soakLatency struct {
+	Count    int    `json:"count"`
+	Failures int    `json:"failures"`
+	P50      string `json:"p50"`
+	P90      string `json:"p90"`
+	P99      string `json:"p99"`
+	Max      string `json:"max"`
+
+	samples []time.Duration
+}
+
+// soakReport is the outcome of a soak test.
+type soakReport struct {
+	Plugin          string                  `json:"plugin"`
+	Version         string                  `json:"version"`
+	Passed          bool                    `json:"passed"`
+	Duration        string                  `json:"duration"`
+	Cycles          int                     `json:"cycles"`
+	FailedCycles    int                     `json:"failedCycles"`
+	Fault           string                  `json:"fault,omitempty"`
+	FaultsInjected  int                     `json:"faultsInjected"`
+	FaultErrors     int                     `json:"faultErrors"`
+	LeakedEndpoints int                     `json:"leakedEndpoints"`
+	LeakedSandboxes int                     `json:"leakedSandboxes"`
+	Commands        map[string]*soakLatency `json:"commands"`
+	Errors          []string                `json:"errors,omitempty"`
+}
+
+// runSoak parses the soak command line arguments, runs a soak test against the plugin with the
+// network configuration on stdin, prints the soak report and returns an exit code.
+func (plugin *Plugin) runSoak(args []string) int {
+	soaker, ok := plugin.Commands.(Soaker)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support soak tests", plugin.Name))
+		return 1
+	}
+
+	var opts soakOptions
+	flags := flag.NewFlagSet(SoakCommand, flag.ContinueOnError)
+	flags.Float64Var(&opts.Rate, "rate", 1, "number of sandboxes created and deleted per second")
+	flags.DurationVar(&opts.Duration, "duration", 10*time.Minute, "how long to run the soak test")
+	flags.IntVar(&opts.Cycles, "cycles", 0, "maximum number of sandboxes, or zero for no limit")
+	flags.StringVar(&opts.IfName, "ifname", "eth0", "name of the container interface")
+	flags.StringVar(&opts.Fault, "fault", "",
+		fmt.Sprintf("fault injected while a sandbox is added, one of %v", soaker.SoakFaults()))
+	flags.DurationVar(&opts.FaultInterval, "fault-interval", time.Minute, "how often the fault is injected")
+	err := flags.Parse(args)
+	if err != nil {
+		return 1
+	}
+
+	if opts.Rate <= 0 {
+		os.Stderr.WriteString(fmt.Sprintf("Invalid rate %v", opts.Rate))
+		return 1
+	}
+	if opts.Fault != "" && !containsString(soaker.SoakFaults(), opts.Fault) {
+		os.Stderr.WriteString(fmt.Sprintf("Invalid fault %s, expected one of %v", opts.Fault, soaker.SoakFaults()))
+		return 1
+	}
+
+	stdinData, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to read network config from stdin: %v", err))
+		return 1
+	}
+
+	// Stop early on interrupt, and still report what ran so far.
+	stop := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	// Endpoint operations enter network namespaces, so keep this goroutine on the same OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	log.Infof("Plugin %s version %s running soak test with options %+v.", plugin.Name, version.Version, opts)
+	report := plugin.soak(soaker, stdinData, &opts, stop)
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to print soak report: %v", err))
+		return 1
+	}
+	fmt.Println(string(reportJSON))
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// soak creates and deletes sandboxes at the given rate until the duration elapses, the maximum
+// number of cycles ran or stop is closed, and returns the report. The test passes if no
+// endpoints or sandboxes leaked, and commands only failed in cycles with injected faults.
+func (plugin *Plugin) soak(soaker Soaker, stdinData []byte, opts *soakOptions, stop <-chan struct{}) *soakReport {
+	report := &soakReport{
+		Plugin:   plugin.Name,
+		Version:  version.Version,
+		Fault:    opts.Fault,
+		Commands: make(map[string]*soakLatency),
+	}
+
+	startEndpoints, err := soaker.CountEndpoints()
+	if err != nil {
+		report.addError(fmt.Errorf("failed to count endpoints: %v", err))
+	}
+
+	runID := newRunID()
+	interval := time.Duration(float64(time.Second) / opts.Rate)
+	start := time.Now()
+	lastFault := start
+	stopped := false
+
+	for !stopped && time.Since(start) < opts.Duration && (opts.Cycles == 0 || report.Cycles < opts.Cycles) {
+		cycleStart := time.Now()
+
+		fault := ""
+		if opts.Fault != "" && cycleStart.Sub(lastFault) >= opts.FaultInterval {
+			fault = opts.Fault
+			lastFault = cycleStart
+		}
+
+		name := fmt.Sprintf("soak-%s-%d", runID, report.Cycles)
+		if !plugin.soakCycle(soaker, report, stdinData, name, opts.IfName, fault) && fault == "" {
+			report.FailedCycles++
+		}
+		report.Cycles++
+
+		select {
+		case <-stop:
+			log.Infof("Soak test interrupted after %d cycles.", report.Cycles)
+			stopped = true
+		case <-time.After(time.Until(cycleStart.Add(interval))):
+		}
+	}
+
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	endEndpoints, err := soaker.CountEndpoints()
+	if err != nil {
+		report.addError(fmt.Errorf("failed to count endpoints: %v", err))
+	} else if endEndpoints > startEndpoints {
+		report.LeakedEndpoints = endEndpoints - startEndpoints
+	}
+
+	for _, latency := range report.Commands {
+		latency.summarize()
+	}
+
+	report.Passed = report.FailedCycles == 0 && report.LeakedEndpoints == 0 && report.LeakedSandboxes == 0
+	return report
+}
+
+// soakCycle creates a sandbox, connects it to the network, checks and deletes it, and returns
+// whether all commands succeeded. The fault, if any, is injected while the ADD command runs.
+func (plugin *Plugin) soakCycle(
+	soaker Soaker,
+	report *soakReport,
+	stdinData []byte,
+	name string,
+	ifName string,
+	fault string) bool {
+
+	var netns string
+	err := report.time("CreateSandbox", func() error {
+		var err error
+		netns, err = soaker.CreateSandbox(name)
+		return err
+	})
+	if err != nil {
+		return false
+	}
+
+	args := &cniSkel.CmdArgs{
+		ContainerID: name,
+		Netns:       netns,
+		IfName:      ifName,
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+		StdinData:   stdinData,
+	}
+
+	var faultDone chan error
+	if fault != "" {
+		faultDone = make(chan error, 1)
+		go func() { faultDone <- soaker.InjectFault(fault, netns) }()
+	}
+
+	passed := report.time("ADD", func() error {
+		return captureStdout(nil, func() error {
+			return plugin.recoverCmd(validateCmd(plugin.Commands.Add))(args)
+		})
+	}) == nil
+
+	if faultDone != nil {
+		report.FaultsInjected++
+		err = <-faultDone
+		if err != nil {
+			report.FaultErrors++
+			report.addError(fmt.Errorf("fault %s: %v", fault, err))
+		}
+	}
+
+	if checker, ok := plugin.Commands.(Checker); ok && passed {
+		passed = report.time("CHECK", func() error {
+			return captureStdout(nil, func() error {
+				return plugin.recoverCmd(validateCmd(checker.Check))(args)
+			})
+		}) == nil
+	}
+
+	// Runtimes retry DEL commands until they succeed, so only a DEL command that keeps failing
+	// leaks the endpoint.
+	for i := 0; ; i++ {
+		err = report.time("DEL", func() error {
+			return captureStdout(nil, func() error {
+				return plugin.recoverCmd(validateCmd(plugin.Commands.Del))(args)
+			})
+		})
+		if err == nil || i == soakDelRetries {
+			break
+		}
+		passed = false
+		time.Sleep(soakDelRetryInterval)
+	}
+
+	err = report.time("DeleteSandbox", func() error { return soaker.DeleteSandbox(netns) })
+	if err != nil {
+		report.LeakedSandboxes++
+		passed = false
+	}
+
+	return passed
+}
+
+// time runs a command of a soak cycle and records its latency and error.
+func (report *soakReport) time(command string, fn func() error) error {
+	latency, ok := report.Commands[command]
+	if !ok {
+		latency = &soakLatency{}
+		report.Commands[command] = latency
+	}
+
+	start := time.Now()
+	err := fn()
+	latency.samples = append(latency.samples, time.Since(start))
+	latency.Count++
+	if err != nil {
+		latency.Failures++
+		report.addError(fmt.Errorf("%s: %v", command, err))
+	}
+
+	return err
+}
+
+// addError keeps the first errors of a soak test in the report, and logs all of them.
+func (report *soakReport) addError(err error) {
+	log.Errorf("Soak test error: %v.", err)
+	if len(report.Errors) < maxSoakErrors {
+		report.Errors = append(report.Errors, err.Error())
+	}
+}
+
+// summarize computes the latency percentiles of a command from its samples.
+func (latency *soakLatency) summarize() {
+	if len(latency.samples) == 0 {
+		return
+	}
+
+	sort.Slice(latency.samples, func(i, j int) bool { return latency.samples[i] < latency.samples[j] })
+	percentile := func(p int) string {
+		return latency.samples[(len(latency.samples)-1)*p/100].String()
+	}
+
+	latency.P50 = percentile(50)
+	latency.P90 = percentile(90)
+	latency.P99 = percentile(99)
+	latency.Max = percentile(100)
+}
+
+// containsString returns whether the list contains the string.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
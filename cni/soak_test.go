@@ -0,0 +1,166 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// soakAPI is a CNI plugin with in-memory sandboxes for soak tests.
+type soakAPI struct {
+	conformanceAPI
+	lock      sync.Mutex
+	sandboxes map[string]bool
+	faults    int
+	leakDel   bool
+}
+
+func newSoakAPI() *soakAPI {
+	return &soakAPI{
+		conformanceAPI: conformanceAPI{endpoints: make(map[string]string)},
+		sandboxes:      make(map[string]bool),
+	}
+}
+
+func (api *soakAPI) Add(args *cniSkel.CmdArgs) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	if !api.sandboxes[args.Netns] {
+		return fmt.Errorf("sandbox %s not found", args.Netns)
+	}
+	return api.conformanceAPI.Add(args)
+}
+
+func (api *soakAPI) Del(args *cniSkel.CmdArgs) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	if api.leakDel {
+		return nil
+	}
+	return api.conformanceAPI.Del(args)
+}
+
+func (api *soakAPI) Check(args *cniSkel.CmdArgs) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	return api.conformanceAPI.Check(args)
+}
+
+func (api *soakAPI) CreateSandbox(name string) (string, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	netns := "/var/run/netns/" + name
+	api.sandboxes[netns] = true
+	return netns, nil
+}
+
+func (api *soakAPI) DeleteSandbox(netns string) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	delete(api.sandboxes, netns)
+	return nil
+}
+
+func (api *soakAPI) SoakFaults() []string {
+	return []string{"noop"}
+}
+
+func (api *soakAPI) InjectFault(fault string, netns string) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	api.faults++
+	return nil
+}
+
+func (api *soakAPI) CountEndpoints() (int, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	return len(api.endpoints), nil
+}
+
+func runTestSoak(t *testing.T, api *soakAPI, opts *soakOptions) *soakReport {
+	plugin, cleanup := newTestPlugin(t)
+	defer cleanup()
+	plugin.Commands = api
+
+	return plugin.soak(api, []byte("{}"), opts, make(chan struct{}))
+}
+
+func TestSoakPassed(t *testing.T) {
+	api := newSoakAPI()
+	report := runTestSoak(t, api, &soakOptions{
+		Rate:          1000,
+		Duration:      time.Minute,
+		Cycles:        5,
+		IfName:        "eth0",
+		Fault:         "noop",
+		FaultInterval: 0,
+	})
+
+	assert.True(t, report.Passed, "%v", report.Errors)
+	assert.Equal(t, 5, report.Cycles)
+	assert.Equal(t, 5, report.FaultsInjected)
+	assert.Equal(t, 5, api.faults)
+	assert.Empty(t, api.sandboxes)
+	assert.Empty(t, api.endpoints)
+	for _, command := range []string{"CreateSandbox", "ADD", "CHECK", "DEL", "DeleteSandbox"} {
+		require.Contains(t, report.Commands, command)
+		assert.Equal(t, 5, report.Commands[command].Count, command)
+		assert.NotEmpty(t, report.Commands[command].Max, command)
+	}
+}
+
+func TestSoakLeakedEndpoints(t *testing.T) {
+	api := newSoakAPI()
+	api.leakDel = true
+	report := runTestSoak(t, api, &soakOptions{Rate: 1000, Duration: time.Minute, Cycles: 3, IfName: "eth0"})
+
+	assert.False(t, report.Passed)
+	assert.Equal(t, 3, report.LeakedEndpoints)
+	assert.Zero(t, report.FailedCycles)
+}
+
+func TestSoakStopped(t *testing.T) {
+	plugin, cleanup := newTestPlugin(t)
+	defer cleanup()
+	api := newSoakAPI()
+	plugin.Commands = api
+
+	stop := make(chan struct{})
+	close(stop)
+	report := plugin.soak(api, []byte("{}"), &soakOptions{Rate: 1, Duration: time.Minute, IfName: "eth0"}, stop)
+
+	assert.True(t, report.Passed)
+	assert.Equal(t, 1, report.Cycles)
+}
+
+func TestSoakLatencySummarize(t *testing.T) {
+	latency := &soakLatency{}
+	for i := 100; i > 0; i-- {
+		latency.samples = append(latency.samples, time.Duration(i)*time.Millisecond)
+	}
+	latency.summarize()
+
+	assert.Equal(t, "50ms", latency.P50)
+	assert.Equal(t, "90ms", latency.P90)
+	assert.Equal(t, "99ms", latency.P99)
+	assert.Equal(t, "100ms", latency.Max)
+}
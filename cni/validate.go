@@ -0,0 +1,108 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"fmt"
+	"regexp"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// maxNetnsLength is the maximum length of a network namespace.
+const maxNetnsLength = 1024
+
+// Values from CNI arguments and network configurations end up in link names, HNS object names,
+// state file names and external command lines. They are constrained to conservative character
+// classes and lengths before use, so that a malicious task configuration can neither inject
+// commands nor collide with the names of other resources, e.g. through owner ID separators.
+var (
+	// containerIDRegexp matches valid container IDs, as defined by the CNI specification.
+	containerIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-]{0,254}$`)
+
+	// ifNameRegexp matches valid container interface names. Linux limits interface names to
+	// 15 characters.
+	ifNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.\-]{1,15}$`)
+
+	// netnsRegexp matches valid network namespaces: paths on Linux, and "none", infrastructure
+	// container references or HCN namespace IDs on Windows.
+	netnsRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:/\\\-{}]*$`)
+
+	// adapterNameRegexp matches valid host adapter names. Windows adapter names may contain
+	// spaces, parentheses and number signs, e.g. "vEthernet (Ethernet #2)".
+	adapterNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.\-][a-zA-Z0-9 _.()#\-]{0,255}$`)
+)
+
+// validateCmd wraps a CNI command handler so that the handler is invoked only with valid
+// CNI arguments.
+func validateCmd(cmd CmdFunc) CmdFunc {
+	return func(args *cniSkel.CmdArgs) error {
+		err := ValidateArgs(args)
+		if err != nil {
+			return err
+		}
+
+		return cmd(args)
+	}
+}
+
+// ValidateArgs returns an error if the container ID, interface name or network namespace in the
+// given CNI arguments is invalid.
+func ValidateArgs(args *cniSkel.CmdArgs) error {
+	err := ValidateContainerID(args.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateIfName(args.IfName)
+	if err != nil {
+		return err
+	}
+
+	return ValidateNetns(args.Netns)
+}
+
+// ValidateContainerID returns an error if the given container ID is invalid.
+func ValidateContainerID(containerID string) error {
+	if !containerIDRegexp.MatchString(containerID) {
+		return fmt.Errorf("invalid container ID %q, must be up to 255 letters, digits, "+
+			"underscores, dots or dashes", containerID)
+	}
+	return nil
+}
+
+// ValidateIfName returns an error if the given container interface name is invalid.
+func ValidateIfName(ifName string) error {
+	if !ifNameRegexp.MatchString(ifName) || ifName == "." || ifName == ".." {
+		return fmt.Errorf("invalid interface name %q, must be up to 15 letters, digits, "+
+			"underscores, dots or dashes", ifName)
+	}
+	return nil
+}
+
+// ValidateNetns returns an error if the given network namespace is invalid. It may be empty.
+func ValidateNetns(netns string) error {
+	if len(netns) > maxNetnsLength || !netnsRegexp.MatchString(netns) {
+		return fmt.Errorf("invalid network namespace %q", netns)
+	}
+	return nil
+}
+
+// ValidateAdapterName returns an error if the given host adapter name is invalid.
+func ValidateAdapterName(name string) error {
+	if !adapterNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid adapter name %q", name)
+	}
+	return nil
+}
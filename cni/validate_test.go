@@ -0,0 +1,67 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"strings"
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateArgs(t *testing.T) {
+	valid := []cniSkel.CmdArgs{
+		{ContainerID: "abc123", IfName: "eth0", Netns: "/proc/1234/ns/net"},
+		{ContainerID: "ecs-task_1.2-x", IfName: "eth0", Netns: "/var/run/netns/cni-1234"},
+		{ContainerID: "abc123", IfName: "eth0", Netns: "none"},
+		{ContainerID: "abc123", IfName: "eth0", Netns: "{a5b3c0d8-2b71-4d6e-9a4e-0f3c1e2d5b6a}"},
+		{ContainerID: "abc123", IfName: "eth0", Netns: "container:abc123"},
+		{ContainerID: "abc123", IfName: "eth0"},
+	}
+
+	invalid := []cniSkel.CmdArgs{
+		{ContainerID: "", IfName: "eth0"},
+		{ContainerID: "-abc", IfName: "eth0"},
+		{ContainerID: "abc;reboot", IfName: "eth0"},
+		{ContainerID: "abc@owner", IfName: "eth0"},
+		{ContainerID: strings.Repeat("a", 256), IfName: "eth0"},
+		{ContainerID: "abc123", IfName: ""},
+		{ContainerID: "abc123", IfName: ".."},
+		{ContainerID: "abc123", IfName: "eth0/../x"},
+		{ContainerID: "abc123", IfName: "averylonginterfacename"},
+		{ContainerID: "abc123", IfName: "eth0", Netns: "/proc/1/ns/net; reboot"},
+		{ContainerID: "abc123", IfName: "eth0", Netns: "$(reboot)"},
+	}
+
+	for _, args := range valid {
+		args := args
+		assert.NoError(t, ValidateArgs(&args), "args: %+v", args)
+	}
+
+	for _, args := range invalid {
+		args := args
+		assert.Error(t, ValidateArgs(&args), "args: %+v", args)
+	}
+}
+
+func TestValidateAdapterName(t *testing.T) {
+	for _, name := range []string{"eth1", "Ethernet 2", "vEthernet (Ethernet #2)", "ens5.100"} {
+		assert.NoError(t, ValidateAdapterName(name), "name: %s", name)
+	}
+
+	for _, name := range []string{"", " eth1", "eth1;reboot", "eth1`id`", "eth1|x", strings.Repeat("a", 257)} {
+		assert.Error(t, ValidateAdapterName(name), "name: %s", name)
+	}
+}
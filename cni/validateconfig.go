@@ -0,0 +1,204 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/schema"
+)
+
+// runValidateConfig validates the network configuration in the given file, prints the errors
+// and returns an exit code.
+func (plugin *Plugin) runValidateConfig(path string) int {
+	validator, ok := plugin.Commands.(ConfigValidator)
+	if !ok {
+		os.Stderr.WriteString(fmt.Sprintf("Plugin %s does not support validating configuration", plugin.Name))
+		return 1
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to read network config: %v", err))
+		return 1
+	}
+
+	errs, err := plugin.ValidateNetConfig(validator, data)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to validate network config: %v", err))
+		return 1
+	}
+
+	for _, err := range errs {
+		os.Stderr.WriteString(fmt.Sprintf("%s: %v\n", path, err))
+	}
+	if len(errs) != 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// ValidateNetConfig validates the network configuration or network configuration list in the
+// given data offline, and returns all errors found. Only the configurations of this plugin in a
+// list are validated, as the runtime passes them to the plugin.
+func (plugin *Plugin) ValidateNetConfig(validator ConfigValidator, data []byte) ([]error, error) {
+	configSchema, err := schema.Parse([]byte(validator.ConfigSchema()))
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	if err != nil {
+		return []error{&schema.Error{Message: fmt.Sprintf("invalid JSON: %v", err)}}, nil
+	}
+
+	netConfig, ok := value.(map[string]interface{})
+	if !ok {
+		return []error{&schema.Error{Message: "expected object"}}, nil
+	}
+
+	var errs []error
+	fail := func(path string, format string, a ...interface{}) {
+		errs = append(errs, &schema.Error{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	cniVersion, _ := netConfig["cniVersion"].(string)
+	if cniVersion != "" && !plugin.supportsVersion(cniVersion) {
+		fail("cniVersion", "%q is not supported by %s, expected one of %v",
+			cniVersion, plugin.Name, plugin.SpecVersions.SupportedVersions())
+	}
+
+	// A network configuration without a plugin list configures a single plugin.
+	if _, ok = netConfig["plugins"]; !ok {
+		return append(errs, plugin.validatePluginConfig(validator, configSchema, "", netConfig)...), nil
+	}
+
+	// Runtimes may list the CNI spec versions they support instead, and inject the highest
+	// version that the plugin supports too.
+	if list, ok := netConfig[versionsKey]; ok {
+		versions, ok := toStrings(list)
+		if !ok {
+			fail(versionsKey, "expected an array of strings")
+		} else {
+			negotiated, err := NegotiateVersion(cniVersion, versions, plugin.SpecVersions.SupportedVersions())
+			if err != nil {
+				fail(versionsKey, "%v", err)
+			} else if cniVersion == "" {
+				cniVersion = negotiated
+			}
+		}
+	}
+
+	if cniVersion == "" {
+		fail("cniVersion", "missing CNI spec version")
+	}
+
+	name, _ := netConfig["name"].(string)
+	if name == "" {
+		fail("name", "missing network name")
+	}
+
+	plugins, ok := netConfig["plugins"].([]interface{})
+	if !ok || len(plugins) == 0 {
+		fail("plugins", "expected a non-empty array of plugin configurations")
+		return errs, nil
+	}
+
+	found := false
+	for i, entry := range plugins {
+		path := fmt.Sprintf("plugins[%d]", i)
+		pluginConfig, ok := entry.(map[string]interface{})
+		if !ok {
+			fail(path, "expected object")
+			continue
+		}
+
+		if pluginConfig["type"] != plugin.Name {
+			continue
+		}
+		found = true
+
+		// The runtime injects the name and version of the list into each plugin configuration.
+		pluginConfig["cniVersion"] = cniVersion
+		pluginConfig["name"] = name
+		errs = append(errs, plugin.validatePluginConfig(validator, configSchema, path, pluginConfig)...)
+	}
+
+	if !found {
+		fail("plugins", "no configuration of type %s", plugin.Name)
+	}
+
+	return errs, nil
+}
+
+// validatePluginConfig validates the network configuration of the plugin at the given path.
+func (plugin *Plugin) validatePluginConfig(
+	validator ConfigValidator,
+	configSchema *schema.Schema,
+	path string,
+	netConfig map[string]interface{}) []error {
+
+	errs := configSchema.ValidateValue(path, netConfig)
+	if len(errs) != 0 {
+		// Constraints between fields are only meaningful for fields of the expected types.
+		return errs
+	}
+
+	data, err := json.Marshal(netConfig)
+	if err == nil {
+		err = validator.ValidateConfig(data)
+	}
+	if err != nil {
+		return []error{&schema.Error{Path: path, Message: err.Error()}}
+	}
+
+	return nil
+}
+
+// toStrings returns the strings in the given JSON array, or false if it is not an array of strings.
+func toStrings(value interface{}) ([]string, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	var strs []string
+	for _, entry := range list {
+		s, ok := entry.(string)
+		if !ok {
+			return nil, false
+		}
+		strs = append(strs, s)
+	}
+
+	return strs, true
+}
+
+// supportsVersion returns whether the plugin supports the given CNI spec version.
+func (plugin *Plugin) supportsVersion(cniVersion string) bool {
+	for _, version := range plugin.SpecVersions.SupportedVersions() {
+		if version == cniVersion {
+			return true
+		}
+	}
+	return false
+}
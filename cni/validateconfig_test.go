@@ -0,0 +1,114 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfigValidator validates configurations with a mode field and an optional address
+// required by the L2 mode.
+type testConfigValidator struct{}
+
+func (v *testConfigValidator) ConfigSchema() string {
+	return `{
+		"type": "object",
+		"required": ["cniVersion", "name", "type"],
+		"additionalProperties": false,
+		"properties": {
+			"cniVersion": {"type": "string"},
+			"name": {"type": "string"},
+			"type": {"type": "string"},
+			"mode": {"type": "string", "enum": ["L2", "L3"]},
+			"address": {"type": "string", "format": "ip"}
+		}
+	}`
+}
+
+func (v *testConfigValidator) ValidateConfig(netConfig []byte) error {
+	var config struct {
+		Mode    string `json:"mode"`
+		Address string `json:"address"`
+	}
+	err := json.Unmarshal(netConfig, &config)
+	if err != nil {
+		return err
+	}
+	if config.Mode == "L2" && config.Address == "" {
+		return errors.New("mode L2 requires address")
+	}
+	return nil
+}
+
+func TestValidateNetConfig(t *testing.T) {
+	plugin := &Plugin{
+		Name:         "test-plugin",
+		SpecVersions: cniVersion.PluginSupports("0.3.0", "0.3.1"),
+	}
+
+	tests := []struct {
+		name         string
+		config       string
+		expectErrors []string
+	}{
+		{"valid config", `{"cniVersion": "0.3.1", "name": "net", "type": "test-plugin", "mode": "L3"}`, nil},
+		{"valid list", `{"cniVersion": "0.3.1", "name": "net", "plugins": [
+			{"type": "test-plugin", "mode": "L2", "address": "10.0.0.1"},
+			{"type": "other-plugin", "unknown": true}]}`, nil},
+		{"schema errors", `{"cniVersion": "0.3.1", "name": "net", "plugins": [
+			{"type": "test-plugin", "mode": "L4", "Address": "10.0.0.1"}]}`, []string{
+			`plugins[0].Address: unknown field, did you mean address?`,
+			`plugins[0].mode: "L4" is not one of "L2", "L3"`}},
+		{"cross-field error", `{"cniVersion": "0.3.1", "name": "net", "type": "test-plugin", "mode": "L2"}`,
+			[]string{"mode L2 requires address"}},
+		{"cross-field error in list", `{"cniVersion": "0.3.1", "name": "net", "plugins": [
+			{"type": "other-plugin"}, {"type": "test-plugin", "mode": "L2"}]}`,
+			[]string{"plugins[1]: mode L2 requires address"}},
+		{"unsupported version", `{"cniVersion": "1.0.0", "name": "net", "type": "test-plugin"}`,
+			[]string{`cniVersion: "1.0.0" is not supported by test-plugin, expected one of [0.3.0 0.3.1]`}},
+		{"list with versions", `{"cniVersions": ["0.3.1", "1.0.0"], "name": "net", "plugins": [
+			{"type": "test-plugin", "mode": "L3"}]}`, nil},
+		{"list with unsupported versions", `{"cniVersions": ["1.0.0", "1.1.0"], "name": "net", "plugins": [
+			{"type": "test-plugin", "mode": "L3"}]}`, []string{
+			"cniVersions: no supported CNI version in [1.0.0 1.1.0], plugin supports [0.3.0 0.3.1]",
+			"cniVersion: missing CNI spec version"}},
+		{"invalid list", `{"plugins": []}`, []string{
+			"cniVersion: missing CNI spec version",
+			"name: missing network name",
+			"plugins: expected a non-empty array of plugin configurations"}},
+		{"plugin missing from list", `{"cniVersion": "0.3.1", "name": "net", "plugins": [{"type": "other-plugin"}, 1]}`,
+			[]string{"plugins[1]: expected object", "plugins: no configuration of type test-plugin"}},
+		{"invalid JSON", `{"cniVersion": "0.3.1",`, []string{"invalid JSON: unexpected EOF"}},
+		{"not an object", `[]`, []string{"expected object"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs, err := plugin.ValidateNetConfig(&testConfigValidator{}, []byte(test.config))
+			require.NoError(t, err)
+
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			assert.Equal(t, test.expectErrors, messages)
+		})
+	}
+}
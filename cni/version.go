@@ -0,0 +1,162 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// versionsKey is the key of the list of CNI spec versions supported by the runtime in network
+// configurations.
+const versionsKey = "cniVersions"
+
+// NegotiateVersion returns the highest CNI spec version in the list of versions supported by
+// the runtime that the plugin supports too. Runtimes that do not list versions get the single
+// version in the network configuration.
+func NegotiateVersion(version string, versions []string, supported []string) (string, error) {
+	if len(versions) == 0 {
+		return version, nil
+	}
+
+	negotiated := ""
+	for _, v := range versions {
+		if containsString(supported, v) && (negotiated == "" || compareVersions(v, negotiated) > 0) {
+			negotiated = v
+		}
+	}
+
+	if negotiated == "" {
+		return "", fmt.Errorf("no supported CNI version in %v, plugin supports %v", versions, supported)
+	}
+
+	return negotiated, nil
+}
+
+// compareVersions returns a negative number, zero or a positive number if CNI spec version a
+// is lower than, equal to or higher than version b.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bPart, _ = strconv.Atoi(bParts[i])
+		}
+		if aPart != bPart {
+			return aPart - bPart
+		}
+	}
+
+	return 0
+}
+
+// decodeVersions returns the CNI spec version and the list of versions supported by the runtime
+// in a network configuration.
+func decodeVersions(netConfig []byte) (string, []string, error) {
+	var conf struct {
+		CNIVersion  string   `json:"cniVersion"`
+		CNIVersions []string `json:"cniVersions"`
+	}
+	err := json.Unmarshal(netConfig, &conf)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return conf.CNIVersion, conf.CNIVersions, nil
+}
+
+// runVersion executes the CNI VERSION command. It reports the CNI spec version negotiated from
+// the versions on stdin, or the version of the CNI library if there are none.
+func (plugin *Plugin) runVersion() *cniTypes.Error {
+	supported := plugin.Commands.GetVersion().SupportedVersions()
+	info := struct {
+		CNIVersion        string   `json:"cniVersion"`
+		SupportedVersions []string `json:"supportedVersions"`
+	}{
+		CNIVersion:        cniVersion.Current(),
+		SupportedVersions: supported,
+	}
+
+	stdinData, err := ioutil.ReadAll(os.Stdin)
+	if err == nil && len(stdinData) != 0 {
+		version, versions, err := decodeVersions(stdinData)
+		if err == nil {
+			version, err = NegotiateVersion(version, versions, supported)
+		}
+		if err == nil && containsString(supported, version) {
+			info.CNIVersion = version
+		}
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(&info)
+	if err != nil {
+		return toCNIError(err)
+	}
+
+	return nil
+}
+
+// negotiateStdinVersion replaces the CNI spec version of the network configuration on stdin
+// with the version negotiated from its list of versions, if it has one, as the CNI library only
+// checks the single version.
+func (plugin *Plugin) negotiateStdinVersion() *cniTypes.Error {
+	stdinData, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return toCNIError(err)
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(stdinData, &fields) == nil && fields[versionsKey] != nil {
+		version, versions, err := decodeVersions(stdinData)
+		if err == nil {
+			version, err = NegotiateVersion(version, versions, plugin.Commands.GetVersion().SupportedVersions())
+		}
+		if err != nil {
+			return &cniTypes.Error{
+				Code:    cniTypes.ErrIncompatibleCNIVersion,
+				Msg:     "incompatible CNI versions",
+				Details: err.Error(),
+			}
+		}
+
+		fields["cniVersion"], _ = json.Marshal(version)
+		stdinData, err = json.Marshal(fields)
+		if err != nil {
+			return toCNIError(err)
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return toCNIError(err)
+	}
+	go func() {
+		w.Write(stdinData)
+		w.Close()
+	}()
+	os.Stdin = r
+
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionAPI is a CNI plugin that only supports the given CNI spec versions.
+type versionAPI struct {
+	versions []string
+}
+
+func (api *versionAPI) Add(args *cniSkel.CmdArgs) error {
+	return nil
+}
+
+func (api *versionAPI) Del(args *cniSkel.CmdArgs) error {
+	return nil
+}
+
+func (api *versionAPI) GetVersion() cniVersion.PluginInfo {
+	return cniVersion.PluginSupports(api.versions...)
+}
+
+// withStdin runs fn with the given data on stdin.
+func withStdin(t *testing.T, data string, fn func()) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+
+	fn()
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	supported := []string{"0.3.0", "0.3.1", "0.4.0", "1.0.0", "1.1.0"}
+
+	tests := []struct {
+		version  string
+		versions []string
+		expected string
+	}{
+		{"0.3.1", nil, "0.3.1"},
+		{"2.0.0", nil, "2.0.0"},
+		{"0.3.1", []string{"0.3.1", "1.0.0"}, "1.0.0"},
+		{"", []string{"1.1.0", "0.4.0", "1.0.0"}, "1.1.0"},
+		{"", []string{"0.10.0", "0.3.0", "2.0.0"}, "0.3.0"},
+	}
+
+	for _, test := range tests {
+		negotiated, err := NegotiateVersion(test.version, test.versions, supported)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, negotiated)
+	}
+
+	_, err := NegotiateVersion("", []string{"0.2.0", "2.0.0"}, supported)
+	assert.Error(t, err)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Zero(t, compareVersions("1.0.0", "1.0.0"))
+	assert.True(t, compareVersions("0.10.0", "0.9.0") > 0)
+	assert.True(t, compareVersions("0.4.0", "1.0.0") < 0)
+	assert.True(t, compareVersions("1.1", "1.0.1") > 0)
+}
+
+func TestRunVersion(t *testing.T) {
+	plugin := &Plugin{Commands: &versionAPI{versions: []string{"0.3.1", "1.0.0"}}}
+
+	tests := []struct {
+		stdin    string
+		expected string
+	}{
+		{``, "0.3.1"},
+		{`{"cniVersion":"1.0.0"}`, "1.0.0"},
+		{`{"cniVersions":["0.3.1", "1.0.0", "1.1.0"]}`, "1.0.0"},
+		{`{"cniVersion":"9.0.0"}`, "0.3.1"},
+	}
+
+	for _, test := range tests {
+		var output []byte
+		withStdin(t, test.stdin, func() {
+			require.NoError(t, captureStdout(&output, func() error {
+				if cniErr := plugin.runVersion(); cniErr != nil {
+					return cniErr
+				}
+				return nil
+			}))
+		})
+
+		var info struct {
+			CNIVersion        string   `json:"cniVersion"`
+			SupportedVersions []string `json:"supportedVersions"`
+		}
+		require.NoError(t, json.Unmarshal(output, &info), test.stdin)
+		assert.Equal(t, test.expected, info.CNIVersion, test.stdin)
+		assert.Equal(t, []string{"0.3.1", "1.0.0"}, info.SupportedVersions)
+	}
+}
+
+func TestNegotiateStdinVersion(t *testing.T) {
+	plugin := &Plugin{Commands: &versionAPI{versions: []string{"0.3.1", "1.0.0"}}}
+
+	withStdin(t, `{"cniVersions":["0.3.1", "1.0.0"], "name":"net"}`, func() {
+		require.Nil(t, plugin.negotiateStdinVersion())
+		data, err := ioutil.ReadAll(os.Stdin)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"cniVersion":"1.0.0", "cniVersions":["0.3.1", "1.0.0"], "name":"net"}`, string(data))
+	})
+
+	withStdin(t, `{"cniVersion":"0.3.1", "name":"net"}`, func() {
+		require.Nil(t, plugin.negotiateStdinVersion())
+		data, err := ioutil.ReadAll(os.Stdin)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"cniVersion":"0.3.1", "name":"net"}`, string(data))
+	})
+
+	withStdin(t, `{"cniVersions":["1.1.0"], "name":"net"}`, func() {
+		cniErr := plugin.negotiateStdinVersion()
+		require.NotNil(t, cniErr)
+		assert.Equal(t, uint(cniTypes.ErrIncompatibleCNIVersion), cniErr.Code)
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+)
+
+const (
+	// Command is the option for the plugin to run health checks and exit.
+	Command = "healthcheck"
+
+	// Exit codes reported by health checks. Each failing check reports a distinct code so that
+	// watchdogs can tell which part of the node networking stack is broken.
+	ExitHealthy            = 0
+	ExitUnknownFailure     = 1
+	ExitNetworkUnreachable = 2
+	ExitStateNotWritable   = 3
+)
+
+// Check is a single named health probe.
+type Check struct {
+	Name     string
+	ExitCode int
+	Probe    func() error
+}
+
+// Result is the outcome of a single health check.
+type Result struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a health check run.
+type Report struct {
+	Healthy  bool     `json:"healthy"`
+	ExitCode int      `json:"exitCode"`
+	Results  []Result `json:"results"`
+}
+
+// DefaultChecks returns the standard set of health checks for a plugin.
+func DefaultChecks(stateDir string) []Check {
+	return []Check{
+		{
+			Name:     networkCheckName,
+			ExitCode: ExitNetworkUnreachable,
+			Probe:    probeNetwork,
+		},
+		{
+			Name:     "state",
+			ExitCode: ExitStateNotWritable,
+			Probe: func() error {
+				return state.CheckWritable(stateDir)
+			},
+		},
+	}
+}
+
+// Run runs all given checks. The exit code of the report is that of the first failing check.
+func Run(checks []Check) *Report {
+	report := &Report{
+		Healthy:  true,
+		ExitCode: ExitHealthy,
+	}
+
+	for _, check := range checks {
+		result := Result{Name: check.Name, Healthy: true}
+
+		err := check.Probe()
+		if err != nil {
+			result.Healthy = false
+			result.Error = err.Error()
+
+			if report.Healthy {
+				report.Healthy = false
+				report.ExitCode = check.ExitCode
+				if report.ExitCode == ExitHealthy {
+					report.ExitCode = ExitUnknownFailure
+				}
+			}
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// String returns the JSON string of the health report.
+func (report *Report) String() (string, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("health: failed to marshal report %+v: %v", report, err)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package health
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func healthyProbe() error {
+	return nil
+}
+
+func failingProbe() error {
+	return fmt.Errorf("probe failed")
+}
+
+func TestRunAllHealthy(t *testing.T) {
+	report := Run([]Check{
+		{Name: "a", ExitCode: ExitNetworkUnreachable, Probe: healthyProbe},
+		{Name: "b", ExitCode: ExitStateNotWritable, Probe: healthyProbe},
+	})
+
+	assert.True(t, report.Healthy)
+	assert.Equal(t, ExitHealthy, report.ExitCode)
+	assert.Len(t, report.Results, 2)
+}
+
+func TestRunReportsFirstFailingExitCode(t *testing.T) {
+	report := Run([]Check{
+		{Name: "a", ExitCode: ExitNetworkUnreachable, Probe: healthyProbe},
+		{Name: "b", ExitCode: ExitStateNotWritable, Probe: failingProbe},
+		{Name: "c", ExitCode: ExitNetworkUnreachable, Probe: failingProbe},
+	})
+
+	assert.False(t, report.Healthy)
+	assert.Equal(t, ExitStateNotWritable, report.ExitCode)
+	assert.True(t, report.Results[0].Healthy)
+	assert.False(t, report.Results[1].Healthy)
+	assert.Equal(t, "probe failed", report.Results[1].Error)
+	assert.False(t, report.Results[2].Healthy)
+}
+
+func TestRunFailingCheckWithoutExitCode(t *testing.T) {
+	report := Run([]Check{
+		{Name: "a", Probe: failingProbe},
+	})
+
+	assert.Equal(t, ExitUnknownFailure, report.ExitCode)
+}
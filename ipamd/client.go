@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"net"
+	"net/rpc/jsonrpc"
+	"time"
+)
+
+const (
+	// dialTimeout is the timeout for connecting to the daemon.
+	dialTimeout = 5 * time.Second
+)
+
+// Client is a client for the daemon used by CNI plugins.
+type Client struct {
+	socketPath string
+}
+
+// NewClient creates a new Client object for the daemon listening on the given socket.
+func NewClient(socketPath string) *Client {
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+
+	return &Client{socketPath: socketPath}
+}
+
+// Allocate requests an IP address for a container. It returns the allocated address and the
+// subnet gateway.
+func (c *Client) Allocate(containerID string) (*net.IPNet, net.IP, error) {
+	var reply AllocateReply
+	err := c.call("Allocate", &AllocateArgs{ContainerID: containerID}, &reply)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ip, ipNet, err := net.ParseCIDR(reply.IPAddress)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ipamd: invalid allocated address %s", reply.IPAddress)
+	}
+	ipNet.IP = ip
+
+	return ipNet, net.ParseIP(reply.Gateway), nil
+}
+
+// Release releases the IP address allocated to a container.
+func (c *Client) Release(containerID string) error {
+	var reply ReleaseReply
+	return c.call("Release", &ReleaseArgs{ContainerID: containerID}, &reply)
+}
+
+// call invokes a method of the daemon's RPC service.
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	conn, err := net.DialTimeout("unix", c.socketPath, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("ipamd: failed to connect to %s: %v", c.socketPath, err)
+	}
+
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
+
+	err = client.Call(serviceName+"."+method, args, reply)
+	if err != nil {
+		return fmt.Errorf("ipamd: %s failed: %v", method, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,495 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// DefaultSocketPath is the default path of the daemon's unix domain socket.
+	DefaultSocketPath = "/var/run/vpc-ipamd.sock"
+
+	// DefaultWarmIPTarget is the default number of free addresses kept in the warm pool.
+	DefaultWarmIPTarget = 5
+
+	// DefaultReconcileInterval is the default interval between warm pool reconciliations.
+	DefaultReconcileInterval = 30 * time.Second
+
+	// serviceName is the name of the RPC service served by the daemon.
+	serviceName = "IPAM"
+
+	// poolName is the name of the daemon's IP address pool state file.
+	poolName = "ipamd"
+
+	// minAcceptRetryDelay and maxAcceptRetryDelay bound the delay between retries of
+	// temporary accept errors.
+	minAcceptRetryDelay = 5 * time.Millisecond
+	maxAcceptRetryDelay = 1 * time.Second
+)
+
+// EC2API is the subset of the EC2 API used by the daemon.
+type EC2API interface {
+	AssignPrivateIPAddresses(eniID string, count int) ([]net.IP, error)
+	AssignIPv4Prefixes(eniID string, count int) ([]*net.IPNet, error)
+	UnassignIPv4Prefixes(eniID string, prefixes []*net.IPNet) error
+	AssignIPv6Prefixes(eniID string, count int) ([]*net.IPNet, error)
+	UnassignIPv6Prefixes(eniID string, prefixes []*net.IPNet) error
+}
+
+// Config is the configuration of the daemon.
+type Config struct {
+	// ENIID is the ID of the ENI whose secondary IP addresses are allocated.
+	ENIID string
+	// Subnet is the prefix of the ENI's subnet.
+	Subnet *net.IPNet
+	// Gateway is the default gateway of the ENI's subnet.
+	Gateway net.IP
+	// Addresses is the set of secondary IP addresses already assigned to the ENI.
+	Addresses []net.IP
+	// Prefixes is the set of prefixes already delegated to the ENI.
+	Prefixes []*net.IPNet
+	// PrefixDelegation enables growing the pool with prefixes delegated to the ENI instead of
+	// individual secondary IP addresses. It is required for IPv6 subnets.
+	PrefixDelegation bool
+	// WarmIPTarget is the number of free addresses to keep in the pool.
+	WarmIPTarget int
+	// MaxIPs is the maximum number of secondary IP addresses and prefixes that the ENI supports.
+	// Each delegated prefix counts as one.
+	MaxIPs int
+	// StateDir is the directory where allocations are persisted.
+	StateDir string
+	// SocketPath is the path of the unix domain socket the daemon listens on.
+	SocketPath string
+	// ReconcileInterval is the interval between warm pool reconciliations.
+	ReconcileInterval time.Duration
+}
+
+// AllocateArgs are the arguments of an allocation request.
+type AllocateArgs struct {
+	ContainerID string
+}
+
+// AllocateReply is the reply to an allocation request.
+type AllocateReply struct {
+	IPAddress string
+	Gateway   string
+}
+
+// ReleaseArgs are the arguments of a release request.
+type ReleaseArgs struct {
+	ContainerID string
+}
+
+// ReleaseReply is the reply to a release request.
+type ReleaseReply struct {
+	IPAddress string
+}
+
+// Daemon maintains a warm pool of secondary IP addresses on an ENI, and allocates them to
+// containers on behalf of CNI plugins.
+type Daemon struct {
+	config    Config
+	ec2       EC2API
+	lock      sync.Mutex
+	addresses []*net.IPNet
+	prefixes  []*net.IPNet
+	listener  net.Listener
+	replenish chan struct{}
+	done      chan struct{}
+}
+
+// service is the RPC service exported by the daemon.
+type service struct {
+	daemon *Daemon
+}
+
+// NewDaemon creates a new Daemon object.
+func NewDaemon(config Config, ec2 EC2API) *Daemon {
+	if config.WarmIPTarget == 0 {
+		config.WarmIPTarget = DefaultWarmIPTarget
+	}
+	if config.SocketPath == "" {
+		config.SocketPath = DefaultSocketPath
+	}
+	if config.ReconcileInterval == 0 {
+		config.ReconcileInterval = DefaultReconcileInterval
+	}
+
+	daemon := &Daemon{
+		config:    config,
+		ec2:       ec2,
+		replenish: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	for _, ip := range config.Addresses {
+		daemon.addresses = append(daemon.addresses, &net.IPNet{IP: ip, Mask: config.Subnet.Mask})
+	}
+	daemon.prefixes = append(daemon.prefixes, config.Prefixes...)
+
+	return daemon
+}
+
+// Start starts listening for requests and maintaining the warm pool.
+func (daemon *Daemon) Start() error {
+	if daemon.isIPv6() && !daemon.config.PrefixDelegation {
+		return fmt.Errorf("ipamd: IPv6 subnets require prefix delegation")
+	}
+
+	server := rpc.NewServer()
+	err := server.RegisterName(serviceName, &service{daemon: daemon})
+	if err != nil {
+		return err
+	}
+
+	// Remove the socket left behind by a previous instance.
+	os.Remove(daemon.config.SocketPath)
+
+	daemon.listener, err = net.Listen("unix", daemon.config.SocketPath)
+	if err != nil {
+		return fmt.Errorf("ipamd: failed to listen on %s: %v", daemon.config.SocketPath, err)
+	}
+
+	err = os.Chmod(daemon.config.SocketPath, 0600)
+	if err != nil {
+		daemon.listener.Close()
+		return err
+	}
+
+	go daemon.reconcileLoop()
+	go daemon.serve(server)
+
+	log.Infof("Listening on %s.", daemon.config.SocketPath)
+	return nil
+}
+
+// Stop stops the daemon.
+func (daemon *Daemon) Stop() {
+	close(daemon.done)
+	daemon.listener.Close()
+}
+
+// serve accepts connections and serves requests on them.
+func (daemon *Daemon) serve(server *rpc.Server) {
+	var retryDelay time.Duration
+
+	for {
+		conn, err := daemon.listener.Accept()
+		if err != nil {
+			select {
+			case <-daemon.done:
+				return
+			default:
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				// Back off like net/http.Server to avoid spinning on persistent errors.
+				if retryDelay == 0 {
+					retryDelay = minAcceptRetryDelay
+				} else {
+					retryDelay *= 2
+				}
+				if retryDelay > maxAcceptRetryDelay {
+					retryDelay = maxAcceptRetryDelay
+				}
+				log.Errorf("Failed to accept connection, retrying in %v: %v.", retryDelay, err)
+
+				select {
+				case <-daemon.done:
+					return
+				case <-time.After(retryDelay):
+				}
+				continue
+			}
+
+			if !isClosedConnError(err) {
+				log.Errorf("Failed to accept connection: %v.", err)
+			}
+			return
+		}
+		retryDelay = 0
+
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// isClosedConnError returns whether the error was caused by using a closed listener.
+func isClosedConnError(err error) bool {
+	// net.ErrClosed is not available in this Go version.
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// reconcileLoop keeps the warm pool at its target size.
+func (daemon *Daemon) reconcileLoop() {
+	ticker := time.NewTicker(daemon.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		err := daemon.reconcile()
+		if err != nil {
+			log.Errorf("Failed to reconcile warm pool: %v.", err)
+		}
+
+		select {
+		case <-daemon.done:
+			return
+		case <-ticker.C:
+		case <-daemon.replenish:
+		}
+	}
+}
+
+// reconcile keeps the number of free addresses in the pool at the warm target, by assigning
+// secondary IP addresses or delegating prefixes to the ENI, and by releasing unused prefixes.
+func (daemon *Daemon) reconcile() error {
+	daemon.lock.Lock()
+	allocations, err := daemon.pool().Allocations()
+	if err != nil {
+		daemon.lock.Unlock()
+		return err
+	}
+
+	free := daemon.capacity() - len(allocations)
+	slots := len(daemon.addresses) + len(daemon.prefixes)
+
+	// Stop allocating from unused prefixes before releasing them.
+	unused := daemon.removeUnusedPrefixes(allocations, free)
+	daemon.lock.Unlock()
+
+	if len(unused) > 0 {
+		return daemon.releasePrefixes(unused)
+	}
+
+	need := daemon.config.WarmIPTarget - free
+	if need <= 0 {
+		return nil
+	}
+
+	if daemon.config.PrefixDelegation {
+		return daemon.assignPrefixes(need, slots)
+	}
+
+	return daemon.assignAddresses(need, slots)
+}
+
+// assignAddresses assigns new secondary IP addresses to the ENI.
+func (daemon *Daemon) assignAddresses(need int, slots int) error {
+	count := daemon.capSlots(need, slots)
+	if count <= 0 {
+		return nil
+	}
+
+	log.Infof("Assigning %d secondary IP addresses to ENI %s.", count, daemon.config.ENIID)
+	ips, err := daemon.ec2.AssignPrivateIPAddresses(daemon.config.ENIID, count)
+	if err != nil {
+		return err
+	}
+
+	daemon.lock.Lock()
+	defer daemon.lock.Unlock()
+	for _, ip := range ips {
+		daemon.addresses = append(daemon.addresses, &net.IPNet{IP: ip, Mask: daemon.config.Subnet.Mask})
+	}
+
+	return nil
+}
+
+// assignPrefixes delegates enough new prefixes to the ENI for the needed number of addresses.
+func (daemon *Daemon) assignPrefixes(need int, slots int) error {
+	prefixSize := daemon.prefixSize()
+	count := daemon.capSlots((need+prefixSize-1)/prefixSize, slots)
+	if count <= 0 {
+		return nil
+	}
+
+	log.Infof("Delegating %d prefixes to ENI %s.", count, daemon.config.ENIID)
+
+	var prefixes []*net.IPNet
+	var err error
+	if daemon.isIPv6() {
+		prefixes, err = daemon.ec2.AssignIPv6Prefixes(daemon.config.ENIID, count)
+	} else {
+		prefixes, err = daemon.ec2.AssignIPv4Prefixes(daemon.config.ENIID, count)
+	}
+	if err != nil {
+		return err
+	}
+
+	daemon.lock.Lock()
+	defer daemon.lock.Unlock()
+	daemon.prefixes = append(daemon.prefixes, prefixes...)
+
+	return nil
+}
+
+// releasePrefixes releases unused prefixes back to EC2.
+func (daemon *Daemon) releasePrefixes(prefixes []*net.IPNet) error {
+	log.Infof("Releasing unused prefixes %v from ENI %s.", prefixes, daemon.config.ENIID)
+
+	var err error
+	if daemon.isIPv6() {
+		err = daemon.ec2.UnassignIPv6Prefixes(daemon.config.ENIID, prefixes)
+	} else {
+		err = daemon.ec2.UnassignIPv4Prefixes(daemon.config.ENIID, prefixes)
+	}
+
+	if err != nil {
+		// The prefixes are still delegated to the ENI. Allocate from them again.
+		daemon.lock.Lock()
+		daemon.prefixes = append(daemon.prefixes, prefixes...)
+		daemon.lock.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// removeUnusedPrefixes removes prefixes without allocations from the pool, as long as the pool
+// keeps at least the warm target of free addresses, and returns them. Must be called with the
+// lock held.
+func (daemon *Daemon) removeUnusedPrefixes(allocations map[string]string, free int) []*net.IPNet {
+	if !daemon.config.PrefixDelegation {
+		return nil
+	}
+
+	utilization := ipam.PrefixUtilization(allocations, daemon.prefixes)
+
+	var kept, unused []*net.IPNet
+	for _, prefix := range daemon.prefixes {
+		size := ipam.PrefixSize(prefix)
+		if utilization[prefix.String()] == 0 && free-size >= daemon.config.WarmIPTarget {
+			unused = append(unused, prefix)
+			free -= size
+			continue
+		}
+		kept = append(kept, prefix)
+	}
+
+	daemon.prefixes = kept
+	return unused
+}
+
+// capacity returns the total number of addresses in the pool. Must be called with the lock held.
+func (daemon *Daemon) capacity() int {
+	total := len(daemon.addresses)
+	for _, prefix := range daemon.prefixes {
+		size := ipam.PrefixSize(prefix)
+		if total > int(^uint(0)>>1)-size {
+			return int(^uint(0) >> 1)
+		}
+		total += size
+	}
+
+	return total
+}
+
+// capSlots limits the number of new addresses or prefixes to the free slots on the ENI.
+func (daemon *Daemon) capSlots(count int, slots int) int {
+	if daemon.config.MaxIPs > 0 && slots+count > daemon.config.MaxIPs {
+		count = daemon.config.MaxIPs - slots
+	}
+	return count
+}
+
+// prefixSize returns the number of addresses in prefixes delegated to the ENI.
+func (daemon *Daemon) prefixSize() int {
+	length, bits := ipam.IPv4PrefixLength, 32
+	if daemon.isIPv6() {
+		length, bits = ipam.IPv6PrefixLength, 128
+	}
+
+	return ipam.PrefixSize(&net.IPNet{Mask: net.CIDRMask(length, bits)})
+}
+
+// isIPv6 returns whether the ENI subnet is an IPv6 subnet.
+func (daemon *Daemon) isIPv6() bool {
+	return daemon.config.Subnet.IP.To4() == nil
+}
+
+// pool returns the IP address pool backed by the addresses and prefixes currently assigned to
+// the ENI. Must be called with the lock held.
+func (daemon *Daemon) pool() *ipam.Pool {
+	addresses := make([]*net.IPNet, len(daemon.addresses))
+	copy(addresses, daemon.addresses)
+	prefixes := make([]*net.IPNet, len(daemon.prefixes))
+	copy(prefixes, daemon.prefixes)
+
+	return ipam.NewPrefixPool(daemon.config.StateDir, poolName, addresses, prefixes, daemon.config.Subnet.Mask)
+}
+
+// triggerReconcile wakes up the reconcile loop without blocking.
+func (daemon *Daemon) triggerReconcile() {
+	select {
+	case daemon.replenish <- struct{}{}:
+	default:
+	}
+}
+
+// Allocate allocates an IP address to a container.
+func (svc *service) Allocate(args *AllocateArgs, reply *AllocateReply) error {
+	daemon := svc.daemon
+
+	// Hold the lock, so that prefixes are not released while allocating from them.
+	daemon.lock.Lock()
+	address, err := daemon.pool().Allocate(args.ContainerID)
+	daemon.lock.Unlock()
+	if err != nil {
+		// The pool is exhausted. Replenish it for subsequent requests.
+		daemon.triggerReconcile()
+		log.Errorf("Failed to allocate IP address to container %s: %v.", args.ContainerID, err)
+		return err
+	}
+
+	log.Infof("Allocated IP address %s to container %s.", address, args.ContainerID)
+	reply.IPAddress = address.String()
+	if daemon.config.Gateway != nil {
+		reply.Gateway = daemon.config.Gateway.String()
+	}
+
+	daemon.triggerReconcile()
+	return nil
+}
+
+// Release releases the IP address allocated to a container.
+func (svc *service) Release(args *ReleaseArgs, reply *ReleaseReply) error {
+	daemon := svc.daemon
+
+	daemon.lock.Lock()
+	address, err := daemon.pool().Release(args.ContainerID)
+	daemon.lock.Unlock()
+	if err != nil {
+		log.Errorf("Failed to release IP address of container %s: %v.", args.ContainerID, err)
+		return err
+	}
+
+	if address != nil {
+		log.Infof("Released IP address %s of container %s.", address, args.ContainerID)
+		reply.IPAddress = address.String()
+		daemon.triggerReconcile()
+	}
+
+	return nil
+}
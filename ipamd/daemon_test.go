@@ -0,0 +1,284 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEC2 assigns sequential addresses and prefixes in 10.0.1.0/24.
+type fakeEC2 struct {
+	lock       sync.Mutex
+	next       int
+	nextPrefix int
+	released   []*net.IPNet
+}
+
+func (f *fakeEC2) AssignPrivateIPAddresses(eniID string, count int) ([]net.IP, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var ips []net.IP
+	for i := 0; i < count; i++ {
+		ips = append(ips, net.ParseIP(fmt.Sprintf("10.0.1.%d", 100+f.next)))
+		f.next++
+	}
+	return ips, nil
+}
+
+func (f *fakeEC2) AssignIPv4Prefixes(eniID string, count int) ([]*net.IPNet, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var prefixes []*net.IPNet
+	for i := 0; i < count; i++ {
+		_, prefix, _ := net.ParseCIDR(fmt.Sprintf("10.0.1.%d/28", 128+16*f.nextPrefix))
+		prefixes = append(prefixes, prefix)
+		f.nextPrefix++
+	}
+	return prefixes, nil
+}
+
+func (f *fakeEC2) UnassignIPv4Prefixes(eniID string, prefixes []*net.IPNet) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.released = append(f.released, prefixes...)
+	return nil
+}
+
+func (f *fakeEC2) AssignIPv6Prefixes(eniID string, count int) ([]*net.IPNet, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (f *fakeEC2) UnassignIPv6Prefixes(eniID string, prefixes []*net.IPNet) error {
+	return fmt.Errorf("not supported")
+}
+
+func (f *fakeEC2) assignedPrefixes() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.nextPrefix
+}
+
+func (f *fakeEC2) releasedPrefixes() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.released)
+}
+
+func (f *fakeEC2) assigned() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.next
+}
+
+func newTestDaemon(t *testing.T, config Config) (*Daemon, *fakeEC2, func()) {
+	dir, err := ioutil.TempDir("", "ipamd")
+	require.NoError(t, err)
+
+	_, subnet, _ := net.ParseCIDR("10.0.1.0/24")
+	config.ENIID = "eni-1"
+	config.Subnet = subnet
+	config.Gateway = net.ParseIP("10.0.1.1")
+	config.StateDir = dir
+	config.SocketPath = filepath.Join(dir, "ipamd.sock")
+	config.ReconcileInterval = time.Hour
+
+	ec2 := &fakeEC2{}
+	daemon := NewDaemon(config, ec2)
+	require.NoError(t, daemon.Start())
+
+	return daemon, ec2, func() {
+		daemon.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitForAssigned waits until the fake EC2 API has assigned the given number of addresses.
+func waitForAssigned(t *testing.T, ec2 *fakeEC2, count int) {
+	for i := 0; i < 100 && ec2.assigned() < count; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, count, ec2.assigned())
+}
+
+func TestWarmPoolFilledOnStart(t *testing.T) {
+	_, ec2, cleanup := newTestDaemon(t, Config{WarmIPTarget: 3})
+	defer cleanup()
+
+	waitForAssigned(t, ec2, 3)
+}
+
+func TestAllocateAndRelease(t *testing.T) {
+	daemon, ec2, cleanup := newTestDaemon(t, Config{WarmIPTarget: 2})
+	defer cleanup()
+	waitForAssigned(t, ec2, 2)
+
+	client := NewClient(daemon.config.SocketPath)
+
+	address, gateway, err := client.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.100/24", address.String())
+	assert.Equal(t, "10.0.1.1", gateway.String())
+
+	// Allocation is idempotent.
+	address, _, err = client.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.100/24", address.String())
+
+	// The warm pool is replenished after an allocation.
+	waitForAssigned(t, ec2, 3)
+
+	err = client.Release("container1")
+	assert.NoError(t, err)
+}
+
+func TestMaxIPs(t *testing.T) {
+	daemon, ec2, cleanup := newTestDaemon(t, Config{
+		Addresses:    []net.IP{net.ParseIP("10.0.1.20")},
+		WarmIPTarget: 5,
+		MaxIPs:       2,
+	})
+	defer cleanup()
+	waitForAssigned(t, ec2, 1)
+
+	client := NewClient(daemon.config.SocketPath)
+
+	address, _, err := client.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address.String())
+
+	_, _, err = client.Allocate("container2")
+	require.NoError(t, err)
+
+	_, _, err = client.Allocate("container3")
+	assert.Error(t, err)
+}
+
+// waitFor waits until the condition holds.
+func waitFor(t *testing.T, condition func() bool) {
+	for i := 0; i < 100 && !condition(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, condition())
+}
+
+func TestPrefixDelegation(t *testing.T) {
+	daemon, ec2, cleanup := newTestDaemon(t, Config{WarmIPTarget: 3, PrefixDelegation: true})
+	defer cleanup()
+	waitFor(t, func() bool { return ec2.assignedPrefixes() == 1 })
+	assert.Equal(t, 0, ec2.assigned())
+
+	client := NewClient(daemon.config.SocketPath)
+
+	// Addresses are allocated from the prefix with the subnet mask.
+	for i := 0; i < 14; i++ {
+		address, _, err := client.Allocate(fmt.Sprintf("container%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("10.0.1.%d/24", 128+i), address.String())
+	}
+
+	// A second prefix is delegated when fewer than the warm target are free.
+	waitFor(t, func() bool { return ec2.assignedPrefixes() == 2 })
+}
+
+func TestPrefixDelegationReleasesUnusedPrefixes(t *testing.T) {
+	var prefixes []*net.IPNet
+	for _, cidr := range []string{"10.0.1.16/28", "10.0.1.32/28", "10.0.1.48/28"} {
+		_, prefix, _ := net.ParseCIDR(cidr)
+		prefixes = append(prefixes, prefix)
+	}
+
+	daemon, ec2, cleanup := newTestDaemon(t, Config{
+		Prefixes:         prefixes,
+		WarmIPTarget:     3,
+		PrefixDelegation: true,
+	})
+	defer cleanup()
+
+	// All but one unused prefix are released.
+	waitFor(t, func() bool { return ec2.releasedPrefixes() == 2 })
+
+	daemon.lock.Lock()
+	defer daemon.lock.Unlock()
+	require.Len(t, daemon.prefixes, 1)
+	assert.Equal(t, "10.0.1.48/28", daemon.prefixes[0].String())
+}
+
+func TestIPv6RequiresPrefixDelegation(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("2600:1f14::/64")
+	daemon := NewDaemon(Config{Subnet: subnet}, &fakeEC2{})
+	assert.Error(t, daemon.Start())
+}
+
+func TestClientWithoutDaemon(t *testing.T) {
+	client := NewClient(filepath.Join(os.TempDir(), "ipamd-missing.sock"))
+	_, _, err := client.Allocate("container1")
+	assert.Error(t, err)
+}
+
+// temporaryError is a temporary net.Error.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary error" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// failingListener fails a number of accepts with a temporary error, then reports itself closed.
+type failingListener struct {
+	net.Listener
+	failures int
+	accepts  int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts++
+	if l.accepts <= l.failures {
+		return nil, temporaryError{}
+	}
+	return nil, fmt.Errorf("accept unix: use of closed network connection")
+}
+
+func TestServeBacksOffTemporaryErrors(t *testing.T) {
+	listener := &failingListener{failures: 3}
+	daemon := NewDaemon(Config{}, &fakeEC2{})
+	daemon.listener = listener
+
+	start := time.Now()
+	daemon.serve(rpc.NewServer())
+
+	// Retries are delayed by 5ms, 10ms and 20ms before the closed listener ends the loop.
+	assert.Equal(t, 4, listener.accepts)
+	assert.True(t, time.Since(start) >= 35*time.Millisecond)
+}
+
+func TestServeStopsOnClosedListener(t *testing.T) {
+	listener := &failingListener{}
+	daemon := NewDaemon(Config{}, &fakeEC2{})
+	daemon.listener = listener
+
+	daemon.serve(rpc.NewServer())
+	assert.Equal(t, 1, listener.accepts)
+}
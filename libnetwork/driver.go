@@ -0,0 +1,542 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package libnetwork implements a Docker libnetwork remote network driver on top of the
+// vpc-shared-eni network builder, so that Docker engines without a CNI-aware runtime can
+// connect containers to shared ENIs with `docker network create -d vpc-eni`.
+package libnetwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// DriverName is the name of the network driver, as passed to docker network create -d.
+	DriverName = "vpc-eni"
+
+	// DefaultSocketPath is the path of the socket Docker discovers the driver on.
+	DefaultSocketPath = "/run/docker/plugins/" + DriverName + ".sock"
+
+	// defaultIfName is the default name of the container interface.
+	defaultIfName = "eth0"
+
+	// stateFileName is the name of the file storing the networks and endpoints of the driver.
+	stateFileName = "driver.json"
+
+	// contentType is the media type of plugin API requests and responses.
+	contentType = "application/vnd.docker.plugins.v1.2+json"
+
+	// genericOptionsKey is the key of the driver options passed with docker network create -o.
+	genericOptionsKey = "com.docker.network.generic"
+)
+
+// Config is the configuration of the driver.
+type Config struct {
+	// StateDir is the directory where networks and endpoints are persisted.
+	StateDir string
+	// SocketPath is the path of the unix domain socket the driver listens on.
+	SocketPath string
+}
+
+// networkState is a network created with the driver.
+type networkState struct {
+	Name          string   `json:"name"`
+	ENIName       string   `json:"eniName,omitempty"`
+	ENIMACAddress string   `json:"eniMACAddress,omitempty"`
+	ENIIPAddress  string   `json:"eniIPAddress,omitempty"`
+	BridgeType    string   `json:"bridgeType,omitempty"`
+	VPCCIDRs      []string `json:"vpcCIDRs,omitempty"`
+	Gateway       string   `json:"gateway,omitempty"`
+	IfName        string   `json:"ifName"`
+}
+
+// endpointState is an endpoint created with the driver.
+type endpointState struct {
+	NetworkID  string `json:"networkID"`
+	IPAddress  string `json:"ipAddress"`
+	MACAddress string `json:"macAddress,omitempty"`
+	SandboxKey string `json:"sandboxKey,omitempty"`
+}
+
+// driverState is the persisted state of the driver.
+type driverState struct {
+	Networks  map[string]*networkState  `json:"networks"`
+	Endpoints map[string]*endpointState `json:"endpoints"`
+}
+
+// Driver serves the libnetwork remote driver API and builds networks with a network builder.
+type Driver struct {
+	config     Config
+	nb         network.Builder
+	resolveENI func(name string, macAddress string) (*eni.ENI, error)
+	lock       sync.Mutex
+	listener   net.Listener
+	server     *http.Server
+}
+
+// NewDriver creates a new Driver object that builds networks with the given builder.
+func NewDriver(config Config, nb network.Builder) *Driver {
+	if config.SocketPath == "" {
+		config.SocketPath = DefaultSocketPath
+	}
+
+	return &Driver{
+		config:     config,
+		nb:         nb,
+		resolveENI: findENI,
+	}
+}
+
+// Start starts listening for requests.
+func (d *Driver) Start() error {
+	// Remove the socket left behind by a previous instance.
+	os.Remove(d.config.SocketPath)
+
+	err := os.MkdirAll(filepath.Dir(d.config.SocketPath), 0755)
+	if err != nil {
+		return fmt.Errorf("libnetwork: failed to create socket directory: %v", err)
+	}
+
+	d.listener, err = net.Listen("unix", d.config.SocketPath)
+	if err != nil {
+		return fmt.Errorf("libnetwork: failed to listen on %s: %v", d.config.SocketPath, err)
+	}
+
+	d.server = &http.Server{Handler: d.Handler()}
+	go d.server.Serve(d.listener)
+
+	log.Infof("Listening on %s.", d.config.SocketPath)
+	return nil
+}
+
+// Stop stops the driver.
+func (d *Driver) Stop() {
+	d.server.Close()
+}
+
+// Handler returns the HTTP handler of the remote driver API.
+func (d *Driver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(path string, fn func(body json.RawMessage) (interface{}, error)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			var body json.RawMessage
+			err := json.NewDecoder(r.Body).Decode(&body)
+			if err != nil {
+				body = json.RawMessage("{}")
+			}
+
+			log.Infof("Received %s request: %s.", path, body)
+			res, err := fn(body)
+			w.Header().Set("Content-Type", contentType)
+			if err != nil {
+				log.Errorf("Failed to serve %s request: %v.", path, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				res = map[string]string{"Err": err.Error()}
+			}
+			json.NewEncoder(w).Encode(res)
+		})
+	}
+
+	empty := func(json.RawMessage) (interface{}, error) { return struct{}{}, nil }
+
+	handle("/Plugin.Activate", func(json.RawMessage) (interface{}, error) {
+		return map[string][]string{"Implements": {"NetworkDriver"}}, nil
+	})
+	handle("/NetworkDriver.GetCapabilities", func(json.RawMessage) (interface{}, error) {
+		return map[string]string{"Scope": "local", "ConnectivityScope": "local"}, nil
+	})
+	handle("/NetworkDriver.CreateNetwork", d.createNetwork)
+	handle("/NetworkDriver.DeleteNetwork", d.deleteNetwork)
+	handle("/NetworkDriver.CreateEndpoint", d.createEndpoint)
+	handle("/NetworkDriver.DeleteEndpoint", d.deleteEndpoint)
+	handle("/NetworkDriver.EndpointOperInfo", func(json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"Value": map[string]string{}}, nil
+	})
+	handle("/NetworkDriver.Join", d.join)
+	handle("/NetworkDriver.Leave", d.leave)
+	handle("/NetworkDriver.DiscoverNew", empty)
+	handle("/NetworkDriver.DiscoverDelete", empty)
+	handle("/NetworkDriver.ProgramExternalConnectivity", empty)
+	handle("/NetworkDriver.RevokeExternalConnectivity", empty)
+
+	return mux
+}
+
+// createNetwork validates and stores the options of a new network. The network is built when
+// the first container joins it.
+func (d *Driver) createNetwork(body json.RawMessage) (interface{}, error) {
+	var req struct {
+		NetworkID string
+		Options   map[string]json.RawMessage
+		IPv4Data  []struct {
+			Pool    string
+			Gateway string
+		}
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	var options map[string]string
+	if raw, ok := req.Options[genericOptionsKey]; ok {
+		err = json.Unmarshal(raw, &options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid driver options: %v", err)
+		}
+	}
+
+	nw, err := newNetworkState(req.NetworkID, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.IPv4Data) != 0 && req.IPv4Data[0].Gateway != "" {
+		nw.Gateway = strings.SplitN(req.IPv4Data[0].Gateway, "/", 2)[0]
+	}
+
+	return struct{}{}, d.update(func(s *driverState) error {
+		s.Networks[req.NetworkID] = nw
+		return nil
+	})
+}
+
+// newNetworkState returns the network with the given driver options.
+func newNetworkState(networkID string, options map[string]string) (*networkState, error) {
+	if len(networkID) < 12 {
+		return nil, fmt.Errorf("invalid network ID %s", networkID)
+	}
+
+	nw := &networkState{
+		Name:   DriverName + "-" + networkID[:12],
+		IfName: defaultIfName,
+	}
+	for key, value := range options {
+		switch key {
+		case "eniName":
+			nw.ENIName = value
+		case "eniMACAddress":
+			nw.ENIMACAddress = value
+		case "eniIPAddress":
+			nw.ENIIPAddress = value
+		case "bridgeType":
+			nw.BridgeType = value
+		case "vpcCIDRs":
+			nw.VPCCIDRs = strings.Split(value, ",")
+		case "ifName":
+			nw.IfName = value
+		default:
+			return nil, fmt.Errorf("unknown driver option %s", key)
+		}
+	}
+
+	if nw.ENIName == "" && nw.ENIMACAddress == "" {
+		return nil, fmt.Errorf("missing required driver option eniName or eniMACAddress")
+	}
+
+	// Parse the addresses now, so that invalid networks are rejected on creation.
+	_, err := nw.network(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return nw, nil
+}
+
+// network returns the container network built by the network builder.
+func (nw *networkState) network(sharedENI *eni.ENI) (*network.Network, error) {
+	n := &network.Network{
+		Name:       nw.Name,
+		BridgeType: nw.BridgeType,
+		SharedENI:  sharedENI,
+		OwnerID:    DriverName,
+	}
+
+	var err error
+	if nw.ENIIPAddress != "" {
+		n.ENIIPAddress, err = parseIPNet(nw.ENIIPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid eniIPAddress %s", nw.ENIIPAddress)
+		}
+	}
+
+	for _, cidr := range nw.VPCCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vpcCIDRs %s", cidr)
+		}
+		n.VPCCIDRs = append(n.VPCCIDRs, *ipNet)
+	}
+
+	if nw.Gateway != "" {
+		n.GatewayIPAddress = net.ParseIP(nw.Gateway)
+	}
+
+	return n, nil
+}
+
+// deleteNetwork deletes a network and forgets it.
+func (d *Driver) deleteNetwork(body json.RawMessage) (interface{}, error) {
+	var req struct {
+		NetworkID string
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, d.update(func(s *driverState) error {
+		nw, ok := s.Networks[req.NetworkID]
+		if !ok {
+			return nil
+		}
+
+		sharedENI, err := d.resolveENI(nw.ENIName, nw.ENIMACAddress)
+		if err == nil {
+			var n *network.Network
+			n, err = nw.network(sharedENI)
+			if err == nil {
+				err = d.nb.DeleteNetwork(n)
+			}
+		}
+		if err != nil {
+			// The network may never have been built. Forget it anyway.
+			log.Errorf("Failed to delete network %s, ignoring: %v.", nw.Name, err)
+		}
+
+		delete(s.Networks, req.NetworkID)
+		return nil
+	})
+}
+
+// createEndpoint stores the addresses of a new endpoint assigned by Docker IPAM.
+func (d *Driver) createEndpoint(body json.RawMessage) (interface{}, error) {
+	var req struct {
+		NetworkID  string
+		EndpointID string
+		Interface  struct {
+			Address    string
+			MacAddress string
+		}
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = parseIPNet(req.Interface.Address); err != nil {
+		return nil, fmt.Errorf("invalid endpoint address %s", req.Interface.Address)
+	}
+
+	return map[string]interface{}{}, d.update(func(s *driverState) error {
+		if _, ok := s.Networks[req.NetworkID]; !ok {
+			return fmt.Errorf("network %s not found", req.NetworkID)
+		}
+
+		s.Endpoints[req.EndpointID] = &endpointState{
+			NetworkID:  req.NetworkID,
+			IPAddress:  req.Interface.Address,
+			MACAddress: req.Interface.MacAddress,
+		}
+		return nil
+	})
+}
+
+// deleteEndpoint forgets an endpoint.
+func (d *Driver) deleteEndpoint(body json.RawMessage) (interface{}, error) {
+	var req struct {
+		EndpointID string
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, d.update(func(s *driverState) error {
+		delete(s.Endpoints, req.EndpointID)
+		return nil
+	})
+}
+
+// join builds the network if necessary and connects the endpoint to the sandbox. The network
+// builder moves the interface into the sandbox itself, so no interface is returned to Docker.
+func (d *Driver) join(body json.RawMessage) (interface{}, error) {
+	var req struct {
+		NetworkID  string
+		EndpointID string
+		SandboxKey string
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]interface{}{"DisableGatewayService": true}
+	return res, d.update(func(s *driverState) error {
+		nw, ep, err := d.endpoint(s, req.NetworkID, req.EndpointID, req.SandboxKey)
+		if err != nil {
+			return err
+		}
+
+		err = d.nb.FindOrCreateNetwork(nw)
+		if err != nil {
+			log.Errorf("Failed to create network: %v.", err)
+			return err
+		}
+
+		err = d.nb.FindOrCreateEndpoint(nw, ep)
+		if err != nil {
+			log.Errorf("Failed to create endpoint: %v.", err)
+			return err
+		}
+
+		s.Endpoints[req.EndpointID].SandboxKey = req.SandboxKey
+		return nil
+	})
+}
+
+// leave disconnects the endpoint from its sandbox.
+func (d *Driver) leave(body json.RawMessage) (interface{}, error) {
+	var req struct {
+		NetworkID  string
+		EndpointID string
+	}
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, d.update(func(s *driverState) error {
+		nw, ep, err := d.endpoint(s, req.NetworkID, req.EndpointID, "")
+		if err != nil {
+			return err
+		}
+
+		err = d.nb.DeleteEndpoint(nw, ep)
+		if err != nil {
+			log.Errorf("Failed to delete endpoint: %v.", err)
+			return err
+		}
+
+		s.Endpoints[req.EndpointID].SandboxKey = ""
+		return nil
+	})
+}
+
+// endpoint returns the network and endpoint built by the network builder for an endpoint.
+func (d *Driver) endpoint(
+	s *driverState, networkID string, endpointID string, sandboxKey string) (*network.Network, *network.Endpoint, error) {
+
+	nws, ok := s.Networks[networkID]
+	if !ok {
+		return nil, nil, fmt.Errorf("network %s not found", networkID)
+	}
+	eps, ok := s.Endpoints[endpointID]
+	if !ok {
+		return nil, nil, fmt.Errorf("endpoint %s not found", endpointID)
+	}
+	if sandboxKey == "" {
+		sandboxKey = eps.SandboxKey
+	}
+
+	sharedENI, err := d.resolveENI(nws.ENIName, nws.ENIMACAddress)
+	if err != nil {
+		log.Errorf("Failed to find ENI %s: %v.", nws.ENIName, err)
+		return nil, nil, err
+	}
+
+	nw, err := nws.network(sharedENI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ipAddress, err := parseIPNet(eps.IPAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ep := &network.Endpoint{
+		ContainerID: endpointID,
+		NetNSName:   sandboxKey,
+		IfName:      nws.IfName,
+		IPAddress:   ipAddress,
+		OwnerID:     DriverName,
+	}
+
+	return nw, ep, nil
+}
+
+// update atomically applies the given update to the persisted driver state.
+func (d *Driver) update(fn func(s *driverState) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var s driverState
+	path := filepath.Join(d.config.StateDir, stateFileName)
+	return state.UpdateJSONFile(path, &s, func() error {
+		if s.Networks == nil {
+			s.Networks = make(map[string]*networkState)
+		}
+		if s.Endpoints == nil {
+			s.Endpoints = make(map[string]*endpointState)
+		}
+		return fn(&s)
+	})
+}
+
+// parseIPNet parses an address in CIDR notation, keeping the host address.
+func parseIPNet(s string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	ipNet.IP = ip
+
+	return ipNet, nil
+}
+
+// findENI finds the shared ENI with the given link name or MAC address.
+func findENI(name string, macAddress string) (*eni.ENI, error) {
+	var mac net.HardwareAddr
+	var err error
+	if macAddress != "" {
+		mac, err = net.ParseMAC(macAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sharedENI, err := eni.NewENI(name, mac)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sharedENI.AttachToLink()
+	if err != nil {
+		return nil, err
+	}
+
+	return sharedENI, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package libnetwork
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testNetworkID  = "0123456789abcdef0123456789abcdef"
+	testEndpointID = "fedcba9876543210fedcba9876543210"
+)
+
+func newTestDriver(t *testing.T) (*Driver, *fake.Builder, func()) {
+	dir, err := ioutil.TempDir("", "libnetwork")
+	require.NoError(t, err)
+
+	fb := fake.NewBuilder()
+	d := NewDriver(Config{StateDir: dir}, fb)
+	d.resolveENI = func(name string, macAddress string) (*eni.ENI, error) {
+		return eni.NewENI(name, nil)
+	}
+
+	return d, fb, func() { os.RemoveAll(dir) }
+}
+
+// call sends a remote driver API request and returns the status code and decoded response.
+func call(t *testing.T, d *Driver, path string, req interface{}) (int, map[string]interface{}) {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+
+	var res map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return w.Code, res
+}
+
+func createTestNetwork(t *testing.T, d *Driver, options map[string]string) (int, map[string]interface{}) {
+	return call(t, d, "/NetworkDriver.CreateNetwork", map[string]interface{}{
+		"NetworkID": testNetworkID,
+		"Options":   map[string]interface{}{genericOptionsKey: options},
+		"IPv4Data":  []map[string]string{{"Pool": "10.0.1.0/24", "Gateway": "10.0.1.1/24"}},
+	})
+}
+
+func TestActivate(t *testing.T) {
+	d, _, cleanup := newTestDriver(t)
+	defer cleanup()
+
+	code, res := call(t, d, "/Plugin.Activate", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"NetworkDriver"}, res["Implements"])
+
+	_, res = call(t, d, "/NetworkDriver.GetCapabilities", nil)
+	assert.Equal(t, "local", res["Scope"])
+}
+
+func TestEndpointLifecycle(t *testing.T) {
+	d, fb, cleanup := newTestDriver(t)
+	defer cleanup()
+
+	code, _ := createTestNetwork(t, d, map[string]string{"eniName": "eth1", "bridgeType": "L3"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = call(t, d, "/NetworkDriver.CreateEndpoint", map[string]interface{}{
+		"NetworkID":  testNetworkID,
+		"EndpointID": testEndpointID,
+		"Interface":  map[string]string{"Address": "10.0.1.20/24"},
+	})
+	require.Equal(t, http.StatusOK, code)
+
+	code, res := call(t, d, "/NetworkDriver.Join", map[string]string{
+		"NetworkID":  testNetworkID,
+		"EndpointID": testEndpointID,
+		"SandboxKey": "/var/run/docker/netns/0123456789ab",
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, res["DisableGatewayService"])
+	assert.Nil(t, res["InterfaceName"])
+	assert.True(t, fb.HasNetwork("vpc-eni-0123456789ab"))
+	assert.True(t, fb.HasEndpoint(testEndpointID))
+
+	code, _ = call(t, d, "/NetworkDriver.Leave", map[string]string{
+		"NetworkID":  testNetworkID,
+		"EndpointID": testEndpointID,
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, fb.HasEndpoint(testEndpointID))
+
+	code, _ = call(t, d, "/NetworkDriver.DeleteEndpoint", map[string]string{"EndpointID": testEndpointID})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = call(t, d, "/NetworkDriver.DeleteNetwork", map[string]string{"NetworkID": testNetworkID})
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, fb.HasNetwork("vpc-eni-0123456789ab"))
+}
+
+func TestCreateNetworkInvalidOptions(t *testing.T) {
+	tests := []map[string]string{
+		nil,
+		{"eniName": "eth1", "bridgeType": "L3", "unknown": "value"},
+		{"eniName": "eth1", "eniIPAddress": "10.0.1"},
+		{"eniName": "eth1", "vpcCIDRs": "10.0.0.0/16,invalid"},
+	}
+
+	for _, options := range tests {
+		d, _, cleanup := newTestDriver(t)
+		code, res := createTestNetwork(t, d, options)
+		assert.Equal(t, http.StatusInternalServerError, code, "%v", options)
+		assert.NotEmpty(t, res["Err"])
+		cleanup()
+	}
+}
+
+func TestJoinUnknownEndpoint(t *testing.T) {
+	d, fb, cleanup := newTestDriver(t)
+	defer cleanup()
+
+	code, _ := createTestNetwork(t, d, map[string]string{"eniName": "eth1"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, res := call(t, d, "/NetworkDriver.Join", map[string]string{
+		"NetworkID":  testNetworkID,
+		"EndpointID": testEndpointID,
+	})
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, res["Err"], "not found")
+	assert.Empty(t, fb.Calls())
+}
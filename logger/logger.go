@@ -16,6 +16,8 @@ package logger
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	log "github.com/cihub/seelog"
 )
@@ -24,25 +26,27 @@ const (
 	// Environment variables for custom log settings.
 	envLogLevel    = "VPC_CNI_LOG_LEVEL"
 	envLogFilePath = "VPC_CNI_LOG_FILE"
+	envLogDir      = "VPC_CNI_LOG_DIR"
+	envLogMaxSize  = "VPC_CNI_LOG_MAX_SIZE_MB"
+	envLogMaxRolls = "VPC_CNI_LOG_MAX_ROLLS"
 
-	// Log configuration used by seelog.
-	logConfigFormat = `
-<seelog type="asyncloop" minlevel="%s">
- <outputs formatid="main">
-  <rollingfile filename="%s" type="date" datepattern="2006-01-02-15" archivetype="none" maxrolls="24" />
- </outputs>
- <formats>
-  <format id="main" format="%%UTCDate(2006-01-02T15:04:05Z07:00) [%%LEVEL] %%Msg%%n" />
- </formats>
-</seelog>
-`
+	// Default log rolling settings.
+	defaultLogMaxSizeMB = 10
+	defaultLogMaxRolls  = 5
 )
 
-// Setup sets up a file logger.
+// Setup sets up a file logger that rolls and compresses log files by size. The log file is
+// opened when the first message at the effective log level is written, so that commands that
+// log nothing do not pay for it. Unless the log location is overridden, messages go to a per-OS
+// fallback directory if the default log file cannot be created, e.g. on a read-only rootfs.
 func Setup(logFilePath string) {
-	config := fmt.Sprintf(logConfigFormat, getLogLevel(), getLogFilePath(logFilePath))
+	logLevel, _ := log.LogLevelFromString(getLogLevel())
+	file := newRollingFile(getLogFilePath(logFilePath), getLogMaxSize(), getLogMaxRolls())
+	if file.path == logFilePath {
+		file.fallbackPath = filepath.Join(fallbackLogDir, filepath.Base(logFilePath))
+	}
 
-	logger, err := log.LoggerFromConfigAsString(config)
+	logger, err := log.LoggerFromCustomReceiver(newFileReceiver(logLevel, file))
 	if err != nil {
 		fmt.Println("Failed to setup logger: ", err)
 		return
@@ -61,12 +65,38 @@ func getLogLevel() string {
 	return logLevel.String()
 }
 
-// GetLogFilePath returns the effective log file path.
+// GetLogFilePath returns the effective log file path. A custom log directory keeps the default
+// log file name.
 func getLogFilePath(defaultLogFilePath string) string {
 	logFilePath := os.Getenv(envLogFilePath)
-	if logFilePath == "" {
-		logFilePath = defaultLogFilePath
+	if logFilePath != "" {
+		return logFilePath
+	}
+
+	logDir := os.Getenv(envLogDir)
+	if logDir != "" {
+		return filepath.Join(logDir, filepath.Base(defaultLogFilePath))
+	}
+
+	return defaultLogFilePath
+}
+
+// getLogMaxSize returns the effective maximum size of a log file in bytes.
+func getLogMaxSize() int64 {
+	maxSizeMB, err := strconv.Atoi(os.Getenv(envLogMaxSize))
+	if err != nil || maxSizeMB <= 0 {
+		maxSizeMB = defaultLogMaxSizeMB
+	}
+
+	return int64(maxSizeMB) << 20
+}
+
+// getLogMaxRolls returns the effective maximum number of rolled log files to keep.
+func getLogMaxRolls() int {
+	maxRolls, err := strconv.Atoi(os.Getenv(envLogMaxRolls))
+	if err != nil || maxRolls < 0 {
+		maxRolls = defaultLogMaxRolls
 	}
 
-	return logFilePath
+	return maxRolls
 }
@@ -29,6 +29,13 @@ func TestGetLogFilePathReturnsOverriddenPath(t *testing.T) {
 	assert.Equal(t, path, getLogFilePath("/tmp/bar"))
 }
 
+func TestGetLogFilePathReturnsPathInOverriddenDir(t *testing.T) {
+	os.Setenv(envLogDir, "/tmp/logs")
+	defer os.Unsetenv(envLogDir)
+
+	assert.Equal(t, "/tmp/logs/bar.log", getLogFilePath("/var/log/bar.log"))
+}
+
 func TestGetLogFilePathReturnsDefaultPath(t *testing.T) {
 	path := "/tmp/foo"
 	assert.Equal(t, path, getLogFilePath(path))
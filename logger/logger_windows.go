@@ -0,0 +1,23 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fallbackLogDir is the directory of log files on hosts where the default log directory is not
+// writable, such as hardened images that do not allow creating directories on the system drive.
+var fallbackLogDir = filepath.Join(os.TempDir(), "Amazon", "VPC-CNI-Plugins", "log")
@@ -0,0 +1,67 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// logTimeFormat is the format of message timestamps.
+	logTimeFormat = "2006-01-02T15:04:05Z07:00"
+)
+
+// fileReceiver is a seelog receiver that writes messages at or above a minimum level to a
+// rolling log file. It formats messages itself, so that no seelog format string is parsed
+// when a plugin starts.
+type fileReceiver struct {
+	minLevel log.LogLevel
+	file     *rollingFile
+}
+
+// newFileReceiver creates a new fileReceiver object.
+func newFileReceiver(minLevel log.LogLevel, file *rollingFile) *fileReceiver {
+	return &fileReceiver{
+		minLevel: minLevel,
+		file:     file,
+	}
+}
+
+// ReceiveMessage writes a message to the log file.
+func (r *fileReceiver) ReceiveMessage(message string, level log.LogLevel, context log.LogContextInterface) error {
+	if level < r.minLevel {
+		return nil
+	}
+
+	line := time.Now().UTC().Format(logTimeFormat) + " [" + strings.ToUpper(level.String()) + "] " + message + "\n"
+	_, err := r.file.Write([]byte(line))
+	return err
+}
+
+// AfterParse is not used, as the receiver is not created from a seelog config.
+func (r *fileReceiver) AfterParse(initArgs log.CustomReceiverInitArgs) error {
+	return nil
+}
+
+// Flush does nothing, as messages are written to the log file unbuffered.
+func (r *fileReceiver) Flush() {
+}
+
+// Close closes the log file.
+func (r *fileReceiver) Close() error {
+	return r.file.Close()
+}
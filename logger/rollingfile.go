@@ -0,0 +1,211 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// rolledFileFormat is the format of the names of compressed rolled log files.
+	rolledFileFormat = "%s.%d.gz"
+
+	// logFilePerm is the permission mode of log files.
+	logFilePerm = 0644
+
+	// logDirPerm is the permission mode of log directories.
+	logDirPerm = 0755
+)
+
+// rollingFile is a log file that is rolled when its size exceeds a maximum. Rolled files are
+// compressed with gzip and at most a maximum number of them are kept. Rolling is best-effort
+// across processes, since several plugin instances may write to the same log file concurrently.
+type rollingFile struct {
+	path         string
+	fallbackPath string
+	maxSize      int64
+	maxRolls     int
+	file         *os.File
+	size         int64
+	lock         sync.Mutex
+}
+
+// newRollingFile creates a new rollingFile object. The log file is opened on the first write.
+func newRollingFile(path string, maxSize int64, maxRolls int) *rollingFile {
+	return &rollingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxRolls: maxRolls,
+	}
+}
+
+// Write writes to the log file, rolling it first if it would exceed its maximum size.
+func (rf *rollingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	// Other processes may have appended to or rolled the log file since it was opened.
+	err := rf.refresh()
+	if err != nil {
+		return 0, err
+	}
+
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		err := rf.roll()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to roll log file %s: %v\n", rf.path, err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the log file.
+func (rf *rollingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	return rf.file.Close()
+}
+
+// refresh updates the log file size, opening the log file if it is not open yet or was rolled
+// by another process.
+func (rf *rollingFile) refresh() error {
+	if rf.file == nil {
+		return rf.open()
+	}
+
+	pathInfo, pathErr := os.Stat(rf.path)
+	fileInfo, fileErr := rf.file.Stat()
+
+	if pathErr == nil && fileErr == nil && os.SameFile(pathInfo, fileInfo) {
+		rf.size = fileInfo.Size()
+		return nil
+	}
+
+	rf.file.Close()
+	return rf.open()
+}
+
+// open opens the log file for appending, creating it if necessary. If the log file cannot be
+// created and there is a fallback path, the fallback log file is used from then on.
+func (rf *rollingFile) open() error {
+	file, err := openLogFile(rf.path)
+	if err != nil && rf.fallbackPath != "" && rf.fallbackPath != rf.path {
+		file, err = openLogFile(rf.fallbackPath)
+		if err == nil {
+			rf.path = rf.fallbackPath
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+
+	return nil
+}
+
+// openLogFile opens the log file at the given path for appending, creating it and its directory
+// if necessary.
+func openLogFile(path string) (*os.File, error) {
+	err := os.MkdirAll(filepath.Dir(path), logDirPerm)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, logFilePerm)
+}
+
+// roll compresses the current log file into the first rolled file, shifting older rolled files
+// and deleting the ones beyond the maximum count, and reopens a new empty log file.
+func (rf *rollingFile) roll() error {
+	rf.file.Close()
+
+	// Move the current log file out of the way first, so that new messages go to a new file.
+	tmpPath := fmt.Sprintf("%s.%d", rf.path, os.Getpid())
+	renameErr := os.Rename(rf.path, tmpPath)
+
+	err := rf.open()
+	if err != nil {
+		return err
+	}
+
+	if renameErr != nil {
+		// Another process has already rolled the file.
+		return nil
+	}
+	defer os.Remove(tmpPath)
+
+	if rf.maxRolls <= 0 {
+		return nil
+	}
+
+	// Shift the existing rolled files, dropping the oldest.
+	os.Remove(fmt.Sprintf(rolledFileFormat, rf.path, rf.maxRolls))
+	for i := rf.maxRolls - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf(rolledFileFormat, rf.path, i), fmt.Sprintf(rolledFileFormat, rf.path, i+1))
+	}
+
+	return compressFile(tmpPath, fmt.Sprintf(rolledFileFormat, rf.path, 1))
+}
+
+// compressFile writes a gzip compressed copy of the source file to the destination file.
+func compressFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFilePerm)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(srcPath)
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+
+	return err
+}
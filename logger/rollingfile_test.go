@@ -0,0 +1,152 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollingFileRollsAndCompresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "plugin.log")
+	rf := newRollingFile(path, 16, 2)
+	defer rf.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err = rf.Write([]byte(fmt.Sprintf("message %d\n", i)))
+		require.NoError(t, err)
+	}
+
+	// Each message fills the log file, so each write rolls the previous one.
+	current, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "message 3\n", string(current))
+
+	assert.Equal(t, "message 2\n", readGzipFile(t, fmt.Sprintf(rolledFileFormat, path, 1)))
+	assert.Equal(t, "message 1\n", readGzipFile(t, fmt.Sprintf(rolledFileFormat, path, 2)))
+
+	// Only the maximum number of rolled files is kept.
+	_, err = os.Stat(fmt.Sprintf(rolledFileFormat, path, 3))
+	assert.True(t, os.IsNotExist(err))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+}
+
+func TestRollingFileReopensFileRolledByAnotherProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "plugin.log")
+	rf := newRollingFile(path, 1024, 1)
+	defer rf.Close()
+
+	_, err = rf.Write([]byte("old message\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(path, path+".old"))
+
+	_, err = rf.Write([]byte("message\n"))
+	require.NoError(t, err)
+
+	current, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "message\n", string(current))
+}
+
+func TestRollingFileOpensOnFirstWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "plugin.log")
+	rf := newRollingFile(path, 1024, 1)
+	defer rf.Close()
+
+	_, err = os.Stat(filepath.Dir(path))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = rf.Write([]byte("message\n"))
+	require.NoError(t, err)
+
+	current, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "message\n", string(current))
+}
+
+func TestGetLogMaxSize(t *testing.T) {
+	assert.Equal(t, int64(defaultLogMaxSizeMB)<<20, getLogMaxSize())
+
+	os.Setenv(envLogMaxSize, "1")
+	defer os.Unsetenv(envLogMaxSize)
+	assert.Equal(t, int64(1)<<20, getLogMaxSize())
+
+	os.Setenv(envLogMaxSize, "-1")
+	assert.Equal(t, int64(defaultLogMaxSizeMB)<<20, getLogMaxSize())
+}
+
+func TestGetLogMaxRolls(t *testing.T) {
+	assert.Equal(t, defaultLogMaxRolls, getLogMaxRolls())
+
+	os.Setenv(envLogMaxRolls, "0")
+	defer os.Unsetenv(envLogMaxRolls)
+	assert.Equal(t, 0, getLogMaxRolls())
+}
+
+func readGzipFile(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestRollingFileFallsBackWhenLogDirIsNotWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A regular file in place of the log directory fails the log file creation even as root.
+	readOnlyDir := filepath.Join(dir, "readonly")
+	require.NoError(t, ioutil.WriteFile(readOnlyDir, nil, 0644))
+
+	rf := newRollingFile(filepath.Join(readOnlyDir, "plugin.log"), 1024, 2)
+	rf.fallbackPath = filepath.Join(dir, "fallback", "plugin.log")
+	defer rf.Close()
+
+	_, err = rf.Write([]byte("message\n"))
+	require.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(rf.fallbackPath)
+	require.NoError(t, err)
+	assert.Equal(t, "message\n", string(contents))
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package multicall links several plugins into a single busybox-style executable. The executable
+// runs the plugin it is invoked as, through a link named after the plugin, or the plugin named by
+// its first argument. All plugins on a host then share one version and one copy of the code.
+package multicall
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// InstallCommand is the subcommand creating links to the executable for all its plugins.
+	InstallCommand = "install"
+
+	// linkTempSuffix is the suffix of links created before they are renamed into place.
+	linkTempSuffix = ".tmp"
+)
+
+// Plugin is a plugin linked into a multi-call executable.
+type Plugin interface {
+	Initialize() error
+	Run() *cniTypes.Error
+}
+
+// NewPluginFunc creates a plugin.
+type NewPluginFunc func() (Plugin, error)
+
+// Executable is a multi-call executable.
+type Executable struct {
+	// Name is the name of the executable itself.
+	Name    string
+	plugins map[string]NewPluginFunc
+}
+
+// New creates a new multi-call executable with the given name.
+func New(name string) *Executable {
+	return &Executable{
+		Name:    name,
+		plugins: make(map[string]NewPluginFunc),
+	}
+}
+
+// Register links the plugin with the given name into the executable.
+func (e *Executable) Register(name string, newPlugin NewPluginFunc) {
+	e.plugins[name] = newPlugin
+}
+
+// Names returns the sorted names of the plugins linked into the executable.
+func (e *Executable) Names() []string {
+	var names []string
+	for name := range e.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Main runs the executable with the given command line arguments and returns its exit code.
+func (e *Executable) Main(args []string) int {
+	if len(args) == 0 {
+		e.printUsage()
+		return 1
+	}
+
+	// Invoked through a link named after a plugin.
+	name := commandName(args[0])
+	if _, ok := e.plugins[name]; ok {
+		return e.runPlugin(name, args)
+	}
+
+	// Invoked with the plugin name or a subcommand as the first argument.
+	if len(args) < 2 {
+		e.printUsage()
+		return 1
+	}
+	if args[1] == InstallCommand {
+		return e.runInstall(args[2:])
+	}
+	if _, ok := e.plugins[args[1]]; ok {
+		return e.runPlugin(args[1], args[1:])
+	}
+
+	e.printUsage()
+	return 1
+}
+
+// runPlugin runs the plugin with the given name and command line arguments.
+func (e *Executable) runPlugin(name string, args []string) int {
+	// Plugins parse their command line arguments from os.Args.
+	os.Args = args
+
+	plugin, err := e.plugins[name]()
+	if err != nil {
+		return 1
+	}
+
+	err = plugin.Initialize()
+	if err != nil {
+		return 1
+	}
+
+	cniErr := plugin.Run()
+	if cniErr != nil {
+		cniErr.Print()
+		return 1
+	}
+
+	return 0
+}
+
+// runInstall runs the install subcommand.
+func (e *Executable) runInstall(args []string) int {
+	flags := flag.NewFlagSet(e.Name+" "+InstallCommand, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	dir := flags.String("dir", "", "directory of the links, the directory of the executable if empty")
+	hardlink := flags.Bool("hardlink", defaultHardlink, "creates hard links instead of symbolic links")
+	err := flags.Parse(args)
+	if err == nil && flags.NArg() != 0 {
+		err = fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to parse arguments: %v\n", err))
+		return 1
+	}
+
+	path, err := os.Executable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to find executable: %v\n", err))
+		return 1
+	}
+
+	if *dir == "" {
+		*dir = filepath.Dir(path)
+	}
+
+	err = e.Install(path, *dir, *hardlink)
+	if err != nil {
+		os.Stderr.WriteString(fmt.Sprintf("Failed to install links: %v\n", err))
+		return 1
+	}
+
+	return 0
+}
+
+// Install creates a link to the executable at the given path for each plugin in the given
+// directory, replacing existing plugin executables. Links are renamed into place, so that
+// runtimes never find a plugin missing while they are installed.
+func (e *Executable) Install(path string, dir string, hardlink bool) error {
+	for _, name := range e.Names() {
+		linkPath := filepath.Join(dir, name+executableSuffix)
+		if linkPath == path {
+			continue
+		}
+
+		tmpPath := linkPath + linkTempSuffix
+		os.Remove(tmpPath)
+
+		var err error
+		if hardlink {
+			err = os.Link(path, tmpPath)
+		} else {
+			err = os.Symlink(path, tmpPath)
+		}
+		if err != nil {
+			return fmt.Errorf("multicall: failed to create link %s: %v", tmpPath, err)
+		}
+
+		err = os.Rename(tmpPath, linkPath)
+		if err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("multicall: failed to rename link to %s: %v", linkPath, err)
+		}
+
+		// Renaming a hard link over another link to the same file does nothing.
+		os.Remove(tmpPath)
+	}
+
+	return nil
+}
+
+// printUsage prints the usage of the executable.
+func (e *Executable) printUsage() {
+	os.Stderr.WriteString(fmt.Sprintf(
+		"Usage: %s <plugin> [arguments]\n       %s %s [-dir <dir>] [-hardlink]\nPlugins: %s\n",
+		e.Name, e.Name, InstallCommand, strings.Join(e.Names(), ", ")))
+}
+
+// commandName returns the name that an executable is invoked as.
+func commandName(arg0 string) string {
+	return strings.TrimSuffix(filepath.Base(arg0), executableSuffix)
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package multicall
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPlugin is a plugin recording the command line arguments it runs with.
+type testPlugin struct {
+	args   []string
+	cniErr *cniTypes.Error
+}
+
+func (p *testPlugin) Initialize() error {
+	return nil
+}
+
+func (p *testPlugin) Run() *cniTypes.Error {
+	p.args = os.Args
+	return p.cniErr
+}
+
+func newTestExecutable(plugins map[string]*testPlugin) *Executable {
+	e := New("vpc-cni-plugins")
+	for name, plugin := range plugins {
+		plugin := plugin
+		e.Register(name, func() (Plugin, error) { return plugin, nil })
+	}
+	return e
+}
+
+func TestMainDispatch(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectPlugin string
+		expectArgs   []string
+		expectCode   int
+	}{
+		{"link", []string{"/opt/cni/bin/vpc-bridge"}, "vpc-bridge", []string{"/opt/cni/bin/vpc-bridge"}, 0},
+		{"link with arguments", []string{"vpc-bridge", "-version"}, "vpc-bridge", []string{"vpc-bridge", "-version"}, 0},
+		{"subcommand", []string{"/opt/cni/bin/vpc-cni-plugins", "vpc-ipam", "-version"}, "vpc-ipam", []string{"vpc-ipam", "-version"}, 0},
+		{"renamed executable", []string{"./multicall", "vpc-ipam"}, "vpc-ipam", []string{"vpc-ipam"}, 0},
+		{"failing plugin", []string{"vpc-fail"}, "vpc-fail", []string{"vpc-fail"}, 1},
+		{"unknown plugin", []string{"vpc-cni-plugins", "vpc-unknown"}, "", nil, 1},
+		{"no plugin", []string{"vpc-cni-plugins"}, "", nil, 1},
+		{"no arguments", []string{}, "", nil, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugins := map[string]*testPlugin{
+				"vpc-bridge": {},
+				"vpc-ipam":   {},
+				"vpc-fail":   {cniErr: &cniTypes.Error{Code: 100, Msg: "failed"}},
+			}
+			e := newTestExecutable(plugins)
+
+			assert.Equal(t, test.expectCode, e.Main(test.args))
+			for name, plugin := range plugins {
+				if name == test.expectPlugin {
+					assert.Equal(t, test.expectArgs, plugin.args)
+				} else {
+					assert.Nil(t, plugin.args, "plugin %s ran", name)
+				}
+			}
+		})
+	}
+}
+
+func TestMainPluginError(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	e := New("vpc-cni-plugins")
+	e.Register("vpc-bridge", func() (Plugin, error) { return nil, errors.New("failed") })
+
+	assert.Equal(t, 1, e.Main([]string{"vpc-bridge"}))
+}
+
+func TestNames(t *testing.T) {
+	e := newTestExecutable(map[string]*testPlugin{"vpc-ipam": {}, "vpc-bridge": {}, "aws-appmesh": {}})
+
+	assert.Equal(t, []string{"aws-appmesh", "vpc-bridge", "vpc-ipam"}, e.Names())
+}
+
+func TestInstall(t *testing.T) {
+	for _, hardlink := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "multicall")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "vpc-cni-plugins"+executableSuffix)
+		require.NoError(t, ioutil.WriteFile(path, []byte("executable"), 0755))
+
+		// An existing plugin executable is replaced.
+		bridgePath := filepath.Join(dir, "vpc-bridge"+executableSuffix)
+		require.NoError(t, ioutil.WriteFile(bridgePath, []byte("old"), 0755))
+
+		e := newTestExecutable(map[string]*testPlugin{"vpc-bridge": {}, "vpc-ipam": {}})
+		require.NoError(t, e.Install(path, dir, hardlink))
+		// Installing again replaces the links.
+		require.NoError(t, e.Install(path, dir, hardlink))
+
+		executable, err := os.Stat(path)
+		require.NoError(t, err)
+		for _, name := range e.Names() {
+			linkPath := filepath.Join(dir, name+executableSuffix)
+			info, err := os.Stat(linkPath)
+			require.NoError(t, err)
+			assert.True(t, os.SameFile(executable, info), "%s is not linked", name)
+
+			linkInfo, err := os.Lstat(linkPath)
+			require.NoError(t, err)
+			assert.Equal(t, !hardlink, linkInfo.Mode()&os.ModeSymlink != 0)
+
+			_, err = os.Lstat(linkPath + linkTempSuffix)
+			assert.True(t, os.IsNotExist(err))
+		}
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	assert.Equal(t, "vpc-bridge", commandName("/opt/cni/bin/vpc-bridge"+executableSuffix))
+	assert.Equal(t, "vpc-bridge", commandName("vpc-bridge"))
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package command runs external tools and captures their output, so that failures can be
+// diagnosed from the error and the logs instead of a bare exit status.
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+
+	log "github.com/cihub/seelog"
+)
+
+// Error is returned when an external command fails.
+type Error struct {
+	Args   []string
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// Error returns the string representation of a command error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("command [%s] failed: %v: stdout: %q stderr: %q",
+		strings.Join(e.Args, " "), e.Err, e.Stdout, e.Stderr)
+}
+
+// transientStderr are the messages of commands that fail because of contention with other
+// processes, and succeed when retried.
+var transientStderr = []string{
+	"Another app is currently holding the xtables lock",
+	"Resource temporarily unavailable",
+}
+
+// Run runs an external command and returns its standard output.
+func Run(name string, args ...string) (string, error) {
+	return RunWithInput(nil, name, args...)
+}
+
+// RunWithInput runs an external command with the given standard input and returns its
+// standard output. Commands that fail transiently are retried with the default backoff policy.
+func RunWithInput(stdin io.Reader, name string, args ...string) (string, error) {
+	return RunWithOutput(stdin, nil, name, args...)
+}
+
+// RunWithOutput is like RunWithInput, and also streams the standard output of the command to
+// the given writer, if any, as it is written. The output of failed attempts is streamed as well.
+func RunWithOutput(stdin io.Reader, w io.Writer, name string, args ...string) (string, error) {
+	// Buffer the input so that it can be replayed on retries.
+	var input []byte
+	if stdin != nil {
+		var err error
+		input, err = ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("command: failed to read input: %v", err)
+		}
+	}
+
+	var stdout string
+	err := backoff.Default().Retry(fmt.Sprintf("command %s", name), func() error {
+		var err error
+		stdout, err = runOnce(input, stdin != nil, w, name, args...)
+		return err
+	}, isTransient)
+
+	return stdout, err
+}
+
+// runOnce runs an external command once.
+func runOnce(input []byte, hasInput bool, w io.Writer, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	// Run in the C locale, so that output consumed by the plugins does not vary with the
+	// locale of the host.
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	if hasInput {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	cmd.Stdout = &stdout
+	if w != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, w)
+	}
+	cmd.Stderr = &stderr
+
+	log.Debugf("Running command %v.", cmd.Args)
+	err := cmd.Run()
+	if err != nil {
+		cmdErr := &Error{
+			Args:   cmd.Args,
+			Stdout: stdout.String(),
+			Stderr: stderr.String(),
+			Err:    err,
+		}
+		log.Errorf("Failed to run command: %v.", cmdErr)
+		return cmdErr.Stdout, cmdErr
+	}
+
+	if stderr.Len() != 0 {
+		log.Infof("Command %v wrote to stderr: %q.", cmd.Args, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// isTransient returns whether a command failed transiently, either because the process could
+// not be started for lack of resources, or because it reported contention with another process.
+func isTransient(err error) bool {
+	cmdErr, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+
+	if pathErr, ok := cmdErr.Err.(*os.PathError); ok {
+		if errno, ok := pathErr.Err.(syscall.Errno); ok {
+			return errno.Temporary()
+		}
+	}
+
+	for _, msg := range transientStderr {
+		if strings.Contains(cmdErr.Stderr, msg) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReturnsStdout(t *testing.T) {
+	out, err := Run("sh", "-c", "echo hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", out)
+}
+
+func TestRunWithInputPassesStdin(t *testing.T) {
+	out, err := RunWithInput(strings.NewReader("rules"), "cat")
+	assert.NoError(t, err)
+	assert.Equal(t, "rules", out)
+}
+
+func TestRunWithOutputStreamsStdout(t *testing.T) {
+	// The first line reaches the writer while the command is still running.
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := RunWithOutput(nil, w, "sh", "-c", "echo first; sleep 1; echo second")
+		w.Close()
+		done <- err
+	}()
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", line)
+	select {
+	case <-done:
+		t.Fatal("output was not streamed before the command exited")
+	default:
+	}
+
+	go ioutil.ReadAll(r)
+	assert.NoError(t, <-done)
+}
+
+func TestRunUsesCLocale(t *testing.T) {
+	out, err := Run("sh", "-c", "echo $LC_ALL")
+	assert.NoError(t, err)
+	assert.Equal(t, "C\n", out)
+}
+
+func TestRunFailureCapturesContext(t *testing.T) {
+	_, err := Run("sh", "-c", "echo out; echo bad rule >&2; exit 3")
+	assert.Error(t, err)
+
+	cmdErr, ok := err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"sh", "-c", "echo out; echo bad rule >&2; exit 3"}, cmdErr.Args)
+	assert.Equal(t, "out\n", cmdErr.Stdout)
+	assert.Equal(t, "bad rule\n", cmdErr.Stderr)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "bad rule")
+}
+
+func TestRunRetriesTransientFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "command")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Fail with a lock contention error on the first attempt only.
+	script := fmt.Sprintf(`if [ ! -e %[1]s/ran ]; then touch %[1]s/ran; `+
+		`echo "Another app is currently holding the xtables lock" >&2; exit 4; fi; cat`, dir)
+	out, err := RunWithInput(strings.NewReader("rules"), "sh", "-c", script)
+	assert.NoError(t, err)
+	assert.Equal(t, "rules", out)
+}
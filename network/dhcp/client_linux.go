@@ -0,0 +1,72 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dhcp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// dhclientPath is the path to the ISC DHCP client.
+	dhclientPath = "dhclient"
+)
+
+// Acquire obtains a lease for the given interface in the current network namespace. The DHCP
+// client does not configure the interface and exits once the lease is obtained, so the lease
+// is not renewed. Leases from the VPC DHCP service are stable for the lifetime of the interface.
+func Acquire(ifName string) (*Lease, error) {
+	dir, err := ioutil.TempDir("", "dhcp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	leaseFile := filepath.Join(dir, "dhclient.leases")
+	pidFile := filepath.Join(dir, "dhclient.pid")
+
+	// Request a lease once, without running the client configuration script.
+	log.Infof("Requesting DHCP lease on interface %s.", ifName)
+	_, err = command.Run(dhclientPath,
+		"-4", "-1", "-sf", "/bin/true", "-lf", leaseFile, "-pf", pidFile, ifName)
+	if err != nil {
+		return nil, fmt.Errorf("dhcp: failed to obtain lease on %s: %v", ifName, err)
+	}
+
+	// Stop the client, which stays in the background after obtaining the lease, without
+	// releasing the lease.
+	_, err = command.Run(dhclientPath, "-x", "-pf", pidFile)
+	if err != nil {
+		log.Errorf("Failed to stop DHCP client on interface %s: %v.", ifName, err)
+	}
+
+	leases, err := ioutil.ReadFile(leaseFile)
+	if err != nil {
+		return nil, fmt.Errorf("dhcp: failed to read lease file: %v", err)
+	}
+
+	lease, err := ParseLeases(string(leases))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Obtained DHCP lease %+v on interface %s.", lease, ifName)
+	return lease, nil
+}
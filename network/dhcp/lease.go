@@ -0,0 +1,90 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package dhcp obtains IP address leases from the VPC DHCP service.
+package dhcp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Lease is an IPv4 address lease obtained from a DHCP server.
+type Lease struct {
+	Address    *net.IPNet
+	Router     net.IP
+	DNSServers []string
+	DomainName string
+}
+
+// ParseLeases parses the contents of a dhclient lease file and returns the most recent lease.
+func ParseLeases(leases string) (*Lease, error) {
+	var lease, current *Lease
+	var mask net.IPMask
+
+	scanner := bufio.NewScanner(strings.NewReader(leases))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSuffix(line, ";")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case line == "lease {":
+			current = &Lease{}
+			mask = nil
+		case line == "}":
+			if current != nil && current.Address != nil {
+				if mask != nil {
+					current.Address.Mask = mask
+				}
+				lease = current
+			}
+			current = nil
+		case current == nil:
+			continue
+		case fields[0] == "fixed-address" && len(fields) == 2:
+			ip := net.ParseIP(fields[1]).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("dhcp: invalid fixed-address %s", fields[1])
+			}
+			current.Address = &net.IPNet{IP: ip, Mask: ip.DefaultMask()}
+		case fields[0] != "option" || len(fields) < 3:
+			continue
+		case fields[1] == "subnet-mask":
+			ip := net.ParseIP(fields[2]).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("dhcp: invalid subnet-mask %s", fields[2])
+			}
+			mask = net.IPMask(ip)
+		case fields[1] == "routers":
+			// Use the first router if there are several.
+			current.Router = net.ParseIP(strings.Split(fields[2], ",")[0])
+		case fields[1] == "domain-name-servers":
+			servers := strings.Split(strings.Join(fields[2:], ""), ",")
+			current.DNSServers = append(current.DNSServers, servers...)
+		case fields[1] == "domain-name":
+			current.DomainName = strings.Trim(strings.Join(fields[2:], " "), `"`)
+		}
+	}
+
+	if lease == nil {
+		return nil, fmt.Errorf("dhcp: no lease found")
+	}
+
+	return lease, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dhcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLeases = `lease {
+  interface "eth0";
+  fixed-address 10.0.1.5;
+  option subnet-mask 255.255.255.0;
+  option routers 10.0.1.1;
+  option domain-name-servers 10.0.0.2;
+  renew 2 2019/06/04 20:09:26;
+}
+lease {
+  interface "eth0";
+  fixed-address 10.0.1.6;
+  option subnet-mask 255.255.240.0;
+  option routers 10.0.0.1,10.0.0.2;
+  option domain-name-servers 10.0.0.2, 10.0.0.3;
+  option domain-name "ec2.internal";
+}
+`
+
+func TestParseLeases(t *testing.T) {
+	lease, err := ParseLeases(testLeases)
+	require.NoError(t, err)
+
+	// The most recent lease wins.
+	assert.Equal(t, "10.0.1.6/20", lease.Address.String())
+	assert.Equal(t, "10.0.0.1", lease.Router.String())
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, lease.DNSServers)
+	assert.Equal(t, "ec2.internal", lease.DomainName)
+}
+
+func TestParseLeasesWithoutLease(t *testing.T) {
+	_, err := ParseLeases("")
+	assert.Error(t, err)
+
+	_, err = ParseLeases("lease {\n  interface \"eth0\";\n}\n")
+	assert.Error(t, err)
+}
+
+func TestParseLeasesInvalidAddress(t *testing.T) {
+	_, err := ParseLeases("lease {\n  fixed-address 10.0.1;\n}\n")
+	assert.Error(t, err)
+}
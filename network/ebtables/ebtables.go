@@ -19,7 +19,9 @@ package ebtables
 import (
 	"fmt"
 	"net"
-	"os/exec"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
 
 	log "github.com/cihub/seelog"
 )
@@ -61,6 +63,19 @@ type IPv4Match struct {
 	Dst net.IP
 }
 
+// IPv6Match is an ebtables IPv6 match extension.
+type IPv6Match struct {
+	Src *net.IPNet
+	Dst *net.IPNet
+}
+
+// MarkMatch is an ebtables mark match extension. It matches packets whose mark, masked by the
+// mask, equals the value. A zero mask matches the whole mark.
+type MarkMatch struct {
+	Value uint32
+	Mask  uint32
+}
+
 // DNATTarget is an ebtables DNAT target extension.
 type DNATTarget struct {
 	ToDst  net.HardwareAddr
@@ -74,6 +89,12 @@ type SNATTarget struct {
 	Target StdTarget
 }
 
+// MarkTarget is an ebtables mark target extension. It sets the given bits in the packet mark.
+type MarkTarget struct {
+	Or     uint32
+	Target StdTarget
+}
+
 // StdTarget is an ebtables standard target.
 type StdTarget string
 
@@ -151,10 +172,28 @@ func (match *ARPMatch) String() string {
 	var s string
 
 	if match.Op != "" {
-		s += "--arp-op " + match.Op
+		s += " --arp-op " + match.Op
+	}
+	if match.HType != "" {
+		s += " --arp-htype " + match.HType
+	}
+	if match.PType != "" {
+		s += " --arp-ptype " + match.PType
+	}
+	if match.IPSrc != nil {
+		s += " --arp-ip-src " + match.IPSrc.String()
+	}
+	if match.IPDst != nil {
+		s += " --arp-ip-dst " + match.IPDst.String()
+	}
+	if match.MACSrc != nil {
+		s += " --arp-mac-src " + match.MACSrc.String()
+	}
+	if match.MACDst != nil {
+		s += " --arp-mac-dst " + match.MACDst.String()
 	}
 
-	return s
+	return s[1:]
 }
 
 // String returns the string representation of an ebtables IPv4 match extension.
@@ -171,6 +210,28 @@ func (match *IPv4Match) String() string {
 	return s[1:]
 }
 
+// String returns the string representation of an ebtables IPv6 match extension.
+func (match *IPv6Match) String() string {
+	var s string
+
+	if match.Src != nil {
+		s += " --ip6-src " + match.Src.String()
+	}
+	if match.Dst != nil {
+		s += " --ip6-dst " + match.Dst.String()
+	}
+
+	return s[1:]
+}
+
+// String returns the string representation of an ebtables mark match extension.
+func (match *MarkMatch) String() string {
+	if match.Mask == 0 {
+		return fmt.Sprintf("--mark 0x%x", match.Value)
+	}
+	return fmt.Sprintf("--mark 0x%x/0x%x", match.Value, match.Mask)
+}
+
 // String returns the string representation of an ebtables DNAT target extension.
 func (dnat *DNATTarget) String() string {
 	s := "-j dnat"
@@ -202,6 +263,17 @@ func (snat *SNATTarget) String() string {
 	return s
 }
 
+// String returns the string representation of an ebtables mark target extension.
+func (mark *MarkTarget) String() string {
+	s := fmt.Sprintf("-j mark --mark-or 0x%x", mark.Or)
+
+	if mark.Target != "" {
+		s += " --mark-target " + string(mark.Target)
+	}
+
+	return s
+}
+
 // Append appends a rule to the table.
 func (table *Table) Append(chain Chain, rule *Rule) error {
 	return execute(table.append(chain, rule))
@@ -222,19 +294,38 @@ func (table *Table) delete(chain Chain, rule *Rule) string {
 	return table.generateCmd("-D", chain, rule)
 }
 
+// NewChain creates a new user-defined chain in the table.
+func (table *Table) NewChain(chain Chain) error {
+	return execute(table.generateChainCmd("-N", chain))
+}
+
+// DeleteChain flushes and deletes a user-defined chain from the table. The chain must not be
+// the target of any rule.
+func (table *Table) DeleteChain(chain Chain) error {
+	err := execute(table.generateChainCmd("-F", chain))
+	if err != nil {
+		return err
+	}
+
+	return execute(table.generateChainCmd("-X", chain))
+}
+
+// generateChainCmd generates the ebtables command string for a chain command.
+func (table *Table) generateChainCmd(command string, chain Chain) string {
+	return ebtablesExe + " -t " + table.name + " " + command + " " + chain.String()
+}
+
 // generateCmd generates the ebtables command string.
 func (table *Table) generateCmd(command string, chain Chain, rule *Rule) string {
 	return ebtablesExe + " -t " + table.name + " " + command + " " + chain.String() + " " + rule.String()
 }
 
-// execute executes an ebtables command.
-func execute(command string) error {
-	log.Infof("Executing ebtables command %s.", command)
+// execute executes an ebtables command. The command line is split into arguments and executed
+// directly, without a shell, so that values in rules cannot inject additional commands.
+func execute(cmdLine string) error {
+	log.Infof("Executing ebtables command %s.", cmdLine)
 
-	cmd := exec.Command("sh", "-c", command)
-	err := cmd.Start()
-	if err == nil {
-		err = cmd.Wait()
-	}
+	args := strings.Fields(cmdLine)
+	_, err := command.Run(args[0], args[1:]...)
 	return err
 }
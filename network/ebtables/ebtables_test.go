@@ -58,6 +58,49 @@ func TestRuleWithARPMatch(t *testing.T) {
 	)
 }
 
+// TestRuleWithARPAddressMatch tests that rules matching ARP addresses are generated correctly.
+func TestRuleWithARPAddressMatch(t *testing.T) {
+	assert.Equal(t,
+		"ebtables -t filter -A vpc-as-1 -p ARP -s 12:34:56:78:9a:bc --arp-ip-src 10.1.1.42 --arp-mac-src 12:34:56:78:9a:bc -j RETURN",
+		Filter.append(
+			Chain("vpc-as-1"),
+			&Rule{
+				Protocol: "ARP",
+				Src:      randomMACAddr,
+				Match: &ARPMatch{
+					IPSrc:  net.ParseIP("10.1.1.42"),
+					MACSrc: randomMACAddr,
+				},
+				Target: Return,
+			},
+		),
+	)
+}
+
+// TestRuleWithIPv6Match tests that rules with an IPv6 match extension are generated correctly.
+func TestRuleWithIPv6Match(t *testing.T) {
+	_, linkLocal, _ := net.ParseCIDR("fe80::/10")
+
+	assert.Equal(t,
+		"ebtables -t filter -A FORWARD -p IPv6 -i veth1 --ip6-src fe80::/10 -j RETURN",
+		Filter.append(
+			Forward,
+			&Rule{
+				Protocol: "IPv6",
+				In:       "veth1",
+				Match:    &IPv6Match{Src: linkLocal},
+				Target:   Return,
+			},
+		),
+	)
+}
+
+// TestChainCommands tests that user-defined chain commands are generated correctly.
+func TestChainCommands(t *testing.T) {
+	assert.Equal(t, "ebtables -t filter -N vpc-as-1", Filter.generateChainCmd("-N", Chain("vpc-as-1")))
+	assert.Equal(t, "ebtables -t filter -X vpc-as-1", Filter.generateChainCmd("-X", Chain("vpc-as-1")))
+}
+
 // TestRuleWithDNATTarget tests that rules with a DNAT target extension are generated correctly.
 func TestRuleWithDNATTarget(t *testing.T) {
 	assert.Equal(t,
@@ -97,3 +140,29 @@ func TestRuleWithSNATTarget(t *testing.T) {
 		),
 	)
 }
+
+// TestRuleWithMark tests that rules with mark match and target extensions are generated correctly.
+func TestRuleWithMark(t *testing.T) {
+	assert.Equal(t,
+		"ebtables -t nat -A PREROUTING -i veth1 -j mark --mark-or 0x100000 --mark-target CONTINUE",
+		NAT.append(
+			PreRouting,
+			&Rule{
+				In:     "veth1",
+				Target: &MarkTarget{Or: 0x100000, Target: Continue},
+			},
+		),
+	)
+
+	assert.Equal(t,
+		"ebtables -t filter -A OUTPUT -o veth1 --mark 0x200000/0x200000 -j DROP",
+		Filter.append(
+			Output,
+			&Rule{
+				Out:    "veth1",
+				Match:  &MarkMatch{Value: 0x200000, Mask: 0x200000},
+				Target: Drop,
+			},
+		),
+	)
+}
@@ -0,0 +1,311 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// apiVersion is the EC2 Query API version.
+	apiVersion = "2016-11-15"
+	// serviceName is the EC2 service name used in request signatures.
+	serviceName = "ec2"
+	// endpointFormat is the format of regional EC2 endpoints.
+	endpointFormat = "https://ec2.%s.amazonaws.com/"
+	// requestTimeout is the timeout for EC2 API requests.
+	requestTimeout = 30 * time.Second
+)
+
+// Client is a minimal EC2 Query API client for the calls needed to manage ENI addresses.
+type Client struct {
+	Region      string
+	Endpoint    string
+	Credentials func() (*Credentials, error)
+	HTTP        *http.Client
+}
+
+// Error is an error returned by the EC2 API.
+type Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// errorResponse is the EC2 API error response format.
+type errorResponse struct {
+	Errors    []Error `xml:"Errors>Error"`
+	RequestID string  `xml:"RequestID"`
+}
+
+// assignPrivateIPAddressesResponse is the AssignPrivateIpAddresses response format.
+type assignPrivateIPAddressesResponse struct {
+	NetworkInterfaceID string   `xml:"networkInterfaceId"`
+	Addresses          []string `xml:"assignedPrivateIpAddressesSet>item>privateIpAddress"`
+	IPv4Prefixes       []string `xml:"assignedIpv4PrefixSet>item>ipv4Prefix"`
+}
+
+// assignIPv6AddressesResponse is the AssignIpv6Addresses response format.
+type assignIPv6AddressesResponse struct {
+	NetworkInterfaceID string   `xml:"networkInterfaceId"`
+	IPv6Prefixes       []string `xml:"assignedIpv6PrefixSet>item"`
+}
+
+// TrunkInterfaceAssociation is an association of a branch ENI with a trunk ENI.
+type TrunkInterfaceAssociation struct {
+	AssociationID     string `xml:"associationId"`
+	BranchInterfaceID string `xml:"branchInterfaceId"`
+	TrunkInterfaceID  string `xml:"trunkInterfaceId"`
+	InterfaceProtocol string `xml:"interfaceProtocol"`
+	VlanID            int    `xml:"vlanId"`
+}
+
+// describeTrunkInterfaceAssociationsResponse is the DescribeTrunkInterfaceAssociations
+// response format.
+type describeTrunkInterfaceAssociationsResponse struct {
+	Associations []TrunkInterfaceAssociation `xml:"interfaceAssociationSet>item"`
+}
+
+// describeNetworkInterfacesResponse is the DescribeNetworkInterfaces response format.
+type describeNetworkInterfacesResponse struct {
+	NetworkInterfaces []struct {
+		NetworkInterfaceID string   `xml:"networkInterfaceId"`
+		GroupIDs           []string `xml:"groupSet>item>groupId"`
+	} `xml:"networkInterfaceSet>item"`
+}
+
+// NewClient creates a new EC2 client for the given region.
+func NewClient(region string, credentials func() (*Credentials, error)) *Client {
+	return &Client{
+		Region:      region,
+		Endpoint:    fmt.Sprintf(endpointFormat, region),
+		Credentials: credentials,
+		HTTP:        &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Error returns the string representation of an EC2 API error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("ec2: %s: %s", e.Code, e.Message)
+}
+
+// AssignPrivateIPAddresses assigns the given number of new secondary private IP addresses
+// to an ENI and returns them.
+func (c *Client) AssignPrivateIPAddresses(eniID string, count int) ([]net.IP, error) {
+	params := url.Values{
+		"NetworkInterfaceId":             {eniID},
+		"SecondaryPrivateIpAddressCount": {strconv.Itoa(count)},
+	}
+
+	var resp assignPrivateIPAddressesResponse
+	err := c.call("AssignPrivateIpAddresses", params, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, address := range resp.Addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("ec2: invalid assigned address %s", address)
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// UnassignPrivateIPAddresses unassigns the given secondary private IP addresses from an ENI.
+func (c *Client) UnassignPrivateIPAddresses(eniID string, ips []net.IP) error {
+	params := url.Values{
+		"NetworkInterfaceId": {eniID},
+	}
+	for i, ip := range ips {
+		params.Set(fmt.Sprintf("PrivateIpAddress.%d", i+1), ip.String())
+	}
+
+	return c.call("UnassignPrivateIpAddresses", params, nil)
+}
+
+// AssignIPv4Prefixes delegates the given number of new /28 IPv4 prefixes to an ENI and
+// returns them.
+func (c *Client) AssignIPv4Prefixes(eniID string, count int) ([]*net.IPNet, error) {
+	params := url.Values{
+		"NetworkInterfaceId": {eniID},
+		"Ipv4PrefixCount":    {strconv.Itoa(count)},
+	}
+
+	var resp assignPrivateIPAddressesResponse
+	err := c.call("AssignPrivateIpAddresses", params, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrefixes(resp.IPv4Prefixes)
+}
+
+// UnassignIPv4Prefixes releases the given IPv4 prefixes delegated to an ENI.
+func (c *Client) UnassignIPv4Prefixes(eniID string, prefixes []*net.IPNet) error {
+	params := url.Values{
+		"NetworkInterfaceId": {eniID},
+	}
+	for i, prefix := range prefixes {
+		params.Set(fmt.Sprintf("Ipv4Prefix.%d", i+1), prefix.String())
+	}
+
+	return c.call("UnassignPrivateIpAddresses", params, nil)
+}
+
+// AssignIPv6Prefixes delegates the given number of new /80 IPv6 prefixes to an ENI and
+// returns them.
+func (c *Client) AssignIPv6Prefixes(eniID string, count int) ([]*net.IPNet, error) {
+	params := url.Values{
+		"NetworkInterfaceId": {eniID},
+		"Ipv6PrefixCount":    {strconv.Itoa(count)},
+	}
+
+	var resp assignIPv6AddressesResponse
+	err := c.call("AssignIpv6Addresses", params, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrefixes(resp.IPv6Prefixes)
+}
+
+// UnassignIPv6Prefixes releases the given IPv6 prefixes delegated to an ENI.
+func (c *Client) UnassignIPv6Prefixes(eniID string, prefixes []*net.IPNet) error {
+	params := url.Values{
+		"NetworkInterfaceId": {eniID},
+	}
+	for i, prefix := range prefixes {
+		params.Set(fmt.Sprintf("Ipv6Prefix.%d", i+1), prefix.String())
+	}
+
+	return c.call("UnassignIpv6Addresses", params, nil)
+}
+
+// DescribeTrunkInterfaceAssociation returns the trunk interface association with the given ID.
+func (c *Client) DescribeTrunkInterfaceAssociation(associationID string) (*TrunkInterfaceAssociation, error) {
+	params := url.Values{
+		"AssociationId.1": {associationID},
+	}
+
+	var resp describeTrunkInterfaceAssociationsResponse
+	err := c.call("DescribeTrunkInterfaceAssociations", params, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Associations) == 0 {
+		return nil, &Error{
+			Code:    "InvalidAssociationID.NotFound",
+			Message: fmt.Sprintf("association %s does not exist", associationID),
+		}
+	}
+
+	return &resp.Associations[0], nil
+}
+
+// DescribeSecurityGroups returns the IDs of the security groups of an ENI.
+func (c *Client) DescribeSecurityGroups(eniID string) ([]string, error) {
+	params := url.Values{
+		"NetworkInterfaceId.1": {eniID},
+	}
+
+	var resp describeNetworkInterfacesResponse
+	err := c.call("DescribeNetworkInterfaces", params, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.NetworkInterfaces) == 0 {
+		return nil, &Error{
+			Code:    "InvalidNetworkInterfaceID.NotFound",
+			Message: fmt.Sprintf("network interface %s does not exist", eniID),
+		}
+	}
+
+	return resp.NetworkInterfaces[0].GroupIDs, nil
+}
+
+// parsePrefixes parses a list of prefixes returned by the EC2 API.
+func parsePrefixes(prefixStrings []string) ([]*net.IPNet, error) {
+	var prefixes []*net.IPNet
+	for _, prefixString := range prefixStrings {
+		_, prefix, err := net.ParseCIDR(prefixString)
+		if err != nil {
+			return nil, fmt.Errorf("ec2: invalid assigned prefix %s", prefixString)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
+
+// call sends a signed EC2 API request and decodes the XML response into out.
+func (c *Client) call(action string, params url.Values, out interface{}) error {
+	creds, err := c.Credentials()
+	if err != nil {
+		return fmt.Errorf("ec2: failed to get credentials: %v", err)
+	}
+
+	params.Set("Action", action)
+	params.Set("Version", apiVersion)
+	body := []byte(params.Encode())
+
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signRequest(req, body, creds, c.Region, serviceName, time.Now())
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("ec2: %s request failed: %v", action, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ec2: failed to read %s response: %v", action, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		if xml.Unmarshal(data, &errResp) == nil && len(errResp.Errors) > 0 {
+			return &errResp.Errors[0]
+		}
+		return fmt.Errorf("ec2: %s failed with status %s", action, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = xml.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("ec2: failed to parse %s response: %v", action, err)
+	}
+
+	return nil
+}
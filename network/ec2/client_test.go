@@ -0,0 +1,193 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCredentials = &Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+// TestSignRequest tests signing against the example in the AWS Signature Version 4 documentation.
+func TestSignRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet,
+		"https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signRequest(req, nil, testCredentials, "us-east-1", "iam", now)
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
+
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	client := NewClient("us-west-2", func() (*Credentials, error) { return testCredentials, nil })
+	client.Endpoint = server.URL + "/"
+	return client, server.Close
+}
+
+func TestAssignPrivateIPAddresses(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "Action=AssignPrivateIpAddresses")
+		assert.Contains(t, string(body), "SecondaryPrivateIpAddressCount=2")
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), signingAlgorithm))
+
+		fmt.Fprint(w, `<AssignPrivateIpAddressesResponse>
+			<networkInterfaceId>eni-1</networkInterfaceId>
+			<assignedPrivateIpAddressesSet>
+				<item><privateIpAddress>10.0.1.20</privateIpAddress></item>
+				<item><privateIpAddress>10.0.1.21</privateIpAddress></item>
+			</assignedPrivateIpAddressesSet>
+		</AssignPrivateIpAddressesResponse>`)
+	})
+	defer cleanup()
+
+	ips, err := client.AssignPrivateIPAddresses("eni-1", 2)
+	require.NoError(t, err)
+	require.Len(t, ips, 2)
+	assert.Equal(t, "10.0.1.20", ips[0].String())
+	assert.Equal(t, "10.0.1.21", ips[1].String())
+}
+
+func TestAssignIPv4Prefixes(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "Ipv4PrefixCount=1")
+
+		fmt.Fprint(w, `<AssignPrivateIpAddressesResponse>
+			<networkInterfaceId>eni-1</networkInterfaceId>
+			<assignedIpv4PrefixSet>
+				<item><ipv4Prefix>10.0.1.32/28</ipv4Prefix></item>
+			</assignedIpv4PrefixSet>
+		</AssignPrivateIpAddressesResponse>`)
+	})
+	defer cleanup()
+
+	prefixes, err := client.AssignIPv4Prefixes("eni-1", 1)
+	require.NoError(t, err)
+	require.Len(t, prefixes, 1)
+	assert.Equal(t, "10.0.1.32/28", prefixes[0].String())
+}
+
+func TestAssignIPv6Prefixes(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "Action=AssignIpv6Addresses")
+
+		fmt.Fprint(w, `<AssignIpv6AddressesResponse>
+			<networkInterfaceId>eni-1</networkInterfaceId>
+			<assignedIpv6PrefixSet><item>2600:1f14:0:1:a::/80</item></assignedIpv6PrefixSet>
+		</AssignIpv6AddressesResponse>`)
+	})
+	defer cleanup()
+
+	prefixes, err := client.AssignIPv6Prefixes("eni-1", 1)
+	require.NoError(t, err)
+	require.Len(t, prefixes, 1)
+	assert.Equal(t, "2600:1f14:0:1:a::/80", prefixes[0].String())
+}
+
+func TestAPIError(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<Response><Errors><Error><Code>PrivateIpAddressLimitExceeded</Code>`+
+			`<Message>limit exceeded</Message></Error></Errors><RequestID>1</RequestID></Response>`)
+	})
+	defer cleanup()
+
+	_, err := client.AssignPrivateIPAddresses("eni-1", 1)
+	require.Error(t, err)
+	ec2Err, ok := err.(*Error)
+	require.True(t, ok)
+	assert.Equal(t, "PrivateIpAddressLimitExceeded", ec2Err.Code)
+}
+
+func TestDescribeTrunkInterfaceAssociation(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "AssociationId.1=trunk-assoc-1")
+
+		fmt.Fprint(w, `<DescribeTrunkInterfaceAssociationsResponse>
+			<interfaceAssociationSet>
+				<item>
+					<associationId>trunk-assoc-1</associationId>
+					<branchInterfaceId>eni-2</branchInterfaceId>
+					<trunkInterfaceId>eni-1</trunkInterfaceId>
+					<interfaceProtocol>VLAN</interfaceProtocol>
+					<vlanId>10</vlanId>
+				</item>
+			</interfaceAssociationSet>
+		</DescribeTrunkInterfaceAssociationsResponse>`)
+	})
+	defer cleanup()
+
+	assoc, err := client.DescribeTrunkInterfaceAssociation("trunk-assoc-1")
+	require.NoError(t, err)
+	assert.Equal(t, "eni-2", assoc.BranchInterfaceID)
+	assert.Equal(t, "eni-1", assoc.TrunkInterfaceID)
+	assert.Equal(t, 10, assoc.VlanID)
+}
+
+func TestDescribeTrunkInterfaceAssociationNotFound(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<DescribeTrunkInterfaceAssociationsResponse>
+			<interfaceAssociationSet/>
+		</DescribeTrunkInterfaceAssociationsResponse>`)
+	})
+	defer cleanup()
+
+	_, err := client.DescribeTrunkInterfaceAssociation("trunk-assoc-1")
+	require.Error(t, err)
+	assert.Equal(t, "InvalidAssociationID.NotFound", err.(*Error).Code)
+}
+
+func TestDescribeSecurityGroups(t *testing.T) {
+	client, cleanup := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<DescribeNetworkInterfacesResponse>
+			<networkInterfaceSet>
+				<item>
+					<networkInterfaceId>eni-2</networkInterfaceId>
+					<groupSet>
+						<item><groupId>sg-1</groupId><groupName>web</groupName></item>
+						<item><groupId>sg-2</groupId><groupName>db</groupName></item>
+					</groupSet>
+				</item>
+			</networkInterfaceSet>
+		</DescribeNetworkInterfacesResponse>`)
+	})
+	defer cleanup()
+
+	groups, err := client.DescribeSecurityGroups("eni-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sg-1", "sg-2"}, groups)
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec2
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/network/imds"
+)
+
+// NewInstanceClient creates a new EC2 client for the region of the instance, using the
+// credentials of the instance role from instance metadata.
+func NewInstanceClient(md *imds.Client) (*Client, error) {
+	region, err := md.GetRegion()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(region, func() (*Credentials, error) {
+		creds, err := md.GetSecurityCredentials()
+		if err != nil {
+			return nil, err
+		}
+		return &Credentials{
+			AccessKeyID:     creds.AccessKeyID,
+			SecretAccessKey: creds.SecretAccessKey,
+			SessionToken:    creds.Token,
+		}, nil
+	}), nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package exclusion protects host adapters, such as the management or storage ENIs, that CNI
+// plugins must never modify even if the orchestrator passes them in the network configuration.
+package exclusion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+// List is a list of excluded adapters, identified by link name or MAC address.
+type List struct {
+	Names        []string `json:"names,omitempty"`
+	MACAddresses []string `json:"macAddresses,omitempty"`
+}
+
+// Load loads the exclusion list from the given file. It returns nil if the file does not exist.
+func Load(path string) (*List, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("exclusion: failed to read exclusion list: %v", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates an exclusion list.
+func Parse(data []byte) (*List, error) {
+	var list List
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, fmt.Errorf("exclusion: failed to parse exclusion list: %v", err)
+	}
+
+	// Normalize MAC addresses so that they compare equal regardless of notation.
+	for i, s := range list.MACAddresses {
+		mac, err := net.ParseMAC(s)
+		if err != nil {
+			return nil, fmt.Errorf("exclusion: invalid MAC address %s", s)
+		}
+		list.MACAddresses[i] = mac.String()
+	}
+
+	return &list, nil
+}
+
+// Check returns an error if the adapter with the given link name or MAC address is excluded.
+// Either may be unknown. A nil list excludes nothing.
+func (list *List) Check(name string, macAddress net.HardwareAddr) error {
+	if list == nil {
+		return nil
+	}
+
+	if name != "" {
+		for _, excluded := range list.Names {
+			if strings.EqualFold(name, excluded) {
+				return fmt.Errorf("exclusion: adapter %s is excluded", name)
+			}
+		}
+	}
+
+	if macAddress != nil {
+		for _, excluded := range list.MACAddresses {
+			if macAddress.String() == excluded {
+				return fmt.Errorf("exclusion: adapter %s is excluded", macAddress)
+			}
+		}
+	}
+
+	return nil
+}
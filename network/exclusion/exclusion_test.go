@@ -0,0 +1,47 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package exclusion
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	list, err := Parse([]byte(`{"names":["eth0"], "macAddresses":["0A-00-00-00-00-01"]}`))
+	require.NoError(t, err)
+
+	mac, _ := net.ParseMAC("0a:00:00:00:00:01")
+	assert.Error(t, list.Check("eth0", nil))
+	assert.Error(t, list.Check("", mac))
+	assert.Error(t, list.Check("eth1", mac))
+	assert.NoError(t, list.Check("eth1", nil))
+
+	var none *List
+	assert.NoError(t, none.Check("eth0", mac))
+}
+
+func TestParseInvalidMACAddress(t *testing.T) {
+	_, err := Parse([]byte(`{"macAddresses":["eth0"]}`))
+	assert.Error(t, err)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	list, err := Load("/nonexistent/excluded-adapters.json")
+	assert.NoError(t, err)
+	assert.Nil(t, list)
+}
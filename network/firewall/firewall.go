@@ -0,0 +1,99 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package firewall manages groups of Windows Defender Firewall rules owned by the plugins.
+// Rules are managed with the NetSecurity PowerShell module, and a group is always replaced
+// or removed as a whole.
+package firewall
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule directions.
+const (
+	DirectionInbound  = "Inbound"
+	DirectionOutbound = "Outbound"
+)
+
+// Rule actions.
+const (
+	ActionAllow = "Allow"
+	ActionBlock = "Block"
+)
+
+// Rule protocols.
+const (
+	ProtocolAny    = "Any"
+	ProtocolTCP    = "TCP"
+	ProtocolUDP    = "UDP"
+	ProtocolICMPv4 = "ICMPv4"
+)
+
+// Rule is a Windows Defender Firewall rule. Empty address and port lists match all.
+type Rule struct {
+	Direction       string
+	Action          string
+	Protocol        string
+	LocalPorts      []string
+	RemotePorts     []string
+	RemoteAddresses []string
+	InterfaceAlias  string
+}
+
+// replaceGroupScript returns the PowerShell script replacing the rules in a group.
+func replaceGroupScript(group string, rules []Rule) string {
+	script := removeGroupScript(group)
+
+	for i, rule := range rules {
+		name := fmt.Sprintf("%s %d", group, i)
+		cmd := fmt.Sprintf("New-NetFirewallRule -Name %s -DisplayName %s -Group %s -Direction %s -Action %s -Protocol %s",
+			quote(name), quote(name), quote(group), rule.Direction, rule.Action, rule.Protocol)
+		if len(rule.LocalPorts) != 0 {
+			cmd += " -LocalPort " + quoteList(rule.LocalPorts)
+		}
+		if len(rule.RemotePorts) != 0 {
+			cmd += " -RemotePort " + quoteList(rule.RemotePorts)
+		}
+		if len(rule.RemoteAddresses) != 0 {
+			cmd += " -RemoteAddress " + quoteList(rule.RemoteAddresses)
+		}
+		if rule.InterfaceAlias != "" {
+			cmd += " -InterfaceAlias " + quote(rule.InterfaceAlias)
+		}
+		script += "; " + cmd + " | Out-Null"
+	}
+
+	return script
+}
+
+// removeGroupScript returns the PowerShell script removing the rules in a group, if any.
+func removeGroupScript(group string) string {
+	return fmt.Sprintf("Remove-NetFirewallRule -Group %s -ErrorAction SilentlyContinue", quote(group))
+}
+
+// quote returns a PowerShell single-quoted string literal, in which no characters are special
+// except for the single quote itself.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// quoteList returns a PowerShell array of single-quoted string literals.
+func quoteList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, quote(value))
+	}
+	return strings.Join(quoted, ",")
+}
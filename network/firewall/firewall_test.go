@@ -0,0 +1,52 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firewall
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceGroupScript(t *testing.T) {
+	rules := []Rule{
+		{
+			Direction:       DirectionInbound,
+			Action:          ActionAllow,
+			Protocol:        ProtocolTCP,
+			LocalPorts:      []string{"80", "8000-8080"},
+			RemoteAddresses: []string{"10.0.0.0/16"},
+			InterfaceAlias:  "vEthernet (cid-1)",
+		},
+		{
+			Direction: DirectionOutbound,
+			Action:    ActionBlock,
+			Protocol:  ProtocolAny,
+		},
+	}
+
+	assert.Equal(t,
+		"Remove-NetFirewallRule -Group 'vpc-cni cid-1' -ErrorAction SilentlyContinue; "+
+			"New-NetFirewallRule -Name 'vpc-cni cid-1 0' -DisplayName 'vpc-cni cid-1 0' -Group 'vpc-cni cid-1' "+
+			"-Direction Inbound -Action Allow -Protocol TCP -LocalPort '80','8000-8080' "+
+			"-RemoteAddress '10.0.0.0/16' -InterfaceAlias 'vEthernet (cid-1)' | Out-Null; "+
+			"New-NetFirewallRule -Name 'vpc-cni cid-1 1' -DisplayName 'vpc-cni cid-1 1' -Group 'vpc-cni cid-1' "+
+			"-Direction Outbound -Action Block -Protocol Any | Out-Null",
+		replaceGroupScript("vpc-cni cid-1", rules))
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, "'plain'", quote("plain"))
+	assert.Equal(t, "'it''s; $(x)'", quote("it's; $(x)"))
+}
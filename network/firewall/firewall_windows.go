@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+
+	log "github.com/cihub/seelog"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	// powershellPath is the path of the PowerShell executable, found on first use.
+	powershellPath     string
+	powershellPathErr  error
+	powershellPathOnce sync.Once
+)
+
+// ReplaceGroup replaces the rules in a group with the given rules.
+func ReplaceGroup(group string, rules []Rule) error {
+	log.Infof("Replacing firewall rule group %s with %d rules.", group, len(rules))
+	return run(replaceGroupScript(group, rules))
+}
+
+// RemoveGroup removes the rules in a group. It is not an error if the group has no rules.
+func RemoveGroup(group string) error {
+	log.Infof("Removing firewall rule group %s.", group)
+	return run(removeGroupScript(group))
+}
+
+// run runs a PowerShell script that stops at the first error.
+func run(script string) error {
+	path, err := getPowerShellPath()
+	if err != nil {
+		return fmt.Errorf("firewall: failed to find PowerShell: %v", err)
+	}
+
+	_, err = command.Run(path, "-NoProfile", "-NonInteractive", "-Command",
+		"$ErrorActionPreference = 'Stop'; "+script)
+	if err != nil {
+		return fmt.Errorf("firewall: failed to run script: %v", err)
+	}
+
+	return nil
+}
+
+// getPowerShellPath returns the path of the PowerShell executable of the host.
+func getPowerShellPath() (string, error) {
+	powershellPathOnce.Do(func() {
+		systemDir, err := windows.GetSystemDirectory()
+		if err != nil {
+			log.Errorf("Failed to get system directory: %v.", err)
+		}
+
+		powershellPath, powershellPathErr = findPowerShell(systemDir, fileExists, exec.LookPath)
+		log.Infof("Using PowerShell %s.", powershellPath)
+	})
+
+	return powershellPath, powershellPathErr
+}
+
+// fileExists returns whether a regular file exists at the given path.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
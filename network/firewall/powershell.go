@@ -0,0 +1,55 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firewall
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	// windowsPowerShellPath is the path of Windows PowerShell relative to the system directory.
+	windowsPowerShellPath = `WindowsPowerShell\v1.0\powershell.exe`
+
+	// Names of the PowerShell executables looked up in PATH, in order of preference.
+	powershellExe = "powershell.exe"
+	pwshExe       = "pwsh.exe"
+)
+
+// findPowerShell returns the path of the PowerShell executable. Windows PowerShell in the system
+// directory is preferred, since it matches the architecture of the plugin process, whereas the
+// first executable in PATH may be an emulated x64 build on ARM64 hosts. PATH is searched as a
+// fallback, including for PowerShell 7 on images without Windows PowerShell such as Nano Server.
+func findPowerShell(
+	systemDir string,
+	exists func(path string) bool,
+	lookPath func(file string) (string, error)) (string, error) {
+
+	if systemDir != "" {
+		path := filepath.Join(systemDir, windowsPowerShellPath)
+		if exists(path) {
+			return path, nil
+		}
+	}
+
+	for _, name := range []string{powershellExe, pwshExe} {
+		path, err := lookPath(name)
+		if err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("none of %s and %s found in the system directory or PATH",
+		powershellExe, pwshExe)
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firewall
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPowerShell(t *testing.T) {
+	systemDir := `C:\Windows\System32`
+	inboxPath := filepath.Join(systemDir, windowsPowerShellPath)
+
+	testCases := []struct {
+		name      string
+		systemDir string
+		files     []string
+		path      []string
+		expected  string
+	}{
+		{
+			name:      "inbox PowerShell preferred over PATH",
+			systemDir: systemDir,
+			files:     []string{inboxPath},
+			path:      []string{powershellExe},
+			expected:  inboxPath,
+		},
+		{
+			name:      "Windows PowerShell in PATH",
+			systemDir: systemDir,
+			path:      []string{powershellExe, pwshExe},
+			expected:  `C:\bin\` + powershellExe,
+		},
+		{
+			name:     "PowerShell 7 in PATH without system directory",
+			path:     []string{pwshExe},
+			expected: `C:\bin\` + pwshExe,
+		},
+		{
+			name:      "no PowerShell",
+			systemDir: systemDir,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exists := func(path string) bool {
+				for _, file := range tc.files {
+					if file == path {
+						return true
+					}
+				}
+				return false
+			}
+			lookPath := func(file string) (string, error) {
+				for _, name := range tc.path {
+					if name == file {
+						return `C:\bin\` + name, nil
+					}
+				}
+				return "", fmt.Errorf("%s not found", file)
+			}
+
+			path, err := findPowerShell(tc.systemDir, exists, lookPath)
+			if tc.expected == "" {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, path)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imds
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+)
+
+const (
+	// cacheDirName is the name of the cache directory shared by all plugins.
+	cacheDirName = "imds"
+	// cacheFileName is the name of the cache file.
+	cacheFileName = "cache.json"
+
+	// defaultMetadataTTL is the default time instance metadata responses are cached.
+	defaultMetadataTTL = time.Minute
+	// defaultMinRequestInterval is the default minimum interval between requests to IMDS from
+	// all processes on the node.
+	defaultMinRequestInterval = 20 * time.Millisecond
+
+	// tokenRefreshMargin is the time before their expiration cached tokens are replaced.
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// Cache is a node-wide cache of IMDSv2 session tokens and instance metadata responses, shared
+// by all plugin processes through a state file. It also limits the rate of requests to IMDS
+// from all processes, so that bursts of task launches do not trip IMDS throttling.
+type Cache struct {
+	Path               string
+	MetadataTTL        time.Duration
+	MinRequestInterval time.Duration
+}
+
+// cacheFile is the contents of the cache file.
+type cacheFile struct {
+	Token           string                `json:"token,omitempty"`
+	TokenExpiration time.Time             `json:"tokenExpiration"`
+	Entries         map[string]cacheEntry `json:"entries,omitempty"`
+	NextRequest     time.Time             `json:"nextRequest"`
+}
+
+// cacheEntry is a cached instance metadata response.
+type cacheEntry struct {
+	Value      string    `json:"value"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// NewSharedCache creates a cache in the state directory shared by all plugins on the node.
+func NewSharedCache() *Cache {
+	return &Cache{
+		Path:               filepath.Join(state.GetCacheDir(cacheDirName), cacheFileName),
+		MetadataTTL:        defaultMetadataTTL,
+		MinRequestInterval: defaultMinRequestInterval,
+	}
+}
+
+// getToken returns the cached session token, if it is not about to expire.
+func (cache *Cache) getToken() (string, bool) {
+	var cf cacheFile
+	found, err := state.ReadJSONFile(cache.Path, &cf)
+	if err != nil || !found || cf.Token == "" {
+		return "", false
+	}
+
+	if time.Now().Add(tokenRefreshMargin).After(cf.TokenExpiration) {
+		return "", false
+	}
+
+	return cf.Token, true
+}
+
+// putToken caches a session token with the given lifetime.
+func (cache *Cache) putToken(token string, ttl time.Duration) error {
+	var cf cacheFile
+	return cache.update(&cf, func() {
+		cf.Token = token
+		cf.TokenExpiration = time.Now().Add(ttl)
+	})
+}
+
+// getMetadata returns the cached instance metadata resource at the given path, if it has not
+// expired.
+func (cache *Cache) getMetadata(path string) (string, bool) {
+	var cf cacheFile
+	found, err := state.ReadJSONFile(cache.Path, &cf)
+	if err != nil || !found {
+		return "", false
+	}
+
+	entry, ok := cf.Entries[path]
+	if !ok || time.Now().After(entry.Expiration) {
+		return "", false
+	}
+
+	return entry.Value, true
+}
+
+// putMetadata caches the instance metadata resource at the given path.
+func (cache *Cache) putMetadata(path string, value string) error {
+	var cf cacheFile
+	return cache.update(&cf, func() {
+		now := time.Now()
+		if cf.Entries == nil {
+			cf.Entries = make(map[string]cacheEntry)
+		}
+		// Drop expired entries, so that the cache does not grow without bounds.
+		for p, entry := range cf.Entries {
+			if now.After(entry.Expiration) {
+				delete(cf.Entries, p)
+			}
+		}
+		cf.Entries[path] = cacheEntry{
+			Value:      value,
+			Expiration: now.Add(cache.MetadataTTL),
+		}
+	})
+}
+
+// wait blocks until the next request to IMDS is allowed by the node-wide rate limit. Each caller
+// reserves the next free request slot, so concurrent callers are spread out rather than released
+// at once.
+func (cache *Cache) wait() error {
+	var cf cacheFile
+	var slot time.Time
+	err := cache.update(&cf, func() {
+		slot = time.Now()
+		if cf.NextRequest.After(slot) {
+			slot = cf.NextRequest
+		}
+		cf.NextRequest = slot.Add(cache.MinRequestInterval)
+	})
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(time.Until(slot))
+	return nil
+}
+
+// update atomically applies the given update to the cache file.
+func (cache *Cache) update(cf *cacheFile, update func()) error {
+	// Start over rather than failing forever on a corrupt cache file.
+	if _, err := state.ReadJSONFile(cache.Path, cf); err != nil {
+		os.Remove(cache.Path)
+	}
+
+	return state.UpdateJSONFile(cache.Path, cf, func() error {
+		update()
+		return nil
+	})
+}
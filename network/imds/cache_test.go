@@ -0,0 +1,140 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a client with a cache in a temporary directory, and counts the token
+// and metadata requests served.
+func newTestClient(t *testing.T) (*Client, map[string]int, func()) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+
+		if r.URL.Path == tokenPath {
+			assert.Equal(t, http.MethodPut, r.Method)
+			fmt.Fprint(w, "token")
+			return
+		}
+		assert.Equal(t, "token", r.Header.Get(tokenHeader))
+		fmt.Fprint(w, "value of "+r.URL.Path)
+	}))
+
+	dir, err := ioutil.TempDir("", "imds")
+	require.NoError(t, err)
+
+	client := NewClient()
+	client.Endpoint = server.URL
+	client.Cache = &Cache{
+		Path:               filepath.Join(dir, cacheFileName),
+		MetadataTTL:        time.Minute,
+		MinRequestInterval: time.Millisecond,
+	}
+
+	return client, requests, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCachedClientReusesTokenAndResponses(t *testing.T) {
+	client, requests, cleanup := newTestClient(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		value, err := client.GetInstanceTag("prefixes")
+		require.NoError(t, err)
+		assert.Equal(t, "value of "+metadataPathPrefix+"tags/instance/prefixes", value)
+	}
+
+	// Another process on the node shares the cache.
+	other := NewClient()
+	other.Endpoint = client.Endpoint
+	other.Cache = client.Cache
+	_, err := other.GetRegion()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, requests[tokenPath])
+	assert.Equal(t, 1, requests[metadataPathPrefix+"tags/instance/prefixes"])
+	assert.Equal(t, 1, requests[metadataPathPrefix+"placement/region"])
+}
+
+func TestCachedClientRefetchesExpiredResponses(t *testing.T) {
+	client, requests, cleanup := newTestClient(t)
+	defer cleanup()
+	client.Cache.MetadataTTL = 0
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetRegion()
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, requests[tokenPath])
+	assert.Equal(t, 2, requests[metadataPathPrefix+"placement/region"])
+}
+
+func TestCachedClientDoesNotCacheCredentials(t *testing.T) {
+	client, _, cleanup := newTestClient(t)
+	defer cleanup()
+
+	// The test server does not return valid credentials.
+	_, err := client.GetSecurityCredentials()
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(client.Cache.Path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "security-credentials")
+}
+
+func TestCacheRateLimitsRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imds")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cache := &Cache{
+		Path:               filepath.Join(dir, cacheFileName),
+		MinRequestInterval: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, cache.wait())
+		}()
+	}
+	wg.Wait()
+
+	// Concurrent requests are spread out by the minimum interval.
+	assert.True(t, time.Since(start) >= 4*cache.MinRequestInterval)
+}
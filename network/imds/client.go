@@ -0,0 +1,224 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+)
+
+const (
+	// defaultEndpoint is the base URL of the EC2 instance metadata service.
+	defaultEndpoint = "http://169.254.169.254"
+
+	// tokenPath is the path of the IMDSv2 session token resource.
+	tokenPath = "/latest/api/token"
+	// metadataPathPrefix is the path prefix of instance metadata resources.
+	metadataPathPrefix = "/latest/meta-data/"
+
+	// tokenTTLHeader and tokenHeader are the IMDSv2 session token request headers.
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	// tokenTTL is the lifetime of IMDSv2 session tokens.
+	tokenTTL = 6 * time.Hour
+
+	// requestTimeout is the timeout for instance metadata requests.
+	requestTimeout = 5 * time.Second
+)
+
+// Client is a client for the EC2 instance metadata service.
+type Client struct {
+	Endpoint string
+	HTTP     *http.Client
+	// Backoff is the retry policy for transient failures. Zero fields use the default policy.
+	Backoff backoff.Policy
+	// Cache is the optional cache of session tokens and metadata responses shared with other
+	// processes. If set, requests are also rate limited node-wide.
+	Cache *Cache
+}
+
+// SecurityCredentials are the temporary credentials of the instance profile role.
+type SecurityCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// NewClient creates a new instance metadata service client.
+func NewClient() *Client {
+	return &Client{
+		Endpoint: defaultEndpoint,
+		HTTP:     &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// NewCachedClient creates a new instance metadata service client that shares its session
+// tokens and metadata responses with other processes on the node.
+func NewCachedClient() *Client {
+	c := NewClient()
+	c.Cache = NewSharedCache()
+	return c
+}
+
+// GetMetadata returns the instance metadata resource at the given path.
+func (c *Client) GetMetadata(path string) (string, error) {
+	if c.Cache != nil {
+		if value, ok := c.Cache.getMetadata(path); ok {
+			return value, nil
+		}
+	}
+
+	value, err := c.getMetadata(path)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Cache != nil {
+		c.Cache.putMetadata(path, value)
+	}
+
+	return value, nil
+}
+
+// getMetadata requests the instance metadata resource at the given path, bypassing the cache.
+func (c *Client) getMetadata(path string) (string, error) {
+	token, err := c.getToken()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.Endpoint+metadataPathPrefix+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(tokenHeader, token)
+
+	return c.do(req)
+}
+
+// GetRegion returns the region of the instance.
+func (c *Client) GetRegion() (string, error) {
+	return c.GetMetadata("placement/region")
+}
+
+// GetInstanceTag returns the value of the given tag of the instance. Access to instance tags in
+// instance metadata must be enabled.
+func (c *Client) GetInstanceTag(key string) (string, error) {
+	return c.GetMetadata("tags/instance/" + key)
+}
+
+// GetSecurityCredentials returns the temporary credentials of the instance profile role.
+func (c *Client) GetSecurityCredentials() (*SecurityCredentials, error) {
+	// Credentials are secrets, and are never written to the cache.
+	roles, err := c.getMetadata("iam/security-credentials/")
+	if err != nil {
+		return nil, err
+	}
+
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return nil, fmt.Errorf("imds: no instance profile role")
+	}
+
+	data, err := c.getMetadata("iam/security-credentials/" + role)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds SecurityCredentials
+	err = json.Unmarshal([]byte(data), &creds)
+	if err != nil {
+		return nil, fmt.Errorf("imds: failed to parse security credentials: %v", err)
+	}
+
+	return &creds, nil
+}
+
+// getToken returns a cached IMDSv2 session token, or requests a new one.
+func (c *Client) getToken() (string, error) {
+	if c.Cache != nil {
+		if token, ok := c.Cache.getToken(); ok {
+			return token, nil
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.Endpoint+tokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(tokenTTLHeader, strconv.Itoa(int(tokenTTL.Seconds())))
+
+	token, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Cache != nil {
+		c.Cache.putToken(token, tokenTTL)
+	}
+
+	return token, nil
+}
+
+// do sends a request and returns the response body. Transport errors, throttling and server
+// errors are retried.
+func (c *Client) do(req *http.Request) (string, error) {
+	var body string
+	err := c.Backoff.Retry("IMDS request "+req.URL.Path, func() error {
+		var err error
+		body, err = c.doOnce(req)
+		return err
+	}, backoff.IsTransient)
+
+	return body, err
+}
+
+// doOnce sends a request once and returns the response body.
+func (c *Client) doOnce(req *http.Request) (string, error) {
+	if c.Cache != nil {
+		err := c.Cache.wait()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", backoff.Transient(fmt.Errorf("imds: request %s failed: %v", req.URL.Path, err))
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("imds: failed to read response to %s: %v", req.URL.Path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("imds: request %s failed with status %s", req.URL.Path, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			err = backoff.Transient(err)
+		}
+		return "", err
+	}
+
+	return string(body), nil
+}
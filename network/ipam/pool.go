@@ -0,0 +1,413 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+)
+
+const (
+	// poolFileFormat is the format of the names of pool state files.
+	poolFilePrefix = "ipam-"
+	poolFileSuffix = ".json"
+	poolFileFormat = poolFilePrefix + "%s" + poolFileSuffix
+
+	// corruptFileSuffix is appended to the names of corrupt pool state files moved aside.
+	corruptFileSuffix = ".corrupt"
+)
+
+// PoolSchema is the schema of the pool state files in a state directory.
+var PoolSchema = state.FileSchema{Name: "ipam-pools", Pattern: poolFilePrefix + "*" + poolFileSuffix, Journaled: true}
+
+// Pool allocates IP addresses from a set, such as the secondary IP addresses of an ENI or a
+// VPC subnet range, to containers. Allocations are persisted in the plugin state directory,
+// so that they are shared by all plugin processes on the node.
+type Pool struct {
+	path         string
+	addresses    addressSet
+	reservations map[string]*net.IPNet
+	owner        string
+}
+
+// addressSet is a set of IP addresses that a pool allocates from.
+type addressSet interface {
+	// forEach calls fn for each address in the set in order, until fn returns false.
+	forEach(fn func(*net.IPNet) bool)
+	// find returns the address in the set with the given string representation, or nil.
+	find(s string) *net.IPNet
+	// String returns a description of the set.
+	String() string
+}
+
+// addressList is an addressSet backed by a fixed list of addresses.
+type addressList []*net.IPNet
+
+// poolState is the persistent state of a pool, mapping container IDs to allocated addresses,
+// the times they were allocated and the IDs of the CNI stacks that own them. Truncated marks
+// the allocations restored from interface names that are keyed by truncated container IDs.
+type poolState struct {
+	Allocations map[string]string    `json:"allocations"`
+	AllocatedAt map[string]time.Time `json:"allocatedAt,omitempty"`
+	Owners      map[string]string    `json:"owners,omitempty"`
+	Truncated   map[string]bool      `json:"truncated,omitempty"`
+}
+
+// NewPool creates a new Pool object for the named pool in the given state directory.
+func NewPool(stateDir string, name string, addresses []*net.IPNet) *Pool {
+	return &Pool{
+		path:      filepath.Join(stateDir, fmt.Sprintf(poolFileFormat, name)),
+		addresses: addressList(addresses),
+	}
+}
+
+// SetReservations sets the addresses reserved for specific keys, such as container IDs or task
+// ARNs. Reserved addresses are allocated only to containers with the matching key.
+func (pool *Pool) SetReservations(reservations map[string]*net.IPNet) error {
+	pool.reservations = make(map[string]*net.IPNet)
+	for key, reserved := range reservations {
+		address := pool.addresses.find(reserved.String())
+		if address == nil {
+			return fmt.Errorf("ipam: reserved address %s is not in %s", reserved, pool.addresses)
+		}
+		pool.reservations[key] = address
+	}
+
+	return nil
+}
+
+// SetOwner sets the ID of the CNI stack that owns the allocations made through the pool.
+// Allocations owned by other CNI stacks are neither returned nor released.
+func (pool *Pool) SetOwner(ownerID string) {
+	pool.owner = ownerID
+}
+
+// Allocate allocates a free IP address to the given container. If the container already has an
+// allocation, it returns the same address.
+func (pool *Pool) Allocate(containerID string) (*net.IPNet, error) {
+	return pool.AllocateReserved(containerID, containerID)
+}
+
+// AllocateReserved allocates the IP address reserved for the given key to the given container.
+// If there is no reservation for the key, it allocates a free IP address that is not reserved.
+// If the container already has an allocation, it returns the same address.
+func (pool *Pool) AllocateReserved(containerID string, key string) (*net.IPNet, error) {
+	var ps poolState
+	var address *net.IPNet
+
+	err := state.UpdateJournaledFile(pool.path, &ps, func() error {
+		if ps.Allocations == nil {
+			ps.Allocations = make(map[string]string)
+		}
+
+		if allocated, ok := ps.Allocations[containerID]; ok {
+			if ps.Owners[containerID] != pool.owner {
+				return fmt.Errorf("ipam: allocation of container %s is owned by %q",
+					containerID, ps.Owners[containerID])
+			}
+			address = pool.addresses.find(allocated)
+			if address != nil {
+				return nil
+			}
+		}
+
+		inUse := make(map[string]string)
+		for allocatedTo, allocated := range ps.Allocations {
+			inUse[allocated] = allocatedTo
+		}
+
+		if reserved, ok := pool.reservations[key]; ok {
+			if allocatedTo, ok := inUse[reserved.String()]; ok {
+				return fmt.Errorf("ipam: reserved address %s is in use by container %s", reserved, allocatedTo)
+			}
+			address = reserved
+		} else {
+			address = pool.findFree(inUse)
+		}
+
+		if address == nil {
+			return fmt.Errorf("ipam: no free IP address left in %s", pool.addresses)
+		}
+
+		ps.Allocations[containerID] = address.String()
+		if ps.AllocatedAt == nil {
+			ps.AllocatedAt = make(map[string]time.Time)
+		}
+		ps.AllocatedAt[containerID] = time.Now()
+		if pool.owner != "" {
+			if ps.Owners == nil {
+				ps.Owners = make(map[string]string)
+			}
+			ps.Owners[containerID] = pool.owner
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// findFree returns the first address in the pool that is neither in use nor reserved.
+func (pool *Pool) findFree(inUse map[string]string) *net.IPNet {
+	isReserved := make(map[string]bool)
+	for _, reserved := range pool.reservations {
+		isReserved[reserved.String()] = true
+	}
+
+	var address *net.IPNet
+	pool.addresses.forEach(func(candidate *net.IPNet) bool {
+		if _, ok := inUse[candidate.String()]; ok || isReserved[candidate.String()] {
+			return true
+		}
+		address = candidate
+		return false
+	})
+
+	return address
+}
+
+// Lookup returns the IP address allocated to the given container without releasing it.
+// It returns nil if the container has no allocation.
+func (pool *Pool) Lookup(containerID string) (*net.IPNet, error) {
+	var ps poolState
+	_, err := state.ReadJournaledFile(pool.path, &ps)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ps.findAllocation(containerID)
+	allocated, ok := ps.Allocations[key]
+	if !ok {
+		return nil, nil
+	}
+	if ps.Owners[key] != pool.owner {
+		return nil, fmt.Errorf("ipam: allocation of container %s is owned by %q", key, ps.Owners[key])
+	}
+
+	return pool.addresses.find(allocated), nil
+}
+
+// Release releases the IP address allocated to the given container and returns it.
+// It returns nil if the container has no allocation.
+func (pool *Pool) Release(containerID string) (*net.IPNet, error) {
+	var ps poolState
+	var address *net.IPNet
+
+	err := state.UpdateJournaledFile(pool.path, &ps, func() error {
+		key := ps.findAllocation(containerID)
+		if allocated, ok := ps.Allocations[key]; ok {
+			if ps.Owners[key] != pool.owner {
+				return fmt.Errorf("ipam: allocation of container %s is owned by %q", key, ps.Owners[key])
+			}
+			address = pool.addresses.find(allocated)
+			ps.delete(key)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// Allocations returns the current allocations of the pool, mapping container IDs to addresses.
+func (pool *Pool) Allocations() (map[string]string, error) {
+	var ps poolState
+	_, err := state.ReadJournaledFile(pool.path, &ps)
+	if err != nil {
+		return nil, err
+	}
+
+	if ps.Allocations == nil {
+		ps.Allocations = make(map[string]string)
+	}
+
+	return ps.Allocations, nil
+}
+
+// Restore adds allocations recovered from the live network configuration, mapping container
+// IDs to addresses, to the pool as allocations of the pool owner. Container IDs set in
+// truncated may be truncated prefixes of the actual container IDs. Existing allocations are
+// kept. A corrupt pool state file is moved aside and rebuilt. Returns the number of restored
+// allocations.
+func (pool *Pool) Restore(allocations map[string]string, truncated map[string]bool) (int, error) {
+	var ps poolState
+	_, err := state.ReadJournaledFile(pool.path, &ps)
+	if err != nil {
+		err = os.Rename(pool.path, pool.path+corruptFileSuffix)
+		if err != nil {
+			return 0, fmt.Errorf("ipam: failed to move aside corrupt pool state: %v", err)
+		}
+		err = state.RemoveJournal(pool.path)
+		if err != nil {
+			return 0, fmt.Errorf("ipam: failed to remove corrupt pool state: %v", err)
+		}
+	}
+
+	var restored int
+	err = state.UpdateJournaledFile(pool.path, &ps, func() error {
+		if ps.Allocations == nil {
+			ps.Allocations = make(map[string]string)
+		}
+
+		inUse := make(map[string]bool)
+		for _, allocated := range ps.Allocations {
+			inUse[allocated] = true
+		}
+
+		for containerID, address := range allocations {
+			if _, ok := ps.Allocations[containerID]; ok || inUse[address] {
+				continue
+			}
+			ps.Allocations[containerID] = address
+			if pool.owner != "" {
+				if ps.Owners == nil {
+					ps.Owners = make(map[string]string)
+				}
+				ps.Owners[containerID] = pool.owner
+			}
+			if truncated[containerID] {
+				if ps.Truncated == nil {
+					ps.Truncated = make(map[string]bool)
+				}
+				ps.Truncated[containerID] = true
+			}
+			inUse[address] = true
+			restored++
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return restored, nil
+}
+
+// ReleaseIf releases the allocations owned by the pool owner for which fn returns true, and
+// returns them as a map of container IDs to addresses. Allocations recorded before allocation
+// times were persisted have a zero allocation time.
+func (pool *Pool) ReleaseIf(fn func(containerID string, allocatedAt time.Time) bool) (map[string]string, error) {
+	var ps poolState
+	released := make(map[string]string)
+
+	err := state.UpdateJournaledFile(pool.path, &ps, func() error {
+		for containerID, allocated := range ps.Allocations {
+			if ps.Owners[containerID] != pool.owner {
+				continue
+			}
+			if fn(containerID, ps.AllocatedAt[containerID]) {
+				released[containerID] = allocated
+				ps.delete(containerID)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return released, nil
+}
+
+// ListPools returns the names of the pools persisted in the given state directory.
+func ListPools(stateDir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(stateDir, fmt.Sprintf(poolFileFormat, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, path := range paths {
+		name := strings.TrimPrefix(filepath.Base(path), poolFilePrefix)
+		names = append(names, strings.TrimSuffix(name, poolFileSuffix))
+	}
+
+	return names, nil
+}
+
+// findAllocation returns the key of the allocation of the given container. Allocations restored
+// from interface names may be keyed by truncated container IDs.
+func (ps *poolState) findAllocation(containerID string) string {
+	if _, ok := ps.Allocations[containerID]; ok {
+		return containerID
+	}
+
+	for key := range ps.Truncated {
+		if _, ok := ps.Allocations[key]; ok && MatchContainerID(containerID, key, true) {
+			return key
+		}
+	}
+
+	return containerID
+}
+
+// MatchContainerID returns whether the given container ID matches the given ID recorded for a
+// container. If truncated is set, the recorded ID may be the container ID truncated to its length.
+func MatchContainerID(containerID string, recorded string, truncated bool) bool {
+	if containerID == recorded {
+		return true
+	}
+
+	return truncated &&
+		recorded != "" &&
+		len(containerID) > len(recorded) &&
+		containerID[:len(recorded)] == recorded
+}
+
+// delete deletes the allocation with the given key.
+func (ps *poolState) delete(key string) {
+	delete(ps.Allocations, key)
+	delete(ps.AllocatedAt, key)
+	delete(ps.Owners, key)
+	delete(ps.Truncated, key)
+}
+
+// forEach calls fn for each address in the list.
+func (list addressList) forEach(fn func(*net.IPNet) bool) {
+	for _, address := range list {
+		if !fn(address) {
+			return
+		}
+	}
+}
+
+// find returns the address in the list with the given string representation.
+func (list addressList) find(s string) *net.IPNet {
+	for _, address := range list {
+		if address.String() == s {
+			return address
+		}
+	}
+
+	return nil
+}
+
+// String returns a description of the list.
+func (list addressList) String() string {
+	return fmt.Sprintf("pool of %d", len(list))
+}
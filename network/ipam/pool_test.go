@@ -0,0 +1,246 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPool(t *testing.T, addresses ...string) (*Pool, func()) {
+	dir, err := ioutil.TempDir("", "ipam")
+	require.NoError(t, err)
+
+	var ipNets []*net.IPNet
+	for _, address := range addresses {
+		ipNet, err := vpc.GetIPAddressFromString(address)
+		require.NoError(t, err)
+		ipNets = append(ipNets, ipNet)
+	}
+
+	return NewPool(dir, "test", ipNets), func() { os.RemoveAll(dir) }
+}
+
+func TestPoolAllocateAndRelease(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24")
+	defer cleanup()
+
+	address1, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address1.String())
+
+	// Allocation is idempotent.
+	address1, err = pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address1.String())
+
+	address2, err := pool.Allocate("container2")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.21/24", address2.String())
+
+	_, err = pool.Allocate("container3")
+	assert.Error(t, err)
+
+	released, err := pool.Release("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", released.String())
+
+	address3, err := pool.Allocate("container3")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address3.String())
+}
+
+func TestPoolReleaseWithoutAllocation(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24")
+	defer cleanup()
+
+	released, err := pool.Release("container1")
+	assert.NoError(t, err)
+	assert.Nil(t, released)
+}
+
+func TestPoolReleaseIf(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24")
+	defer cleanup()
+
+	start := time.Now()
+	_, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	_, err = pool.Allocate("container2")
+	require.NoError(t, err)
+
+	released, err := pool.ReleaseIf(func(containerID string, allocatedAt time.Time) bool {
+		assert.False(t, allocatedAt.Before(start))
+		return containerID == "container1"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"container1": "10.0.1.20/24"}, released)
+
+	allocations, err := pool.Allocations()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"container2": "10.0.1.21/24"}, allocations)
+}
+
+func TestListPools(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24")
+	defer cleanup()
+
+	_, err := pool.Allocate("container1")
+	require.NoError(t, err)
+
+	names, err := ListPools(filepath.Dir(pool.path))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test"}, names)
+}
+
+func TestPoolRestore(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24", "10.0.1.22/24")
+	defer cleanup()
+
+	_, err := pool.Allocate("container1")
+	require.NoError(t, err)
+
+	restored, err := pool.Restore(map[string]string{
+		"container1": "10.0.1.22/24",
+		"0123abcd":   "10.0.1.21/24",
+	}, map[string]bool{"0123abcd": true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	// Restored addresses are not allocated again.
+	address, err := pool.Allocate("container2")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.22/24", address.String())
+
+	// Allocations restored with truncated container IDs are released by full container ID.
+	released, err := pool.Release("0123abcdef456789")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.21/24", released.String())
+}
+
+func TestPoolReleaseMatchesExactContainerID(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24")
+	defer cleanup()
+
+	_, err := pool.Allocate("c1")
+	require.NoError(t, err)
+
+	released, err := pool.Release("c10")
+	require.NoError(t, err)
+	assert.Nil(t, released)
+
+	allocations, err := pool.Allocations()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"c1": "10.0.1.20/24"}, allocations)
+
+	// Container IDs restored without truncation are matched exactly as well.
+	restored, err := pool.Restore(map[string]string{"c2": "10.0.1.21/24"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	released, err = pool.Release("c20")
+	require.NoError(t, err)
+	assert.Nil(t, released)
+}
+
+func TestPoolRestoreCorruptState(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24")
+	defer cleanup()
+
+	require.NoError(t, ioutil.WriteFile(pool.path, []byte("{corrupt"), 0600))
+	_, err := pool.Allocate("container1")
+	assert.Error(t, err)
+
+	restored, err := pool.Restore(map[string]string{"container1": "10.0.1.21/24"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	address, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.21/24", address.String())
+	assert.FileExists(t, pool.path+corruptFileSuffix)
+}
+
+func TestPoolReservations(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24", "10.0.1.22/24")
+	defer cleanup()
+
+	reserved, _ := vpc.GetIPAddressFromString("10.0.1.20/24")
+	require.NoError(t, pool.SetReservations(map[string]*net.IPNet{"task1": reserved}))
+
+	// Reserved addresses are not allocated to other containers.
+	address, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.21/24", address.String())
+
+	address, err = pool.AllocateReserved("container2", "task1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address.String())
+
+	// The reserved address is in use until the previous container releases it.
+	_, err = pool.AllocateReserved("container3", "task1")
+	assert.Error(t, err)
+
+	_, err = pool.Release("container2")
+	require.NoError(t, err)
+	address, err = pool.AllocateReserved("container3", "task1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address.String())
+}
+
+func TestPoolReservationNotInPool(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24")
+	defer cleanup()
+
+	reserved, _ := vpc.GetIPAddressFromString("10.0.1.30/24")
+	assert.Error(t, pool.SetReservations(map[string]*net.IPNet{"task1": reserved}))
+}
+
+func TestPoolOwners(t *testing.T) {
+	pool, cleanup := newTestPool(t, "10.0.1.20/24", "10.0.1.21/24")
+	defer cleanup()
+
+	pool.SetOwner("ecs")
+	_, err := pool.Allocate("container1")
+	require.NoError(t, err)
+
+	// Allocations are invisible to other owners, but their addresses are in use.
+	pool.SetOwner("eks")
+	_, err = pool.Allocate("container1")
+	assert.Error(t, err)
+	_, err = pool.Release("container1")
+	assert.Error(t, err)
+
+	address, err := pool.Allocate("container2")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.21/24", address.String())
+
+	released, err := pool.ReleaseIf(func(string, time.Time) bool { return true })
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"container2": "10.0.1.21/24"}, released)
+
+	pool.SetOwner("ecs")
+	address, err = pool.Release("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.20/24", address.String())
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	// IPv4PrefixLength is the length of IPv4 prefixes delegated to ENIs.
+	IPv4PrefixLength = 28
+	// IPv6PrefixLength is the length of IPv6 prefixes delegated to ENIs.
+	IPv6PrefixLength = 80
+)
+
+// prefixSet is an addressSet backed by IP prefixes delegated to an ENI, in addition to
+// individual secondary IP addresses. All addresses in delegated prefixes are allocatable.
+type prefixSet struct {
+	addresses addressList
+	prefixes  []*net.IPNet
+	mask      net.IPMask
+}
+
+// NewPrefixPool creates a new Pool object for the named pool in the given state directory that
+// allocates the given addresses and all addresses in the given delegated prefixes. Addresses
+// allocated from prefixes are assigned the subnet mask.
+func NewPrefixPool(
+	stateDir string,
+	name string,
+	addresses []*net.IPNet,
+	prefixes []*net.IPNet,
+	mask net.IPMask) *Pool {
+
+	pool := NewPool(stateDir, name, nil)
+	pool.addresses = &prefixSet{
+		addresses: addressList(addresses),
+		prefixes:  prefixes,
+		mask:      mask,
+	}
+
+	return pool
+}
+
+// PrefixSize returns the number of addresses in a prefix, saturated at the maximum int value.
+func PrefixSize(prefix *net.IPNet) int {
+	ones, bits := prefix.Mask.Size()
+	if bits-ones >= 31 {
+		return int(^uint(0) >> 1)
+	}
+	return 1 << uint(bits-ones)
+}
+
+// PrefixUtilization returns the number of allocated addresses in each prefix, keyed by prefix.
+func PrefixUtilization(allocations map[string]string, prefixes []*net.IPNet) map[string]int {
+	utilization := make(map[string]int)
+	for _, prefix := range prefixes {
+		utilization[prefix.String()] = 0
+	}
+
+	for _, allocated := range allocations {
+		ip, _, err := net.ParseCIDR(allocated)
+		if err != nil {
+			continue
+		}
+
+		for _, prefix := range prefixes {
+			if prefix.Contains(ip) {
+				utilization[prefix.String()]++
+				break
+			}
+		}
+	}
+
+	return utilization
+}
+
+// forEach calls fn for each individual address and then each address in each prefix.
+func (set *prefixSet) forEach(fn func(*net.IPNet) bool) {
+	more := true
+	set.addresses.forEach(func(address *net.IPNet) bool {
+		more = fn(address)
+		return more
+	})
+
+	for _, prefix := range set.prefixes {
+		if !more {
+			return
+		}
+
+		last := lastIP(prefix)
+		for ip := normalizeIP(prefix.IP); compareIP(ip, last) <= 0; ip = addToIP(ip, 1) {
+			more = fn(&net.IPNet{IP: ip, Mask: set.mask})
+			if !more || ip.Equal(last) {
+				break
+			}
+		}
+	}
+}
+
+// find returns the address with the given string representation, or nil.
+func (set *prefixSet) find(s string) *net.IPNet {
+	address := set.addresses.find(s)
+	if address != nil {
+		return address
+	}
+
+	ip, ipNet, err := net.ParseCIDR(s)
+	if err != nil || ipNet.Mask.String() != set.mask.String() {
+		return nil
+	}
+
+	for _, prefix := range set.prefixes {
+		if prefix.Contains(ip) {
+			return &net.IPNet{IP: normalizeIP(ip), Mask: set.mask}
+		}
+	}
+
+	return nil
+}
+
+// String returns a description of the set.
+func (set *prefixSet) String() string {
+	return fmt.Sprintf("%s and %d prefixes", set.addresses, len(set.prefixes))
+}
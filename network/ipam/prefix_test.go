@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixPoolAllocate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mask := net.CIDRMask(24, 32)
+	addresses := []*net.IPNet{{IP: net.ParseIP("10.0.1.20").To4(), Mask: mask}}
+	prefixes := []*net.IPNet{parseCIDR(t, "10.0.1.32/30"), parseCIDR(t, "10.0.1.48/30")}
+	pool := NewPrefixPool(dir, "test", addresses, prefixes, mask)
+
+	// Individual addresses are allocated first, then prefixes in order.
+	expected := []string{
+		"10.0.1.20/24",
+		"10.0.1.32/24", "10.0.1.33/24", "10.0.1.34/24", "10.0.1.35/24",
+		"10.0.1.48/24", "10.0.1.49/24", "10.0.1.50/24", "10.0.1.51/24",
+	}
+	for i, address := range expected {
+		allocated, err := pool.Allocate(string(rune('a' + i)))
+		require.NoError(t, err)
+		assert.Equal(t, address, allocated.String())
+	}
+
+	_, err = pool.Allocate("z")
+	assert.Error(t, err)
+
+	released, err := pool.Release("b")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.32/24", released.String())
+
+	allocations, err := pool.Allocations()
+	require.NoError(t, err)
+	utilization := PrefixUtilization(allocations, prefixes)
+	assert.Equal(t, 3, utilization["10.0.1.32/30"])
+	assert.Equal(t, 4, utilization["10.0.1.48/30"])
+}
+
+func TestPrefixPoolIPv6(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	prefix := parseCIDR(t, "2600:1f14:0:1:a::/80")
+	pool := NewPrefixPool(dir, "test", nil, []*net.IPNet{prefix}, net.CIDRMask(64, 128))
+
+	address, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "2600:1f14:0:1:a::/64", address.String())
+
+	address, err = pool.Allocate("container2")
+	require.NoError(t, err)
+	assert.Equal(t, "2600:1f14:0:1:a::1/64", address.String())
+}
+
+func TestPrefixSize(t *testing.T) {
+	assert.Equal(t, 16, PrefixSize(parseCIDR(t, "10.0.1.32/28")))
+	assert.Equal(t, int(^uint(0)>>1), PrefixSize(parseCIDR(t, "2600:1f14::/80")))
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+)
+
+const (
+	// vpcReservedHeadAddresses is the number of addresses at the start of each VPC subnet that
+	// are reserved for the network address, VPC router, DNS server and future use.
+	vpcReservedHeadAddresses = 4
+	// vpcReservedTailAddresses is the number of addresses at the end of each VPC subnet that
+	// are reserved for the network broadcast address.
+	vpcReservedTailAddresses = 1
+)
+
+// Range is a range of IP addresses in a VPC subnet.
+type Range struct {
+	// Subnet is the VPC subnet prefix.
+	Subnet *net.IPNet
+	// RangeStart is the first address to allocate. Defaults to the first address that is not
+	// reserved by VPC.
+	RangeStart net.IP
+	// RangeEnd is the last address to allocate. Defaults to the last address that is not
+	// reserved by VPC.
+	RangeEnd net.IP
+	// Gateway is the subnet gateway, which is never allocated. Defaults to the VPC router.
+	Gateway net.IP
+	// Exclude is the list of address blocks that are never allocated.
+	Exclude []*net.IPNet
+}
+
+// NewRangePool creates a new Pool object for the named pool in the given state directory that
+// allocates addresses from the given VPC subnet range.
+func NewRangePool(stateDir string, name string, r *Range) (*Pool, error) {
+	err := r.setDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	pool := NewPool(stateDir, name, nil)
+	pool.addresses = r
+
+	return pool, nil
+}
+
+// setDefaults validates the range and sets the default values of optional fields.
+func (r *Range) setDefaults() error {
+	if r.Subnet == nil {
+		return fmt.Errorf("ipam: missing subnet")
+	}
+
+	subnet := vpc.GetSubnetPrefix(&net.IPNet{IP: r.Subnet.IP, Mask: r.Subnet.Mask})
+	r.Subnet = subnet
+
+	ones, bits := subnet.Mask.Size()
+	if bits-ones < 3 {
+		return fmt.Errorf("ipam: subnet %s is too small", subnet)
+	}
+
+	if r.RangeStart == nil {
+		r.RangeStart = addToIP(subnet.IP, vpcReservedHeadAddresses)
+	}
+
+	if r.RangeEnd == nil {
+		r.RangeEnd = addToIP(lastIP(subnet), -vpcReservedTailAddresses)
+	}
+
+	if r.Gateway == nil {
+		vpcSubnet, err := vpc.NewSubnet(subnet)
+		if err != nil {
+			return err
+		}
+		r.Gateway = vpcSubnet.Gateways[0]
+	}
+
+	if !subnet.Contains(r.RangeStart) || !subnet.Contains(r.RangeEnd) {
+		return fmt.Errorf("ipam: range %s-%s is not in subnet %s", r.RangeStart, r.RangeEnd, subnet)
+	}
+
+	if compareIP(r.RangeStart, r.RangeEnd) > 0 {
+		return fmt.Errorf("ipam: range start %s is after range end %s", r.RangeStart, r.RangeEnd)
+	}
+
+	return nil
+}
+
+// forEach calls fn for each allocatable address in the range.
+func (r *Range) forEach(fn func(*net.IPNet) bool) {
+	for ip := r.RangeStart; compareIP(ip, r.RangeEnd) <= 0; ip = addToIP(ip, 1) {
+		if r.isExcluded(ip) {
+			continue
+		}
+
+		if !fn(&net.IPNet{IP: ip, Mask: r.Subnet.Mask}) {
+			return
+		}
+	}
+}
+
+// find returns the allocatable address in the range with the given string representation.
+func (r *Range) find(s string) *net.IPNet {
+	ip, ipNet, err := net.ParseCIDR(s)
+	if err != nil || ipNet.String() != r.Subnet.String() {
+		return nil
+	}
+
+	if compareIP(ip, r.RangeStart) < 0 || compareIP(ip, r.RangeEnd) > 0 || r.isExcluded(ip) {
+		return nil
+	}
+
+	return &net.IPNet{IP: normalizeIP(ip), Mask: r.Subnet.Mask}
+}
+
+// String returns a description of the range.
+func (r *Range) String() string {
+	return fmt.Sprintf("range %s-%s", r.RangeStart, r.RangeEnd)
+}
+
+// isExcluded returns whether the given address must not be allocated.
+func (r *Range) isExcluded(ip net.IP) bool {
+	if ip.Equal(r.Gateway) {
+		return true
+	}
+
+	for _, block := range r.Exclude {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeIP returns the 4-byte form of IPv4 addresses and the 16-byte form of IPv6 addresses.
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// compareIP compares two IP addresses of the same family.
+func compareIP(a, b net.IP) int {
+	return bytes.Compare(normalizeIP(a), normalizeIP(b))
+}
+
+// addToIP returns the IP address offset by n.
+func addToIP(ip net.IP, n int) net.IP {
+	ip = normalizeIP(ip)
+	result := make(net.IP, len(ip))
+	copy(result, ip)
+
+	carry := n
+	for i := len(result) - 1; i >= 0 && carry != 0; i-- {
+		sum := int(result[i]) + carry
+		result[i] = byte(sum & 0xff)
+		carry = sum >> 8
+	}
+
+	return result
+}
+
+// lastIP returns the last address in a subnet.
+func lastIP(subnet *net.IPNet) net.IP {
+	ip := normalizeIP(subnet.IP)
+	mask := subnet.Mask
+	if len(mask) != len(ip) {
+		mask = mask[len(mask)-len(ip):]
+	}
+
+	result := make(net.IP, len(ip))
+	for i := range ip {
+		result[i] = ip[i] | ^mask[i]
+	}
+
+	return result
+}
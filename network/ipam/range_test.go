@@ -0,0 +1,110 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseCIDR(t *testing.T, s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return ipNet
+}
+
+func TestRangeDefaults(t *testing.T) {
+	r := &Range{Subnet: parseCIDR(t, "10.0.1.0/24")}
+	require.NoError(t, r.setDefaults())
+
+	assert.Equal(t, "10.0.1.4", r.RangeStart.String())
+	assert.Equal(t, "10.0.1.254", r.RangeEnd.String())
+	assert.Equal(t, "10.0.1.1", r.Gateway.String())
+}
+
+func TestRangeInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		r    Range
+	}{
+		{"missing subnet", Range{}},
+		{"subnet too small", Range{Subnet: parseCIDR(t, "10.0.1.0/30")}},
+		{"start outside subnet", Range{Subnet: parseCIDR(t, "10.0.1.0/24"), RangeStart: net.ParseIP("10.0.2.4")}},
+		{"start after end", Range{
+			Subnet:     parseCIDR(t, "10.0.1.0/24"),
+			RangeStart: net.ParseIP("10.0.1.100"),
+			RangeEnd:   net.ParseIP("10.0.1.50"),
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, tc.r.setDefaults())
+		})
+	}
+}
+
+func TestRangePoolAllocate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pool, err := NewRangePool(dir, "test", &Range{
+		Subnet:     parseCIDR(t, "10.0.1.0/24"),
+		RangeStart: net.ParseIP("10.0.1.1"),
+		RangeEnd:   net.ParseIP("10.0.1.6"),
+		Exclude:    []*net.IPNet{parseCIDR(t, "10.0.1.2/31"), parseCIDR(t, "10.0.1.5/32")},
+	})
+	require.NoError(t, err)
+
+	// The gateway and excluded addresses are skipped.
+	address1, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.4/24", address1.String())
+
+	address2, err := pool.Allocate("container2")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.6/24", address2.String())
+
+	_, err = pool.Allocate("container3")
+	assert.Error(t, err)
+
+	released, err := pool.Release("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.4/24", released.String())
+}
+
+func TestRangePoolAllocateIPv6(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pool, err := NewRangePool(dir, "test", &Range{Subnet: parseCIDR(t, "2600:1f14::/64")})
+	require.NoError(t, err)
+
+	address, err := pool.Allocate("container1")
+	require.NoError(t, err)
+	assert.Equal(t, "2600:1f14::4/64", address.String())
+}
+
+func TestAddToIP(t *testing.T) {
+	assert.Equal(t, "10.0.2.0", addToIP(net.ParseIP("10.0.1.255"), 1).String())
+	assert.Equal(t, "10.0.0.255", addToIP(net.ParseIP("10.0.1.0"), -1).String())
+	assert.Equal(t, "10.0.1.255", lastIP(parseCIDR(t, "10.0.1.0/24")).String())
+}
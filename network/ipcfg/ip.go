@@ -17,12 +17,20 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 const (
 	ipv4Forwarding = "/proc/sys/net/ipv4/conf/%s/forwarding"
 	ipv4ProxyARP   = "/proc/sys/net/ipv4/conf/%s/proxy_arp"
+	ipv6Forwarding = "/proc/sys/net/ipv6/conf/%s/forwarding"
+	ipv6AcceptRA   = "/proc/sys/net/ipv6/conf/%s/accept_ra"
+	ipv6AcceptDAD  = "/proc/sys/net/ipv6/conf/%s/accept_dad"
+	ipv6Disable    = "/proc/sys/net/ipv6/conf/%s/disable_ipv6"
+
+	sysctlDir = "/proc/sys"
 )
 
 // SetIPv4Forwarding sets the IPv4 forwarding property of an interface to the given value.
@@ -35,10 +43,49 @@ func SetIPv4ProxyARP(ifName string, value int) error {
 	return set(fmt.Sprintf(ipv4ProxyARP, ifName), value)
 }
 
+// SetIPv6Forwarding sets the IPv6 forwarding property of an interface to the given value.
+func SetIPv6Forwarding(ifName string, value int) error {
+	return set(fmt.Sprintf(ipv6Forwarding, ifName), value)
+}
+
+// SetIPv6AcceptRA sets the IPv6 router advertisement acceptance property of an interface to the
+// given value.
+func SetIPv6AcceptRA(ifName string, value int) error {
+	return set(fmt.Sprintf(ipv6AcceptRA, ifName), value)
+}
+
+// SetIPv6AcceptDAD sets the IPv6 duplicate address detection property of an interface to the
+// given value.
+func SetIPv6AcceptDAD(ifName string, value int) error {
+	return set(fmt.Sprintf(ipv6AcceptDAD, ifName), value)
+}
+
+// SetIPv6Disable sets the IPv6 disable property of an interface to the given value.
+func SetIPv6Disable(ifName string, value int) error {
+	return set(fmt.Sprintf(ipv6Disable, ifName), value)
+}
+
 // Set sets a system variable to the given value.
+// SetSysctl sets the kernel parameter with the given key, e.g. "net.ipv4.tcp_keepalive_time",
+// to the given value in the current network namespace.
+func SetSysctl(key string, value string) error {
+	return setString(SysctlPath(key), value)
+}
+
+// SysctlPath returns the path of the kernel parameter with the given key. As with sysctl(8),
+// keys containing slashes use slashes as separators, e.g. for interface names containing dots.
+func SysctlPath(key string) string {
+	if strings.Contains(key, "/") {
+		return filepath.Join(sysctlDir, key)
+	}
+	return filepath.Join(sysctlDir, strings.Replace(key, ".", "/", -1))
+}
+
 func set(name string, value int) error {
-	valueStr := strconv.Itoa(value)
+	return setString(name, strconv.Itoa(value))
+}
 
+func setString(name string, valueStr string) error {
 	// Do not rewrite if the value is already set.
 	currValue, err := ioutil.ReadFile(name)
 	if err == nil && bytes.Equal(bytes.TrimSpace(currValue), []byte(valueStr)) {
@@ -0,0 +1,26 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipcfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSysctlPath tests the conversion of kernel parameter keys to paths.
+func TestSysctlPath(t *testing.T) {
+	assert.Equal(t, "/proc/sys/net/ipv4/tcp_keepalive_time", SysctlPath("net.ipv4.tcp_keepalive_time"))
+	assert.Equal(t, "/proc/sys/net/ipv4/conf/eth0.100/rp_filter", SysctlPath("net/ipv4/conf/eth0.100/rp_filter"))
+}
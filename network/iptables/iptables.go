@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
 )
 
 const (
@@ -158,28 +160,9 @@ func (s *Session) Serialize() string {
 
 // Commit loads all rules in this session atomically to iptables.
 func (s *Session) Commit(stdout io.Writer) error {
-	var stderr bytes.Buffer
-
 	// Pass the serialized session state via stdin.
-	cmd := exec.Cmd{
-		Path:   s.restorePath,
-		Args:   nil,
-		Stdin:  bytes.NewBufferString(s.Serialize()),
-		Stdout: stdout,
-		Stderr: &stderr,
-	}
-
-	// Execute the restore command.
-	if err := cmd.Run(); err != nil {
-		switch e := err.(type) {
-		case *exec.ExitError:
-			return fmt.Errorf("%v %v %v", *e, cmd, stderr.String())
-		default:
-			return err
-		}
-	}
-
-	return nil
+	_, err := command.RunWithOutput(bytes.NewBufferString(s.Serialize()), stdout, s.restorePath)
+	return err
 }
 
 // NewChain creates a new Chain object.
@@ -0,0 +1,131 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package lb programs node-local service load balancing from virtual IP addresses to backends.
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Protocols.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// Service is a service reachable at a virtual IP address and port, load balanced to backends.
+type Service struct {
+	VIP      net.IP    `json:"vip"`
+	Port     uint16    `json:"port"`
+	Protocol string    `json:"protocol,omitempty"`
+	Backends []Backend `json:"backends"`
+}
+
+// Backend is a service backend.
+type Backend struct {
+	IP   net.IP `json:"ip"`
+	Port uint16 `json:"port"`
+}
+
+// serviceMap is the JSON format of the service mapping file.
+type serviceMap struct {
+	Services []Service `json:"services"`
+}
+
+// Load loads the service mappings from a file.
+func Load(path string) ([]Service, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lb: failed to read service map: %v", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates service mappings.
+func Parse(data []byte) ([]Service, error) {
+	var sm serviceMap
+	err := json.Unmarshal(data, &sm)
+	if err != nil {
+		return nil, fmt.Errorf("lb: failed to parse service map: %v", err)
+	}
+
+	keys := make(map[string]bool)
+	for i := range sm.Services {
+		svc := &sm.Services[i]
+		err = svc.validate()
+		if err != nil {
+			return nil, fmt.Errorf("lb: invalid service %d: %v", i, err)
+		}
+
+		if keys[svc.Key()] {
+			return nil, fmt.Errorf("lb: duplicate service %s", svc.Key())
+		}
+		keys[svc.Key()] = true
+	}
+
+	return sm.Services, nil
+}
+
+// Key returns the protocol, virtual IP address and port that uniquely identify the service.
+func (svc *Service) Key() string {
+	return svc.Protocol + ":" + net.JoinHostPort(svc.VIP.String(), strconv.Itoa(int(svc.Port)))
+}
+
+// validate validates the service and sets the defaults of optional fields.
+func (svc *Service) validate() error {
+	if svc.VIP == nil {
+		return fmt.Errorf("missing vip")
+	}
+	if svc.Port == 0 {
+		return fmt.Errorf("missing port")
+	}
+
+	if svc.Protocol == "" {
+		svc.Protocol = ProtocolTCP
+	}
+	if svc.Protocol != ProtocolTCP && svc.Protocol != ProtocolUDP {
+		return fmt.Errorf("invalid protocol %s", svc.Protocol)
+	}
+
+	for i := range svc.Backends {
+		backend := &svc.Backends[i]
+		if backend.IP == nil {
+			return fmt.Errorf("missing backend ip")
+		}
+		if (backend.IP.To4() == nil) != (svc.VIP.To4() == nil) {
+			return fmt.Errorf("backend %s is not in the same address family as vip", backend.IP)
+		}
+		if backend.Port == 0 {
+			backend.Port = svc.Port
+		}
+	}
+
+	// Order backends so that equal services compare equal.
+	sort.Slice(svc.Backends, func(i, j int) bool {
+		return backend(svc.Backends[i]) < backend(svc.Backends[j])
+	})
+
+	return nil
+}
+
+// backend returns the address and port of a backend.
+func backend(b Backend) string {
+	return net.JoinHostPort(b.IP.String(), strconv.Itoa(int(b.Port)))
+}
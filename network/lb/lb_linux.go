@@ -0,0 +1,305 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package lb
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+
+	log "github.com/cihub/seelog"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// vipLinkName is the name of the dummy link that holds service virtual IP addresses, so
+	// that IPVS receives traffic sent to them. Only IPVS services with a virtual IP address
+	// on this link are managed.
+	vipLinkName = "vpclb0"
+
+	// ipvsadmCommand is the name of the IPVS administration command.
+	ipvsadmCommand = "ipvsadm"
+)
+
+// ipvsServices maps IPVS virtual service specifications (e.g. "-t 10.0.0.1:80") to the
+// sorted real server addresses of each service.
+type ipvsServices map[string][]string
+
+// Sync programs IPVS to load balance the given services, replacing any services programmed
+// before. Traffic is forwarded to backends with IPVS masquerading.
+func Sync(services []Service) error {
+	link, err := findOrCreateVIPLink()
+	if err != nil {
+		log.Errorf("Failed to create VIP link: %v.", err)
+		return err
+	}
+
+	// Find the services programmed before.
+	linkAddrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+
+	var addrs []netlink.Addr
+	managed := make(map[string]bool)
+	for _, addr := range linkAddrs {
+		// Skip the link-local address that the kernel assigns to the link.
+		if addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		addrs = append(addrs, addr)
+		managed[addr.IP.String()] = true
+	}
+
+	output, err := command.Run(ipvsadmCommand, "-S", "-n")
+	if err != nil {
+		log.Errorf("Failed to list IPVS services: %v.", err)
+		return err
+	}
+
+	current := parseIPVSServices(output)
+
+	// Bring the VIP link addresses up to date before programming services.
+	vips := make(map[string]bool)
+	for _, svc := range services {
+		if vips[svc.VIP.String()] {
+			continue
+		}
+		vips[svc.VIP.String()] = true
+
+		if !managed[svc.VIP.String()] {
+			err = netlink.AddrAdd(link, &netlink.Addr{IPNet: hostPrefix(svc.VIP)})
+			if err != nil {
+				log.Errorf("Failed to add VIP %s: %v.", svc.VIP, err)
+				return err
+			}
+		}
+	}
+
+	script := ipvsScript(current, services, managed)
+	if script != "" {
+		log.Debugf("Programming IPVS rules:\n%s", script)
+		_, err = command.RunWithInput(strings.NewReader(script), ipvsadmCommand, "-R")
+		if err != nil {
+			log.Errorf("Failed to program IPVS rules: %v.", err)
+			return err
+		}
+	}
+
+	// Remove VIP link addresses that are no longer used.
+	for _, addr := range addrs {
+		if !vips[addr.IP.String()] {
+			err = netlink.AddrDel(link, &addr)
+			if err != nil {
+				log.Errorf("Failed to delete VIP %s: %v.", addr.IP, err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// findOrCreateVIPLink finds or creates the dummy link that holds virtual IP addresses.
+func findOrCreateVIPLink() (netlink.Link, error) {
+	link, err := netlink.LinkByName(vipLinkName)
+	if err == nil {
+		return link, nil
+	}
+
+	la := netlink.NewLinkAttrs()
+	la.Name = vipLinkName
+	err = netlink.LinkAdd(&netlink.Dummy{LinkAttrs: la})
+	if err != nil {
+		return nil, err
+	}
+
+	link, err = netlink.LinkByName(vipLinkName)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, netlink.LinkSetUp(link)
+}
+
+// ipvsRule is a line of the output of "ipvsadm -S -n", which restores a virtual service or one
+// of its real servers.
+type ipvsRule struct {
+	// Command is -A for virtual services and -a for real servers.
+	Command string
+	// Service is the virtual service specification, the protocol flag and the address.
+	Service string
+	// Real is the address of the real server, if any.
+	Real string
+}
+
+// parseIPVSRule parses a line of the output of "ipvsadm -S -n". Addresses are numeric, so rules
+// with addresses that are not IP address and port pairs are rejected.
+func parseIPVSRule(line string) (*ipvsRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid ipvsadm rule %q", line)
+	}
+
+	rule := &ipvsRule{Command: fields[0], Service: fields[1] + " " + fields[2]}
+	switch rule.Command {
+	case "-A":
+	case "-a":
+		for i := 3; i < len(fields)-1; i++ {
+			if fields[i] == "-r" {
+				rule.Real = fields[i+1]
+			}
+		}
+		if rule.Real == "" {
+			return nil, fmt.Errorf("ipvsadm rule %q has no real server", line)
+		}
+	default:
+		return nil, fmt.Errorf("invalid ipvsadm command in rule %q", line)
+	}
+
+	switch fields[1] {
+	case "-t", "-u":
+	default:
+		return nil, fmt.Errorf("invalid ipvsadm service type in rule %q", line)
+	}
+
+	for _, address := range []string{fields[2], rule.Real} {
+		if address == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid ipvsadm address in rule %q", line)
+		}
+	}
+
+	return rule, nil
+}
+
+// parseIPVSServices parses the output of "ipvsadm -S -n". Rules that are not understood, such as
+// firewall mark services, are skipped and never modified.
+func parseIPVSServices(output string) ipvsServices {
+	services := make(ipvsServices)
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		rule, err := parseIPVSRule(line)
+		if err != nil {
+			log.Debugf("Skipping IPVS rule: %v.", err)
+			continue
+		}
+
+		switch rule.Command {
+		case "-A":
+			if _, ok := services[rule.Service]; !ok {
+				services[rule.Service] = nil
+			}
+		case "-a":
+			services[rule.Service] = append(services[rule.Service], rule.Real)
+		}
+	}
+
+	for _, reals := range services {
+		sort.Strings(reals)
+	}
+
+	return services
+}
+
+// ipvsScript returns the "ipvsadm -R" commands that bring the current IPVS services up to date
+// with the given services. Current services with virtual IP addresses that are not managed are
+// left alone.
+func ipvsScript(current ipvsServices, services []Service, managed map[string]bool) string {
+	var script bytes.Buffer
+	desired := make(map[string]bool)
+
+	for _, svc := range services {
+		spec := ipvsServiceSpec(svc)
+		desired[spec] = true
+
+		reals, exists := current[spec]
+		if !exists {
+			fmt.Fprintf(&script, "-A %s -s rr\n", spec)
+		}
+
+		wanted := make(map[string]bool)
+		for _, b := range svc.Backends {
+			wanted[backend(b)] = true
+		}
+
+		for _, real := range reals {
+			if !wanted[real] {
+				fmt.Fprintf(&script, "-d %s -r %s\n", spec, real)
+			}
+		}
+
+		for _, b := range svc.Backends {
+			if !containsString(reals, backend(b)) {
+				fmt.Fprintf(&script, "-a %s -r %s -m\n", spec, backend(b))
+			}
+		}
+	}
+
+	// Delete managed services that are no longer wanted, in a stable order.
+	var stale []string
+	for spec := range current {
+		if desired[spec] {
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(strings.Fields(spec)[1])
+		if err == nil && managed[host] {
+			stale = append(stale, spec)
+		}
+	}
+
+	sort.Strings(stale)
+	for _, spec := range stale {
+		fmt.Fprintf(&script, "-D %s\n", spec)
+	}
+
+	return script.String()
+}
+
+// ipvsServiceSpec returns the IPVS virtual service specification of a service.
+func ipvsServiceSpec(svc Service) string {
+	flag := "-t"
+	if svc.Protocol == ProtocolUDP {
+		flag = "-u"
+	}
+
+	return flag + " " + net.JoinHostPort(svc.VIP.String(), strconv.Itoa(int(svc.Port)))
+}
+
+// hostPrefix returns the host prefix of an IP address.
+func hostPrefix(ip net.IP) *net.IPNet {
+	if ip.To4() != nil {
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// containsString returns whether a sorted slice contains a string.
+func containsString(sorted []string, s string) bool {
+	i := sort.SearchStrings(sorted, s)
+	return i < len(sorted) && sorted[i] == s
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package lb
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ipvsadmOutput = `-A -t 172.20.0.10:80 -s rr
+-a -t 172.20.0.10:80 -r 10.0.1.7:80 -m -w 1
+-a -t 172.20.0.10:80 -r 10.0.1.5:80 -m -w 1
+-A -u 172.20.0.11:53 -s rr
+-A -t 192.168.0.1:443 -s rr
+-a -t 192.168.0.1:443 -r 10.0.2.5:443 -m -w 1
+-A -t [fd00::a]:80 -s rr
+`
+
+func TestParseIPVSServices(t *testing.T) {
+	assert.Equal(t, ipvsServices{
+		"-t 172.20.0.10:80":  {"10.0.1.5:80", "10.0.1.7:80"},
+		"-u 172.20.0.11:53":  nil,
+		"-t 192.168.0.1:443": {"10.0.2.5:443"},
+		"-t [fd00::a]:80":    nil,
+	}, parseIPVSServices(ipvsadmOutput))
+}
+
+func TestParseIPVSRule(t *testing.T) {
+	rule, err := parseIPVSRule("-a -t [fd00::a]:80 -r [fd00::5]:80 -m -w 1")
+	require.NoError(t, err)
+	assert.Equal(t, &ipvsRule{Command: "-a", Service: "-t [fd00::a]:80", Real: "[fd00::5]:80"}, rule)
+
+	for _, line := range []string{
+		"-A -f 1 -s rr",
+		"-A -t localhost:80 -s rr",
+		"-a -t 172.20.0.10:80 -m -w 1",
+		"-a -t 172.20.0.10:80 -r 10.0.1.7 -m",
+		"-E -t 172.20.0.10:80",
+		"-A -t",
+	} {
+		_, err = parseIPVSRule(line)
+		assert.Error(t, err, line)
+	}
+}
+
+// TestParseIPVSServicesFuzz tests that parsing arbitrary output assembled from fragments of
+// ipvsadm output never panics and returns only services with valid addresses.
+func TestParseIPVSServicesFuzz(t *testing.T) {
+	fragments := []string{"-A", "-a", "-t", "-u", "-f", "-r", "-s", "rr", " ", "\n", "172.20.0.10",
+		":", "80", "[", "]", "fd00::a", "\x00", "é"}
+
+	f := func(picks []uint8) bool {
+		var output strings.Builder
+		for _, pick := range picks {
+			output.WriteString(fragments[int(pick)%len(fragments)])
+		}
+
+		for spec, reals := range parseIPVSServices(output.String()) {
+			fields := strings.Fields(spec)
+			if len(fields) != 2 {
+				return false
+			}
+			for _, address := range append(reals, fields[1]) {
+				if _, _, err := net.SplitHostPort(address); err != nil {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	assert.NoError(t, quick.Check(f, &quick.Config{MaxCount: 10000}))
+}
+
+func TestIPVSScript(t *testing.T) {
+	services, err := Parse([]byte(`{"services":[
+		{"vip":"172.20.0.10","port":80,"backends":[{"ip":"10.0.1.5"},{"ip":"10.0.1.6"}]},
+		{"vip":"fd00::a","port":80,"backends":[{"ip":"fd00::5"}]}
+	]}`))
+	require.NoError(t, err)
+
+	// 192.168.0.1 is not managed, so its service is left alone.
+	managed := map[string]bool{"172.20.0.10": true, "172.20.0.11": true, "fd00::a": true}
+
+	script := ipvsScript(parseIPVSServices(ipvsadmOutput), services, managed)
+	assert.Equal(t, `-d -t 172.20.0.10:80 -r 10.0.1.7:80
+-a -t 172.20.0.10:80 -r 10.0.1.6:80 -m
+-a -t [fd00::a]:80 -r [fd00::5]:80 -m
+-D -u 172.20.0.11:53
+`, script)
+
+	// Syncing the same services again is a no-op.
+	current := ipvsServices{
+		"-t 172.20.0.10:80": {"10.0.1.5:80", "10.0.1.6:80"},
+		"-t [fd00::a]:80":   {"[fd00::5]:80"},
+	}
+	assert.Empty(t, ipvsScript(current, services, managed))
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package lb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	services, err := Parse([]byte(`{"services":[
+		{"vip":"172.20.0.10","port":80,"backends":[{"ip":"10.0.1.6","port":8080},{"ip":"10.0.1.5"}]}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+
+	svc := services[0]
+	assert.Equal(t, ProtocolTCP, svc.Protocol)
+	assert.Equal(t, "tcp:172.20.0.10:80", svc.Key())
+	assert.Equal(t, "10.0.1.5", svc.Backends[0].IP.String())
+	assert.Equal(t, uint16(80), svc.Backends[0].Port)
+	assert.Equal(t, uint16(8080), svc.Backends[1].Port)
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		sm   string
+	}{
+		{"malformed", `{"services":`},
+		{"missing vip", `{"services":[{"port":80}]}`},
+		{"missing port", `{"services":[{"vip":"172.20.0.10"}]}`},
+		{"invalid protocol", `{"services":[{"vip":"172.20.0.10","port":80,"protocol":"sctp"}]}`},
+		{"missing backend ip", `{"services":[{"vip":"172.20.0.10","port":80,"backends":[{"port":80}]}]}`},
+		{"mixed address families", `{"services":[{"vip":"172.20.0.10","port":80,"backends":[{"ip":"fd00::5"}]}]}`},
+		{"duplicate", `{"services":[{"vip":"172.20.0.10","port":80},{"vip":"172.20.0.10","port":80}]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.sm))
+			assert.Error(t, err)
+		})
+	}
+}
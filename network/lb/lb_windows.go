@@ -0,0 +1,168 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	"github.com/Microsoft/hcsshim"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// stateName is the name of the state directory of the load balancer.
+	stateName = "vpc-lb"
+	// stateFileName is the name of the file recording the HNS policy lists programmed.
+	stateFileName = "services.json"
+)
+
+// hnsProtocols maps protocols to HNS protocol numbers.
+var hnsProtocols = map[string]uint16{
+	ProtocolTCP: 6,
+	ProtocolUDP: 17,
+}
+
+// dsrELBPolicy is an HNS load balancer policy with direct server return, which is not modeled
+// by hcsshim.
+type dsrELBPolicy struct {
+	hcsshim.ELBPolicy
+	DSR bool `json:"IsDSR,omitempty"`
+}
+
+// programmedService is a service programmed as an HNS policy list.
+type programmedService struct {
+	PolicyListID string
+	Service      Service
+	EndpointIDs  []string
+}
+
+// Sync programs HNS load balancer policies with direct server return for the given services,
+// replacing any services programmed before. Backends are matched to the HNS endpoints that
+// have their IP addresses; backends without endpoints are skipped until they appear.
+func Sync(services []Service) error {
+	endpoints, err := hcsshim.HNSListEndpointRequest()
+	if err != nil {
+		log.Errorf("Failed to list HNS endpoints: %v.", err)
+		return err
+	}
+
+	endpointIDs := make(map[string]string)
+	for _, ep := range endpoints {
+		if ep.IPAddress != nil {
+			endpointIDs[ep.IPAddress.String()] = ep.Id
+		}
+	}
+
+	programmed := make(map[string]programmedService)
+	path := filepath.Join(state.GetDir(stateName), stateFileName)
+
+	return state.UpdateJSONFile(path, &programmed, func() error {
+		desired := make(map[string]programmedService)
+		for _, svc := range services {
+			ps := programmedService{Service: svc}
+			for _, b := range svc.Backends {
+				if id, ok := endpointIDs[b.IP.String()]; ok {
+					ps.EndpointIDs = append(ps.EndpointIDs, id)
+				}
+			}
+			desired[svc.Key()] = ps
+		}
+
+		// Delete policy lists of services that changed or are no longer wanted.
+		for key, ps := range programmed {
+			want, ok := desired[key]
+			if ok && reflect.DeepEqual(want.Service, ps.Service) &&
+				reflect.DeepEqual(want.EndpointIDs, ps.EndpointIDs) {
+				continue
+			}
+
+			log.Infof("Deleting HNS policy list %s for service %s.", ps.PolicyListID, key)
+			_, err := (&hcsshim.PolicyList{ID: ps.PolicyListID}).Delete()
+			if err != nil {
+				// The policy list is gone if HNS was reset.
+				log.Errorf("Failed to delete HNS policy list %s, ignoring: %v.", ps.PolicyListID, err)
+			}
+			delete(programmed, key)
+		}
+
+		// Create policy lists of new services.
+		for key, ps := range desired {
+			if _, ok := programmed[key]; ok || len(ps.EndpointIDs) == 0 {
+				continue
+			}
+
+			policyList, err := newPolicyList(&ps)
+			if err != nil {
+				log.Errorf("Failed to build HNS policy list for service %s: %v.", key, err)
+				return err
+			}
+
+			policyList, err = policyList.Create()
+			if err != nil {
+				log.Errorf("Failed to create HNS policy list for service %s: %v.", key, err)
+				return err
+			}
+
+			log.Infof("Created HNS policy list %s for service %s.", policyList.ID, key)
+			ps.PolicyListID = policyList.ID
+			programmed[key] = ps
+		}
+
+		return nil
+	})
+}
+
+// newPolicyList returns the HNS policy list that load balances a service.
+func newPolicyList(ps *programmedService) (*hcsshim.PolicyList, error) {
+	svc := &ps.Service
+
+	// HNS load balancers translate to a single backend port.
+	port := svc.Backends[0].Port
+	for _, b := range svc.Backends {
+		if b.Port != port {
+			return nil, fmt.Errorf("lb: backends of service %s have different ports", svc.Key())
+		}
+	}
+
+	policy := dsrELBPolicy{
+		ELBPolicy: hcsshim.ELBPolicy{
+			LBPolicy: hcsshim.LBPolicy{
+				Policy:       hcsshim.Policy{Type: hcsshim.ExternalLoadBalancer},
+				Protocol:     hnsProtocols[svc.Protocol],
+				InternalPort: port,
+				ExternalPort: svc.Port,
+			},
+			VIPs: []string{svc.VIP.String()},
+			ILB:  true,
+		},
+		DSR: true,
+	}
+
+	buf, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	policyList := &hcsshim.PolicyList{Policies: []json.RawMessage{buf}}
+	for _, id := range ps.EndpointIDs {
+		policyList.EndpointReferences = append(policyList.EndpointReferences, "/endpoints/"+id)
+	}
+
+	return policyList, nil
+}
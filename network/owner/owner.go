@@ -0,0 +1,100 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package owner identifies the CNI stack that owns the resources created by the plugins, so
+// that multiple CNI stacks on a node do not delete or garbage collect each other's resources.
+package owner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// nameSeparator separates the owner ID suffix in resource names. It is not valid in
+	// container IDs or network names.
+	nameSeparator = "@"
+
+	// aliasPrefix is the prefix of the link aliases that record the owner of Linux links,
+	// whose names are too short for a suffix.
+	aliasPrefix = "vpc-cni-owner:"
+)
+
+var (
+	// idRegexp matches valid owner IDs.
+	idRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,15}$`)
+)
+
+// Validate returns an error if the given owner ID is invalid. The empty ID identifies
+// resources without an owner.
+func Validate(id string) error {
+	if id != "" && !idRegexp.MatchString(id) {
+		return fmt.Errorf("invalid ownerID %s, must be up to 16 lowercase letters, digits or dashes", id)
+	}
+	return nil
+}
+
+// NameSuffix returns the suffix appended to resource names of the given owner.
+func NameSuffix(id string) string {
+	if id == "" {
+		return ""
+	}
+	return nameSeparator + id
+}
+
+// SplitName splits a resource name into the base name and the owner ID.
+func SplitName(name string) (string, string) {
+	i := strings.LastIndex(name, nameSeparator)
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+len(nameSeparator):]
+}
+
+// Alias returns the link alias that records the given owner. The alias also stamps the link
+// as created by the plugins, including for the empty owner ID.
+func Alias(id string) string {
+	return aliasPrefix + id
+}
+
+// IsStamped returns whether the given link alias stamps the link as created by the plugins.
+func IsStamped(alias string) bool {
+	return strings.HasPrefix(alias, aliasPrefix)
+}
+
+// FromAlias returns the owner ID recorded in the given link alias.
+func FromAlias(alias string) string {
+	if !strings.HasPrefix(alias, aliasPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(alias, aliasPrefix)
+}
+
+// Check returns an error if the named resource is not owned by the given owner.
+func Check(resource string, resourceOwner string, id string) error {
+	if resourceOwner != id {
+		return fmt.Errorf("%s is owned by %q, not %q", resource, resourceOwner, id)
+	}
+	return nil
+}
+
+// CheckStamp returns an error if the named resource is about to be deleted but was not stamped
+// by the plugins, unless the deletion is forced. This protects the resources of coexisting CNI
+// plugins that happen to have the same names.
+func CheckStamp(resource string, stamped bool, force bool) error {
+	if !stamped && !force {
+		return fmt.Errorf("%s is not stamped by this plugin, refusing to delete it without force", resource)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package owner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"", "ecs", "eks-1", "0123456789abcdef"} {
+		assert.NoError(t, Validate(id), id)
+	}
+	for _, id := range []string{"ECS", "-ecs", "e@cs", "0123456789abcdefg"} {
+		assert.Error(t, Validate(id), id)
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	base, id := SplitName("cid-0123" + NameSuffix("ecs"))
+	assert.Equal(t, "cid-0123", base)
+	assert.Equal(t, "ecs", id)
+
+	base, id = SplitName("cid-0123" + NameSuffix(""))
+	assert.Equal(t, "cid-0123", base)
+	assert.Equal(t, "", id)
+}
+
+func TestAlias(t *testing.T) {
+	assert.Equal(t, "ecs", FromAlias(Alias("ecs")))
+	assert.Equal(t, "", FromAlias(Alias("")))
+	assert.Equal(t, "", FromAlias("uplink"))
+
+	assert.True(t, IsStamped(Alias("ecs")))
+	assert.True(t, IsStamped(Alias("")))
+	assert.False(t, IsStamped("uplink"))
+	assert.False(t, IsStamped(""))
+}
+
+func TestCheckStamp(t *testing.T) {
+	assert.NoError(t, CheckStamp("link veth0", true, false))
+	assert.NoError(t, CheckStamp("link veth0", false, true))
+	assert.Error(t, CheckStamp("link veth0", false, false))
+}
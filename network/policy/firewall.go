@@ -0,0 +1,59 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/network/firewall"
+)
+
+// firewallProtocols maps policy protocols to Windows Defender Firewall protocols.
+var firewallProtocols = map[string]string{
+	ProtocolAll:  firewall.ProtocolAny,
+	ProtocolTCP:  firewall.ProtocolTCP,
+	ProtocolUDP:  firewall.ProtocolUDP,
+	ProtocolICMP: firewall.ProtocolICMPv4,
+}
+
+// FirewallRules returns the Windows Defender Firewall rules scoped to the given interface that
+// implement the policy rules. Block rules take precedence over allow rules in the firewall,
+// regardless of the order of the policy rules.
+func FirewallRules(rules []Rule, interfaceAlias string) []firewall.Rule {
+	fwRules := make([]firewall.Rule, 0, len(rules))
+
+	for _, rule := range rules {
+		fwRule := firewall.Rule{
+			Direction:       firewall.DirectionInbound,
+			Action:          firewall.ActionAllow,
+			Protocol:        firewallProtocols[rule.Protocol],
+			RemoteAddresses: rule.CIDRs,
+			InterfaceAlias:  interfaceAlias,
+		}
+
+		if rule.Action == ActionDeny {
+			fwRule.Action = firewall.ActionBlock
+		}
+
+		// Ingress rules match task ports and egress rules match remote ports.
+		if rule.Direction == DirectionEgress {
+			fwRule.Direction = firewall.DirectionOutbound
+			fwRule.RemotePorts = rule.Ports
+		} else {
+			fwRule.LocalPorts = rule.Ports
+		}
+
+		fwRules = append(fwRules, fwRule)
+	}
+
+	return fwRules
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package policy enforces simple allow/deny network policy documents on task endpoints.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Policy actions.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// Traffic directions relative to the task.
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+// Protocols.
+const (
+	ProtocolAll  = "all"
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+)
+
+// Document is a network policy document. Rules are evaluated in order, and traffic that matches
+// no rule is subject to the default action.
+type Document struct {
+	DefaultAction string `json:"defaultAction,omitempty"`
+	Rules         []Rule `json:"rules"`
+}
+
+// Rule is a single allow or deny rule.
+type Rule struct {
+	// Action is allow or deny.
+	Action string `json:"action"`
+	// Direction is ingress or egress.
+	Direction string `json:"direction"`
+	// Protocol is tcp, udp, icmp or all. Defaults to all.
+	Protocol string `json:"protocol,omitempty"`
+	// CIDRs are the remote address blocks that the rule matches. Matches all if empty.
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Ports are the task ports for ingress or remote ports for egress that the rule matches,
+	// as single ports or ranges such as "8000-8080". Matches all if empty.
+	Ports []string `json:"ports,omitempty"`
+}
+
+// Load loads a policy document given inline or in a file. It returns nil if neither is given.
+func Load(inline json.RawMessage, path string) (*Document, error) {
+	if len(inline) != 0 && path != "" {
+		return nil, fmt.Errorf("policy: both inline policy and policy file specified")
+	}
+
+	data := []byte(inline)
+	if path != "" {
+		var err error
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("policy: failed to read policy file: %v", err)
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates a policy document.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("policy: failed to parse policy document: %v", err)
+	}
+
+	err = doc.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// ParseRules parses and validates a list of rules given outside of a policy document.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	err := json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("policy: failed to parse rules: %v", err)
+	}
+
+	for i := range rules {
+		err = rules[i].validate()
+		if err != nil {
+			return nil, fmt.Errorf("policy: invalid rule %d: %v", i, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// validate validates the document and sets the defaults of optional fields.
+func (doc *Document) validate() error {
+	if doc.DefaultAction == "" {
+		doc.DefaultAction = ActionAllow
+	}
+	if doc.DefaultAction != ActionAllow && doc.DefaultAction != ActionDeny {
+		return fmt.Errorf("policy: invalid defaultAction %s", doc.DefaultAction)
+	}
+
+	for i := range doc.Rules {
+		err := doc.Rules[i].validate()
+		if err != nil {
+			return fmt.Errorf("policy: invalid rule %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validate validates the rule and sets the defaults of optional fields.
+func (rule *Rule) validate() error {
+	if rule.Action != ActionAllow && rule.Action != ActionDeny {
+		return fmt.Errorf("invalid action %s", rule.Action)
+	}
+
+	if rule.Direction != DirectionIngress && rule.Direction != DirectionEgress {
+		return fmt.Errorf("invalid direction %s", rule.Direction)
+	}
+
+	if rule.Protocol == "" {
+		rule.Protocol = ProtocolAll
+	}
+
+	switch rule.Protocol {
+	case ProtocolAll, ProtocolICMP:
+		if len(rule.Ports) != 0 {
+			return fmt.Errorf("ports are not supported for protocol %s", rule.Protocol)
+		}
+	case ProtocolTCP, ProtocolUDP:
+	default:
+		return fmt.Errorf("invalid protocol %s", rule.Protocol)
+	}
+
+	for i, cidr := range rule.CIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %s", cidr)
+		}
+		rule.CIDRs[i] = ipNet.String()
+	}
+
+	for _, port := range rule.Ports {
+		_, _, err := parsePortRange(port)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parsePortRange parses a single port or a port range.
+func parsePortRange(s string) (uint16, uint16, error) {
+	parts := strings.SplitN(s, "-", 2)
+
+	first, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || first == 0 {
+		return 0, 0, fmt.Errorf("invalid port %s", s)
+	}
+
+	last := first
+	if len(parts) == 2 {
+		last, err = strconv.ParseUint(parts[1], 10, 16)
+		if err != nil || last < first {
+			return 0, 0, fmt.Errorf("invalid port range %s", s)
+		}
+	}
+
+	return uint16(first), uint16(last), nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+
+	log "github.com/cihub/seelog"
+	"github.com/coreos/go-iptables/iptables"
+)
+
+const (
+	// filterTable is the iptables table that policy chains are in.
+	filterTable = "filter"
+
+	// ipsetCommand is the name of the ipset command.
+	ipsetCommand = "ipset"
+)
+
+// Apply enforces the policy document in the current network namespace, replacing any policy
+// enforced before. It is idempotent.
+func Apply(doc *Document) error {
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := iptables.NewWithProtocol(proto)
+		if err != nil {
+			return err
+		}
+
+		compiled := compile(doc, proto == iptables.ProtocolIPv6)
+
+		for name, cidrs := range compiled.ipsets {
+			err = applyIPSet(name, cidrs, proto == iptables.ProtocolIPv6)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, chain := range []string{ingressChain, egressChain} {
+			// ClearChain creates the chain if it does not exist.
+			err = ipt.ClearChain(filterTable, chain)
+			if err != nil {
+				return err
+			}
+
+			for _, rule := range compiled.chains[chain] {
+				err = ipt.Append(filterTable, chain, rule...)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = ipt.AppendUnique(filterTable, "INPUT", "-j", ingressChain)
+		if err != nil {
+			return err
+		}
+
+		err = ipt.AppendUnique(filterTable, "OUTPUT", "-j", egressChain)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check verifies that the policy enforced in the current network namespace matches the policy
+// document. It returns an error describing the first difference found.
+func Check(doc *Document) error {
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := iptables.NewWithProtocol(proto)
+		if err != nil {
+			return err
+		}
+
+		compiled := compile(doc, proto == iptables.ProtocolIPv6)
+
+		for name, cidrs := range compiled.ipsets {
+			members, err := listIPSet(name)
+			if err != nil {
+				return err
+			}
+
+			expected := append([]string(nil), cidrs...)
+			sort.Strings(expected)
+			if strings.Join(members, ",") != strings.Join(expected, ",") {
+				return fmt.Errorf("policy: ipset %s has members %v, expected %v", name, members, expected)
+			}
+		}
+
+		for _, chain := range []string{ingressChain, egressChain} {
+			// The listing starts with the chain declaration.
+			rules, err := ipt.List(filterTable, chain)
+			if err != nil {
+				return fmt.Errorf("policy: failed to list chain %s: %v", chain, err)
+			}
+
+			if len(rules)-1 != len(compiled.chains[chain]) {
+				return fmt.Errorf("policy: chain %s has %d rules, expected %d",
+					chain, len(rules)-1, len(compiled.chains[chain]))
+			}
+
+			for _, rule := range compiled.chains[chain] {
+				exists, err := ipt.Exists(filterTable, chain, rule...)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return fmt.Errorf("policy: chain %s is missing rule %v", chain, rule)
+				}
+			}
+		}
+
+		for parent, chain := range map[string]string{"INPUT": ingressChain, "OUTPUT": egressChain} {
+			exists, err := ipt.Exists(filterTable, parent, "-j", chain)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("policy: chain %s is missing jump to %s", parent, chain)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reconcile checks the policy enforced in the current network namespace, and applies the policy
+// document again if it has drifted.
+func Reconcile(doc *Document) error {
+	err := Check(doc)
+	if err == nil {
+		return nil
+	}
+
+	log.Infof("Enforced policy has drifted, reapplying: %v.", err)
+	return Apply(doc)
+}
+
+// Remove removes the policy enforced in the current network namespace.
+func Remove() error {
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := iptables.NewWithProtocol(proto)
+		if err != nil {
+			return err
+		}
+
+		for parent, chain := range map[string]string{"INPUT": ingressChain, "OUTPUT": egressChain} {
+			exists, err := ipt.Exists(filterTable, parent, "-j", chain)
+			if err == nil && exists {
+				err = ipt.Delete(filterTable, parent, "-j", chain)
+				if err != nil {
+					return err
+				}
+			}
+
+			// ClearChain creates the chain if it does not exist, so it can always be deleted.
+			err = ipt.ClearChain(filterTable, chain)
+			if err != nil {
+				return err
+			}
+
+			err = ipt.DeleteChain(filterTable, chain)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Destroy the ipsets, which are no longer referenced by any rule.
+	sets, err := command.Run(ipsetCommand, "list", "-name")
+	if err != nil {
+		// ipset is not installed, so no ipsets were created.
+		return nil
+	}
+
+	for _, name := range strings.Fields(sets) {
+		if strings.HasPrefix(name, strings.SplitN(ipsetNameFormat, "%", 2)[0]) {
+			_, err = command.Run(ipsetCommand, "destroy", name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyIPSet creates or updates an ipset with the given member CIDRs.
+func applyIPSet(name string, cidrs []string, ipv6 bool) error {
+	family := "inet"
+	if ipv6 {
+		family = "inet6"
+	}
+
+	_, err := command.Run(ipsetCommand, "create", name, "hash:net", "family", family, "-exist")
+	if err != nil {
+		return err
+	}
+
+	_, err = command.Run(ipsetCommand, "flush", name)
+	if err != nil {
+		return err
+	}
+
+	for _, cidr := range cidrs {
+		_, err = command.Run(ipsetCommand, "add", name, cidr, "-exist")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listIPSet returns the sorted members of an ipset.
+func listIPSet(name string) ([]string, error) {
+	output, err := command.Run(ipsetCommand, "save", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIPSetMembers(output, name)
+}
+
+// ipsetSaveLine is a line of the output of "ipset save", which restores a set or its members.
+type ipsetSaveLine struct {
+	Command string
+	Set     string
+	Args    []string
+}
+
+// parseIPSetSaveLine parses a line of the output of "ipset save".
+func parseIPSetSaveLine(line string) (*ipsetSaveLine, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("policy: invalid ipset save line %q", line)
+	}
+
+	return &ipsetSaveLine{Command: fields[0], Set: fields[1], Args: fields[2:]}, nil
+}
+
+// parseIPSetMembers parses the sorted member CIDRs of an ipset from the output of "ipset save",
+// which is meant to be read back by ipset and, unlike "ipset list", does not change between
+// versions. Host addresses are listed without a prefix length.
+func parseIPSetMembers(output string, name string) ([]string, error) {
+	var members []string
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		saveLine, err := parseIPSetSaveLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if saveLine.Set != name || saveLine.Command != "add" {
+			continue
+		}
+		if len(saveLine.Args) == 0 {
+			return nil, fmt.Errorf("policy: ipset %s has a member without address", name)
+		}
+
+		member := saveLine.Args[0]
+		if !strings.Contains(member, "/") {
+			ip := net.ParseIP(member)
+			if ip == nil {
+				return nil, fmt.Errorf("policy: ipset %s has invalid member %q", name, member)
+			}
+			if ip.To4() != nil {
+				member += "/32"
+			} else {
+				member += "/128"
+			}
+		}
+
+		_, cidr, err := net.ParseCIDR(member)
+		if err != nil {
+			return nil, fmt.Errorf("policy: ipset %s has invalid member %q", name, member)
+		}
+		members = append(members, cidr.String())
+	}
+
+	sort.Strings(members)
+	return members, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package policy
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ipsetSaveOutput = `create vpcpol-e3-v4 hash:net family inet hashsize 1024 maxelem 65536
+add vpcpol-e3-v4 172.16.0.0/12
+add vpcpol-e3-v4 10.0.0.2
+add vpcpol-e3-v6 fd00::1
+add vpcpol-e3-v4 10.0.0.0/16 timeout 0
+`
+
+func TestParseIPSetMembers(t *testing.T) {
+	members, err := parseIPSetMembers(ipsetSaveOutput, "vpcpol-e3-v4")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/16", "10.0.0.2/32", "172.16.0.0/12"}, members)
+
+	members, err = parseIPSetMembers(ipsetSaveOutput, "vpcpol-e3-v6")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fd00::1/128"}, members)
+
+	for _, output := range []string{
+		"add vpcpol-e3-v4\n",
+		"add vpcpol-e3-v4 10.0.0.256\n",
+		"add vpcpol-e3-v4 10.0.0.0/33\n",
+		"vpcpol-e3-v4\n",
+	} {
+		_, err = parseIPSetMembers(output, "vpcpol-e3-v4")
+		assert.Error(t, err, output)
+	}
+}
+
+// TestParseIPSetMembersFuzz tests that parsing arbitrary output assembled from fragments of
+// ipset output never panics and returns only valid CIDRs.
+func TestParseIPSetMembersFuzz(t *testing.T) {
+	fragments := []string{"add", "create", "vpcpol-e3-v4", " ", "\t", "\n", "10.0.0.1", "/", "24",
+		"fd00::", "::", ".", "hash:net", "-", "\x00", "é", "999"}
+
+	f := func(picks []uint8) bool {
+		var output strings.Builder
+		for _, pick := range picks {
+			output.WriteString(fragments[int(pick)%len(fragments)])
+		}
+
+		members, err := parseIPSetMembers(output.String(), "vpcpol-e3-v4")
+		if err != nil {
+			return members == nil
+		}
+		for _, member := range members {
+			if _, _, err := net.ParseCIDR(member); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	assert.NoError(t, quick.Check(f, &quick.Config{MaxCount: 10000}))
+}
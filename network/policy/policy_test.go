@@ -0,0 +1,120 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/firewall"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSetsDefaults(t *testing.T) {
+	doc, err := Parse([]byte(`{"rules":[{"action":"allow","direction":"ingress","cidrs":["10.0.1.5/16"]}]}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, ActionAllow, doc.DefaultAction)
+	assert.Equal(t, ProtocolAll, doc.Rules[0].Protocol)
+	assert.Equal(t, []string{"10.0.0.0/16"}, doc.Rules[0].CIDRs)
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		doc  string
+	}{
+		{"malformed", `{"rules":`},
+		{"invalid default action", `{"defaultAction":"reject"}`},
+		{"invalid action", `{"rules":[{"action":"reject","direction":"ingress"}]}`},
+		{"invalid direction", `{"rules":[{"action":"allow","direction":"inbound"}]}`},
+		{"invalid protocol", `{"rules":[{"action":"allow","direction":"ingress","protocol":"sctp"}]}`},
+		{"ports without protocol", `{"rules":[{"action":"allow","direction":"ingress","ports":["80"]}]}`},
+		{"invalid CIDR", `{"rules":[{"action":"allow","direction":"egress","cidrs":["10.0.0.0"]}]}`},
+		{"invalid port", `{"rules":[{"action":"allow","direction":"egress","protocol":"tcp","ports":["0"]}]}`},
+		{"invalid port range", `{"rules":[{"action":"allow","direction":"egress","protocol":"tcp","ports":["90-80"]}]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.doc))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"defaultAction":"deny"}`), 0644))
+
+	doc, err := Load(nil, "")
+	assert.NoError(t, err)
+	assert.Nil(t, doc)
+
+	doc, err = Load(nil, path)
+	require.NoError(t, err)
+	assert.Equal(t, ActionDeny, doc.DefaultAction)
+
+	_, err = Load([]byte(`{}`), path)
+	assert.Error(t, err)
+
+	_, err = Load(nil, filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`[{"action":"deny","direction":"egress","cidrs":["10.0.1.5/16"]}]`))
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, ProtocolAll, rules[0].Protocol)
+	assert.Equal(t, []string{"10.0.0.0/16"}, rules[0].CIDRs)
+
+	_, err = ParseRules([]byte(`[{"action":"deny","direction":"sideways"}]`))
+	assert.Error(t, err)
+}
+
+func TestFirewallRules(t *testing.T) {
+	rules := []Rule{
+		{Action: ActionAllow, Direction: DirectionIngress, Protocol: ProtocolTCP, Ports: []string{"80"}},
+		{Action: ActionDeny, Direction: DirectionEgress, Protocol: ProtocolUDP, Ports: []string{"53"},
+			CIDRs: []string{"10.0.0.0/16"}},
+	}
+
+	fwRules := FirewallRules(rules, "vEthernet (cid-1)")
+	require.Len(t, fwRules, 2)
+
+	assert.Equal(t, firewall.Rule{
+		Direction:      firewall.DirectionInbound,
+		Action:         firewall.ActionAllow,
+		Protocol:       firewall.ProtocolTCP,
+		LocalPorts:     []string{"80"},
+		InterfaceAlias: "vEthernet (cid-1)",
+	}, fwRules[0])
+	assert.Equal(t, firewall.Rule{
+		Direction:       firewall.DirectionOutbound,
+		Action:          firewall.ActionBlock,
+		Protocol:        firewall.ProtocolUDP,
+		RemotePorts:     []string{"53"},
+		RemoteAddresses: []string{"10.0.0.0/16"},
+		InterfaceAlias:  "vEthernet (cid-1)",
+	}, fwRules[1])
+}
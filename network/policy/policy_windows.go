@@ -0,0 +1,85 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"strings"
+
+	"github.com/Microsoft/hcsshim"
+)
+
+const (
+	// rulePriorityBase is the HNS ACL priority of the first policy rule. Rules with lower
+	// priority values take precedence.
+	rulePriorityBase = 100
+	// defaultRulePriority is the HNS ACL priority of the rules implementing the default action.
+	defaultRulePriority = 65000
+)
+
+// hnsProtocols maps policy protocols to HNS ACL protocol numbers.
+var hnsProtocols = map[string]string{
+	ProtocolAll:  "",
+	ProtocolTCP:  "6",
+	ProtocolUDP:  "17",
+	ProtocolICMP: "1",
+}
+
+// ACLPolicies returns the HNS endpoint ACL policies that enforce the policy document.
+// HNS blocks traffic that matches no ACL, so rules for the default action are always included.
+func ACLPolicies(doc *Document) []hcsshim.ACLPolicy {
+	policies := make([]hcsshim.ACLPolicy, 0, len(doc.Rules)+2)
+
+	for i, rule := range doc.Rules {
+		acl := hcsshim.ACLPolicy{
+			Type:            hcsshim.ACL,
+			Protocols:       hnsProtocols[rule.Protocol],
+			Action:          aclAction(rule.Action),
+			Direction:       hcsshim.In,
+			RemoteAddresses: strings.Join(rule.CIDRs, ","),
+			RuleType:        hcsshim.Switch,
+			Priority:        uint16(rulePriorityBase + i),
+		}
+
+		// Ingress rules match task ports and egress rules match remote ports.
+		ports := strings.Join(rule.Ports, ",")
+		if rule.Direction == DirectionEgress {
+			acl.Direction = hcsshim.Out
+			acl.RemotePorts = ports
+		} else {
+			acl.LocalPorts = ports
+		}
+
+		policies = append(policies, acl)
+	}
+
+	for _, direction := range []hcsshim.DirectionType{hcsshim.In, hcsshim.Out} {
+		policies = append(policies, hcsshim.ACLPolicy{
+			Type:      hcsshim.ACL,
+			Action:    aclAction(doc.DefaultAction),
+			Direction: direction,
+			RuleType:  hcsshim.Switch,
+			Priority:  defaultRulePriority,
+		})
+	}
+
+	return policies
+}
+
+// aclAction returns the HNS ACL action for a policy action.
+func aclAction(action string) hcsshim.ActionType {
+	if action == ActionDeny {
+		return hcsshim.Block
+	}
+	return hcsshim.Allow
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// Names of the iptables chains that enforce policies in task network namespaces.
+	ingressChain = "VPC-POLICY-INGRESS"
+	egressChain  = "VPC-POLICY-EGRESS"
+
+	// ipsetNameFormat is the format of the names of ipsets holding the CIDRs of a rule.
+	ipsetNameFormat = "vpcpol-%s%d-v%d"
+)
+
+// compiledPolicy is a policy document compiled to iptables rules and ipsets for an IP family.
+type compiledPolicy struct {
+	// chains maps chain names to their ordered rule specifications.
+	chains map[string][][]string
+	// ipsets maps ipset names to their member CIDRs.
+	ipsets map[string][]string
+}
+
+// compile compiles a policy document to iptables rules for the given IP family. CIDRs of the
+// other family are ignored, and rules that only match CIDRs of the other family are skipped.
+func compile(doc *Document, ipv6 bool) *compiledPolicy {
+	family := 4
+	if ipv6 {
+		family = 6
+	}
+
+	compiled := &compiledPolicy{
+		chains: map[string][][]string{
+			ingressChain: {
+				{"-i", "lo", "-j", "ACCEPT"},
+				{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+			},
+			egressChain: {
+				{"-o", "lo", "-j", "ACCEPT"},
+				{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+			},
+		},
+		ipsets: make(map[string][]string),
+	}
+
+	for i, rule := range doc.Rules {
+		chain, addrFlag, setDir := ingressChain, "-s", "src"
+		if rule.Direction == DirectionEgress {
+			chain, addrFlag, setDir = egressChain, "-d", "dst"
+		}
+
+		var spec []string
+
+		switch rule.Protocol {
+		case ProtocolAll:
+		case ProtocolICMP:
+			if ipv6 {
+				spec = append(spec, "-p", "ipv6-icmp")
+			} else {
+				spec = append(spec, "-p", "icmp")
+			}
+		default:
+			spec = append(spec, "-p", rule.Protocol)
+		}
+
+		cidrs := filterCIDRs(rule.CIDRs, ipv6)
+		if len(rule.CIDRs) != 0 && len(cidrs) == 0 {
+			continue
+		}
+
+		switch len(cidrs) {
+		case 0:
+		case 1:
+			spec = append(spec, addrFlag, cidrs[0])
+		default:
+			name := fmt.Sprintf(ipsetNameFormat, rule.Direction[:1], i, family)
+			compiled.ipsets[name] = cidrs
+			spec = append(spec, "-m", "set", "--match-set", name, setDir)
+		}
+
+		// Ingress rules match task ports and egress rules match remote ports, both of which
+		// are destination ports.
+		ports := make([]string, len(rule.Ports))
+		for j, port := range rule.Ports {
+			ports[j] = strings.Replace(port, "-", ":", 1)
+		}
+
+		switch len(ports) {
+		case 0:
+		case 1:
+			spec = append(spec, "--dport", ports[0])
+		default:
+			spec = append(spec, "-m", "multiport", "--dports", strings.Join(ports, ","))
+		}
+
+		spec = append(spec, "-j", target(rule.Action))
+		compiled.chains[chain] = append(compiled.chains[chain], spec)
+	}
+
+	if doc.DefaultAction == ActionDeny {
+		for _, chain := range []string{ingressChain, egressChain} {
+			compiled.chains[chain] = append(compiled.chains[chain], []string{"-j", "DROP"})
+		}
+	}
+
+	return compiled
+}
+
+// filterCIDRs returns the CIDRs of the given IP family.
+func filterCIDRs(cidrs []string, ipv6 bool) []string {
+	var filtered []string
+	for _, cidr := range cidrs {
+		ip, _, _ := net.ParseCIDR(cidr)
+		if (ip.To4() == nil) == ipv6 {
+			filtered = append(filtered, cidr)
+		}
+	}
+	return filtered
+}
+
+// target returns the iptables target for a policy action.
+func target(action string) string {
+	if action == ActionDeny {
+		return "DROP"
+	}
+	return "ACCEPT"
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile(t *testing.T) {
+	doc, err := Parse([]byte(`{
+		"defaultAction": "deny",
+		"rules": [
+			{"action":"allow","direction":"ingress","protocol":"tcp","ports":["80","8000-8080"]},
+			{"action":"allow","direction":"egress","protocol":"udp","cidrs":["10.0.0.2/32"],"ports":["53"]},
+			{"action":"deny","direction":"egress","cidrs":["169.254.169.254/32","fd00:ec2::254/128"]},
+			{"action":"allow","direction":"egress","protocol":"icmp","cidrs":["10.0.0.0/16","172.16.0.0/12"]}
+		]}`))
+	require.NoError(t, err)
+
+	compiled := compile(doc, false)
+	assert.Equal(t, [][]string{
+		{"-i", "lo", "-j", "ACCEPT"},
+		{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		{"-p", "tcp", "-m", "multiport", "--dports", "80,8000:8080", "-j", "ACCEPT"},
+		{"-j", "DROP"},
+	}, compiled.chains[ingressChain])
+	assert.Equal(t, [][]string{
+		{"-o", "lo", "-j", "ACCEPT"},
+		{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		{"-p", "udp", "-d", "10.0.0.2/32", "--dport", "53", "-j", "ACCEPT"},
+		{"-d", "169.254.169.254/32", "-j", "DROP"},
+		{"-p", "icmp", "-m", "set", "--match-set", "vpcpol-e3-v4", "dst", "-j", "ACCEPT"},
+		{"-j", "DROP"},
+	}, compiled.chains[egressChain])
+	assert.Equal(t, map[string][]string{"vpcpol-e3-v4": {"10.0.0.0/16", "172.16.0.0/12"}}, compiled.ipsets)
+
+	// Rules matching only IPv4 CIDRs are skipped for IPv6.
+	compiled = compile(doc, true)
+	assert.Equal(t, [][]string{
+		{"-o", "lo", "-j", "ACCEPT"},
+		{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		{"-d", "fd00:ec2::254/128", "-j", "DROP"},
+		{"-j", "DROP"},
+	}, compiled.chains[egressChain])
+	assert.Empty(t, compiled.ipsets)
+}
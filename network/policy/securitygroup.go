@@ -0,0 +1,236 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+// SecurityGroup is a security group definition in the shape of the EC2 DescribeSecurityGroups
+// API output, so that existing security group definitions can be enforced on task endpoints.
+type SecurityGroup struct {
+	GroupID             string          `json:"GroupId,omitempty"`
+	IPPermissions       []IPPermission  `json:"IpPermissions"`
+	IPPermissionsEgress *[]IPPermission `json:"IpPermissionsEgress"`
+}
+
+// IPPermission is a security group rule.
+type IPPermission struct {
+	// IPProtocol is tcp, udp, icmp, icmpv6, their protocol numbers, or -1 for all protocols.
+	IPProtocol string `json:"IpProtocol"`
+	// FromPort and ToPort are the port range for tcp and udp. Both are -1 or unset for all ports.
+	FromPort *int `json:"FromPort"`
+	ToPort   *int `json:"ToPort"`
+	// IPRanges, IPv6Ranges and UserIDGroupPairs are the remote addresses that the rule matches.
+	IPRanges         []IPRange         `json:"IpRanges"`
+	IPv6Ranges       []IPv6Range       `json:"Ipv6Ranges"`
+	UserIDGroupPairs []UserIDGroupPair `json:"UserIdGroupPairs"`
+}
+
+// IPRange is an IPv4 address block in a security group rule.
+type IPRange struct {
+	CIDRIP string `json:"CidrIp"`
+}
+
+// IPv6Range is an IPv6 address block in a security group rule.
+type IPv6Range struct {
+	CIDRIPv6 string `json:"CidrIpv6"`
+}
+
+// UserIDGroupPair is a reference to another security group in a security group rule. Since
+// group membership is not known on the node, references are placeholders resolved to the
+// address blocks given for the referenced group.
+type UserIDGroupPair struct {
+	GroupID string `json:"GroupId"`
+}
+
+// securityGroupProtocols maps the security group protocols to policy protocols.
+var securityGroupProtocols = map[string]string{
+	"-1":     ProtocolAll,
+	"all":    ProtocolAll,
+	"tcp":    ProtocolTCP,
+	"6":      ProtocolTCP,
+	"udp":    ProtocolUDP,
+	"17":     ProtocolUDP,
+	"icmp":   ProtocolICMP,
+	"1":      ProtocolICMP,
+	"icmpv6": ProtocolICMP,
+	"58":     ProtocolICMP,
+}
+
+// LoadSecurityGroups loads security group definitions given inline or in a file, and compiles
+// them into a policy document. The group CIDRs map resolves references to other security groups.
+// It returns nil if neither is given.
+func LoadSecurityGroups(inline json.RawMessage, path string, groupCIDRs map[string][]string) (*Document, error) {
+	if len(inline) != 0 && path != "" {
+		return nil, fmt.Errorf("policy: both inline security groups and security groups file specified")
+	}
+
+	data := []byte(inline)
+	if path != "" {
+		var err error
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("policy: failed to read security groups file: %v", err)
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var groups []SecurityGroup
+	err := json.Unmarshal(data, &groups)
+	if err != nil {
+		return nil, fmt.Errorf("policy: failed to parse security groups: %v", err)
+	}
+
+	return CompileSecurityGroups(groups, groupCIDRs)
+}
+
+// CompileSecurityGroups compiles security groups into a policy document with security group
+// semantics: traffic is denied unless a rule of any group allows it. Egress is allowed if no
+// group defines egress rules, matching the default egress rule of new security groups.
+func CompileSecurityGroups(groups []SecurityGroup, groupCIDRs map[string][]string) (*Document, error) {
+	doc := &Document{DefaultAction: ActionDeny}
+	allowAllEgress := true
+
+	for _, group := range groups {
+		rules, err := compilePermissions(group.IPPermissions, DirectionIngress, groupCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("policy: invalid ingress rule in security group %s: %v", group.GroupID, err)
+		}
+		doc.Rules = append(doc.Rules, rules...)
+
+		if group.IPPermissionsEgress == nil {
+			continue
+		}
+		allowAllEgress = false
+
+		rules, err = compilePermissions(*group.IPPermissionsEgress, DirectionEgress, groupCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("policy: invalid egress rule in security group %s: %v", group.GroupID, err)
+		}
+		doc.Rules = append(doc.Rules, rules...)
+	}
+
+	if allowAllEgress {
+		doc.Rules = append(doc.Rules, Rule{
+			Action:    ActionAllow,
+			Direction: DirectionEgress,
+			Protocol:  ProtocolAll,
+		})
+	}
+
+	err := doc.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// compilePermissions compiles security group rules into allow rules in the given direction.
+func compilePermissions(
+	permissions []IPPermission,
+	direction string,
+	groupCIDRs map[string][]string) ([]Rule, error) {
+
+	var rules []Rule
+	for _, perm := range permissions {
+		protocol, ok := securityGroupProtocols[perm.IPProtocol]
+		if !ok {
+			return nil, fmt.Errorf("unsupported protocol %s", perm.IPProtocol)
+		}
+
+		ports, err := compilePortRange(protocol, perm.FromPort, perm.ToPort)
+		if err != nil {
+			return nil, err
+		}
+
+		var cidrs []string
+		for _, r := range perm.IPRanges {
+			cidrs = append(cidrs, r.CIDRIP)
+		}
+		for _, r := range perm.IPv6Ranges {
+			cidrs = append(cidrs, r.CIDRIPv6)
+		}
+		for _, pair := range perm.UserIDGroupPairs {
+			groupCIDR, ok := groupCIDRs[pair.GroupID]
+			if !ok {
+				return nil, fmt.Errorf("no CIDRs for referenced security group %s", pair.GroupID)
+			}
+			cidrs = append(cidrs, groupCIDR...)
+		}
+
+		// Rules without sources match no traffic, whereas policy rules without CIDRs match all.
+		if len(cidrs) == 0 {
+			continue
+		}
+
+		rules = append(rules, Rule{
+			Action:    ActionAllow,
+			Direction: direction,
+			Protocol:  protocol,
+			CIDRs:     cidrs,
+			Ports:     ports,
+		})
+	}
+
+	return rules, nil
+}
+
+// compilePortRange compiles the port range of a security group rule into policy ports.
+// It returns nil for all ports.
+func compilePortRange(protocol string, fromPort *int, toPort *int) ([]string, error) {
+	allPorts := (fromPort == nil || *fromPort == -1) && (toPort == nil || *toPort == -1)
+
+	switch protocol {
+	case ProtocolTCP, ProtocolUDP:
+	default:
+		// ICMP rules use the port range for type and code, which policies do not match.
+		if !allPorts {
+			return nil, fmt.Errorf("ICMP type and code are not supported")
+		}
+		return nil, nil
+	}
+
+	if allPorts {
+		return nil, nil
+	}
+
+	if fromPort == nil || toPort == nil || *fromPort < 0 || *toPort > 65535 || *fromPort > *toPort {
+		return nil, fmt.Errorf("invalid port range")
+	}
+
+	first, last := *fromPort, *toPort
+	if first == 0 {
+		if last == 65535 {
+			return nil, nil
+		}
+		first = 1
+	}
+	if last < first {
+		return nil, fmt.Errorf("invalid port range")
+	}
+
+	if first == last {
+		return []string{strconv.Itoa(first)}, nil
+	}
+
+	return []string{fmt.Sprintf("%d-%d", first, last)}, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecurityGroups = `[{
+	"GroupId": "sg-web",
+	"IpPermissions": [
+		{"IpProtocol": "tcp", "FromPort": 443, "ToPort": 443,
+		 "IpRanges": [{"CidrIp": "0.0.0.0/0"}], "Ipv6Ranges": [{"CidrIpv6": "::/0"}]},
+		{"IpProtocol": "tcp", "FromPort": 8000, "ToPort": 8080,
+		 "UserIdGroupPairs": [{"GroupId": "sg-lb"}]},
+		{"IpProtocol": "-1", "IpRanges": [{"CidrIp": "10.0.5.0/24"}]},
+		{"IpProtocol": "udp", "FromPort": 53, "ToPort": 53}
+	],
+	"IpPermissionsEgress": [
+		{"IpProtocol": "icmp", "FromPort": -1, "ToPort": -1, "IpRanges": [{"CidrIp": "10.0.0.0/16"}]},
+		{"IpProtocol": "17", "FromPort": 0, "ToPort": 65535, "IpRanges": [{"CidrIp": "10.0.0.2/32"}]}
+	]
+}]`
+
+func TestCompileSecurityGroups(t *testing.T) {
+	groupCIDRs := map[string][]string{"sg-lb": {"10.0.1.0/24", "10.0.2.0/24"}}
+
+	doc, err := LoadSecurityGroups([]byte(testSecurityGroups), "", groupCIDRs)
+	require.NoError(t, err)
+
+	assert.Equal(t, ActionDeny, doc.DefaultAction)
+	assert.Equal(t, []Rule{
+		{ActionAllow, DirectionIngress, ProtocolTCP, []string{"0.0.0.0/0", "::/0"}, []string{"443"}},
+		{ActionAllow, DirectionIngress, ProtocolTCP, []string{"10.0.1.0/24", "10.0.2.0/24"}, []string{"8000-8080"}},
+		{ActionAllow, DirectionIngress, ProtocolAll, []string{"10.0.5.0/24"}, nil},
+		{ActionAllow, DirectionEgress, ProtocolICMP, []string{"10.0.0.0/16"}, nil},
+		{ActionAllow, DirectionEgress, ProtocolUDP, []string{"10.0.0.2/32"}, nil},
+	}, doc.Rules)
+}
+
+func TestCompileSecurityGroupsDefaultEgress(t *testing.T) {
+	doc, err := LoadSecurityGroups([]byte(`[{"IpPermissions":[]}]`), "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{{Action: ActionAllow, Direction: DirectionEgress, Protocol: ProtocolAll}}, doc.Rules)
+
+	// Groups with empty egress rules deny all egress.
+	doc, err = LoadSecurityGroups([]byte(`[{"IpPermissions":[], "IpPermissionsEgress":[]}]`), "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, doc.Rules)
+}
+
+func TestCompileSecurityGroupsInvalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		groups string
+	}{
+		{"malformed", `[{"IpPermissions":`},
+		{"unsupported protocol", `[{"IpPermissions":[{"IpProtocol":"sctp","IpRanges":[{"CidrIp":"10.0.0.0/8"}]}]}]`},
+		{"ICMP type", `[{"IpPermissions":[{"IpProtocol":"icmp","FromPort":8,"ToPort":0,"IpRanges":[{"CidrIp":"10.0.0.0/8"}]}]}]`},
+		{"invalid port range", `[{"IpPermissions":[{"IpProtocol":"tcp","FromPort":90,"ToPort":80,"IpRanges":[{"CidrIp":"10.0.0.0/8"}]}]}]`},
+		{"invalid CIDR", `[{"IpPermissions":[{"IpProtocol":"tcp","FromPort":80,"ToPort":80,"IpRanges":[{"CidrIp":"10.0.0.0"}]}]}]`},
+		{"unknown group", `[{"IpPermissions":[{"IpProtocol":"-1","UserIdGroupPairs":[{"GroupId":"sg-x"}]}]}]`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadSecurityGroups([]byte(tc.groups), "", nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadSecurityGroupsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "security-groups.json")
+	err = ioutil.WriteFile(path, []byte(testSecurityGroups), 0600)
+	require.NoError(t, err)
+
+	doc, err := LoadSecurityGroups(nil, path, map[string][]string{"sg-lb": {"10.0.1.0/24"}})
+	require.NoError(t, err)
+	assert.Len(t, doc.Rules, 5)
+
+	_, err = LoadSecurityGroups([]byte(testSecurityGroups), path, nil)
+	assert.Error(t, err)
+
+	doc, err = LoadSecurityGroups(nil, "", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, doc)
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vpc
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	// IP address family modes.
+	// Dual-stack mode places no restriction on address families.
+	IPFamilyDual = "dual"
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+
+	// WellKnownNAT64Prefix is the well-known NAT64 prefix defined by RFC 6052, which the
+	// VPC NAT gateway translates to IPv4.
+	WellKnownNAT64Prefix = "64:ff9b::/96"
+
+	// DNS64ServerAddress is the IPv6 address of the Amazon-provided DNS server, which
+	// synthesizes AAAA records with the NAT64 prefix when DNS64 is enabled on the subnet.
+	DNS64ServerAddress = "fd00:ec2::253"
+
+	// InstanceMetadataEndpointIPv6 is EC2's instance metadata endpoint on IPv6-only instances.
+	InstanceMetadataEndpointIPv6 = "fd00:ec2::254/128"
+)
+
+// IsIPv4 returns whether the given IP address is an IPv4 address.
+func IsIPv4(ipAddress net.IP) bool {
+	return ipAddress.To4() != nil
+}
+
+// GetIPVersion returns the CNI IP version string of the given IP address.
+func GetIPVersion(ipAddress net.IP) string {
+	if IsIPv4(ipAddress) {
+		return "4"
+	}
+	return "6"
+}
+
+// ValidateIPFamily validates that the given IP addresses belong to the given IP address family.
+// Nil addresses are ignored.
+func ValidateIPFamily(family string, ipAddresses ...net.IP) error {
+	switch family {
+	case IPFamilyDual:
+		return nil
+	case IPFamilyIPv4, IPFamilyIPv6:
+	default:
+		return fmt.Errorf("invalid IP family %s", family)
+	}
+
+	for _, ipAddress := range ipAddresses {
+		if ipAddress == nil {
+			continue
+		}
+		if IsIPv4(ipAddress) != (family == IPFamilyIPv4) {
+			return fmt.Errorf("IP address %s does not belong to IP family %s", ipAddress, family)
+		}
+	}
+
+	return nil
+}
+
+// SynthesizeNAT64Address returns the IPv6 address that represents the given IPv4 address
+// behind the given NAT64 prefix. Only /96 prefixes are supported.
+func SynthesizeNAT64Address(prefix *net.IPNet, ipAddress net.IP) (net.IP, error) {
+	ones, bits := prefix.Mask.Size()
+	if ones != 96 || bits != 8*net.IPv6len {
+		return nil, fmt.Errorf("unsupported NAT64 prefix %s", prefix)
+	}
+
+	ipv4Address := ipAddress.To4()
+	if ipv4Address == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 address", ipAddress)
+	}
+
+	synthesized := make(net.IP, net.IPv6len)
+	copy(synthesized, prefix.IP.To16())
+	copy(synthesized[12:], ipv4Address)
+
+	return synthesized, nil
+}
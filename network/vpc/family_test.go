@@ -0,0 +1,56 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vpc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateIPFamily tests IP address family validation.
+func TestValidateIPFamily(t *testing.T) {
+	ipv4 := net.ParseIP("10.0.1.20")
+	ipv6 := net.ParseIP("2600:1f14::20")
+
+	assert.NoError(t, ValidateIPFamily(IPFamilyDual, ipv4, ipv6))
+	assert.NoError(t, ValidateIPFamily(IPFamilyIPv4, ipv4, nil))
+	assert.NoError(t, ValidateIPFamily(IPFamilyIPv6, ipv6, nil))
+	assert.Error(t, ValidateIPFamily(IPFamilyIPv4, ipv4, ipv6))
+	assert.Error(t, ValidateIPFamily(IPFamilyIPv6, ipv6, ipv4))
+	assert.Error(t, ValidateIPFamily("ipv5", ipv4))
+}
+
+// TestGetIPVersion tests CNI IP version strings.
+func TestGetIPVersion(t *testing.T) {
+	assert.Equal(t, "4", GetIPVersion(net.ParseIP("10.0.1.20")))
+	assert.Equal(t, "6", GetIPVersion(net.ParseIP("2600:1f14::20")))
+}
+
+// TestSynthesizeNAT64Address tests NAT64 address synthesis.
+func TestSynthesizeNAT64Address(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR(WellKnownNAT64Prefix)
+
+	address, err := SynthesizeNAT64Address(prefix, net.ParseIP("192.0.2.33"))
+	assert.NoError(t, err)
+	assert.Equal(t, "64:ff9b::c000:221", address.String())
+
+	_, err = SynthesizeNAT64Address(prefix, net.ParseIP("2600:1f14::20"))
+	assert.Error(t, err)
+
+	_, prefix, _ = net.ParseCIDR("64:ff9b::/64")
+	_, err = SynthesizeNAT64Address(prefix, net.ParseIP("192.0.2.33"))
+	assert.Error(t, err)
+}
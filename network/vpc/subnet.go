@@ -18,8 +18,9 @@ import (
 )
 
 var (
-	// Well-known VPC default gateway host ID.
-	defaultGatewayHostID = []byte{0, 0, 0, 1}
+	// Well-known VPC default gateway host IDs.
+	defaultGatewayHostID     = []byte{0, 0, 0, 1}
+	defaultGatewayHostIDIPv6 = net.ParseIP("::1")
 )
 
 // Subnet represents a VPC subnet.
@@ -31,7 +32,11 @@ type Subnet struct {
 // NewSubnet creates a new VPC subnet object given its prefix.
 func NewSubnet(prefix *net.IPNet) (*Subnet, error) {
 	// Compute default gateway address.
-	gateway := ComputeIPAddress(prefix, defaultGatewayHostID)
+	hostID := defaultGatewayHostID
+	if !IsIPv4(prefix.IP) {
+		hostID = defaultGatewayHostIDIPv6
+	}
+	gateway := ComputeIPAddress(prefix, hostID)
 
 	subnet := &Subnet{
 		Prefix:   *prefix,
@@ -63,7 +68,8 @@ func GetSubnetPrefix(ipAddress *net.IPNet) *net.IPNet {
 func ComputeIPAddress(prefix *net.IPNet, hostID net.IP) net.IP {
 	// Always treat as IPv6 address to ensure compatibility with both IPv4 and IPv6.
 	prefixIP := prefix.IP.To16()
-	hostIP := hostID.To16()
+	hostIP := make(net.IP, net.IPv6len)
+	copy(hostIP, hostID.To16())
 
 	for i := 0; i < len(hostIP); i++ {
 		hostIP[i] |= prefixIP[i]
@@ -71,3 +77,49 @@ func ComputeIPAddress(prefix *net.IPNet, hostID net.IP) net.IP {
 
 	return hostIP
 }
+
+// ExcludeCIDRs returns the CIDR blocks covering the given address block without the excluded
+// CIDR blocks. Excluded blocks in other IP families are ignored.
+func ExcludeCIDRs(block net.IPNet, excluded []net.IPNet) []string {
+	blocks := []net.IPNet{block}
+	for _, cidr := range excluded {
+		if len(cidr.Mask) != len(block.Mask) {
+			continue
+		}
+		hole := net.IPNet{IP: cidr.IP.Mask(cidr.Mask), Mask: cidr.Mask}
+
+		var remaining []net.IPNet
+		for _, b := range blocks {
+			remaining = append(remaining, subtractCIDR(b, hole)...)
+		}
+		blocks = remaining
+	}
+
+	var cidrs []string
+	for _, b := range blocks {
+		cidrs = append(cidrs, b.String())
+	}
+
+	return cidrs
+}
+
+// subtractCIDR returns the CIDR blocks covering the given address block without the hole.
+func subtractCIDR(block net.IPNet, hole net.IPNet) []net.IPNet {
+	blockOnes, bits := block.Mask.Size()
+	holeOnes, _ := hole.Mask.Size()
+
+	if !block.Contains(hole.IP) && !hole.Contains(block.IP) {
+		return []net.IPNet{block}
+	}
+	if holeOnes <= blockOnes {
+		return nil
+	}
+
+	// Split the block in halves, one of which contains the hole.
+	mask := net.CIDRMask(blockOnes+1, bits)
+	low := net.IPNet{IP: block.IP.Mask(mask), Mask: mask}
+	high := net.IPNet{IP: append(net.IP{}, low.IP...), Mask: mask}
+	high.IP[blockOnes/8] |= 0x80 >> uint(blockOnes%8)
+
+	return append(subtractCIDR(low, hole), subtractCIDR(high, hole)...)
+}
@@ -24,6 +24,8 @@ const (
 	anySubnetPrefixString        = "12.34.56.0/22"
 	anySubnetGateway             = "12.34.56.1"
 	anyInvalidSubnetPrefixString = "12.345.56.0/42"
+	anyIPv6SubnetPrefixString    = "2600:1f14:abc:de00::/64"
+	anyIPv6SubnetGateway         = "2600:1f14:abc:de00::1"
 )
 
 // TestNewSubnet tests subnet constructors.
@@ -49,3 +51,28 @@ func TestNewSubnet(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, subnet)
 }
+
+// TestNewIPv6Subnet tests that IPv6 subnets get an IPv6 default gateway.
+func TestNewIPv6Subnet(t *testing.T) {
+	subnet, err := NewSubnetFromString(anyIPv6SubnetPrefixString)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(subnet.Gateways), "incorrect number of gateways")
+	assert.Equal(t, anyIPv6SubnetGateway, subnet.Gateways[0].String(), "incorrect gateway")
+
+	// The well-known host ID must not be modified by previous computations.
+	subnet, err = NewSubnetFromString(anyIPv6SubnetPrefixString)
+	assert.NoError(t, err)
+	assert.Equal(t, anyIPv6SubnetGateway, subnet.Gateways[0].String(), "incorrect gateway")
+}
+
+// TestExcludeCIDRs tests the complement of CIDR blocks within an address block.
+func TestExcludeCIDRs(t *testing.T) {
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	_, half, _ := net.ParseCIDR("128.0.0.0/1")
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	_, ipv6, _ := net.ParseCIDR("fd00::/8")
+
+	assert.Equal(t, []string{"0.0.0.0/1"}, ExcludeCIDRs(*all, []net.IPNet{*half, *ipv6}))
+	assert.Len(t, ExcludeCIDRs(*all, []net.IPNet{*private}), 8)
+	assert.Nil(t, ExcludeCIDRs(*half, []net.IPNet{*all}))
+}
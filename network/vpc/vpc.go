@@ -17,6 +17,10 @@ const (
 	// InstanceMetadataEndpoint is EC2's instance metadata endpoint.
 	InstanceMetadataEndpoint = "169.254.169.254/32"
 
+	// DNSServerAddress is the link-local address of the Amazon-provided DNS server. It is also
+	// reachable at the base of each VPC IPv4 CIDR block plus two.
+	DNSServerAddress = "169.254.169.253"
+
 	// JumboFrameMTU is the VPC jumbo Ethernet frame Maximum Transmission Unit size in bytes.
 	JumboFrameMTU = 9001
 )
@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -34,6 +35,7 @@ type NetConfig struct {
 	PrevResult         *cniTypesCurrent.Result
 	IgnoredUID         string
 	IgnoredGID         string
+	IgnoredSID         string
 	ProxyIngressPort   string
 	ProxyEgressPort    string
 	AppPorts           string
@@ -50,6 +52,7 @@ type netConfigJSON struct {
 
 	IgnoredUID         string   `json:"ignoredUID"`
 	IgnoredGID         string   `json:"ignoredGID"`
+	IgnoredSID         string   `json:"ignoredSID"`
 	ProxyIngressPort   string   `json:"proxyIngressPort"`
 	ProxyEgressPort    string   `json:"proxyEgressPort"`
 	AppPorts           []string `json:"appPorts"`
@@ -64,6 +67,9 @@ const (
 	ipv6Proto = "IPv6"
 )
 
+// sidRegexp matches Windows security identifiers in string format, e.g. "S-1-5-21-1004-1001".
+var sidRegexp = regexp.MustCompile(`^S-1-[0-9]+(-[0-9]+)+$`)
+
 // New creates a new NetConfig object by parsing the given CNI arguments.
 func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
 	// Parse network configuration.
@@ -88,6 +94,7 @@ func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
 		NetConf:            config.NetConf,
 		IgnoredUID:         config.IgnoredUID,
 		IgnoredGID:         config.IgnoredGID,
+		IgnoredSID:         config.IgnoredSID,
 		ProxyIngressPort:   config.ProxyIngressPort,
 		ProxyEgressPort:    config.ProxyEgressPort,
 		AppPorts:           strings.Join(config.AppPorts, splitter),
@@ -126,8 +133,9 @@ func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
 // validateConfig validates network configuration.
 func validateConfig(config netConfigJSON) error {
 	// Validate if all the required fields are present.
-	if config.IgnoredGID == "" && config.IgnoredUID == "" {
-		return fmt.Errorf("missing required parameter ignoredGID or ignoredUID")
+	// Linux identifies the proxy by user or group ID, and Windows by security identifier.
+	if config.IgnoredGID == "" && config.IgnoredUID == "" && config.IgnoredSID == "" {
+		return fmt.Errorf("missing required parameter ignoredGID, ignoredUID or ignoredSID")
 	}
 	if config.ProxyEgressPort == "" {
 		return fmt.Errorf("missing required parameter proxyEgressPort")
@@ -144,6 +152,9 @@ func validateConfig(config netConfigJSON) error {
 	}
 
 	// Validate the format of all fields.
+	if config.IgnoredSID != "" && !sidRegexp.MatchString(config.IgnoredSID) {
+		return errors.Errorf("invalid SID [%s] specified in ignoredSID", config.IgnoredSID)
+	}
 	if err := isValidPort(config.ProxyEgressPort); err != nil {
 		return err
 	}
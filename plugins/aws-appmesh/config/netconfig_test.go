@@ -44,6 +44,10 @@ var (
 			// no ingress traffic, e.g. batch job.
 			netConfig: `{"ignoredGID":"1337", "proxyEgressPort":"8000"}`,
 		},
+		config{
+			// Windows proxy identified by SID.
+			netConfig: `{"ignoredSID":"S-1-5-21-1004336348-1177238915-682003330-1001", "proxyIngressPort":"8080", "proxyEgressPort":"8000", "appPorts":["1223"]}`,
+		},
 	}
 
 	invalidConfigs = []config{
@@ -62,6 +66,9 @@ var (
 		config{
 			netConfig: `{"ignoredGID":"1337", "proxyEgressPort":"8000", "appPorts":["1223"]}`,
 		},
+		config{
+			netConfig: `{"ignoredSID":"envoy", "proxyEgressPort":"8000"}`,
+		},
 	}
 )
 
@@ -0,0 +1,194 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/aws-appmesh/config"
+
+	"github.com/Microsoft/hcsshim/hcn"
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+const (
+	// hnsEndpointNameFormat is the format of the HNS endpoint names generated by vpc-shared-eni.
+	hnsEndpointNameFormat = "cid-%s"
+
+	// hnsL4WfpProxy is the HNS endpoint policy type for layer-4 WFP proxies.
+	hnsL4WfpProxy hcn.EndpointPolicyType = "L4WFPPROXY"
+
+	// protocolTCP is the IANA protocol number for TCP.
+	protocolTCP = 6
+)
+
+// l4WfpProxyPolicySetting is an HNS layer-4 WFP proxy policy.
+// This definition really needs to be in Microsoft's hcsshim package.
+type l4WfpProxyPolicySetting struct {
+	InboundProxyPort   string          `json:",omitempty"`
+	OutboundProxyPort  string          `json:",omitempty"`
+	FilterTuple        fiveTuple       `json:",omitempty"`
+	UserSID            string          `json:",omitempty"`
+	InboundExceptions  proxyExceptions `json:",omitempty"`
+	OutboundExceptions proxyExceptions `json:",omitempty"`
+}
+
+// fiveTuple selects the traffic a WFP proxy policy applies to.
+type fiveTuple struct {
+	Protocols       string `json:",omitempty"`
+	LocalAddresses  string `json:",omitempty"`
+	RemoteAddresses string `json:",omitempty"`
+	LocalPorts      string `json:",omitempty"`
+	RemotePorts     string `json:",omitempty"`
+	Priority        uint16 `json:",omitempty"`
+}
+
+// proxyExceptions lists traffic exempted from a WFP proxy policy.
+type proxyExceptions struct {
+	IpAddressExceptions []string `json:",omitempty"`
+	PortExceptions      []string `json:",omitempty"`
+}
+
+// setupRedirection adds layer-4 WFP proxy policies to the task HNS endpoint that redirect
+// traffic to the proxy.
+func (plugin *Plugin) setupRedirection(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	if netConfig.IgnoredSID == "" {
+		return fmt.Errorf("missing required parameter ignoredSID")
+	}
+
+	endpointName := fmt.Sprintf(hnsEndpointNameFormat, args.ContainerID)
+	endpoint, err := hcn.GetEndpointByName(endpointName)
+	if err != nil {
+		log.Errorf("Failed to find HNS endpoint %s: %v.", endpointName, err)
+		return err
+	}
+
+	return plugin.modifyPolicies(endpoint, netConfig, hcn.RequestTypeAdd)
+}
+
+// removeRedirection removes the layer-4 WFP proxy policies from the task HNS endpoint.
+func (plugin *Plugin) removeRedirection(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	endpointName := fmt.Sprintf(hnsEndpointNameFormat, args.ContainerID)
+	endpoint, err := hcn.GetEndpointByName(endpointName)
+	if err != nil {
+		if hcn.IsNotFoundError(err) {
+			// The policies are deleted along with the endpoint.
+			log.Infof("Failed to find HNS endpoint %s, ignoring.", endpointName)
+			return nil
+		}
+		log.Errorf("Failed to find HNS endpoint %s: %v.", endpointName, err)
+		return err
+	}
+
+	return plugin.modifyPolicies(endpoint, netConfig, hcn.RequestTypeRemove)
+}
+
+// modifyPolicies adds or removes the proxy policies for the given configuration.
+func (plugin *Plugin) modifyPolicies(
+	endpoint *hcn.HostComputeEndpoint,
+	netConfig *config.NetConfig,
+	requestType hcn.RequestType) error {
+
+	policies, err := newProxyPolicies(netConfig)
+	if err != nil {
+		return err
+	}
+
+	settings, err := json.Marshal(hcn.PolicyEndpointRequest{Policies: policies})
+	if err != nil {
+		return err
+	}
+
+	request := &hcn.ModifyEndpointSettingRequest{
+		ResourceType: hcn.EndpointResourceTypePolicy,
+		RequestType:  requestType,
+		Settings:     settings,
+	}
+
+	log.Infof("Modifying HNS endpoint %s with %s proxy policies: %s.",
+		endpoint.Name, requestType, settings)
+	err = hcn.ModifyEndpointSettings(endpoint.Id, request)
+	if err != nil {
+		log.Errorf("Failed to modify HNS endpoint %s: %v.", endpoint.Name, err)
+		return err
+	}
+
+	return nil
+}
+
+// newProxyPolicies returns the WFP proxy policies for the given configuration. Outbound TCP
+// traffic is redirected to the egress port, except for traffic of the proxy process itself,
+// which is identified by its SID, and traffic to ignored ports and addresses. Inbound TCP
+// traffic to application ports is redirected to the ingress port.
+func newProxyPolicies(netConfig *config.NetConfig) ([]hcn.EndpointPolicy, error) {
+	egress := l4WfpProxyPolicySetting{
+		OutboundProxyPort: netConfig.ProxyEgressPort,
+		FilterTuple: fiveTuple{
+			Protocols: strconv.Itoa(protocolTCP),
+		},
+		UserSID: netConfig.IgnoredSID,
+		OutboundExceptions: proxyExceptions{
+			IpAddressExceptions: splitList(netConfig.EgressIgnoredIPv4s),
+			PortExceptions:      splitList(netConfig.EgressIgnoredPorts),
+		},
+	}
+
+	if netConfig.EnableIPv6 {
+		egress.OutboundExceptions.IpAddressExceptions = append(
+			egress.OutboundExceptions.IpAddressExceptions, splitList(netConfig.EgressIgnoredIPv6s)...)
+	}
+
+	settings := []l4WfpProxyPolicySetting{egress}
+
+	if netConfig.ProxyIngressPort != "" {
+		for _, port := range splitList(netConfig.AppPorts) {
+			settings = append(settings, l4WfpProxyPolicySetting{
+				InboundProxyPort: netConfig.ProxyIngressPort,
+				FilterTuple: fiveTuple{
+					Protocols:  strconv.Itoa(protocolTCP),
+					LocalPorts: port,
+				},
+				UserSID: netConfig.IgnoredSID,
+			})
+		}
+	}
+
+	var policies []hcn.EndpointPolicy
+	for _, setting := range settings {
+		rawSetting, err := json.Marshal(setting)
+		if err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, hcn.EndpointPolicy{
+			Type:     hnsL4WfpProxy,
+			Settings: rawSetting,
+		})
+	}
+
+	return policies, nil
+}
+
+// splitList splits a comma separated list.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	return strings.Split(list, ",")
+}
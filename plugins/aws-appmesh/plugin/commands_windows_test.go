@@ -0,0 +1,66 @@
+// +build !integration_test,!e2e_test
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/aws-appmesh/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProxyPolicies(t *testing.T) {
+	netConfig := &config.NetConfig{
+		IgnoredSID:         "S-1-5-21-1004-1001",
+		ProxyIngressPort:   "8000",
+		ProxyEgressPort:    "8080",
+		AppPorts:           "5000,5001",
+		EgressIgnoredPorts: "80",
+		EgressIgnoredIPv4s: "169.254.169.254",
+		EgressIgnoredIPv6s: "fd00:ec2::254",
+	}
+
+	policies, err := newProxyPolicies(netConfig)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	var egress l4WfpProxyPolicySetting
+	require.NoError(t, json.Unmarshal(policies[0].Settings, &egress))
+	assert.Equal(t, "8080", egress.OutboundProxyPort)
+	assert.Equal(t, "S-1-5-21-1004-1001", egress.UserSID)
+	assert.Equal(t, []string{"169.254.169.254"}, egress.OutboundExceptions.IpAddressExceptions)
+	assert.Equal(t, []string{"80"}, egress.OutboundExceptions.PortExceptions)
+
+	for i, port := range []string{"5000", "5001"} {
+		var ingress l4WfpProxyPolicySetting
+		require.NoError(t, json.Unmarshal(policies[i+1].Settings, &ingress))
+		assert.Equal(t, "8000", ingress.InboundProxyPort)
+		assert.Equal(t, port, ingress.FilterTuple.LocalPorts)
+	}
+
+	// IPv6 exceptions apply only if IPv6 is enabled.
+	netConfig.EnableIPv6 = true
+	netConfig.ProxyIngressPort = ""
+	policies, err = newProxyPolicies(netConfig)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+
+	require.NoError(t, json.Unmarshal(policies[0].Settings, &egress))
+	assert.Equal(t, []string{"169.254.169.254", "fd00:ec2::254"}, egress.OutboundExceptions.IpAddressExceptions)
+}
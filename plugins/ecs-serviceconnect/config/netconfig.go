@@ -0,0 +1,183 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// NetConfig defines the network configuration for the ecs-serviceconnect plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	PrevResult    *cniTypesCurrent.Result
+	IngressConfig []IngressConfig
+	EgressConfig  *EgressConfig
+	EnableIPv4    bool
+	EnableIPv6    bool
+	// LoopbackDSR enables direct server return for traffic from a task to its own IP address,
+	// so that listeners can reach services in the same task. Windows only.
+	LoopbackDSR bool
+}
+
+// IngressConfig defines the redirection of inbound traffic to a Service Connect listener.
+type IngressConfig struct {
+	// InterceptPort is the application port whose inbound traffic is redirected.
+	// If zero, the listener receives traffic on its own port and nothing is redirected.
+	InterceptPort uint16 `json:"interceptPort,omitempty"`
+	// ListenerPort is the port of the Service Connect listener.
+	ListenerPort uint16 `json:"listenerPort"`
+}
+
+// EgressConfig defines the redirection of outbound traffic to a Service Connect listener.
+type EgressConfig struct {
+	// ListenerPort is the port of the Service Connect egress listener.
+	ListenerPort uint16 `json:"listenerPort"`
+	// VIP is the virtual IP address range assigned to Service Connect services.
+	// Only outbound traffic sent to this range is redirected.
+	VIP VIPConfig `json:"vip"`
+	// ExcludedPorts are destination ports whose outbound traffic is never redirected.
+	ExcludedPorts []uint16 `json:"excludedPorts,omitempty"`
+}
+
+// VIPConfig defines the virtual IP address ranges of Service Connect services.
+type VIPConfig struct {
+	IPv4CIDR string `json:"ipv4Cidr,omitempty"`
+	IPv6CIDR string `json:"ipv6Cidr,omitempty"`
+}
+
+// netConfigJSON defines the network configuration JSON file format for the ecs-serviceconnect plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	PrevResult    map[string]interface{} `json:"prevResult,omitempty"`
+	IngressConfig []IngressConfig        `json:"ingressConfig"`
+	EgressConfig  *EgressConfig          `json:"egressConfig"`
+	EnableIPv4    *bool                  `json:"enableIPv4"`
+	EnableIPv6    bool                   `json:"enableIPv6"`
+	LoopbackDSR   bool                   `json:"loopbackDSR"`
+}
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	netConfig := NetConfig{
+		NetConf:       config.NetConf,
+		IngressConfig: config.IngressConfig,
+		EgressConfig:  config.EgressConfig,
+		EnableIPv4:    config.EnableIPv4 == nil || *config.EnableIPv4,
+		EnableIPv6:    config.EnableIPv6,
+		LoopbackDSR:   config.LoopbackDSR,
+	}
+
+	err = validateConfig(&netConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PrevResult != nil {
+		// Plugin was called as part of a chain. Parse the previous result to pass forward.
+		prevResBytes, err := json.Marshal(config.PrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize prevResult: %v", err)
+		}
+
+		prevRes, err := cniVersion.NewResult(config.CNIVersion, prevResBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+		}
+
+		netConfig.PrevResult, err = cniTypesCurrent.NewResultFromResult(prevRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+		}
+	} else {
+		// Plugin was called stand-alone.
+		netConfig.PrevResult = &cniTypesCurrent.Result{}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
+
+// validateConfig validates network configuration.
+func validateConfig(netConfig *NetConfig) error {
+	if !netConfig.EnableIPv4 && !netConfig.EnableIPv6 {
+		return fmt.Errorf("at least one of enableIPv4 and enableIPv6 must be set")
+	}
+
+	if len(netConfig.IngressConfig) == 0 && netConfig.EgressConfig == nil {
+		return fmt.Errorf("missing required parameter ingressConfig or egressConfig")
+	}
+
+	for _, ingress := range netConfig.IngressConfig {
+		if ingress.ListenerPort == 0 {
+			return fmt.Errorf("missing required parameter ingressConfig listenerPort")
+		}
+		if ingress.InterceptPort == ingress.ListenerPort {
+			return fmt.Errorf("invalid ingressConfig interceptPort %d same as listenerPort",
+				ingress.InterceptPort)
+		}
+	}
+
+	if egress := netConfig.EgressConfig; egress != nil {
+		if egress.ListenerPort == 0 {
+			return fmt.Errorf("missing required parameter egressConfig listenerPort")
+		}
+
+		for _, port := range egress.ExcludedPorts {
+			if port == 0 || port == egress.ListenerPort {
+				return fmt.Errorf("invalid egressConfig excludedPorts port %d", port)
+			}
+		}
+
+		if netConfig.EnableIPv4 {
+			err := validateCIDR(egress.VIP.IPv4CIDR, false)
+			if err != nil {
+				return err
+			}
+		}
+		if netConfig.EnableIPv6 {
+			err := validateCIDR(egress.VIP.IPv6CIDR, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateCIDR validates a VIP CIDR block of the given address family.
+func validateCIDR(cidr string, isIPv6 bool) error {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil || (ip.To4() == nil) != isIPv6 {
+		return fmt.Errorf("invalid VIP CIDR %q", cidr)
+	}
+
+	return nil
+}
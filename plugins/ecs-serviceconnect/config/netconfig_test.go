@@ -0,0 +1,90 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// Ingress and egress.
+		`{"ingressConfig":[{"interceptPort":8080, "listenerPort":15000}],
+		  "egressConfig":{"listenerPort":15001, "vip":{"ipv4Cidr":"127.255.0.0/16"}}}`,
+		// Ingress only, with a listener bound to its own port.
+		`{"ingressConfig":[{"listenerPort":15000}]}`,
+		// Egress only, dual stack.
+		`{"egressConfig":{"listenerPort":15001, "vip":{"ipv4Cidr":"127.255.0.0/16", "ipv6Cidr":"2002::1234:abcd:ffff:c0a8:101/112"}},
+		  "enableIPv6":true}`,
+		// Egress only, IPv6 only.
+		`{"egressConfig":{"listenerPort":15001, "vip":{"ipv6Cidr":"2002::1234:abcd:ffff:c0a8:101/112"}},
+		  "enableIPv4":false, "enableIPv6":true}`,
+		// Egress with excluded ports and loopback DSR.
+		`{"egressConfig":{"listenerPort":15001, "vip":{"ipv4Cidr":"127.255.0.0/16"}, "excludedPorts":[22, 443]},
+		  "loopbackDSR":true}`,
+	}
+
+	invalidConfigs = []string{
+		// Neither ingress nor egress.
+		`{}`,
+		// Missing ingress listener port.
+		`{"ingressConfig":[{"interceptPort":8080}]}`,
+		// Intercept port same as listener port.
+		`{"ingressConfig":[{"interceptPort":15000, "listenerPort":15000}]}`,
+		// Missing egress listener port.
+		`{"egressConfig":{"vip":{"ipv4Cidr":"127.255.0.0/16"}}}`,
+		// Missing IPv4 VIP CIDR.
+		`{"egressConfig":{"listenerPort":15001, "vip":{}}}`,
+		// IPv6 VIP CIDR for IPv4.
+		`{"egressConfig":{"listenerPort":15001, "vip":{"ipv4Cidr":"2002::/112"}}}`,
+		// No address family enabled.
+		`{"ingressConfig":[{"listenerPort":15000}], "enableIPv4":false}`,
+		// Excluded port same as listener port.
+		`{"egressConfig":{"listenerPort":15001, "vip":{"ipv4Cidr":"127.255.0.0/16"}, "excludedPorts":[15001]}}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestIPv4EnabledByDefault tests that IPv4 is enabled unless explicitly disabled.
+func TestIPv4EnabledByDefault(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[0])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.True(t, netConfig.EnableIPv4)
+	assert.False(t, netConfig.EnableIPv6)
+}
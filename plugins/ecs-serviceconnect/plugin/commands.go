@@ -0,0 +1,70 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/ecs-serviceconnect/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Call the operating system specific handler.
+	err = plugin.setupRedirection(args, netConfig)
+	if err != nil {
+		log.Errorf("Failed to set up traffic redirection: %v.", err)
+		return err
+	}
+
+	// Pass through the previous result.
+	log.Infof("Writing CNI result to stdout: %+v", netConfig.PrevResult)
+
+	return cniTypes.PrintResult(netConfig.PrevResult, netConfig.CNIVersion)
+}
+
+// Del is the CNI DEL command handler.
+// CNI DEL command can be called by the orchestrator multiple times for the same interface,
+// and thus must be best-effort and idempotent.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Call the operating system specific handler.
+	err = plugin.removeRedirection(args, netConfig)
+	if err != nil {
+		log.Errorf("Failed to remove traffic redirection: %v.", err)
+	}
+
+	return err
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"strconv"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/ecs-serviceconnect/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/coreos/go-iptables/iptables"
+)
+
+const (
+	// Names of iptables chains created for Service Connect rules.
+	ingressChain = "SERVICECONNECT_INGRESS"
+	egressChain  = "SERVICECONNECT_EGRESS"
+)
+
+// setupRedirection installs iptables rules in the task network namespace that redirect
+// intercepted traffic to the Service Connect listeners.
+func (plugin *Plugin) setupRedirection(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	log.Infof("Searching for netns %s.", args.Netns)
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		log.Errorf("Failed to find netns %s: %v.", args.Netns, err)
+		return err
+	}
+
+	return ns.Run(func() error {
+		for proto, vipCIDR := range plugin.protocols(netConfig) {
+			iptable, err := iptables.NewWithProtocol(proto)
+			if err != nil {
+				return err
+			}
+
+			err = plugin.setupIngressRules(iptable, netConfig)
+			if err != nil {
+				return err
+			}
+
+			err = plugin.setupEgressRules(iptable, netConfig, vipCIDR)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// removeRedirection deletes the iptables rules installed in the task network namespace.
+func (plugin *Plugin) removeRedirection(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		// The rules are deleted along with the network namespace.
+		log.Infof("Failed to find netns %s, ignoring: %v.", args.Netns, err)
+		return nil
+	}
+
+	return ns.Run(func() error {
+		for proto := range plugin.protocols(netConfig) {
+			iptable, err := iptables.NewWithProtocol(proto)
+			if err != nil {
+				return err
+			}
+
+			if len(netConfig.IngressConfig) != 0 {
+				err = plugin.deleteChain(iptable, "PREROUTING", ingressChain,
+					"-p", "tcp", "-m", "addrtype", "!", "--src-type", "LOCAL")
+				if err != nil {
+					return err
+				}
+			}
+
+			if netConfig.EgressConfig != nil {
+				err = plugin.deleteChain(iptable, "OUTPUT", egressChain, "-p", "tcp")
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// protocols returns the enabled IP protocols, mapped to their egress VIP CIDR blocks.
+func (plugin *Plugin) protocols(netConfig *config.NetConfig) map[iptables.Protocol]string {
+	protos := make(map[iptables.Protocol]string)
+
+	var vip config.VIPConfig
+	if netConfig.EgressConfig != nil {
+		vip = netConfig.EgressConfig.VIP
+	}
+
+	if netConfig.EnableIPv4 {
+		protos[iptables.ProtocolIPv4] = vip.IPv4CIDR
+	}
+	if netConfig.EnableIPv6 {
+		protos[iptables.ProtocolIPv6] = vip.IPv6CIDR
+	}
+
+	return protos
+}
+
+// setupIngressRules redirects inbound traffic to intercepted application ports to listeners.
+func (plugin *Plugin) setupIngressRules(iptable *iptables.IPTables, netConfig *config.NetConfig) error {
+	if len(netConfig.IngressConfig) == 0 {
+		return nil
+	}
+
+	err := iptable.NewChain("nat", ingressChain)
+	if err != nil {
+		return err
+	}
+
+	for _, ingress := range netConfig.IngressConfig {
+		// Listeners bound to their own port receive traffic without redirection.
+		if ingress.InterceptPort == 0 {
+			continue
+		}
+
+		err = iptable.Append("nat", ingressChain, "-p", "tcp",
+			"--dport", strconv.Itoa(int(ingress.InterceptPort)),
+			"-j", "REDIRECT", "--to-port", strconv.Itoa(int(ingress.ListenerPort)))
+		if err != nil {
+			log.Errorf("Append rule to redirect port %d to listener failed: %v", ingress.InterceptPort, err)
+			return err
+		}
+	}
+
+	// Apply ingress chain to non local traffic, so that listeners can reach the application.
+	err = iptable.Append("nat", "PREROUTING", "-p", "tcp", "-m", "addrtype", "!", "--src-type",
+		"LOCAL", "-j", ingressChain)
+	if err != nil {
+		log.Errorf("Append rule to jump from PREROUTING to ingress chain failed: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// setupEgressRules redirects outbound traffic to Service Connect VIPs to the egress listener.
+func (plugin *Plugin) setupEgressRules(
+	iptable *iptables.IPTables,
+	netConfig *config.NetConfig,
+	vipCIDR string) error {
+
+	if netConfig.EgressConfig == nil {
+		return nil
+	}
+
+	err := iptable.NewChain("nat", egressChain)
+	if err != nil {
+		return err
+	}
+
+	// Traffic to excluded ports is never redirected.
+	for _, port := range netConfig.EgressConfig.ExcludedPorts {
+		err = iptable.Append("nat", egressChain, "-p", "tcp",
+			"--dport", strconv.Itoa(int(port)), "-j", "RETURN")
+		if err != nil {
+			log.Errorf("Append rule to exclude port %d failed: %v", port, err)
+			return err
+		}
+	}
+
+	// Only traffic sent to VIPs is redirected, which excludes all other destinations.
+	err = iptable.Append("nat", egressChain, "-p", "tcp", "-d", vipCIDR,
+		"-j", "REDIRECT", "--to-port", strconv.Itoa(int(netConfig.EgressConfig.ListenerPort)))
+	if err != nil {
+		log.Errorf("Append rule to redirect VIP traffic to listener failed: %v", err)
+		return err
+	}
+
+	err = iptable.Append("nat", "OUTPUT", "-p", "tcp", "-j", egressChain)
+	if err != nil {
+		log.Errorf("Append rule to jump from OUTPUT to egress chain failed: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// deleteChain deletes the jump rule to a chain and the chain itself.
+func (plugin *Plugin) deleteChain(
+	iptable *iptables.IPTables,
+	parentChain string,
+	chain string,
+	match ...string) error {
+
+	rule := append(match, "-j", chain)
+	exists, err := iptable.Exists("nat", parentChain, rule...)
+	if err == nil && exists {
+		err = iptable.Delete("nat", parentChain, rule...)
+		if err != nil {
+			log.Errorf("Delete the rule in %s chain failed: %v", parentChain, err)
+			return err
+		}
+	}
+
+	// Flush and delete the chain.
+	err = iptable.ClearChain("nat", chain)
+	if err != nil {
+		log.Errorf("Failed to flush rules in chain[%v]: %v", chain, err)
+		return err
+	}
+
+	err = iptable.DeleteChain("nat", chain)
+	if err != nil {
+		log.Errorf("Failed to delete chain[%v]: %v", chain, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/ecs-serviceconnect/config"
+
+	"github.com/Microsoft/hcsshim/hcn"
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+const (
+	// hnsEndpointNameFormat is the format of the HNS endpoint names generated by vpc-shared-eni.
+	hnsEndpointNameFormat = "cid-%s"
+	// hnsLoopbackDSR is the HNS endpoint policy type for loopback direct server return.
+	hnsLoopbackDSR hcn.EndpointPolicyType = "LoopbackDSR"
+	// containerNetNSPrefix is the prefix of netns names referring to an infra container.
+	containerNetNSPrefix = "container:"
+	// protocolTCP is the IANA protocol number for TCP.
+	protocolTCP = 6
+)
+
+// loopbackDSRPolicySetting is an HNS loopback direct server return policy.
+// This definition really needs to be in Microsoft's hcsshim package.
+type loopbackDSRPolicySetting struct {
+	IPAddress string `json:",omitempty"`
+}
+
+// setupRedirection adds layer-4 proxy policies to the task HNS endpoint that redirect
+// intercepted traffic to the Service Connect listeners.
+func (plugin *Plugin) setupRedirection(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	endpointName := generateHNSEndpointName(args)
+	endpoint, err := hcn.GetEndpointByName(endpointName)
+	if err != nil {
+		log.Errorf("Failed to find HNS endpoint %s: %v.", endpointName, err)
+		return err
+	}
+
+	return plugin.modifyPolicies(endpoint, netConfig, hcn.RequestTypeAdd)
+}
+
+// removeRedirection removes the layer-4 proxy policies from the task HNS endpoint.
+func (plugin *Plugin) removeRedirection(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	endpointName := generateHNSEndpointName(args)
+	endpoint, err := hcn.GetEndpointByName(endpointName)
+	if err != nil {
+		if hcn.IsNotFoundError(err) {
+			// The policies are deleted along with the endpoint.
+			log.Infof("Failed to find HNS endpoint %s, ignoring.", endpointName)
+			return nil
+		}
+		log.Errorf("Failed to find HNS endpoint %s: %v.", endpointName, err)
+		return err
+	}
+
+	return plugin.modifyPolicies(endpoint, netConfig, hcn.RequestTypeRemove)
+}
+
+// modifyPolicies adds or removes the proxy policies for the given configuration.
+func (plugin *Plugin) modifyPolicies(
+	endpoint *hcn.HostComputeEndpoint,
+	netConfig *config.NetConfig,
+	requestType hcn.RequestType) error {
+
+	policies, err := newPolicies(endpoint, netConfig)
+	if err != nil {
+		return err
+	}
+
+	if len(policies) == 0 {
+		return nil
+	}
+
+	settings, err := json.Marshal(hcn.PolicyEndpointRequest{Policies: policies})
+	if err != nil {
+		return err
+	}
+
+	request := &hcn.ModifyEndpointSettingRequest{
+		ResourceType: hcn.EndpointResourceTypePolicy,
+		RequestType:  requestType,
+		Settings:     settings,
+	}
+
+	log.Infof("Modifying HNS endpoint %s with %s proxy policies: %s.",
+		endpoint.Name, requestType, settings)
+	err = hcn.ModifyEndpointSettings(endpoint.Id, request)
+	if err != nil {
+		log.Errorf("Failed to modify HNS endpoint %s: %v.", endpoint.Name, err)
+		return err
+	}
+
+	return nil
+}
+
+// newPolicies returns the endpoint policies for the given configuration.
+func newPolicies(
+	endpoint *hcn.HostComputeEndpoint,
+	netConfig *config.NetConfig) ([]hcn.EndpointPolicy, error) {
+
+	var policies []hcn.EndpointPolicy
+
+	for _, ingress := range netConfig.IngressConfig {
+		// Listeners bound to their own port receive traffic without redirection.
+		if ingress.InterceptPort == 0 {
+			continue
+		}
+
+		policy, err := newL4ProxyPolicy(
+			ingress.ListenerPort, strconv.Itoa(int(ingress.InterceptPort)), nil)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	if netConfig.EgressConfig != nil {
+		var exceptions []string
+		for _, port := range netConfig.EgressConfig.ExcludedPorts {
+			exceptions = append(exceptions, strconv.Itoa(int(port)))
+		}
+
+		vip := netConfig.EgressConfig.VIP
+		for _, cidr := range []string{vip.IPv4CIDR, vip.IPv6CIDR} {
+			if cidr == "" {
+				continue
+			}
+
+			policy, err := newL4ProxyPolicy(netConfig.EgressConfig.ListenerPort, cidr, exceptions)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, policy)
+		}
+	}
+
+	// Loopback DSR lets the task reach its own IP addresses, for example when a listener
+	// connects to a service in the same task.
+	if netConfig.LoopbackDSR {
+		for _, ipConfig := range endpoint.IpConfigurations {
+			rawSetting, err := json.Marshal(loopbackDSRPolicySetting{IPAddress: ipConfig.IpAddress})
+			if err != nil {
+				return nil, err
+			}
+
+			policies = append(policies, hcn.EndpointPolicy{
+				Type:     hnsLoopbackDSR,
+				Settings: rawSetting,
+			})
+		}
+	}
+
+	return policies, nil
+}
+
+// newL4ProxyPolicy returns a layer-4 proxy policy that sends TCP traffic for the destination
+// to the listener port, except for traffic to the given ports.
+func newL4ProxyPolicy(
+	listenerPort uint16,
+	destination string,
+	exceptions []string) (hcn.EndpointPolicy, error) {
+
+	setting := hcn.L4ProxyPolicySetting{
+		Port:          strconv.Itoa(int(listenerPort)),
+		Protocol:      protocolTCP,
+		ExceptionList: exceptions,
+		Destination:   destination,
+	}
+
+	rawSetting, err := json.Marshal(setting)
+	if err != nil {
+		return hcn.EndpointPolicy{}, err
+	}
+
+	return hcn.EndpointPolicy{
+		Type:     hcn.L4Proxy,
+		Settings: rawSetting,
+	}, nil
+}
+
+// generateHNSEndpointName returns the name of the task HNS endpoint. Containers sharing the
+// netns of an infra container, such as those of ENI-backed tasks, share its endpoint.
+func generateHNSEndpointName(args *cniSkel.CmdArgs) string {
+	id := args.ContainerID
+	if strings.HasPrefix(args.Netns, containerNetNSPrefix) {
+		id = strings.TrimPrefix(args.Netns, containerNetNSPrefix)
+	}
+
+	return fmt.Sprintf(hnsEndpointNameFormat, id)
+}
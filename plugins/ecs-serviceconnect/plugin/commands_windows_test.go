@@ -0,0 +1,76 @@
+// +build !integration_test,!e2e_test
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/ecs-serviceconnect/config"
+
+	"github.com/Microsoft/hcsshim/hcn"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicies(t *testing.T) {
+	endpoint := &hcn.HostComputeEndpoint{
+		IpConfigurations: []hcn.IpConfig{{IpAddress: "10.0.1.20", PrefixLength: 24}},
+	}
+	netConfig := &config.NetConfig{
+		IngressConfig: []config.IngressConfig{
+			{InterceptPort: 8080, ListenerPort: 15000},
+			{ListenerPort: 15002},
+		},
+		EgressConfig: &config.EgressConfig{
+			ListenerPort:  15001,
+			VIP:           config.VIPConfig{IPv4CIDR: "127.255.0.0/16"},
+			ExcludedPorts: []uint16{22, 443},
+		},
+		LoopbackDSR: true,
+	}
+
+	policies, err := newPolicies(endpoint, netConfig)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	var ingress hcn.L4ProxyPolicySetting
+	assert.Equal(t, hcn.L4Proxy, policies[0].Type)
+	require.NoError(t, json.Unmarshal(policies[0].Settings, &ingress))
+	assert.Equal(t, "15000", ingress.Port)
+	assert.Equal(t, "8080", ingress.Destination)
+	assert.Empty(t, ingress.ExceptionList)
+
+	var egress hcn.L4ProxyPolicySetting
+	assert.Equal(t, hcn.L4Proxy, policies[1].Type)
+	require.NoError(t, json.Unmarshal(policies[1].Settings, &egress))
+	assert.Equal(t, "15001", egress.Port)
+	assert.Equal(t, "127.255.0.0/16", egress.Destination)
+	assert.Equal(t, []string{"22", "443"}, egress.ExceptionList)
+
+	var dsr loopbackDSRPolicySetting
+	assert.Equal(t, hnsLoopbackDSR, policies[2].Type)
+	require.NoError(t, json.Unmarshal(policies[2].Settings, &dsr))
+	assert.Equal(t, "10.0.1.20", dsr.IPAddress)
+}
+
+func TestGenerateHNSEndpointName(t *testing.T) {
+	assert.Equal(t, "cid-task1", generateHNSEndpointName(
+		&cniSkel.CmdArgs{ContainerID: "task1", Netns: "none"}))
+	assert.Equal(t, "cid-infra1", generateHNSEndpointName(
+		&cniSkel.CmdArgs{ContainerID: "task1", Netns: "container:infra1"}))
+}
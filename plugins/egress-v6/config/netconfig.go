@@ -0,0 +1,130 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// NetConfig defines the network configuration for the egress-v6 plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	ULACIDR       *net.IPNet
+	NodeIPAddress net.IP
+	InterfaceName string
+	MTU           int
+	PrevResult    *cniTypesCurrent.Result
+}
+
+// netConfigJSON defines the network configuration JSON file format for the egress-v6 plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	ULACIDR       string                 `json:"ulaCIDR"`
+	NodeIPAddress string                 `json:"nodeIPAddress"`
+	InterfaceName string                 `json:"interfaceName"`
+	MTU           string                 `json:"mtu"`
+	PrevResult    map[string]interface{} `json:"prevResult,omitempty"`
+}
+
+const (
+	// DefaultULACIDR is the default unique local address block that task addresses are
+	// allocated from.
+	DefaultULACIDR = "fd00::ac:0/118"
+
+	// DefaultInterfaceName is the default name of the egress interface in the task netns.
+	DefaultInterfaceName = "v6if0"
+)
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Set defaults.
+	if config.ULACIDR == "" {
+		config.ULACIDR = DefaultULACIDR
+	}
+
+	if config.InterfaceName == "" {
+		config.InterfaceName = DefaultInterfaceName
+	}
+
+	netConfig := NetConfig{
+		NetConf:       config.NetConf,
+		InterfaceName: config.InterfaceName,
+		MTU:           vpc.JumboFrameMTU,
+	}
+
+	// Parse the unique local address block.
+	_, netConfig.ULACIDR, err = net.ParseCIDR(config.ULACIDR)
+	if err != nil || netConfig.ULACIDR.IP.To4() != nil {
+		return nil, fmt.Errorf("invalid ulaCIDR %s", config.ULACIDR)
+	}
+
+	// Parse the optional node IP address. Egress traffic is masqueraded if none is specified.
+	if config.NodeIPAddress != "" {
+		netConfig.NodeIPAddress = net.ParseIP(config.NodeIPAddress)
+		if netConfig.NodeIPAddress == nil || netConfig.NodeIPAddress.To4() != nil {
+			return nil, fmt.Errorf("invalid nodeIPAddress %s", config.NodeIPAddress)
+		}
+	}
+
+	// Parse the optional MTU.
+	if config.MTU != "" {
+		netConfig.MTU, err = strconv.Atoi(config.MTU)
+		if err != nil || netConfig.MTU < 1280 || netConfig.MTU > vpc.JumboFrameMTU {
+			return nil, fmt.Errorf("invalid mtu %s", config.MTU)
+		}
+	}
+
+	if config.PrevResult != nil {
+		// Plugin was called as part of a chain. Parse the previous result to pass forward.
+		prevResBytes, err := json.Marshal(config.PrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize prevResult: %v", err)
+		}
+
+		prevRes, err := cniVersion.NewResult(config.CNIVersion, prevResBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+		}
+
+		netConfig.PrevResult, err = cniTypesCurrent.NewResultFromResult(prevRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+		}
+	} else {
+		// Plugin was called stand-alone.
+		netConfig.PrevResult = &cniTypesCurrent.Result{}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
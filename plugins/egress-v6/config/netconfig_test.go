@@ -0,0 +1,77 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// All defaults.
+		`{}`,
+		// With optional fields.
+		`{"ulaCIDR":"fd00::100:0/120", "nodeIPAddress":"2600:1f14:0:1::10", "interfaceName":"egress0", "mtu":"1500"}`,
+		// Chained.
+		`{"cniVersion":"0.3.1", "prevResult":{"cniVersion":"0.3.1", "interfaces":[{"name":"eth0"}]}}`,
+	}
+
+	invalidConfigs = []string{
+		// IPv4 ULA CIDR.
+		`{"ulaCIDR":"10.0.0.0/24"}`,
+		// Invalid ULA CIDR.
+		`{"ulaCIDR":"fd00::"}`,
+		// IPv4 node IP address.
+		`{"nodeIPAddress":"10.0.1.10"}`,
+		// MTU too small for IPv6.
+		`{"mtu":"1000"}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestDefaults tests that optional fields are set to their defaults.
+func TestDefaults(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[0])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultULACIDR, netConfig.ULACIDR.String())
+	assert.Equal(t, DefaultInterfaceName, netConfig.InterfaceName)
+	assert.Equal(t, 9001, netConfig.MTU)
+	assert.Nil(t, netConfig.NodeIPAddress)
+	assert.NotNil(t, netConfig.PrevResult)
+}
@@ -0,0 +1,394 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipcfg"
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/egress-v6/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// hostVethNameFormat is the format of the names of host-side veth links.
+	hostVethNameFormat = "egv6%s"
+
+	// gatewayAddress is the link-local address of the host-side veth link, which is the default
+	// IPv6 gateway of the task.
+	gatewayAddress = "fe80::1/64"
+
+	// ruleCommentFormat is the format of the comments identifying the NAT rule of a task.
+	ruleCommentFormat = "egress-v6: %s"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Allocate a unique local address to the task.
+	pool, err := plugin.pool(netConfig)
+	if err != nil {
+		log.Errorf("Failed to create IP address pool: %v.", err)
+		return err
+	}
+
+	address, err := pool.Allocate(args.ContainerID)
+	if err != nil {
+		log.Errorf("Failed to allocate IPv6 address: %v.", err)
+		return err
+	}
+	address = &net.IPNet{IP: address.IP, Mask: net.CIDRMask(128, 128)}
+	log.Infof("Allocated IPv6 address %s.", address)
+
+	// Find the target network namespace.
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		log.Errorf("Failed to find netns %s: %v.", args.Netns, err)
+		return err
+	}
+
+	hostVethName := hostVethLinkName(args.ContainerID)
+
+	// Enable IPv6 forwarding on the host without losing router advertisements.
+	err = enableHostIPv6Forwarding()
+	if err != nil {
+		log.Errorf("Failed to enable IPv6 forwarding: %v.", err)
+		return err
+	}
+
+	// Connect the task network namespace to the host with a veth pair.
+	err = createVethPair(ns, hostVethName, netConfig.MTU)
+	if err != nil {
+		log.Errorf("Failed to create veth pair: %v.", err)
+		return err
+	}
+
+	// Set up the egress interface in the task network namespace.
+	var taskLink netlink.Link
+	err = ns.Run(func() error {
+		var err error
+		taskLink, err = setupTaskLink(hostVethName+"-2", netConfig.InterfaceName, address)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to set up egress interface in netns %s: %v.", args.Netns, err)
+		return err
+	}
+
+	// Route the task address to the veth link on the host and translate it on egress.
+	hostLink, err := setupHostLink(hostVethName, address)
+	if err != nil {
+		log.Errorf("Failed to set up host veth link: %v.", err)
+		return err
+	}
+
+	err = setupNAT(args.ContainerID, address, netConfig.NodeIPAddress, true)
+	if err != nil {
+		log.Errorf("Failed to set up NAT66 rule: %v.", err)
+		return err
+	}
+
+	// Add the egress interfaces to the previous result.
+	result := netConfig.PrevResult
+	result.Interfaces = append(result.Interfaces,
+		&cniTypesCurrent.Interface{
+			Name: hostLink.Attrs().Name,
+			Mac:  hostLink.Attrs().HardwareAddr.String(),
+		},
+		&cniTypesCurrent.Interface{
+			Name:    taskLink.Attrs().Name,
+			Mac:     taskLink.Attrs().HardwareAddr.String(),
+			Sandbox: args.Netns,
+		})
+
+	log.Infof("Writing CNI result to stdout: %+v", result)
+	return cniTypes.PrintResult(result, netConfig.CNIVersion)
+}
+
+// Del is the CNI DEL command handler.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	pool, err := plugin.pool(netConfig)
+	if err != nil {
+		log.Errorf("Failed to create IP address pool: %v.", err)
+		return err
+	}
+
+	address, err := pool.Release(args.ContainerID)
+	if err != nil {
+		log.Errorf("Failed to release IPv6 address: %v.", err)
+		return err
+	}
+
+	if address != nil {
+		log.Infof("Released IPv6 address %s.", address)
+		address = &net.IPNet{IP: address.IP, Mask: net.CIDRMask(128, 128)}
+		err = setupNAT(args.ContainerID, address, netConfig.NodeIPAddress, false)
+		if err != nil {
+			log.Errorf("Failed to delete NAT66 rule: %v.", err)
+			return err
+		}
+	}
+
+	// Deleting the host veth link also deletes its peer in the task network namespace.
+	hostVethName := hostVethLinkName(args.ContainerID)
+	link, err := netlink.LinkByName(hostVethName)
+	if err != nil {
+		log.Infof("Host veth link %s not found, ignoring: %v.", hostVethName, err)
+		return nil
+	}
+
+	log.Infof("Deleting host veth link %s.", hostVethName)
+	err = netlink.LinkDel(link)
+	if err != nil {
+		log.Errorf("Failed to delete host veth link %s: %v.", hostVethName, err)
+		return err
+	}
+
+	return nil
+}
+
+// pool returns the pool of unique local addresses.
+func (plugin *Plugin) pool(netConfig *config.NetConfig) (*ipam.Pool, error) {
+	return ipam.NewRangePool(plugin.StateDirPath, netConfig.Name, &ipam.Range{Subnet: netConfig.ULACIDR})
+}
+
+// hostVethLinkName returns the name of the host-side veth link of a task.
+func hostVethLinkName(containerID string) string {
+	if len(containerID) > 8 {
+		containerID = containerID[:8]
+	}
+	return fmt.Sprintf(hostVethNameFormat, containerID)
+}
+
+// enableHostIPv6Forwarding enables IPv6 forwarding on the host. Interfaces with an IPv6 default
+// route keep accepting router advertisements, which Linux disables by default on routers.
+func enableHostIPv6Forwarding() error {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_V6)
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		if route.Dst != nil {
+			continue
+		}
+
+		link, err := netlink.LinkByIndex(route.LinkIndex)
+		if err != nil {
+			return err
+		}
+
+		err = ipcfg.SetIPv6AcceptRA(link.Attrs().Name, 2)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ipcfg.SetIPv6Forwarding("all", 1)
+}
+
+// createVethPair creates a veth pair and moves the peer to the target network namespace.
+func createVethPair(ns netns.NetNS, vethLinkName string, mtu int) error {
+	// Check if the veth pair already exists.
+	_, err := netlink.LinkByName(vethLinkName)
+	if err == nil {
+		log.Infof("Found existing veth pair %s.", vethLinkName)
+		return nil
+	}
+
+	la := netlink.NewLinkAttrs()
+	la.Name = vethLinkName
+	la.MTU = mtu
+	vethLink := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  vethLinkName + "-2",
+	}
+
+	log.Infof("Creating veth pair %+v.", vethLink)
+	err = netlink.LinkAdd(vethLink)
+	if err != nil {
+		return err
+	}
+
+	peer, err := netlink.LinkByName(vethLink.PeerName)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Moving veth link peer %s to target netns.", vethLink.PeerName)
+	return netlink.LinkSetNsFd(peer, int(ns.GetFd()))
+}
+
+// setupTaskLink configures the egress interface in the task network namespace.
+func setupTaskLink(vethPeerName string, ifName string, address *net.IPNet) (netlink.Link, error) {
+	// Check if the egress interface already exists.
+	link, err := netlink.LinkByName(ifName)
+	if err == nil {
+		log.Infof("Found existing egress interface %s.", ifName)
+		return link, nil
+	}
+
+	link, err = netlink.LinkByName(vethPeerName)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Renaming link %s to %s.", vethPeerName, ifName)
+	err = netlink.LinkSetName(link, ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	// IPv6 may be disabled in IPv4-only task network namespaces.
+	for _, name := range []string{"all", "default", ifName} {
+		err = ipcfg.SetIPv6Disable(name, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ipcfg.SetIPv6AcceptDAD(ifName, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err = netlink.LinkByName(ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Assigning IPv6 address %s to link %s.", address, ifName)
+	err = netlink.AddrAdd(link, &netlink.Addr{IPNet: address, Flags: unix.IFA_F_NODAD})
+	if err != nil {
+		return nil, err
+	}
+
+	// Route all IPv6 traffic to the host.
+	gateway, _, _ := net.ParseCIDR(gatewayAddress)
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+		Gw:        gateway,
+	}
+
+	log.Infof("Adding default IPv6 route %+v.", route)
+	err = netlink.RouteAdd(route)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// setupHostLink configures the host-side veth link as the task's gateway.
+func setupHostLink(vethLinkName string, address *net.IPNet) (netlink.Link, error) {
+	link, err := netlink.LinkByName(vethLinkName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := netlink.ParseAddr(gatewayAddress)
+	if err != nil {
+		return nil, err
+	}
+	gateway.Flags = unix.IFA_F_NODAD
+
+	err = netlink.AddrReplace(link, gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       address,
+		Scope:     netlink.SCOPE_LINK,
+	}
+
+	log.Infof("Adding host IPv6 route %+v.", route)
+	err = netlink.RouteReplace(route)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// setupNAT adds or deletes the rule that translates egress traffic from a task address to the
+// node IPv6 address.
+func setupNAT(containerID string, address *net.IPNet, nodeIPAddress net.IP, add bool) error {
+	ip6t, err := iptables.NewWithProtocol(iptables.ProtocolIPv6)
+	if err != nil {
+		return err
+	}
+
+	rule := []string{"-s", address.String(), "-m", "comment", "--comment",
+		fmt.Sprintf(ruleCommentFormat, containerID)}
+	if nodeIPAddress != nil {
+		rule = append(rule, "-j", "SNAT", "--to-source", nodeIPAddress.String())
+	} else {
+		rule = append(rule, "-j", "MASQUERADE")
+	}
+
+	if add {
+		log.Infof("Adding NAT66 rule %v.", rule)
+		return ip6t.AppendUnique("nat", "POSTROUTING", rule...)
+	}
+
+	exists, err := ip6t.Exists("nat", "POSTROUTING", rule...)
+	if err != nil || !exists {
+		return err
+	}
+
+	log.Infof("Deleting NAT66 rule %v.", rule)
+	return ip6t.Delete("nat", "POSTROUTING", rule...)
+}
@@ -39,6 +39,16 @@ type NetConfig struct {
 	BlockIMDS          bool
 	InterfaceType      string
 	Tap                *TAPConfig
+	Association        *BranchAssociation
+}
+
+// BranchAssociation defines the EC2 association of the branch ENI with the trunk ENI, which is
+// validated before the branch ENI is wired to the task.
+type BranchAssociation struct {
+	AssociationID    string
+	BranchENIID      string
+	TrunkENIID       string
+	SecurityGroupIDs []string
 }
 
 // TAPConfig defines a TAP interface configuration.
@@ -61,6 +71,10 @@ type netConfigJSON struct {
 	InterfaceType      string   `json:"interfaceType"`
 	Uid                string   `json:"uid"`
 	Gid                string   `json:"gid"`
+	AssociationID      string   `json:"associationID"`
+	BranchENIID        string   `json:"branchENIID"`
+	TrunkENIID         string   `json:"trunkENIID"`
+	SecurityGroupIDs   []string `json:"securityGroupIDs"`
 }
 
 // pcArgs defines the per-container arguments passed in CNI_ARGS environment variable.
@@ -70,6 +84,9 @@ type pcArgs struct {
 	BranchMACAddress   cniTypes.UnmarshallableString
 	IPAddresses        cniTypes.UnmarshallableString
 	GatewayIPAddresses cniTypes.UnmarshallableString
+	AssociationID      cniTypes.UnmarshallableString
+	BranchENIID        cniTypes.UnmarshallableString
+	SecurityGroupIDs   cniTypes.UnmarshallableString
 }
 
 const (
@@ -116,6 +133,15 @@ func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
 		if pca.GatewayIPAddresses != "" {
 			config.GatewayIPAddresses = strings.Split(string(pca.GatewayIPAddresses), ",")
 		}
+		if pca.AssociationID != "" {
+			config.AssociationID = string(pca.AssociationID)
+		}
+		if pca.BranchENIID != "" {
+			config.BranchENIID = string(pca.BranchENIID)
+		}
+		if pca.SecurityGroupIDs != "" {
+			config.SecurityGroupIDs = strings.Split(string(pca.SecurityGroupIDs), ",")
+		}
 	}
 
 	// Set defaults.
@@ -212,6 +238,23 @@ func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
 		}
 	}
 
+	// Parse the optional branch association.
+	if config.AssociationID != "" || config.BranchENIID != "" || config.SecurityGroupIDs != nil {
+		if config.AssociationID == "" {
+			return nil, fmt.Errorf("missing required parameter associationID")
+		}
+		if config.BranchENIID == "" {
+			return nil, fmt.Errorf("missing required parameter branchENIID")
+		}
+
+		netConfig.Association = &BranchAssociation{
+			AssociationID:    config.AssociationID,
+			BranchENIID:      config.BranchENIID,
+			TrunkENIID:       config.TrunkENIID,
+			SecurityGroupIDs: config.SecurityGroupIDs,
+		}
+	}
+
 	// Validation complete. Return the parsed NetConfig object.
 	log.Debugf("Created NetConfig: %+v", netConfig)
 	return &netConfig, nil
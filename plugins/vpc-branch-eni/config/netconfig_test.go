@@ -57,6 +57,14 @@ var (
 			netConfig: `{"trunkName":"eth1", "interfaceType": "vlan"}`,
 			pcArgs:    "BranchVlanID=10;BranchMACAddress=10:20:30:40:50:60;IPAddresses=192.168.1.2/16",
 		},
+		config{ // Branch association in netconfig.
+			netConfig: `{"trunkName":"eth1", "interfaceType": "vlan", "associationID":"trunk-assoc-1", "branchENIID":"eni-2", "trunkENIID":"eni-1", "securityGroupIDs":["sg-1"]}`,
+			pcArgs:    "BranchVlanID=10;BranchMACAddress=10:20:30:40:50:60",
+		},
+		config{ // Branch association in per-container args.
+			netConfig: `{"trunkName":"eth1", "interfaceType": "vlan"}`,
+			pcArgs:    "BranchVlanID=10;BranchMACAddress=10:20:30:40:50:60;AssociationID=trunk-assoc-1;BranchENIID=eni-2;SecurityGroupIDs=sg-1,sg-2",
+		},
 	}
 
 	invalidConfigs = []config{
@@ -72,6 +80,14 @@ var (
 			netConfig: `{"trunkName":"eth1", "branchVlanID":"100", "interfaceType":"tap"}`,
 			pcArgs:    "BranchMACAddress=10:20:30:40:50:60;IPAddresses=192.168.1.2/16",
 		},
+		config{ // missing branch ENI ID for branch association.
+			netConfig: `{"trunkName":"eth1", "interfaceType": "vlan", "associationID":"trunk-assoc-1"}`,
+			pcArgs:    "BranchVlanID=10;BranchMACAddress=10:20:30:40:50:60",
+		},
+		config{ // security groups without branch association.
+			netConfig: `{"trunkName":"eth1", "interfaceType": "vlan", "securityGroupIDs":["sg-1"]}`,
+			pcArgs:    "BranchVlanID=10;BranchMACAddress=10:20:30:40:50:60",
+		},
 	}
 )
 
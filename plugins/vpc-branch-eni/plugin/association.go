@@ -0,0 +1,107 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ec2"
+	"github.com/aws/amazon-vpc-cni-plugins/network/imds"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-branch-eni/config"
+
+	log "github.com/cihub/seelog"
+)
+
+// associationAPI is the set of EC2 calls used to validate branch associations.
+type associationAPI interface {
+	DescribeTrunkInterfaceAssociation(associationID string) (*ec2.TrunkInterfaceAssociation, error)
+	DescribeSecurityGroups(eniID string) ([]string, error)
+}
+
+// validateBranchAssociation validates that the branch ENI is associated with the trunk ENI on
+// the expected VLAN, and that it carries the expected security groups, before the branch ENI is
+// wired to the task.
+func (plugin *Plugin) validateBranchAssociation(netConfig *config.NetConfig) error {
+	assoc := netConfig.Association
+
+	api := plugin.ec2
+	if api == nil {
+		client, err := ec2.NewInstanceClient(imds.NewCachedClient())
+		if err != nil {
+			return fmt.Errorf("failed to create EC2 client: %v", err)
+		}
+		api = client
+	}
+
+	log.Infof("Validating branch association %s.", assoc.AssociationID)
+	association, err := api.DescribeTrunkInterfaceAssociation(assoc.AssociationID)
+	if err != nil {
+		return fmt.Errorf("failed to find branch association %s: %v", assoc.AssociationID, err)
+	}
+
+	var securityGroupIDs []string
+	if len(assoc.SecurityGroupIDs) != 0 {
+		securityGroupIDs, err = api.DescribeSecurityGroups(assoc.BranchENIID)
+		if err != nil {
+			return fmt.Errorf("failed to find security groups of branch %s: %v", assoc.BranchENIID, err)
+		}
+	}
+
+	return checkBranchAssociation(netConfig, association, securityGroupIDs)
+}
+
+// checkBranchAssociation checks a branch association and the security groups of the branch ENI
+// against the network configuration.
+func checkBranchAssociation(
+	netConfig *config.NetConfig,
+	association *ec2.TrunkInterfaceAssociation,
+	securityGroupIDs []string) error {
+
+	assoc := netConfig.Association
+
+	if association.BranchInterfaceID != assoc.BranchENIID {
+		return fmt.Errorf("branch association %s is for branch %s, expected %s",
+			assoc.AssociationID, association.BranchInterfaceID, assoc.BranchENIID)
+	}
+
+	if assoc.TrunkENIID != "" && association.TrunkInterfaceID != assoc.TrunkENIID {
+		return fmt.Errorf("branch association %s is for trunk %s, expected %s",
+			assoc.AssociationID, association.TrunkInterfaceID, assoc.TrunkENIID)
+	}
+
+	if association.VlanID != netConfig.BranchVlanID {
+		return fmt.Errorf("branch association %s is for VLAN %d, expected %d",
+			assoc.AssociationID, association.VlanID, netConfig.BranchVlanID)
+	}
+
+	actual := make(map[string]bool)
+	for _, id := range securityGroupIDs {
+		actual[id] = true
+	}
+
+	var missing []string
+	for _, id := range assoc.SecurityGroupIDs {
+		if !actual[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("branch %s is missing security groups %s",
+			assoc.BranchENIID, strings.Join(missing, ","))
+	}
+
+	return nil
+}
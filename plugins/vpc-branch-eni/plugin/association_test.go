@@ -0,0 +1,59 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ec2"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-branch-eni/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckBranchAssociation(t *testing.T) {
+	netConfig := &config.NetConfig{
+		BranchVlanID: 10,
+		Association: &config.BranchAssociation{
+			AssociationID:    "trunk-assoc-1",
+			BranchENIID:      "eni-2",
+			TrunkENIID:       "eni-1",
+			SecurityGroupIDs: []string{"sg-1"},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		association ec2.TrunkInterfaceAssociation
+		groups      []string
+		valid       bool
+	}{
+		{"valid", ec2.TrunkInterfaceAssociation{BranchInterfaceID: "eni-2", TrunkInterfaceID: "eni-1", VlanID: 10}, []string{"sg-2", "sg-1"}, true},
+		{"other branch", ec2.TrunkInterfaceAssociation{BranchInterfaceID: "eni-3", TrunkInterfaceID: "eni-1", VlanID: 10}, []string{"sg-1"}, false},
+		{"other trunk", ec2.TrunkInterfaceAssociation{BranchInterfaceID: "eni-2", TrunkInterfaceID: "eni-4", VlanID: 10}, []string{"sg-1"}, false},
+		{"other VLAN", ec2.TrunkInterfaceAssociation{BranchInterfaceID: "eni-2", TrunkInterfaceID: "eni-1", VlanID: 11}, []string{"sg-1"}, false},
+		{"missing security group", ec2.TrunkInterfaceAssociation{BranchInterfaceID: "eni-2", TrunkInterfaceID: "eni-1", VlanID: 10}, []string{"sg-2"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkBranchAssociation(netConfig, &tc.association, tc.groups)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
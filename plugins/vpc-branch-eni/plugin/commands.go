@@ -57,6 +57,15 @@ func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
 		return err
 	}
 
+	// Validate the branch association before wiring the branch ENI to the task.
+	if netConfig.Association != nil {
+		err = plugin.validateBranchAssociation(netConfig)
+		if err != nil {
+			log.Errorf("Failed to validate branch association: %v.", err)
+			return err
+		}
+	}
+
 	// Create the trunk ENI.
 	trunk, err := eni.NewTrunk(netConfig.TrunkName, netConfig.TrunkMACAddress, eni.TrunkIsolationModeVLAN)
 	if err != nil {
@@ -443,7 +452,7 @@ func (plugin *Plugin) createMACVTAPLink(linkName string, parentIndex int) error
 	la.Name = linkName
 	la.ParentIndex = parentIndex
 	macvtapLink := &netlink.Macvtap{
-		netlink.Macvlan{
+		Macvlan: netlink.Macvlan{
 			LinkAttrs: la,
 			Mode:      netlink.MACVLAN_MODE_PASSTHRU,
 		},
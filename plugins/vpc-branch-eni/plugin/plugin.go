@@ -36,6 +36,8 @@ var (
 // Plugin represents a vpc-branch-eni CNI plugin.
 type Plugin struct {
 	*cni.Plugin
+	// ec2 validates branch associations. Created on demand if nil.
+	ec2 associationAPI
 }
 
 // NewPlugin creates a new vpc-branch-eni Plugin object.
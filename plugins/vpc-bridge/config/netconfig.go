@@ -0,0 +1,116 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// NetConfig defines the network configuration for the vpc-bridge plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	ENIName          string
+	ENIMACAddress    net.HardwareAddr
+	ENIIPAddress     *net.IPNet
+	VPCCIDRs         []net.IPNet
+	IPAddress        *net.IPNet
+	GatewayIPAddress net.IP
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-bridge plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	ENIName          string   `json:"eniName"`
+	ENIMACAddress    string   `json:"eniMACAddress"`
+	ENIIPAddress     string   `json:"eniIPAddress"`
+	VPCCIDRs         []string `json:"vpcCIDRs"`
+	IPAddress        string   `json:"ipAddress"`
+	GatewayIPAddress string   `json:"gatewayIPAddress"`
+}
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Validate if all the required fields are present.
+	if config.ENIName == "" && config.ENIMACAddress == "" {
+		return nil, fmt.Errorf("missing required parameter ENIName or ENIMACAddress")
+	}
+	if config.ENIIPAddress == "" {
+		return nil, fmt.Errorf("missing required parameter ENIIPAddress")
+	}
+	if config.IPAddress == "" {
+		return nil, fmt.Errorf("missing required parameter IPAddress")
+	}
+
+	// Populate NetConfig.
+	netConfig := NetConfig{
+		NetConf: config.NetConf,
+		ENIName: config.ENIName,
+	}
+
+	// Parse the ENI MAC address.
+	if config.ENIMACAddress != "" {
+		netConfig.ENIMACAddress, err = net.ParseMAC(config.ENIMACAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENIMACAddress %s", config.ENIMACAddress)
+		}
+	}
+
+	// Parse the ENI IP address, which remains assigned to the host.
+	netConfig.ENIIPAddress, err = vpc.GetIPAddressFromString(config.ENIIPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENIIPAddress %s", config.ENIIPAddress)
+	}
+
+	// Parse the optional VPC CIDR blocks.
+	for _, cidrString := range config.VPCCIDRs {
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VPCCIDR %s", cidrString)
+		}
+		netConfig.VPCCIDRs = append(netConfig.VPCCIDRs, *cidr)
+	}
+
+	// Parse the endpoint IP address.
+	netConfig.IPAddress, err = vpc.GetIPAddressFromString(config.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IPAddress %s", config.IPAddress)
+	}
+
+	// Parse the optional gateway IP address.
+	if config.GatewayIPAddress != "" {
+		netConfig.GatewayIPAddress = net.ParseIP(config.GatewayIPAddress)
+		if netConfig.GatewayIPAddress == nil {
+			return nil, fmt.Errorf("invalid GatewayIPAddress %s", config.GatewayIPAddress)
+		}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
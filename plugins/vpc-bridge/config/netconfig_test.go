@@ -0,0 +1,66 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	validConfigs = []string{
+		// All required fields.
+		`{"eniName":"eth1", "eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24"}`,
+		// ENIMACAddress instead of ENIName.
+		`{"eniMACAddress":"12:34:56:78:9a:bc", "eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24"}`,
+		// With optional fields.
+		`{"eniName":"eth1", "eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24",
+		  "gatewayIPAddress":"10.0.1.1", "vpcCIDRs":["10.0.0.0/16"]}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing ENI.
+		`{"eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24"}`,
+		// Missing ENI IP address.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24"}`,
+		// Missing endpoint IP address.
+		`{"eniName":"eth1", "eniIPAddress":"10.0.1.10/24"}`,
+		// Invalid gateway IP address.
+		`{"eniName":"eth1", "eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24", "gatewayIPAddress":"10.0.1"}`,
+		// Invalid VPC CIDR block.
+		`{"eniName":"eth1", "eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24", "vpcCIDRs":["10.0.0.0"]}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
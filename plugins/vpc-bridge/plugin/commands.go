@@ -0,0 +1,191 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-bridge/config"
+	sharedENIConfig "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	nw, err := plugin.newNetwork(netConfig)
+	if err != nil {
+		return err
+	}
+
+	// Serialize operations on the network of the ENI across plugin processes.
+	unlock, err := plugin.lockNetwork(netConfig, nw.SharedENI)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Find or create the bridge for the ENI.
+	nb := plugin.builder()
+	err = nb.FindOrCreateNetwork(nw)
+	if err != nil {
+		log.Errorf("Failed to create network: %v.", err)
+		return err
+	}
+
+	// Find or create the container endpoint on the bridge.
+	ep := plugin.newEndpoint(args, netConfig)
+	err = nb.FindOrCreateEndpoint(nw, ep)
+	if err != nil {
+		log.Errorf("Failed to create endpoint: %v.", err)
+		return err
+	}
+
+	// In explain mode, output the planned operations instead of a CNI result.
+	if eb, ok := nb.(*network.ExplainBuilder); ok {
+		return eb.Print(plugin.stdout)
+	}
+
+	// Generate CNI result.
+	result := &cniTypesCurrent.Result{
+		Interfaces: []*cniTypesCurrent.Interface{
+			{
+				Name:    args.IfName,
+				Mac:     ep.MACAddress.String(),
+				Sandbox: args.Netns,
+			},
+		},
+		IPs: []*cniTypesCurrent.IPConfig{
+			{
+				Version:   vpc.GetIPVersion(netConfig.IPAddress.IP),
+				Interface: cniTypesCurrent.Int(0),
+				Address:   *netConfig.IPAddress,
+				Gateway:   netConfig.GatewayIPAddress,
+			},
+		},
+	}
+
+	// Output CNI result.
+	log.Infof("Writing CNI result to stdout: %+v", result)
+	err = cni.WriteResult(plugin.stdout, result, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+	}
+
+	return err
+}
+
+// Del is the CNI DEL command handler.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	nw, err := plugin.newNetwork(netConfig)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := plugin.lockNetwork(netConfig, nw.SharedENI)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	nb := plugin.builder()
+	err = nb.DeleteEndpoint(nw, plugin.newEndpoint(args, netConfig))
+	if err != nil {
+		// DEL is best-effort. Log and ignore the failure.
+		log.Errorf("Failed to delete endpoint, ignoring: %v", err)
+	}
+
+	// Delete the bridge with the last endpoint, returning the ENI to its original configuration.
+	reaper := &network.Reaper{
+		StateDir:      plugin.StateDirPath,
+		Builder:       nb,
+		ListEndpoints: plugin.listEndpoints,
+	}
+	_, err = reaper.DeleteIfUnused(nw)
+	if err != nil {
+		log.Errorf("Failed to delete network %s, ignoring: %v.", nw.Name, err)
+	}
+
+	// In explain mode, output the planned operations.
+	if eb, ok := nb.(*network.ExplainBuilder); ok {
+		return eb.Print(plugin.stdout)
+	}
+
+	return nil
+}
+
+// newNetwork returns the bridge network for the ENI in the given network configuration.
+func (plugin *Plugin) newNetwork(netConfig *config.NetConfig) (*network.Network, error) {
+	// Find the ENI.
+	sharedENI, err := eni.NewENI(netConfig.ENIName, netConfig.ENIMACAddress)
+	if err != nil {
+		log.Errorf("Failed to find ENI %s: %v.", netConfig.ENIName, err)
+		return nil, err
+	}
+
+	// Find the ENI link.
+	err = sharedENI.AttachToLink()
+	if err != nil {
+		log.Errorf("Failed to find ENI link: %v.", err)
+		return nil, err
+	}
+
+	// In layer3 mode, the IP address and default route remain on the ENI and the host routes
+	// between the bridge and the ENI.
+	return &network.Network{
+		Name:                netConfig.Name,
+		BridgeType:          sharedENIConfig.BridgeTypeL3,
+		SharedENI:           sharedENI,
+		ENIIPAddress:        netConfig.ENIIPAddress,
+		GatewayIPAddress:    netConfig.GatewayIPAddress,
+		VPCCIDRs:            netConfig.VPCCIDRs,
+		DNSServers:          netConfig.DNS.Nameservers,
+		DNSSuffixSearchList: netConfig.DNS.Search,
+	}, nil
+}
+
+// newEndpoint returns the container endpoint for the given CNI arguments.
+func (plugin *Plugin) newEndpoint(args *cniSkel.CmdArgs, netConfig *config.NetConfig) *network.Endpoint {
+	return &network.Endpoint{
+		ContainerID: args.ContainerID,
+		NetNSName:   args.Netns,
+		IfName:      args.IfName,
+		IfType:      sharedENIConfig.IfTypeVETH,
+		IPAddress:   netConfig.IPAddress,
+	}
+}
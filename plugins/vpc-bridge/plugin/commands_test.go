@@ -0,0 +1,87 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPlugin returns a plugin wired to a fake network builder.
+func newTestPlugin(t *testing.T) (*Plugin, *fake.Builder) {
+	plugin, err := NewPlugin()
+	require.NoError(t, err)
+
+	nb := fake.NewBuilder()
+	plugin.nb = nb
+	plugin.listEndpoints = nb.ListEndpoints
+	plugin.stdout = ioutil.Discard
+
+	plugin.StateDirPath, err = ioutil.TempDir("", "vpc-bridge")
+	require.NoError(t, err)
+
+	return plugin, nb
+}
+
+// newTestArgs returns CNI arguments for a network configuration that refers to an interface
+// present on the test host.
+func newTestArgs(t *testing.T, containerID string, ipAddress string) *cniSkel.CmdArgs {
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	require.NotEmpty(t, interfaces)
+
+	netConfig := fmt.Sprintf(`{
+		"cniVersion": "0.3.1",
+		"name": "vpc",
+		"type": "vpc-bridge",
+		"eniName": "%s",
+		"eniIPAddress": "10.0.1.10/24",
+		"vpcCIDRs": ["10.0.0.0/16"],
+		"ipAddress": "%s",
+		"gatewayIPAddress": "10.0.1.1"
+	}`, interfaces[0].Name, ipAddress)
+
+	return &cniSkel.CmdArgs{
+		ContainerID: containerID,
+		Netns:       "none",
+		IfName:      "eth0",
+		StdinData:   []byte(netConfig),
+	}
+}
+
+func TestDelDeletesUnusedNetwork(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer os.RemoveAll(plugin.StateDirPath)
+
+	args1 := newTestArgs(t, "container1", "10.0.1.20/24")
+	args2 := newTestArgs(t, "container2", "10.0.1.21/24")
+	require.NoError(t, plugin.Add(args1))
+	require.NoError(t, plugin.Add(args2))
+
+	// The bridge is kept while other endpoints use it.
+	require.NoError(t, plugin.Del(args1))
+	assert.True(t, nb.HasNetwork("vpc"))
+
+	require.NoError(t, plugin.Del(args2))
+	assert.False(t, nb.HasNetwork("vpc"))
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"io"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-bridge/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+const (
+	// pluginName is the name of the plugin as specified in CNI config files.
+	pluginName = "vpc-bridge"
+
+	// logFilePath is the path to the plugin's log file.
+	logFilePath = "/var/log/vpc-bridge.log"
+)
+
+var (
+	// specVersions is the set of CNI spec versions supported by this plugin.
+	specVersions = cniVersion.PluginSupports("0.3.0", "0.3.1")
+)
+
+// Plugin represents a vpc-bridge CNI plugin.
+//
+// Unlike vpc-shared-eni in layer2 mode, the host keeps the ENI and its IP address. Endpoints are
+// connected to a bridge and reach the VPC through the host, which routes their traffic and acts
+// as their gateway. This allows traffic between the host and endpoints on the same ENI. On
+// Windows, endpoints are connected to an HNS L2Bridge network on the ENI instead.
+type Plugin struct {
+	*cni.Plugin
+	nb            network.Builder
+	listEndpoints func() ([]network.EndpointRecord, error)
+	// stdout receives CNI results and explain mode output.
+	stdout io.Writer
+}
+
+// NewPlugin creates a new Plugin object.
+func NewPlugin() (*Plugin, error) {
+	var err error
+	plugin := &Plugin{}
+
+	plugin.Plugin, err = cni.NewPlugin(pluginName, specVersions, logFilePath, plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin.nb = network.NewBridgeBuilder(plugin.StateDirPath)
+	plugin.listEndpoints = network.ListEndpoints
+	plugin.stdout = os.Stdout
+
+	return plugin, nil
+}
+
+// builder returns the network builder for the CNI command being executed.
+func (plugin *Plugin) builder() network.Builder {
+	if plugin.Explain {
+		return &network.ExplainBuilder{}
+	}
+
+	return plugin.nb
+}
+
+// lockNetwork acquires the lock of the network on the given ENI, which serializes operations on
+// the network across plugin processes, and returns a function that releases it.
+func (plugin *Plugin) lockNetwork(netConfig *config.NetConfig, sharedENI *eni.ENI) (func(), error) {
+	if plugin.Explain {
+		return func() {}, nil
+	}
+
+	unlock, err := state.LockNetwork(plugin.StateDirPath, sharedENI.GetMACAddress().String())
+	if err != nil {
+		log.Errorf("Failed to lock network %s: %v.", netConfig.Name, err)
+		return nil, err
+	}
+
+	return unlock, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// NetConfig defines the network configuration for the vpc-efa plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	EFAName          string
+	EFAMACAddress    net.HardwareAddr
+	IPAddresses      []net.IPNet
+	GatewayIPAddress net.IP
+	MTU              int
+	InterfaceName    string
+	PrevResult       *cniTypesCurrent.Result
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-efa plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	EFAName          string                 `json:"efaName"`
+	EFAMACAddress    string                 `json:"efaMACAddress"`
+	IPAddresses      []string               `json:"ipAddresses"`
+	GatewayIPAddress string                 `json:"gatewayIPAddress"`
+	MTU              string                 `json:"mtu"`
+	InterfaceName    string                 `json:"interfaceName"`
+	PrevResult       map[string]interface{} `json:"prevResult,omitempty"`
+}
+
+// pcArgs defines the per-container arguments passed in CNI_ARGS environment variable.
+type pcArgs struct {
+	cniTypes.CommonArgs
+	EFAMACAddress cniTypes.UnmarshallableString
+	IPAddresses   cniTypes.UnmarshallableString
+}
+
+const (
+	// DefaultMTU is the default MTU of EFA interfaces, which support jumbo frames.
+	DefaultMTU = 9001
+
+	// DefaultInterfaceName is the default name of EFA interfaces when the plugin is chained,
+	// since the previous plugins already use the CNI interface name.
+	DefaultInterfaceName = "efa0"
+
+	// Whether the plugin ignores unknown per-container arguments.
+	ignoreUnknown = true
+)
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Parse optional per-container arguments.
+	if args.Args != "" {
+		var pca pcArgs
+		pca.IgnoreUnknown = ignoreUnknown
+
+		if err := cniTypes.LoadArgs(args.Args, &pca); err != nil {
+			return nil, fmt.Errorf("failed to parse per-container args: %v", err)
+		}
+
+		// Per-container arguments override the ones from network configuration.
+		if pca.EFAMACAddress != "" {
+			config.EFAMACAddress = string(pca.EFAMACAddress)
+		}
+		if pca.IPAddresses != "" {
+			config.IPAddresses = strings.Split(string(pca.IPAddresses), ",")
+		}
+	}
+
+	// Validate if all the required fields are present.
+	if config.EFAName == "" && config.EFAMACAddress == "" {
+		return nil, fmt.Errorf("missing required parameter efaName or efaMACAddress")
+	}
+
+	netConfig := NetConfig{
+		NetConf:       config.NetConf,
+		EFAName:       config.EFAName,
+		MTU:           DefaultMTU,
+		InterfaceName: config.InterfaceName,
+	}
+
+	// Parse the EFA MAC address.
+	if config.EFAMACAddress != "" {
+		netConfig.EFAMACAddress, err = net.ParseMAC(config.EFAMACAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid efaMACAddress %s", config.EFAMACAddress)
+		}
+	}
+
+	// Parse the optional EFA IP addresses.
+	for _, ipAddress := range config.IPAddresses {
+		address, err := vpc.GetIPAddressFromString(ipAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ipAddress %s", ipAddress)
+		}
+		netConfig.IPAddresses = append(netConfig.IPAddresses, *address)
+	}
+
+	// Parse the optional gateway IP address.
+	if config.GatewayIPAddress != "" {
+		netConfig.GatewayIPAddress = net.ParseIP(config.GatewayIPAddress)
+		if netConfig.GatewayIPAddress == nil {
+			return nil, fmt.Errorf("invalid gatewayIPAddress %s", config.GatewayIPAddress)
+		}
+	}
+
+	// Parse the optional MTU.
+	if config.MTU != "" {
+		netConfig.MTU, err = strconv.Atoi(config.MTU)
+		if err != nil || netConfig.MTU < 68 || netConfig.MTU > DefaultMTU {
+			return nil, fmt.Errorf("invalid mtu %s", config.MTU)
+		}
+	}
+
+	if config.PrevResult != nil {
+		// Plugin was called as part of a chain. Parse the previous result to pass forward.
+		prevResBytes, err := json.Marshal(config.PrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize prevResult: %v", err)
+		}
+
+		prevRes, err := cniVersion.NewResult(config.CNIVersion, prevResBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+		}
+
+		netConfig.PrevResult, err = cniTypesCurrent.NewResultFromResult(prevRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+		}
+		if netConfig.InterfaceName == "" {
+			netConfig.InterfaceName = DefaultInterfaceName
+		}
+	} else {
+		// Plugin was called stand-alone.
+		netConfig.PrevResult = &cniTypesCurrent.Result{}
+
+		if netConfig.InterfaceName == "" {
+			netConfig.InterfaceName = args.IfName
+		}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
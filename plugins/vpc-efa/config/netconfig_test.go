@@ -0,0 +1,95 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type config struct {
+	netConfig string
+	pcArgs    string
+}
+
+var (
+	validConfigs = []config{
+		{ // All required fields.
+			netConfig: `{"efaMACAddress":"12:34:56:78:9a:bc"}`,
+		},
+		{ // EFA name and optional fields.
+			netConfig: `{"efaName":"eth2", "ipAddresses":["10.0.2.20/24"], "gatewayIPAddress":"10.0.2.1", "mtu":"8900"}`,
+		},
+		{ // EFA fields in per-container args.
+			netConfig: `{}`,
+			pcArgs:    "EFAMACAddress=12:34:56:78:9a:bc;IPAddresses=10.0.2.20/24,2600:1f14::20/64",
+		},
+		{ // Chained.
+			netConfig: `{"cniVersion":"0.3.1", "efaName":"eth2",
+				"prevResult":{"cniVersion":"0.3.1", "interfaces":[{"name":"eth0"}]}}`,
+		},
+	}
+
+	invalidConfigs = []config{
+		{ // Missing EFA name and MAC address.
+			netConfig: `{"ipAddresses":["10.0.2.20/24"]}`,
+		},
+		{ // Invalid EFA MAC address.
+			netConfig: `{"efaMACAddress":"12:34:56"}`,
+		},
+		{ // Invalid IP address.
+			netConfig: `{"efaName":"eth2", "ipAddresses":["10.0.2.20"]}`,
+		},
+		{ // Invalid gateway IP address.
+			netConfig: `{"efaName":"eth2", "gatewayIPAddress":"10.0.2"}`,
+		},
+		{ // MTU too large.
+			netConfig: `{"efaName":"eth2", "mtu":"9216"}`,
+		},
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config.netConfig), Args: config.pcArgs}
+		_, err := New(args)
+		assert.NoError(t, err, config.netConfig)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config.netConfig), Args: config.pcArgs}
+		_, err := New(args)
+		assert.Error(t, err, config.netConfig)
+	}
+}
+
+// TestDefaults tests that optional fields are set to their defaults.
+func TestDefaults(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[0].netConfig)}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultMTU, netConfig.MTU)
+	assert.Empty(t, netConfig.IPAddresses)
+	assert.NotNil(t, netConfig.PrevResult)
+}
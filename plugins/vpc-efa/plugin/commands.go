@@ -0,0 +1,314 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-efa/config"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// rdmaCommand is the name of the iproute2 command used for assigning RDMA devices to
+	// network namespaces, which the netlink library does not support.
+	rdmaCommand = "rdma"
+
+	// stateFileNameFormat is the format of the names of files recording EFA attachments.
+	stateFileNameFormat = "%s-%s.json"
+)
+
+// efaState records an EFA attached to a task, so that it can be returned to the host.
+type efaState struct {
+	LinkName   string
+	MACAddress string
+	Devices    efaDevices
+}
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Find the target network namespace.
+	log.Infof("Searching for netns %s.", args.Netns)
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		log.Errorf("Failed to find netns %s: %v.", args.Netns, err)
+		return err
+	}
+
+	// Find the EFA.
+	efa, err := eni.NewENI(netConfig.EFAName, netConfig.EFAMACAddress)
+	if err != nil {
+		log.Errorf("Failed to find EFA: %v.", err)
+		return err
+	}
+
+	err = efa.AttachToLink()
+	if err != nil {
+		// The EFA may have been moved to the target network namespace by a previous ADD.
+		err = ns.Run(func() error {
+			return efa.AttachToLink()
+		})
+		if err != nil {
+			log.Errorf("Failed to find EFA link: %v.", err)
+			return err
+		}
+		log.Infof("Found EFA link %s in netns %s.", efa, args.Netns)
+	} else {
+		err = plugin.moveEFA(efa, ns, args, netConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Configure the EFA link in the target network namespace.
+	err = ns.Run(func() error {
+		return plugin.setupEFALink(efa, netConfig)
+	})
+	if err != nil {
+		log.Errorf("Failed to setup EFA link: %v.", err)
+		return err
+	}
+
+	// Append the EFA interface to the previous result.
+	result := netConfig.PrevResult
+	result.Interfaces = append(result.Interfaces, &cniTypesCurrent.Interface{
+		Name:    netConfig.InterfaceName,
+		Mac:     efa.GetMACAddress().String(),
+		Sandbox: args.Netns,
+	})
+	ifIndex := len(result.Interfaces) - 1
+	for _, ipAddress := range netConfig.IPAddresses {
+		version := "4"
+		if ipAddress.IP.To4() == nil {
+			version = "6"
+		}
+		result.IPs = append(result.IPs, &cniTypesCurrent.IPConfig{
+			Version:   version,
+			Interface: cniTypesCurrent.Int(ifIndex),
+			Address:   ipAddress,
+			Gateway:   netConfig.GatewayIPAddress,
+		})
+	}
+
+	// Output CNI result.
+	log.Infof("Writing CNI result to stdout: %+v", result)
+	err = cniTypes.PrintResult(result, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+	}
+
+	return err
+}
+
+// Del is the CNI DEL command handler.
+// CNI DEL command can be called by the orchestrator multiple times for the same interface,
+// and thus must be best-effort and idempotent.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	statePath := plugin.getStatePath(args.ContainerID, netConfig.InterfaceName)
+	var efaState efaState
+	found, err := state.ReadJSONFile(statePath, &efaState)
+	if err != nil || !found {
+		log.Infof("EFA attachment state not found, ignoring: %v.", err)
+		return nil
+	}
+
+	// Search for the target network namespace. Physical links, and in exclusive mode RDMA
+	// devices, return to the host network namespace when the network namespace is deleted.
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		log.Infof("Failed to find netns %s, ignoring: %v.", args.Netns, err)
+		os.Remove(statePath)
+		return nil
+	}
+
+	hostNS, err := netns.GetNetNS("/proc/1/ns/net")
+	if err != nil {
+		log.Errorf("Failed to find host netns: %v.", err)
+		return err
+	}
+
+	// Return the EFA link to the host network namespace under its original name.
+	err = ns.Run(func() error {
+		link, err := netlink.LinkByName(netConfig.InterfaceName)
+		if err != nil {
+			log.Infof("EFA link %s not found, ignoring: %v.", netConfig.InterfaceName, err)
+			return nil
+		}
+
+		err = netlink.LinkSetDown(link)
+		if err != nil {
+			return err
+		}
+
+		err = netlink.LinkSetName(link, efaState.LinkName)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Moving EFA link %s to host netns.", efaState.LinkName)
+		return netlink.LinkSetNsFd(link, int(hostNS.GetFd()))
+	})
+	if err != nil {
+		log.Errorf("Failed to return EFA link to host netns: %v.", err)
+		return err
+	}
+
+	os.Remove(statePath)
+	return nil
+}
+
+// moveEFA moves an EFA and its RDMA devices from the host to the target network namespace, and
+// records the attachment.
+func (plugin *Plugin) moveEFA(
+	efa *eni.ENI, ns netns.NetNS, args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	devices, err := findEFADevices(efa.GetLinkName())
+	if err != nil {
+		log.Errorf("Failed to find EFA devices: %v.", err)
+		return err
+	}
+
+	log.Infof("Found EFA %s with RDMA devices %v and device files %v.",
+		efa, devices.RDMADevices, devices.DeviceFiles)
+
+	// Record the attachment before moving the EFA, so that DEL can return it to the host.
+	var efaState efaState
+	statePath := plugin.getStatePath(args.ContainerID, netConfig.InterfaceName)
+	err = state.UpdateJSONFile(statePath, &efaState, func() error {
+		efaState.LinkName = efa.GetLinkName()
+		efaState.MACAddress = efa.GetMACAddress().String()
+		efaState.Devices = *devices
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Failed to record EFA attachment: %v.", err)
+		return err
+	}
+
+	// In shared mode, RDMA devices are visible in all network namespaces and the task only
+	// needs access to the device files. In exclusive mode, they must be assigned to the target
+	// network namespace, which the rdma command only supports for named network namespaces.
+	if isRDMANetNSExclusive() {
+		nsName, err := getNetNSName(args.Netns)
+		if err != nil {
+			return err
+		}
+
+		for _, device := range devices.RDMADevices {
+			log.Infof("Moving RDMA device %s to netns %s.", device, nsName)
+			_, err = command.Run(rdmaCommand, "dev", "set", device, "netns", nsName)
+			if err != nil {
+				log.Errorf("Failed to move RDMA device %s: %v.", device, err)
+				return err
+			}
+		}
+	}
+
+	log.Infof("Moving EFA link %s to netns %s.", efa, args.Netns)
+	err = efa.SetNetNS(ns)
+	if err != nil {
+		log.Errorf("Failed to move EFA link: %v.", err)
+	}
+
+	return err
+}
+
+// setupEFALink configures the EFA link in the current network namespace.
+func (plugin *Plugin) setupEFALink(efa *eni.ENI, netConfig *config.NetConfig) error {
+	ifName := netConfig.InterfaceName
+	if efa.GetLinkName() != ifName {
+		log.Infof("Renaming EFA link %s to %s.", efa, ifName)
+		err := efa.SetLinkName(ifName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := efa.SetLinkMTU(uint(netConfig.MTU))
+	if err != nil {
+		return err
+	}
+
+	for _, ipAddress := range netConfig.IPAddresses {
+		address := ipAddress
+		log.Infof("Assigning IP address %v to EFA link %s.", address, ifName)
+		err = efa.AddIPAddress(&address)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+
+	err = efa.SetOpState(true)
+	if err != nil {
+		return err
+	}
+
+	if netConfig.GatewayIPAddress == nil {
+		return nil
+	}
+
+	// Add a default route through the gateway, typically when the EFA is the only task interface.
+	route := &netlink.Route{
+		LinkIndex: efa.GetLinkIndex(),
+		Gw:        netConfig.GatewayIPAddress,
+	}
+
+	log.Infof("Adding default IP route %+v.", route)
+	return netlink.RouteReplace(route)
+}
+
+// getStatePath returns the path of the file recording the EFA attached to a task interface.
+func (plugin *Plugin) getStatePath(containerID string, ifName string) string {
+	return filepath.Join(plugin.StateDirPath, fmt.Sprintf(stateFileNameFormat, containerID, ifName))
+}
+
+// getNetNSName returns the name of a named network namespace from its path.
+func getNetNSName(path string) (string, error) {
+	dir := filepath.Dir(path)
+	if dir != "/var/run/netns" && dir != "/run/netns" {
+		return "", fmt.Errorf("exclusive RDMA netns mode requires a named netns, got %s", path)
+	}
+
+	return filepath.Base(path), nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// rdmaDeviceDirPath is the directory of RDMA user verbs device files.
+	rdmaDeviceDirPath = "/dev/infiniband"
+
+	// rdmaNetNSModeExclusive is the ib_core netns_mode parameter value in which RDMA devices
+	// are only visible in the network namespace they are assigned to.
+	rdmaNetNSModeExclusive = "N"
+)
+
+// sysfsRoot is the mount point of sysfs. It is a variable so that tests can replace it.
+var sysfsRoot = "/sys"
+
+// efaDevices describes the RDMA devices of an EFA.
+type efaDevices struct {
+	// RDMADevices are the names of the RDMA devices (e.g. efa_0).
+	RDMADevices []string
+	// DeviceFiles are the user verbs device files (e.g. /dev/infiniband/uverbs0).
+	DeviceFiles []string
+}
+
+// findEFADevices returns the RDMA devices of the EFA with the given link name.
+func findEFADevices(linkName string) (*efaDevices, error) {
+	deviceDir := filepath.Join(sysfsRoot, "class", "net", linkName, "device")
+
+	rdmaDevices, err := readDirNames(filepath.Join(deviceDir, "infiniband"))
+	if err != nil || len(rdmaDevices) == 0 {
+		return nil, fmt.Errorf("link %s is not an EFA: no RDMA device found", linkName)
+	}
+
+	verbsDevices, err := readDirNames(filepath.Join(deviceDir, "infiniband_verbs"))
+	if err != nil || len(verbsDevices) == 0 {
+		return nil, fmt.Errorf("link %s is not an EFA: no user verbs device found", linkName)
+	}
+
+	devices := &efaDevices{RDMADevices: rdmaDevices}
+	for _, name := range verbsDevices {
+		devices.DeviceFiles = append(devices.DeviceFiles, filepath.Join(rdmaDeviceDirPath, name))
+	}
+
+	return devices, nil
+}
+
+// isRDMANetNSExclusive returns whether RDMA devices are exclusive to network namespaces. Older
+// kernels without the parameter always share RDMA devices across network namespaces.
+func isRDMANetNSExclusive() bool {
+	data, err := ioutil.ReadFile(filepath.Join(sysfsRoot, "module", "ib_core", "parameters", "netns_mode"))
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(data)) == rdmaNetNSModeExclusive
+}
+
+// readDirNames returns the sorted names of the entries in a directory.
+func readDirNames(path string) ([]string, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSysfs creates a fake sysfs with an EFA link and returns a function that restores sysfsRoot.
+func setupSysfs(t *testing.T, netnsMode string) func() {
+	dir, err := ioutil.TempDir("", "sysfs")
+	require.NoError(t, err)
+
+	deviceDir := filepath.Join(dir, "class", "net", "eth1", "device")
+	require.NoError(t, os.MkdirAll(filepath.Join(deviceDir, "infiniband", "efa_0"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(deviceDir, "infiniband_verbs", "uverbs0"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "class", "net", "eth0", "device"), 0755))
+
+	if netnsMode != "" {
+		paramDir := filepath.Join(dir, "module", "ib_core", "parameters")
+		require.NoError(t, os.MkdirAll(paramDir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(paramDir, "netns_mode"), []byte(netnsMode+"\n"), 0644))
+	}
+
+	sysfsRoot = dir
+	return func() {
+		sysfsRoot = "/sys"
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFindEFADevices(t *testing.T) {
+	defer setupSysfs(t, "")()
+
+	devices, err := findEFADevices("eth1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"efa_0"}, devices.RDMADevices)
+	assert.Equal(t, []string{"/dev/infiniband/uverbs0"}, devices.DeviceFiles)
+
+	_, err = findEFADevices("eth0")
+	assert.Error(t, err)
+}
+
+func TestIsRDMANetNSExclusive(t *testing.T) {
+	restore := setupSysfs(t, "")
+	assert.False(t, isRDMANetNSExclusive())
+	restore()
+
+	restore = setupSysfs(t, "Y")
+	assert.False(t, isRDMANetNSExclusive())
+	restore()
+
+	restore = setupSysfs(t, "N")
+	assert.True(t, isRDMANetNSExclusive())
+	restore()
+}
+
+func TestGetNetNSName(t *testing.T) {
+	name, err := getNetNSName("/var/run/netns/task1")
+	require.NoError(t, err)
+	assert.Equal(t, "task1", name)
+
+	_, err = getNetNSName("/proc/42/ns/net")
+	assert.Error(t, err)
+}
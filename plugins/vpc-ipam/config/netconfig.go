@@ -0,0 +1,229 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// NetConfig defines the network configuration for the vpc-ipam plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	Range        ipam.Range
+	DaemonSocket string
+	Routes       []*cniTypes.Route
+	// Reservations maps task ARNs or container IDs to their reserved addresses.
+	Reservations map[string]*net.IPNet
+	// ReservationKey is the key of the container's reservation.
+	ReservationKey string
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-ipam plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	IPAM *ipamConfigJSON `json:"ipam"`
+}
+
+// ipamConfigJSON defines the ipam section of the network configuration JSON file format.
+type ipamConfigJSON struct {
+	Type         string            `json:"type"`
+	Subnet       string            `json:"subnet"`
+	RangeStart   string            `json:"rangeStart"`
+	RangeEnd     string            `json:"rangeEnd"`
+	Gateway      string            `json:"gateway"`
+	Exclude      []string          `json:"exclude"`
+	DaemonSocket string            `json:"daemonSocket"`
+	Routes       []*cniTypes.Route `json:"routes"`
+	Reservations map[string]string `json:"reservations"`
+	// ReservationsFile is the path to a JSON file with additional reservations.
+	ReservationsFile string `json:"reservationsFile"`
+}
+
+// pcArgs defines the per-container arguments passed in CNI_ARGS environment variable.
+type pcArgs struct {
+	cniTypes.CommonArgs
+	IP      cniTypes.UnmarshallableString
+	TaskARN cniTypes.UnmarshallableString
+}
+
+const (
+	// Whether the plugin ignores unknown per-container arguments.
+	ignoreUnknown = true
+)
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Validate if all the required fields are present.
+	if config.IPAM == nil {
+		return nil, fmt.Errorf("missing required section ipam")
+	}
+
+	netConfig := NetConfig{
+		NetConf:      config.NetConf,
+		DaemonSocket: config.IPAM.DaemonSocket,
+		Routes:       config.IPAM.Routes,
+	}
+
+	// Parse optional per-container arguments.
+	var pca pcArgs
+	if args.Args != "" {
+		pca.IgnoreUnknown = ignoreUnknown
+		if err := cniTypes.LoadArgs(args.Args, &pca); err != nil {
+			return nil, fmt.Errorf("failed to parse per-container args: %v", err)
+		}
+	}
+
+	// Addresses are allocated by the warm pool daemon if a daemon socket is specified.
+	if netConfig.DaemonSocket != "" {
+		if len(config.IPAM.Reservations) != 0 || config.IPAM.ReservationsFile != "" || pca.IP != "" {
+			return nil, fmt.Errorf("reservations are not supported with daemonSocket")
+		}
+		log.Debugf("Created NetConfig: %+v", netConfig)
+		return &netConfig, nil
+	}
+
+	if config.IPAM.Subnet == "" {
+		return nil, fmt.Errorf("missing required parameter subnet")
+	}
+
+	// Parse the VPC subnet.
+	_, netConfig.Range.Subnet, err = net.ParseCIDR(config.IPAM.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %s", config.IPAM.Subnet)
+	}
+
+	// Parse the optional range boundaries.
+	netConfig.Range.RangeStart, err = parseOptionalIP(config.IPAM.RangeStart, "rangeStart")
+	if err != nil {
+		return nil, err
+	}
+	netConfig.Range.RangeEnd, err = parseOptionalIP(config.IPAM.RangeEnd, "rangeEnd")
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the optional gateway IP address.
+	netConfig.Range.Gateway, err = parseOptionalIP(config.IPAM.Gateway, "gateway")
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the optional excluded IP addresses and CIDR blocks.
+	for _, exclude := range config.IPAM.Exclude {
+		if !strings.Contains(exclude, "/") {
+			ip := net.ParseIP(exclude)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid exclude %s", exclude)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			exclude = fmt.Sprintf("%s/%d", exclude, bits)
+		}
+
+		_, block, err := net.ParseCIDR(exclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude %s", exclude)
+		}
+		netConfig.Range.Exclude = append(netConfig.Range.Exclude, block)
+	}
+
+	// Parse the optional reservations.
+	err = netConfig.parseReservations(config.IPAM, &pca, args.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
+
+// parseOptionalIP parses an optional IP address parameter.
+// parseReservations parses the reservations from the network configuration, the reservations
+// file and the per-container arguments, in increasing order of precedence.
+func (netConfig *NetConfig) parseReservations(config *ipamConfigJSON, pca *pcArgs, containerID string) error {
+	reservations := make(map[string]string)
+	if config.ReservationsFile != "" {
+		data, err := ioutil.ReadFile(config.ReservationsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read reservations file: %v", err)
+		}
+		err = json.Unmarshal(data, &reservations)
+		if err != nil {
+			return fmt.Errorf("failed to parse reservations file: %v", err)
+		}
+	}
+
+	for key, address := range config.Reservations {
+		reservations[key] = address
+	}
+
+	// Reservations are keyed by task ARN if one is specified, or by container ID otherwise.
+	netConfig.ReservationKey = containerID
+	if pca.TaskARN != "" {
+		netConfig.ReservationKey = string(pca.TaskARN)
+	}
+	if pca.IP != "" {
+		reservations[netConfig.ReservationKey] = string(pca.IP)
+	}
+
+	netConfig.Reservations = make(map[string]*net.IPNet)
+	reservedBy := make(map[string]string)
+	for key, address := range reservations {
+		ip := net.ParseIP(address)
+		if ip == nil || !netConfig.Range.Subnet.Contains(ip) {
+			return fmt.Errorf("invalid reservation %s for %s", address, key)
+		}
+		if other, ok := reservedBy[ip.String()]; ok {
+			return fmt.Errorf("address %s is reserved for both %s and %s", address, other, key)
+		}
+		reservedBy[ip.String()] = key
+		netConfig.Reservations[key] = &net.IPNet{IP: ip, Mask: netConfig.Range.Subnet.Mask}
+	}
+
+	return nil
+}
+
+func parseOptionalIP(s string, name string) (net.IP, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid %s %s", name, s)
+	}
+
+	return ip, nil
+}
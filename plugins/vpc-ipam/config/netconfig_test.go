@@ -0,0 +1,130 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// All required fields.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24"}}`,
+		// With optional fields.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "rangeStart":"10.0.1.32",
+		  "rangeEnd":"10.0.1.63", "gateway":"10.0.1.1", "exclude":["10.0.1.40", "10.0.1.48/29"],
+		  "routes":[{"dst":"0.0.0.0/0"}]}}`,
+		// Allocated by the warm pool daemon.
+		`{"ipam":{"type":"vpc-ipam", "daemonSocket":"/var/run/vpc-ipamd.sock"}}`,
+		// With reservations.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "reservations":{"task1":"10.0.1.5"}}}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing ipam section.
+		`{"type":"vpc-ipam"}`,
+		// Missing subnet.
+		`{"ipam":{"type":"vpc-ipam"}}`,
+		// Invalid subnet.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0"}}`,
+		// Invalid range start.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "rangeStart":"10.0.1"}}`,
+		// Invalid gateway.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "gateway":"gw"}}`,
+		// Invalid exclude.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "exclude":["10.0.1.0/33"]}}`,
+		// Reservation outside the subnet.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "reservations":{"task1":"10.0.2.5"}}}`,
+		// Address reserved twice.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24",
+		  "reservations":{"task1":"10.0.1.5", "task2":"10.0.1.5"}}}`,
+		// Missing reservations file.
+		`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24", "reservationsFile":"/nonexistent"}}`,
+		// Reservations with the warm pool daemon.
+		`{"ipam":{"type":"vpc-ipam", "daemonSocket":"/var/run/vpc-ipamd.sock",
+		  "reservations":{"task1":"10.0.1.5"}}}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestExclude tests that single excluded IP addresses are parsed as host prefixes.
+func TestExclude(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[1])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	require.Len(t, netConfig.Range.Exclude, 2)
+	assert.Equal(t, "10.0.1.40/32", netConfig.Range.Exclude[0].String())
+	assert.Equal(t, "10.0.1.48/29", netConfig.Range.Exclude[1].String())
+}
+
+// TestReservations tests that reservations are merged from the reservations file, the network
+// configuration and the per-container arguments.
+func TestReservations(t *testing.T) {
+	file, err := ioutil.TempFile("", "reservations")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`{"task1":"10.0.1.5", "task2":"10.0.1.6"}`)
+	require.NoError(t, err)
+	file.Close()
+
+	config := fmt.Sprintf(`{"ipam":{"type":"vpc-ipam", "subnet":"10.0.1.0/24",
+	  "reservationsFile":"%s", "reservations":{"task2":"10.0.1.7"}}}`, file.Name())
+	args := &skel.CmdArgs{
+		ContainerID: "container1",
+		StdinData:   []byte(config),
+		Args:        "TaskARN=task3;IP=10.0.1.8",
+	}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.Equal(t, "task3", netConfig.ReservationKey)
+	require.Len(t, netConfig.Reservations, 3)
+	assert.Equal(t, "10.0.1.5/24", netConfig.Reservations["task1"].String())
+	assert.Equal(t, "10.0.1.7/24", netConfig.Reservations["task2"].String())
+	assert.Equal(t, "10.0.1.8/24", netConfig.Reservations["task3"].String())
+
+	// Without a task ARN, reservations are keyed by container ID.
+	args.Args = "IP=10.0.1.8"
+	netConfig, err = New(args)
+	require.NoError(t, err)
+	assert.Equal(t, "container1", netConfig.ReservationKey)
+	assert.Equal(t, "10.0.1.8/24", netConfig.Reservations["container1"].String())
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/ipamd"
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-ipam/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Allocate an IP address to the container.
+	address, gateway, err := plugin.allocate(args, netConfig)
+	if err != nil {
+		log.Errorf("Failed to allocate IP address: %v.", err)
+		return err
+	}
+	log.Infof("Allocated IP address %s.", address)
+
+	version := "4"
+	if address.IP.To4() == nil {
+		version = "6"
+	}
+
+	// Generate CNI result.
+	result := &cniTypesCurrent.Result{
+		IPs: []*cniTypesCurrent.IPConfig{
+			{
+				Version: version,
+				Address: *address,
+				Gateway: gateway,
+			},
+		},
+		Routes: netConfig.Routes,
+		DNS:    netConfig.DNS,
+	}
+
+	// Output CNI result.
+	log.Infof("Writing CNI result to stdout: %+v", result)
+	err = cniTypes.PrintResult(result, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+	}
+
+	return err
+}
+
+// Del is the CNI DEL command handler.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Release the IP address allocated to the container, if any.
+	err = plugin.release(args, netConfig)
+	if err != nil {
+		log.Errorf("Failed to release IP address: %v.", err)
+	}
+
+	return err
+}
+
+// allocate allocates an IP address to the container from the warm pool daemon or the
+// configured subnet range, and returns it along with the gateway.
+func (plugin *Plugin) allocate(args *cniSkel.CmdArgs, netConfig *config.NetConfig) (*net.IPNet, net.IP, error) {
+	if netConfig.DaemonSocket != "" {
+		return ipamd.NewClient(netConfig.DaemonSocket).Allocate(args.ContainerID)
+	}
+
+	pool, err := ipam.NewRangePool(plugin.StateDirPath, netConfig.Name, &netConfig.Range)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = pool.SetReservations(netConfig.Reservations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	address, err := pool.AllocateReserved(args.ContainerID, netConfig.ReservationKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return address, netConfig.Range.Gateway, nil
+}
+
+// release releases the IP address allocated to the container.
+func (plugin *Plugin) release(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	if netConfig.DaemonSocket != "" {
+		return ipamd.NewClient(netConfig.DaemonSocket).Release(args.ContainerID)
+	}
+
+	pool, err := ipam.NewRangePool(plugin.StateDirPath, netConfig.Name, &netConfig.Range)
+	if err != nil {
+		return err
+	}
+
+	address, err := pool.Release(args.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	if address != nil {
+		log.Infof("Released IP address %s.", address)
+	} else {
+		log.Infof("No IP address allocated to container %s.", args.ContainerID)
+	}
+
+	return nil
+}
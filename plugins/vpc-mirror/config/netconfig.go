@@ -0,0 +1,151 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// NetConfig defines the network configuration for the vpc-mirror plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	TargetIPAddress net.IP
+	VNI             uint32
+	DestinationPort uint16
+	TargetInterface string
+	Direction       string
+	PrevResult      *cniTypesCurrent.Result
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-mirror plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	TargetIPAddress string                 `json:"targetIPAddress"`
+	VNI             string                 `json:"vni"`
+	DestinationPort string                 `json:"destinationPort"`
+	TargetInterface string                 `json:"targetInterface"`
+	Direction       string                 `json:"direction"`
+	PrevResult      map[string]interface{} `json:"prevResult,omitempty"`
+}
+
+const (
+	// DefaultDestinationPort is the IANA assigned UDP port for VXLAN, used by VPC traffic
+	// mirroring.
+	DefaultDestinationPort = 4789
+
+	// maxVNI is the largest valid 24-bit VXLAN network identifier.
+	maxVNI = 1<<24 - 1
+
+	// Traffic directions, relative to the task.
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+	DirectionBoth    = "both"
+)
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Validate if all the required fields are present.
+	if config.TargetIPAddress == "" && config.TargetInterface == "" {
+		return nil, fmt.Errorf("missing required parameter targetIPAddress or targetInterface")
+	}
+	if config.TargetIPAddress != "" && config.TargetInterface != "" {
+		return nil, fmt.Errorf("only one of targetIPAddress and targetInterface can be specified")
+	}
+
+	// Set defaults.
+	if config.Direction == "" {
+		config.Direction = DirectionBoth
+	}
+
+	netConfig := NetConfig{
+		NetConf:         config.NetConf,
+		DestinationPort: DefaultDestinationPort,
+		TargetInterface: config.TargetInterface,
+		Direction:       config.Direction,
+	}
+
+	// Parse the VXLAN mirror target.
+	if config.TargetIPAddress != "" {
+		netConfig.TargetIPAddress = net.ParseIP(config.TargetIPAddress)
+		if netConfig.TargetIPAddress == nil || netConfig.TargetIPAddress.To4() == nil {
+			return nil, fmt.Errorf("invalid targetIPAddress %s", config.TargetIPAddress)
+		}
+
+		if config.VNI == "" {
+			return nil, fmt.Errorf("missing required parameter vni")
+		}
+
+		vni, err := strconv.ParseUint(config.VNI, 10, 32)
+		if err != nil || vni > maxVNI {
+			return nil, fmt.Errorf("invalid vni %s", config.VNI)
+		}
+		netConfig.VNI = uint32(vni)
+
+		if config.DestinationPort != "" {
+			port, err := strconv.ParseUint(config.DestinationPort, 10, 16)
+			if err != nil || port == 0 {
+				return nil, fmt.Errorf("invalid destinationPort %s", config.DestinationPort)
+			}
+			netConfig.DestinationPort = uint16(port)
+		}
+	}
+
+	// Parse the direction.
+	switch netConfig.Direction {
+	case DirectionIngress, DirectionEgress, DirectionBoth:
+	default:
+		return nil, fmt.Errorf("invalid direction %s", netConfig.Direction)
+	}
+
+	if config.PrevResult != nil {
+		// Plugin was called as part of a chain. Parse the previous result to pass forward.
+		prevResBytes, err := json.Marshal(config.PrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize prevResult: %v", err)
+		}
+
+		prevRes, err := cniVersion.NewResult(config.CNIVersion, prevResBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+		}
+
+		netConfig.PrevResult, err = cniTypesCurrent.NewResultFromResult(prevRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+		}
+	} else {
+		// Plugin was called stand-alone.
+		netConfig.PrevResult = &cniTypesCurrent.Result{}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
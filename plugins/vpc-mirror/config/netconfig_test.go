@@ -0,0 +1,80 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// VXLAN mirror target.
+		`{"targetIPAddress":"10.0.5.10", "vni":"42"}`,
+		// Local capture interface with optional fields.
+		`{"targetInterface":"mirror0", "direction":"ingress"}`,
+		// VXLAN mirror target with custom port, chained.
+		`{"cniVersion":"0.3.1", "targetIPAddress":"10.0.5.10", "vni":"42", "destinationPort":"4790",
+		  "prevResult":{"cniVersion":"0.3.1", "interfaces":[{"name":"eth0", "sandbox":"/var/run/netns/task"}]}}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing mirror target.
+		`{"vni":"42"}`,
+		// Both mirror targets.
+		`{"targetIPAddress":"10.0.5.10", "vni":"42", "targetInterface":"mirror0"}`,
+		// Missing VNI.
+		`{"targetIPAddress":"10.0.5.10"}`,
+		// Invalid VNI.
+		`{"targetIPAddress":"10.0.5.10", "vni":"16777216"}`,
+		// IPv6 mirror target.
+		`{"targetIPAddress":"2600:1f14::10", "vni":"42"}`,
+		// Invalid direction.
+		`{"targetInterface":"mirror0", "direction":"inbound"}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestDefaults tests that optional fields are set to their defaults.
+func TestDefaults(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[0])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint32(42), netConfig.VNI)
+	assert.Equal(t, uint16(DefaultDestinationPort), netConfig.DestinationPort)
+	assert.Equal(t, DirectionBoth, netConfig.Direction)
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-mirror/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// tcCommand is the name of the iproute2 command used for configuring traffic control
+	// mirroring, which the netlink library does not fully support.
+	tcCommand = "tc"
+
+	// mirrorFilterPref is the preference of the traffic control filters that mirror traffic,
+	// which identifies them for deletion.
+	mirrorFilterPref = "49152"
+
+	// vxlanLinkNameFormat is the format of the names of VXLAN mirror target links.
+	vxlanLinkNameFormat = "vmirror%d"
+
+	// Traffic control hooks of the host-side interface.
+	tcHookIngress = "ingress"
+	tcHookEgress  = "egress"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	hostLink, err := plugin.findHostLink(args)
+	if err != nil {
+		log.Errorf("Failed to find host-side link of task interface: %v.", err)
+		return err
+	}
+
+	targetLink, err := plugin.findOrCreateMirrorTarget(netConfig)
+	if err != nil {
+		log.Errorf("Failed to find or create mirror target: %v.", err)
+		return err
+	}
+
+	// Traffic control on the host-side link sees task traffic in the opposite direction.
+	log.Infof("Mirroring %s traffic of link %s to %s.",
+		netConfig.Direction, hostLink.Attrs().Name, targetLink.Attrs().Name)
+
+	_, err = command.Run(tcCommand, "qdisc", "replace", "dev", hostLink.Attrs().Name, "clsact")
+	if err != nil {
+		log.Errorf("Failed to add clsact qdisc: %v.", err)
+		return err
+	}
+
+	for _, hook := range getTCHooks(netConfig.Direction) {
+		_, err = command.Run(tcCommand, mirrorFilterArgs("replace", hostLink.Attrs().Name, hook,
+			targetLink.Attrs().Name)...)
+		if err != nil {
+			log.Errorf("Failed to add %s mirror filter: %v.", hook, err)
+			return err
+		}
+	}
+
+	// Pass through the previous result.
+	log.Infof("Writing CNI result to stdout: %+v", netConfig.PrevResult)
+	err = cniTypes.PrintResult(netConfig.PrevResult, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+	}
+
+	return err
+}
+
+// Del is the CNI DEL command handler.
+// CNI DEL command can be called by the orchestrator multiple times for the same interface,
+// and thus must be best-effort and idempotent.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Mirror filters are deleted along with the host-side link when the task network is torn
+	// down, so there is nothing left to clean up if the link is already gone. The mirror target
+	// is shared by tasks and is left in place.
+	hostLink, err := plugin.findHostLink(args)
+	if err != nil {
+		log.Infof("Host-side link of task interface not found, ignoring: %v.", err)
+		return nil
+	}
+
+	for _, hook := range getTCHooks(netConfig.Direction) {
+		_, err = command.Run(tcCommand, mirrorFilterArgs("del", hostLink.Attrs().Name, hook, "")...)
+		if err != nil {
+			log.Infof("Failed to delete %s mirror filter, ignoring: %v.", hook, err)
+		}
+	}
+
+	return nil
+}
+
+// findHostLink returns the host-side peer of the veth link connecting the task interface.
+func (plugin *Plugin) findHostLink(args *cniSkel.CmdArgs) (netlink.Link, error) {
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		return nil, err
+	}
+
+	var peerIndex int
+	err = ns.Run(func() error {
+		link, err := netlink.LinkByName(args.IfName)
+		if err != nil {
+			return err
+		}
+
+		if link.Type() != "veth" {
+			return fmt.Errorf("task interface %s is a %s link, mirroring requires a veth link",
+				args.IfName, link.Type())
+		}
+
+		// The parent index of a veth link is the index of its peer.
+		peerIndex = link.Attrs().ParentIndex
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return netlink.LinkByIndex(peerIndex)
+}
+
+// findOrCreateMirrorTarget returns the link that mirrored traffic is sent to, creating the
+// VXLAN link to a remote mirror target if it does not exist.
+func (plugin *Plugin) findOrCreateMirrorTarget(netConfig *config.NetConfig) (netlink.Link, error) {
+	if netConfig.TargetInterface != "" {
+		return netlink.LinkByName(netConfig.TargetInterface)
+	}
+
+	name := fmt.Sprintf(vxlanLinkNameFormat, netConfig.VNI)
+	link, err := netlink.LinkByName(name)
+	if err == nil {
+		return link, nil
+	}
+
+	// Send encapsulated traffic through the interface that routes to the mirror target.
+	routes, err := netlink.RouteGet(netConfig.TargetIPAddress)
+	if err == nil && len(routes) == 0 {
+		err = fmt.Errorf("no route to %s", netConfig.TargetIPAddress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	la := netlink.NewLinkAttrs()
+	la.Name = name
+	vxlan := &netlink.Vxlan{
+		LinkAttrs:    la,
+		VxlanId:      int(netConfig.VNI),
+		VtepDevIndex: routes[0].LinkIndex,
+		Group:        netConfig.TargetIPAddress,
+		Port:         int(netConfig.DestinationPort),
+	}
+
+	log.Infof("Creating VXLAN link %s VNI %d remote %s port %d.", name, netConfig.VNI,
+		netConfig.TargetIPAddress, netConfig.DestinationPort)
+	err = netlink.LinkAdd(vxlan)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err = netlink.LinkByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, netlink.LinkSetUp(link)
+}
+
+// getTCHooks returns the traffic control hooks of the host-side link that see task traffic in
+// the given direction. Task egress traffic enters the host through the host-side link.
+func getTCHooks(direction string) []string {
+	switch direction {
+	case config.DirectionIngress:
+		return []string{tcHookEgress}
+	case config.DirectionEgress:
+		return []string{tcHookIngress}
+	default:
+		return []string{tcHookIngress, tcHookEgress}
+	}
+}
+
+// mirrorFilterArgs returns the tc command arguments that add or delete a mirror filter.
+func mirrorFilterArgs(op string, linkName string, hook string, targetName string) []string {
+	args := []string{"filter", op, "dev", linkName, hook, "pref", mirrorFilterPref}
+	if targetName != "" {
+		args = append(args, "matchall", "action", "mirred", "egress", "mirror", "dev", targetName)
+	}
+	return args
+}
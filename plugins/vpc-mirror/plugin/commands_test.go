@@ -0,0 +1,38 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-mirror/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTCHooks(t *testing.T) {
+	assert.Equal(t, []string{tcHookEgress}, getTCHooks(config.DirectionIngress))
+	assert.Equal(t, []string{tcHookIngress}, getTCHooks(config.DirectionEgress))
+	assert.Equal(t, []string{tcHookIngress, tcHookEgress}, getTCHooks(config.DirectionBoth))
+}
+
+func TestMirrorFilterArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"filter", "replace", "dev", "veth1", "ingress", "pref", "49152",
+			"matchall", "action", "mirred", "egress", "mirror", "dev", "vmirror7"},
+		mirrorFilterArgs("replace", "veth1", tcHookIngress, "vmirror7"))
+	assert.Equal(t,
+		[]string{"filter", "del", "dev", "veth1", "egress", "pref", "49152"},
+		mirrorFilterArgs("del", "veth1", tcHookEgress, ""))
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// NetConfig defines the network configuration for the vpc-multi-interface plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	Interfaces []InterfaceConfig
+}
+
+// InterfaceConfig defines the configuration of an interface created by a delegate plugin.
+type InterfaceConfig struct {
+	IfName string
+	Type   string
+	Config []byte
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-multi-interface
+// plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	Interfaces []interfaceConfigJSON `json:"interfaces"`
+}
+
+// interfaceConfigJSON defines the interface configuration JSON format.
+type interfaceConfigJSON struct {
+	IfName string                 `json:"ifName"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Validate if all the required fields are present.
+	if len(config.Interfaces) == 0 {
+		return nil, fmt.Errorf("missing required parameter interfaces")
+	}
+
+	netConfig := NetConfig{
+		NetConf: config.NetConf,
+	}
+
+	ifNames := make(map[string]bool)
+	for i, ifConfig := range config.Interfaces {
+		if ifConfig.IfName == "" {
+			return nil, fmt.Errorf("missing required parameter ifName in interface %d", i)
+		}
+		if ifNames[ifConfig.IfName] {
+			return nil, fmt.Errorf("duplicate ifName %s", ifConfig.IfName)
+		}
+		ifNames[ifConfig.IfName] = true
+
+		if ifConfig.Config == nil {
+			return nil, fmt.Errorf("missing required parameter config in interface %s", ifConfig.IfName)
+		}
+
+		pluginType, _ := ifConfig.Config["type"].(string)
+		if pluginType == "" {
+			return nil, fmt.Errorf("missing required parameter type in interface %s", ifConfig.IfName)
+		}
+
+		// Delegates inherit the CNI version and network name unless they specify their own.
+		if _, ok := ifConfig.Config["cniVersion"]; !ok {
+			ifConfig.Config["cniVersion"] = config.CNIVersion
+		}
+		if _, ok := ifConfig.Config["name"]; !ok {
+			ifConfig.Config["name"] = config.Name
+		}
+
+		delegateConfig, err := json.Marshal(ifConfig.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize config of interface %s: %v", ifConfig.IfName, err)
+		}
+
+		netConfig.Interfaces = append(netConfig.Interfaces, InterfaceConfig{
+			IfName: ifConfig.IfName,
+			Type:   pluginType,
+			Config: delegateConfig,
+		})
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
@@ -0,0 +1,86 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// Single interface.
+		`{"interfaces":[{"ifName":"eth0", "config":{"type":"vpc-shared-eni"}}]}`,
+		// Multiple interfaces.
+		`{"cniVersion":"0.3.1", "name":"task", "interfaces":[
+		  {"ifName":"eth0", "config":{"type":"vpc-shared-eni"}},
+		  {"ifName":"eth1", "config":{"type":"vpc-branch-eni", "cniVersion":"0.3.0", "name":"mgmt"}}]}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing interfaces.
+		`{"name":"task"}`,
+		// Missing ifName.
+		`{"interfaces":[{"config":{"type":"vpc-shared-eni"}}]}`,
+		// Missing config.
+		`{"interfaces":[{"ifName":"eth0"}]}`,
+		// Missing delegate type.
+		`{"interfaces":[{"ifName":"eth0", "config":{}}]}`,
+		// Duplicate ifName.
+		`{"interfaces":[{"ifName":"eth0", "config":{"type":"a"}}, {"ifName":"eth0", "config":{"type":"b"}}]}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestDelegateConfigs tests that delegates inherit the CNI version and network name.
+func TestDelegateConfigs(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[1])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+	require.Len(t, netConfig.Interfaces, 2)
+
+	var delegate map[string]interface{}
+	require.NoError(t, json.Unmarshal(netConfig.Interfaces[0].Config, &delegate))
+	assert.Equal(t, "vpc-shared-eni", netConfig.Interfaces[0].Type)
+	assert.Equal(t, "0.3.1", delegate["cniVersion"])
+	assert.Equal(t, "task", delegate["name"])
+
+	require.NoError(t, json.Unmarshal(netConfig.Interfaces[1].Config, &delegate))
+	assert.Equal(t, "eth1", netConfig.Interfaces[1].IfName)
+	assert.Equal(t, "0.3.0", delegate["cniVersion"])
+	assert.Equal(t, "mgmt", delegate["name"])
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-multi-interface/config"
+
+	log "github.com/cihub/seelog"
+	"github.com/containernetworking/cni/pkg/invoke"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Invoke the delegate plugin of each interface in order.
+	var results []*cniTypesCurrent.Result
+	for i, ifConfig := range netConfig.Interfaces {
+		log.Infof("Adding interface %s with plugin %s.", ifConfig.IfName, ifConfig.Type)
+		result, err := plugin.addInterface(args, &ifConfig)
+		if err != nil {
+			log.Errorf("Failed to add interface %s: %v.", ifConfig.IfName, err)
+			// Roll back the interfaces added so far, so that the task is not left half-connected.
+			plugin.delInterfaces(args, netConfig.Interfaces[:i])
+			return err
+		}
+		results = append(results, result)
+	}
+
+	result := mergeResults(results)
+
+	// Output CNI result.
+	log.Infof("Writing CNI result to stdout: %+v", result)
+	err = cniTypes.PrintResult(result, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+	}
+
+	return err
+}
+
+// Del is the CNI DEL command handler.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	return plugin.delInterfaces(args, netConfig.Interfaces)
+}
+
+// addInterface invokes the CNI ADD command of the delegate plugin for an interface.
+func (plugin *Plugin) addInterface(
+	args *cniSkel.CmdArgs,
+	ifConfig *config.InterfaceConfig) (*cniTypesCurrent.Result, error) {
+
+	r, err := plugin.delegator.add(ifConfig.Type, ifConfig.Config, delegateArgs("ADD", args, ifConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := cniTypesCurrent.NewResultFromResult(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+	}
+
+	return result, nil
+}
+
+// delInterfaces invokes the CNI DEL command of the delegate plugins for the given interfaces in
+// reverse order. It attempts to delete all interfaces and returns the first error.
+func (plugin *Plugin) delInterfaces(args *cniSkel.CmdArgs, ifConfigs []config.InterfaceConfig) error {
+	var firstErr error
+
+	for i := len(ifConfigs) - 1; i >= 0; i-- {
+		ifConfig := &ifConfigs[i]
+		log.Infof("Deleting interface %s with plugin %s.", ifConfig.IfName, ifConfig.Type)
+
+		err := plugin.delegator.del(ifConfig.Type, ifConfig.Config, delegateArgs("DEL", args, ifConfig))
+		if err != nil {
+			log.Errorf("Failed to delete interface %s: %v.", ifConfig.IfName, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// delegateArgs returns the arguments for invoking a delegate plugin for an interface.
+func delegateArgs(command string, args *cniSkel.CmdArgs, ifConfig *config.InterfaceConfig) *invoke.Args {
+	return &invoke.Args{
+		Command:       command,
+		ContainerID:   args.ContainerID,
+		NetNS:         args.Netns,
+		PluginArgsStr: args.Args,
+		IfName:        ifConfig.IfName,
+		Path:          os.Getenv(envCNIPath),
+	}
+}
+
+// mergeResults merges the results of delegate plugins into a single result.
+func mergeResults(results []*cniTypesCurrent.Result) *cniTypesCurrent.Result {
+	merged := &cniTypesCurrent.Result{}
+
+	for _, result := range results {
+		// Interface indices in IP configs are relative to each result's interface list.
+		offset := len(merged.Interfaces)
+		merged.Interfaces = append(merged.Interfaces, result.Interfaces...)
+
+		for _, ipConfig := range result.IPs {
+			ip := *ipConfig
+			if ip.Interface != nil {
+				ip.Interface = cniTypesCurrent.Int(*ip.Interface + offset)
+			}
+			merged.IPs = append(merged.IPs, &ip)
+		}
+
+		merged.Routes = append(merged.Routes, result.Routes...)
+
+		if len(merged.DNS.Nameservers) == 0 {
+			merged.DNS = result.DNS
+		}
+	}
+
+	return merged
+}
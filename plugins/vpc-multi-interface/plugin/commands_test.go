@@ -0,0 +1,124 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `{"cniVersion":"0.3.1", "name":"task", "interfaces":[
+	{"ifName":"eth0", "config":{"type":"data"}},
+	{"ifName":"eth1", "config":{"type":"mgmt"}}]}`
+
+// fakeDelegator records delegate invocations and returns a result with one interface each.
+type fakeDelegator struct {
+	calls   []string
+	failAdd string
+}
+
+func (d *fakeDelegator) add(pluginType string, netConfig []byte, args *invoke.Args) (cniTypes.Result, error) {
+	d.calls = append(d.calls, fmt.Sprintf("ADD %s %s", pluginType, args.IfName))
+	if pluginType == d.failAdd {
+		return nil, fmt.Errorf("%s failed", pluginType)
+	}
+
+	_, address, _ := net.ParseCIDR(fmt.Sprintf("10.0.%d.20/24", len(d.calls)))
+	return &cniTypesCurrent.Result{
+		CNIVersion: "0.3.1",
+		Interfaces: []*cniTypesCurrent.Interface{{Name: args.IfName, Sandbox: args.NetNS}},
+		IPs: []*cniTypesCurrent.IPConfig{
+			{Version: "4", Interface: cniTypesCurrent.Int(0), Address: *address},
+		},
+	}, nil
+}
+
+func (d *fakeDelegator) del(pluginType string, netConfig []byte, args *invoke.Args) error {
+	d.calls = append(d.calls, fmt.Sprintf("DEL %s %s", pluginType, args.IfName))
+	return nil
+}
+
+func newTestArgs() *cniSkel.CmdArgs {
+	return &cniSkel.CmdArgs{
+		ContainerID: "container1",
+		Netns:       "/var/run/netns/task",
+		IfName:      "eth0",
+		StdinData:   []byte(testConfig),
+	}
+}
+
+func TestAddInvokesDelegatesInOrder(t *testing.T) {
+	delegator := &fakeDelegator{}
+	plugin := &Plugin{delegator: delegator}
+
+	err := plugin.Add(newTestArgs())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ADD data eth0", "ADD mgmt eth1"}, delegator.calls)
+}
+
+func TestAddRollsBackOnFailure(t *testing.T) {
+	delegator := &fakeDelegator{failAdd: "mgmt"}
+	plugin := &Plugin{delegator: delegator}
+
+	err := plugin.Add(newTestArgs())
+	assert.Error(t, err)
+	assert.Equal(t, []string{"ADD data eth0", "ADD mgmt eth1", "DEL data eth0"}, delegator.calls)
+}
+
+func TestDelInvokesDelegatesInReverseOrder(t *testing.T) {
+	delegator := &fakeDelegator{}
+	plugin := &Plugin{delegator: delegator}
+
+	err := plugin.Del(newTestArgs())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DEL mgmt eth1", "DEL data eth0"}, delegator.calls)
+}
+
+func TestMergeResults(t *testing.T) {
+	_, address0, _ := net.ParseCIDR("10.0.1.20/24")
+	_, address1, _ := net.ParseCIDR("10.0.2.20/24")
+
+	results := []*cniTypesCurrent.Result{
+		{
+			Interfaces: []*cniTypesCurrent.Interface{{Name: "eth0"}},
+			IPs:        []*cniTypesCurrent.IPConfig{{Version: "4", Interface: cniTypesCurrent.Int(0), Address: *address0}},
+			DNS:        cniTypes.DNS{Nameservers: []string{"10.0.0.2"}},
+		},
+		{
+			Interfaces: []*cniTypesCurrent.Interface{{Name: "eth1"}},
+			IPs:        []*cniTypesCurrent.IPConfig{{Version: "4", Interface: cniTypesCurrent.Int(0), Address: *address1}},
+			DNS:        cniTypes.DNS{Nameservers: []string{"10.0.0.3"}},
+		},
+	}
+
+	merged := mergeResults(results)
+	require.Len(t, merged.Interfaces, 2)
+	require.Len(t, merged.IPs, 2)
+	assert.Equal(t, 0, *merged.IPs[0].Interface)
+	assert.Equal(t, 1, *merged.IPs[1].Interface)
+	assert.Equal(t, []string{"10.0.0.2"}, merged.DNS.Nameservers)
+
+	// The delegate results are not modified.
+	assert.Equal(t, 0, *results[1].IPs[0].Interface)
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// envCNIPath is the environment variable with the CNI plugin search path.
+	envCNIPath = "CNI_PATH"
+)
+
+// delegator invokes delegate plugins.
+type delegator interface {
+	add(pluginType string, netConfig []byte, args *invoke.Args) (cniTypes.Result, error)
+	del(pluginType string, netConfig []byte, args *invoke.Args) error
+}
+
+// execDelegator invokes delegate plugin executables found in the CNI plugin search path.
+type execDelegator struct{}
+
+// add invokes the CNI ADD command of a delegate plugin.
+func (execDelegator) add(pluginType string, netConfig []byte, args *invoke.Args) (cniTypes.Result, error) {
+	pluginPath, err := invoke.FindInPath(pluginType, filepath.SplitList(os.Getenv(envCNIPath)))
+	if err != nil {
+		return nil, err
+	}
+
+	return invoke.ExecPluginWithResult(pluginPath, netConfig, args)
+}
+
+// del invokes the CNI DEL command of a delegate plugin.
+func (execDelegator) del(pluginType string, netConfig []byte, args *invoke.Args) error {
+	pluginPath, err := invoke.FindInPath(pluginType, filepath.SplitList(os.Getenv(envCNIPath)))
+	if err != nil {
+		return err
+	}
+
+	return invoke.ExecPluginWithoutResult(pluginPath, netConfig, args)
+}
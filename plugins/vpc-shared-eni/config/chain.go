@@ -0,0 +1,84 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+// When the plugin is chained after another plugin, the runtime passes the result of the previous
+// plugin as "prevResult" in the network configuration. The ENI and the container addresses that
+// are omitted from the network configuration are taken from it, and the result of the plugin is
+// appended to it so that the plugins that follow in the chain, e.g. portmap, see both.
+
+// parsePrevResult parses the result of the previous plugin in the chain.
+func parsePrevResult(data json.RawMessage) (*cniTypesCurrent.Result, error) {
+	var result cniTypesCurrent.Result
+	err := json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prevResult: %v", err)
+	}
+
+	// Results in CNI spec versions 1.0.0 and later do not carry IP versions.
+	for _, ipConfig := range result.IPs {
+		if ipConfig.Version == "" && ipConfig.Address.IP != nil {
+			ipConfig.Version = vpc.GetIPVersion(ipConfig.Address.IP)
+		}
+	}
+
+	return &result, nil
+}
+
+// applyPrevResult fills the ENI and container address fields omitted from the network
+// configuration from the result of the previous plugin in the chain. The ENI is the first host
+// interface, i.e. the first interface outside of a sandbox, in the result.
+func applyPrevResult(config *netConfigJSON, prevResult *cniTypesCurrent.Result) {
+	hostIndex := -1
+	for i, iface := range prevResult.Interfaces {
+		if iface.Sandbox == "" {
+			hostIndex = i
+			break
+		}
+	}
+
+	if hostIndex >= 0 && config.ENIName == "" && config.ENIMACAddress == "" {
+		config.ENIName = prevResult.Interfaces[hostIndex].Name
+		config.ENIMACAddress = prevResult.Interfaces[hostIndex].Mac
+	}
+
+	for _, ipConfig := range prevResult.IPs {
+		onHost := ipConfig.Interface != nil && *ipConfig.Interface == hostIndex
+
+		if onHost {
+			if config.ENIIPAddress == "" {
+				config.ENIIPAddress = ipConfig.Address.String()
+			}
+			continue
+		}
+
+		// Container addresses are only taken in static mode without any other address source.
+		if config.IPAddress == "" && config.IPAddressPool == nil && config.IPAM.Type == "" &&
+			config.IPAddressMode != IPAddressModeDHCP {
+			config.IPAddress = ipConfig.Address.String()
+			if config.GatewayIPAddress == "" && ipConfig.Gateway != nil {
+				config.GatewayIPAddress = ipConfig.Gateway.String()
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// pluginType is the type of the plugin in network configurations.
+	pluginType = "vpc-shared-eni"
+
+	// legacyBridgePluginType is the type of the vpc-bridge plugin, which vpc-shared-eni replaces.
+	legacyBridgePluginType = "vpc-bridge"
+)
+
+var (
+	// legacyBridgeOptions are the options of vpc-bridge network configurations. vpc-bridge
+	// endpoints are veth pairs on a layer 3 bridge.
+	legacyBridgeOptions = map[string]bool{
+		"eniName":          true,
+		"eniMACAddress":    true,
+		"eniIPAddress":     true,
+		"vpcCIDRs":         true,
+		"ipAddress":        true,
+		"gatewayIPAddress": true,
+	}
+)
+
+// ConvertLegacyConfig converts a vpc-bridge or older vpc-shared-eni network configuration, or a
+// network configuration list containing them, to an equivalent vpc-shared-eni configuration. The
+// configurations of other plugins in a list are kept as they are. Options that have no
+// equivalent are dropped and reported in the returned warnings. The converted configuration is
+// validated before it is returned.
+func ConvertLegacyConfig(data []byte) ([]byte, []string, error) {
+	var conf map[string]json.RawMessage
+	err := json.Unmarshal(data, &conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	var warnings []string
+	if rawPlugins, ok := conf["plugins"]; ok {
+		// Network configuration lists pass their name and version to each plugin.
+		var plugins []map[string]json.RawMessage
+		err = json.Unmarshal(rawPlugins, &plugins)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse network config list plugins: %v", err)
+		}
+
+		for i, plugin := range plugins {
+			w, err := convertPluginConfig(plugin, conf["name"], conf["cniVersion"])
+			if err != nil {
+				return nil, nil, fmt.Errorf("plugin %d: %v", i, err)
+			}
+			warnings = append(warnings, w...)
+		}
+
+		conf["plugins"], err = json.Marshal(plugins)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		warnings, err = convertPluginConfig(conf, conf["name"], conf["cniVersion"])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	data, err = json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, warnings, nil
+}
+
+// convertPluginConfig converts the configuration of a plugin in place, and returns warnings for
+// the options that were dropped.
+func convertPluginConfig(conf map[string]json.RawMessage, name json.RawMessage, cniVersion json.RawMessage) ([]string, error) {
+	var typ string
+	json.Unmarshal(conf["type"], &typ)
+
+	var supported map[string]bool
+	switch typ {
+	case legacyBridgePluginType:
+		supported = legacyBridgeOptions
+	case pluginType:
+		supported = options()
+	default:
+		return nil, nil
+	}
+
+	var warnings []string
+	for _, key := range sortedKeys(conf) {
+		if isNetConfOption(key) || supported[key] {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("option %s is not supported by %s, dropped", key, pluginType))
+		delete(conf, key)
+	}
+
+	// Options that only restate defaults are dropped.
+	if string(conf["bridgeNetNSPath"]) == `""` {
+		delete(conf, "bridgeNetNSPath")
+	}
+
+	if typ == legacyBridgePluginType {
+		conf["type"] = json.RawMessage(`"` + pluginType + `"`)
+		conf["bridgeType"] = json.RawMessage(`"` + BridgeTypeL3 + `"`)
+		conf["interfaceType"] = json.RawMessage(`"` + IfTypeVETH + `"`)
+	}
+
+	// Validate the converted configuration as the runtime passes it to the plugin.
+	netConf := make(map[string]json.RawMessage)
+	for key, value := range conf {
+		netConf[key] = value
+	}
+	if name != nil {
+		netConf["name"] = name
+	}
+	if cniVersion != nil {
+		netConf["cniVersion"] = cniVersion
+	}
+	data, err := json.Marshal(netConf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = New(&cniSkel.CmdArgs{StdinData: data}, false)
+	if err != nil {
+		return nil, fmt.Errorf("converted network config is invalid: %v", err)
+	}
+
+	return warnings, nil
+}
+
+// options returns the options of vpc-shared-eni network configurations.
+func options() map[string]bool {
+	return jsonFieldNames(reflect.TypeOf(netConfigJSON{}))
+}
+
+// isNetConfOption returns whether the given option is common to all network configurations.
+func isNetConfOption(key string) bool {
+	return jsonFieldNames(reflect.TypeOf(cniTypes.NetConf{}))[key]
+}
+
+// jsonFieldNames returns the JSON names of the fields of the given struct type, including the
+// fields of embedded structs.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			for name := range jsonFieldNames(field.Type) {
+				names[name] = true
+			}
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// sortedKeys returns the keys of the given configuration in order, for stable warnings.
+func sortedKeys(conf map[string]json.RawMessage) []string {
+	var keys []string
+	for key := range conf {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertLegacyBridgeConfig(t *testing.T) {
+	legacy := `{"cniVersion":"0.3.1", "name":"vpc", "type":"vpc-bridge", "eniName":"eth1",
+	  "eniIPAddress":"192.168.1.42/24", "vpcCIDRs":["192.168.0.0/16"], "ipAddress":"192.168.1.43/24",
+	  "gatewayIPAddress":"192.168.1.1", "mtu":9001}`
+
+	converted, warnings, err := ConvertLegacyConfig([]byte(legacy))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"cniVersion":"0.3.1", "name":"vpc", "type":"vpc-shared-eni", "eniName":"eth1",
+	  "eniIPAddress":"192.168.1.42/24", "vpcCIDRs":["192.168.0.0/16"], "ipAddress":"192.168.1.43/24",
+	  "gatewayIPAddress":"192.168.1.1", "bridgeType":"L3", "interfaceType":"veth"}`, string(converted))
+	assert.Equal(t, []string{"option mtu is not supported by vpc-shared-eni, dropped"}, warnings)
+}
+
+func TestConvertLegacyConfigList(t *testing.T) {
+	legacy := `{"cniVersion":"0.3.1", "name":"vpc", "plugins":[
+	  {"type":"vpc-shared-eni", "eniName":"eth1", "bridgeNetNSPath":"", "ipAddress":"10.0.1.20/24",
+	   "capabilities":{"sandbox":true}, "unknownOption":true},
+	  {"type":"portmap", "capabilities":{"portMappings":true}}]}`
+
+	converted, warnings, err := ConvertLegacyConfig([]byte(legacy))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"cniVersion":"0.3.1", "name":"vpc", "plugins":[
+	  {"type":"vpc-shared-eni", "eniName":"eth1", "ipAddress":"10.0.1.20/24", "capabilities":{"sandbox":true}},
+	  {"type":"portmap", "capabilities":{"portMappings":true}}]}`, string(converted))
+	assert.Equal(t, []string{"option unknownOption is not supported by vpc-shared-eni, dropped"},
+		warnings)
+}
+
+func TestConvertLegacyConfigInvalid(t *testing.T) {
+	for _, legacy := range []string{
+		`not json`,
+		`{"plugins":"vpc-bridge"}`,
+		// The converted configuration is validated.
+		`{"type":"vpc-bridge", "eniIPAddress":"192.168.1.42/24"}`,
+		`{"plugins":[{"type":"vpc-bridge", "eniName":"eth1", "ipAddress":"192.168.1"}]}`,
+	} {
+		_, _, err := ConvertLegacyConfig([]byte(legacy))
+		assert.Error(t, err, legacy)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+)
+
+// DNS lock-down is enabled with "dnsLockdown": true in the network configuration. It blocks DNS
+// exfiltration through arbitrary external resolvers by only allowing DNS and DNS over TLS traffic
+// to the Amazon-provided VPC resolvers, the DNS proxy, if any, and the resolvers in
+// "dnsAllowedResolvers". Its rules are evaluated ahead of the rules in the network configuration.
+
+// dnsLockdownPorts are the ports of DNS and DNS over TLS traffic.
+var dnsLockdownPorts = []string{"53", "853"}
+
+// resolverCIDRs returns the host CIDR blocks of the Amazon-provided VPC resolvers for the IP
+// family of the network, and of the DNS proxy, if any.
+func resolverCIDRs(netConfig *NetConfig) []string {
+	if netConfig.IPFamily == vpc.IPFamilyIPv6 {
+		cidrs := []string{hostCIDR(net.ParseIP(vpc.DNS64ServerAddress))}
+		if netConfig.DNSProxyAddress != nil {
+			cidrs = append(cidrs, hostCIDR(netConfig.DNSProxyAddress))
+		}
+		return cidrs
+	}
+
+	cidrs := []string{hostCIDR(net.ParseIP(vpc.DNSServerAddress))}
+	for i := range netConfig.VPCCIDRs {
+		cidr := &netConfig.VPCCIDRs[i]
+		if vpc.IsIPv4(cidr.IP) {
+			resolver := vpc.ComputeIPAddress(cidr, net.IPv4(0, 0, 0, 2))
+			cidrs = append(cidrs, hostCIDR(resolver))
+		}
+	}
+	if netConfig.DNSProxyAddress != nil {
+		cidrs = append(cidrs, hostCIDR(netConfig.DNSProxyAddress))
+	}
+
+	return cidrs
+}
+
+// dnsRestrictionRules returns the network policy rules that allow traffic to the given ports
+// only to the given resolvers.
+func dnsRestrictionRules(resolverCIDRs []string, ports []string) []policy.Rule {
+	var rules []policy.Rule
+	for _, action := range []string{policy.ActionAllow, policy.ActionDeny} {
+		for _, protocol := range []string{policy.ProtocolUDP, policy.ProtocolTCP} {
+			rule := policy.Rule{
+				Action:    action,
+				Direction: policy.DirectionEgress,
+				Protocol:  protocol,
+				Ports:     ports,
+			}
+			if action == policy.ActionAllow {
+				rule.CIDRs = resolverCIDRs
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// applyDNSLockdown adds the rules of the DNS lock-down ahead of all other rules.
+func applyDNSLockdown(netConfig *NetConfig) {
+	cidrs := resolverCIDRs(netConfig)
+	for _, resolver := range netConfig.DNSAllowedResolvers {
+		cidrs = append(cidrs, resolver.String())
+	}
+
+	if netConfig.Policy == nil {
+		netConfig.Policy = &policy.Document{DefaultAction: policy.ActionAllow}
+	}
+	netConfig.Policy.Rules = append(dnsRestrictionRules(cidrs, dnsLockdownPorts), netConfig.Policy.Rules...)
+}
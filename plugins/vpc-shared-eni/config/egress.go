@@ -0,0 +1,78 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+)
+
+// Egress restriction is enabled with "restrictEgress": true in the network configuration, for
+// regulated workloads that must not reach the internet even if the VPC has a NAT path. Egress
+// traffic is denied unless its destination is in a VPC CIDR block, in "egressAllowedCIDRs", or
+// is the Amazon-provided DNS server, the DNS proxy or a Kubernetes service. Policies cannot
+// match the complement of address blocks, so the rule denies the address blocks that remain
+// after removing the allowed ones from the address space. It is evaluated ahead of all other
+// rules, so that other rules cannot allow traffic outside the VPC, while rules denying traffic
+// inside the VPC still apply.
+
+// egressRestrictionRule returns the network policy rule of the egress restriction, for the IP
+// family of the network.
+func egressRestrictionRule(netConfig *NetConfig) policy.Rule {
+	allowed := append([]net.IPNet{}, netConfig.VPCCIDRs...)
+	for _, cidr := range netConfig.EgressAllowedCIDRs {
+		allowed = append(allowed, *cidr)
+	}
+
+	hosts := []net.IP{net.ParseIP(vpc.DNSServerAddress), net.ParseIP(vpc.DNS64ServerAddress)}
+	if netConfig.DNSProxyAddress != nil {
+		hosts = append(hosts, netConfig.DNSProxyAddress)
+	}
+	for _, host := range hosts {
+		_, cidr, _ := net.ParseCIDR(hostCIDR(host))
+		allowed = append(allowed, *cidr)
+	}
+
+	if netConfig.Kubernetes.ServiceCIDR != "" {
+		_, cidr, err := net.ParseCIDR(netConfig.Kubernetes.ServiceCIDR)
+		if err == nil {
+			allowed = append(allowed, *cidr)
+		}
+	}
+
+	var denied []string
+	if netConfig.IPFamily != vpc.IPFamilyIPv6 {
+		denied = append(denied, vpc.ExcludeCIDRs(net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, allowed)...)
+	}
+	if netConfig.IPFamily != vpc.IPFamilyIPv4 {
+		denied = append(denied, vpc.ExcludeCIDRs(net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}, allowed)...)
+	}
+
+	return policy.Rule{
+		Action:    policy.ActionDeny,
+		Direction: policy.DirectionEgress,
+		Protocol:  policy.ProtocolAll,
+		CIDRs:     denied,
+	}
+}
+
+// applyEgressRestriction adds the rule of the egress restriction ahead of all other rules.
+func applyEgressRestriction(netConfig *NetConfig) {
+	if netConfig.Policy == nil {
+		netConfig.Policy = &policy.Document{DefaultAction: policy.ActionAllow}
+	}
+	netConfig.Policy.Rules = append([]policy.Rule{egressRestrictionRule(netConfig)}, netConfig.Policy.Rules...)
+}
@@ -0,0 +1,243 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	log "github.com/cihub/seelog"
+)
+
+// The IMDS-derived configuration mode is enabled with "imdsDerivedConfig": true in the network
+// configuration. The fields that are sensitive or error-prone to supply from the orchestrator,
+// namely the ENI IP address and subnet, the VPC CIDR blocks, the gateway and the DNS servers,
+// are then rejected if present, and always derived from the instance metadata of the ENI with
+// the configured MAC address instead.
+
+const (
+	// eniMetadataPathFormat is the format of the instance metadata path of an ENI.
+	eniMetadataPathFormat = "network/interfaces/macs/%s/"
+)
+
+var (
+	retrieveMetadataHandler func(path string) (string, error)
+)
+
+// RegisterMetadataHandler registers the handler that retrieves instance metadata resources, which
+// is used for deriving trusted network configuration.
+func RegisterMetadataHandler(handler func(path string) (string, error)) {
+	retrieveMetadataHandler = handler
+}
+
+// ENIMetadata is the network configuration of an ENI derived from its instance metadata.
+type ENIMetadata struct {
+	// IPAddress is the primary address of the ENI, with the prefix length of its subnet.
+	IPAddress string
+	// SecondaryIPAddresses are the secondary addresses of the ENI, with the prefix length of
+	// its subnet.
+	SecondaryIPAddresses []string
+	VPCCIDRs             []string
+	// Gateway is empty if the gateway is not at the conventional address in the ENI subnet.
+	Gateway   string
+	DNSServer string
+	ZoneType  string
+}
+
+// deriveConfigFromMetadata replaces the trusted fields of the network configuration with the
+// values derived from the instance metadata of the ENI.
+func deriveConfigFromMetadata(config *netConfigJSON) error {
+	err := validateMetadataDerivedConfig(config)
+	if err != nil {
+		return err
+	}
+
+	macAddress, _ := net.ParseMAC(config.ENIMACAddress)
+	metadata, err := GetENIMetadata(macAddress, config.IPFamily, config.ZoneType)
+	if err != nil {
+		return err
+	}
+
+	config.ENIIPAddress = metadata.IPAddress
+	config.VPCCIDRs = metadata.VPCCIDRs
+	config.GatewayIPAddress = metadata.Gateway
+	config.DNS.Nameservers = []string{metadata.DNSServer}
+	config.ZoneType = metadata.ZoneType
+
+	return nil
+}
+
+// validateMetadataDerivedConfig validates that the network configuration leaves the fields
+// derived from instance metadata unset, and identifies the ENI by its MAC address.
+func validateMetadataDerivedConfig(config *netConfigJSON) error {
+	if config.ENIIPAddress != "" || len(config.VPCCIDRs) != 0 ||
+		config.GatewayIPAddress != "" || len(config.DNS.Nameservers) != 0 {
+		return fmt.Errorf("imdsDerivedConfig does not allow eniIPAddress, vpcCIDRs, " +
+			"gatewayIPAddress or dns nameservers in the network configuration")
+	}
+
+	_, err := net.ParseMAC(config.ENIMACAddress)
+	if err != nil {
+		return fmt.Errorf("imdsDerivedConfig requires a valid eniMACAddress")
+	}
+
+	return nil
+}
+
+// GetENIMetadata derives the network configuration of the ENI with the given MAC address in the
+// given IP family from its instance metadata, following the conventions of the given zone type.
+// The zone type is detected if empty.
+func GetENIMetadata(macAddress net.HardwareAddr, ipFamily string, zoneType string) (*ENIMetadata, error) {
+	if retrieveMetadataHandler == nil {
+		return nil, fmt.Errorf("no instance metadata handler registered")
+	}
+
+	if zoneType == "" {
+		var err error
+		zoneType, err = GetZoneType()
+		if err != nil {
+			log.Warnf("Failed to detect zone type, assuming %s: %v.", ZoneTypeAvailabilityZone, err)
+			zoneType = ZoneTypeAvailabilityZone
+		}
+	}
+
+	// Resource names differ between IP families.
+	addressesName, subnetName, vpcName := "local-ipv4s", "subnet-ipv4-cidr-block", "vpc-ipv4-cidr-blocks"
+	if ipFamily == vpc.IPFamilyIPv6 {
+		addressesName, subnetName, vpcName = "ipv6s", "subnet-ipv6-cidr-blocks", "vpc-ipv6-cidr-blocks"
+	}
+
+	getValues := func(name string) ([]string, error) {
+		path := fmt.Sprintf(eniMetadataPathFormat, macAddress) + name
+		value, err := retrieveMetadataHandler(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve instance metadata %s: %v", path, err)
+		}
+		values := strings.Fields(value)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("instance metadata %s is empty", path)
+		}
+		return values, nil
+	}
+
+	addresses, err := getValues(addressesName)
+	if err != nil {
+		return nil, err
+	}
+	subnets, err := getValues(subnetName)
+	if err != nil {
+		return nil, err
+	}
+	vpcCIDRs, err := getValues(vpcName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ENI's primary address is the first one, and the gateway is at the base of its subnet
+	// plus one.
+	subnet, err := vpc.NewSubnetFromString(subnets[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance metadata subnet %s", subnets[0])
+	}
+	prefixLength, _ := subnet.Prefix.Mask.Size()
+
+	metadata := &ENIMetadata{
+		VPCCIDRs: vpcCIDRs,
+		ZoneType: zoneType,
+	}
+
+	// Local network interfaces of Outposts servers lease their gateway on the on-premises
+	// network. Leaving the gateway unset lets DHCP networks use the leased gateway, and others
+	// fall back to the same conventional address.
+	if zoneType != ZoneTypeOutpost {
+		metadata.Gateway = subnet.Gateways[0].String()
+	}
+
+	for i, address := range addresses {
+		ipAddress := net.ParseIP(address)
+		if ipAddress == nil || !subnet.Prefix.Contains(ipAddress) {
+			return nil, fmt.Errorf("invalid instance metadata address %s in subnet %s", address, subnets[0])
+		}
+		address = fmt.Sprintf("%s/%d", ipAddress, prefixLength)
+		if i == 0 {
+			metadata.IPAddress = address
+		} else {
+			metadata.SecondaryIPAddresses = append(metadata.SecondaryIPAddresses, address)
+		}
+	}
+
+	// Use the Amazon-provided DNS server, at the base of the primary VPC CIDR block plus two for
+	// IPv4, and at its well-known address for IPv6. Zones away from the parent region use the
+	// link-local address served by the local host instead.
+	switch {
+	case ipFamily == vpc.IPFamilyIPv6:
+		metadata.DNSServer = vpc.DNS64ServerAddress
+	case usesLocalDNS(zoneType):
+		metadata.DNSServer = vpc.DNSServerAddress
+	default:
+		_, vpcCIDR, err := net.ParseCIDR(vpcCIDRs[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance metadata VPC CIDR block %s", vpcCIDRs[0])
+		}
+		metadata.DNSServer = vpc.ComputeIPAddress(vpcCIDR, net.IP{0, 0, 0, 2}).String()
+	}
+
+	return metadata, nil
+}
+
+// DetectENIMACAddress returns the MAC address of the secondary ENI with the lowest device number
+// in the instance metadata. The primary ENI, with device number zero, is never shared.
+func DetectENIMACAddress() (net.HardwareAddr, error) {
+	if retrieveMetadataHandler == nil {
+		return nil, fmt.Errorf("no instance metadata handler registered")
+	}
+
+	value, err := retrieveMetadataHandler("network/interfaces/macs/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ENIs in instance metadata: %v", err)
+	}
+
+	var found net.HardwareAddr
+	minDeviceNumber := -1
+	for _, mac := range strings.Fields(value) {
+		macAddress, err := net.ParseMAC(strings.TrimSuffix(mac, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance metadata MAC address %s", mac)
+		}
+
+		path := fmt.Sprintf(eniMetadataPathFormat, macAddress) + "device-number"
+		value, err := retrieveMetadataHandler(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve instance metadata %s: %v", path, err)
+		}
+		deviceNumber, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance metadata device number %s", value)
+		}
+
+		if deviceNumber != 0 && (minDeviceNumber == -1 || deviceNumber < minDeviceNumber) {
+			found, minDeviceNumber = macAddress, deviceNumber
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no secondary ENI attached to the instance")
+	}
+
+	return found, nil
+}
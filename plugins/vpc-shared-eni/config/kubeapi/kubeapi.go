@@ -11,9 +11,9 @@
 // express or implied. See the License for the specific language governing
 // permissions and limitations under the License.
 
-// +build !disablekubeapi
-
-package config
+// Package kubeapi retrieves pod configuration from the Kubernetes API server. It is imported only
+// by binaries that need it, as the Kubernetes client accounts for much of their size.
+package kubeapi
 
 import (
 	"fmt"
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
 
 	log "github.com/cihub/seelog"
 
@@ -39,11 +40,11 @@ const (
 )
 
 func init() {
-	retrievePodConfigHandler = retrievePodConfig
+	config.RegisterPodConfigHandler(retrievePodConfig)
 }
 
 // retrievePodConfig retrieves a pod's configuration from an external source.
-func retrievePodConfig(netConfig *NetConfig) error {
+func retrievePodConfig(netConfig *config.NetConfig) error {
 	// Retrieve the IP address configuration from pod.
 	kubeClient, err := createKubeClient()
 	if err != nil {
@@ -88,13 +89,13 @@ func createKubeClient() (kubernetes.Interface, error) {
 	kubeconfig := os.Getenv("KUBECONFIG")
 
 	// Create the config from the path.
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build kubeconfig: %v", err)
 	}
 
 	// Generate the client for the given config.
-	client, err := kubernetes.NewForConfig(config)
+	client, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
 	}
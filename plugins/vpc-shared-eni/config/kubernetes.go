@@ -49,6 +49,12 @@ var (
 	retrievePodConfigHandler func(netConfig *NetConfig) error
 )
 
+// RegisterPodConfigHandler registers the handler that retrieves pod configuration missing from
+// the network configuration, such as the pod IP address kept by the Kubernetes API server.
+func RegisterPodConfigHandler(handler func(netConfig *NetConfig) error) {
+	retrievePodConfigHandler = handler
+}
+
 // parseKubernetesArgs parses Kubernetes-specific CNI arguments.
 func parseKubernetesArgs(netConfig *NetConfig, args *cniSkel.CmdArgs, isAddCmd bool) error {
 	if args == nil || args.Args == "" {
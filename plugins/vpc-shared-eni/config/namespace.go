@@ -0,0 +1,100 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
+
+	log "github.com/cihub/seelog"
+)
+
+// namespaceDefaultsJSON defines the per-namespace policy defaults file format. Cluster operators
+// drop a <namespace>.json file in the namespace defaults directory to apply guardrails to every
+// pod in that namespace without editing the network configuration.
+type namespaceDefaultsJSON struct {
+	Policy        json.RawMessage `json:"policy"`
+	NATExceptions []string        `json:"natExceptions"`
+	EgressRate    uint64          `json:"egressRate"`
+}
+
+// loadNamespaceDefaults loads the policy defaults of the pod's namespace, if any, and merges
+// them into the network configuration.
+func loadNamespaceDefaults(netConfig *NetConfig, dir string) error {
+	namespace := netConfig.Kubernetes.Namespace
+	if dir == "" || namespace == "" {
+		return nil
+	}
+
+	// Namespace names are DNS labels. Reject anything that could escape the directory.
+	if strings.ContainsAny(namespace, `/\`) || namespace == "." || namespace == ".." {
+		return fmt.Errorf("invalid namespace %s", namespace)
+	}
+
+	path := filepath.Join(dir, namespace+".json")
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read namespace defaults: %v", err)
+	}
+
+	var defaults namespaceDefaultsJSON
+	err = json.Unmarshal(data, &defaults)
+	if err != nil {
+		return fmt.Errorf("failed to parse namespace defaults %s: %v", path, err)
+	}
+
+	log.Infof("Applying namespace defaults from %s.", path)
+
+	// Namespace rules are evaluated ahead of the rules in the network configuration, and the
+	// stricter of the two default actions applies.
+	if len(defaults.Policy) != 0 {
+		doc, err := policy.Parse(defaults.Policy)
+		if err != nil {
+			return fmt.Errorf("invalid namespace policy: %v", err)
+		}
+
+		if netConfig.Policy == nil {
+			netConfig.Policy = doc
+		} else {
+			netConfig.Policy.Rules = append(doc.Rules, netConfig.Policy.Rules...)
+			if doc.DefaultAction == policy.ActionDeny {
+				netConfig.Policy.DefaultAction = policy.ActionDeny
+			}
+		}
+	}
+
+	for _, exception := range defaults.NATExceptions {
+		_, prefix, err := net.ParseCIDR(exception)
+		if err != nil {
+			return fmt.Errorf("invalid NAT exception %s", exception)
+		}
+		netConfig.NATExceptions = append(netConfig.NATExceptions, prefix)
+	}
+
+	if defaults.EgressRate != 0 {
+		netConfig.EgressRate = defaults.EgressRate
+	}
+
+	return nil
+}
@@ -16,65 +16,224 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/exclusion"
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
 	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
 
 	log "github.com/cihub/seelog"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
 )
 
 // NetConfig defines the network configuration for the vpc-shared-eni plugin.
 type NetConfig struct {
 	cniTypes.NetConf
-	ENIName          string
-	ENIMACAddress    net.HardwareAddr
-	ENIIPAddress     *net.IPNet
-	VPCCIDRs         []net.IPNet
-	BridgeType       string
-	BridgeNetNSPath  string
-	IPAddress        *net.IPNet
-	GatewayIPAddress net.IP
-	InterfaceType    string
-	TapUserID        int
-	Kubernetes       KubernetesConfig
+	ENIName              string
+	ENIMACAddress        net.HardwareAddr
+	ENIIPAddress         *net.IPNet
+	StandbyENIName       string
+	StandbyENIMACAddress net.HardwareAddr
+	VPCCIDRs             []net.IPNet
+	ExtraPrefixes        []*net.IPNet
+	ExtraPrefixesTag     string
+	BridgeType           string
+	BridgeNetNSPath      string
+	IPAddressMode        string
+	NetworkDeletion      string
+	IPAddress            *net.IPNet
+	IPAddressPool        []*net.IPNet
+	GatewayIPAddress     net.IP
+	ZoneType             string
+	InterfaceType        string
+	TapUserID            int
+	IPFamily             string
+	DNS64                bool
+	NAT64Prefix          *net.IPNet
+	DNSProxyAddress      net.IP
+	Policy               *policy.Document
+	HostFirewallRules    []policy.Rule
+	SecureDefaults       bool
+	RestrictEgress       bool
+	EgressAllowedCIDRs   []*net.IPNet
+	DNSLockdown          bool
+	DNSAllowedResolvers  []*net.IPNet
+	AntiSpoofing         bool
+	EastWestIsolation    bool
+	EastWestOptIn        bool
+	NATExceptions        []*net.IPNet
+	EgressRate           uint64
+	AgentSocket          string
+	NotifySocket         string
+	OwnerID              string
+	ForceDelete          bool
+	ExcludedAdapters     *exclusion.List
+	Backoff              backoff.Policy
+	MaxConcurrentOps     int
+	HNSCallTimeout       HNSCallTimeoutConfig
+	Sandbox              SandboxConfig
+	Kubernetes           KubernetesConfig
+	Sysctls              map[string]string
+	PrevResult           *cniTypesCurrent.Result
+}
+
+// SandboxConfig defines the sandbox that the endpoint is attached to, as provided by the runtime.
+type SandboxConfig struct {
+	// Isolation is the sandbox isolation type.
+	Isolation string
+	// UtilityVMID is the ID of the utility VM backing a Hyper-V isolated sandbox.
+	UtilityVMID string
+	// ManagedNamespace is whether the plugin creates and owns the network namespace of the
+	// sandbox, instead of attaching to the namespace of an infrastructure container. Windows only.
+	ManagedNamespace bool
+}
+
+// HNSCallTimeoutConfig bounds the ceiling on the duration of HNS calls, which adapts to the HNS
+// latencies observed on the host. Zero values select the defaults. Windows only.
+type HNSCallTimeoutConfig struct {
+	Min time.Duration
+	Max time.Duration
 }
 
 // netConfigJSON defines the network configuration JSON file format for the vpc-shared-eni plugin.
 type netConfigJSON struct {
 	cniTypes.NetConf
-	ENIName          string   `json:"eniName"`
-	ENIMACAddress    string   `json:"eniMACAddress"`
-	ENIIPAddress     string   `json:"eniIPAddress"`
-	VPCCIDRs         []string `json:"vpcCIDRs"`
-	BridgeType       string   `json:"bridgeType"`
-	BridgeNetNSPath  string   `json:"bridgeNetNSPath"`
-	IPAddress        string   `json:"ipAddress"`
-	GatewayIPAddress string   `json:"gatewayIPAddress"`
-	InterfaceType    string   `json:"interfaceType"`
-	TapUserID        string   `json:"tapUserID"`
-	ServiceCIDR      string   `json:"serviceCIDR"`
+	CNIVersions          []string            `json:"cniVersions"`
+	PrevResult           json.RawMessage     `json:"prevResult"`
+	ENIName              string              `json:"eniName"`
+	ENIMACAddress        string              `json:"eniMACAddress"`
+	ENIIPAddress         string              `json:"eniIPAddress"`
+	StandbyENIName       string              `json:"standbyENIName"`
+	StandbyENIMACAddress string              `json:"standbyENIMACAddress"`
+	VPCCIDRs             []string            `json:"vpcCIDRs"`
+	ExtraPrefixes        []string            `json:"extraPrefixes"`
+	ExtraPrefixesFile    string              `json:"extraPrefixesFile"`
+	ExtraPrefixesTag     string              `json:"extraPrefixesTag"`
+	BridgeType           string              `json:"bridgeType"`
+	BridgeNetNSPath      string              `json:"bridgeNetNSPath"`
+	IPAddressMode        string              `json:"ipAddressMode"`
+	NetworkDeletion      string              `json:"networkDeletion"`
+	IPAddress            string              `json:"ipAddress"`
+	IPAddressPool        []string            `json:"secondaryIPAddresses"`
+	GatewayIPAddress     string              `json:"gatewayIPAddress"`
+	ZoneType             string              `json:"zoneType"`
+	InterfaceType        string              `json:"interfaceType"`
+	TapUserID            string              `json:"tapUserID"`
+	ServiceCIDR          string              `json:"serviceCIDR"`
+	IPFamily             string              `json:"ipFamily"`
+	DNS64                bool                `json:"dns64"`
+	NAT64Prefix          string              `json:"nat64Prefix"`
+	DNSProxyAddress      string              `json:"dnsProxyAddress"`
+	Policy               json.RawMessage     `json:"policy"`
+	PolicyFile           string              `json:"policyFile"`
+	SecurityGroups       json.RawMessage     `json:"securityGroups"`
+	SecurityGroupsFile   string              `json:"securityGroupsFile"`
+	SecurityGroupCIDRs   map[string][]string `json:"securityGroupCIDRs"`
+	HostFirewallRules    json.RawMessage     `json:"hostFirewallRules"`
+	SecureDefaults       bool                `json:"secureDefaults"`
+	IMDSDerivedConfig    bool                `json:"imdsDerivedConfig"`
+	RestrictEgress       bool                `json:"restrictEgress"`
+	EgressAllowedCIDRs   []string            `json:"egressAllowedCIDRs"`
+	DNSLockdown          bool                `json:"dnsLockdown"`
+	DNSAllowedResolvers  []string            `json:"dnsAllowedResolvers"`
+	AntiSpoofing         *bool               `json:"antiSpoofing"`
+	EastWestIsolation    bool                `json:"eastWestIsolation"`
+	EastWestOptIn        bool                `json:"eastWestOptIn"`
+	NamespaceDefaultsDir string              `json:"namespaceDefaultsDir"`
+	AgentSocket          string              `json:"agentSocket"`
+	NotifySocket         string              `json:"notifySocket"`
+	OwnerID              string              `json:"ownerID"`
+	ForceDelete          bool                `json:"forceDelete"`
+	ExcludedAdaptersFile string              `json:"excludedAdaptersFile"`
+	Backoff              backoffJSON         `json:"backoff"`
+	MaxConcurrentOps     *int                `json:"maxConcurrentOperations"`
+	HNSCallTimeout       durationRange       `json:"hnsCallTimeout"`
+	ManagedNamespace     bool                `json:"managedNamespace"`
+	Sysctls              map[string]string   `json:"sysctls"`
+	RuntimeConfig        struct {
+		Sandbox struct {
+			Isolation   string `json:"isolation"`
+			UtilityVMID string `json:"utilityVMID"`
+		} `json:"sandbox"`
+	} `json:"runtimeConfig"`
+}
+
+// durationRange defines bounds of a duration in the network configuration.
+type durationRange struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// backoffJSON defines the retry policy for transient failures in the network configuration.
+type backoffJSON struct {
+	MaxAttempts     int    `json:"maxAttempts"`
+	InitialInterval string `json:"initialInterval"`
+	MaxInterval     string `json:"maxInterval"`
 }
 
+// SpecVersions are the CNI spec versions supported by the plugin.
+var SpecVersions = append([]string{"0.3.0", "0.3.1"}, cni.ResultVersions...)
+
 const (
 	// Bridge network namespace defaults to the host network namespace (empty string),
 	// or more precisely, whichever namespace the CNI plugin is running in.
 	defaultBridgeNetNSPath = ""
 
-	// Bridge type values.
+	// Bridge type values. On Linux, both bridge types share one ENI among many containers
+	// through a bridge per network and ENI, with a veth pair per container. In L2 mode, the ENI
+	// stays in the host network namespace and is attached to the bridge, so that containers are
+	// directly reachable on the VPC subnet. In L3 mode, container traffic is routed by the host.
 	BridgeTypeL2 = "L2"
 	BridgeTypeL3 = "L3"
 
 	// Interface type values.
-	IfTypeVETH = "veth"
-	IfTypeTAP  = "tap"
+	IfTypeVETH    = "veth"
+	IfTypeTAP     = "tap"
+	IfTypeMacvtap = "macvtap"
+	// IPVLAN endpoints are IPVLAN L2 sub-interfaces of the ENI, sharing its MAC address, without
+	// any bridge. Linux only.
+	IfTypeIPVLAN = "ipvlan"
+
+	// IP address mode values.
+	IPAddressModeStatic = "static"
+	IPAddressModeDHCP   = "dhcp"
+
+	// Network deletion values.
+	NetworkDeletionKeep      = "keep"
+	NetworkDeletionImmediate = "immediate"
+	NetworkDeletionDeferred  = "deferred"
+
+	// Sandbox isolation values.
+	SandboxIsolationProcess = "process"
+	SandboxIsolationHyperV  = "hyperv"
+	SandboxIsolationMicroVM = "microvm"
 )
 
 // New creates a new NetConfig object by parsing the given CNI arguments.
 func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
+	return parse(args, isAddCmd, false)
+}
+
+// Validate validates the given network configuration offline, e.g. in image build pipelines.
+// Fields derived from instance metadata are not retrieved.
+func Validate(data []byte) error {
+	_, err := parse(&cniSkel.CmdArgs{StdinData: data}, false, true)
+	return err
+}
+
+// parse creates a new NetConfig object by parsing the given CNI arguments. Offline parsing
+// skips the fields derived from instance metadata.
+func parse(args *cniSkel.CmdArgs, isAddCmd bool, offline bool) (*NetConfig, error) {
 	// Parse network configuration.
 	var config netConfigJSON
 	err := json.Unmarshal(args.StdinData, &config)
@@ -82,11 +241,37 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		return nil, fmt.Errorf("failed to parse network config: %v", err)
 	}
 
+	// Results are written in the highest version supported by both the runtime and the plugin.
+	config.CNIVersion, err = cni.NegotiateVersion(config.CNIVersion, config.CNIVersions, SpecVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Take the fields omitted by chained configurations from the previous result.
+	var prevResult *cniTypesCurrent.Result
+	if len(config.PrevResult) != 0 {
+		prevResult, err = parsePrevResult(config.PrevResult)
+		if err != nil {
+			return nil, err
+		}
+		applyPrevResult(&config, prevResult)
+	}
+
 	// Validate if all the required fields are present.
 	if config.ENIName == "" && config.ENIMACAddress == "" {
 		return nil, fmt.Errorf("missing required parameter ENIName or ENIMACAddress")
 	}
 
+	// Adapter names are passed to HNS and to external commands.
+	for _, name := range []string{config.ENIName, config.StandbyENIName} {
+		if name != "" {
+			err = cni.ValidateAdapterName(name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Set defaults.
 	if config.BridgeType == "" {
 		config.BridgeType = BridgeTypeL3
@@ -96,20 +281,81 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		config.BridgeNetNSPath = defaultBridgeNetNSPath
 	}
 
+	if config.IPAddressMode == "" {
+		config.IPAddressMode = IPAddressModeStatic
+	}
+
+	if config.NetworkDeletion == "" {
+		config.NetworkDeletion = NetworkDeletionKeep
+	}
+
+	// Addresses are IPv4 unless IPv6-only mode is explicitly requested.
+	if config.IPFamily == "" {
+		config.IPFamily = vpc.IPFamilyIPv4
+	}
+
+	sandbox := &config.RuntimeConfig.Sandbox
+	if sandbox.Isolation == "" {
+		if sandbox.UtilityVMID != "" {
+			sandbox.Isolation = SandboxIsolationHyperV
+		} else {
+			sandbox.Isolation = SandboxIsolationProcess
+		}
+	}
+
 	if config.InterfaceType == "" {
-		config.InterfaceType = IfTypeVETH
+		// MicroVM sandboxes connect to the endpoint through a TAP interface.
+		if sandbox.Isolation == SandboxIsolationMicroVM {
+			config.InterfaceType = IfTypeTAP
+		} else {
+			config.InterfaceType = IfTypeVETH
+		}
+	}
+
+	// Parse the optional zone type.
+	if config.ZoneType != "" && !isValidZoneType(config.ZoneType) {
+		return nil, fmt.Errorf("invalid ZoneType %s", config.ZoneType)
+	}
+
+	// Derive the trusted fields from instance metadata instead of the network configuration.
+	if config.IMDSDerivedConfig {
+		if offline {
+			err = validateMetadataDerivedConfig(&config)
+		} else {
+			err = deriveConfigFromMetadata(&config)
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Populate NetConfig.
 	netConfig := NetConfig{
-		NetConf:         config.NetConf,
-		ENIName:         config.ENIName,
-		BridgeType:      config.BridgeType,
-		BridgeNetNSPath: config.BridgeNetNSPath,
-		InterfaceType:   config.InterfaceType,
+		NetConf:          config.NetConf,
+		ENIName:          config.ENIName,
+		StandbyENIName:   config.StandbyENIName,
+		BridgeType:       config.BridgeType,
+		BridgeNetNSPath:  config.BridgeNetNSPath,
+		ExtraPrefixesTag: config.ExtraPrefixesTag,
+		IPAddressMode:    config.IPAddressMode,
+		NetworkDeletion:  config.NetworkDeletion,
+		ZoneType:         config.ZoneType,
+		InterfaceType:    config.InterfaceType,
+		IPFamily:         config.IPFamily,
+		DNS64:            config.DNS64,
+		AgentSocket:      config.AgentSocket,
+		NotifySocket:     config.NotifySocket,
+		OwnerID:          config.OwnerID,
+		ForceDelete:      config.ForceDelete,
+		Sandbox: SandboxConfig{
+			Isolation:        sandbox.Isolation,
+			UtilityVMID:      sandbox.UtilityVMID,
+			ManagedNamespace: config.ManagedNamespace,
+		},
 		Kubernetes: KubernetesConfig{
 			ServiceCIDR: config.ServiceCIDR,
 		},
+		PrevResult: prevResult,
 	}
 
 	// Parse the ENI MAC address.
@@ -120,6 +366,57 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		}
 	}
 
+	// Parse the optional standby ENI, which the agent fails over to when the ENI is unhealthy.
+	if config.StandbyENIName != "" || config.StandbyENIMACAddress != "" {
+		if config.AgentSocket == "" {
+			return nil, fmt.Errorf("standby ENI requires agentSocket")
+		}
+	}
+
+	if config.StandbyENIMACAddress != "" {
+		netConfig.StandbyENIMACAddress, err = net.ParseMAC(config.StandbyENIMACAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid StandbyENIMACAddress %s", config.StandbyENIMACAddress)
+		}
+	}
+
+	// Parse the optional owner ID, which isolates the resources of multiple CNI stacks on a node.
+	err = owner.Validate(config.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the optional retry policy for transient failures.
+	netConfig.Backoff, err = parseBackoff(&config.Backoff)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the optional limit of network operations running concurrently on the node across
+	// plugin processes. Zero means no limit.
+	netConfig.MaxConcurrentOps = defaultMaxConcurrentOps
+	if config.MaxConcurrentOps != nil {
+		if *config.MaxConcurrentOps < 0 {
+			return nil, fmt.Errorf("invalid maxConcurrentOperations %d", *config.MaxConcurrentOps)
+		}
+		netConfig.MaxConcurrentOps = *config.MaxConcurrentOps
+	}
+
+	// Parse the optional bounds of the HNS call ceiling.
+	netConfig.HNSCallTimeout, err = parseHNSCallTimeout(&config.HNSCallTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the list of host adapters that the plugin must never touch.
+	if config.ExcludedAdaptersFile == "" {
+		config.ExcludedAdaptersFile = exclusion.DefaultPath
+	}
+	netConfig.ExcludedAdapters, err = exclusion.Load(config.ExcludedAdaptersFile)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse the optional ENI IP address.
 	if config.ENIIPAddress != "" {
 		netConfig.ENIIPAddress, err = vpc.GetIPAddressFromString(config.ENIIPAddress)
@@ -139,11 +436,88 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		}
 	}
 
+	// Parse the optional egress restriction to the VPC and allowed CIDR blocks.
+	if config.RestrictEgress && len(netConfig.VPCCIDRs) == 0 {
+		return nil, fmt.Errorf("restrictEgress requires vpcCIDRs")
+	}
+	for _, cidrString := range config.EgressAllowedCIDRs {
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egressAllowedCIDR %s", cidrString)
+		}
+		netConfig.EgressAllowedCIDRs = append(netConfig.EgressAllowedCIDRs, cidr)
+	}
+
+	// Parse the optional resolvers allowed in addition to the VPC resolvers, as addresses or
+	// CIDR blocks.
+	for _, resolver := range config.DNSAllowedResolvers {
+		cidrString := resolver
+		if ip := net.ParseIP(resolver); ip != nil {
+			cidrString = hostCIDR(ip)
+		}
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dnsAllowedResolver %s", resolver)
+		}
+		netConfig.DNSAllowedResolvers = append(netConfig.DNSAllowedResolvers, cidr)
+	}
+
+	// Parse the optional extra prefixes routed via the ENI gateway. Prefixes in the tag are
+	// fetched from instance metadata when the endpoint is created.
+	netConfig.ExtraPrefixes, err = ParsePrefixes(strings.Join(config.ExtraPrefixes, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ExtraPrefixesFile != "" {
+		data, err := ioutil.ReadFile(config.ExtraPrefixesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extra prefixes file: %v", err)
+		}
+
+		prefixes, err := ParsePrefixes(string(data))
+		if err != nil {
+			return nil, err
+		}
+		netConfig.ExtraPrefixes = append(netConfig.ExtraPrefixes, prefixes...)
+	}
+
 	// Parse the bridge type.
 	if config.BridgeType != BridgeTypeL2 && config.BridgeType != BridgeTypeL3 {
 		return nil, fmt.Errorf("invalid BridgeType %s", config.BridgeType)
 	}
 
+	// Parse the IP address mode.
+	switch config.IPAddressMode {
+	case IPAddressModeStatic:
+	case IPAddressModeDHCP:
+		// Endpoints obtain their addresses from the VPC DHCP service over the shared ENI.
+		if config.IPAddress != "" || config.IPAddressPool != nil || config.IPAM.Type != "" {
+			return nil, fmt.Errorf(
+				"ipAddressMode %s cannot be combined with ipAddress, secondaryIPAddresses or ipam",
+				IPAddressModeDHCP)
+		}
+		if config.BridgeType != BridgeTypeL2 || config.IPFamily != vpc.IPFamilyIPv4 {
+			return nil, fmt.Errorf("ipAddressMode %s requires BridgeType %s and IPFamily %s",
+				IPAddressModeDHCP, BridgeTypeL2, vpc.IPFamilyIPv4)
+		}
+	default:
+		return nil, fmt.Errorf("invalid IPAddressMode %s", config.IPAddressMode)
+	}
+
+	// Parse the network deletion mode. Networks are kept for reuse by default. Deferred deletion
+	// is completed by the agent or by later plugin invocations, keeping DEL latency bounded.
+	switch config.NetworkDeletion {
+	case NetworkDeletionKeep:
+	case NetworkDeletionImmediate, NetworkDeletionDeferred:
+		if config.AgentSocket != "" {
+			return nil, fmt.Errorf("networkDeletion %s cannot be combined with agentSocket",
+				config.NetworkDeletion)
+		}
+	default:
+		return nil, fmt.Errorf("invalid NetworkDeletion %s", config.NetworkDeletion)
+	}
+
 	// Parse the optional IP address.
 	if config.IPAddress != "" {
 		netConfig.IPAddress, err = vpc.GetIPAddressFromString(config.IPAddress)
@@ -152,6 +526,15 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		}
 	}
 
+	// Parse the optional pool of ENI secondary IP addresses to allocate from.
+	for _, ipAddress := range config.IPAddressPool {
+		address, err := vpc.GetIPAddressFromString(ipAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secondary IPAddress %s", ipAddress)
+		}
+		netConfig.IPAddressPool = append(netConfig.IPAddressPool, address)
+	}
+
 	// Parse the optional gateway IP address.
 	if config.GatewayIPAddress != "" {
 		netConfig.GatewayIPAddress = net.ParseIP(config.GatewayIPAddress)
@@ -161,10 +544,39 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 	}
 
 	// Parse the interface type.
-	if config.InterfaceType != IfTypeVETH && config.InterfaceType != IfTypeTAP {
+	switch config.InterfaceType {
+	case IfTypeVETH, IfTypeTAP, IfTypeMacvtap:
+	case IfTypeIPVLAN:
+		// IPVLAN endpoints are reached by the ENI secondary IP addresses they are assigned.
+		// The ENI stays in the host network namespace and is not attached to a bridge.
+		if config.BridgeType != BridgeTypeL3 || config.BridgeNetNSPath != "" ||
+			config.IPAddressMode != IPAddressModeStatic {
+			return nil, fmt.Errorf("interfaceType %s requires BridgeType %s and ipAddressMode %s, "+
+				"and cannot be combined with bridgeNetNSPath", IfTypeIPVLAN, BridgeTypeL3, IPAddressModeStatic)
+		}
+		// Frames of IPVLAN endpoints bypass the bridge, where their source addresses and
+		// east-west traffic are filtered.
+		if config.AntiSpoofing == nil || *config.AntiSpoofing || config.EastWestIsolation {
+			return nil, fmt.Errorf("interfaceType %s requires antiSpoofing to be disabled, "+
+				"and cannot be combined with eastWestIsolation", IfTypeIPVLAN)
+		}
+	default:
 		return nil, fmt.Errorf("invalid InterfaceType %s", config.InterfaceType)
 	}
 
+	// Parse the sandbox isolation type.
+	switch sandbox.Isolation {
+	case SandboxIsolationProcess, SandboxIsolationHyperV, SandboxIsolationMicroVM:
+	default:
+		return nil, fmt.Errorf("invalid sandbox isolation %s", sandbox.Isolation)
+	}
+
+	// Plugin managed namespaces are attached to process isolated sandboxes only.
+	if config.ManagedNamespace && sandbox.Isolation != SandboxIsolationProcess {
+		return nil, fmt.Errorf("managedNamespace is not supported with sandbox isolation %s",
+			sandbox.Isolation)
+	}
+
 	// Parse the optional TAP user ID.
 	if config.TapUserID != "" {
 		netConfig.TapUserID, err = strconv.Atoi(config.TapUserID)
@@ -173,6 +585,70 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		}
 	}
 
+	// Parse the IP family.
+	if config.IPFamily != vpc.IPFamilyIPv4 && config.IPFamily != vpc.IPFamilyIPv6 {
+		return nil, fmt.Errorf("invalid IPFamily %s", config.IPFamily)
+	}
+
+	// Parse the optional NAT64 prefix. DNS64 synthesizes addresses with the well-known prefix.
+	if config.NAT64Prefix == "" && config.DNS64 {
+		config.NAT64Prefix = vpc.WellKnownNAT64Prefix
+	}
+
+	if config.NAT64Prefix != "" {
+		_, netConfig.NAT64Prefix, err = net.ParseCIDR(config.NAT64Prefix)
+		if err != nil || vpc.IsIPv4(netConfig.NAT64Prefix.IP) {
+			return nil, fmt.Errorf("invalid NAT64Prefix %s", config.NAT64Prefix)
+		}
+	}
+
+	// Use the Amazon-provided DNS64 server unless name servers are configured explicitly.
+	if config.DNS64 && len(netConfig.DNS.Nameservers) == 0 {
+		netConfig.DNS.Nameservers = []string{vpc.DNS64ServerAddress}
+	}
+
+	// Parse the optional DNS proxy address. Endpoints resolve names through the proxy only.
+	if config.DNSProxyAddress != "" {
+		netConfig.DNSProxyAddress = net.ParseIP(config.DNSProxyAddress)
+		if netConfig.DNSProxyAddress == nil {
+			return nil, fmt.Errorf("invalid DNSProxyAddress %s", config.DNSProxyAddress)
+		}
+		netConfig.DNS.Nameservers = []string{netConfig.DNSProxyAddress.String()}
+	}
+
+	// Validate that the addresses do not mix IP families unexpectedly.
+	err = validateIPFamily(&netConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the optional network policy.
+	netConfig.Policy, err = policy.Load(config.Policy, config.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network policy: %v", err)
+	}
+
+	// Alternatively, compile the network policy from security group definitions.
+	sgPolicy, err := policy.LoadSecurityGroups(
+		config.SecurityGroups, config.SecurityGroupsFile, config.SecurityGroupCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid security groups: %v", err)
+	}
+	if sgPolicy != nil {
+		if netConfig.Policy != nil {
+			return nil, fmt.Errorf("both network policy and security groups specified")
+		}
+		netConfig.Policy = sgPolicy
+	}
+
+	// Parse the optional host firewall rules scoped to the endpoint. Windows only.
+	if len(config.HostFirewallRules) != 0 {
+		netConfig.HostFirewallRules, err = policy.ParseRules(config.HostFirewallRules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host firewall rules: %v", err)
+		}
+	}
+
 	// Parse orchestrator-specific configuration.
 	if strings.Contains(args.Args, "K8S") {
 		err = parseKubernetesArgs(&netConfig, args, isAddCmd)
@@ -181,7 +657,217 @@ func New(args *cniSkel.CmdArgs, isAddCmd bool) (*NetConfig, error) {
 		}
 	}
 
+	// Apply the policy defaults of the pod's namespace.
+	if isAddCmd {
+		if config.NamespaceDefaultsDir == "" {
+			config.NamespaceDefaultsDir = defaultNamespaceDefaultsDir
+		}
+		err = loadNamespaceDefaults(&netConfig, config.NamespaceDefaultsDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load namespace defaults: %v", err)
+		}
+	}
+
+	// Restrict endpoints to their assigned source addresses, unless disabled for endpoints that
+	// forward traffic on behalf of others, such as network virtual appliances.
+	netConfig.AntiSpoofing = config.AntiSpoofing == nil || *config.AntiSpoofing
+
+	// Block direct traffic to and from other endpoints on the same host, unless both endpoints
+	// opted in to east-west traffic.
+	if config.EastWestOptIn && !config.EastWestIsolation {
+		return nil, fmt.Errorf("eastWestOptIn requires eastWestIsolation")
+	}
+	netConfig.EastWestIsolation = config.EastWestIsolation
+	netConfig.EastWestOptIn = config.EastWestOptIn
+
+	// Parse the optional kernel parameters set in the endpoint's network namespace.
+	for key, value := range config.Sysctls {
+		err = validateSysctl(key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	netConfig.Sysctls = config.Sysctls
+
+	// Apply the secure defaults profile ahead of all other rules.
+	if config.SecureDefaults {
+		netConfig.SecureDefaults = true
+		applySecureDefaults(&netConfig)
+	}
+
+	// Restrict DNS traffic to approved resolvers ahead of all other rules.
+	if config.DNSLockdown {
+		netConfig.DNSLockdown = true
+		applyDNSLockdown(&netConfig)
+	}
+
+	// Restrict egress traffic to the VPC ahead of all other rules.
+	if config.RestrictEgress {
+		netConfig.RestrictEgress = true
+		applyEgressRestriction(&netConfig)
+	}
+
+	// Allow DNS traffic to the proxy ahead of any rules that would block it.
+	if netConfig.Policy != nil && netConfig.DNSProxyAddress != nil {
+		netConfig.Policy.Rules = append(dnsProxyRules(netConfig.DNSProxyAddress), netConfig.Policy.Rules...)
+	}
+
 	// Validation complete. Return the parsed NetConfig object.
 	log.Debugf("Created NetConfig: %+v", netConfig)
 	return &netConfig, nil
 }
+
+// validateIPFamily validates that all addresses in the network configuration belong to the
+// configured IP family, and that the other options are compatible with it.
+func validateIPFamily(netConfig *NetConfig) error {
+	ipAddresses := []net.IP{netConfig.GatewayIPAddress}
+	if netConfig.ENIIPAddress != nil {
+		ipAddresses = append(ipAddresses, netConfig.ENIIPAddress.IP)
+	}
+	if netConfig.IPAddress != nil {
+		ipAddresses = append(ipAddresses, netConfig.IPAddress.IP)
+	}
+	for _, ipAddress := range netConfig.IPAddressPool {
+		ipAddresses = append(ipAddresses, ipAddress.IP)
+	}
+	for _, cidr := range netConfig.VPCCIDRs {
+		ipAddresses = append(ipAddresses, cidr.IP)
+	}
+	for _, prefix := range netConfig.ExtraPrefixes {
+		ipAddresses = append(ipAddresses, prefix.IP)
+	}
+	if netConfig.DNSProxyAddress != nil {
+		ipAddresses = append(ipAddresses, netConfig.DNSProxyAddress)
+	}
+
+	err := vpc.ValidateIPFamily(netConfig.IPFamily, ipAddresses...)
+	if err != nil {
+		return err
+	}
+
+	if netConfig.IPFamily != vpc.IPFamilyIPv6 && (netConfig.DNS64 || netConfig.NAT64Prefix != nil) {
+		return fmt.Errorf("DNS64 and NAT64Prefix require IPFamily %s", vpc.IPFamilyIPv6)
+	}
+
+	// Layer2 bridges rely on ARP to switch frames between the shared ENI and endpoints.
+	if netConfig.IPFamily == vpc.IPFamilyIPv6 && netConfig.BridgeType == BridgeTypeL2 {
+		return fmt.Errorf("BridgeType %s is not supported with IPFamily %s",
+			BridgeTypeL2, vpc.IPFamilyIPv6)
+	}
+
+	return nil
+}
+
+// validateSysctl validates a kernel parameter set in the endpoint's network namespace. Only the
+// parameters under "net" are scoped to the network namespace; all others affect the host.
+func validateSysctl(key string, value string) error {
+	sep := "."
+	if strings.Contains(key, "/") {
+		sep = "/"
+	}
+
+	segments := strings.Split(key, sep)
+	if segments[0] != "net" || len(segments) < 2 {
+		return fmt.Errorf("invalid sysctl %s: only net parameters are supported", key)
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid sysctl %s", key)
+		}
+	}
+
+	if value == "" || strings.ContainsAny(value, "\n\x00") {
+		return fmt.Errorf("invalid sysctl %s value %q", key, value)
+	}
+
+	return nil
+}
+
+// parseBackoff parses the retry policy for transient failures. Unset fields keep their defaults.
+func parseBackoff(config *backoffJSON) (backoff.Policy, error) {
+	var policy backoff.Policy
+	var err error
+
+	if config.MaxAttempts < 0 {
+		return policy, fmt.Errorf("invalid backoff maxAttempts %d", config.MaxAttempts)
+	}
+	policy.MaxAttempts = config.MaxAttempts
+
+	if config.InitialInterval != "" {
+		policy.InitialInterval, err = time.ParseDuration(config.InitialInterval)
+		if err != nil || policy.InitialInterval < 0 {
+			return policy, fmt.Errorf("invalid backoff initialInterval %s", config.InitialInterval)
+		}
+	}
+
+	if config.MaxInterval != "" {
+		policy.MaxInterval, err = time.ParseDuration(config.MaxInterval)
+		if err != nil || policy.MaxInterval < 0 {
+			return policy, fmt.Errorf("invalid backoff maxInterval %s", config.MaxInterval)
+		}
+	}
+
+	return policy, nil
+}
+
+// parseHNSCallTimeout parses the bounds of the HNS call ceiling.
+func parseHNSCallTimeout(config *durationRange) (HNSCallTimeoutConfig, error) {
+	var timeout HNSCallTimeoutConfig
+	var err error
+
+	if config.Min != "" {
+		timeout.Min, err = time.ParseDuration(config.Min)
+		if err != nil || timeout.Min <= 0 {
+			return timeout, fmt.Errorf("invalid hnsCallTimeout min %s", config.Min)
+		}
+	}
+
+	if config.Max != "" {
+		timeout.Max, err = time.ParseDuration(config.Max)
+		if err != nil || timeout.Max <= 0 {
+			return timeout, fmt.Errorf("invalid hnsCallTimeout max %s", config.Max)
+		}
+	}
+
+	if timeout.Min != 0 && timeout.Max != 0 && timeout.Min > timeout.Max {
+		return timeout, fmt.Errorf("hnsCallTimeout min %s exceeds max %s", config.Min, config.Max)
+	}
+
+	return timeout, nil
+}
+
+// dnsProxyRules returns the network policy rules allowing DNS traffic to the DNS proxy.
+func dnsProxyRules(dnsProxyAddress net.IP) []policy.Rule {
+	cidr := hostCIDR(dnsProxyAddress)
+
+	var rules []policy.Rule
+	for _, protocol := range []string{policy.ProtocolUDP, policy.ProtocolTCP} {
+		rules = append(rules, policy.Rule{
+			Action:    policy.ActionAllow,
+			Direction: policy.DirectionEgress,
+			Protocol:  protocol,
+			CIDRs:     []string{cidr},
+			Ports:     []string{"53"},
+		})
+	}
+
+	return rules
+}
+
+// ParsePrefixes parses a list of CIDR blocks separated by commas or whitespace.
+func ParsePrefixes(s string) ([]*net.IPNet, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	var prefixes []*net.IPNet
+	for _, field := range fields {
+		_, prefix, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra prefix %s", field)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
@@ -0,0 +1,559 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// IPv4 with defaults.
+		`{"eniName":"eth1", "eniIPAddress":"10.0.1.10/24", "ipAddress":"10.0.1.20/24"}`,
+		// IPv6-only.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "eniIPAddress":"2600:1f14::10/64",
+		  "ipAddress":"2600:1f14::20/64", "gatewayIPAddress":"2600:1f14::1"}`,
+		// IPv6-only with DNS64.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "ipAddress":"2600:1f14::20/64", "dns64":true}`,
+		// IPv6-only with a custom NAT64 prefix.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "ipAddress":"2600:1f14::20/64",
+		  "nat64Prefix":"2600:1f14:ffff::/96"}`,
+		// Plugin managed namespace.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "managedNamespace":true}`,
+		// Addresses obtained from DHCP.
+		`{"eniName":"eth1", "bridgeType":"L2", "ipAddressMode":"dhcp"}`,
+		// With extra prefixes.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "extraPrefixes":["10.1.0.0/16", "192.168.0.0/24"],
+		  "extraPrefixesTag":"vpc-cni:extra-prefixes"}`,
+		// With a DNS proxy.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "dnsProxyAddress":"169.254.20.10"}`,
+		`{"eniName":"eth1", "standbyENIName":"eth2", "agentSocket":"/var/run/vpc-cni-agent.sock"}`,
+		`{"eniName":"eth1", "ownerID":"ecs"}`,
+		// Notifying the ECS agent of endpoint changes.
+		`{"eniName":"eth1", "notifySocket":"/var/run/ecs/vpc-cni-notify.sock"}`,
+		// With a custom retry policy.
+		`{"eniName":"eth1", "backoff":{"maxAttempts":6, "initialInterval":"50ms", "maxInterval":"5s"}}`,
+		// Attaching microVMs through TAP and macvtap interfaces.
+		`{"eniName":"eth1", "interfaceType":"tap", "tapUserID":"1000"}`,
+		`{"eniName":"eth1", "interfaceType":"macvtap"}`,
+		// Tuning the endpoint's network namespace.
+		`{"eniName":"eth1", "sysctls":{"net.ipv4.conf.eth0.rp_filter":"2", "net/ipv6/conf/eth0.100/accept_ra":"0"}}`,
+		// Sharing the ENI through IPVLAN sub-interfaces.
+		`{"eniName":"eth1", "interfaceType":"ipvlan", "ipAddress":"10.0.1.20/24", "antiSpoofing":false}`,
+		// Deleting empty networks.
+		`{"eniName":"eth1", "networkDeletion":"immediate"}`,
+		`{"eniName":"eth1", "networkDeletion":"deferred"}`,
+		// Limiting concurrent operations.
+		`{"eniName":"eth1", "maxConcurrentOperations":4}`,
+		`{"eniName":"eth1", "maxConcurrentOperations":0}`,
+		// Bounding HNS call ceilings.
+		`{"eniName":"eth1", "hnsCallTimeout":{"min":"5s", "max":"5m"}}`,
+		`{"eniName":"eth1", "hnsCallTimeout":{"max":"30s"}}`,
+		// With security groups.
+		`{"eniName":"eth1", "securityGroups":[{"GroupId":"sg-web", "IpPermissions":[{"IpProtocol":"tcp",
+		  "FromPort":80, "ToPort":80, "UserIdGroupPairs":[{"GroupId":"sg-lb"}]}]}],
+		  "securityGroupCIDRs":{"sg-lb":["10.0.1.0/24"]}}`,
+		// Locking down DNS.
+		`{"eniName":"eth1", "dnsLockdown":true, "dnsAllowedResolvers":["1.1.1.1", "fd00::53/128"]}`,
+		// Restricting egress to the VPC.
+		`{"eniName":"eth1", "restrictEgress":true, "vpcCIDRs":["10.0.0.0/16"], "egressAllowedCIDRs":["52.94.0.0/22"]}`,
+		// Disabling anti-spoofing for network virtual appliances.
+		`{"eniName":"eth1", "antiSpoofing":false}`,
+		// Host firewall rules.
+		`{"eniName":"eth1", "hostFirewallRules":[{"action":"allow", "direction":"ingress", "protocol":"tcp", "ports":["80"]}]}`,
+		// Isolating endpoints on the same host.
+		`{"eniName":"eth1", "eastWestIsolation":true, "eastWestOptIn":true}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing ENI.
+		`{"ipAddress":"10.0.1.20/24"}`,
+		// Invalid IP family.
+		`{"eniName":"eth1", "ipFamily":"dual"}`,
+		// IPv6 address in IPv4 mode.
+		`{"eniName":"eth1", "ipAddress":"2600:1f14::20/64"}`,
+		// IPv4 address in IPv6-only mode.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "ipAddress":"10.0.1.20/24"}`,
+		// IPv4 gateway in IPv6-only mode.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "ipAddress":"2600:1f14::20/64",
+		  "gatewayIPAddress":"10.0.1.1"}`,
+		// IPv4 VPC CIDR in IPv6-only mode.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "vpcCIDRs":["10.0.0.0/16"]}`,
+		// DNS64 in IPv4 mode.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "dns64":true}`,
+		// IPv4 NAT64 prefix.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "nat64Prefix":"10.64.0.0/16"}`,
+		// Layer2 bridge in IPv6-only mode.
+		`{"eniName":"eth1", "ipFamily":"ipv6", "bridgeType":"L2"}`,
+		// Plugin managed namespace in a Hyper-V isolated sandbox.
+		`{"eniName":"eth1", "managedNamespace":true, "runtimeConfig":{"sandbox":{"utilityVMID":"uvm1"}}}`,
+		// Invalid IP address mode.
+		`{"eniName":"eth1", "ipAddressMode":"auto"}`,
+		// Invalid interface type.
+		`{"eniName":"eth1", "interfaceType":"ipvtap"}`,
+		// Sysctls outside of the network namespace, or escaping /proc/sys.
+		`{"eniName":"eth1", "sysctls":{"kernel.pid_max":"65536"}}`,
+		`{"eniName":"eth1", "sysctls":{"net/../kernel/pid_max":"65536"}}`,
+		`{"eniName":"eth1", "sysctls":{"net.ipv4..forwarding":"1"}}`,
+		`{"eniName":"eth1", "sysctls":{"net.ipv4.ip_forward":""}}`,
+		// IPVLAN endpoints bypass the bridge.
+		`{"eniName":"eth1", "interfaceType":"ipvlan", "ipAddress":"10.0.1.20/24"}`,
+		`{"eniName":"eth1", "interfaceType":"ipvlan", "bridgeType":"L2", "antiSpoofing":false}`,
+		`{"eniName":"eth1", "interfaceType":"ipvlan", "antiSpoofing":false, "eastWestIsolation":true}`,
+		// Invalid network deletion mode.
+		`{"eniName":"eth1", "networkDeletion":"lazy"}`,
+		// Network deletion with the agent.
+		`{"eniName":"eth1", "networkDeletion":"deferred", "agentSocket":"/var/run/vpc-cni-agent.sock"}`,
+		// DHCP with a static IP address.
+		`{"eniName":"eth1", "bridgeType":"L2", "ipAddressMode":"dhcp", "ipAddress":"10.0.1.20/24"}`,
+		// DHCP with a layer3 bridge.
+		`{"eniName":"eth1", "ipAddressMode":"dhcp"}`,
+		// Invalid extra prefix.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "extraPrefixes":["10.1.0.0"]}`,
+		// Extra prefix in a different IP family.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "extraPrefixes":["fd00::/64"]}`,
+		// Missing extra prefixes file.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "extraPrefixesFile":"/nonexistent"}`,
+		// Invalid DNS proxy address.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "dnsProxyAddress":"proxy"}`,
+		// DNS proxy address in a different IP family.
+		`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "dnsProxyAddress":"fd00::53"}`,
+		// Standby ENI without the agent.
+		`{"eniName":"eth1", "standbyENIName":"eth2"}`,
+		// Invalid standby ENI MAC address.
+		`{"eniName":"eth1", "standbyENIMACAddress":"eth2", "agentSocket":"/var/run/vpc-cni-agent.sock"}`,
+		// Invalid owner ID.
+		`{"eniName":"eth1", "ownerID":"ECS@node"}`,
+		// Invalid retry policy.
+		`{"eniName":"eth1", "backoff":{"maxAttempts":-1}}`,
+		`{"eniName":"eth1", "backoff":{"maxInterval":"5"}}`,
+		// Invalid concurrency limit.
+		`{"eniName":"eth1", "maxConcurrentOperations":-1}`,
+		// Invalid HNS call ceiling bounds.
+		`{"eniName":"eth1", "hnsCallTimeout":{"min":"5"}}`,
+		`{"eniName":"eth1", "hnsCallTimeout":{"min":"2m", "max":"1m"}}`,
+		// Invalid security groups.
+		`{"eniName":"eth1", "securityGroups":[{"IpPermissions":[{"IpProtocol":"-1",
+		  "UserIdGroupPairs":[{"GroupId":"sg-lb"}]}]}]}`,
+		`{"eniName":"eth1", "securityGroups":[{"IpPermissions":[]}], "policy":{"rules":[]}}`,
+		// Invalid DNS resolver.
+		`{"eniName":"eth1", "dnsLockdown":true, "dnsAllowedResolvers":["dns.example.com"]}`,
+		// Invalid egress restriction.
+		`{"eniName":"eth1", "restrictEgress":true}`,
+		`{"eniName":"eth1", "restrictEgress":true, "vpcCIDRs":["10.0.0.0/16"], "egressAllowedCIDRs":["10.1.0.0"]}`,
+		// Invalid host firewall rules.
+		`{"eniName":"eth1", "hostFirewallRules":[{"action":"allow", "direction":"ingress", "ports":["80"]}]}`,
+		// East-west opt-in without isolation.
+		`{"eniName":"eth1", "eastWestOptIn":true}`,
+		// IMDS-derived fields in the network configuration, or without an ENI MAC address.
+		`{"eniMACAddress":"0a:12:34:56:78:9a", "imdsDerivedConfig":true, "gatewayIPAddress":"10.0.1.1"}`,
+		`{"eniMACAddress":"0a:12:34:56:78:9a", "imdsDerivedConfig":true, "dns":{"nameservers":["8.8.8.8"]}}`,
+		`{"eniName":"eth1", "imdsDerivedConfig":true}`,
+		// Invalid adapter names.
+		`{"eniName":"eth1; reboot"}`,
+		`{"eniName":"eth1", "standbyENIName":"$(reboot)", "agentSocket":"/var/run/vpc-cni-agent.sock"}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args, true)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args, true)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestVersionNegotiation tests that the highest CNI spec version supported by both the runtime
+// and the plugin is negotiated.
+func TestVersionNegotiation(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected string
+	}{
+		{`{"cniVersion":"0.3.1", "eniName":"eth1"}`, "0.3.1"},
+		{`{"cniVersion":"0.3.1", "cniVersions":["0.3.1", "1.0.0", "9.0.0"], "eniName":"eth1"}`, "1.0.0"},
+		{`{"cniVersions":["1.1.0", "0.4.0"], "eniName":"eth1"}`, "1.1.0"},
+	}
+
+	for _, test := range tests {
+		netConfig, err := New(&skel.CmdArgs{StdinData: []byte(test.config)}, true)
+		require.NoError(t, err, test.config)
+		assert.Equal(t, test.expected, netConfig.CNIVersion, test.config)
+	}
+
+	_, err := New(&skel.CmdArgs{StdinData: []byte(`{"cniVersions":["0.2.0", "9.0.0"], "eniName":"eth1"}`)}, true)
+	assert.Error(t, err)
+}
+
+// TestIPFamilyDefaults tests that IP family options are set to their defaults.
+func TestIPFamilyDefaults(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[0])}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+	assert.Equal(t, vpc.IPFamilyIPv4, netConfig.IPFamily)
+	assert.Nil(t, netConfig.NAT64Prefix)
+
+	args = &skel.CmdArgs{StdinData: []byte(validConfigs[2])}
+	netConfig, err = New(args, true)
+	require.NoError(t, err)
+	assert.Equal(t, vpc.IPFamilyIPv6, netConfig.IPFamily)
+	assert.Equal(t, vpc.WellKnownNAT64Prefix, netConfig.NAT64Prefix.String())
+	assert.Equal(t, []string{vpc.DNS64ServerAddress}, netConfig.DNS.Nameservers)
+}
+
+// TestDNSProxy tests that endpoints resolve names through the DNS proxy, which the network
+// policy allows ahead of its own rules.
+func TestDNSProxy(t *testing.T) {
+	config := `{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "dnsProxyAddress":"169.254.20.10",
+	  "dns":{"nameservers":["10.0.0.2"]},
+	  "policy":{"defaultAction":"deny", "rules":[{"action":"deny", "direction":"egress", "protocol":"udp", "ports":["53"]}]}}`
+	args := &skel.CmdArgs{StdinData: []byte(config)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, "169.254.20.10", netConfig.DNSProxyAddress.String())
+	assert.Equal(t, []string{"169.254.20.10"}, netConfig.DNS.Nameservers)
+
+	require.Len(t, netConfig.Policy.Rules, 3)
+	for _, rule := range netConfig.Policy.Rules[:2] {
+		assert.Equal(t, policy.ActionAllow, rule.Action)
+		assert.Equal(t, []string{"169.254.20.10/32"}, rule.CIDRs)
+		assert.Equal(t, []string{"53"}, rule.Ports)
+	}
+	assert.Equal(t, policy.ActionDeny, netConfig.Policy.Rules[2].Action)
+}
+
+// TestSecureDefaults tests that the secure defaults profile is evaluated ahead of the rules in
+// the network configuration.
+func TestSecureDefaults(t *testing.T) {
+	config := `{"eniName":"eth1", "secureDefaults":true, "vpcCIDRs":["10.0.0.0/16"],
+	  "secondaryIPAddresses":["10.0.1.20/24", "10.0.1.21/24"],
+	  "policy":{"rules":[{"action":"allow", "direction":"egress", "cidrs":["169.254.169.254/32"]}]}}`
+	args := &skel.CmdArgs{StdinData: []byte(config)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	assert.True(t, netConfig.SecureDefaults)
+	assert.Equal(t, policy.ActionAllow, netConfig.Policy.DefaultAction)
+	rules := netConfig.Policy.Rules
+	require.Len(t, rules, 8)
+
+	// Instance metadata is blocked.
+	assert.Equal(t, policy.ActionDeny, rules[0].Action)
+	assert.Equal(t, []string{"169.254.169.254/32"}, rules[0].CIDRs)
+
+	// Endpoints on the node are isolated from each other.
+	for _, rule := range rules[1:3] {
+		assert.Equal(t, policy.ActionDeny, rule.Action)
+		assert.Equal(t, []string{"10.0.1.20/32", "10.0.1.21/32"}, rule.CIDRs)
+	}
+
+	// DNS is restricted to the VPC resolvers.
+	for _, rule := range rules[3:5] {
+		assert.Equal(t, policy.ActionAllow, rule.Action)
+		assert.Equal(t, []string{"169.254.169.253/32", "10.0.0.2/32"}, rule.CIDRs)
+	}
+	for _, rule := range rules[5:7] {
+		assert.Equal(t, policy.ActionDeny, rule.Action)
+		assert.Empty(t, rule.CIDRs)
+		assert.Equal(t, []string{"53"}, rule.Ports)
+	}
+
+	// Rules in the network configuration cannot override the profile.
+	assert.Equal(t, policy.ActionAllow, rules[7].Action)
+}
+
+// TestDNSLockdown tests that DNS lock-down only allows DNS traffic to the VPC resolvers and the
+// allowed resolvers ahead of the rules in the network configuration.
+func TestDNSLockdown(t *testing.T) {
+	config := `{"eniName":"eth1", "dnsLockdown":true, "vpcCIDRs":["10.0.0.0/16"],
+	  "dnsAllowedResolvers":["10.1.0.53", "10.2.0.0/28"],
+	  "policy":{"rules":[{"action":"allow", "direction":"egress", "protocol":"udp", "ports":["53"]}]}}`
+	args := &skel.CmdArgs{StdinData: []byte(config)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	assert.True(t, netConfig.DNSLockdown)
+	rules := netConfig.Policy.Rules
+	require.Len(t, rules, 5)
+
+	for _, rule := range rules[:2] {
+		assert.Equal(t, policy.ActionAllow, rule.Action)
+		assert.Equal(t, []string{"169.254.169.253/32", "10.0.0.2/32", "10.1.0.53/32", "10.2.0.0/28"}, rule.CIDRs)
+		assert.Equal(t, []string{"53", "853"}, rule.Ports)
+	}
+	for _, rule := range rules[2:4] {
+		assert.Equal(t, policy.ActionDeny, rule.Action)
+		assert.Empty(t, rule.CIDRs)
+		assert.Equal(t, []string{"53", "853"}, rule.Ports)
+	}
+
+	// Rules in the network configuration cannot override the lock-down.
+	assert.Equal(t, policy.ActionAllow, rules[4].Action)
+}
+
+// TestRestrictEgress tests that egress restriction denies all destinations outside the VPC and
+// the allowed CIDR blocks ahead of the rules in the network configuration.
+func TestRestrictEgress(t *testing.T) {
+	config := `{"eniName":"eth1", "restrictEgress":true, "vpcCIDRs":["10.0.0.0/16"],
+	  "egressAllowedCIDRs":["52.94.0.0/22"], "dnsProxyAddress":"169.254.20.10",
+	  "policy":{"rules":[{"action":"allow", "direction":"egress", "cidrs":["0.0.0.0/0"]}]}}`
+	args := &skel.CmdArgs{StdinData: []byte(config)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	assert.True(t, netConfig.RestrictEgress)
+	rules := netConfig.Policy.Rules
+	var rule *policy.Rule
+	for i := range rules {
+		if rules[i].Action == policy.ActionDeny {
+			rule = &rules[i]
+			break
+		}
+	}
+	require.NotNil(t, rule)
+	assert.Equal(t, policy.DirectionEgress, rule.Direction)
+	assert.Equal(t, policy.ProtocolAll, rule.Protocol)
+
+	denied := func(address string) bool {
+		for _, cidr := range rule.CIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			require.NoError(t, err)
+			if ipNet.Contains(net.ParseIP(address)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, address := range []string{"8.8.8.8", "10.1.0.1", "169.254.169.254", "255.255.255.255"} {
+		assert.True(t, denied(address), "address %s", address)
+	}
+	for _, address := range []string{"10.0.5.1", "52.94.3.255", "169.254.169.253", "169.254.20.10"} {
+		assert.False(t, denied(address), "address %s", address)
+	}
+
+	// Rules in the network configuration cannot override the restriction.
+	assert.Equal(t, policy.ActionAllow, rules[len(rules)-1].Action)
+}
+
+// TestIMDSDerivedConfig tests that the trusted fields are derived from the instance metadata of
+// the ENI.
+func TestIMDSDerivedConfig(t *testing.T) {
+	metadata := map[string]string{
+		"network/interfaces/macs/0a:12:34:56:78:9a/local-ipv4s":            "10.0.1.10\n10.0.1.20",
+		"network/interfaces/macs/0a:12:34:56:78:9a/subnet-ipv4-cidr-block": "10.0.1.0/24",
+		"network/interfaces/macs/0a:12:34:56:78:9a/vpc-ipv4-cidr-blocks":   "10.0.0.0/16\n100.64.0.0/16",
+	}
+	RegisterMetadataHandler(func(path string) (string, error) {
+		value, ok := metadata[path]
+		if !ok {
+			return "", fmt.Errorf("not found")
+		}
+		return value, nil
+	})
+	defer RegisterMetadataHandler(nil)
+
+	config := `{"eniMACAddress":"0A:12:34:56:78:9A", "imdsDerivedConfig":true, "restrictEgress":true}`
+	args := &skel.CmdArgs{StdinData: []byte(config)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, "10.0.1.10/24", netConfig.ENIIPAddress.String())
+	assert.Equal(t, "10.0.1.1", netConfig.GatewayIPAddress.String())
+	assert.Equal(t, []string{"10.0.0.2"}, netConfig.DNS.Nameservers)
+	require.Len(t, netConfig.VPCCIDRs, 2)
+	assert.Equal(t, "100.64.0.0/16", netConfig.VPCCIDRs[1].String())
+
+	// Instance metadata that is missing or inconsistent fails the configuration.
+	metadata["network/interfaces/macs/0a:12:34:56:78:9a/subnet-ipv4-cidr-block"] = "10.0.2.0/24"
+	_, err = New(args, true)
+	assert.Error(t, err)
+
+	config = `{"eniMACAddress":"0a:12:34:56:78:9a", "ipFamily":"ipv6", "imdsDerivedConfig":true}`
+	args = &skel.CmdArgs{StdinData: []byte(config)}
+	_, err = New(args, true)
+	assert.Error(t, err)
+}
+
+// TestIMDSDerivedConfigOutsideRegion tests that the configuration derived from instance metadata
+// follows the conventions of Local Zones and Outposts.
+func TestIMDSDerivedConfigOutsideRegion(t *testing.T) {
+	metadata := map[string]string{
+		"network/interfaces/macs/0a:12:34:56:78:9a/local-ipv4s":            "10.0.1.10",
+		"network/interfaces/macs/0a:12:34:56:78:9a/subnet-ipv4-cidr-block": "10.0.1.0/24",
+		"network/interfaces/macs/0a:12:34:56:78:9a/vpc-ipv4-cidr-blocks":   "10.0.0.0/16",
+		"placement/availability-zone":                                      "us-west-2-lax-1a",
+	}
+	RegisterMetadataHandler(func(path string) (string, error) {
+		value, ok := metadata[path]
+		if !ok {
+			return "", fmt.Errorf("not found")
+		}
+		return value, nil
+	})
+	defer RegisterMetadataHandler(nil)
+
+	config := `{"eniMACAddress":"0a:12:34:56:78:9a", "imdsDerivedConfig":true}`
+	netConfig, err := New(&skel.CmdArgs{StdinData: []byte(config)}, true)
+	require.NoError(t, err)
+	assert.Equal(t, ZoneTypeLocalZone, netConfig.ZoneType)
+	assert.Equal(t, "10.0.1.1", netConfig.GatewayIPAddress.String())
+	assert.Equal(t, []string{vpc.DNSServerAddress}, netConfig.DNS.Nameservers)
+
+	config = `{"eniMACAddress":"0a:12:34:56:78:9a", "imdsDerivedConfig":true, "zoneType":"outpost"}`
+	netConfig, err = New(&skel.CmdArgs{StdinData: []byte(config)}, true)
+	require.NoError(t, err)
+	assert.Equal(t, ZoneTypeOutpost, netConfig.ZoneType)
+	assert.Nil(t, netConfig.GatewayIPAddress)
+	assert.Equal(t, []string{vpc.DNSServerAddress}, netConfig.DNS.Nameservers)
+
+	config = `{"eniMACAddress":"0a:12:34:56:78:9a", "imdsDerivedConfig":true, "zoneType":"region"}`
+	_, err = New(&skel.CmdArgs{StdinData: []byte(config)}, true)
+	assert.Error(t, err)
+}
+
+// TestAntiSpoofing tests that anti-spoofing is enabled unless explicitly disabled.
+func TestAntiSpoofing(t *testing.T) {
+	for config, enabled := range map[string]bool{
+		`{"eniName":"eth1"}`:                       true,
+		`{"eniName":"eth1", "antiSpoofing":true}`:  true,
+		`{"eniName":"eth1", "antiSpoofing":false}`: false,
+	} {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		netConfig, err := New(args, true)
+		require.NoError(t, err)
+		assert.Equal(t, enabled, netConfig.AntiSpoofing, config)
+	}
+}
+
+// TestExtraPrefixes tests that extra prefixes are merged from the network configuration and
+// the extra prefixes file.
+func TestExtraPrefixes(t *testing.T) {
+	file, err := ioutil.TempFile("", "prefixes")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("172.16.0.0/12\n192.168.0.0/24, 100.64.0.0/10\n")
+	require.NoError(t, err)
+	file.Close()
+
+	config := fmt.Sprintf(`{"eniName":"eth1", "ipAddress":"10.0.1.20/24",
+	  "extraPrefixes":["10.1.0.0/16"], "extraPrefixesFile":"%s"}`, file.Name())
+	args := &skel.CmdArgs{StdinData: []byte(config)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	var prefixes []string
+	for _, prefix := range netConfig.ExtraPrefixes {
+		prefixes = append(prefixes, prefix.String())
+	}
+	assert.Equal(t, []string{"10.1.0.0/16", "172.16.0.0/12", "192.168.0.0/24", "100.64.0.0/10"}, prefixes)
+}
+
+// TestNamespaceDefaults tests that the policy defaults of the pod's namespace are merged into
+// the network configuration.
+func TestNamespaceDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namespaces")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defaults := `{"policy":{"defaultAction":"deny", "rules":[{"action":"allow", "direction":"egress", "cidrs":["10.0.0.0/16"]}]},
+	  "natExceptions":["100.64.0.0/10"], "egressRate":100000000}`
+	err = ioutil.WriteFile(filepath.Join(dir, "team-a.json"), []byte(defaults), 0644)
+	require.NoError(t, err)
+
+	config := fmt.Sprintf(`{"eniName":"eth1", "ipAddress":"10.0.1.20/24", "namespaceDefaultsDir":"%s",
+	  "policy":{"rules":[{"action":"deny", "direction":"ingress", "protocol":"tcp", "ports":["22"]}]}}`, dir)
+	args := &skel.CmdArgs{
+		StdinData: []byte(config),
+		Args:      "K8S_POD_NAMESPACE=team-a;K8S_POD_NAME=pod-1",
+	}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, policy.ActionDeny, netConfig.Policy.DefaultAction)
+	require.Len(t, netConfig.Policy.Rules, 2)
+	assert.Equal(t, []string{"10.0.0.0/16"}, netConfig.Policy.Rules[0].CIDRs)
+	assert.Equal(t, []string{"22"}, netConfig.Policy.Rules[1].Ports)
+	require.Len(t, netConfig.NATExceptions, 1)
+	assert.Equal(t, "100.64.0.0/10", netConfig.NATExceptions[0].String())
+	assert.Equal(t, uint64(100000000), netConfig.EgressRate)
+
+	// Pods in namespaces without defaults are left unchanged.
+	args.Args = "K8S_POD_NAMESPACE=team-b;K8S_POD_NAME=pod-1"
+	netConfig, err = New(args, true)
+	require.NoError(t, err)
+	assert.Equal(t, policy.ActionAllow, netConfig.Policy.DefaultAction)
+	assert.Len(t, netConfig.Policy.Rules, 1)
+	assert.Nil(t, netConfig.NATExceptions)
+	assert.Zero(t, netConfig.EgressRate)
+}
+
+// TestPrevResult tests that the fields omitted from chained network configurations are taken
+// from the result of the previous plugin in the chain.
+func TestPrevResult(t *testing.T) {
+	prevResult := `"prevResult":{
+	  "interfaces":[{"name":"eth1","mac":"0a:58:0a:00:01:0a"},
+	    {"name":"eth0","mac":"0a:58:0a:00:01:14","sandbox":"/var/run/netns/test"}],
+	  "ips":[{"address":"10.0.1.10/24","interface":0},
+	    {"address":"10.0.1.20/24","gateway":"10.0.1.1","interface":1}]}`
+
+	args := &skel.CmdArgs{StdinData: []byte(`{"cniVersion":"1.0.0", ` + prevResult + `}`)}
+	netConfig, err := New(args, true)
+	require.NoError(t, err)
+	assert.Equal(t, "eth1", netConfig.ENIName)
+	assert.Equal(t, "0a:58:0a:00:01:0a", netConfig.ENIMACAddress.String())
+	assert.Equal(t, "10.0.1.10/24", netConfig.ENIIPAddress.String())
+	assert.Equal(t, "10.0.1.20/24", netConfig.IPAddress.String())
+	assert.Equal(t, "10.0.1.1", netConfig.GatewayIPAddress.String())
+	require.NotNil(t, netConfig.PrevResult)
+	assert.Equal(t, "4", netConfig.PrevResult.IPs[0].Version)
+
+	// Fields present in the network configuration take precedence.
+	args = &skel.CmdArgs{StdinData: []byte(`{"eniName":"eth2", "ipAddress":"10.0.1.30/24", ` + prevResult + `}`)}
+	netConfig, err = New(args, true)
+	require.NoError(t, err)
+	assert.Equal(t, "eth2", netConfig.ENIName)
+	assert.Nil(t, netConfig.ENIMACAddress)
+	assert.Equal(t, "10.0.1.30/24", netConfig.IPAddress.String())
+
+	args = &skel.CmdArgs{StdinData: []byte(`{"eniName":"eth1", "prevResult":[]}`)}
+	_, err = New(args, true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Instances in Local Zones, Wavelength Zones and on Outposts do not follow all the conventions
+// of VPC subnets in the parent region. The Amazon-provided DNS server at the base of the VPC
+// CIDR block plus two is served from the parent region, which adds latency and is unreachable
+// while an Outpost is disconnected, whereas the link-local DNS server is served locally. Local
+// network interfaces of Outposts servers connect to the on-premises network, where the gateway
+// is not at the base of the VPC subnet plus one, but leased through DHCP instead.
+//
+// The zone type is detected from the availability zone name in the instance metadata, or set
+// with "zoneType" in the network configuration. Outposts are in the availability zone of their
+// parent region and cannot be detected this way.
+
+const (
+	// Zone type values.
+	ZoneTypeAvailabilityZone = "availability-zone"
+	ZoneTypeLocalZone        = "local-zone"
+	ZoneTypeWavelengthZone   = "wavelength-zone"
+	ZoneTypeOutpost          = "outpost"
+
+	// availabilityZoneMetadataPath is the instance metadata path of the availability zone name.
+	availabilityZoneMetadataPath = "placement/availability-zone"
+)
+
+var (
+	// localZoneNameRegexp matches Local Zone names, e.g. us-west-2-lax-1a. Availability zone
+	// names end with the region name followed by a letter, e.g. us-west-2a.
+	localZoneNameRegexp = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-\d+-[a-z]+-\d+[a-z]$`)
+	// wavelengthZoneNameRegexp matches Wavelength Zone names, e.g. us-east-1-wl1-bos-wlz-1.
+	wavelengthZoneNameRegexp = regexp.MustCompile(`^[a-z]{2}-[a-z]+-\d+-wl\d+-[a-z]+-wlz-\d+$`)
+)
+
+// GetZoneType returns the type of the zone of the instance, detected from the availability zone
+// name in the instance metadata.
+func GetZoneType() (string, error) {
+	if retrieveMetadataHandler == nil {
+		return "", fmt.Errorf("no instance metadata handler registered")
+	}
+
+	name, err := retrieveMetadataHandler(availabilityZoneMetadataPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve instance metadata %s: %v",
+			availabilityZoneMetadataPath, err)
+	}
+
+	return zoneTypeFromName(strings.TrimSpace(name)), nil
+}
+
+// zoneTypeFromName returns the type of the zone with the given name.
+func zoneTypeFromName(name string) string {
+	switch {
+	case wavelengthZoneNameRegexp.MatchString(name):
+		return ZoneTypeWavelengthZone
+	case localZoneNameRegexp.MatchString(name):
+		return ZoneTypeLocalZone
+	default:
+		return ZoneTypeAvailabilityZone
+	}
+}
+
+// isValidZoneType returns whether the given zone type is valid.
+func isValidZoneType(zoneType string) bool {
+	switch zoneType {
+	case ZoneTypeAvailabilityZone, ZoneTypeLocalZone, ZoneTypeWavelengthZone, ZoneTypeOutpost:
+		return true
+	}
+	return false
+}
+
+// usesLocalDNS returns whether instances in zones of the given type resolve names through the
+// link-local DNS server instead of the DNS server in the VPC CIDR block.
+func usesLocalDNS(zoneType string) bool {
+	return zoneType != "" && zoneType != ZoneTypeAvailabilityZone
+}
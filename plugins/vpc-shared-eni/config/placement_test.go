@@ -0,0 +1,35 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneTypeFromName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"us-west-2a":              ZoneTypeAvailabilityZone,
+		"eu-central-1c":           ZoneTypeAvailabilityZone,
+		"us-gov-west-1a":          ZoneTypeAvailabilityZone,
+		"us-west-2-lax-1a":        ZoneTypeLocalZone,
+		"us-east-1-bos-1a":        ZoneTypeLocalZone,
+		"ap-northeast-1-tpe-1a":   ZoneTypeLocalZone,
+		"us-east-1-wl1-bos-wlz-1": ZoneTypeWavelengthZone,
+		"":                        ZoneTypeAvailabilityZone,
+	} {
+		assert.Equal(t, expected, zoneTypeFromName(name), name)
+	}
+}
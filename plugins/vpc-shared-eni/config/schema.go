@@ -0,0 +1,128 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+// Schema is the JSON schema of the vpc-shared-eni network configuration. It describes the types,
+// ranges and formats of the fields. Constraints between fields are validated by the parser.
+const Schema = `{
+  "description": "vpc-shared-eni network configuration",
+  "type": "object",
+  "required": ["cniVersion", "name", "type"],
+  "additionalProperties": false,
+  "properties": {
+    "cniVersion": {"type": "string", "minLength": 1},
+    "cniVersions": {"type": "array", "items": {"type": "string", "minLength": 1}},
+    "name": {"type": "string", "minLength": 1},
+    "type": {"type": "string", "enum": ["vpc-shared-eni"]},
+    "capabilities": {"type": "object", "additionalProperties": {"type": "boolean"}},
+    "ipam": {
+      "type": "object",
+      "required": ["type"],
+      "properties": {"type": {"type": "string", "minLength": 1}}
+    },
+    "dns": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "nameservers": {"type": "array", "items": {"type": "string", "format": "ip"}},
+        "domain": {"type": "string"},
+        "search": {"type": "array", "items": {"type": "string"}},
+        "options": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    "prevResult": {"type": "object"},
+    "args": {"type": "object"},
+    "runtimeConfig": {
+      "type": "object",
+      "properties": {
+        "sandbox": {
+          "type": "object",
+          "additionalProperties": false,
+          "properties": {
+            "isolation": {"type": "string", "enum": ["process", "hyperv", "microvm"]},
+            "utilityVMID": {"type": "string"}
+          }
+        }
+      }
+    },
+    "eniName": {"type": "string", "minLength": 1},
+    "eniMACAddress": {"type": "string", "format": "mac"},
+    "eniIPAddress": {"type": "string", "format": "cidr"},
+    "standbyENIName": {"type": "string", "minLength": 1},
+    "standbyENIMACAddress": {"type": "string", "format": "mac"},
+    "vpcCIDRs": {"type": "array", "items": {"type": "string", "format": "cidr"}},
+    "extraPrefixes": {"type": "array", "items": {"type": "string"}},
+    "extraPrefixesFile": {"type": "string"},
+    "extraPrefixesTag": {"type": "string"},
+    "bridgeType": {"type": "string", "enum": ["L2", "L3"]},
+    "bridgeNetNSPath": {"type": "string"},
+    "ipAddressMode": {"type": "string", "enum": ["static", "dhcp"]},
+    "networkDeletion": {"type": "string", "enum": ["keep", "immediate", "deferred"]},
+    "ipAddress": {"type": "string", "format": "cidr"},
+    "secondaryIPAddresses": {"type": "array", "items": {"type": "string", "format": "cidr"}},
+    "gatewayIPAddress": {"type": "string", "format": "ip"},
+    "zoneType": {"type": "string", "enum": ["availability-zone", "local-zone", "wavelength-zone", "outpost"]},
+    "interfaceType": {"type": "string", "enum": ["veth", "tap", "macvtap", "ipvlan"]},
+    "tapUserID": {"type": "string", "pattern": "^[0-9]+$"},
+    "serviceCIDR": {"type": "string", "format": "cidr"},
+    "ipFamily": {"type": "string", "enum": ["ipv4", "ipv6"]},
+    "dns64": {"type": "boolean"},
+    "nat64Prefix": {"type": "string", "format": "cidr"},
+    "dnsProxyAddress": {"type": "string", "format": "ip"},
+    "policy": {"type": "object"},
+    "policyFile": {"type": "string"},
+    "securityGroups": {"type": "array", "items": {"type": "object"}},
+    "securityGroupsFile": {"type": "string"},
+    "securityGroupCIDRs": {
+      "type": "object",
+      "additionalProperties": {"type": "array", "items": {"type": "string", "format": "cidr"}}
+    },
+    "hostFirewallRules": {"type": "array", "items": {"type": "object"}},
+    "secureDefaults": {"type": "boolean"},
+    "imdsDerivedConfig": {"type": "boolean"},
+    "restrictEgress": {"type": "boolean"},
+    "egressAllowedCIDRs": {"type": "array", "items": {"type": "string", "format": "cidr"}},
+    "dnsLockdown": {"type": "boolean"},
+    "dnsAllowedResolvers": {"type": "array", "items": {"type": "string"}},
+    "antiSpoofing": {"type": "boolean"},
+    "eastWestIsolation": {"type": "boolean"},
+    "eastWestOptIn": {"type": "boolean"},
+    "sysctls": {"type": "object", "additionalProperties": {"type": "string"}},
+    "namespaceDefaultsDir": {"type": "string"},
+    "agentSocket": {"type": "string"},
+    "notifySocket": {"type": "string"},
+    "ownerID": {"type": "string", "pattern": "^[a-z0-9][a-z0-9-]{0,15}$"},
+    "forceDelete": {"type": "boolean"},
+    "excludedAdaptersFile": {"type": "string"},
+    "backoff": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "maxAttempts": {"type": "integer", "minimum": 0},
+        "initialInterval": {"type": "string", "format": "duration"},
+        "maxInterval": {"type": "string", "format": "duration"}
+      }
+    },
+    "maxConcurrentOperations": {"type": "integer", "minimum": 0},
+    "hnsCallTimeout": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "min": {"type": "string", "format": "duration"},
+        "max": {"type": "string", "format": "duration"}
+      }
+    },
+    "managedNamespace": {"type": "boolean"}
+  }
+}`
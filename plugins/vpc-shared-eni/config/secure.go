@@ -0,0 +1,88 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+)
+
+// The secure defaults profile is enabled with "secureDefaults": true in the network configuration.
+// It lets security teams mandate a single switch instead of reviewing individual policy rules.
+// Its rules are evaluated ahead of all other rules, so they cannot be overridden by the network
+// configuration or namespace defaults. The profile:
+//
+//  - blocks the instance metadata service, so that containers cannot obtain the credentials of
+//    the instance role,
+//  - blocks traffic between endpoints on the node, i.e. to and from the secondary IP addresses
+//    of the shared ENI,
+//  - restricts DNS to the Amazon-provided VPC resolvers and the DNS proxy, if any.
+
+// secureDefaultsRules returns the network policy rules of the secure defaults profile for the
+// IP family of the network.
+func secureDefaultsRules(netConfig *NetConfig) []policy.Rule {
+	imdsCIDR := vpc.InstanceMetadataEndpoint
+	if netConfig.IPFamily == vpc.IPFamilyIPv6 {
+		imdsCIDR = vpc.InstanceMetadataEndpointIPv6
+	}
+
+	rules := []policy.Rule{
+		{
+			Action:    policy.ActionDeny,
+			Direction: policy.DirectionEgress,
+			Protocol:  policy.ProtocolAll,
+			CIDRs:     []string{imdsCIDR},
+		},
+	}
+
+	var endpointCIDRs []string
+	for _, address := range netConfig.IPAddressPool {
+		endpointCIDRs = append(endpointCIDRs, hostCIDR(address.IP))
+	}
+	if len(endpointCIDRs) != 0 {
+		for _, direction := range []string{policy.DirectionIngress, policy.DirectionEgress} {
+			rules = append(rules, policy.Rule{
+				Action:    policy.ActionDeny,
+				Direction: direction,
+				Protocol:  policy.ProtocolAll,
+				CIDRs:     endpointCIDRs,
+			})
+		}
+	}
+
+	rules = append(rules, dnsRestrictionRules(resolverCIDRs(netConfig), []string{"53"})...)
+
+	return rules
+}
+
+// applySecureDefaults adds the rules of the secure defaults profile ahead of all other rules.
+func applySecureDefaults(netConfig *NetConfig) {
+	if netConfig.Policy == nil {
+		netConfig.Policy = &policy.Document{DefaultAction: policy.ActionAllow}
+	}
+	netConfig.Policy.Rules = append(secureDefaultsRules(netConfig), netConfig.Policy.Rules...)
+}
+
+// hostCIDR returns the host CIDR block of the given IP address.
+func hostCIDR(ipAddress net.IP) string {
+	bits := 8 * net.IPv6len
+	if vpc.IsIPv4(ipAddress) {
+		bits = 8 * net.IPv4len
+	}
+
+	return fmt.Sprintf("%s/%d", ipAddress, bits)
+}
@@ -17,15 +17,21 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+	"github.com/aws/amazon-vpc-cni-plugins/network/dhcp"
 	"github.com/aws/amazon-vpc-cni-plugins/network/ebtables"
 	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
 	"github.com/aws/amazon-vpc-cni-plugins/network/ipcfg"
 	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
 	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
 	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
 
 	log "github.com/cihub/seelog"
+	"github.com/coreos/go-iptables/iptables"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
@@ -40,16 +46,50 @@ const (
 	// vethLinkNameFormat is the format used for generating veth link names.
 	vethLinkNameFormat = "veth%s"
 
+	// antiSpoofingChainFormat is the format used for generating ebtables chain names enforcing
+	// the source addresses of an endpoint.
+	antiSpoofingChainFormat = "vpc-as-%s"
+
+	// eastWestEndpointMark marks packets sent by endpoints subject to east-west isolation.
+	eastWestEndpointMark = 0x100000
+	// eastWestIsolatedMark marks packets sent by endpoints that did not opt in to east-west traffic.
+	eastWestIsolatedMark = 0x200000
+
 	// tapBridgeName is the name of the bridge connecting TAP interfaces.
 	tapBridgeName = "tapbr0"
+
+	// tunCloneDevice is the character device for attaching to TAP links.
+	tunCloneDevice = "/dev/net/tun"
+	// macvtapDeviceFormat is the format of the paths of character devices of macvtap links.
+	macvtapDeviceFormat = "/dev/tap%d"
+
+	// tbfMinBuffer is the minimum token bucket size in bytes, which fits a few jumbo frames.
+	tbfMinBuffer = 32 * 1024
 )
 
 // BridgeBuilder implements NetworkBuilder interface by bridging containers to an ENI on Linux.
 type BridgeBuilder struct{}
 
+// NewBridgeBuilder creates a new BridgeBuilder. The state directory is unused on Linux, where
+// netlink lookups are cheap enough not to need caching.
+func NewBridgeBuilder(stateDir string) *BridgeBuilder {
+	return &BridgeBuilder{}
+}
+
+// CheckStatus returns an error if the host cannot connect containers. Bridging is provided by
+// the kernel on Linux, so there is no networking service to check.
+func (nb *BridgeBuilder) CheckStatus() error {
+	return nil
+}
+
 // FindOrCreateNetwork creates a new container network.
 func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
-	var err error
+	// Never touch excluded host adapters.
+	err := nw.CheckExcluded()
+	if err != nil {
+		log.Errorf("Failed to create bridge: %v.", err)
+		return err
+	}
 
 	bridgeName := fmt.Sprintf(bridgeNameFormat, nw.Name, nw.SharedENI.GetLinkIndex())
 
@@ -75,13 +115,13 @@ func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
 		// Connect the ENI to a bridge in the bridge network namespace.
 		err = bridgeNetNS.Run(func() error {
 			nw.BridgeIndex, err = nb.createBridge(
-				bridgeName, nw.BridgeType, nw.SharedENI, nw.ENIIPAddress)
+				bridgeName, nw.BridgeType, nw.IPFamily, nw.SharedENI, nw.ENIIPAddress, nw.OwnerID)
 			return err
 		})
 	} else {
 		// Connect the ENI to a bridge.
 		nw.BridgeIndex, err = nb.createBridge(
-			bridgeName, nw.BridgeType, nw.SharedENI, nw.ENIIPAddress)
+			bridgeName, nw.BridgeType, nw.IPFamily, nw.SharedENI, nw.ENIIPAddress, nw.OwnerID)
 	}
 
 	if err != nil {
@@ -93,9 +133,23 @@ func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
 
 // DeleteNetwork deletes a container network.
 func (nb *BridgeBuilder) DeleteNetwork(nw *Network) error {
+	// Never touch excluded host adapters.
+	err := nw.CheckExcluded()
+	if err != nil {
+		log.Errorf("Failed to delete bridge: %v.", err)
+		return err
+	}
+
 	bridgeName := fmt.Sprintf(bridgeNameFormat, nw.Name, nw.SharedENI.GetLinkIndex())
 
-	err := nb.deleteBridge(bridgeName, nw.BridgeType, nw.SharedENI)
+	// Never delete networks of other CNI stacks.
+	err = nb.checkLinkStamp(bridgeName, nw.OwnerID, nw.ForceDelete)
+	if err != nil {
+		log.Errorf("Failed to delete bridge: %v.", err)
+		return err
+	}
+
+	err = nb.deleteBridge(bridgeName, nw.BridgeType, nw.SharedENI)
 
 	if err != nil {
 		log.Errorf("Failed to delete bridge: %v.", err)
@@ -106,6 +160,16 @@ func (nb *BridgeBuilder) DeleteNetwork(nw *Network) error {
 
 // FindOrCreateEndpoint connects the ENI to target network namespace using veth pairs.
 func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
+	if ep.SandboxIsolation == config.SandboxIsolationHyperV {
+		return fmt.Errorf("sandbox isolation %s is not supported on Linux", ep.SandboxIsolation)
+	}
+	if ep.ManagedNamespace {
+		return fmt.Errorf("managed namespaces are not supported on Linux")
+	}
+	if len(ep.FirewallRules) != 0 {
+		return fmt.Errorf("host firewall rules are not supported on Linux")
+	}
+
 	// Derive endpoint names.
 	cid := ep.ContainerID
 	if len(cid) > 8 {
@@ -122,14 +186,39 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 		return err
 	}
 
-	// Connect the bridge to the target network namespace with a veth pair.
-	err = nb.createVethPair(nw.BridgeIndex, targetNetNS, vethLinkName, vethPeerName)
-	if err != nil {
-		log.Errorf("Failed to create veth pair: %v.", err)
-		return err
+	if ep.IfType == config.IfTypeIPVLAN {
+		// Connect the ENI to the target network namespace with an IPVLAN link.
+		err = nb.createIPVLANLink(nw, ep, targetNetNS, vethPeerName)
+		if err != nil {
+			log.Errorf("Failed to create IPVLAN link: %v.", err)
+			return err
+		}
+	} else {
+		// Connect the bridge to the target network namespace with a veth pair.
+		err = nb.createVethPair(nw.BridgeIndex, targetNetNS, vethLinkName, vethPeerName, ep.OwnerID)
+		if err != nil {
+			log.Errorf("Failed to create veth pair: %v.", err)
+			return err
+		}
+	}
+
+	// Obtain the endpoint IP address from the VPC DHCP service.
+	if nw.DHCP {
+		err = targetNetNS.Run(func() error {
+			ep.DHCPLease, err = nb.acquireDHCPLease(vethPeerName, ep.IfName)
+			return err
+		})
+		if err != nil {
+			log.Errorf("Failed to obtain DHCP lease: %v.", err)
+			return err
+		}
+		ep.IPAddress = ep.DHCPLease.Address
 	}
 
 	gatewayIPAddress := nw.GatewayIPAddress
+	if gatewayIPAddress == nil && ep.DHCPLease != nil {
+		gatewayIPAddress = ep.DHCPLease.Router
+	}
 	var gatewayMACAddress net.HardwareAddr
 
 	// Check whether the endpoint is in the same subnet as the ENI.
@@ -137,7 +226,13 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 	eniSubnetPrefix := vpc.GetSubnetPrefix(nw.ENIIPAddress)
 	sameSubnet := (epSubnetPrefix.String() == eniSubnetPrefix.String())
 
-	if nw.BridgeType == config.BridgeTypeL3 || !sameSubnet {
+	// IPVLAN endpoints receive their traffic directly from the ENI.
+	if ep.IfType == config.IfTypeIPVLAN {
+		if !sameSubnet {
+			return fmt.Errorf("IPVLAN endpoint address %s is not in the ENI subnet %s",
+				ep.IPAddress, eniSubnetPrefix)
+		}
+	} else if nw.BridgeType == config.BridgeTypeL3 || !sameSubnet {
 		// Route ingress traffic for the endpoint to the bridge.
 		route := &netlink.Route{
 			LinkIndex: nw.BridgeIndex,
@@ -157,7 +252,7 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 		}
 
 		log.Infof("Adding IP route %+v to bridge.", route)
-		err = netlink.RouteAdd(route)
+		err = retryNetlink("RouteAdd", func() error { return netlink.RouteAdd(route) })
 		if err != nil && !os.IsExist(err) {
 			log.Errorf("Failed to add IP route %+v: %v.", route, err)
 			return err
@@ -180,7 +275,10 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 	err = targetNetNS.Run(func() error {
 		ep.MACAddress, err = nb.setupTargetNetNS(
 			vethPeerName, ep.IfType, ep.TapUserID, ep.IfName, ep.IPAddress,
-			gatewayIPAddress, gatewayMACAddress)
+			gatewayIPAddress, gatewayMACAddress, nw.NAT64Prefix, nw.ExtraPrefixes)
+		if err == nil && (ep.IfType == config.IfTypeTAP || ep.IfType == config.IfTypeMacvtap) {
+			ep.TapDevice, err = nb.getTapDevice(ep.IfType, ep.IfName)
+		}
 		return err
 	})
 	if err != nil {
@@ -188,6 +286,69 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 		return err
 	}
 
+	// Enforce the network policy in the target network namespace. The policy is removed
+	// along with the network namespace.
+	if ep.Policy != nil {
+		err = targetNetNS.Run(func() error {
+			return policy.Apply(ep.Policy)
+		})
+		if err != nil {
+			log.Errorf("Failed to apply network policy: %v.", err)
+			return err
+		}
+	}
+
+	// Tune the container interface and the network stack of the target network namespace.
+	if len(ep.Sysctls) != 0 {
+		err = targetNetNS.Run(func() error {
+			return nb.setSysctls(ep.Sysctls)
+		})
+		if err != nil {
+			log.Errorf("Failed to set sysctls in netns %s: %v.", ep.NetNSName, err)
+			return err
+		}
+	}
+
+	// Cap the endpoint's egress bandwidth on the container interface.
+	if ep.EgressRate != 0 {
+		err = targetNetNS.Run(func() error {
+			return nb.limitEgressRate(ep.IfName, ep.EgressRate)
+		})
+		if err != nil {
+			log.Errorf("Failed to limit egress rate of link %s: %v.", ep.IfName, err)
+			return err
+		}
+	}
+
+	// Redirect DNS traffic from the endpoint to the DNS proxy.
+	if nw.DNSProxyAddress != nil {
+		err = targetNetNS.Run(func() error {
+			return nb.redirectDNS(nw.DNSProxyAddress)
+		})
+		if err != nil {
+			log.Errorf("Failed to redirect DNS traffic to proxy %s: %v.", nw.DNSProxyAddress, err)
+			return err
+		}
+	}
+
+	// Drop frames sent by the endpoint from source addresses other than its own.
+	if ep.AntiSpoofing {
+		err = nb.enforceSourceAddresses(nw, ep, cid)
+		if err != nil {
+			log.Errorf("Failed to enforce source addresses for veth link %s: %v.", vethLinkName, err)
+			return err
+		}
+	}
+
+	// Block direct traffic from and to other endpoints on the same host.
+	if ep.EastWestIsolation {
+		err = nb.isolateEastWest(cid, ep.EastWestOptIn)
+		if err != nil {
+			log.Errorf("Failed to isolate veth link %s from other endpoints: %v.", vethLinkName, err)
+			return err
+		}
+	}
+
 	if nw.BridgeType == config.BridgeTypeL2 {
 		// Set MAC DNAT rule for translating ingress IP datagrams arriving on the shared ENI
 		// sent to the endpoint IP address to endpoint MAC address.
@@ -219,6 +380,17 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
 	var returnedErr error
 
+	// Never delete endpoints of other CNI stacks.
+	cid := ep.ContainerID
+	if len(cid) > 8 {
+		cid = cid[:8]
+	}
+	err := nb.checkLinkStamp(fmt.Sprintf(vethLinkNameFormat, cid), ep.OwnerID, ep.ForceDelete)
+	if err != nil {
+		log.Errorf("Failed to delete endpoint: %v.", err)
+		return err
+	}
+
 	// Find the target network namespace.
 	log.Infof("Searching for netns %s.", ep.NetNSName)
 	targetNetNS, err := netns.GetNetNS(ep.NetNSName)
@@ -233,6 +405,14 @@ func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
 		link, err := netlink.LinkByName(ep.IfName)
 		if err == nil {
 			ep.MACAddress = link.Attrs().HardwareAddr
+
+			// Query the address obtained from DHCP, which is not recorded elsewhere.
+			if ep.IPAddress == nil && nw.DHCP {
+				addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+				if err == nil && len(addrs) != 0 {
+					ep.IPAddress = addrs[0].IPNet
+				}
+			}
 		}
 
 		// Delete the veth pair.
@@ -243,6 +423,33 @@ func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
 		returnedErr = err
 	}
 
+	// Remove the source address enforcement.
+	if ep.AntiSpoofing {
+		err = nb.removeSourceAddressEnforcement(cid)
+		if err != nil {
+			log.Errorf("Failed to remove source address enforcement for endpoint: %v.", err)
+			returnedErr = err
+		}
+	}
+
+	// Remove the east-west isolation.
+	if ep.EastWestIsolation {
+		for _, r := range eastWestRules(cid, ep.EastWestOptIn) {
+			err = r.table.Delete(r.chain, r.rule)
+			if err != nil {
+				log.Errorf("Failed to delete east-west isolation rule for endpoint: %v.", err)
+				returnedErr = err
+			}
+		}
+	}
+
+	// The endpoint IP address is unknown if the plugin state was lost and could not be
+	// recovered. There is nothing else to clean up by address.
+	if ep.IPAddress == nil {
+		log.Infof("Endpoint IP address is unknown, skipping DNAT rule and route cleanup.")
+		return returnedErr
+	}
+
 	// Delete bridge layer2 configuration.
 	if nw.BridgeType == config.BridgeTypeL2 {
 		// Delete the MAC DNAT rule for the endpoint.
@@ -278,7 +485,7 @@ func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
 	route.Dst.Mask = net.CIDRMask(maskSize, maskSize)
 
 	log.Infof("Deleting IP route %+v from bridge.", route)
-	err = netlink.RouteDel(route)
+	err = retryNetlink("RouteDel", func() error { return netlink.RouteDel(route) })
 	if err != nil && !os.IsNotExist(err) {
 		log.Errorf("Failed to delete IP route %+v: %v.", route, err)
 		return err
@@ -291,13 +498,19 @@ func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
 func (nb *BridgeBuilder) createBridge(
 	bridgeName string,
 	bridgeType string,
+	ipFamily string,
 	sharedENI *eni.ENI,
-	ipAddress *net.IPNet) (int, error) {
+	ipAddress *net.IPNet,
+	ownerID string) (int, error) {
 
 	// Check if the bridge already exists.
 	bridge, err := net.InterfaceByName(bridgeName)
 	if err == nil {
 		log.Infof("Found existing bridge %s.", bridgeName)
+		err = nb.checkLinkOwner(bridgeName, ownerID)
+		if err != nil {
+			return 0, err
+		}
 		return bridge.Index, nil
 	}
 
@@ -324,6 +537,12 @@ func (nb *BridgeBuilder) createBridge(
 		}
 	}()
 
+	// Record the owner of the bridge.
+	err = nb.setLinkOwner(bridgeLink, ownerID)
+	if err != nil {
+		return 0, err
+	}
+
 	// Connect a dummy link to the bridge.
 	// Bridge inherits the smallest MTU of links connected to its ports.
 	dummyName := fmt.Sprintf(dummyNameFormat, bridgeName)
@@ -482,6 +701,35 @@ func (nb *BridgeBuilder) createBridge(
 			log.Errorf("Failed to add IP route %+v: %v.", route, err)
 			return 0, err
 		}
+	} else if ipFamily == vpc.IPFamilyIPv6 {
+		// In IPv6-only layer3 configuration, endpoints have a static neighbor entry for the
+		// gateway, so there is no need to proxy neighbor discovery. No IPv4 is programmed.
+
+		// Keep accepting router advertisements on the shared ENI once forwarding is enabled,
+		// so that the host retains its IPv6 default route.
+		log.Infof("Enabling IPv6 router advertisements on %s.", sharedENI.GetLinkName())
+		err = ipcfg.SetIPv6AcceptRA(sharedENI.GetLinkName(), 2)
+		if err != nil {
+			log.Errorf("Failed to enable IPv6 router advertisements on %s: %v.",
+				sharedENI.GetLinkName(), err)
+			return 0, err
+		}
+
+		// Enable IPv6 forwarding on the bridge and shared ENI, so that IP datagrams can be
+		// routed between them.
+		log.Infof("Enabling IPv6 forwarding on %s.", bridgeName)
+		err = ipcfg.SetIPv6Forwarding(bridgeName, 1)
+		if err != nil {
+			log.Errorf("Failed to enable IPv6 forwarding on %s: %v.", bridgeName, err)
+			return 0, err
+		}
+
+		log.Infof("Enabling IPv6 forwarding on %s.", sharedENI.GetLinkName())
+		err = ipcfg.SetIPv6Forwarding(sharedENI.GetLinkName(), 1)
+		if err != nil {
+			log.Errorf("Failed to enable IPv6 forwarding on %s: %v.", sharedENI.GetLinkName(), err)
+			return 0, err
+		}
 	} else {
 		// In layer3 configuration, the IP address and default route remain on the shared ENI.
 		// IP datagrams are routed between the bridge and the shared ENI.
@@ -595,13 +843,14 @@ func (nb *BridgeBuilder) createVethPair(
 	bridgeIndex int,
 	targetNetNS netns.NetNS,
 	vethLinkName string,
-	vethPeerName string) error {
+	vethPeerName string,
+	ownerID string) error {
 
 	// Check if the veth pair already exists.
 	_, err := netlink.LinkByName(vethLinkName)
 	if err == nil {
 		log.Infof("Found existing veth pair  %s.", vethLinkName)
-		return nil
+		return nb.checkLinkOwner(vethLinkName, ownerID)
 	}
 
 	// Create the veth link and connect it to the bridge.
@@ -615,14 +864,20 @@ func (nb *BridgeBuilder) createVethPair(
 	}
 
 	log.Infof("Creating veth pair %+v.", vethLink)
-	err = netlink.LinkAdd(vethLink)
+	err = retryNetlink("LinkAdd", func() error { return netlink.LinkAdd(vethLink) })
 	if err != nil {
 		log.Errorf("Failed to add veth pair %s: %v.", vethLinkName, err)
 		return err
 	}
 
+	// Record the owner of the veth pair.
+	err = nb.setLinkOwner(vethLink, ownerID)
+	if err != nil {
+		return err
+	}
+
 	// Set the veth link operational state up.
-	err = netlink.LinkSetUp(vethLink)
+	err = retryNetlink("LinkSetUp", func() error { return netlink.LinkSetUp(vethLink) })
 	if err != nil {
 		log.Errorf("Failed to set veth link %s state up: %v.", vethLinkName, err)
 		return err
@@ -633,7 +888,7 @@ func (nb *BridgeBuilder) createVethPair(
 	la = netlink.NewLinkAttrs()
 	la.Name = vethPeerName
 	vethPeer := &netlink.Dummy{LinkAttrs: la}
-	err = netlink.LinkSetNsFd(vethPeer, int(targetNetNS.GetFd()))
+	err = retryNetlink("LinkSetNsFd", func() error { return netlink.LinkSetNsFd(vethPeer, int(targetNetNS.GetFd())) })
 	if err != nil {
 		log.Errorf("Failed to move veth link peer %s to target netns: %v.", vethPeerName, err)
 		return err
@@ -642,13 +897,113 @@ func (nb *BridgeBuilder) createVethPair(
 	return nil
 }
 
+// createIPVLANLink creates an IPVLAN link in L2 mode on the shared ENI, and moves it to the
+// target network namespace. The link is configured like the peer of a veth pair afterwards.
+func (nb *BridgeBuilder) createIPVLANLink(
+	nw *Network,
+	ep *Endpoint,
+	targetNetNS netns.NetNS,
+	linkName string) error {
+
+	// Check if the container interface already exists.
+	var exists bool
+	targetNetNS.Run(func() error {
+		_, err := netlink.LinkByName(ep.IfName)
+		exists = (err == nil)
+		return nil
+	})
+	if exists {
+		log.Infof("Found existing container interface %s.", ep.IfName)
+		return nil
+	}
+
+	// Remove the link left over by any previous attempt.
+	link, err := netlink.LinkByName(linkName)
+	if err == nil {
+		log.Infof("Deleting leftover IPVLAN link %s.", linkName)
+		netlink.LinkDel(link)
+	}
+
+	la := netlink.NewLinkAttrs()
+	la.Name = linkName
+	la.ParentIndex = nw.SharedENI.GetLinkIndex()
+	ipvlanLink := &netlink.IPVlan{
+		LinkAttrs: la,
+		Mode:      netlink.IPVLAN_MODE_L2,
+	}
+
+	log.Infof("Creating IPVLAN link %+v.", ipvlanLink)
+	err = retryNetlink("LinkAdd", func() error { return netlink.LinkAdd(ipvlanLink) })
+	if err != nil {
+		log.Errorf("Failed to add IPVLAN link %s: %v.", linkName, err)
+		return err
+	}
+
+	log.Infof("Moving IPVLAN link %s to target netns.", linkName)
+	err = retryNetlink("LinkSetNsFd", func() error { return netlink.LinkSetNsFd(ipvlanLink, int(targetNetNS.GetFd())) })
+	if err != nil {
+		log.Errorf("Failed to move IPVLAN link %s to target netns: %v.", linkName, err)
+		netlink.LinkDel(ipvlanLink)
+		return err
+	}
+
+	return nil
+}
+
+// EndpointName returns the name of the host veth link of the given endpoint.
+func EndpointName(ep *Endpoint) string {
+	cid := ep.ContainerID
+	if len(cid) > 8 {
+		cid = cid[:8]
+	}
+	return fmt.Sprintf(vethLinkNameFormat, cid)
+}
+
+// setLinkOwner records the owner of a link in its alias, as link names are too short for
+// an owner ID suffix. The alias also stamps the link as created by this plugin.
+func (nb *BridgeBuilder) setLinkOwner(link netlink.Link, ownerID string) error {
+	err := netlink.LinkSetAlias(link, owner.Alias(ownerID))
+	if err != nil {
+		log.Errorf("Failed to set owner of link %s: %v.", link.Attrs().Name, err)
+	}
+
+	return err
+}
+
+// checkLinkOwner returns an error if the named link exists and is owned by another CNI stack.
+func (nb *BridgeBuilder) checkLinkOwner(linkName string, ownerID string) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return nil
+	}
+
+	return owner.Check("link "+linkName, owner.FromAlias(link.Attrs().Alias), ownerID)
+}
+
+// checkLinkStamp returns an error if the named link exists and is either owned by another CNI
+// stack, or was not stamped by this plugin and the deletion is not forced.
+func (nb *BridgeBuilder) checkLinkStamp(linkName string, ownerID string, force bool) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return nil
+	}
+
+	alias := link.Attrs().Alias
+	err = owner.CheckStamp("link "+linkName, owner.IsStamped(alias), force)
+	if err != nil {
+		return err
+	}
+
+	return owner.Check("link "+linkName, owner.FromAlias(alias), ownerID)
+}
+
 // deleteVethPair deletes the given veth pair.
 func (nb *BridgeBuilder) deleteVethPair(vethPeerName string) error {
 	la := netlink.NewLinkAttrs()
 	la.Name = vethPeerName
 	vethLink := &netlink.Veth{LinkAttrs: la}
 	log.Infof("Deleting veth pair: %v.", vethPeerName)
-	err := netlink.LinkDel(vethLink)
+	err := retryNetlink("LinkDel", func() error { return netlink.LinkDel(vethLink) })
 	if err != nil {
 		log.Errorf("Failed to delete veth pair %s: %v.", vethPeerName, err)
 	}
@@ -665,7 +1020,9 @@ func (nb *BridgeBuilder) setupTargetNetNS(
 	ifName string,
 	ipAddress *net.IPNet,
 	gatewayIPAddress net.IP,
-	gatewayMACAddress net.HardwareAddr) (net.HardwareAddr, error) {
+	gatewayMACAddress net.HardwareAddr,
+	nat64Prefix *net.IPNet,
+	extraPrefixes []*net.IPNet) (net.HardwareAddr, error) {
 
 	// Check if the container interface already exists.
 	link, err := netlink.LinkByName(ifName)
@@ -675,10 +1032,14 @@ func (nb *BridgeBuilder) setupTargetNetNS(
 	}
 
 	switch ifType {
-	case config.IfTypeVETH:
-		err = nb.setupVethLink(vethPeerName, ifName, ipAddress, gatewayIPAddress, gatewayMACAddress)
+	case config.IfTypeVETH, config.IfTypeIPVLAN:
+		err = nb.setupVethLink(
+			vethPeerName, ifName, ipAddress, gatewayIPAddress, gatewayMACAddress, nat64Prefix,
+			extraPrefixes)
 	case config.IfTypeTAP:
 		err = nb.setupTapLink(vethPeerName, ifName, tapUserID)
+	case config.IfTypeMacvtap:
+		err = nb.setupMacvtapLink(vethPeerName, ifName, tapUserID)
 	}
 
 	if err != nil {
@@ -690,13 +1051,302 @@ func (nb *BridgeBuilder) setupTargetNetNS(
 	return link.Attrs().HardwareAddr, err
 }
 
+// redirectDNS redirects DNS traffic sent to any resolver in the current network namespace to
+// the DNS proxy, so that tasks with hardcoded resolver addresses use the proxy as well.
+func (nb *BridgeBuilder) redirectDNS(dnsProxyAddress net.IP) error {
+	proto := iptables.ProtocolIPv4
+	if !vpc.IsIPv4(dnsProxyAddress) {
+		proto = iptables.ProtocolIPv6
+	}
+
+	ipt, err := iptables.NewWithProtocol(proto)
+	if err != nil {
+		return err
+	}
+
+	for _, protocol := range []string{"udp", "tcp"} {
+		rule := []string{
+			"-p", protocol, "--dport", "53", "!", "-d", dnsProxyAddress.String(),
+			"-j", "DNAT", "--to-destination", dnsProxyAddress.String(),
+		}
+		log.Infof("Adding iptables rule nat OUTPUT %v.", rule)
+		err = ipt.AppendUnique("nat", "OUTPUT", rule...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enforceSourceAddresses restricts the frames sent by an endpoint over its veth link to the
+// endpoint's source MAC and IP addresses. Frames are checked in a chain of the endpoint, which
+// is the target of both the FORWARD chain for bridged traffic and the INPUT chain for traffic
+// routed by the host.
+func (nb *BridgeBuilder) enforceSourceAddresses(nw *Network, ep *Endpoint, cid string) error {
+	chain := ebtables.Chain(fmt.Sprintf(antiSpoofingChainFormat, cid))
+
+	// Replace the chain left over by any previous attempt.
+	nb.removeSourceAddressEnforcement(cid)
+
+	err := ebtables.Filter.NewChain(chain)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range nb.antiSpoofingRules(nw, ep) {
+		err = ebtables.Filter.Append(chain, rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, parent := range []ebtables.Chain{ebtables.Forward, ebtables.Input} {
+		err = ebtables.Filter.Append(parent, nb.antiSpoofingJumpRule(cid))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeSourceAddressEnforcement removes the chain enforcing the source addresses of an endpoint.
+func (nb *BridgeBuilder) removeSourceAddressEnforcement(cid string) error {
+	var returnedErr error
+
+	for _, parent := range []ebtables.Chain{ebtables.Forward, ebtables.Input} {
+		err := ebtables.Filter.Delete(parent, nb.antiSpoofingJumpRule(cid))
+		if err != nil {
+			returnedErr = err
+		}
+	}
+
+	err := ebtables.Filter.DeleteChain(ebtables.Chain(fmt.Sprintf(antiSpoofingChainFormat, cid)))
+	if err != nil {
+		returnedErr = err
+	}
+
+	return returnedErr
+}
+
+// antiSpoofingJumpRule returns the rule checking frames received from an endpoint's veth link.
+func (nb *BridgeBuilder) antiSpoofingJumpRule(cid string) *ebtables.Rule {
+	return &ebtables.Rule{
+		In:     fmt.Sprintf(vethLinkNameFormat, cid),
+		Target: ebtables.StdTarget(fmt.Sprintf(antiSpoofingChainFormat, cid)),
+	}
+}
+
+// antiSpoofingRules returns the rules returning frames with the endpoint's source addresses
+// and dropping all others.
+func (nb *BridgeBuilder) antiSpoofingRules(nw *Network, ep *Endpoint) []*ebtables.Rule {
+	// Frames from TAP interfaces carry the MAC address of the virtual machine's interface,
+	// which is not known to the plugin.
+	mac := ep.MACAddress
+	if ep.IfType == config.IfTypeTAP {
+		mac = nil
+	}
+
+	var rules []*ebtables.Rule
+	ipAddress := ep.IPAddress
+	switch {
+	case ipAddress == nil:
+		rules = append(rules, &ebtables.Rule{Src: mac, Target: ebtables.Return})
+	case vpc.IsIPv4(ipAddress.IP):
+		sources := []net.IP{ipAddress.IP}
+		if nw.DHCP {
+			// DHCP clients send requests from the unspecified address until leased.
+			sources = append(sources, net.IPv4zero)
+		}
+		for _, src := range sources {
+			rules = append(rules, &ebtables.Rule{
+				Protocol: "IPv4",
+				Src:      mac,
+				Match:    &ebtables.IPv4Match{Src: src},
+				Target:   ebtables.Return,
+			})
+		}
+		rules = append(rules, &ebtables.Rule{
+			Protocol: "ARP",
+			Src:      mac,
+			Match:    &ebtables.ARPMatch{IPSrc: ipAddress.IP, MACSrc: mac},
+			Target:   ebtables.Return,
+		})
+	default:
+		// Neighbor discovery is performed from link-local and unspecified addresses.
+		host := &net.IPNet{IP: ipAddress.IP, Mask: net.CIDRMask(128, 128)}
+		_, linkLocal, _ := net.ParseCIDR("fe80::/10")
+		_, unspecified, _ := net.ParseCIDR("::/128")
+		for _, src := range []*net.IPNet{host, linkLocal, unspecified} {
+			rules = append(rules, &ebtables.Rule{
+				Protocol: "IPv6",
+				Src:      mac,
+				Match:    &ebtables.IPv6Match{Src: src},
+				Target:   ebtables.Return,
+			})
+		}
+	}
+
+	return append(rules, &ebtables.Rule{Target: ebtables.Drop})
+}
+
+// eastWestRule is an ebtables rule isolating an endpoint from other endpoints on the same host.
+type eastWestRule struct {
+	tableName string
+	table     *ebtables.Table
+	chain ebtables.Chain
+	rule  *ebtables.Rule
+}
+
+// isolateEastWest blocks direct traffic between an endpoint and other endpoints on the same host,
+// unless both endpoints opted in to east-west traffic.
+func (nb *BridgeBuilder) isolateEastWest(cid string, optIn bool) error {
+	for _, r := range eastWestRules(cid, optIn) {
+		// Replace the rules left over by any previous attempt.
+		r.table.Delete(r.chain, r.rule)
+
+		err := r.table.Append(r.chain, r.rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eastWestRules returns the rules isolating an endpoint from other endpoints on the same host.
+// Packets sent by endpoints are marked on ingress, and the marks survive both bridging and
+// routing by the host. Endpoints that opted in drop packets from endpoints that did not, and the
+// others drop packets from all endpoints. Packets from the host and remote hosts are unmarked.
+func eastWestRules(cid string, optIn bool) []eastWestRule {
+	vethLinkName := fmt.Sprintf(vethLinkNameFormat, cid)
+
+	mark := uint32(eastWestEndpointMark | eastWestIsolatedMark)
+	dropMark := uint32(eastWestEndpointMark)
+	if optIn {
+		mark = eastWestEndpointMark
+		dropMark = eastWestIsolatedMark
+	}
+
+	rules := []eastWestRule{
+		{
+			tableName: "nat",
+			table:     &ebtables.NAT,
+			chain:     ebtables.PreRouting,
+			rule: &ebtables.Rule{
+				In:     vethLinkName,
+				Target: &ebtables.MarkTarget{Or: mark, Target: ebtables.Continue},
+			},
+		},
+	}
+
+	// Bridged packets traverse the FORWARD chain and routed packets the OUTPUT chain.
+	for _, chain := range []ebtables.Chain{ebtables.Forward, ebtables.Output} {
+		rules = append(rules, eastWestRule{
+			tableName: "filter",
+			table:     &ebtables.Filter,
+			chain:     chain,
+			rule: &ebtables.Rule{
+				Out:    vethLinkName,
+				Match:  &ebtables.MarkMatch{Value: dropMark, Mask: dropMark},
+				Target: ebtables.Drop,
+			},
+		})
+	}
+
+	return rules
+}
+
+// setSysctls sets the given kernel parameters in the current network namespace, in key order.
+func (nb *BridgeBuilder) setSysctls(sysctls map[string]string) error {
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		log.Infof("Setting sysctl %s to %s.", key, sysctls[key])
+		err := ipcfg.SetSysctl(key, sysctls[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limitEgressRate attaches a token bucket filter to a link in the current network namespace,
+// capping its egress rate in bits per second.
+func (nb *BridgeBuilder) limitEgressRate(linkName string, rate uint64) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return err
+	}
+
+	// Allow bursts of up to 100ms worth of traffic, queued for at most 50ms.
+	bytesPerSecond := rate / 8
+	qdisc := &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   bytesPerSecond,
+		Buffer: uint32(bytesPerSecond/10) + tbfMinBuffer,
+		Limit:  uint32(bytesPerSecond/20) + tbfMinBuffer,
+	}
+
+	log.Infof("Adding tbf qdisc with rate %d bits/s to link %s.", rate, linkName)
+	return netlink.QdiscReplace(qdisc)
+}
+
+// acquireDHCPLease obtains a DHCP lease on the container interface, or on the veth link that
+// becomes the container interface if it does not exist yet.
+func (nb *BridgeBuilder) acquireDHCPLease(vethPeerName string, ifName string) (*dhcp.Lease, error) {
+	linkName := ifName
+	_, err := netlink.LinkByName(ifName)
+	if err != nil {
+		linkName = vethPeerName
+	}
+
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		log.Errorf("Failed to set link %s state up: %v.", linkName, err)
+		return nil, err
+	}
+
+	lease, err := dhcp.Acquire(linkName)
+
+	// The veth link must be down to be renamed to the container interface name.
+	if linkName == vethPeerName {
+		downErr := netlink.LinkSetDown(link)
+		if downErr != nil {
+			log.Errorf("Failed to set link %s state down: %v.", linkName, downErr)
+			if err == nil {
+				err = downErr
+			}
+		}
+	}
+
+	return lease, err
+}
+
 // setupVethLink sets up a veth link in the target network namespace.
 func (nb *BridgeBuilder) setupVethLink(
 	vethPeerName string,
 	ifName string,
 	ipAddress *net.IPNet,
 	gatewayIPAddress net.IP,
-	gatewayMACAddress net.HardwareAddr) error {
+	gatewayMACAddress net.HardwareAddr,
+	nat64Prefix *net.IPNet,
+	extraPrefixes []*net.IPNet) error {
 
 	var link netlink.Link
 
@@ -723,6 +1373,16 @@ func (nb *BridgeBuilder) setupVethLink(
 
 	// Set the IP address and the default gateway if specified.
 	if ipAddress != nil {
+		// Addresses are unique within the VPC, so skip duplicate address detection to make
+		// IPv6 addresses usable immediately.
+		if !vpc.IsIPv4(ipAddress.IP) {
+			err = ipcfg.SetIPv6AcceptDAD(ifName, 0)
+			if err != nil {
+				log.Errorf("Failed to disable IPv6 DAD on link %s: %v.", ifName, err)
+				return err
+			}
+		}
+
 		// Assign the IP address.
 		log.Infof("Assigning IP address %v to link %s.", ipAddress, ifName)
 		address := &netlink.Addr{IPNet: ipAddress}
@@ -764,11 +1424,50 @@ func (nb *BridgeBuilder) setupVethLink(
 			return err
 		}
 
+		// Route NAT64 traffic through this interface even if another interface is the default.
+		if nat64Prefix != nil {
+			route = &netlink.Route{
+				LinkIndex: iface.Index,
+				Dst:       nat64Prefix,
+				Gw:        gatewayIPAddress,
+				Flags:     int(netlink.FLAG_ONLINK),
+			}
+
+			log.Infof("Adding NAT64 IP route %+v.", route)
+			err = netlink.RouteAdd(route)
+			if err != nil {
+				log.Errorf("Failed to add IP route %+v: %v.", route, err)
+				return err
+			}
+		}
+
+		// Route peered VPC and transit gateway prefixes through this interface as well.
+		for _, prefix := range extraPrefixes {
+			route = &netlink.Route{
+				LinkIndex: iface.Index,
+				Dst:       prefix,
+				Gw:        gatewayIPAddress,
+				Flags:     int(netlink.FLAG_ONLINK),
+			}
+
+			log.Infof("Adding extra prefix IP route %+v.", route)
+			err = netlink.RouteAdd(route)
+			if err != nil {
+				log.Errorf("Failed to add IP route %+v: %v.", route, err)
+				return err
+			}
+		}
+
 		// Add the neighbor entry for the gateway if a MAC address is specified.
 		if gatewayMACAddress != nil {
+			family := netlink.FAMILY_V4
+			if !vpc.IsIPv4(gatewayIPAddress) {
+				family = netlink.FAMILY_V6
+			}
+
 			neigh := &netlink.Neigh{
 				LinkIndex:    iface.Index,
-				Family:       netlink.FAMILY_V4,
+				Family:       family,
 				State:        netlink.NUD_PERMANENT,
 				IP:           gatewayIPAddress,
 				HardwareAddr: gatewayMACAddress,
@@ -868,3 +1567,96 @@ func (nb *BridgeBuilder) setupTapLink(linkName string, tapLinkName string, uid i
 
 	return nil
 }
+
+// setupMacvtapLink sets up a macvtap link on the veth link in the target network namespace.
+// Unlike TAP links, macvtap links need no bridge, and virtual machines attach to them through a
+// character device of their own. The virtual machine's interface is expected to use the MAC
+// address of the macvtap link.
+func (nb *BridgeBuilder) setupMacvtapLink(linkName string, macvtapLinkName string, uid int) error {
+	// Set the lower veth link operational state up.
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		log.Errorf("Failed to find link %s: %v", linkName, err)
+		return err
+	}
+
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		log.Errorf("Failed to set link %s state: %v", linkName, err)
+		return err
+	}
+
+	// Create the macvtap link.
+	la := netlink.NewLinkAttrs()
+	la.Name = macvtapLinkName
+	la.ParentIndex = link.Attrs().Index
+	la.MTU = vpc.JumboFrameMTU
+	macvtapLink := &netlink.Macvtap{
+		Macvlan: netlink.Macvlan{
+			LinkAttrs: la,
+			Mode:      netlink.MACVLAN_MODE_BRIDGE,
+		},
+	}
+
+	log.Infof("Creating macvtap link %+v.", macvtapLink)
+	err = netlink.LinkAdd(macvtapLink)
+	if err != nil {
+		log.Errorf("Failed to add macvtap link: %v", err)
+		return err
+	}
+
+	// Set macvtap link operational state up.
+	err = netlink.LinkSetUp(macvtapLink)
+	if err != nil {
+		log.Errorf("Failed to set macvtap link state: %v", err)
+		return err
+	}
+
+	// Set macvtap device ownership. The device node is created by the kernel in devtmpfs, and
+	// may be missing on hosts without it, where the runtime creates the node itself.
+	device, err := nb.getTapDevice(config.IfTypeMacvtap, macvtapLinkName)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Setting macvtap device %s owner to uid %d.", device, uid)
+	err = os.Chown(device, uid, -1)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to set macvtap device owner: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// getTapDevice returns the path of the character device for attaching to the given TAP or
+// macvtap link. TAP links are attached by name through the clone device, whereas each macvtap
+// link has its own device named after its interface index.
+func (nb *BridgeBuilder) getTapDevice(ifType string, linkName string) (string, error) {
+	if ifType == config.IfTypeTAP {
+		return tunCloneDevice, nil
+	}
+
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		log.Errorf("Failed to find link %s: %v", linkName, err)
+		return "", err
+	}
+
+	return fmt.Sprintf(macvtapDeviceFormat, link.Attrs().Index), nil
+}
+
+// retryNetlink calls a netlink operation with the default backoff policy, retrying the errors
+// caused by contention in the kernel.
+func retryNetlink(op string, fn func() error) error {
+	return backoff.Default().Retry(op, fn, isTransientNetlinkError)
+}
+
+// isTransientNetlinkError returns whether a netlink error is transient.
+func isTransientNetlinkError(err error) bool {
+	switch err {
+	case unix.EBUSY, unix.EAGAIN, unix.EINTR, unix.ENOBUFS:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
+
+	"github.com/Microsoft/hcsshim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkACLRules is the number of policy rules of endpoints in benchmarks.
+const benchmarkACLRules = 100
+
+// newTestPolicyEndpoint returns a test endpoint enforcing a policy with the given number of rules.
+func newTestPolicyEndpoint(rules int) *Endpoint {
+	ep := newTestEndpoint("container1")
+	ep.EgressRate = 100000000
+	ep.Policy = &policy.Document{DefaultAction: policy.ActionDeny}
+	for i := 0; i < rules; i++ {
+		ep.Policy.Rules = append(ep.Policy.Rules, policy.Rule{
+			Action:    policy.ActionAllow,
+			Direction: policy.DirectionIngress,
+			Protocol:  policy.ProtocolTCP,
+			CIDRs:     []string{fmt.Sprintf("10.%d.0.0/16", i)},
+			Ports:     []string{"80", "8000-8080"},
+		})
+	}
+	return ep
+}
+
+// encodePerPolicy encodes an HNS endpoint request the way it was encoded before policies were
+// kept typed, by encoding each policy into a raw message and then encoding the endpoint.
+func encodePerPolicy(request *hnsEndpointRequest) ([]byte, error) {
+	hnsEndpoint := *request.HNSEndpoint
+	for _, p := range request.Policies {
+		buf, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		hnsEndpoint.Policies = append(hnsEndpoint.Policies, buf)
+	}
+	return json.Marshal(&hnsEndpoint)
+}
+
+func TestHNSEndpointRequestMatchesPerPolicyEncoding(t *testing.T) {
+	nb, nw := newTestNetwork(t, newFakeHNS())
+	nw.ServiceCIDR = "10.100.0.0/16"
+	request := nb.newHNSEndpoint(nw, newTestPolicyEndpoint(3), "cid-container1")
+
+	expected, err := encodePerPolicy(request)
+	require.NoError(t, err)
+	actual, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, string(expected), string(actual))
+}
+
+func TestHNSEndpointRequestAntiSpoofing(t *testing.T) {
+	nb, nw := newTestNetwork(t, newFakeHNS())
+	ep := newTestEndpoint("container1")
+	ep.AntiSpoofing = true
+	request := nb.newHNSEndpoint(nw, ep, "cid-container1")
+
+	var acls []*hcsshim.ACLPolicy
+	for _, p := range request.Policies {
+		if acl, ok := p.(*hcsshim.ACLPolicy); ok {
+			acls = append(acls, acl)
+		}
+	}
+
+	// Endpoints without a policy allow all traffic from their own address.
+	require.Len(t, acls, 3)
+	assert.Equal(t, hcsshim.Allow, acls[0].Action)
+	assert.Equal(t, hcsshim.Allow, acls[1].Action)
+
+	acl := acls[2]
+	assert.Equal(t, hcsshim.Block, acl.Action)
+	assert.Equal(t, hcsshim.Out, acl.Direction)
+	assert.Equal(t, uint16(antiSpoofingACLPriority), acl.Priority)
+	blocked := strings.Split(acl.LocalAddresses, ",")
+	assert.Len(t, blocked, 32)
+	assert.Contains(t, blocked, "10.0.1.21/32")
+	assert.NotContains(t, blocked, "10.0.1.20/32")
+}
+
+func TestHNSEndpointRequestEastWestIsolation(t *testing.T) {
+	nb, nw := newTestNetwork(t, newFakeHNS())
+	ep := newTestEndpoint("container1")
+	assert.False(t, nb.newHNSEndpoint(nw, ep, "cid-container1").DisableICC)
+
+	ep.EastWestIsolation = true
+	assert.True(t, nb.newHNSEndpoint(nw, ep, "cid-container1").DisableICC)
+
+	ep.EastWestOptIn = true
+	assert.False(t, nb.newHNSEndpoint(nw, ep, "cid-container1").DisableICC)
+}
+
+func BenchmarkHNSEndpointRequest(b *testing.B) {
+	nb, nw := newTestNetwork(b, newFakeHNS())
+	ep := newTestPolicyEndpoint(benchmarkACLRules)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := json.Marshal(nb.newHNSEndpoint(nw, ep, "cid-container1"))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHNSEndpointRequestPerPolicy(b *testing.B) {
+	nb, nw := newTestNetwork(b, newFakeHNS())
+	ep := newTestPolicyEndpoint(benchmarkACLRules)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := encodePerPolicy(nb.newHNSEndpoint(nw, ep, "cid-container1"))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -17,9 +17,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/aws/amazon-vpc-cni-plugins/network/dhcp"
+	"github.com/aws/amazon-vpc-cni-plugins/network/firewall"
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
 	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
 
 	"github.com/Microsoft/hcsshim"
 	log "github.com/cihub/seelog"
@@ -34,11 +42,30 @@ const (
 
 	// hnsEndpointNameFormat is the format of the names generated for HNS endpoints.
 	hnsEndpointNameFormat = "cid-%s"
+
+	// firewallGroupFormat is the format of the host firewall rule groups of HNS endpoints.
+	firewallGroupFormat = "vpc-shared-eni %s"
+
+	// vNICNameFormat is the format of the names of HNS endpoint vNICs.
+	vNICNameFormat = "vEthernet (%s)"
+
+	// antiSpoofingACLPriority is the HNS ACL priority of the rule enforcing the source address
+	// of an endpoint, which takes precedence over all network policy rules.
+	antiSpoofingACLPriority = 50
 )
 
 var (
 	// hnsMinVersion is the minimum version of HNS supported by this plugin.
 	hnsMinVersion = hcsshim.HNSVersion1803
+
+	// dhcpLeaseTimeout is how long to wait for endpoints to obtain an address from DHCP.
+	dhcpLeaseTimeout = 30 * time.Second
+	// dhcpPollInterval is how often to check whether an endpoint obtained an address.
+	dhcpPollInterval = 500 * time.Millisecond
+
+	// namespaceGUIDRegexp matches the HCN namespace GUIDs that containerd passes as netns.
+	namespaceGUIDRegexp = regexp.MustCompile(
+		`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 )
 
 // hnsRoutePolicy is an HNS route policy.
@@ -49,13 +76,39 @@ type hnsRoutePolicy struct {
 	NeedEncap         bool   `json:"NeedEncap,omitempty"`
 }
 
+// hnsEndpointRequest is an HNS endpoint create request. Policies are kept as typed structures and
+// encoded once with the endpoint, rather than each encoded into a raw message first.
+type hnsEndpointRequest struct {
+	*hcsshim.HNSEndpoint
+	Policies []interface{} `json:",omitempty"`
+}
+
 // BridgeBuilder implements NetworkBuilder interface by bridging containers to an ENI on Windows.
-type BridgeBuilder struct{}
+// HNS lookups are cached in memory, and also in a state file if the builder has a state directory.
+// HNS objects created by the builder are stamped the same way.
+type BridgeBuilder struct {
+	hns      hnsClient
+	stateDir string
+	stamps   hnsStamps
+}
+
+// NewBridgeBuilder creates a new BridgeBuilder that shares its HNS lookup cache with other
+// processes through the given state directory.
+func NewBridgeBuilder(stateDir string) *BridgeBuilder {
+	return &BridgeBuilder{stateDir: stateDir}
+}
 
 // FindOrCreateNetwork creates a new HNS network.
 func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
+	// Never touch excluded host adapters.
+	err := nw.CheckExcluded()
+	if err != nil {
+		log.Errorf("Failed to create HNS network: %v.", err)
+		return err
+	}
+
 	// Check that the HNS version is supported.
-	err := nb.checkHNSVersion()
+	err = nb.checkHNSVersion()
 	if err != nil {
 		return err
 	}
@@ -67,25 +120,14 @@ func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
 
 	// Check if the network already exists.
 	networkName := nb.generateHNSNetworkName(nw)
-	hnsNetwork, err := hcsshim.GetHNSNetworkByName(networkName)
+	hnsNetwork, err := nb.client().GetHNSNetworkByName(networkName)
 	if err == nil {
 		log.Infof("Found existing HNS network %s.", networkName)
 		return nil
 	}
 
 	// Initialize the HNS network.
-	hnsNetwork = &hcsshim.HNSNetwork{
-		Name:               networkName,
-		Type:               hnsL2Bridge,
-		NetworkAdapterName: nw.SharedENI.GetLinkName(),
-
-		Subnets: []hcsshim.Subnet{
-			{
-				AddressPrefix:  vpc.GetSubnetPrefix(nw.ENIIPAddress).String(),
-				GatewayAddress: nw.GatewayIPAddress.String(),
-			},
-		},
-	}
+	hnsNetwork = nb.newHNSNetwork(nw)
 
 	buf, err := json.Marshal(hnsNetwork)
 	if err != nil {
@@ -95,7 +137,7 @@ func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
 
 	// Create the HNS network.
 	log.Infof("Creating HNS network: %+v", hnsRequest)
-	hnsResponse, err := hcsshim.HNSNetworkRequest("POST", "", hnsRequest)
+	hnsResponse, err := nb.client().HNSNetworkRequest("POST", "", hnsRequest)
 	if err != nil {
 		log.Errorf("Failed to create HNS network: %v.", err)
 		return err
@@ -103,30 +145,101 @@ func (nb *BridgeBuilder) FindOrCreateNetwork(nw *Network) error {
 
 	log.Infof("Received HNS network response: %+v.", hnsResponse)
 
-	return nil
+	err = nb.stampHNSObject(hnsResponse.Id, nw.OwnerID)
+	if err != nil {
+		log.Errorf("Failed to stamp HNS network: %v.", err)
+	}
+
+	return err
 }
 
 // DeleteNetwork deletes an existing HNS network.
 func (nb *BridgeBuilder) DeleteNetwork(nw *Network) error {
+	// Never touch excluded host adapters.
+	err := nw.CheckExcluded()
+	if err != nil {
+		log.Errorf("Failed to delete HNS network: %v.", err)
+		return err
+	}
+
 	// Find the HNS network ID.
 	networkName := nb.generateHNSNetworkName(nw)
-	hnsNetwork, err := hcsshim.GetHNSNetworkByName(networkName)
+	hnsNetwork, err := nb.client().GetHNSNetworkByName(networkName)
+	if err != nil {
+		return err
+	}
+
+	// Never delete networks of other CNI plugins.
+	err = nb.checkHNSStamp("HNS network "+networkName, hnsNetwork.Id, nw.OwnerID, nw.ForceDelete)
 	if err != nil {
+		log.Errorf("Failed to delete HNS network: %v.", err)
 		return err
 	}
 
 	// Delete the HNS network.
 	log.Infof("Deleting HNS network name: %s ID: %s", networkName, hnsNetwork.Id)
-	_, err = hcsshim.HNSNetworkRequest("DELETE", hnsNetwork.Id, "")
+	_, err = nb.client().HNSNetworkRequest("DELETE", hnsNetwork.Id, "")
 	if err != nil {
 		log.Errorf("Failed to delete HNS network: %v.", err)
+		return err
 	}
+	nb.unstampHNSObject(hnsNetwork.Id)
 
-	return err
+	return nil
 }
 
 // FindOrCreateEndpoint creates a new HNS endpoint in the network.
 func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
+	if ep.SandboxIsolation == config.SandboxIsolationMicroVM {
+		return fmt.Errorf("sandbox isolation %s is not supported on Windows", ep.SandboxIsolation)
+	}
+	if ep.IfType == config.IfTypeIPVLAN {
+		return fmt.Errorf("interface type %s is not supported on Windows", ep.IfType)
+	}
+	if len(ep.Sysctls) != 0 {
+		return fmt.Errorf("sysctls are not supported on Windows")
+	}
+
+	var err error
+	if ep.ManagedNamespace {
+		// The plugin creates and owns the namespace in pause-less sandbox flows. Endpoints are
+		// found by name, so the whole flow can be resumed.
+		err = nb.resumeAfterHNSRestart(nw, "managed endpoint creation", func() error {
+			return nb.findOrCreateManagedEndpoint(nw, ep)
+		})
+	} else {
+		err = nb.findOrCreateEndpoint(nw, ep)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Scope the host firewall rules of the endpoint to its vNIC, in a rule group of its own.
+	if len(ep.FirewallRules) != 0 {
+		err = nb.addFirewallRules(ep)
+		if err != nil {
+			log.Errorf("Failed to add host firewall rules: %v.", err)
+			return err
+		}
+	}
+
+	if !nw.DHCP {
+		return nil
+	}
+
+	// Harvest the address assigned to the endpoint by the VPC DHCP service.
+	ep.DHCPLease, err = nb.waitForDHCPLease(ep)
+	if err != nil {
+		log.Errorf("Failed to obtain DHCP lease: %v.", err)
+		return err
+	}
+	ep.IPAddress = ep.DHCPLease.Address
+
+	return nil
+}
+
+// findOrCreateEndpoint creates a new HNS endpoint attached to an infrastructure container.
+func (nb *BridgeBuilder) findOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 	// Query the infrastructure container ID.
 	isInfraContainer, infraContainerID, err := nb.getInfraContainerID(ep)
 	if err != nil {
@@ -135,7 +248,7 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 
 	// Check if the endpoint already exists.
 	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
-	hnsEndpoint, err := hcsshim.GetHNSEndpointByName(endpointName)
+	hnsEndpoint, err := nb.client().GetHNSEndpointByName(endpointName)
 	if err == nil {
 		log.Infof("Found existing HNS endpoint %s.", endpointName)
 		if isInfraContainer {
@@ -145,9 +258,10 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 				endpointName, ep.ContainerID)
 		} else {
 			// Attach the existing endpoint to the container's network namespace.
-			err = nb.attachEndpoint(hnsEndpoint, ep.ContainerID)
+			err = nb.attachEndpoint(hnsEndpoint, ep)
 		}
 
+		ep.ID = hnsEndpoint.Id
 		ep.MACAddress, _ = net.ParseMAC(hnsEndpoint.MacAddress)
 		return err
 	} else {
@@ -158,18 +272,336 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 		}
 	}
 
-	// Initialize the HNS endpoint.
-	hnsEndpoint = &hcsshim.HNSEndpoint{
+	return nb.resumeAfterHNSRestart(nw, "endpoint creation", func() error {
+		return nb.createAndAttachEndpoint(nw, ep, endpointName)
+	})
+}
+
+// createAndAttachEndpoint creates a new HNS endpoint and attaches it to an infrastructure
+// container. The endpoint is deleted if it cannot be attached.
+func (nb *BridgeBuilder) createAndAttachEndpoint(nw *Network, ep *Endpoint, endpointName string) error {
+	// Create the HNS endpoint.
+	hnsResponse, err := nb.createHNSEndpoint(nw, ep, endpointName)
+	if err != nil {
+		return err
+	}
+
+	// Attach the HNS endpoint to the container's network namespace, or hot-add it to the
+	// utility VM backing a Hyper-V isolated sandbox.
+	err = nb.attachEndpoint(hnsResponse, ep)
+	if err != nil {
+		// Cleanup the failed endpoint.
+		log.Infof("Deleting the failed HNS endpoint %s.", hnsResponse.Id)
+		nb.deleteHNSEndpoint(hnsResponse.Id)
+
+		return err
+	}
+
+	// Return network interface ID and MAC address.
+	ep.ID = hnsResponse.Id
+	ep.MACAddress, _ = net.ParseMAC(hnsResponse.MacAddress)
+
+	return nil
+}
+
+// DeleteEndpoint deletes an existing HNS endpoint.
+func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
+	// Remove the host firewall rules of the endpoint. The rules match no traffic once the vNIC
+	// is deleted, so the endpoint is deleted regardless.
+	if len(ep.FirewallRules) != 0 {
+		err := nb.removeFirewallRules(ep)
+		if err != nil {
+			log.Errorf("Failed to remove host firewall rules, ignoring: %v.", err)
+		}
+	}
+
+	if ep.ManagedNamespace {
+		return nb.deleteManagedEndpoint(ep)
+	}
+
+	// Query the infrastructure container ID.
+	isInfraContainer, infraContainerID, err := nb.getInfraContainerID(ep)
+	if err != nil {
+		return err
+	}
+
+	// Find the HNS endpoint ID.
+	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
+	hnsEndpoint, err := nb.client().GetHNSEndpointByName(endpointName)
+	if err != nil {
+		return err
+	}
+	ep.ID = hnsEndpoint.Id
+
+	// Never delete endpoints of other CNI plugins.
+	err = nb.checkHNSStamp("HNS endpoint "+endpointName, hnsEndpoint.Id, ep.OwnerID, ep.ForceDelete)
+	if err != nil {
+		log.Errorf("Failed to delete HNS endpoint: %v.", err)
+		return err
+	}
+
+	// Remove the HNS endpoint from a namespace created by the container runtime. The endpoint is
+	// also removed from the namespace when it is deleted, so failures are ignored.
+	if namespaceID := runtimeNamespaceID(ep); namespaceID != "" {
+		log.Infof("Removing HNS endpoint %s from namespace %s.", hnsEndpoint.Id, namespaceID)
+		err = nb.client().RemoveNamespaceEndpoint(namespaceID, hnsEndpoint.Id)
+		if err != nil {
+			log.Errorf("Failed to remove HNS endpoint from namespace, ignoring: %v.", err)
+		}
+
+		log.Infof("Deleting HNS endpoint name: %s ID: %s", endpointName, hnsEndpoint.Id)
+		return nb.deleteHNSEndpoint(hnsEndpoint.Id)
+	}
+
+	// Detach the HNS endpoint from the container's network namespace or utility VM.
+	targetID := nb.attachTargetID(ep)
+	log.Infof("Detaching HNS endpoint %s from compute system %s.", hnsEndpoint.Id, targetID)
+	err = nb.client().HotDetachEndpoint(targetID, hnsEndpoint.Id)
+	if err != nil && err != hcsshim.ErrComputeSystemDoesNotExist {
+		// Utility VMs are commonly stopped before the endpoint is deleted. An endpoint is
+		// released by a utility VM that is shutting down, so it can still be deleted.
+		if ep.SandboxIsolation != config.SandboxIsolationHyperV ||
+			(!hcsshim.IsNotExist(err) && err != hcsshim.ErrVmcomputeOperationInvalidState) {
+			return err
+		}
+		log.Infof("Utility VM %s is stopped or stopping, ignoring detach failure: %v.", targetID, err)
+	}
+
+	// The rest of the delete logic applies to infrastructure container only.
+	if !isInfraContainer {
+		return nil
+	}
+
+	// Delete the HNS endpoint.
+	log.Infof("Deleting HNS endpoint name: %s ID: %s", endpointName, hnsEndpoint.Id)
+	return nb.deleteHNSEndpoint(hnsEndpoint.Id)
+}
+
+// findOrCreateManagedEndpoint creates an HNS endpoint in a new HCN namespace owned by the
+// plugin, so that no infrastructure container is needed to hold the sandbox namespace.
+// Returns the namespace ID in the endpoint.
+func (nb *BridgeBuilder) findOrCreateManagedEndpoint(nw *Network, ep *Endpoint) error {
+	// Check if the endpoint already exists.
+	endpointName := nb.generateHNSEndpointName(ep, "")
+	hnsEndpoint, err := nb.client().GetHNSEndpointByName(endpointName)
+	if err == nil {
+		log.Infof("Found existing HNS endpoint %s.", endpointName)
+		ep.ID = hnsEndpoint.Id
+		ep.MACAddress, _ = net.ParseMAC(hnsEndpoint.MacAddress)
+		ep.NamespaceID, err = nb.client().GetEndpointNamespace(hnsEndpoint.Id)
+		if err != nil || ep.NamespaceID != "" {
+			// This is a benign duplicate create call for an existing endpoint.
+			return err
+		}
+	} else {
+		hnsEndpoint, err = nb.createHNSEndpoint(nw, ep, endpointName)
+		if err != nil {
+			return err
+		}
+		ep.ID = hnsEndpoint.Id
+		ep.MACAddress, _ = net.ParseMAC(hnsEndpoint.MacAddress)
+	}
+
+	// Create the namespace and add the endpoint to it.
+	ep.NamespaceID, err = nb.client().CreateNamespace()
+	if err == nil {
+		log.Infof("Adding HNS endpoint %s to namespace %s.", hnsEndpoint.Id, ep.NamespaceID)
+		err = nb.client().AddNamespaceEndpoint(ep.NamespaceID, hnsEndpoint.Id)
+		if err != nil {
+			log.Errorf("Failed to add HNS endpoint to namespace: %v.", err)
+			delErr := nb.client().DeleteNamespace(ep.NamespaceID)
+			if delErr != nil {
+				log.Errorf("Failed to delete namespace %s: %v.", ep.NamespaceID, delErr)
+			}
+		}
+	} else {
+		log.Errorf("Failed to create namespace: %v.", err)
+	}
+
+	if err != nil {
+		// Cleanup the failed endpoint.
+		log.Infof("Deleting the failed HNS endpoint %s.", hnsEndpoint.Id)
+		nb.deleteHNSEndpoint(hnsEndpoint.Id)
+		ep.ID = ""
+		ep.NamespaceID = ""
+		return err
+	}
+
+	return nil
+}
+
+// deleteManagedEndpoint deletes an HNS endpoint and the HCN namespace owned by the plugin.
+func (nb *BridgeBuilder) deleteManagedEndpoint(ep *Endpoint) error {
+	endpointName := nb.generateHNSEndpointName(ep, "")
+	hnsEndpoint, err := nb.client().GetHNSEndpointByName(endpointName)
+	if err != nil {
+		return err
+	}
+	ep.ID = hnsEndpoint.Id
+
+	// Never delete endpoints of other CNI plugins.
+	err = nb.checkHNSStamp("HNS endpoint "+endpointName, hnsEndpoint.Id, ep.OwnerID, ep.ForceDelete)
+	if err != nil {
+		log.Errorf("Failed to delete HNS endpoint: %v.", err)
+		return err
+	}
+
+	namespaceID, err := nb.client().GetEndpointNamespace(hnsEndpoint.Id)
+	if err != nil {
+		log.Errorf("Failed to find namespace of HNS endpoint %s: %v.", hnsEndpoint.Id, err)
+		return err
+	}
+
+	if namespaceID != "" {
+		log.Infof("Removing HNS endpoint %s from namespace %s.", hnsEndpoint.Id, namespaceID)
+		err = nb.client().RemoveNamespaceEndpoint(namespaceID, hnsEndpoint.Id)
+		if err != nil {
+			log.Errorf("Failed to remove HNS endpoint from namespace: %v.", err)
+			return err
+		}
+
+		log.Infof("Deleting namespace %s.", namespaceID)
+		err = nb.client().DeleteNamespace(namespaceID)
+		if err != nil {
+			log.Errorf("Failed to delete namespace: %v.", err)
+			return err
+		}
+	}
+
+	// Delete the HNS endpoint.
+	log.Infof("Deleting HNS endpoint name: %s ID: %s", endpointName, hnsEndpoint.Id)
+	return nb.deleteHNSEndpoint(hnsEndpoint.Id)
+}
+
+// waitForDHCPLease waits until the endpoint obtains an address from DHCP and returns the lease.
+func (nb *BridgeBuilder) waitForDHCPLease(ep *Endpoint) (*dhcp.Lease, error) {
+	var infraContainerID string
+	if !ep.ManagedNamespace {
+		var err error
+		_, infraContainerID, err = nb.getInfraContainerID(ep)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
+	deadline := time.Now().Add(dhcpLeaseTimeout)
+
+	for {
+		hnsEndpoint, err := nb.client().GetHNSEndpointByName(endpointName)
+		if err != nil {
+			return nil, err
+		}
+
+		if hnsEndpoint.IPAddress != nil && !hnsEndpoint.IPAddress.IsUnspecified() {
+			lease := &dhcp.Lease{
+				Address: &net.IPNet{
+					IP:   hnsEndpoint.IPAddress,
+					Mask: net.CIDRMask(int(hnsEndpoint.PrefixLength), 8*len(hnsEndpoint.IPAddress)),
+				},
+				Router:     net.ParseIP(hnsEndpoint.GatewayAddress),
+				DomainName: hnsEndpoint.DNSSuffix,
+			}
+			if hnsEndpoint.DNSServerList != "" {
+				lease.DNSServers = strings.Split(hnsEndpoint.DNSServerList, ",")
+			}
+			log.Infof("HNS endpoint %s obtained DHCP lease %+v.", endpointName, lease)
+			return lease, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for DHCP lease on HNS endpoint %s", endpointName)
+		}
+		time.Sleep(dhcpPollInterval)
+	}
+}
+
+// createHNSEndpoint creates an HNS endpoint for a container endpoint.
+func (nb *BridgeBuilder) createHNSEndpoint(
+	nw *Network, ep *Endpoint, endpointName string) (*hcsshim.HNSEndpoint, error) {
+
+	// Encode the endpoint request.
+	buf, err := json.Marshal(nb.newHNSEndpoint(nw, ep, endpointName))
+	if err != nil {
+		return nil, err
+	}
+	hnsRequest := string(buf)
+
+	// Create the HNS endpoint.
+	log.Infof("Creating HNS endpoint: %+v", hnsRequest)
+	hnsResponse, err := nb.client().HNSEndpointRequest("POST", "", hnsRequest)
+	if err != nil {
+		log.Errorf("Failed to create HNS endpoint: %v.", err)
+		return nil, err
+	}
+
+	log.Infof("Received HNS endpoint response: %+v.", hnsResponse)
+
+	// Stamp the HNS endpoint, or delete it as it could never be deleted otherwise.
+	err = nb.stampHNSObject(hnsResponse.Id, ep.OwnerID)
+	if err != nil {
+		log.Errorf("Failed to stamp HNS endpoint: %v.", err)
+		nb.deleteHNSEndpoint(hnsResponse.Id)
+		return nil, err
+	}
+
+	return hnsResponse, nil
+}
+
+// deleteHNSEndpoint deletes the HNS endpoint with the given ID and its stamp.
+func (nb *BridgeBuilder) deleteHNSEndpoint(id string) error {
+	_, err := nb.client().HNSEndpointRequest("DELETE", id, "")
+	if err != nil {
+		log.Errorf("Failed to delete HNS endpoint: %v.", err)
+		return err
+	}
+	nb.unstampHNSObject(id)
+
+	return nil
+}
+
+// newHNSNetwork returns the HNS network definition for a container network.
+func (nb *BridgeBuilder) newHNSNetwork(nw *Network) *hcsshim.HNSNetwork {
+	hnsNetwork := &hcsshim.HNSNetwork{
+		Name:               nb.generateHNSNetworkName(nw),
+		Type:               hnsL2Bridge,
+		NetworkAdapterName: nw.SharedENI.GetLinkName(),
+	}
+
+	// Endpoints on networks without subnets obtain their addresses from DHCP.
+	if !nw.DHCP {
+		hnsNetwork.Subnets = []hcsshim.Subnet{
+			{
+				AddressPrefix:  vpc.GetSubnetPrefix(nw.ENIIPAddress).String(),
+				GatewayAddress: nw.GatewayIPAddress.String(),
+			},
+		}
+	}
+
+	return hnsNetwork
+}
+
+// newHNSEndpoint returns the HNS endpoint request, including policies, for a container endpoint.
+func (nb *BridgeBuilder) newHNSEndpoint(nw *Network, ep *Endpoint, endpointName string) *hnsEndpointRequest {
+	hnsEndpoint := &hcsshim.HNSEndpoint{
 		Name:               endpointName,
 		VirtualNetworkName: nb.generateHNSNetworkName(nw),
 		DNSSuffix:          strings.Join(nw.DNSSuffixSearchList, ","),
 		DNSServerList:      strings.Join(nw.DNSServers, ","),
 	}
 
-	// Set the endpoint IP address.
-	hnsEndpoint.IPAddress = ep.IPAddress.IP
-	pl, _ := ep.IPAddress.Mask.Size()
-	hnsEndpoint.PrefixLength = uint8(pl)
+	// Set the endpoint IP address, unless it is obtained from DHCP.
+	if ep.IPAddress != nil {
+		hnsEndpoint.IPAddress = ep.IPAddress.IP
+		pl, _ := ep.IPAddress.Mask.Size()
+		hnsEndpoint.PrefixLength = uint8(pl)
+	}
+
+	// Block direct traffic to and from other containers on the same host, unless both
+	// endpoints opted in to east-west traffic.
+	if ep.EastWestIsolation && !ep.EastWestOptIn {
+		hnsEndpoint.DisableICC = true
+	}
 
 	// SNAT endpoint traffic to ENI primary IP address...
 	var snatExceptions []string
@@ -186,147 +618,189 @@ func (nb *BridgeBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
 		// ...or the destination is a service endpoint.
 		snatExceptions = append(snatExceptions, nw.ServiceCIDR)
 	}
+	for _, prefix := range nw.ExtraPrefixes {
+		// ...or the destination is in a peered VPC or transit gateway network, which is routed
+		// via the ENI gateway with the endpoint's own address.
+		snatExceptions = append(snatExceptions, prefix.String())
+	}
+	for _, prefix := range ep.NATExceptions {
+		// ...or the destination is excluded by the namespace defaults.
+		snatExceptions = append(snatExceptions, prefix.String())
+	}
+
+	var acls []hcsshim.ACLPolicy
+	if ep.Policy != nil {
+		acls = policy.ACLPolicies(ep.Policy)
+	}
+
+	// Block traffic leaving the endpoint from source addresses other than its own. HNS blocks
+	// traffic that matches no ACL, so endpoints without a policy allow all other traffic. MAC
+	// address spoofing is already disabled on the switch ports of container endpoints.
+	if ep.AntiSpoofing && ep.IPAddress != nil {
+		if acls == nil {
+			acls = policy.ACLPolicies(&policy.Document{DefaultAction: policy.ActionAllow})
+		}
+		acls = append(acls, nb.antiSpoofingACL(ep.IPAddress.IP))
+	}
+
+	// Size the policy list for the SNAT, route, QoS and ACL policies up front.
+	request := &hnsEndpointRequest{
+		HNSEndpoint: hnsEndpoint,
+		Policies:    make([]interface{}, 0, 5+len(acls)),
+	}
 
-	err = nb.addEndpointPolicy(
-		hnsEndpoint,
-		hcsshim.OutboundNatPolicy{
+	request.Policies = append(request.Policies,
+		&hcsshim.OutboundNatPolicy{
 			Policy: hcsshim.Policy{Type: hcsshim.OutboundNat},
 			// Implicit VIP: nw.ENIIPAddress.IP.String(),
 			Exceptions: snatExceptions,
 		})
-	if err != nil {
-		log.Errorf("Failed to add endpoint SNAT policy: %v.", err)
-		return err
-	}
 
 	// Route traffic sent to service endpoints to the host. The load balancer running
 	// in the host network namespace then forwards traffic to its final destination.
 	if nw.ServiceCIDR != "" {
-		// Set route policy for service subnet.
-		// NextHop is implicitly the host.
-		err = nb.addEndpointPolicy(
-			hnsEndpoint,
-			hnsRoutePolicy{
+		request.Policies = append(request.Policies,
+			// Set route policy for service subnet.
+			// NextHop is implicitly the host.
+			&hnsRoutePolicy{
 				Policy:            hcsshim.Policy{Type: hcsshim.Route},
 				DestinationPrefix: nw.ServiceCIDR,
 				NeedEncap:         true,
-			})
-		if err != nil {
-			log.Errorf("Failed to add endpoint route policy for service subnet: %v.", err)
-			return err
-		}
-
-		// Set route policy for host primary IP address.
-		err = nb.addEndpointPolicy(
-			hnsEndpoint,
-			hnsRoutePolicy{
+			},
+			// Set route policy for host primary IP address.
+			&hnsRoutePolicy{
 				Policy:            hcsshim.Policy{Type: hcsshim.Route},
 				DestinationPrefix: nw.ENIIPAddress.IP.String() + "/32",
 				NeedEncap:         true,
 			})
-		if err != nil {
-			log.Errorf("Failed to add endpoint route policy for host: %v.", err)
-			return err
-		}
 	}
 
-	// Encode the endpoint request.
-	buf, err := json.Marshal(hnsEndpoint)
-	if err != nil {
-		return err
+	// Route traffic sent to the DNS proxy to the host, where the proxy is running.
+	if nw.DNSProxyAddress != nil {
+		request.Policies = append(request.Policies,
+			&hnsRoutePolicy{
+				Policy:            hcsshim.Policy{Type: hcsshim.Route},
+				DestinationPrefix: nw.DNSProxyAddress.String() + "/32",
+				NeedEncap:         true,
+			})
 	}
-	hnsRequest := string(buf)
 
-	// Create the HNS endpoint.
-	log.Infof("Creating HNS endpoint: %+v", hnsRequest)
-	hnsResponse, err := hcsshim.HNSEndpointRequest("POST", "", hnsRequest)
-	if err != nil {
-		log.Errorf("Failed to create HNS endpoint: %v.", err)
-		return err
+	// Cap the endpoint's egress bandwidth.
+	if ep.EgressRate != 0 {
+		request.Policies = append(request.Policies,
+			&hcsshim.QosPolicy{
+				Type:                            hcsshim.QOS,
+				MaximumOutgoingBandwidthInBytes: ep.EgressRate / 8,
+			})
 	}
 
-	log.Infof("Received HNS endpoint response: %+v.", hnsResponse)
-
-	// Attach the HNS endpoint to the container's network namespace.
-	err = nb.attachEndpoint(hnsResponse, ep.ContainerID)
-	if err != nil {
-		// Cleanup the failed endpoint.
-		log.Infof("Deleting the failed HNS endpoint %s.", hnsResponse.Id)
-		_, delErr := hcsshim.HNSEndpointRequest("DELETE", hnsResponse.Id, "")
-		if delErr != nil {
-			log.Errorf("Failed to delete HNS endpoint: %v.", delErr)
-		}
-
-		return err
+	// Enforce the network policy with endpoint ACLs.
+	for i := range acls {
+		request.Policies = append(request.Policies, &acls[i])
 	}
 
-	// Return network interface MAC address.
-	ep.MACAddress, _ = net.ParseMAC(hnsResponse.MacAddress)
-
-	return nil
+	return request
 }
 
-// DeleteEndpoint deletes an existing HNS endpoint.
-func (nb *BridgeBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
-	// Query the infrastructure container ID.
-	isInfraContainer, infraContainerID, err := nb.getInfraContainerID(ep)
-	if err != nil {
-		return err
+// antiSpoofingACL returns the HNS ACL policy blocking egress traffic from all source addresses
+// other than the given endpoint IP address. ACLs cannot match the complement of an address, so
+// the policy blocks the address blocks that remain after removing it from the address space.
+func (nb *BridgeBuilder) antiSpoofingACL(ipAddress net.IP) hcsshim.ACLPolicy {
+	bits := 8 * net.IPv6len
+	if vpc.IsIPv4(ipAddress) {
+		bits = 8 * net.IPv4len
+		ipAddress = ipAddress.To4()
 	}
+	all := net.IPNet{IP: make(net.IP, bits/8), Mask: net.CIDRMask(0, bits)}
+	host := net.IPNet{IP: ipAddress, Mask: net.CIDRMask(bits, bits)}
+
+	return hcsshim.ACLPolicy{
+		Type:           hcsshim.ACL,
+		Action:         hcsshim.Block,
+		Direction:      hcsshim.Out,
+		LocalAddresses: strings.Join(vpc.ExcludeCIDRs(all, []net.IPNet{host}), ","),
+		RuleType:       hcsshim.Switch,
+		Priority:       antiSpoofingACLPriority,
+	}
+}
 
-	// Find the HNS endpoint ID.
-	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
-	hnsEndpoint, err := hcsshim.GetHNSEndpointByName(endpointName)
-	if err != nil {
+// addFirewallRules replaces the host firewall rule group of an endpoint. Endpoints shared by the
+// containers of a pod are configured only once, for the infrastructure container.
+func (nb *BridgeBuilder) addFirewallRules(ep *Endpoint) error {
+	endpointName, ok, err := nb.firewallEndpointName(ep)
+	if err != nil || !ok {
 		return err
 	}
 
-	// Detach the HNS endpoint from the container's network namespace.
-	log.Infof("Detaching HNS endpoint %s from container %s netns.", hnsEndpoint.Id, ep.ContainerID)
-	err = hcsshim.HotDetachEndpoint(ep.ContainerID, hnsEndpoint.Id)
-	if err != nil && err != hcsshim.ErrComputeSystemDoesNotExist {
+	rules := policy.FirewallRules(ep.FirewallRules, fmt.Sprintf(vNICNameFormat, endpointName))
+	return firewall.ReplaceGroup(fmt.Sprintf(firewallGroupFormat, endpointName), rules)
+}
+
+// removeFirewallRules removes the host firewall rule group of an endpoint.
+func (nb *BridgeBuilder) removeFirewallRules(ep *Endpoint) error {
+	endpointName, ok, err := nb.firewallEndpointName(ep)
+	if err != nil || !ok {
 		return err
 	}
 
-	// The rest of the delete logic applies to infrastructure container only.
-	if !isInfraContainer {
-		return nil
+	return firewall.RemoveGroup(fmt.Sprintf(firewallGroupFormat, endpointName))
+}
+
+// firewallEndpointName returns the name of the HNS endpoint owning the host firewall rules of
+// an endpoint, and whether the endpoint owns them.
+func (nb *BridgeBuilder) firewallEndpointName(ep *Endpoint) (string, bool, error) {
+	if ep.ManagedNamespace {
+		return nb.generateHNSEndpointName(ep, ""), true, nil
 	}
 
-	// Delete the HNS endpoint.
-	log.Infof("Deleting HNS endpoint name: %s ID: %s", endpointName, hnsEndpoint.Id)
-	_, err = hcsshim.HNSEndpointRequest("DELETE", hnsEndpoint.Id, "")
+	isInfraContainer, infraContainerID, err := nb.getInfraContainerID(ep)
 	if err != nil {
-		log.Errorf("Failed to delete HNS endpoint: %v.", err)
+		return "", false, err
 	}
 
-	return err
+	return nb.generateHNSEndpointName(ep, infraContainerID), isInfraContainer, nil
 }
 
-// attachEndpoint attaches an HNS endpoint to a container's network namespace.
-func (nb *BridgeBuilder) attachEndpoint(ep *hcsshim.HNSEndpoint, containerID string) error {
-	log.Infof("Attaching HNS endpoint %s to container %s.", ep.Id, containerID)
-	err := hcsshim.HotAttachEndpoint(containerID, ep.Id)
+// attachEndpoint attaches an HNS endpoint to a container's network namespace, or adds it to the
+// namespace created by the container runtime.
+func (nb *BridgeBuilder) attachEndpoint(hnsEndpoint *hcsshim.HNSEndpoint, ep *Endpoint) error {
+	var err error
+	if namespaceID := runtimeNamespaceID(ep); namespaceID != "" {
+		log.Infof("Adding HNS endpoint %s to namespace %s.", hnsEndpoint.Id, namespaceID)
+		err = nb.client().AddNamespaceEndpoint(namespaceID, hnsEndpoint.Id)
+	} else {
+		containerID := nb.attachTargetID(ep)
+		log.Infof("Attaching HNS endpoint %s to container %s.", hnsEndpoint.Id, containerID)
+		err = nb.client().HotAttachEndpoint(containerID, hnsEndpoint.Id)
+	}
 	if err != nil {
 		// Attach can fail if the container is no longer running and/or its network namespace
 		// has been cleaned up.
-		log.Errorf("Failed to attach HNS endpoint %s: %v.", ep.Id, err)
+		log.Errorf("Failed to attach HNS endpoint %s: %v.", hnsEndpoint.Id, err)
 	}
 
 	return err
 }
 
-// addEndpointPolicy adds a policy to an HNS endpoint.
-func (nb *BridgeBuilder) addEndpointPolicy(ep *hcsshim.HNSEndpoint, policy interface{}) error {
-	buf, err := json.Marshal(policy)
-	if err != nil {
-		log.Errorf("Failed to encode policy: %v.", err)
-		return err
+// runtimeNamespaceID returns the ID of the HCN namespace of the endpoint if it was created by the
+// container runtime. containerd creates the namespace of each pod sandbox and passes its GUID as
+// the netns, whereas dockershim passes the infrastructure container instead.
+func runtimeNamespaceID(ep *Endpoint) string {
+	if namespaceGUIDRegexp.MatchString(ep.NetNSName) {
+		return ep.NetNSName
 	}
 
-	ep.Policies = append(ep.Policies, buf)
+	return ""
+}
 
-	return nil
+// attachTargetID returns the ID of the compute system that an endpoint is attached to, which is
+// the utility VM for Hyper-V isolated sandboxes and the container otherwise.
+func (nb *BridgeBuilder) attachTargetID(ep *Endpoint) string {
+	if ep.SandboxIsolation == config.SandboxIsolationHyperV && ep.UtilityVMID != "" {
+		return ep.UtilityVMID
+	}
+
+	return ep.ContainerID
 }
 
 // getInfraContainerID returns the infrastructure container ID for the given endpoint.
@@ -351,6 +825,14 @@ func (nb *BridgeBuilder) getInfraContainerID(ep *Endpoint) (bool, string, error)
 		// This is the first, i.e. infrastructure, container in the group.
 		isInfraContainer = true
 		infraContainerID = ep.ContainerID
+	} else if runtimeNamespaceID(ep) != "" {
+		// The container runtime created the namespace of the pod sandbox, and calls the plugin
+		// once for the sandbox. Workload containers join the namespace without the plugin.
+		isInfraContainer = true
+		infraContainerID = ep.ContainerID
+		if ep.SandboxID != "" {
+			infraContainerID = ep.SandboxID
+		}
 	} else if strings.HasPrefix(ep.NetNSName, containerPrefix) {
 		// This is a workload container sharing the netns of a previously created infra container.
 		isInfraContainer = false
@@ -365,11 +847,17 @@ func (nb *BridgeBuilder) getInfraContainerID(ep *Endpoint) (bool, string, error)
 	return isInfraContainer, infraContainerID, nil
 }
 
+// CheckStatus returns an error if the Windows Host Networking Service is not reachable, or if its
+// version is not supported.
+func (nb *BridgeBuilder) CheckStatus() error {
+	return nb.checkHNSVersion()
+}
+
 // checkHNSVersion returns whether the Windows Host Networking Service version is supported.
 func (nb *BridgeBuilder) checkHNSVersion() error {
-	hnsGlobals, err := hcsshim.GetHNSGlobals()
+	hnsGlobals, err := nb.client().GetHNSGlobals()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to query HNS: %v", err)
 	}
 
 	hnsVersion := hnsGlobals.Version
@@ -389,7 +877,7 @@ func (nb *BridgeBuilder) checkHNSVersion() error {
 func (nb *BridgeBuilder) generateHNSNetworkName(nw *Network) string {
 	// Use the MAC address of the shared ENI as the deterministic unique identifier.
 	id := strings.Replace(nw.SharedENI.GetMACAddress().String(), ":", "", -1)
-	return fmt.Sprintf(hnsNetworkNameFormat, nw.Name, id)
+	return fmt.Sprintf(hnsNetworkNameFormat, nw.Name, id) + owner.NameSuffix(nw.OwnerID)
 }
 
 // generateHNSEndpointName generates a deterministic unique name for an HNS endpoint.
@@ -399,5 +887,35 @@ func (nb *BridgeBuilder) generateHNSEndpointName(ep *Endpoint, id string) string
 		id = ep.ContainerID
 	}
 
-	return fmt.Sprintf(hnsEndpointNameFormat, id)
+	return fmt.Sprintf(hnsEndpointNameFormat, id) + owner.NameSuffix(ep.OwnerID)
+}
+
+// EndpointName returns the name of the HNS endpoint of the given endpoint.
+func EndpointName(ep *Endpoint) string {
+	nb := &BridgeBuilder{}
+	_, infraContainerID, err := nb.getInfraContainerID(ep)
+	if err != nil {
+		infraContainerID = ""
+	}
+	return nb.generateHNSEndpointName(ep, infraContainerID)
+}
+
+// client returns the HNS client used by the builder.
+func (nb *BridgeBuilder) client() hnsClient {
+	if nb.hns == nil {
+		var cachePath, latencyPath string
+		if nb.stateDir != "" {
+			cachePath = filepath.Join(nb.stateDir, HNSCacheFileName)
+			latencyPath = filepath.Join(nb.stateDir, HNSLatencyFileName)
+		}
+
+		latencies := newHNSLatencyTracker(latencyPath)
+		watchdog := newWatchdogHNSClient(hcsshimClient{})
+		watchdog.latencies = latencies
+		retrying := newRetryingHNSClient(watchdog)
+		retrying.latencies = latencies
+		nb.hns = newCachingHNSClient(retrying, cachePath)
+	}
+
+	return nb.hns
 }
@@ -0,0 +1,626 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	"github.com/Microsoft/hcsshim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHNSRequest records a single request made to the fake HNS.
+type fakeHNSRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeHNS is an in-process fake of the HNS API that records requests and can simulate
+// failures and latency.
+type fakeHNS struct {
+	mu        sync.Mutex
+	version   hcsshim.HNSVersion
+	networks  map[string]*hcsshim.HNSNetwork
+	endpoints map[string]*hcsshim.HNSEndpoint
+	attached  map[string]string
+	// namespaces maps namespace IDs to the IDs of the endpoints in them.
+	namespaces map[string][]string
+	// dhcpAddress is assigned to endpoints when they are attached, if set.
+	dhcpAddress *net.IPNet
+	requests   []fakeHNSRequest
+	failures   map[string]error
+	latency    time.Duration
+	nextID     int
+}
+
+// newFakeHNS creates a new fakeHNS object.
+func newFakeHNS() *fakeHNS {
+	return &fakeHNS{
+		version:    hcsshim.HNSVersion1803,
+		networks:   make(map[string]*hcsshim.HNSNetwork),
+		endpoints:  make(map[string]*hcsshim.HNSEndpoint),
+		attached:   make(map[string]string),
+		namespaces: make(map[string][]string),
+		failures:   make(map[string]error),
+	}
+}
+
+// enter simulates latency and injected failures for the given API call.
+func (f *fakeHNS) enter(call string, method string, path string, body string) error {
+	time.Sleep(f.latency)
+	f.requests = append(f.requests, fakeHNSRequest{Method: call + " " + method, Path: path, Body: body})
+	return f.failures[call]
+}
+
+func (f *fakeHNS) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("GetHNSGlobals", "GET", "", ""); err != nil {
+		return nil, err
+	}
+	return &hcsshim.HNSGlobals{Version: f.version}, nil
+}
+
+func (f *fakeHNS) GetHNSNetworkByName(networkName string) (*hcsshim.HNSNetwork, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("GetHNSNetworkByName", "GET", networkName, ""); err != nil {
+		return nil, err
+	}
+	network, ok := f.networks[networkName]
+	if !ok {
+		return nil, hcsshim.NetworkNotFoundError{NetworkName: networkName}
+	}
+	return network, nil
+}
+
+func (f *fakeHNS) HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("HNSNetworkRequest", method, path, request); err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "POST":
+		var network hcsshim.HNSNetwork
+		if err := json.Unmarshal([]byte(request), &network); err != nil {
+			return nil, err
+		}
+		f.nextID++
+		network.Id = fmt.Sprintf("network-%d", f.nextID)
+		f.networks[network.Name] = &network
+		return &network, nil
+	case "DELETE":
+		for name, network := range f.networks {
+			if network.Id == path {
+				delete(f.networks, name)
+				return network, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("network %s not found", path)
+}
+
+func (f *fakeHNS) GetHNSEndpointByName(endpointName string) (*hcsshim.HNSEndpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("GetHNSEndpointByName", "GET", endpointName, ""); err != nil {
+		return nil, err
+	}
+	endpoint, ok := f.endpoints[endpointName]
+	if !ok {
+		return nil, hcsshim.EndpointNotFoundError{EndpointName: endpointName}
+	}
+	return endpoint, nil
+}
+
+func (f *fakeHNS) HNSEndpointRequest(method, path, request string) (*hcsshim.HNSEndpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("HNSEndpointRequest", method, path, request); err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "POST":
+		var endpoint hcsshim.HNSEndpoint
+		if err := json.Unmarshal([]byte(request), &endpoint); err != nil {
+			return nil, err
+		}
+		f.nextID++
+		endpoint.Id = fmt.Sprintf("endpoint-%d", f.nextID)
+		endpoint.MacAddress = fmt.Sprintf("00-15-5d-00-00-%02x", f.nextID)
+		f.endpoints[endpoint.Name] = &endpoint
+		return &endpoint, nil
+	case "DELETE":
+		for name, endpoint := range f.endpoints {
+			if endpoint.Id == path {
+				delete(f.endpoints, name)
+				return endpoint, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("endpoint %s not found", path)
+}
+
+func (f *fakeHNS) HotAttachEndpoint(containerID string, endpointID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("HotAttachEndpoint", "POST", containerID, endpointID); err != nil {
+		return err
+	}
+	f.attached[containerID] = endpointID
+	f.assignDHCPAddress(endpointID)
+	return nil
+}
+
+func (f *fakeHNS) HotDetachEndpoint(containerID string, endpointID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("HotDetachEndpoint", "DELETE", containerID, endpointID); err != nil {
+		return err
+	}
+	if _, ok := f.attached[containerID]; !ok {
+		return hcsshim.ErrComputeSystemDoesNotExist
+	}
+	delete(f.attached, containerID)
+	return nil
+}
+
+func (f *fakeHNS) CreateNamespace() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("CreateNamespace", "POST", "", ""); err != nil {
+		return "", err
+	}
+	f.nextID++
+	namespaceID := fmt.Sprintf("namespace-%d", f.nextID)
+	f.namespaces[namespaceID] = nil
+	return namespaceID, nil
+}
+
+func (f *fakeHNS) DeleteNamespace(namespaceID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("DeleteNamespace", "DELETE", namespaceID, ""); err != nil {
+		return err
+	}
+	if _, ok := f.namespaces[namespaceID]; !ok {
+		return fmt.Errorf("namespace %s not found", namespaceID)
+	}
+	delete(f.namespaces, namespaceID)
+	return nil
+}
+
+func (f *fakeHNS) AddNamespaceEndpoint(namespaceID string, endpointID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("AddNamespaceEndpoint", "POST", namespaceID, endpointID); err != nil {
+		return err
+	}
+	f.namespaces[namespaceID] = append(f.namespaces[namespaceID], endpointID)
+	f.assignDHCPAddress(endpointID)
+	return nil
+}
+
+// assignDHCPAddress simulates an endpoint obtaining an address from DHCP.
+func (f *fakeHNS) assignDHCPAddress(endpointID string) {
+	if f.dhcpAddress == nil {
+		return
+	}
+	for _, endpoint := range f.endpoints {
+		if endpoint.Id == endpointID {
+			endpoint.IPAddress = f.dhcpAddress.IP
+			prefixLength, _ := f.dhcpAddress.Mask.Size()
+			endpoint.PrefixLength = uint8(prefixLength)
+			endpoint.GatewayAddress = "10.0.1.1"
+		}
+	}
+}
+
+func (f *fakeHNS) RemoveNamespaceEndpoint(namespaceID string, endpointID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("RemoveNamespaceEndpoint", "DELETE", namespaceID, endpointID); err != nil {
+		return err
+	}
+	var endpointIDs []string
+	for _, id := range f.namespaces[namespaceID] {
+		if id != endpointID {
+			endpointIDs = append(endpointIDs, id)
+		}
+	}
+	f.namespaces[namespaceID] = endpointIDs
+	return nil
+}
+
+func (f *fakeHNS) GetEndpointNamespace(endpointID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.enter("GetEndpointNamespace", "GET", endpointID, ""); err != nil {
+		return "", err
+	}
+	for namespaceID, endpointIDs := range f.namespaces {
+		for _, id := range endpointIDs {
+			if id == endpointID {
+				return namespaceID, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// countRequests returns the number of requests made with the given call and method.
+func (f *fakeHNS) countRequests(method string) int {
+	count := 0
+	for _, req := range f.requests {
+		if req.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// newTestNetwork returns a network and a builder wired to the given fake HNS.
+func newTestNetwork(t testing.TB, hns *fakeHNS) (*BridgeBuilder, *Network) {
+	macAddress, _ := net.ParseMAC("12:34:56:78:9a:bc")
+	sharedENI, err := eni.NewENI("Ethernet 2", macAddress)
+	require.NoError(t, err)
+
+	eniIPAddress, _ := vpc.GetIPAddressFromString("10.0.1.10/24")
+	nw := &Network{
+		Name:             "vpc",
+		SharedENI:        sharedENI,
+		ENIIPAddress:     eniIPAddress,
+		GatewayIPAddress: net.ParseIP("10.0.1.1"),
+		DNSServers:       []string{"10.0.0.2"},
+	}
+
+	return &BridgeBuilder{hns: hns}, nw
+}
+
+// newTestEndpoint returns an infrastructure container endpoint.
+func newTestEndpoint(containerID string) *Endpoint {
+	ipAddress, _ := vpc.GetIPAddressFromString("10.0.1.20/24")
+	return &Endpoint{
+		ContainerID: containerID,
+		NetNSName:   "none",
+		IPAddress:   ipAddress,
+	}
+}
+
+func TestAddCreatesNetworkAndEndpoint(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	network, ok := hns.networks["vpcbr123456789abc"]
+	require.True(t, ok)
+	assert.Equal(t, hnsL2Bridge, network.Type)
+	assert.Equal(t, "10.0.1.0/24", network.Subnets[0].AddressPrefix)
+
+	endpoint, ok := hns.endpoints["cid-container1"]
+	require.True(t, ok)
+	assert.Equal(t, "10.0.1.20", endpoint.IPAddress.String())
+	assert.Len(t, endpoint.Policies, 1)
+	assert.Equal(t, endpoint.Id, hns.attached["container1"])
+	assert.NotNil(t, ep.MACAddress)
+}
+
+func TestAddIsIdempotent(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, nb.FindOrCreateNetwork(nw))
+		require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+	}
+
+	assert.Equal(t, 1, hns.countRequests("HNSNetworkRequest POST"))
+	assert.Equal(t, 1, hns.countRequests("HNSEndpointRequest POST"))
+	assert.Equal(t, 1, hns.countRequests("HotAttachEndpoint POST"))
+}
+
+func TestAddWithServiceCIDRAddsRoutePolicies(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nw.ServiceCIDR = "10.100.0.0/16"
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+
+	assert.Len(t, hns.endpoints["cid-container1"].Policies, 3)
+}
+
+func TestAddFailsOnOldHNSVersion(t *testing.T) {
+	hns := newFakeHNS()
+	hns.version = hcsshim.HNSVersion{Major: 5, Minor: 0}
+	nb, nw := newTestNetwork(t, hns)
+
+	assert.Error(t, nb.FindOrCreateNetwork(nw))
+	assert.Empty(t, hns.networks)
+}
+
+func TestAddAttachFailureDeletesEndpoint(t *testing.T) {
+	hns := newFakeHNS()
+	hns.failures["HotAttachEndpoint"] = fmt.Errorf("container is not running")
+	nb, nw := newTestNetwork(t, hns)
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+	assert.Empty(t, hns.endpoints)
+}
+
+func TestAddWorkloadContainerWithoutInfraEndpointFails(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container2")
+	ep.NetNSName = "container:container1"
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, ep))
+}
+
+func TestAddToleratesLatency(t *testing.T) {
+	hns := newFakeHNS()
+	hns.latency = time.Millisecond
+	nb, nw := newTestNetwork(t, hns)
+
+	start := time.Now()
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+	assert.True(t, time.Since(start) >= time.Duration(len(hns.requests))*hns.latency)
+}
+
+func TestDelDetachesAndDeletesEndpoint(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+
+	assert.Empty(t, hns.endpoints)
+	assert.Empty(t, hns.attached)
+}
+
+func TestDelWorkloadContainerOnlyDetaches(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+
+	ep := newTestEndpoint("container2")
+	ep.NetNSName = "container:container1"
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+
+	assert.Len(t, hns.endpoints, 1)
+	assert.NotContains(t, hns.attached, "container2")
+}
+
+func TestDelStoppedContainerDeletesEndpoint(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	delete(hns.attached, "container1")
+
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+}
+
+func TestAddHyperVSandboxAttachesToUtilityVM(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.SandboxIsolation = config.SandboxIsolationHyperV
+	ep.UtilityVMID = "uvm1"
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	assert.Equal(t, hns.endpoints["cid-container1"].Id, hns.attached["uvm1"])
+	assert.NotContains(t, hns.attached, "container1")
+}
+
+func TestDelHyperVSandboxWithStoppingUtilityVMDeletesEndpoint(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.SandboxIsolation = config.SandboxIsolationHyperV
+	ep.UtilityVMID = "uvm1"
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	hns.failures["HotDetachEndpoint"] = hcsshim.ErrVmcomputeOperationInvalidState
+
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+}
+
+func TestAddMicroVMSandboxFails(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.SandboxIsolation = config.SandboxIsolationMicroVM
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+}
+
+func TestDeleteNetwork(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.DeleteNetwork(nw))
+	assert.Empty(t, hns.networks)
+	assert.Error(t, nb.DeleteNetwork(nw))
+}
+
+func TestAddManagedNamespaceCreatesNamespace(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.ManagedNamespace = true
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	endpoint, ok := hns.endpoints["cid-container1"]
+	require.True(t, ok)
+	require.NotEmpty(t, ep.NamespaceID)
+	assert.Equal(t, []string{endpoint.Id}, hns.namespaces[ep.NamespaceID])
+	assert.Empty(t, hns.attached)
+
+	// A duplicate ADD returns the same namespace.
+	dup := newTestEndpoint("container1")
+	dup.ManagedNamespace = true
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, dup))
+	assert.Equal(t, ep.NamespaceID, dup.NamespaceID)
+	assert.Len(t, hns.namespaces, 1)
+}
+
+func TestAddManagedNamespaceFailureDeletesEndpoint(t *testing.T) {
+	hns := newFakeHNS()
+	hns.failures["AddNamespaceEndpoint"] = fmt.Errorf("namespace is gone")
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.ManagedNamespace = true
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+	assert.Empty(t, hns.namespaces)
+	assert.Empty(t, ep.NamespaceID)
+}
+
+func TestDelManagedNamespaceDeletesNamespace(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.ManagedNamespace = true
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+
+	assert.Empty(t, hns.endpoints)
+	assert.Empty(t, hns.namespaces)
+	assert.Equal(t, 0, hns.countRequests("HotDetachEndpoint DELETE"))
+}
+
+func TestAddContainerdNamespaceAddsEndpointToNamespace(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.NetNSName = "9f3a2b1c-4d5e-6f70-8192-a3b4c5d6e7f8"
+	ep.SandboxID = "sandbox1"
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	endpoint, ok := hns.endpoints["cid-sandbox1"]
+	require.True(t, ok)
+	assert.Equal(t, []string{endpoint.Id}, hns.namespaces[ep.NetNSName])
+	assert.Equal(t, 0, hns.countRequests("HotAttachEndpoint POST"))
+
+	// The namespace is owned by the container runtime, and is not deleted.
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+	assert.Empty(t, hns.namespaces[ep.NetNSName])
+	assert.Equal(t, 0, hns.countRequests("HotDetachEndpoint DELETE"))
+	assert.Equal(t, 0, hns.countRequests("DeleteNamespace DELETE"))
+}
+
+func TestAddInvalidNetNSFails(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	ep.NetNSName = "9f3a2b1c-not-a-guid"
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+}
+
+func TestAddDHCPHarvestsLease(t *testing.T) {
+	hns := newFakeHNS()
+	hns.dhcpAddress, _ = vpc.GetIPAddressFromString("10.0.1.42/24")
+	nb, nw := newTestNetwork(t, hns)
+	nw.DHCP = true
+	ep := newTestEndpoint("container1")
+	ep.IPAddress = nil
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	network := hns.networks[nb.generateHNSNetworkName(nw)]
+	require.NotNil(t, network)
+	assert.Empty(t, network.Subnets)
+
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+	require.NotNil(t, ep.DHCPLease)
+	assert.Equal(t, "10.0.1.42/24", ep.IPAddress.String())
+	assert.Equal(t, "10.0.1.1", ep.DHCPLease.Router.String())
+}
+
+func TestAddDHCPTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { dhcpLeaseTimeout = timeout }(dhcpLeaseTimeout)
+	dhcpLeaseTimeout = 0
+
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nw.DHCP = true
+	ep := newTestEndpoint("container1")
+	ep.IPAddress = nil
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, ep))
+}
+
+func TestCheckStatus(t *testing.T) {
+	hns := newFakeHNS()
+	nb, _ := newTestNetwork(t, hns)
+	assert.NoError(t, nb.CheckStatus())
+
+	hns.version = hcsshim.HNSVersion{Major: 5, Minor: 0}
+	assert.Error(t, nb.CheckStatus())
+
+	hns.failures["GetHNSGlobals"] = fmt.Errorf("service not running")
+	err := nb.CheckStatus()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to query HNS")
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// ExplainBuilder implements the Builder interface by recording the sequence of operations
+// that would be performed to build container networks, with their resolved parameters,
+// without executing any of them. It is used to review the effect of configuration changes.
+type ExplainBuilder struct {
+	Operations []string
+}
+
+// FindOrCreateNetwork plans the creation of a container network.
+func (eb *ExplainBuilder) FindOrCreateNetwork(nw *Network) error {
+	if err := nw.CheckExcluded(); err != nil {
+		return err
+	}
+	return eb.planFindOrCreateNetwork(nw)
+}
+
+// DeleteNetwork plans the deletion of a container network.
+func (eb *ExplainBuilder) DeleteNetwork(nw *Network) error {
+	if err := nw.CheckExcluded(); err != nil {
+		return err
+	}
+	return eb.planDeleteNetwork(nw)
+}
+
+// FindOrCreateEndpoint plans the creation of a container endpoint.
+func (eb *ExplainBuilder) FindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
+	return eb.planFindOrCreateEndpoint(nw, ep)
+}
+
+// DeleteEndpoint plans the deletion of a container endpoint.
+func (eb *ExplainBuilder) DeleteEndpoint(nw *Network, ep *Endpoint) error {
+	return eb.planDeleteEndpoint(nw, ep)
+}
+
+// Print writes the planned operations to the given writer, one per line.
+func (eb *ExplainBuilder) Print(w io.Writer) error {
+	_, err := io.WriteString(w, strings.Join(eb.Operations, "\n")+"\n")
+	return err
+}
+
+// plan records and logs a planned operation.
+func (eb *ExplainBuilder) plan(format string, a ...interface{}) {
+	op := fmt.Sprintf(format, a...)
+	eb.Operations = append(eb.Operations, op)
+	log.Infof("Planned operation %d: %s.", len(eb.Operations), op)
+}
@@ -0,0 +1,313 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ebtables"
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+)
+
+// planFindOrCreateNetwork plans the operations performed by BridgeBuilder.FindOrCreateNetwork.
+func (eb *ExplainBuilder) planFindOrCreateNetwork(nw *Network) error {
+	bridgeName := fmt.Sprintf(bridgeNameFormat, nw.Name, nw.SharedENI.GetLinkIndex())
+	dummyName := fmt.Sprintf(dummyNameFormat, bridgeName)
+	eniLinkName := nw.SharedENI.GetLinkName()
+
+	if nw.BridgeNetNSPath != "" {
+		eb.plan("move link %s to netns %s", eniLinkName, nw.BridgeNetNSPath)
+	}
+
+	eb.plan("create bridge link %s type %s mtu %d if it does not exist",
+		bridgeName, nw.BridgeType, vpc.JumboFrameMTU)
+	eb.plan("set bridge link %s alias %s", bridgeName, owner.Alias(nw.OwnerID))
+	eb.plan("create dummy link %s mtu %d master %s", dummyName, vpc.JumboFrameMTU, bridgeName)
+	eb.plan("set bridge link %s address to dummy link %s address", bridgeName, dummyName)
+
+	if nw.BridgeType == config.BridgeTypeL2 {
+		broadcastMACAddr, _ := net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+		eb.plan("remove ip address %s from link %s", nw.ENIIPAddress, eniLinkName)
+		eb.plan("append ebtables rule nat %s %s", ebtables.PreRouting, &ebtables.Rule{
+			Protocol: "ARP",
+			In:       eniLinkName,
+			Match:    &ebtables.ARPMatch{Op: "Reply"},
+			Target:   &ebtables.DNATTarget{ToDst: broadcastMACAddr, Target: ebtables.Accept},
+		})
+		eb.plan("append ebtables rule nat %s %s", ebtables.PostRouting, &ebtables.Rule{
+			Out:     eniLinkName,
+			SrcType: "unicast",
+			Target: &ebtables.SNATTarget{
+				ToSrc:  nw.SharedENI.GetMACAddress(),
+				ARP:    true,
+				Target: ebtables.Accept,
+			},
+		})
+		eb.plan("set link %s mtu %d master %s up", eniLinkName, vpc.JumboFrameMTU, bridgeName)
+		eb.plan("set bridge link %s up", bridgeName)
+		eb.plan("assign ip address %s to bridge link %s", nw.ENIIPAddress, bridgeName)
+		eb.plan("add default route via %s dev %s", eb.gateway(nw), bridgeName)
+	} else if nw.IPFamily == vpc.IPFamilyIPv6 {
+		eb.plan("set bridge link %s up", bridgeName)
+		eb.plan("enable ipv6 router advertisements on link %s", eniLinkName)
+		eb.plan("enable ipv6 forwarding on links %s and %s", bridgeName, eniLinkName)
+	} else {
+		eb.plan("set bridge link %s up", bridgeName)
+		eb.plan("enable proxy arp on bridge link %s", bridgeName)
+		eb.plan("enable ipv4 forwarding on links %s and %s", bridgeName, eniLinkName)
+	}
+
+	return nil
+}
+
+// planDeleteNetwork plans the operations performed by BridgeBuilder.DeleteNetwork.
+func (eb *ExplainBuilder) planDeleteNetwork(nw *Network) error {
+	bridgeName := fmt.Sprintf(bridgeNameFormat, nw.Name, nw.SharedENI.GetLinkIndex())
+
+	if !nw.ForceDelete {
+		eb.plan("check bridge link %s alias is %s", bridgeName, owner.Alias(nw.OwnerID))
+	}
+	if nw.BridgeType == config.BridgeTypeL2 {
+		eb.plan("delete ebtables rules nat %s and %s for link %s",
+			ebtables.PreRouting, ebtables.PostRouting, nw.SharedENI.GetLinkName())
+	}
+	eb.plan("delete dummy link %s", fmt.Sprintf(dummyNameFormat, bridgeName))
+	eb.plan("delete bridge link %s", bridgeName)
+
+	return nil
+}
+
+// planFindOrCreateEndpoint plans the operations performed by BridgeBuilder.FindOrCreateEndpoint.
+func (eb *ExplainBuilder) planFindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
+	bridgeName := fmt.Sprintf(bridgeNameFormat, nw.Name, nw.SharedENI.GetLinkIndex())
+	vethLinkName := eb.vethLinkName(ep)
+
+	if ep.IfType == config.IfTypeIPVLAN {
+		eb.plan("create ipvlan link %s-2 mode l2 on link %s in netns %s",
+			vethLinkName, nw.SharedENI.GetLinkName(), ep.NetNSName)
+	} else {
+		eb.plan("create veth pair %s master %s and %s-2 in netns %s",
+			vethLinkName, bridgeName, vethLinkName, ep.NetNSName)
+		eb.plan("set veth link %s alias %s", vethLinkName, owner.Alias(ep.OwnerID))
+	}
+
+	if nw.DHCP {
+		return eb.planFindOrCreateDHCPEndpoint(nw, ep)
+	}
+
+	gatewayIPAddress := nw.GatewayIPAddress
+	epSubnetPrefix := vpc.GetSubnetPrefix(ep.IPAddress)
+	eniSubnetPrefix := vpc.GetSubnetPrefix(nw.ENIIPAddress)
+	sameSubnet := (epSubnetPrefix.String() == eniSubnetPrefix.String())
+
+	if ep.IfType == config.IfTypeIPVLAN {
+		if !sameSubnet {
+			return fmt.Errorf("IPVLAN endpoint address %s is not in the ENI subnet %s",
+				ep.IPAddress, eniSubnetPrefix)
+		}
+	} else if nw.BridgeType == config.BridgeTypeL3 || !sameSubnet {
+		dst := epSubnetPrefix
+		if sameSubnet {
+			dst = eb.hostPrefix(ep.IPAddress)
+		}
+		eb.plan("add route %s dev %s scope link", dst, bridgeName)
+
+		if gatewayIPAddress == nil {
+			gatewayIPAddress = eb.gateway(nw)
+		}
+	}
+
+	eb.plan("rename link %s-2 to %s type %s in netns %s", vethLinkName, ep.IfName, ep.IfType, ep.NetNSName)
+	eb.plan("assign ip address %s to link %s in netns %s", ep.IPAddress, ep.IfName, ep.NetNSName)
+	eb.plan("add default route via %s dev %s in netns %s", gatewayIPAddress, ep.IfName, ep.NetNSName)
+	if nw.NAT64Prefix != nil {
+		eb.plan("add route %s via %s dev %s in netns %s",
+			nw.NAT64Prefix, gatewayIPAddress, ep.IfName, ep.NetNSName)
+	}
+	for _, prefix := range nw.ExtraPrefixes {
+		eb.plan("add route %s via %s dev %s in netns %s",
+			prefix, gatewayIPAddress, ep.IfName, ep.NetNSName)
+	}
+	eb.planSysctls(ep)
+	eb.planEgressRate(ep)
+	eb.planDNSRedirect(nw, ep)
+	eb.planAntiSpoofing(ep, ep.IPAddress.IP.String())
+	eb.planEastWestIsolation(ep, "append")
+
+	if nw.BridgeType == config.BridgeTypeL2 {
+		eb.plan("append ebtables rule nat %s -p IPv4 -i %s --ip-dst %s -j dnat --to-dst <endpoint mac>",
+			ebtables.PreRouting, nw.SharedENI.GetLinkName(), ep.IPAddress.IP)
+	}
+
+	return nil
+}
+
+// planFindOrCreateDHCPEndpoint plans the configuration of an endpoint on a DHCP network, whose
+// address is known only after the lease is obtained. DHCP networks are layer2 bridged.
+func (eb *ExplainBuilder) planFindOrCreateDHCPEndpoint(nw *Network, ep *Endpoint) error {
+	vethLinkName := eb.vethLinkName(ep)
+
+	gatewayIPAddress := nw.GatewayIPAddress
+	if gatewayIPAddress == nil {
+		gatewayIPAddress = eb.gateway(nw)
+	}
+
+	eb.plan("request dhcp lease on link %s-2 in netns %s", vethLinkName, ep.NetNSName)
+	eb.plan("rename link %s-2 to %s type %s in netns %s", vethLinkName, ep.IfName, ep.IfType, ep.NetNSName)
+	eb.plan("assign leased ip address to link %s in netns %s", ep.IfName, ep.NetNSName)
+	eb.plan("add default route via %s dev %s in netns %s", gatewayIPAddress, ep.IfName, ep.NetNSName)
+	for _, prefix := range nw.ExtraPrefixes {
+		eb.plan("add route %s via %s dev %s in netns %s",
+			prefix, gatewayIPAddress, ep.IfName, ep.NetNSName)
+	}
+	eb.planSysctls(ep)
+	eb.planEgressRate(ep)
+	eb.planDNSRedirect(nw, ep)
+	eb.planAntiSpoofing(ep, "<leased address>")
+	eb.planEastWestIsolation(ep, "append")
+	eb.plan("append ebtables rule nat %s -p IPv4 -i %s --ip-dst <leased address> -j dnat --to-dst <endpoint mac>",
+		ebtables.PreRouting, nw.SharedENI.GetLinkName())
+
+	return nil
+}
+
+// planSysctls plans the kernel parameters set in the endpoint's network namespace.
+func (eb *ExplainBuilder) planSysctls(ep *Endpoint) {
+	keys := make([]string, 0, len(ep.Sysctls))
+	for key := range ep.Sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		eb.plan("set sysctl %s to %s in netns %s", key, ep.Sysctls[key], ep.NetNSName)
+	}
+}
+
+// planEgressRate plans the egress bandwidth cap of an endpoint.
+func (eb *ExplainBuilder) planEgressRate(ep *Endpoint) {
+	if ep.EgressRate == 0 {
+		return
+	}
+	eb.plan("add tbf qdisc rate %dbit to link %s in netns %s", ep.EgressRate, ep.IfName, ep.NetNSName)
+}
+
+// planDNSRedirect plans the redirection of an endpoint's DNS traffic to the DNS proxy.
+func (eb *ExplainBuilder) planDNSRedirect(nw *Network, ep *Endpoint) {
+	if nw.DNSProxyAddress == nil {
+		return
+	}
+	for _, protocol := range []string{"udp", "tcp"} {
+		eb.plan("append iptables rule nat OUTPUT -p %s --dport 53 ! -d %s -j DNAT --to-destination %s in netns %s",
+			protocol, nw.DNSProxyAddress, nw.DNSProxyAddress, ep.NetNSName)
+	}
+}
+
+// planAntiSpoofing plans the restriction of the frames sent by an endpoint to its source addresses.
+func (eb *ExplainBuilder) planAntiSpoofing(ep *Endpoint, ipAddress string) {
+	if !ep.AntiSpoofing {
+		return
+	}
+	chain := eb.antiSpoofingChain(ep)
+	eb.plan("create ebtables chain filter %s dropping frames not from <endpoint mac> and %s", chain, ipAddress)
+	for _, parent := range []ebtables.Chain{ebtables.Forward, ebtables.Input} {
+		eb.plan("append ebtables rule filter %s -i %s -j %s", parent, eb.vethLinkName(ep), chain)
+	}
+}
+
+// planEastWestIsolation plans the isolation of an endpoint from other endpoints on the same host.
+func (eb *ExplainBuilder) planEastWestIsolation(ep *Endpoint, command string) {
+	if !ep.EastWestIsolation {
+		return
+	}
+	cid := ep.ContainerID
+	if len(cid) > 8 {
+		cid = cid[:8]
+	}
+	for _, r := range eastWestRules(cid, ep.EastWestOptIn) {
+		eb.plan("%s ebtables rule %s %s %s", command, r.tableName, r.chain, r.rule)
+	}
+}
+
+// planDeleteEndpoint plans the operations performed by BridgeBuilder.DeleteEndpoint.
+func (eb *ExplainBuilder) planDeleteEndpoint(nw *Network, ep *Endpoint) error {
+	bridgeName := fmt.Sprintf(bridgeNameFormat, nw.Name, nw.SharedENI.GetLinkIndex())
+
+	if !ep.ForceDelete {
+		eb.plan("check veth link %s alias is %s", eb.vethLinkName(ep), owner.Alias(ep.OwnerID))
+	}
+	if ep.IfType == config.IfTypeIPVLAN {
+		eb.plan("delete ipvlan link %s in netns %s", ep.IfName, ep.NetNSName)
+		return nil
+	}
+	eb.plan("delete veth pair %s in netns %s", ep.IfName, ep.NetNSName)
+	if ep.AntiSpoofing {
+		for _, parent := range []ebtables.Chain{ebtables.Forward, ebtables.Input} {
+			eb.plan("delete ebtables rule filter %s -i %s -j %s", parent, eb.vethLinkName(ep), eb.antiSpoofingChain(ep))
+		}
+		eb.plan("delete ebtables chain filter %s", eb.antiSpoofingChain(ep))
+	}
+	eb.planEastWestIsolation(ep, "delete")
+
+	if ep.IPAddress == nil {
+		return nil
+	}
+
+	if nw.BridgeType == config.BridgeTypeL2 {
+		eb.plan("delete ebtables rule nat %s -p IPv4 -i %s --ip-dst %s -j dnat --to-dst <endpoint mac>",
+			ebtables.PreRouting, nw.SharedENI.GetLinkName(), ep.IPAddress.IP)
+	}
+
+	eb.plan("delete route %s dev %s scope link", eb.hostPrefix(ep.IPAddress), bridgeName)
+
+	return nil
+}
+
+// vethLinkName returns the name of the host side of an endpoint's veth pair.
+func (eb *ExplainBuilder) vethLinkName(ep *Endpoint) string {
+	return EndpointName(ep)
+}
+
+// antiSpoofingChain returns the name of the ebtables chain enforcing an endpoint's source addresses.
+func (eb *ExplainBuilder) antiSpoofingChain(ep *Endpoint) string {
+	cid := ep.ContainerID
+	if len(cid) > 8 {
+		cid = cid[:8]
+	}
+	return fmt.Sprintf(antiSpoofingChainFormat, cid)
+}
+
+// hostPrefix returns the host prefix for the given IP address.
+func (eb *ExplainBuilder) hostPrefix(ipAddress *net.IPNet) *net.IPNet {
+	_, maskSize := ipAddress.Mask.Size()
+	return &net.IPNet{IP: ipAddress.IP, Mask: net.CIDRMask(maskSize, maskSize)}
+}
+
+// gateway returns the default gateway of the ENI subnet.
+func (eb *ExplainBuilder) gateway(nw *Network) net.IP {
+	if nw.GatewayIPAddress != nil {
+		return nw.GatewayIPAddress
+	}
+
+	subnet, err := vpc.NewSubnet(vpc.GetSubnetPrefix(nw.ENIIPAddress))
+	if err != nil {
+		return nil
+	}
+	return subnet.Gateways[0]
+}
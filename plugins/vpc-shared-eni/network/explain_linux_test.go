@@ -0,0 +1,206 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNetwork(t *testing.T, bridgeType string) *Network {
+	sharedENI, err := eni.NewENI("eth1", nil)
+	require.NoError(t, err)
+
+	_, eniIPAddress, _ := net.ParseCIDR("10.0.1.10/24")
+	eniIPAddress.IP = net.ParseIP("10.0.1.10")
+
+	return &Network{
+		Name:         "vpc",
+		BridgeType:   bridgeType,
+		SharedENI:    sharedENI,
+		ENIIPAddress: eniIPAddress,
+	}
+}
+
+func newTestEndpoint(ipAddress string) *Endpoint {
+	ip, ipNet, _ := net.ParseCIDR(ipAddress)
+	ipNet.IP = ip
+
+	return &Endpoint{
+		ContainerID: "0123456789abcdef",
+		NetNSName:   "/var/run/netns/test",
+		IfName:      "eth0",
+		IfType:      config.IfTypeVETH,
+		IPAddress:   ipNet,
+	}
+}
+
+func TestExplainL2Network(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL2)
+
+	require.NoError(t, eb.FindOrCreateNetwork(nw))
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, newTestEndpoint("10.0.1.20/24")))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "create bridge link vpcbr0")
+	assert.Contains(t, plan, "remove ip address 10.0.1.10/24 from link eth1")
+	assert.Contains(t, plan, "add default route via 10.0.1.1 dev vpcbr0")
+	assert.Contains(t, plan, "create veth pair veth01234567")
+	assert.Contains(t, plan, "--ip-dst 10.0.1.20")
+	assert.NotContains(t, plan, "add route")
+}
+
+func TestExplainL3Endpoint(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, newTestEndpoint("10.0.1.20/24")))
+	require.NoError(t, eb.DeleteEndpoint(nw, newTestEndpoint("10.0.1.20/24")))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "add route 10.0.1.20/32 dev vpcbr0 scope link")
+	assert.Contains(t, plan, "delete route 10.0.1.20/32 dev vpcbr0 scope link")
+	assert.NotContains(t, plan, "ebtables")
+}
+
+func TestExplainIPVLANEndpoint(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	ep := newTestEndpoint("10.0.1.20/24")
+	ep.IfType = config.IfTypeIPVLAN
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, eb.DeleteEndpoint(nw, ep))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "create ipvlan link veth01234567-2 mode l2 on link eth1")
+	assert.Contains(t, plan, "delete ipvlan link eth0")
+	assert.NotContains(t, plan, "veth pair")
+	assert.NotContains(t, plan, "vpcbr0")
+
+	// IPVLAN endpoints are reachable in the ENI subnet only.
+	ep = newTestEndpoint("10.1.0.20/24")
+	ep.IfType = config.IfTypeIPVLAN
+	assert.Error(t, eb.FindOrCreateEndpoint(nw, ep))
+}
+
+func TestExplainSysctls(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	ep := newTestEndpoint("10.0.1.20/24")
+	ep.Sysctls = map[string]string{
+		"net.ipv4.tcp_keepalive_time":  "60",
+		"net.ipv4.conf.eth0.rp_filter": "2",
+	}
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, ep))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "set sysctl net.ipv4.conf.eth0.rp_filter to 2 in netns /var/run/netns/test\n"+
+		"set sysctl net.ipv4.tcp_keepalive_time to 60 in netns /var/run/netns/test")
+}
+
+func TestExplainAntiSpoofing(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	ep := newTestEndpoint("10.0.1.20/24")
+	ep.AntiSpoofing = true
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, eb.DeleteEndpoint(nw, ep))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "create ebtables chain filter vpc-as-01234567")
+	assert.Contains(t, plan, "append ebtables rule filter FORWARD -i veth01234567 -j vpc-as-01234567")
+	assert.Contains(t, plan, "append ebtables rule filter INPUT -i veth01234567 -j vpc-as-01234567")
+	assert.Contains(t, plan, "delete ebtables chain filter vpc-as-01234567")
+}
+
+func TestExplainEastWestIsolation(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	ep := newTestEndpoint("10.0.1.20/24")
+	ep.EastWestIsolation = true
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, ep))
+	ep.EastWestOptIn = true
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, ep))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "append ebtables rule nat PREROUTING -i veth01234567 -j mark --mark-or 0x300000")
+	assert.Contains(t, plan, "append ebtables rule filter FORWARD -o veth01234567 --mark 0x100000/0x100000 -j DROP")
+	assert.Contains(t, plan, "append ebtables rule filter OUTPUT -o veth01234567 --mark 0x100000/0x100000 -j DROP")
+	assert.Contains(t, plan, "append ebtables rule nat PREROUTING -i veth01234567 -j mark --mark-or 0x100000")
+	assert.Contains(t, plan, "append ebtables rule filter OUTPUT -o veth01234567 --mark 0x200000/0x200000 -j DROP")
+}
+
+func TestExplainOwnerStamp(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	ep := newTestEndpoint("10.0.1.20/24")
+	ep.OwnerID = "ecs"
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, ep))
+	require.NoError(t, eb.DeleteEndpoint(nw, ep))
+	require.NoError(t, eb.DeleteNetwork(nw))
+	ep.ForceDelete = true
+	require.NoError(t, eb.DeleteEndpoint(nw, ep))
+
+	assert.Contains(t, eb.Operations, "set veth link veth01234567 alias vpc-cni-owner:ecs")
+	assert.Contains(t, eb.Operations, "check veth link veth01234567 alias is vpc-cni-owner:ecs")
+	assert.Contains(t, eb.Operations, "check bridge link vpcbr0 alias is vpc-cni-owner:")
+	assert.Equal(t, 1, strings.Count(strings.Join(eb.Operations, "\n"), "check veth link"))
+}
+
+func TestExplainIPv6OnlyNetwork(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	nw.IPFamily = vpc.IPFamilyIPv6
+	nw.ENIIPAddress, _ = vpc.GetIPAddressFromString("2600:1f14:abc:de00::10/64")
+	_, nw.NAT64Prefix, _ = net.ParseCIDR(vpc.WellKnownNAT64Prefix)
+
+	require.NoError(t, eb.FindOrCreateNetwork(nw))
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, newTestEndpoint("2600:1f14:abc:de00::20/64")))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "enable ipv6 forwarding on links vpcbr0 and eth1")
+	assert.Contains(t, plan, "add route 2600:1f14:abc:de00::20/128 dev vpcbr0 scope link")
+	assert.Contains(t, plan, "add default route via 2600:1f14:abc:de00::1 dev eth0")
+	assert.Contains(t, plan, "add route 64:ff9b::/96 via 2600:1f14:abc:de00::1 dev eth0")
+	assert.NotContains(t, plan, "proxy arp")
+	assert.NotContains(t, plan, "ipv4")
+}
+
+func TestExplainDNSProxy(t *testing.T) {
+	eb := &ExplainBuilder{}
+	nw := newTestNetwork(t, config.BridgeTypeL3)
+	nw.DNSProxyAddress = net.ParseIP("169.254.20.10")
+
+	require.NoError(t, eb.FindOrCreateEndpoint(nw, newTestEndpoint("10.0.1.20/24")))
+
+	plan := strings.Join(eb.Operations, "\n")
+	assert.Contains(t, plan, "-p udp --dport 53 ! -d 169.254.20.10 -j DNAT --to-destination 169.254.20.10")
+	assert.Contains(t, plan, "-p tcp --dport 53 ! -d 169.254.20.10 -j DNAT --to-destination 169.254.20.10")
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+)
+
+// planFindOrCreateNetwork plans the operations performed by BridgeBuilder.FindOrCreateNetwork.
+func (eb *ExplainBuilder) planFindOrCreateNetwork(nw *Network) error {
+	nb := &BridgeBuilder{}
+
+	buf, err := json.Marshal(nb.newHNSNetwork(nw))
+	if err != nil {
+		return err
+	}
+
+	eb.plan("create HNS network %s if it does not exist: %s", nb.generateHNSNetworkName(nw), buf)
+
+	return nil
+}
+
+// planDeleteNetwork plans the operations performed by BridgeBuilder.DeleteNetwork.
+func (eb *ExplainBuilder) planDeleteNetwork(nw *Network) error {
+	nb := &BridgeBuilder{}
+
+	eb.plan("delete HNS network %s", nb.generateHNSNetworkName(nw))
+
+	return nil
+}
+
+// planFindOrCreateEndpoint plans the operations performed by BridgeBuilder.FindOrCreateEndpoint.
+func (eb *ExplainBuilder) planFindOrCreateEndpoint(nw *Network, ep *Endpoint) error {
+	nb := &BridgeBuilder{}
+
+	isInfraContainer, infraContainerID, err := nb.getInfraContainerID(ep)
+	if err != nil {
+		return err
+	}
+
+	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
+
+	if isInfraContainer {
+		buf, err := json.Marshal(nb.newHNSEndpoint(nw, ep, endpointName))
+		if err != nil {
+			return err
+		}
+
+		eb.plan("create HNS endpoint %s if it does not exist: %s", endpointName, buf)
+	}
+
+	if namespaceID := runtimeNamespaceID(ep); namespaceID != "" {
+		eb.plan("add HNS endpoint %s to namespace %s", endpointName, namespaceID)
+	} else {
+		eb.plan("attach HNS endpoint %s to container %s", endpointName, ep.ContainerID)
+	}
+	if nw.DHCP {
+		eb.plan("wait for HNS endpoint %s to obtain dhcp lease", endpointName)
+	}
+
+	return nil
+}
+
+// planDeleteEndpoint plans the operations performed by BridgeBuilder.DeleteEndpoint.
+func (eb *ExplainBuilder) planDeleteEndpoint(nw *Network, ep *Endpoint) error {
+	nb := &BridgeBuilder{}
+
+	isInfraContainer, infraContainerID, err := nb.getInfraContainerID(ep)
+	if err != nil {
+		return err
+	}
+
+	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
+
+	if namespaceID := runtimeNamespaceID(ep); namespaceID != "" {
+		eb.plan("remove HNS endpoint %s from namespace %s", endpointName, namespaceID)
+	} else {
+		eb.plan("detach HNS endpoint %s from container %s", endpointName, ep.ContainerID)
+	}
+	if isInfraContainer {
+		eb.plan("delete HNS endpoint %s", endpointName)
+	}
+
+	return nil
+}
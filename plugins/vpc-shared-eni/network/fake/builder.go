@@ -0,0 +1,223 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fake provides an in-process fake network builder for testing plugin command
+// handlers without touching the host network stack.
+package fake
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/dhcp"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+)
+
+const (
+	// Names of the recorded builder operations.
+	OpFindOrCreateNetwork  = "FindOrCreateNetwork"
+	OpDeleteNetwork        = "DeleteNetwork"
+	OpFindOrCreateEndpoint = "FindOrCreateEndpoint"
+	OpDeleteEndpoint       = "DeleteEndpoint"
+)
+
+// Call records a single call made to the fake builder.
+type Call struct {
+	Op          string
+	NetworkName string
+	ContainerID string
+}
+
+// Builder is a fake network.Builder that records calls, keeps track of the networks and
+// endpoints it created, and can simulate failures and latency.
+type Builder struct {
+	// Failures maps operation names to the errors they return.
+	Failures map[string]error
+	// Latency is the delay added to every operation.
+	Latency time.Duration
+	// DHCPLease is the lease obtained by endpoints on DHCP networks.
+	DHCPLease *dhcp.Lease
+
+	mu        sync.Mutex
+	calls     []Call
+	networks  map[string]bool
+	endpoints map[string]net.HardwareAddr
+	records   map[string]network.EndpointRecord
+	nextMAC   byte
+}
+
+// NewBuilder creates a new fake Builder object.
+func NewBuilder() *Builder {
+	return &Builder{
+		Failures:  make(map[string]error),
+		networks:  make(map[string]bool),
+		endpoints: make(map[string]net.HardwareAddr),
+		records:   make(map[string]network.EndpointRecord),
+	}
+}
+
+// Calls returns the calls made to the builder so far.
+func (nb *Builder) Calls() []Call {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	return append([]Call(nil), nb.calls...)
+}
+
+// HasNetwork returns whether the builder has a network with the given name.
+func (nb *Builder) HasNetwork(name string) bool {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	return nb.networks[name]
+}
+
+// HasEndpoint returns whether the builder has an endpoint for the given container.
+func (nb *Builder) HasEndpoint(containerID string) bool {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	_, ok := nb.endpoints[containerID]
+	return ok
+}
+
+// ListEndpoints lists the endpoints of all networks, like network.ListEndpoints.
+func (nb *Builder) ListEndpoints() ([]network.EndpointRecord, error) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	var records []network.EndpointRecord
+	for _, record := range nb.records {
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// FindOrCreateNetwork creates a fake network.
+func (nb *Builder) FindOrCreateNetwork(nw *network.Network) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	if err := nb.record(OpFindOrCreateNetwork, nw, nil); err != nil {
+		return err
+	}
+
+	if err := nw.CheckExcluded(); err != nil {
+		return err
+	}
+
+	nb.networks[nw.Name] = true
+	return nil
+}
+
+// DeleteNetwork deletes a fake network.
+func (nb *Builder) DeleteNetwork(nw *network.Network) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	if err := nb.record(OpDeleteNetwork, nw, nil); err != nil {
+		return err
+	}
+
+	if err := nw.CheckExcluded(); err != nil {
+		return err
+	}
+
+	if !nb.networks[nw.Name] {
+		return fmt.Errorf("network %s not found", nw.Name)
+	}
+
+	delete(nb.networks, nw.Name)
+	return nil
+}
+
+// FindOrCreateEndpoint creates a fake endpoint.
+func (nb *Builder) FindOrCreateEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	if err := nb.record(OpFindOrCreateEndpoint, nw, ep); err != nil {
+		return err
+	}
+
+	if !nb.networks[nw.Name] {
+		return fmt.Errorf("network %s not found", nw.Name)
+	}
+
+	macAddress, ok := nb.endpoints[ep.ContainerID]
+	if !ok {
+		nb.nextMAC++
+		macAddress = net.HardwareAddr{0x02, 0, 0, 0, 0, nb.nextMAC}
+		nb.endpoints[ep.ContainerID] = macAddress
+	}
+
+	ep.MACAddress = macAddress
+	switch ep.IfType {
+	case config.IfTypeTAP:
+		ep.TapDevice = "/dev/net/tun"
+	case config.IfTypeMacvtap:
+		ep.TapDevice = fmt.Sprintf("/dev/tap%d", macAddress[5])
+	}
+
+	nb.records[ep.ContainerID] = network.EndpointRecord{
+		NetworkName: nw.Name,
+		ContainerID: ep.ContainerID,
+		IPAddress:   ep.IPAddress,
+		OwnerID:     ep.OwnerID,
+	}
+
+	if nw.DHCP {
+		if nb.DHCPLease == nil {
+			return fmt.Errorf("no DHCP lease for container %s", ep.ContainerID)
+		}
+		ep.DHCPLease = nb.DHCPLease
+		ep.IPAddress = nb.DHCPLease.Address
+	}
+
+	return nil
+}
+
+// DeleteEndpoint deletes a fake endpoint.
+func (nb *Builder) DeleteEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	if err := nb.record(OpDeleteEndpoint, nw, ep); err != nil {
+		return err
+	}
+
+	if _, ok := nb.endpoints[ep.ContainerID]; !ok {
+		return fmt.Errorf("endpoint for container %s not found", ep.ContainerID)
+	}
+
+	delete(nb.endpoints, ep.ContainerID)
+	delete(nb.records, ep.ContainerID)
+	return nil
+}
+
+// record records a call, simulates latency and returns any injected failure.
+func (nb *Builder) record(op string, nw *network.Network, ep *network.Endpoint) error {
+	time.Sleep(nb.Latency)
+
+	call := Call{Op: op, NetworkName: nw.Name}
+	if ep != nil {
+		call.ContainerID = ep.ContainerID
+	}
+	nb.calls = append(nb.calls, call)
+
+	return nb.Failures[op]
+}
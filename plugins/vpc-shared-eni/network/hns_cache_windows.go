@@ -0,0 +1,245 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	"github.com/Microsoft/hcsshim"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// hnsCacheTTL is how long HNS lookups are cached. Objects changed by this client are
+	// updated in place, so the TTL only bounds staleness against changes made by others.
+	hnsCacheTTL = 10 * time.Second
+
+	// HNSCacheFileName is the name of the HNS lookup cache file shared by plugin invocations.
+	HNSCacheFileName = "hns-cache.json"
+)
+
+// hnsCacheEntries are the cached HNS networks and endpoints, keyed by name.
+type hnsCacheEntries struct {
+	Networks  map[string]hnsNetworkEntry  `json:"networks"`
+	Endpoints map[string]hnsEndpointEntry `json:"endpoints"`
+}
+
+// hnsNetworkEntry is a cached HNS network.
+type hnsNetworkEntry struct {
+	Network *hcsshim.HNSNetwork `json:"network"`
+	Expires time.Time           `json:"expires"`
+}
+
+// hnsEndpointEntry is a cached HNS endpoint.
+type hnsEndpointEntry struct {
+	Endpoint *hcsshim.HNSEndpoint `json:"endpoint"`
+	Expires  time.Time            `json:"expires"`
+}
+
+// cachingHNSClient wraps an hnsClient to avoid redundant HNS network and endpoint lookups on hot
+// paths. In daemon mode the cache lives in memory. In exec mode it is also kept in a state file,
+// so that it survives across plugin invocations.
+type cachingHNSClient struct {
+	hnsClient
+	path    string
+	mu      sync.Mutex
+	loaded  bool
+	entries hnsCacheEntries
+	now     func() time.Time
+}
+
+// newCachingHNSClient returns a caching HNS client. The cache is in memory only if path is empty.
+func newCachingHNSClient(client hnsClient, path string) *cachingHNSClient {
+	return &cachingHNSClient{
+		hnsClient: client,
+		path:      path,
+		now:       time.Now,
+	}
+}
+
+// GetHNSNetworkByName returns the HNS network with the given name.
+func (c *cachingHNSClient) GetHNSNetworkByName(networkName string) (*hcsshim.HNSNetwork, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	entry, ok := c.entries.Networks[networkName]
+	if ok && c.now().Before(entry.Expires) {
+		hnsNetwork := *entry.Network
+		return &hnsNetwork, nil
+	}
+
+	hnsNetwork, err := c.hnsClient.GetHNSNetworkByName(networkName)
+	c.update(func(entries *hnsCacheEntries) {
+		if err == nil {
+			entries.setNetwork(hnsNetwork, c.now())
+		} else {
+			delete(entries.Networks, networkName)
+		}
+	})
+
+	return hnsNetwork, err
+}
+
+// HNSNetworkRequest sends an HNS network request and updates the cache with its result.
+func (c *cachingHNSClient) HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hnsNetwork, err := c.hnsClient.HNSNetworkRequest(method, path, request)
+	c.update(func(entries *hnsCacheEntries) {
+		for name, entry := range entries.Networks {
+			if entry.Network.Id == path {
+				delete(entries.Networks, name)
+			}
+		}
+		if err == nil && method == "POST" {
+			entries.setNetwork(hnsNetwork, c.now())
+		}
+	})
+
+	return hnsNetwork, err
+}
+
+// GetHNSEndpointByName returns the HNS endpoint with the given name.
+func (c *cachingHNSClient) GetHNSEndpointByName(endpointName string) (*hcsshim.HNSEndpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	entry, ok := c.entries.Endpoints[endpointName]
+	if ok && c.now().Before(entry.Expires) {
+		hnsEndpoint := *entry.Endpoint
+		return &hnsEndpoint, nil
+	}
+
+	hnsEndpoint, err := c.hnsClient.GetHNSEndpointByName(endpointName)
+	c.update(func(entries *hnsCacheEntries) {
+		if err == nil {
+			entries.setEndpoint(hnsEndpoint, c.now())
+		} else {
+			delete(entries.Endpoints, endpointName)
+		}
+	})
+
+	return hnsEndpoint, err
+}
+
+// HNSEndpointRequest sends an HNS endpoint request and updates the cache with its result.
+func (c *cachingHNSClient) HNSEndpointRequest(method, path, request string) (*hcsshim.HNSEndpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hnsEndpoint, err := c.hnsClient.HNSEndpointRequest(method, path, request)
+	c.update(func(entries *hnsCacheEntries) {
+		for name, entry := range entries.Endpoints {
+			if entry.Endpoint.Id == path {
+				delete(entries.Endpoints, name)
+			}
+		}
+		if err == nil && method == "POST" {
+			entries.setEndpoint(hnsEndpoint, c.now())
+		}
+	})
+
+	return hnsEndpoint, err
+}
+
+// reset drops all cached lookups, in memory and in the cache file.
+func (c *cachingHNSClient) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	c.update(func(entries *hnsCacheEntries) {
+		*entries = hnsCacheEntries{}
+	})
+}
+
+// load loads the cache file once per process. Must be called with the lock held.
+func (c *cachingHNSClient) load() {
+	if c.loaded || c.path == "" {
+		return
+	}
+	c.loaded = true
+
+	_, err := state.ReadJSONFile(c.path, &c.entries)
+	if err != nil {
+		log.Errorf("Failed to load HNS cache, ignoring: %v.", err)
+		c.entries = hnsCacheEntries{}
+	}
+}
+
+// update applies the given change to the cache, and to the cache file in exec mode. Expired
+// entries are dropped. Must be called with the lock held.
+func (c *cachingHNSClient) update(change func(entries *hnsCacheEntries)) {
+	if c.path == "" {
+		change(&c.entries)
+		c.entries.expire(c.now())
+		return
+	}
+
+	var entries hnsCacheEntries
+	err := state.UpdateJSONFile(c.path, &entries, func() error {
+		change(&entries)
+		entries.expire(c.now())
+		return nil
+	})
+	if err != nil {
+		// The cache is an optimization only. Fall back to the in-memory copy.
+		log.Errorf("Failed to update HNS cache, ignoring: %v.", err)
+		entries = c.entries
+		change(&entries)
+		entries.expire(c.now())
+	}
+	c.entries = entries
+}
+
+// setNetwork caches an HNS network.
+func (entries *hnsCacheEntries) setNetwork(hnsNetwork *hcsshim.HNSNetwork, now time.Time) {
+	if entries.Networks == nil {
+		entries.Networks = make(map[string]hnsNetworkEntry)
+	}
+	entries.Networks[hnsNetwork.Name] = hnsNetworkEntry{Network: hnsNetwork, Expires: now.Add(hnsCacheTTL)}
+}
+
+// setEndpoint caches an HNS endpoint. Endpoints still waiting for a DHCP address are not cached,
+// so that polling for the lease reaches HNS.
+func (entries *hnsCacheEntries) setEndpoint(hnsEndpoint *hcsshim.HNSEndpoint, now time.Time) {
+	if hnsEndpoint.IPAddress == nil || hnsEndpoint.IPAddress.IsUnspecified() {
+		delete(entries.Endpoints, hnsEndpoint.Name)
+		return
+	}
+	if entries.Endpoints == nil {
+		entries.Endpoints = make(map[string]hnsEndpointEntry)
+	}
+	entries.Endpoints[hnsEndpoint.Name] = hnsEndpointEntry{Endpoint: hnsEndpoint, Expires: now.Add(hnsCacheTTL)}
+}
+
+// expire drops expired entries.
+func (entries *hnsCacheEntries) expire(now time.Time) {
+	for name, entry := range entries.Networks {
+		if !now.Before(entry.Expires) {
+			delete(entries.Networks, name)
+		}
+	}
+	for name, entry := range entries.Endpoints {
+		if !now.Before(entry.Expires) {
+			delete(entries.Endpoints, name)
+		}
+	}
+}
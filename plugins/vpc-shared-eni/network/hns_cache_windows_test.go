@@ -0,0 +1,71 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHNSCacheAvoidsRepeatedLookups(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nb.hns = newCachingHNSClient(hns, "")
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+
+	// Only the first lookups, which miss, reach HNS.
+	assert.Equal(t, 1, hns.countRequests("GetHNSNetworkByName GET"))
+	assert.Equal(t, 1, hns.countRequests("GetHNSEndpointByName GET"))
+
+	// Deleted objects are evicted.
+	require.NoError(t, nb.DeleteEndpoint(nw, newTestEndpoint("container1")))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+	assert.Equal(t, 2, hns.countRequests("HNSEndpointRequest POST"))
+}
+
+func TestHNSCacheFileIsSharedAndExpires(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hns-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, HNSCacheFileName)
+
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nb.hns = newCachingHNSClient(hns, path)
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+
+	// Another invocation finds the network in the cache file.
+	now := time.Now()
+	client := newCachingHNSClient(hns, path)
+	client.now = func() time.Time { return now }
+	_, err = client.GetHNSNetworkByName(nb.generateHNSNetworkName(nw))
+	require.NoError(t, err)
+	assert.Equal(t, 1, hns.countRequests("GetHNSNetworkByName GET"))
+
+	// Expired entries are looked up again.
+	now = now.Add(hnsCacheTTL)
+	_, err = client.GetHNSNetworkByName(nb.generateHNSNetworkName(nw))
+	require.NoError(t, err)
+	assert.Equal(t, 2, hns.countRequests("GetHNSNetworkByName GET"))
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// HNSLatencyFileName is the name of the file keeping the HNS call latencies observed by
+	// plugin invocations.
+	HNSLatencyFileName = "hns-latency.json"
+
+	// hnsLatencySamples is the number of most recent latencies kept per HNS call type.
+	hnsLatencySamples = 64
+
+	// hnsLatencyMinSamples is the number of latencies needed before ceilings adapt to them.
+	hnsLatencyMinSamples = 8
+
+	// hnsCeilingFactor is the multiple of the 99th percentile latency that an HNS call may take
+	// before it is abandoned.
+	hnsCeilingFactor = 4
+)
+
+// hnsLatencyTracker keeps rolling windows of HNS call latencies per call type, and derives the
+// ceilings and retry intervals of HNS calls from them. This avoids abandoning calls prematurely
+// on hosts where HNS is slow but healthy, and waiting long on hosts where it is broken. In
+// daemon mode the latencies live in memory. In exec mode they are also kept in a state file.
+type hnsLatencyTracker struct {
+	path    string
+	mu      sync.Mutex
+	loaded  bool
+	samples map[string][]time.Duration
+}
+
+// newHNSLatencyTracker returns an HNS latency tracker. Latencies are in memory only if path is
+// empty.
+func newHNSLatencyTracker(path string) *hnsLatencyTracker {
+	return &hnsLatencyTracker{path: path}
+}
+
+// record records the latency of a completed HNS call.
+func (t *hnsLatencyTracker) record(op string, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.load()
+	t.update(func(samples map[string][]time.Duration) {
+		window := append(samples[op], latency)
+		if len(window) > hnsLatencySamples {
+			window = window[len(window)-hnsLatencySamples:]
+		}
+		samples[op] = window
+	})
+}
+
+// ceiling returns the ceiling on the duration of HNS calls of the given type, within the
+// configured bounds. Until enough latencies are observed, the default ceiling is used.
+func (t *hnsLatencyTracker) ceiling(op string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.load()
+	ceiling := hnsCallCeiling
+	if window := t.samples[op]; len(window) >= hnsLatencyMinSamples {
+		ceiling = hnsCeilingFactor * percentile(window, 99)
+	}
+
+	min, max := getHNSCallTimeout()
+	if ceiling < min {
+		ceiling = min
+	}
+	if ceiling > max {
+		ceiling = max
+	}
+
+	return ceiling
+}
+
+// retryInterval returns the interval before the first retry of failed HNS calls of the given
+// type. Retrying sooner than a typical call completes only adds load to a slow HNS, so it is the
+// median latency if that is longer than the default. Otherwise it returns zero.
+func (t *hnsLatencyTracker) retryInterval(op string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.load()
+	window := t.samples[op]
+	if len(window) < hnsLatencyMinSamples {
+		return 0
+	}
+
+	interval := percentile(window, 50)
+	if interval <= backoff.DefaultInitialInterval {
+		return 0
+	}
+	if interval > backoff.DefaultMaxInterval {
+		interval = backoff.DefaultMaxInterval
+	}
+
+	return interval
+}
+
+// load loads the latency file once per process. Must be called with the lock held.
+func (t *hnsLatencyTracker) load() {
+	if t.loaded {
+		return
+	}
+	t.loaded = true
+	t.samples = make(map[string][]time.Duration)
+	if t.path == "" {
+		return
+	}
+
+	_, err := state.ReadJSONFile(t.path, &t.samples)
+	if err != nil {
+		log.Errorf("Failed to load HNS latencies, ignoring: %v.", err)
+		t.samples = make(map[string][]time.Duration)
+	}
+}
+
+// update applies the given change to the latencies, and to the latency file in exec mode, so
+// that latencies recorded by concurrent plugin invocations are kept. Must be called with the
+// lock held.
+func (t *hnsLatencyTracker) update(change func(samples map[string][]time.Duration)) {
+	if t.path == "" {
+		change(t.samples)
+		return
+	}
+
+	samples := make(map[string][]time.Duration)
+	err := state.UpdateJSONFile(t.path, &samples, func() error {
+		change(samples)
+		return nil
+	})
+	if err != nil {
+		// Latencies only tune timeouts. Fall back to the in-memory copy.
+		log.Errorf("Failed to update HNS latencies, ignoring: %v.", err)
+		samples = t.samples
+		change(samples)
+	}
+	t.samples = samples
+}
+
+// percentile returns the nearest-rank percentile p of the given latencies.
+func percentile(window []time.Duration, p int) time.Duration {
+	sorted := append([]time.Duration(nil), window...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[(len(sorted)-1)*p/100]
+}
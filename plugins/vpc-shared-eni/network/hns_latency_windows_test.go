@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHNSLatencyTrackerAdaptsCeiling(t *testing.T) {
+	latencies := newHNSLatencyTracker("")
+	op := "HNSEndpointRequest POST"
+
+	// The default ceiling applies until enough latencies are observed.
+	assert.Equal(t, hnsCallCeiling, latencies.ceiling(op))
+	assert.Zero(t, latencies.retryInterval(op))
+
+	for i := 0; i < hnsLatencySamples; i++ {
+		latencies.record(op, 10*time.Second)
+	}
+	assert.Equal(t, hnsCeilingFactor*10*time.Second, latencies.ceiling(op))
+	assert.Equal(t, backoff.DefaultMaxInterval, latencies.retryInterval(op))
+
+	// Ceilings are bounded.
+	for i := 0; i < hnsLatencySamples; i++ {
+		latencies.record(op, time.Millisecond)
+	}
+	assert.Equal(t, DefaultMinHNSCallTimeout, latencies.ceiling(op))
+	assert.Zero(t, latencies.retryInterval(op))
+
+	SetHNSCallTimeout(time.Second, 0)
+	defer SetHNSCallTimeout(DefaultMinHNSCallTimeout, 0)
+	assert.Equal(t, time.Second, latencies.ceiling(op))
+
+	// Call types are tracked separately.
+	assert.Equal(t, hnsCallCeiling, latencies.ceiling("GetHNSEndpointByName"))
+}
+
+func TestHNSLatencyTrackerFileIsShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hns-latency")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, HNSLatencyFileName)
+
+	op := "HNSNetworkRequest POST"
+	for i := 0; i < hnsLatencyMinSamples; i++ {
+		newHNSLatencyTracker(path).record(op, 20*time.Second)
+	}
+
+	assert.Equal(t, hnsCeilingFactor*20*time.Second, newHNSLatencyTracker(path).ceiling(op))
+}
+
+func TestHNSWatchdogRecordsLatencies(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	watchdog := newWatchdogHNSClient(hns)
+	watchdog.latencies = newHNSLatencyTracker("")
+	nb.hns = watchdog
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Len(t, watchdog.latencies.samples["GetHNSGlobals"], 1)
+	assert.Len(t, watchdog.latencies.samples["HNSNetworkRequest POST"], 1)
+}
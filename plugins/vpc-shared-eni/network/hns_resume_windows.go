@@ -0,0 +1,60 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"strings"
+
+	"github.com/Microsoft/hcsshim"
+	log "github.com/cihub/seelog"
+)
+
+// hnsCacheResetter is implemented by HNS clients that cache lookups.
+type hnsCacheResetter interface {
+	reset()
+}
+
+// resumeAfterHNSRestart calls fn, and calls it once more if it fails because an HNS object it
+// uses is gone. HNS loses or renumbers networks and endpoints when it restarts, for example
+// between creating the network and attaching the endpoint. Objects are found by deterministic
+// names, so the network is found or created again by name before fn is resumed.
+func (nb *BridgeBuilder) resumeAfterHNSRestart(nw *Network, op string, fn func() error) error {
+	err := fn()
+	if err == nil || !isHNSObjectNotFound(err) {
+		return err
+	}
+
+	log.Infof("Resuming %s after possible HNS restart: %v.", op, err)
+
+	// Lookups cached before the restart refer to objects that no longer exist.
+	if resetter, ok := nb.client().(hnsCacheResetter); ok {
+		resetter.reset()
+	}
+
+	err = nb.FindOrCreateNetwork(nw)
+	if err != nil {
+		return err
+	}
+
+	return fn()
+}
+
+// isHNSObjectNotFound returns whether an HNS error is caused by a missing network or endpoint.
+// Missing compute systems are not caused by HNS restarts, as containers survive them.
+func isHNSObjectNotFound(err error) bool {
+	if err == hcsshim.ErrComputeSystemDoesNotExist {
+		return false
+	}
+	return hcsshim.IsNotExist(err) || strings.Contains(err.Error(), "not found")
+}
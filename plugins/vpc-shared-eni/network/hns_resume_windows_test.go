@@ -0,0 +1,68 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"testing"
+
+	"github.com/Microsoft/hcsshim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restartingHNS is a fake HNS that restarts when an endpoint is first attached, losing all
+// networks and endpoints.
+type restartingHNS struct {
+	*fakeHNS
+	restarted bool
+}
+
+func (f *restartingHNS) HotAttachEndpoint(containerID string, endpointID string) error {
+	if !f.restarted {
+		f.restarted = true
+		f.mu.Lock()
+		f.networks = make(map[string]*hcsshim.HNSNetwork)
+		f.endpoints = make(map[string]*hcsshim.HNSEndpoint)
+		f.mu.Unlock()
+		return hcsshim.ErrElementNotFound
+	}
+	return f.fakeHNS.HotAttachEndpoint(containerID, endpointID)
+}
+
+func TestAddResumesAfterHNSRestart(t *testing.T) {
+	hns := &restartingHNS{fakeHNS: newFakeHNS()}
+	nb, nw := newTestNetwork(t, hns.fakeHNS)
+	nb.hns = newCachingHNSClient(hns, "")
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+
+	// The network and endpoint are created again by name, and the endpoint is attached.
+	assert.Equal(t, 2, hns.countRequests("HNSNetworkRequest POST"))
+	assert.Equal(t, 2, hns.countRequests("HNSEndpointRequest POST"))
+	assert.Len(t, hns.networks, 1)
+	endpoint, ok := hns.endpoints["cid-container1"]
+	require.True(t, ok)
+	assert.Equal(t, endpoint.Id, hns.attached["container1"])
+}
+
+func TestAddDoesNotResumeOtherFailures(t *testing.T) {
+	hns := newFakeHNS()
+	hns.failures["HotAttachEndpoint"] = hcsshim.ErrComputeSystemDoesNotExist
+	nb, nw := newTestNetwork(t, hns)
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Error(t, nb.FindOrCreateEndpoint(nw, newTestEndpoint("container1")))
+	assert.Equal(t, 1, hns.countRequests("HNSEndpointRequest POST"))
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+
+	"github.com/Microsoft/hcsshim"
+)
+
+// hnsPermanentErrors are the messages of HNS errors caused by the request itself, which fail
+// again when retried.
+var hnsPermanentErrors = []string{
+	"already exists",
+	"The parameter is incorrect",
+	"Element not found",
+}
+
+// retryingHNSClient wraps an hnsClient to retry HNS requests that fail transiently. Attaching
+// and detaching endpoints is not retried, as it fails permanently when the compute system is gone.
+// If latencies are tracked, retries of slow calls are spaced out accordingly.
+type retryingHNSClient struct {
+	hnsClient
+	policy    backoff.Policy
+	latencies *hnsLatencyTracker
+}
+
+// newRetryingHNSClient returns a retrying HNS client with the default backoff policy.
+func newRetryingHNSClient(client hnsClient) *retryingHNSClient {
+	return &retryingHNSClient{hnsClient: client}
+}
+
+// GetHNSGlobals returns the HNS global settings.
+func (c *retryingHNSClient) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
+	var globals *hcsshim.HNSGlobals
+	err := c.retry("GetHNSGlobals", func() error {
+		var err error
+		globals, err = c.hnsClient.GetHNSGlobals()
+		return err
+	})
+	return globals, err
+}
+
+// GetHNSNetworkByName returns the HNS network with the given name.
+func (c *retryingHNSClient) GetHNSNetworkByName(networkName string) (*hcsshim.HNSNetwork, error) {
+	var hnsNetwork *hcsshim.HNSNetwork
+	err := c.retry("GetHNSNetworkByName", func() error {
+		var err error
+		hnsNetwork, err = c.hnsClient.GetHNSNetworkByName(networkName)
+		return err
+	})
+	return hnsNetwork, err
+}
+
+// HNSNetworkRequest sends an HNS network request. A network created by a request that appeared
+// to fail is found by name instead of being created again.
+func (c *retryingHNSClient) HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error) {
+	var hnsNetwork *hcsshim.HNSNetwork
+	retried := false
+	err := c.retry("HNSNetworkRequest "+method, func() error {
+		var err error
+		if retried && method == "POST" {
+			hnsNetwork, err = c.hnsClient.GetHNSNetworkByName(requestName(request))
+			if err == nil {
+				return nil
+			}
+		}
+		retried = true
+		hnsNetwork, err = c.hnsClient.HNSNetworkRequest(method, path, request)
+		return err
+	})
+	return hnsNetwork, err
+}
+
+// GetHNSEndpointByName returns the HNS endpoint with the given name.
+func (c *retryingHNSClient) GetHNSEndpointByName(endpointName string) (*hcsshim.HNSEndpoint, error) {
+	var hnsEndpoint *hcsshim.HNSEndpoint
+	err := c.retry("GetHNSEndpointByName", func() error {
+		var err error
+		hnsEndpoint, err = c.hnsClient.GetHNSEndpointByName(endpointName)
+		return err
+	})
+	return hnsEndpoint, err
+}
+
+// HNSEndpointRequest sends an HNS endpoint request. An endpoint created by a request that
+// appeared to fail is found by name instead of being created again.
+func (c *retryingHNSClient) HNSEndpointRequest(method, path, request string) (*hcsshim.HNSEndpoint, error) {
+	var hnsEndpoint *hcsshim.HNSEndpoint
+	retried := false
+	err := c.retry("HNSEndpointRequest "+method, func() error {
+		var err error
+		if retried && method == "POST" {
+			hnsEndpoint, err = c.hnsClient.GetHNSEndpointByName(requestName(request))
+			if err == nil {
+				return nil
+			}
+		}
+		retried = true
+		hnsEndpoint, err = c.hnsClient.HNSEndpointRequest(method, path, request)
+		return err
+	})
+	return hnsEndpoint, err
+}
+
+// CreateNamespace creates a new HCN host namespace and returns its ID.
+func (c *retryingHNSClient) CreateNamespace() (string, error) {
+	var namespaceID string
+	err := c.retry("CreateNamespace", func() error {
+		var err error
+		namespaceID, err = c.hnsClient.CreateNamespace()
+		return err
+	})
+	return namespaceID, err
+}
+
+// DeleteNamespace deletes an HCN namespace.
+func (c *retryingHNSClient) DeleteNamespace(namespaceID string) error {
+	return c.retry("DeleteNamespace", func() error {
+		return c.hnsClient.DeleteNamespace(namespaceID)
+	})
+}
+
+// AddNamespaceEndpoint adds an HNS endpoint to an HCN namespace.
+func (c *retryingHNSClient) AddNamespaceEndpoint(namespaceID string, endpointID string) error {
+	return c.retry("AddNamespaceEndpoint", func() error {
+		return c.hnsClient.AddNamespaceEndpoint(namespaceID, endpointID)
+	})
+}
+
+// RemoveNamespaceEndpoint removes an HNS endpoint from an HCN namespace.
+func (c *retryingHNSClient) RemoveNamespaceEndpoint(namespaceID string, endpointID string) error {
+	return c.retry("RemoveNamespaceEndpoint", func() error {
+		return c.hnsClient.RemoveNamespaceEndpoint(namespaceID, endpointID)
+	})
+}
+
+// GetEndpointNamespace returns the ID of the HCN namespace of an HNS endpoint, if any.
+func (c *retryingHNSClient) GetEndpointNamespace(endpointID string) (string, error) {
+	var namespaceID string
+	err := c.retry("GetEndpointNamespace", func() error {
+		var err error
+		namespaceID, err = c.hnsClient.GetEndpointNamespace(endpointID)
+		return err
+	})
+	return namespaceID, err
+}
+
+// retry calls fn with the client's backoff policy.
+func (c *retryingHNSClient) retry(op string, fn func() error) error {
+	policy := c.policy
+	if c.latencies != nil && policy.InitialInterval == 0 {
+		policy.InitialInterval = c.latencies.retryInterval(op)
+	}
+
+	return policy.Retry(op, fn, isTransientHNSError)
+}
+
+// isTransientHNSError returns whether an HNS error is transient. HNS does not classify its errors,
+// so all errors are transient except those caused by the request itself. Calls abandoned by the
+// watchdog are not retried, as HNS is likely wedged.
+func isTransientHNSError(err error) bool {
+	if hcsshim.IsNotExist(err) || isHNSTimeout(err) {
+		return false
+	}
+
+	for _, msg := range hnsPermanentErrors {
+		if strings.Contains(err.Error(), msg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestName returns the name of the HNS object in a create request.
+func requestName(request string) string {
+	var object struct {
+		Name string
+	}
+	json.Unmarshal([]byte(request), &object)
+	return object.Name
+}
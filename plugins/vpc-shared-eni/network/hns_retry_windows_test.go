@@ -0,0 +1,74 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+
+	"github.com/Microsoft/hcsshim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyHNS is a fake HNS whose network requests fail transiently a number of times.
+type flakyHNS struct {
+	*fakeHNS
+	failures int
+}
+
+func (f *flakyHNS) HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error) {
+	hnsNetwork, err := f.fakeHNS.HNSNetworkRequest(method, path, request)
+	if f.failures > 0 {
+		// The request takes effect, but its response is lost.
+		f.failures--
+		return nil, fmt.Errorf("The remote procedure call failed")
+	}
+	return hnsNetwork, err
+}
+
+func TestHNSRetryFindsNetworkCreatedByFailedRequest(t *testing.T) {
+	hns := &flakyHNS{fakeHNS: newFakeHNS(), failures: 1}
+	nb, nw := newTestNetwork(t, hns.fakeHNS)
+	nb.hns = &retryingHNSClient{
+		hnsClient: hns,
+		policy:    backoff.Policy{InitialInterval: time.Millisecond},
+	}
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Equal(t, 1, hns.countRequests("HNSNetworkRequest POST"))
+	assert.Len(t, hns.networks, 1)
+}
+
+func TestHNSRetrySkipsPermanentErrors(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nb.hns = &retryingHNSClient{
+		hnsClient: hns,
+		policy:    backoff.Policy{InitialInterval: time.Millisecond},
+	}
+
+	// Lookups of missing networks fail once.
+	_, err := nb.client().GetHNSNetworkByName(nb.generateHNSNetworkName(nw))
+	assert.Error(t, err)
+	assert.Equal(t, 1, hns.countRequests("GetHNSNetworkByName GET"))
+
+	// Other failures are retried.
+	hns.failures["GetHNSGlobals"] = fmt.Errorf("The remote procedure call failed")
+	assert.Error(t, nb.FindOrCreateNetwork(nw))
+	assert.Equal(t, backoff.DefaultMaxAttempts, hns.countRequests("GetHNSGlobals GET"))
+}
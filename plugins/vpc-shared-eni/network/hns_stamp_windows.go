@@ -0,0 +1,95 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// HNSStampsFileName is the name of the state file that stamps the HNS networks and
+	// endpoints created by the plugin.
+	HNSStampsFileName = "hns-stamps.json"
+)
+
+// hnsStamps maps the IDs of the HNS networks and endpoints created by the plugin to the IDs of
+// their owners. HNS objects carry no free-form metadata, so the stamps are kept in a state file.
+type hnsStamps map[string]string
+
+// stampHNSObject stamps the HNS network or endpoint with the given ID as created by the plugin.
+func (nb *BridgeBuilder) stampHNSObject(id string, ownerID string) error {
+	return nb.updateHNSStamps(func(stamps hnsStamps) {
+		stamps[id] = ownerID
+	})
+}
+
+// unstampHNSObject removes the stamp of a deleted HNS network or endpoint.
+func (nb *BridgeBuilder) unstampHNSObject(id string) {
+	err := nb.updateHNSStamps(func(stamps hnsStamps) {
+		delete(stamps, id)
+	})
+	if err != nil {
+		log.Errorf("Failed to remove stamp of HNS object %s, ignoring: %v.", id, err)
+	}
+}
+
+// checkHNSStamp returns an error if the named HNS network or endpoint is either owned by
+// another CNI stack, or was not stamped by the plugin and the deletion is not forced.
+func (nb *BridgeBuilder) checkHNSStamp(resource string, id string, ownerID string, force bool) error {
+	stamps := nb.stamps
+	if nb.stateDir != "" {
+		stamps = make(hnsStamps)
+		_, err := state.ReadJSONFile(filepath.Join(nb.stateDir, HNSStampsFileName), &stamps)
+		if err != nil {
+			return err
+		}
+	}
+
+	stampOwnerID, stamped := stamps[id]
+	err := owner.CheckStamp(resource, stamped, force)
+	if err != nil || !stamped {
+		return err
+	}
+
+	return owner.Check(resource, stampOwnerID, ownerID)
+}
+
+// updateHNSStamps applies the given change to the stamps, which are kept in memory if the
+// builder has no state directory.
+func (nb *BridgeBuilder) updateHNSStamps(change func(stamps hnsStamps)) error {
+	if nb.stateDir == "" {
+		if nb.stamps == nil {
+			nb.stamps = make(hnsStamps)
+		}
+		change(nb.stamps)
+		return nil
+	}
+
+	stamps := make(hnsStamps)
+	err := state.UpdateJSONFile(filepath.Join(nb.stateDir, HNSStampsFileName), &stamps, func() error {
+		change(stamps)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update HNS stamps: %v", err)
+	}
+
+	return nil
+}
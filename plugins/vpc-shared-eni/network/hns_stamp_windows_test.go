@@ -0,0 +1,83 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUnstampedNetworkRequiresForce(t *testing.T) {
+	hns := newFakeHNS()
+	other, nw := newTestNetwork(t, hns)
+	require.NoError(t, other.FindOrCreateNetwork(nw))
+
+	// The network was not stamped by this builder, as if created by another CNI plugin.
+	nb := &BridgeBuilder{hns: hns}
+	assert.Error(t, nb.DeleteNetwork(nw))
+	assert.Len(t, hns.networks, 1)
+
+	nw.ForceDelete = true
+	require.NoError(t, nb.DeleteNetwork(nw))
+	assert.Empty(t, hns.networks)
+}
+
+func TestDelUnstampedEndpointRequiresForce(t *testing.T) {
+	hns := newFakeHNS()
+	other, nw := newTestNetwork(t, hns)
+	ep := newTestEndpoint("container1")
+	require.NoError(t, other.FindOrCreateNetwork(nw))
+	require.NoError(t, other.FindOrCreateEndpoint(nw, ep))
+
+	nb := &BridgeBuilder{hns: hns}
+	assert.Error(t, nb.DeleteEndpoint(nw, ep))
+	assert.Len(t, hns.endpoints, 1)
+	assert.Len(t, hns.attached, 1)
+
+	ep.ForceDelete = true
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	assert.Empty(t, hns.endpoints)
+}
+
+func TestHNSStampsAreSharedThroughStateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hns-stamps")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nb.stateDir = dir
+	ep := newTestEndpoint("container1")
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	require.NoError(t, nb.FindOrCreateEndpoint(nw, ep))
+
+	// Another invocation finds the stamps in the state file.
+	nb = &BridgeBuilder{hns: hns, stateDir: dir}
+	require.NoError(t, nb.DeleteEndpoint(nw, ep))
+	require.NoError(t, nb.DeleteNetwork(nw))
+	assert.Empty(t, hns.endpoints)
+	assert.Empty(t, hns.networks)
+
+	var stamps hnsStamps
+	_, err = state.ReadJSONFile(filepath.Join(dir, HNSStampsFileName), &stamps)
+	require.NoError(t, err)
+	assert.Empty(t, stamps)
+}
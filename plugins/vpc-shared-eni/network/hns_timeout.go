@@ -0,0 +1,57 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinHNSCallTimeout is the default lower bound of the adaptive HNS call ceiling.
+	DefaultMinHNSCallTimeout = 15 * time.Second
+	// DefaultMaxHNSCallTimeout is the default upper bound of the adaptive HNS call ceiling.
+	DefaultMaxHNSCallTimeout = 3 * time.Minute
+)
+
+var (
+	// hnsCallTimeout bounds the ceiling on the duration of HNS calls.
+	hnsCallTimeout = struct {
+		min time.Duration
+		max time.Duration
+	}{DefaultMinHNSCallTimeout, DefaultMaxHNSCallTimeout}
+	hnsCallTimeoutMutex sync.RWMutex
+)
+
+// SetHNSCallTimeout sets the bounds of the ceiling on the duration of HNS calls, which adapts to
+// the HNS latencies observed on the host. Zero values keep their current values. Windows only.
+func SetHNSCallTimeout(min time.Duration, max time.Duration) {
+	hnsCallTimeoutMutex.Lock()
+	defer hnsCallTimeoutMutex.Unlock()
+
+	if min != 0 {
+		hnsCallTimeout.min = min
+	}
+	if max != 0 {
+		hnsCallTimeout.max = max
+	}
+}
+
+// getHNSCallTimeout returns the bounds of the ceiling on the duration of HNS calls.
+func getHNSCallTimeout() (time.Duration, time.Duration) {
+	hnsCallTimeoutMutex.RLock()
+	defer hnsCallTimeoutMutex.RUnlock()
+
+	return hnsCallTimeout.min, hnsCallTimeout.max
+}
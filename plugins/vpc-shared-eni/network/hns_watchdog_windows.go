@@ -0,0 +1,234 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/Microsoft/hcsshim"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// hnsCallCeiling is the hard ceiling on the duration of a single HNS call. It is well below
+	// the timeouts of container runtimes, so that a wedged HNS fails the command with a clear
+	// error instead of hanging it.
+	hnsCallCeiling = 60 * time.Second
+
+	// maxStackDumpSize is the maximum size of the goroutine dump logged for hung HNS calls.
+	maxStackDumpSize = 1 << 20
+)
+
+// hnsTimeoutError is returned for HNS calls that exceeded the hard ceiling and were abandoned.
+type hnsTimeoutError struct {
+	op      string
+	ceiling time.Duration
+}
+
+// Error returns the error message.
+func (e *hnsTimeoutError) Error() string {
+	return fmt.Sprintf("HNS call %s did not complete within %v and was abandoned", e.op, e.ceiling)
+}
+
+// isHNSTimeout returns whether an error was returned for an abandoned HNS call.
+func isHNSTimeout(err error) bool {
+	_, ok := err.(*hnsTimeoutError)
+	return ok
+}
+
+// watchdogHNSClient wraps an hnsClient to abandon HNS calls that exceed a hard ceiling. HNS calls
+// cannot be cancelled, so hung calls are left running in the background until the plugin exits.
+// If latencies are tracked, the ceiling adapts to the latencies of completed calls.
+type watchdogHNSClient struct {
+	hnsClient
+	ceiling   time.Duration
+	latencies *hnsLatencyTracker
+}
+
+// newWatchdogHNSClient returns a watchdog HNS client with the default ceiling.
+func newWatchdogHNSClient(client hnsClient) *watchdogHNSClient {
+	return &watchdogHNSClient{
+		hnsClient: client,
+		ceiling:   hnsCallCeiling,
+	}
+}
+
+// GetHNSGlobals returns the HNS global settings.
+func (c *watchdogHNSClient) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
+	var globals *hcsshim.HNSGlobals
+	err := c.watch("GetHNSGlobals", "", func() error {
+		var err error
+		globals, err = c.hnsClient.GetHNSGlobals()
+		return err
+	})
+	if isHNSTimeout(err) {
+		return nil, err
+	}
+	return globals, err
+}
+
+// GetHNSNetworkByName returns the HNS network with the given name.
+func (c *watchdogHNSClient) GetHNSNetworkByName(networkName string) (*hcsshim.HNSNetwork, error) {
+	var hnsNetwork *hcsshim.HNSNetwork
+	err := c.watch("GetHNSNetworkByName", networkName, func() error {
+		var err error
+		hnsNetwork, err = c.hnsClient.GetHNSNetworkByName(networkName)
+		return err
+	})
+	if isHNSTimeout(err) {
+		return nil, err
+	}
+	return hnsNetwork, err
+}
+
+// HNSNetworkRequest sends an HNS network request.
+func (c *watchdogHNSClient) HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error) {
+	var hnsNetwork *hcsshim.HNSNetwork
+	err := c.watch("HNSNetworkRequest "+method, path+" "+request, func() error {
+		var err error
+		hnsNetwork, err = c.hnsClient.HNSNetworkRequest(method, path, request)
+		return err
+	})
+	if isHNSTimeout(err) {
+		return nil, err
+	}
+	return hnsNetwork, err
+}
+
+// GetHNSEndpointByName returns the HNS endpoint with the given name.
+func (c *watchdogHNSClient) GetHNSEndpointByName(endpointName string) (*hcsshim.HNSEndpoint, error) {
+	var hnsEndpoint *hcsshim.HNSEndpoint
+	err := c.watch("GetHNSEndpointByName", endpointName, func() error {
+		var err error
+		hnsEndpoint, err = c.hnsClient.GetHNSEndpointByName(endpointName)
+		return err
+	})
+	if isHNSTimeout(err) {
+		return nil, err
+	}
+	return hnsEndpoint, err
+}
+
+// HNSEndpointRequest sends an HNS endpoint request.
+func (c *watchdogHNSClient) HNSEndpointRequest(method, path, request string) (*hcsshim.HNSEndpoint, error) {
+	var hnsEndpoint *hcsshim.HNSEndpoint
+	err := c.watch("HNSEndpointRequest "+method, path+" "+request, func() error {
+		var err error
+		hnsEndpoint, err = c.hnsClient.HNSEndpointRequest(method, path, request)
+		return err
+	})
+	if isHNSTimeout(err) {
+		return nil, err
+	}
+	return hnsEndpoint, err
+}
+
+// HotAttachEndpoint attaches an HNS endpoint to a running container.
+func (c *watchdogHNSClient) HotAttachEndpoint(containerID string, endpointID string) error {
+	return c.watch("HotAttachEndpoint", containerID+" "+endpointID, func() error {
+		return c.hnsClient.HotAttachEndpoint(containerID, endpointID)
+	})
+}
+
+// HotDetachEndpoint detaches an HNS endpoint from a running container.
+func (c *watchdogHNSClient) HotDetachEndpoint(containerID string, endpointID string) error {
+	return c.watch("HotDetachEndpoint", containerID+" "+endpointID, func() error {
+		return c.hnsClient.HotDetachEndpoint(containerID, endpointID)
+	})
+}
+
+// CreateNamespace creates a new HCN host namespace and returns its ID.
+func (c *watchdogHNSClient) CreateNamespace() (string, error) {
+	var namespaceID string
+	err := c.watch("CreateNamespace", "", func() error {
+		var err error
+		namespaceID, err = c.hnsClient.CreateNamespace()
+		return err
+	})
+	if isHNSTimeout(err) {
+		return "", err
+	}
+	return namespaceID, err
+}
+
+// DeleteNamespace deletes an HCN namespace.
+func (c *watchdogHNSClient) DeleteNamespace(namespaceID string) error {
+	return c.watch("DeleteNamespace", namespaceID, func() error {
+		return c.hnsClient.DeleteNamespace(namespaceID)
+	})
+}
+
+// AddNamespaceEndpoint adds an HNS endpoint to an HCN namespace.
+func (c *watchdogHNSClient) AddNamespaceEndpoint(namespaceID string, endpointID string) error {
+	return c.watch("AddNamespaceEndpoint", namespaceID+" "+endpointID, func() error {
+		return c.hnsClient.AddNamespaceEndpoint(namespaceID, endpointID)
+	})
+}
+
+// RemoveNamespaceEndpoint removes an HNS endpoint from an HCN namespace.
+func (c *watchdogHNSClient) RemoveNamespaceEndpoint(namespaceID string, endpointID string) error {
+	return c.watch("RemoveNamespaceEndpoint", namespaceID+" "+endpointID, func() error {
+		return c.hnsClient.RemoveNamespaceEndpoint(namespaceID, endpointID)
+	})
+}
+
+// GetEndpointNamespace returns the ID of the HCN namespace of an HNS endpoint, if any.
+func (c *watchdogHNSClient) GetEndpointNamespace(endpointID string) (string, error) {
+	var namespaceID string
+	err := c.watch("GetEndpointNamespace", endpointID, func() error {
+		var err error
+		namespaceID, err = c.hnsClient.GetEndpointNamespace(endpointID)
+		return err
+	})
+	if isHNSTimeout(err) {
+		return "", err
+	}
+	return namespaceID, err
+}
+
+// watch calls fn and waits for it to return up to the client's ceiling. If the call hangs, it
+// logs the pending request and a dump of all goroutines, and returns an hnsTimeoutError without
+// waiting further. Results of abandoned calls must not be read, as fn may still write them.
+func (c *watchdogHNSClient) watch(op string, request string, fn func() error) error {
+	ceiling := c.ceiling
+	if c.latencies != nil {
+		ceiling = c.latencies.ceiling(op)
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(ceiling)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		// Abandoned calls are not recorded, so that a wedged HNS does not raise the ceiling.
+		if c.latencies != nil {
+			c.latencies.record(op, time.Since(start))
+		}
+		return err
+	case <-timer.C:
+		stack := make([]byte, maxStackDumpSize)
+		stack = stack[:runtime.Stack(stack, true)]
+		log.Errorf("HNS call %s did not complete within %v, abandoning it. Pending request: %s. Goroutines:\n%s",
+			op, ceiling, request, stack)
+		return &hnsTimeoutError{op: op, ceiling: ceiling}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHNSWatchdogAbandonsHungCalls(t *testing.T) {
+	hns := newFakeHNS()
+	hns.latency = time.Second
+	nb, nw := newTestNetwork(t, hns)
+	nb.hns = &retryingHNSClient{
+		hnsClient: &watchdogHNSClient{hnsClient: hns, ceiling: 10 * time.Millisecond},
+		policy:    backoff.Policy{InitialInterval: time.Millisecond},
+	}
+
+	start := time.Now()
+	err := nb.FindOrCreateNetwork(nw)
+	require.Error(t, err)
+	assert.True(t, isHNSTimeout(err))
+	assert.Contains(t, err.Error(), "GetHNSGlobals")
+
+	// Hung calls are not retried.
+	assert.True(t, time.Since(start) < hns.latency)
+}
+
+func TestHNSWatchdogPassesThroughResults(t *testing.T) {
+	hns := newFakeHNS()
+	nb, nw := newTestNetwork(t, hns)
+	nb.hns = newWatchdogHNSClient(hns)
+
+	require.NoError(t, nb.FindOrCreateNetwork(nw))
+	assert.Len(t, hns.networks, 1)
+}
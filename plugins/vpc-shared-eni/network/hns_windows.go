@@ -0,0 +1,112 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"github.com/Microsoft/hcsshim"
+	"github.com/Microsoft/hcsshim/hcn"
+)
+
+// hnsClient abstracts the subset of the Windows Host Networking Service API used by this plugin,
+// so that it can be replaced with a fake in tests.
+type hnsClient interface {
+	GetHNSGlobals() (*hcsshim.HNSGlobals, error)
+	GetHNSNetworkByName(networkName string) (*hcsshim.HNSNetwork, error)
+	HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error)
+	GetHNSEndpointByName(endpointName string) (*hcsshim.HNSEndpoint, error)
+	HNSEndpointRequest(method, path, request string) (*hcsshim.HNSEndpoint, error)
+	HotAttachEndpoint(containerID string, endpointID string) error
+	HotDetachEndpoint(containerID string, endpointID string) error
+	CreateNamespace() (string, error)
+	DeleteNamespace(namespaceID string) error
+	AddNamespaceEndpoint(namespaceID string, endpointID string) error
+	RemoveNamespaceEndpoint(namespaceID string, endpointID string) error
+	GetEndpointNamespace(endpointID string) (string, error)
+}
+
+// hcsshimClient implements hnsClient by calling HNS through Microsoft's hcsshim package.
+type hcsshimClient struct{}
+
+// GetHNSGlobals returns the HNS global settings.
+func (hcsshimClient) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
+	return hcsshim.GetHNSGlobals()
+}
+
+// GetHNSNetworkByName returns the HNS network with the given name.
+func (hcsshimClient) GetHNSNetworkByName(networkName string) (*hcsshim.HNSNetwork, error) {
+	return hcsshim.GetHNSNetworkByName(networkName)
+}
+
+// HNSNetworkRequest sends an HNS network request.
+func (hcsshimClient) HNSNetworkRequest(method, path, request string) (*hcsshim.HNSNetwork, error) {
+	return hcsshim.HNSNetworkRequest(method, path, request)
+}
+
+// GetHNSEndpointByName returns the HNS endpoint with the given name.
+func (hcsshimClient) GetHNSEndpointByName(endpointName string) (*hcsshim.HNSEndpoint, error) {
+	return hcsshim.GetHNSEndpointByName(endpointName)
+}
+
+// HNSEndpointRequest sends an HNS endpoint request.
+func (hcsshimClient) HNSEndpointRequest(method, path, request string) (*hcsshim.HNSEndpoint, error) {
+	return hcsshim.HNSEndpointRequest(method, path, request)
+}
+
+// HotAttachEndpoint attaches an HNS endpoint to a running container.
+func (hcsshimClient) HotAttachEndpoint(containerID string, endpointID string) error {
+	return hcsshim.HotAttachEndpoint(containerID, endpointID)
+}
+
+// HotDetachEndpoint detaches an HNS endpoint from a running container.
+func (hcsshimClient) HotDetachEndpoint(containerID string, endpointID string) error {
+	return hcsshim.HotDetachEndpoint(containerID, endpointID)
+}
+
+// CreateNamespace creates a new HCN host namespace and returns its ID.
+func (hcsshimClient) CreateNamespace() (string, error) {
+	namespace, err := hcn.NewNamespace(hcn.NamespaceTypeHost).Create()
+	if err != nil {
+		return "", err
+	}
+	return namespace.Id, nil
+}
+
+// DeleteNamespace deletes an HCN namespace.
+func (hcsshimClient) DeleteNamespace(namespaceID string) error {
+	namespace, err := hcn.GetNamespaceByID(namespaceID)
+	if err != nil {
+		return err
+	}
+	_, err = namespace.Delete()
+	return err
+}
+
+// AddNamespaceEndpoint adds an HNS endpoint to an HCN namespace.
+func (hcsshimClient) AddNamespaceEndpoint(namespaceID string, endpointID string) error {
+	return hcn.AddNamespaceEndpoint(namespaceID, endpointID)
+}
+
+// RemoveNamespaceEndpoint removes an HNS endpoint from an HCN namespace.
+func (hcsshimClient) RemoveNamespaceEndpoint(namespaceID string, endpointID string) error {
+	return hcn.RemoveNamespaceEndpoint(namespaceID, endpointID)
+}
+
+// GetEndpointNamespace returns the ID of the HCN namespace of an HNS endpoint, if any.
+func (hcsshimClient) GetEndpointNamespace(endpointID string) (string, error) {
+	endpoint, err := hcn.GetEndpointByID(endpointID)
+	if err != nil {
+		return "", err
+	}
+	return endpoint.HostComputeNamespace, nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+
+	log "github.com/cihub/seelog"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// hostVeth is the host side of an endpoint's veth pair.
+type hostVeth struct {
+	networkName string
+	containerID string
+	ownerID     string
+}
+
+// ListEndpoints lists the endpoints connected to the bridges of all container networks.
+// Endpoint IP addresses are read from the network namespaces of running processes.
+func ListEndpoints() ([]EndpointRecord, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the bridges created by this plugin, identified by their dummy links.
+	names := make(map[string]bool)
+	for _, link := range links {
+		names[link.Attrs().Name] = true
+	}
+
+	bridges := make(map[int]string)
+	for _, link := range links {
+		name := link.Attrs().Name
+		i := strings.LastIndex(name, "br")
+		if link.Type() == "bridge" && i >= 0 && names[fmt.Sprintf(dummyNameFormat, name)] {
+			bridges[link.Attrs().Index] = name[:i]
+		}
+	}
+
+	// Find the host sides of endpoint veth pairs, indexed by interface index.
+	veths := make(map[int]hostVeth)
+	for _, link := range links {
+		networkName, ok := bridges[link.Attrs().MasterIndex]
+		if !ok || link.Type() != "veth" {
+			continue
+		}
+
+		var containerID string
+		_, err = fmt.Sscanf(link.Attrs().Name, vethLinkNameFormat, &containerID)
+		if err != nil {
+			continue
+		}
+		veths[link.Attrs().Index] = hostVeth{
+			networkName: networkName,
+			containerID: containerID,
+			ownerID:     owner.FromAlias(link.Attrs().Alias),
+		}
+	}
+
+	if len(veths) == 0 {
+		return nil, nil
+	}
+
+	return listNetNSEndpoints(veths)
+}
+
+// listNetNSEndpoints visits each network namespace in use by a process once, and returns the
+// endpoints whose peer is one of the given host veth links.
+func listNetNSEndpoints(veths map[int]hostVeth) ([]EndpointRecord, error) {
+	paths, err := filepath.Glob("/proc/[0-9]*/ns/net")
+	if err != nil {
+		return nil, err
+	}
+
+	var hostNetNS unix.Stat_t
+	err = unix.Stat("/proc/self/ns/net", &hostNetNS)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []EndpointRecord
+	visited := map[uint64]bool{hostNetNS.Ino: true}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			// The process has exited.
+			continue
+		}
+
+		ino := info.Sys().(*syscall.Stat_t).Ino
+		if visited[ino] {
+			continue
+		}
+		visited[ino] = true
+
+		// Read the namespace through a netlink handle, without switching namespaces.
+		ns, err := netns.GetFromPath(path)
+		if err != nil {
+			continue
+		}
+
+		handle, err := netlink.NewHandleAt(ns)
+		ns.Close()
+		if err != nil {
+			log.Errorf("Failed to open netlink handle in netns %s: %v.", path, err)
+			continue
+		}
+
+		records = append(records, listNetNSEndpointsAt(handle, veths)...)
+		handle.Delete()
+	}
+
+	return records, nil
+}
+
+// listNetNSEndpointsAt returns the endpoints in the network namespace of the given netlink
+// handle whose peer is one of the given host veth links.
+func listNetNSEndpointsAt(handle *netlink.Handle, veths map[int]hostVeth) []EndpointRecord {
+	links, err := handle.LinkList()
+	if err != nil {
+		return nil
+	}
+
+	var records []EndpointRecord
+	for _, link := range links {
+		veth, ok := veths[link.Attrs().ParentIndex]
+		if !ok || link.Type() != "veth" {
+			continue
+		}
+
+		addresses, err := handle.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			continue
+		}
+
+		for _, address := range addresses {
+			if address.Scope != unix.RT_SCOPE_UNIVERSE {
+				continue
+			}
+			// Container IDs longer than 8 characters are truncated in veth link names.
+			records = append(records, EndpointRecord{
+				NetworkName: veth.networkName,
+				ContainerID: veth.containerID,
+				Truncated:   len(veth.containerID) == 8,
+				IPAddress:   address.IPNet,
+				OwnerID:     veth.ownerID,
+			})
+			break
+		}
+	}
+
+	return records
+}
+
+// CheckEndpoint verifies that the given endpoint is still connected, i.e. that its host veth
+// link is up and the container interface in its netns carries its IP address. It is cheap
+// enough to run on repeated ADD commands for the same container.
+func CheckEndpoint(ep *Endpoint) error {
+	err := checkVethLink(ep)
+	if err != nil {
+		return err
+	}
+
+	// Read the container interface through a netlink handle, without switching namespaces.
+	ns, err := netns.GetFromPath(ep.NetNSName)
+	if err != nil {
+		return fmt.Errorf("failed to find netns %s: %v", ep.NetNSName, err)
+	}
+	handle, err := netlink.NewHandleAt(ns)
+	ns.Close()
+	if err != nil {
+		return fmt.Errorf("failed to open netlink handle in netns %s: %v", ep.NetNSName, err)
+	}
+	defer handle.Delete()
+
+	link, err := handle.LinkByName(ep.IfName)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %v", ep.IfName, err)
+	}
+	if ep.IPAddress == nil {
+		return nil
+	}
+
+	addresses, err := handle.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list addresses of interface %s: %v", ep.IfName, err)
+	}
+	for _, address := range addresses {
+		if address.IP.Equal(ep.IPAddress.IP) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("interface %s does not have address %s", ep.IfName, ep.IPAddress)
+}
+
+// ProbeEndpoint verifies that the host veth link of the given endpoint is up. Unlike
+// CheckEndpoint, it does not look into the container netns, so it is cheap enough to run on
+// every CHECK command.
+func (nb *BridgeBuilder) ProbeEndpoint(ep *Endpoint) error {
+	return checkVethLink(ep)
+}
+
+// checkVethLink verifies that the host veth link of the given endpoint is up and owned by it.
+func checkVethLink(ep *Endpoint) error {
+	cid := ep.ContainerID
+	if len(cid) > 8 {
+		cid = cid[:8]
+	}
+	vethLinkName := fmt.Sprintf(vethLinkNameFormat, cid)
+
+	link, err := netlink.LinkByName(vethLinkName)
+	if err != nil {
+		return fmt.Errorf("failed to find veth link %s: %v", vethLinkName, err)
+	}
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		return fmt.Errorf("veth link %s is down", vethLinkName)
+	}
+
+	return owner.Check("link "+vethLinkName, owner.FromAlias(link.Attrs().Alias), ep.OwnerID)
+}
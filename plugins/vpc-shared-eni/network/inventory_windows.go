@@ -0,0 +1,115 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+
+	"github.com/Microsoft/hcsshim"
+)
+
+// hnsNetworkNameRegexp matches the names of HNS networks created by this plugin, without the
+// owner ID suffix.
+var hnsNetworkNameRegexp = regexp.MustCompile(`^(.*)br[0-9a-f]{12}$`)
+
+// ListEndpoints lists the HNS endpoints attached to the HNS networks of all container networks.
+func ListEndpoints() ([]EndpointRecord, error) {
+	networks, err := hcsshim.HNSListNetworkRequest("GET", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, hnsNetwork := range networks {
+		baseName, _ := owner.SplitName(hnsNetwork.Name)
+		match := hnsNetworkNameRegexp.FindStringSubmatch(baseName)
+		if match != nil {
+			names[hnsNetwork.Name] = match[1]
+		}
+	}
+
+	endpoints, err := hcsshim.HNSListEndpointRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []EndpointRecord
+	for _, hnsEndpoint := range endpoints {
+		networkName, ok := names[hnsEndpoint.VirtualNetworkName]
+		endpointName, ownerID := owner.SplitName(hnsEndpoint.Name)
+		if !ok || !strings.HasPrefix(endpointName, "cid-") || hnsEndpoint.IPAddress == nil {
+			continue
+		}
+
+		bits := 8 * net.IPv6len
+		if hnsEndpoint.IPAddress.To4() != nil {
+			bits = 8 * net.IPv4len
+		}
+
+		records = append(records, EndpointRecord{
+			NetworkName: networkName,
+			ContainerID: strings.TrimPrefix(endpointName, "cid-"),
+			OwnerID:     ownerID,
+			IPAddress: &net.IPNet{
+				IP:   hnsEndpoint.IPAddress,
+				Mask: net.CIDRMask(int(hnsEndpoint.PrefixLength), bits),
+			},
+		})
+	}
+
+	return records, nil
+}
+
+// CheckEndpoint verifies that the HNS endpoint of the given endpoint still exists with its IP
+// address. It is cheap enough to run on repeated ADD commands for the same container.
+func CheckEndpoint(ep *Endpoint) error {
+	return checkEndpoint(hcsshimClient{}, ep)
+}
+
+// ProbeEndpoint is like CheckEndpoint, but looks up the HNS endpoint through the HNS lookup cache
+// shared by plugin invocations, so that repeated checks do not reach HNS while the cache is fresh.
+func (nb *BridgeBuilder) ProbeEndpoint(ep *Endpoint) error {
+	return checkEndpoint(nb.client(), ep)
+}
+
+// checkEndpoint verifies that the HNS endpoint of the given endpoint exists with its IP address.
+func checkEndpoint(client hnsClient, ep *Endpoint) error {
+	nb := &BridgeBuilder{}
+
+	var infraContainerID string
+	if !ep.ManagedNamespace {
+		var err error
+		_, infraContainerID, err = nb.getInfraContainerID(ep)
+		if err != nil {
+			return err
+		}
+	}
+
+	endpointName := nb.generateHNSEndpointName(ep, infraContainerID)
+	hnsEndpoint, err := client.GetHNSEndpointByName(endpointName)
+	if err != nil {
+		return fmt.Errorf("failed to find endpoint %s: %v", endpointName, err)
+	}
+
+	if ep.IPAddress != nil && !ep.IPAddress.IP.Equal(hnsEndpoint.IPAddress) {
+		return fmt.Errorf("endpoint %s does not have address %s", endpointName, ep.IPAddress)
+	}
+
+	return nil
+}
@@ -16,7 +16,10 @@ package network
 import (
 	"net"
 
+	"github.com/aws/amazon-vpc-cni-plugins/network/dhcp"
 	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/exclusion"
+	"github.com/aws/amazon-vpc-cni-plugins/network/policy"
 )
 
 // Builder knows how to build container networks and connect container network interfaces.
@@ -36,14 +39,49 @@ type Network struct {
 	SharedENI           *eni.ENI
 	ENIIPAddress        *net.IPNet
 	GatewayIPAddress    net.IP
+	IPFamily            string
+	NAT64Prefix         *net.IPNet
 	VPCCIDRs            []net.IPNet
 	DNSServers          []string
 	DNSSuffixSearchList []string
 	ServiceCIDR         string
+	// ExtraPrefixes are the peered VPC, transit gateway or on-premises prefixes routed via
+	// the ENI gateway on every endpoint.
+	ExtraPrefixes []*net.IPNet
+	// DNSProxyAddress is the address of the host-local DNS proxy that endpoints resolve through.
+	DNSProxyAddress net.IP
+	// DHCP is whether endpoints obtain their addresses from the VPC DHCP service.
+	DHCP bool
+	// StandbyENI is the ENI that takes over the endpoints of the network when the shared
+	// ENI fails health checks. Failover is performed by the agent.
+	StandbyENI *eni.ENI
+	// OwnerID is the ID of the CNI stack that owns the network.
+	OwnerID string
+	// ForceDelete is whether the network is deleted even if it was not stamped by the plugin.
+	ForceDelete bool
+	// Excluded is the list of host adapters that builders must never modify.
+	Excluded *exclusion.List
+}
+
+// CheckExcluded returns an error if the shared or standby ENI of the network is excluded.
+func (nw *Network) CheckExcluded() error {
+	for _, e := range []*eni.ENI{nw.SharedENI, nw.StandbyENI} {
+		if e == nil {
+			continue
+		}
+		err := nw.Excluded.Check(e.GetLinkName(), e.GetMACAddress())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Endpoint represents a container network interface.
 type Endpoint struct {
+	// ID is the ID of the endpoint object in the host network stack. Windows only.
+	ID          string
 	ContainerID string
 	NetNSName   string
 	IfName      string
@@ -51,4 +89,53 @@ type Endpoint struct {
 	TapUserID   int
 	MACAddress  net.HardwareAddr
 	IPAddress   *net.IPNet
+	Policy      *policy.Document
+	// FirewallRules are the host firewall rules scoped to the endpoint's vNIC. Windows only.
+	FirewallRules []policy.Rule
+	// NATExceptions are the destinations that endpoint traffic reaches without SNAT. Windows only.
+	NATExceptions []*net.IPNet
+	// EgressRate is the maximum egress bandwidth of the endpoint in bits per second.
+	EgressRate uint64
+	// Sysctls are the kernel parameters set in the endpoint's network namespace. Linux only.
+	Sysctls map[string]string
+	// AntiSpoofing is whether traffic leaving the endpoint is restricted to its assigned
+	// source IP and MAC addresses.
+	AntiSpoofing bool
+	// EastWestIsolation is whether direct traffic between the endpoint and other endpoints on
+	// the same host is blocked, unless both endpoints opted in with EastWestOptIn.
+	EastWestIsolation bool
+	EastWestOptIn     bool
+	// SandboxIsolation is the isolation type of the sandbox the endpoint is attached to.
+	SandboxIsolation string
+	// UtilityVMID is the ID of the utility VM backing a Hyper-V isolated sandbox.
+	UtilityVMID string
+	// SandboxID is the ID of the pod sandbox, if passed by the container runtime.
+	SandboxID string
+	// ManagedNamespace is whether the builder creates and owns the endpoint's namespace.
+	ManagedNamespace bool
+	// NamespaceID is the ID of the namespace created by the builder for a managed namespace.
+	NamespaceID string
+	// DHCPLease is the lease obtained by the builder on networks using DHCP.
+	DHCPLease *dhcp.Lease
+	// OwnerID is the ID of the CNI stack that owns the endpoint.
+	OwnerID string
+	// ForceDelete is whether the endpoint is deleted even if it was not stamped by the plugin.
+	ForceDelete bool
+	// TapDevice is the path of the character device that a virtual machine monitor opens to
+	// attach to a TAP or macvtap interface. Linux only.
+	TapDevice string
+}
+
+// EndpointRecord describes an endpoint found in the live network configuration of the host,
+// which is used for rebuilding lost plugin state.
+type EndpointRecord struct {
+	NetworkName string
+	// ContainerID is the ID of the container, which may be truncated if it is recovered
+	// from an interface name.
+	ContainerID string
+	// Truncated is set if ContainerID may be a truncated prefix of the container ID.
+	Truncated bool
+	IPAddress *net.IPNet
+	// OwnerID is the ID of the CNI stack that owns the endpoint.
+	OwnerID string
 }
@@ -0,0 +1,221 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/exclusion"
+	"github.com/aws/amazon-vpc-cni-plugins/network/owner"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// PendingDeletionsFileName is the name of the state file keeping the networks marked for deletion.
+	PendingDeletionsFileName = "pending-network-deletions.json"
+)
+
+// PendingDeletion is a container network marked for deletion after its last endpoint was deleted.
+type PendingDeletion struct {
+	Name            string
+	BridgeType      string
+	BridgeNetNSPath string
+	ENIName         string
+	ENIMACAddress   string
+	DHCP            bool
+	OwnerID         string
+	ForceDelete     bool
+	Excluded        *exclusion.List
+	MarkedAt        time.Time
+}
+
+// Reaper deletes the container networks that were marked for deletion, if they are still unused.
+type Reaper struct {
+	// StateDir is the state directory of the plugin that marked the networks.
+	StateDir      string
+	Builder       Builder
+	ListEndpoints func() ([]EndpointRecord, error)
+}
+
+// pendingDeletionKey returns the key of a network in the pending deletions.
+func pendingDeletionKey(name string, ownerID string) string {
+	return name + owner.NameSuffix(ownerID)
+}
+
+// MarkForDeletion marks the given network for deletion by a reaper.
+func MarkForDeletion(stateDir string, nw *Network) error {
+	pending := PendingDeletion{
+		Name:            nw.Name,
+		BridgeType:      nw.BridgeType,
+		BridgeNetNSPath: nw.BridgeNetNSPath,
+		ENIName:         nw.SharedENI.GetLinkName(),
+		DHCP:            nw.DHCP,
+		OwnerID:         nw.OwnerID,
+		ForceDelete:     nw.ForceDelete,
+		Excluded:        nw.Excluded,
+		MarkedAt:        time.Now(),
+	}
+	if nw.SharedENI.GetMACAddress() != nil {
+		pending.ENIMACAddress = nw.SharedENI.GetMACAddress().String()
+	}
+
+	deletions := make(map[string]PendingDeletion)
+	return state.UpdateJSONFile(pendingDeletionsPath(stateDir), &deletions, func() error {
+		deletions[pendingDeletionKey(nw.Name, nw.OwnerID)] = pending
+		return nil
+	})
+}
+
+// UnmarkForDeletion clears the deletion mark of the given network, e.g. when it is used again.
+func UnmarkForDeletion(stateDir string, name string, ownerID string) error {
+	key := pendingDeletionKey(name, ownerID)
+
+	// Avoid locking the state file in the common case where nothing is marked.
+	deletions := make(map[string]PendingDeletion)
+	_, err := state.ReadJSONFile(pendingDeletionsPath(stateDir), &deletions)
+	if err != nil {
+		return err
+	}
+	if _, ok := deletions[key]; !ok {
+		return nil
+	}
+
+	return state.UpdateJSONFile(pendingDeletionsPath(stateDir), &deletions, func() error {
+		delete(deletions, key)
+		return nil
+	})
+}
+
+// pendingDeletionsPath returns the path of the pending deletions state file.
+func pendingDeletionsPath(stateDir string) string {
+	return filepath.Join(stateDir, PendingDeletionsFileName)
+}
+
+// Reap deletes the networks marked for deletion that have no endpoints, except those for which
+// skip returns true, and clears the marks of networks that are in use again. Networks busy with
+// other operations are left for the next run. Returns the names of the deleted networks.
+func (r *Reaper) Reap(skip func(name string, ownerID string) bool) ([]string, error) {
+	deletions := make(map[string]PendingDeletion)
+	_, err := state.ReadJSONFile(pendingDeletionsPath(r.StateDir), &deletions)
+	if err != nil || len(deletions) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(deletions))
+	for key := range deletions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var deleted []string
+	var firstErr error
+	for _, key := range keys {
+		pending := deletions[key]
+		if skip != nil && skip(pending.Name, pending.OwnerID) {
+			continue
+		}
+
+		ok, err := r.reap(&pending)
+		if err != nil {
+			log.Errorf("Failed to delete network %s: %v.", pending.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ok {
+			deleted = append(deleted, pending.Name)
+		}
+	}
+
+	return deleted, firstErr
+}
+
+// reap deletes the given network marked for deletion if it has no endpoints.
+// Returns whether the network was deleted.
+func (r *Reaper) reap(pending *PendingDeletion) (bool, error) {
+	unlock, err := state.TryLockNetwork(r.StateDir, pending.ENIMACAddress)
+	if err != nil {
+		log.Infof("Skipping busy network %s: %v.", pending.Name, err)
+		return false, nil
+	}
+	defer unlock()
+
+	var macAddress net.HardwareAddr
+	if pending.ENIMACAddress != "" {
+		macAddress, err = net.ParseMAC(pending.ENIMACAddress)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// The network is deleted along with its ENI.
+	sharedENI, err := eni.NewENI(pending.ENIName, macAddress)
+	if err == nil {
+		err = sharedENI.AttachToLink()
+	}
+	if err != nil {
+		log.Infof("Forgetting network %s, its ENI was not found: %v.", pending.Name, err)
+		return false, UnmarkForDeletion(r.StateDir, pending.Name, pending.OwnerID)
+	}
+
+	nw := &Network{
+		Name:            pending.Name,
+		BridgeType:      pending.BridgeType,
+		BridgeNetNSPath: pending.BridgeNetNSPath,
+		SharedENI:       sharedENI,
+		DHCP:            pending.DHCP,
+		OwnerID:         pending.OwnerID,
+		ForceDelete:     pending.ForceDelete,
+		Excluded:        pending.Excluded,
+	}
+
+	deleted, err := r.DeleteIfUnused(nw)
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, UnmarkForDeletion(r.StateDir, pending.Name, pending.OwnerID)
+}
+
+// DeleteIfUnused deletes the given network if it has no endpoints. The caller must hold the
+// network lock. Returns whether the network was deleted.
+func (r *Reaper) DeleteIfUnused(nw *Network) (bool, error) {
+	records, err := r.ListEndpoints()
+	if err != nil {
+		return false, fmt.Errorf("failed to list endpoints: %v", err)
+	}
+
+	for _, record := range records {
+		if record.NetworkName == nw.Name && record.OwnerID == nw.OwnerID {
+			log.Infof("Keeping network %s, it has endpoints.", nw.Name)
+			return false, nil
+		}
+	}
+
+	log.Infof("Deleting unused network %s.", nw.Name)
+	err = r.Builder.DeleteNetwork(nw)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
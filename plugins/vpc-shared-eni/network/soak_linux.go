@@ -0,0 +1,66 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+)
+
+// Sandbox is a synthetic container network namespace created by soak tests.
+type Sandbox struct {
+	ns      netns.NetNS
+	deleted bool
+}
+
+// NewSandbox creates a named network namespace.
+func NewSandbox(name string) (*Sandbox, error) {
+	ns, err := netns.NewNetNS(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sandbox{ns: ns}, nil
+}
+
+// NetNS returns the path of the network namespace, as passed in CNI commands.
+func (s *Sandbox) NetNS() string {
+	return s.ns.GetPath()
+}
+
+// Delete deletes the network namespace, unless a fault already deleted it.
+func (s *Sandbox) Delete() error {
+	if s.deleted {
+		return nil
+	}
+	s.deleted = true
+
+	return s.ns.Close()
+}
+
+// SoakFaults returns the faults that sandboxes can inject.
+func SoakFaults() []string {
+	return []string{FaultDeleteSandbox}
+}
+
+// InjectFault injects the named fault into the network stack of the sandbox.
+func (s *Sandbox) InjectFault(fault string) error {
+	switch fault {
+	case FaultDeleteSandbox:
+		return s.Delete()
+	default:
+		return fmt.Errorf("unsupported fault %s", fault)
+	}
+}
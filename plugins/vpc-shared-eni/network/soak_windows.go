@@ -0,0 +1,120 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	// hnsServiceName is the name of the Windows Host Networking Service.
+	hnsServiceName = "hns"
+
+	// hnsStopTimeout is how long to wait for the Host Networking Service to stop.
+	hnsStopTimeout = 30 * time.Second
+)
+
+// Sandbox is a synthetic container HCN namespace created by soak tests.
+type Sandbox struct {
+	id      string
+	deleted bool
+}
+
+// NewSandbox creates an HCN namespace. Namespaces are identified by their GUID, so the name
+// is not used.
+func NewSandbox(name string) (*Sandbox, error) {
+	id, err := hcsshimClient{}.CreateNamespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HCN namespace: %v", err)
+	}
+
+	return &Sandbox{id: id}, nil
+}
+
+// NetNS returns the GUID of the HCN namespace, as passed in CNI commands by containerd.
+func (s *Sandbox) NetNS() string {
+	return s.id
+}
+
+// Delete deletes the HCN namespace, unless a fault already deleted it.
+func (s *Sandbox) Delete() error {
+	if s.deleted {
+		return nil
+	}
+	s.deleted = true
+
+	return hcsshimClient{}.DeleteNamespace(s.id)
+}
+
+// SoakFaults returns the faults that sandboxes can inject.
+func SoakFaults() []string {
+	return []string{FaultDeleteSandbox, FaultRestartHNS}
+}
+
+// InjectFault injects the named fault into the network stack of the sandbox.
+func (s *Sandbox) InjectFault(fault string) error {
+	switch fault {
+	case FaultDeleteSandbox:
+		return s.Delete()
+	case FaultRestartHNS:
+		return restartHNS()
+	default:
+		return fmt.Errorf("unsupported fault %s", fault)
+	}
+}
+
+// restartHNS stops the Host Networking Service and starts it again.
+func restartHNS() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(hnsServiceName)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %v", hnsServiceName, err)
+	}
+	defer service.Close()
+
+	log.Infof("Restarting service %s.", hnsServiceName)
+	status, err := service.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("failed to stop service %s: %v", hnsServiceName, err)
+	}
+
+	deadline := time.Now().Add(hnsStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for service %s to stop", hnsServiceName)
+		}
+		time.Sleep(100 * time.Millisecond)
+		status, err = service.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service %s: %v", hnsServiceName, err)
+		}
+	}
+
+	err = service.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start service %s: %v", hnsServiceName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// podMetadata identifies the Kubernetes pod of a container, so that operators can map endpoints
+// back to pods.
+type podMetadata struct {
+	Namespace        string `json:"namespace"`
+	Name             string `json:"name"`
+	InfraContainerID string `json:"infraContainerID,omitempty"`
+}
+
+// auditRecord is a record of a CNI command in the audit log.
+type auditRecord struct {
+	Time        time.Time    `json:"time"`
+	Command     string       `json:"command"`
+	ContainerID string       `json:"containerID"`
+	IfName      string       `json:"ifName"`
+	Netns       string       `json:"netns"`
+	IPAddress   string       `json:"ipAddress,omitempty"`
+	Endpoint    string       `json:"endpoint"`
+	Pod         *podMetadata `json:"pod,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// newPodMetadata returns the pod metadata in the network configuration, or nil if the container
+// does not belong to a Kubernetes pod.
+func newPodMetadata(netConfig *config.NetConfig) *podMetadata {
+	kc := &netConfig.Kubernetes
+	if kc.Namespace == "" && kc.PodName == "" && kc.PodInfraContainerID == "" {
+		return nil
+	}
+
+	return &podMetadata{
+		Namespace:        kc.Namespace,
+		Name:             kc.PodName,
+		InfraContainerID: kc.PodInfraContainerID,
+	}
+}
+
+// audit records the outcome of a CNI command in the audit log.
+func (plugin *Plugin) audit(command string, args *cniSkel.CmdArgs, netConfig *config.NetConfig, cmdErr error) {
+	if plugin.Explain {
+		return
+	}
+
+	record := auditRecord{
+		Time:        time.Now(),
+		Command:     command,
+		ContainerID: args.ContainerID,
+		IfName:      args.IfName,
+		Netns:       args.Netns,
+		Endpoint:    endpointName(args, netConfig),
+		Pod:         newPodMetadata(netConfig),
+	}
+	if netConfig.IPAddress != nil {
+		record.IPAddress = netConfig.IPAddress.String()
+	}
+	if cmdErr != nil {
+		record.Error = cmdErr.Error()
+	}
+
+	err := state.AppendAuditRecord(plugin.StateDirPath, &record)
+	if err != nil {
+		log.Errorf("Failed to write audit record, ignoring: %v.", err)
+	}
+}
+
+// endpointName returns the name of the host-side network resource of the container endpoint.
+func endpointName(args *cniSkel.CmdArgs, netConfig *config.NetConfig) string {
+	return network.EndpointName(&network.Endpoint{
+		ContainerID:      args.ContainerID,
+		NetNSName:        args.Netns,
+		SandboxID:        netConfig.Kubernetes.PodInfraContainerID,
+		ManagedNamespace: netConfig.Sandbox.ManagedNamespace,
+		OwnerID:          netConfig.OwnerID,
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRecords(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	args := newTestArgs(t, testContainerID)
+	args.Args = "K8S_POD_NAMESPACE=team-a;K8S_POD_NAME=pod-1"
+	_, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+	require.NoError(t, plugin.Del(args))
+
+	data, err := ioutil.ReadFile(filepath.Join(plugin.StateDirPath, state.AuditFileName))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	for i, command := range []string{"ADD", "DEL"} {
+		var record auditRecord
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &record))
+		assert.Equal(t, command, record.Command)
+		assert.Equal(t, testContainerID, record.ContainerID)
+		assert.Equal(t, testIfName, record.IfName)
+		assert.Equal(t, "10.0.1.20/24", record.IPAddress)
+		assert.Equal(t, &podMetadata{Namespace: "team-a", Name: "pod-1"}, record.Pod)
+		assert.Empty(t, record.Error)
+	}
+}
+
+func TestAuditRecordsWithoutPod(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	_, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(plugin.StateDirPath, state.AuditFileName))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"pod"`)
+}
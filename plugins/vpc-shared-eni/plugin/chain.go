@@ -0,0 +1,54 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+// chainResult appends the given result to the result of the previous plugin in the chain, for the
+// plugins that follow in the chain. The addresses of the plugin are listed first, as the cached
+// results are expected to start with the endpoint address.
+func chainResult(prevResult *cniTypesCurrent.Result, result *cniTypesCurrent.Result) *cniTypesCurrent.Result {
+	offset := len(prevResult.Interfaces)
+	chained := &cniTypesCurrent.Result{
+		Interfaces: append(append([]*cniTypesCurrent.Interface{}, prevResult.Interfaces...), result.Interfaces...),
+		Routes:     append(append([]*cniTypes.Route{}, prevResult.Routes...), result.Routes...),
+		DNS:        result.DNS,
+	}
+
+	addresses := make(map[string]bool)
+	for _, ipConfig := range result.IPs {
+		ipConfig := *ipConfig
+		if ipConfig.Interface != nil {
+			ipConfig.Interface = cniTypesCurrent.Int(*ipConfig.Interface + offset)
+		}
+		chained.IPs = append(chained.IPs, &ipConfig)
+		addresses[ipConfig.Address.String()] = true
+	}
+
+	// Addresses taken from the previous result are reported once.
+	for _, ipConfig := range prevResult.IPs {
+		if !addresses[ipConfig.Address.String()] {
+			chained.IPs = append(chained.IPs, ipConfig)
+		}
+	}
+
+	if len(chained.DNS.Nameservers) == 0 {
+		chained.DNS = prevResult.DNS
+	}
+
+	return chained
+}
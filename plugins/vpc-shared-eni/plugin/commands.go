@@ -14,13 +14,21 @@
 package plugin
 
 import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
 	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
 	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
 	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
 
 	log "github.com/cihub/seelog"
+	"github.com/containernetworking/cni/pkg/invoke"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
-	cniTypes "github.com/containernetworking/cni/pkg/types"
 	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
 )
 
@@ -36,42 +44,86 @@ func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
 	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
 		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
 
-	// Find the ENI.
-	sharedENI, err := eni.NewENI(netConfig.ENIName, netConfig.ENIMACAddress)
+	// Fail before changing the node if the state of the container cannot be persisted.
+	if !plugin.Explain {
+		err = state.CheckWritable(plugin.StateDirPath)
+		if err != nil {
+			log.Errorf("Failed to write to state directory: %v.", err)
+			return err
+		}
+	}
+
+	err = plugin.initState()
 	if err != nil {
-		log.Errorf("Failed to find ENI %s: %v.", netConfig.ENIName, err)
 		return err
 	}
 
-	// Find the ENI link.
-	err = sharedENI.AttachToLink()
+	// Runtimes retry ADD commands. Skip the full ADD if an identical one already succeeded.
+	if plugin.addFromCache(args, netConfig) {
+		return nil
+	}
+
+	err = plugin.add(args, netConfig)
+	plugin.audit("ADD", args, netConfig, err)
 	if err != nil {
-		log.Errorf("Failed to find ENI link: %v.", err)
 		return err
 	}
 
-	// Call the operating system specific network builder.
-	nb := plugin.nb
+	// Complete deferred network deletions off the DEL path.
+	plugin.reapNetworks(netConfig)
 
-	// Find or create the container network for the shared ENI.
-	nw := network.Network{
-		Name:                netConfig.Name,
-		BridgeType:          netConfig.BridgeType,
-		BridgeNetNSPath:     netConfig.BridgeNetNSPath,
-		SharedENI:           sharedENI,
-		ENIIPAddress:        netConfig.ENIIPAddress,
-		GatewayIPAddress:    netConfig.GatewayIPAddress,
-		VPCCIDRs:            netConfig.VPCCIDRs,
-		DNSServers:          netConfig.DNS.Nameservers,
-		DNSSuffixSearchList: netConfig.DNS.Search,
-		ServiceCIDR:         netConfig.Kubernetes.ServiceCIDR,
+	return nil
+}
+
+// add connects the container to the network with the given network configuration. Each step
+// that changes the node registers the action that undoes it, and if any step fails, the completed
+// steps are undone in reverse order.
+func (plugin *Plugin) add(args *cniSkel.CmdArgs, netConfig *config.NetConfig) (err error) {
+	backoff.SetDefault(netConfig.Backoff)
+	network.SetHNSCallTimeout(netConfig.HNSCallTimeout.Min, netConfig.HNSCallTimeout.Max)
+
+	tx := &transaction{}
+
+	// Steps completed before the network is locked are undone directly on failure.
+	sharedENI, standbyENI, err := plugin.prepareAdd(args, netConfig, tx)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+
+	// Serialize operations on the network of the shared ENI.
+	unlock, err := plugin.lockNetwork(netConfig, sharedENI)
+	if err != nil {
+		tx.rollback()
+		return err
 	}
+	defer unlock()
+
+	// Undo network operations before other processes can operate on the network.
+	defer tx.rollbackIfFailed(&err)
+
+	// Call the operating system specific network builder.
+	nb := plugin.builder(netConfig)
 
-	err = nb.FindOrCreateNetwork(&nw)
+	// The network is in use again if it was marked for deletion.
+	plugin.unmarkNetwork(netConfig)
+
+	// Find or create the container network for the shared ENI. The node agent manages the
+	// lifecycle of networks itself.
+	nw := newNetwork(netConfig, sharedENI, standbyENI)
+	networkReady := false
+	if netConfig.AgentSocket == "" {
+		tx.onRollback("create network", func() error {
+			return plugin.undoNetwork(netConfig, nb, nw, networkReady)
+		})
+	}
+	err = nb.FindOrCreateNetwork(nw)
 	if err != nil {
+		plugin.recordNetworkResult(err)
 		log.Errorf("Failed to create network: %v.", err)
 		return err
 	}
+	networkReady = true
 
 	// Find or create the container endpoint on the network.
 	ep := network.Endpoint{
@@ -81,43 +133,263 @@ func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
 		IfType:      netConfig.InterfaceType,
 		TapUserID:   netConfig.TapUserID,
 		IPAddress:   netConfig.IPAddress,
+		Policy:      netConfig.Policy,
+
+		NATExceptions:     netConfig.NATExceptions,
+		EgressRate:        netConfig.EgressRate,
+		Sysctls:           netConfig.Sysctls,
+		FirewallRules:     netConfig.HostFirewallRules,
+		AntiSpoofing:      netConfig.AntiSpoofing,
+		EastWestIsolation: netConfig.EastWestIsolation,
+		EastWestOptIn:     netConfig.EastWestOptIn,
+		SandboxIsolation:  netConfig.Sandbox.Isolation,
+		UtilityVMID:       netConfig.Sandbox.UtilityVMID,
+		SandboxID:         netConfig.Kubernetes.PodInfraContainerID,
+		ManagedNamespace:  netConfig.Sandbox.ManagedNamespace,
+		OwnerID:           netConfig.OwnerID,
 	}
 
-	err = nb.FindOrCreateEndpoint(&nw, &ep)
+	// Endpoints may be partially created when FindOrCreateEndpoint fails.
+	tx.onRollback("create endpoint", func() error {
+		return nb.DeleteEndpoint(nw, &ep)
+	})
+	err = nb.FindOrCreateEndpoint(nw, &ep)
+	plugin.recordNetworkResult(err)
 	if err != nil {
 		log.Errorf("Failed to create endpoint: %v.", err)
 		return err
 	}
 
+	// In explain mode, output the planned operations instead of a CNI result.
+	if eb, ok := nb.(*network.ExplainBuilder); ok {
+		return eb.Print(os.Stdout)
+	}
+
+	// Harvest the DHCP lease into the CNI result.
+	if ep.DHCPLease != nil {
+		log.Infof("Obtained IP address %s from DHCP.", ep.DHCPLease.Address)
+		netConfig.IPAddress = ep.DHCPLease.Address
+		if netConfig.GatewayIPAddress == nil {
+			netConfig.GatewayIPAddress = ep.DHCPLease.Router
+		}
+		if len(netConfig.DNS.Nameservers) == 0 {
+			netConfig.DNS.Nameservers = ep.DHCPLease.DNSServers
+			netConfig.DNS.Domain = ep.DHCPLease.DomainName
+		}
+	}
+
+	// Report the plugin-managed namespace as the sandbox if there is one.
+	sandbox := args.Netns
+	if ep.NamespaceID != "" {
+		sandbox = ep.NamespaceID
+	}
+
 	// Generate CNI result.
 	result := &cniTypesCurrent.Result{
 		Interfaces: []*cniTypesCurrent.Interface{
 			{
 				Name:    args.IfName,
 				Mac:     ep.MACAddress.String(),
-				Sandbox: args.Netns,
+				Sandbox: sandbox,
 			},
 		},
 		IPs: []*cniTypesCurrent.IPConfig{
 			{
-				Version:   "4",
+				Version:   vpc.GetIPVersion(netConfig.IPAddress.IP),
 				Interface: cniTypesCurrent.Int(0),
 				Address:   *netConfig.IPAddress,
 				Gateway:   netConfig.GatewayIPAddress,
 			},
 		},
+		DNS: netConfig.DNS,
+	}
+
+	// Pass the previous result forward when chained after another plugin.
+	if netConfig.PrevResult != nil {
+		result = chainResult(netConfig.PrevResult, result)
 	}
 
 	// Output CNI result.
-	log.Infof("Writing CNI result to stdout: %+v", result)
-	err = cniTypes.PrintResult(result, netConfig.CNIVersion)
+	tap := newTapAttachment(&ep, args.IfName, sandbox, netConfig.TapUserID)
+	log.Infof("Writing CNI result to stdout: %+v tap:%+v", result, tap)
+	err = printResult(result, tap, netConfig.CNIVersion)
 	if err != nil {
 		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+		return err
+	}
+
+	plugin.cacheResult(args, netConfig, result, tap)
+	plugin.notify("ADD", args, netConfig, &ep)
+
+	return nil
+}
+
+// prepareAdd runs the steps of add that do not change the host network configuration and
+// returns the shared and standby ENIs. The independent steps run concurrently.
+func (plugin *Plugin) prepareAdd(args *cniSkel.CmdArgs, netConfig *config.NetConfig, tx *transaction) (*eni.ENI, *eni.ENI, error) {
+	var sharedENI, standbyENI *eni.ENI
+	err := parallel(
+		func() error {
+			return plugin.allocateIPAddress(args, netConfig, tx)
+		},
+		func() error {
+			return plugin.fetchExtraPrefixesIfTagged(netConfig)
+		},
+		func() error {
+			var err error
+			sharedENI, standbyENI, err = findENIs(netConfig)
+			return err
+		},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Endpoints obtain their addresses from the VPC DHCP service in DHCP mode.
+	useDHCP := netConfig.IPAddressMode == config.IPAddressModeDHCP
+
+	if netConfig.IPAddress == nil && !useDHCP {
+		log.Errorf("Missing IP address for container %s.", args.ContainerID)
+		return nil, nil, fmt.Errorf("missing required parameter IPAddress")
+	}
+
+	// Addresses allocated by IPAM must belong to the configured IP family as well.
+	if netConfig.IPAddress != nil {
+		err = vpc.ValidateIPFamily(netConfig.IPFamily, netConfig.IPAddress.IP, netConfig.GatewayIPAddress)
+		if err != nil {
+			log.Errorf("Invalid IP address for container %s: %v.", args.ContainerID, err)
+			return nil, nil, err
+		}
+	}
+
+	return sharedENI, standbyENI, nil
+}
+
+// newNetwork returns the container network for the shared ENI with the given network configuration.
+func newNetwork(netConfig *config.NetConfig, sharedENI *eni.ENI, standbyENI *eni.ENI) *network.Network {
+	return &network.Network{
+		Name:                netConfig.Name,
+		BridgeType:          netConfig.BridgeType,
+		BridgeNetNSPath:     netConfig.BridgeNetNSPath,
+		SharedENI:           sharedENI,
+		ENIIPAddress:        netConfig.ENIIPAddress,
+		GatewayIPAddress:    netConfig.GatewayIPAddress,
+		IPFamily:            netConfig.IPFamily,
+		NAT64Prefix:         netConfig.NAT64Prefix,
+		VPCCIDRs:            netConfig.VPCCIDRs,
+		DNSServers:          netConfig.DNS.Nameservers,
+		DNSSuffixSearchList: netConfig.DNS.Search,
+		ServiceCIDR:         netConfig.Kubernetes.ServiceCIDR,
+		ExtraPrefixes:       netConfig.ExtraPrefixes,
+		DNSProxyAddress:     netConfig.DNSProxyAddress,
+		DHCP:                netConfig.IPAddressMode == config.IPAddressModeDHCP,
+		StandbyENI:          standbyENI,
+		OwnerID:             netConfig.OwnerID,
+		Excluded:            netConfig.ExcludedAdapters,
+	}
+}
+
+// undoNetwork undoes finding or creating the given network in a failed ADD. A network that
+// failed to be created is partially configured, and is deleted unless it is in use. A ready
+// network is deleted according to the network deletion mode, as after DEL. Must be called with
+// the network lock held.
+func (plugin *Plugin) undoNetwork(
+	netConfig *config.NetConfig, nb network.Builder, nw *network.Network, ready bool) error {
+
+	if ready {
+		if netConfig.NetworkDeletion != config.NetworkDeletionKeep {
+			plugin.deleteNetworkIfUnused(netConfig, nb, nw)
+		}
+		return nil
+	}
+
+	_, err := plugin.reaper(nb).DeleteIfUnused(nw)
+	return err
+}
+
+// allocateIPAddress allocates the container IP address from the IP address pool or the IPAM
+// plugin, unless one is specified in the network configuration. The allocation is released if
+// the transaction is rolled back.
+func (plugin *Plugin) allocateIPAddress(
+	args *cniSkel.CmdArgs, netConfig *config.NetConfig, tx *transaction) error {
+	var err error
+
+	// Allocate a secondary IP address of the shared ENI if none was specified.
+	if netConfig.IPAddress == nil && netConfig.IPAddressPool != nil && !plugin.Explain {
+		pool := ipam.NewPool(plugin.StateDirPath, netConfig.Name, netConfig.IPAddressPool)
+		pool.SetOwner(netConfig.OwnerID)
+		netConfig.IPAddress, err = pool.Allocate(args.ContainerID)
+		if err != nil {
+			log.Errorf("Failed to allocate IP address: %v.", err)
+			return err
+		}
+		log.Infof("Allocated IP address %s.", netConfig.IPAddress)
+		tx.onRollback("allocate IP address", func() error {
+			_, err := pool.Release(args.ContainerID)
+			return err
+		})
+	}
+
+	// Delegate the IP address allocation to the IPAM plugin, if one is configured.
+	if netConfig.IPAddress == nil && netConfig.IPAM.Type != "" && !plugin.Explain {
+		err = plugin.allocateFromIPAM(args, netConfig)
+		if err != nil {
+			log.Errorf("Failed to allocate IP address from IPAM plugin %s: %v.", netConfig.IPAM.Type, err)
+			return err
+		}
+		log.Infof("Allocated IP address %s from IPAM plugin.", netConfig.IPAddress)
+		tx.onRollback("allocate IP address from IPAM plugin", func() error {
+			return invoke.DelegateDel(netConfig.IPAM.Type, args.StdinData)
+		})
+	}
+
+	return nil
+}
+
+// fetchExtraPrefixesIfTagged fetches the extra prefixes kept in an instance tag, if configured.
+func (plugin *Plugin) fetchExtraPrefixesIfTagged(netConfig *config.NetConfig) error {
+	if netConfig.ExtraPrefixesTag == "" || plugin.Explain {
+		return nil
+	}
+
+	err := plugin.fetchExtraPrefixes(netConfig)
+	if err != nil {
+		log.Errorf("Failed to fetch extra prefixes from instance tag %s: %v.",
+			netConfig.ExtraPrefixesTag, err)
 	}
 
 	return err
 }
 
+// findENIs finds the shared ENI and the optional standby ENI.
+func findENIs(netConfig *config.NetConfig) (*eni.ENI, *eni.ENI, error) {
+	// Find the ENI.
+	sharedENI, err := eni.NewENI(netConfig.ENIName, netConfig.ENIMACAddress)
+	if err != nil {
+		log.Errorf("Failed to find ENI %s: %v.", netConfig.ENIName, err)
+		return nil, nil, err
+	}
+
+	// Find the ENI link.
+	err = sharedENI.AttachToLink()
+	if err != nil {
+		log.Errorf("Failed to find ENI link: %v.", err)
+		return nil, nil, err
+	}
+
+	// The standby ENI is resolved by the agent when it fails over.
+	var standbyENI *eni.ENI
+	if netConfig.StandbyENIName != "" || netConfig.StandbyENIMACAddress != nil {
+		standbyENI, err = eni.NewENI(netConfig.StandbyENIName, netConfig.StandbyENIMACAddress)
+		if err != nil {
+			log.Errorf("Failed to find standby ENI %s: %v.", netConfig.StandbyENIName, err)
+			return nil, nil, err
+		}
+	}
+
+	return sharedENI, standbyENI, nil
+}
+
 // Del is the CNI DEL command handler.
 func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
 	// Parse network configuration.
@@ -130,6 +402,69 @@ func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
 	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
 		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
 
+	err = plugin.initState()
+	if err != nil {
+		return err
+	}
+
+	err = plugin.del(args, netConfig)
+	plugin.audit("DEL", args, netConfig, err)
+
+	return err
+}
+
+// Check is the CNI CHECK command handler.
+func (plugin *Plugin) Check(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args, false)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing CHECK with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	err = plugin.initState()
+	if err != nil {
+		return err
+	}
+
+	return plugin.check(args, netConfig)
+}
+
+// del disconnects the container from the network with the given network configuration.
+// The IP address of the container is set in the network configuration if it was found.
+func (plugin *Plugin) del(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	var err error
+
+	backoff.SetDefault(netConfig.Backoff)
+	network.SetHNSCallTimeout(netConfig.HNSCallTimeout.Min, netConfig.HNSCallTimeout.Max)
+
+	plugin.forgetResult(args)
+
+	// Find the secondary IP address allocated to the container, if any. It is released only
+	// after the endpoint is deleted, so that it is not allocated to another container while
+	// the endpoint still uses it.
+	var pool *ipam.Pool
+	if netConfig.IPAddressPool != nil && !plugin.Explain {
+		pool = ipam.NewPool(plugin.StateDirPath, netConfig.Name, netConfig.IPAddressPool)
+		pool.SetOwner(netConfig.OwnerID)
+		ipAddress, err := pool.Lookup(args.ContainerID)
+		if err != nil {
+			log.Errorf("Failed to look up IP address, ignoring: %v.", err)
+		} else if ipAddress == nil {
+			// The pool state may have been lost. Recover the address from the live endpoint.
+			ipAddress = plugin.findEndpointIPAddress(netConfig.Name, args.ContainerID, netConfig.OwnerID)
+			if ipAddress != nil {
+				log.Infof("Recovered IP address %s from live endpoint.", ipAddress)
+			}
+		}
+		if netConfig.IPAddress == nil {
+			netConfig.IPAddress = ipAddress
+		}
+	}
+
 	// Find the ENI.
 	sharedENI, err := eni.NewENI(netConfig.ENIName, netConfig.ENIMACAddress)
 	if err != nil {
@@ -144,14 +479,25 @@ func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
 		return err
 	}
 
+	// Serialize operations on the network of the shared ENI.
+	unlock, err := plugin.lockNetwork(netConfig, sharedENI)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Call operating system specific handler.
-	nb := plugin.nb
+	nb := plugin.builder(netConfig)
 
 	nw := network.Network{
 		Name:            netConfig.Name,
 		BridgeType:      netConfig.BridgeType,
 		BridgeNetNSPath: netConfig.BridgeNetNSPath,
 		SharedENI:       sharedENI,
+		DHCP:            netConfig.IPAddressMode == config.IPAddressModeDHCP,
+		OwnerID:         netConfig.OwnerID,
+		ForceDelete:     netConfig.ForceDelete,
+		Excluded:        netConfig.ExcludedAdapters,
 	}
 
 	ep := network.Endpoint{
@@ -161,13 +507,132 @@ func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
 		IfType:      netConfig.InterfaceType,
 		TapUserID:   netConfig.TapUserID,
 		IPAddress:   netConfig.IPAddress,
+
+		FirewallRules:     netConfig.HostFirewallRules,
+		AntiSpoofing:      netConfig.AntiSpoofing,
+		EastWestIsolation: netConfig.EastWestIsolation,
+		EastWestOptIn:     netConfig.EastWestOptIn,
+		SandboxIsolation:  netConfig.Sandbox.Isolation,
+		UtilityVMID:       netConfig.Sandbox.UtilityVMID,
+		SandboxID:         netConfig.Kubernetes.PodInfraContainerID,
+		ManagedNamespace:  netConfig.Sandbox.ManagedNamespace,
+		OwnerID:           netConfig.OwnerID,
+		ForceDelete:       netConfig.ForceDelete,
 	}
 
 	err = nb.DeleteEndpoint(&nw, &ep)
 	if err != nil {
-		// DEL is best-effort. Log and ignore the failure.
+		// DEL is best-effort. Log and ignore the failure. The IP address stays allocated while
+		// the endpoint exists, until a later DEL or garbage collection deletes it.
 		log.Errorf("Failed to delete endpoint, ignoring: %v", err)
+		if plugin.endpointExists(netConfig, args.ContainerID) {
+			return nil
+		}
+	} else {
+		plugin.notify("DEL", args, netConfig, &ep)
 	}
 
+	// The network lock is still held, so no ADD can allocate the address before it is free.
+	plugin.releaseIPAddress(args, netConfig, pool)
+
+	if netConfig.NetworkDeletion != config.NetworkDeletionKeep {
+		plugin.deleteNetworkIfUnused(netConfig, nb, &nw)
+	}
+
+	// In explain mode, output the planned operations.
+	if eb, ok := nb.(*network.ExplainBuilder); ok {
+		return eb.Print(os.Stdout)
+	}
+
+	return nil
+}
+
+// endpointExists returns whether the live network configuration has an endpoint of the given
+// container, or it cannot be determined.
+func (plugin *Plugin) endpointExists(netConfig *config.NetConfig, containerID string) bool {
+	record, err := plugin.findEndpoint(netConfig.Name, containerID, netConfig.OwnerID)
+	if err != nil {
+		log.Errorf("Failed to list endpoints: %v.", err)
+		return true
+	}
+
+	return record != nil
+}
+
+// releaseIPAddress releases the IP address allocated to the container from the given pool, if
+// any, and by the IPAM plugin, if one is configured. Failures are logged and ignored.
+func (plugin *Plugin) releaseIPAddress(args *cniSkel.CmdArgs, netConfig *config.NetConfig, pool *ipam.Pool) {
+	if pool != nil {
+		ipAddress, err := pool.Release(args.ContainerID)
+		if err != nil {
+			log.Errorf("Failed to release IP address, ignoring: %v.", err)
+		} else if ipAddress != nil {
+			log.Infof("Released IP address %s.", ipAddress)
+		}
+	}
+
+	if netConfig.IPAM.Type != "" && !plugin.Explain {
+		err := invoke.DelegateDel(netConfig.IPAM.Type, args.StdinData)
+		if err != nil {
+			log.Errorf("Failed to release IP address from IPAM plugin %s, ignoring: %v.",
+				netConfig.IPAM.Type, err)
+		}
+	}
+}
+
+// allocateFromIPAM invokes the configured IPAM plugin and sets the container IP address
+// and gateway from its result.
+func (plugin *Plugin) allocateFromIPAM(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	r, err := invoke.DelegateAdd(netConfig.IPAM.Type, args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	result, err := cniTypesCurrent.NewResultFromResult(r)
+	if err != nil {
+		return fmt.Errorf("failed to convert IPAM result to current version: %v", err)
+	}
+
+	if len(result.IPs) == 0 {
+		return fmt.Errorf("IPAM plugin returned no IP addresses")
+	}
+
+	netConfig.IPAddress = &result.IPs[0].Address
+	if netConfig.GatewayIPAddress == nil {
+		netConfig.GatewayIPAddress = result.IPs[0].Gateway
+	}
+
+	return nil
+}
+
+// fetchExtraPrefixes adds the extra prefixes kept in an instance tag to the network configuration.
+func (plugin *Plugin) fetchExtraPrefixes(netConfig *config.NetConfig) error {
+	value, err := plugin.instanceTag(netConfig.ExtraPrefixesTag)
+	if err != nil {
+		return err
+	}
+
+	prefixes, err := config.ParsePrefixes(value)
+	if err != nil {
+		return err
+	}
+
+	err = vpc.ValidateIPFamily(netConfig.IPFamily, prefixIPs(prefixes)...)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Fetched extra prefixes %v from instance tag %s.", prefixes, netConfig.ExtraPrefixesTag)
+	netConfig.ExtraPrefixes = append(netConfig.ExtraPrefixes, prefixes...)
+
 	return nil
 }
+
+// prefixIPs returns the network addresses of the given prefixes.
+func prefixIPs(prefixes []*net.IPNet) []net.IP {
+	var ips []net.IP
+	for _, prefix := range prefixes {
+		ips = append(ips, prefix.IP)
+	}
+	return ips
+}
@@ -0,0 +1,479 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/dhcp"
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testNetworkName = "vpc"
+	testContainerID = "container1"
+	testNetNS       = "none"
+	testIfName      = "eth0"
+)
+
+// newTestPlugin returns a plugin wired to a fake network builder.
+func newTestPlugin(t *testing.T) (*Plugin, *fake.Builder) {
+	plugin, err := NewPlugin()
+	require.NoError(t, err)
+
+	nb := fake.NewBuilder()
+	plugin.nb = nb
+
+	stateDir, err := ioutil.TempDir("", "vpc-shared-eni")
+	require.NoError(t, err)
+	plugin.StateDirPath = stateDir
+
+	return plugin, nb
+}
+
+// cleanupTestPlugin removes the state created by a test plugin.
+func cleanupTestPlugin(plugin *Plugin) {
+	os.RemoveAll(plugin.StateDirPath)
+}
+
+// newTestArgs returns CNI arguments for a network configuration that refers to an
+// interface present on the test host.
+func newTestArgs(t *testing.T, containerID string) *cniSkel.CmdArgs {
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	require.NotEmpty(t, interfaces)
+
+	netConfig := fmt.Sprintf(`{
+		"cniVersion": "0.3.1",
+		"name": "%s",
+		"type": "vpc-shared-eni",
+		"eniName": "%s",
+		"eniIPAddress": "10.0.1.10/24",
+		"ipAddress": "10.0.1.20/24",
+		"gatewayIPAddress": "10.0.1.1"
+	}`, testNetworkName, interfaces[0].Name)
+
+	return &cniSkel.CmdArgs{
+		ContainerID: containerID,
+		Netns:       testNetNS,
+		IfName:      testIfName,
+		StdinData:   []byte(netConfig),
+	}
+}
+
+// captureResult runs fn and returns the CNI result it writes to stdout. Logging is disabled
+// meanwhile, as log messages may be written to stdout as well.
+func captureResult(t *testing.T, fn func() error) (*cniTypesCurrent.Result, error) {
+	output, err := captureOutput(t, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var result cniTypesCurrent.Result
+	require.NoError(t, json.Unmarshal(output, &result))
+	return &result, nil
+}
+
+// captureOutput runs fn and returns what it writes to stdout, with logging disabled.
+func captureOutput(t *testing.T, fn func() error) ([]byte, error) {
+	log.Flush()
+	logger := log.Current
+	log.UseLogger(log.Disabled)
+	defer log.UseLogger(logger)
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	err = fn()
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return output, nil
+}
+
+// ops returns the operation names of the given calls.
+func ops(calls []fake.Call) []string {
+	var names []string
+	for _, call := range calls {
+		names = append(names, call.Op)
+	}
+	return names
+}
+
+func TestAddThenDel(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	require.NoError(t, plugin.Add(newTestArgs(t, testContainerID)))
+	assert.True(t, nb.HasNetwork(testNetworkName))
+	assert.True(t, nb.HasEndpoint(testContainerID))
+
+	require.NoError(t, plugin.Del(newTestArgs(t, testContainerID)))
+	assert.False(t, nb.HasEndpoint(testContainerID))
+
+	assert.Equal(t,
+		[]string{fake.OpFindOrCreateNetwork, fake.OpFindOrCreateEndpoint, fake.OpDeleteEndpoint},
+		ops(nb.Calls()))
+}
+
+func TestDuplicateAdd(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	require.NoError(t, plugin.Add(newTestArgs(t, testContainerID)))
+	require.NoError(t, plugin.Add(newTestArgs(t, testContainerID)))
+	assert.True(t, nb.HasEndpoint(testContainerID))
+	assert.Len(t, nb.Calls(), 4)
+}
+
+func TestAddResultVersions(t *testing.T) {
+	for _, version := range []string{"0.3.1", "0.4.0", "1.0.0", "1.1.0"} {
+		t.Run(version, func(t *testing.T) {
+			plugin, _ := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+
+			args := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{"cniVersion": version})
+			output, err := captureOutput(t, func() error { return plugin.Add(args) })
+			require.NoError(t, err)
+
+			var result struct {
+				CNIVersion string                       `json:"cniVersion"`
+				IPs        []map[string]json.RawMessage `json:"ips"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+			assert.Equal(t, version, result.CNIVersion)
+			require.Len(t, result.IPs, 1)
+			assert.JSONEq(t, `"10.0.1.20/24"`, string(result.IPs[0]["address"]))
+
+			// IP configurations lost their version in CNI spec version 1.0.0.
+			_, hasVersion := result.IPs[0]["version"]
+			assert.Equal(t, version[0] == '0', hasVersion)
+		})
+	}
+}
+
+func TestAddChained(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	prevResult := map[string]interface{}{
+		"interfaces": []map[string]interface{}{{"name": "dummy0", "sandbox": "/var/run/netns/test"}},
+		"ips":        []map[string]interface{}{{"version": "4", "address": "169.254.0.2/24", "interface": 0}},
+		"dns":        map[string]interface{}{"nameservers": []string{"169.254.0.1"}},
+	}
+	args := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{"prevResult": prevResult})
+	result, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+
+	// The result of the plugin is appended to the previous result.
+	require.Len(t, result.Interfaces, 2)
+	assert.Equal(t, "dummy0", result.Interfaces[0].Name)
+	assert.Equal(t, testIfName, result.Interfaces[1].Name)
+	require.Len(t, result.IPs, 2)
+	assert.Equal(t, "10.0.1.20/24", result.IPs[0].Address.String())
+	assert.Equal(t, 1, *result.IPs[0].Interface)
+	assert.Equal(t, "169.254.0.2/24", result.IPs[1].Address.String())
+	assert.Equal(t, []string{"169.254.0.1"}, result.DNS.Nameservers)
+}
+
+func TestAddNetworkFailure(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	nb.Failures[fake.OpFindOrCreateNetwork] = fmt.Errorf("hns unavailable")
+
+	assert.Error(t, plugin.Add(newTestArgs(t, testContainerID)))
+	assert.False(t, nb.HasEndpoint(testContainerID))
+
+	// The partially created network is deleted.
+	assert.Equal(t, []string{fake.OpFindOrCreateNetwork, fake.OpDeleteNetwork}, ops(nb.Calls()))
+}
+
+func TestAddEndpointFailure(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	nb.Failures[fake.OpFindOrCreateEndpoint] = fmt.Errorf("attach failed")
+
+	assert.Error(t, plugin.Add(newTestArgs(t, testContainerID)))
+	assert.False(t, nb.HasEndpoint(testContainerID))
+
+	// The partially created endpoint is deleted, and the network is kept.
+	assert.Equal(t,
+		[]string{fake.OpFindOrCreateNetwork, fake.OpFindOrCreateEndpoint, fake.OpDeleteEndpoint},
+		ops(nb.Calls()))
+	assert.True(t, nb.HasNetwork(testNetworkName))
+}
+
+func TestAddFailureReleasesIPAddress(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	pool := []string{"10.0.1.20/24"}
+
+	nb.Failures[fake.OpFindOrCreateEndpoint] = fmt.Errorf("attach failed")
+	assert.Error(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+
+	// The IP address allocated to the failed container is available again.
+	delete(nb.Failures, fake.OpFindOrCreateEndpoint)
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container2"), pool...)))
+	assert.True(t, nb.HasEndpoint("container2"))
+}
+
+func TestDelKeepsIPAddressOfLiveEndpoint(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	pool := []string{"10.0.1.20/24"}
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+
+	// The endpoint cannot be deleted and is still live, so its address is not released.
+	nb.Failures[fake.OpDeleteEndpoint] = fmt.Errorf("delete failed")
+	withEndpoints(plugin, newTestEndpointRecord(t, "container1", "10.0.1.20/24"))
+	require.NoError(t, plugin.Del(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+	assert.Error(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container2"), pool...)))
+
+	// The address is released once the endpoint is deleted.
+	delete(nb.Failures, fake.OpDeleteEndpoint)
+	require.NoError(t, plugin.Del(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container2"), pool...)))
+	assert.True(t, nb.HasEndpoint("container2"))
+}
+
+func TestAddInvalidConfig(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	args := newTestArgs(t, testContainerID)
+	args.StdinData = []byte(`{"cniVersion": "0.3.1", "name": "vpc"}`)
+
+	assert.Error(t, plugin.Add(args))
+	assert.Empty(t, nb.Calls())
+}
+
+func TestDelWithoutAdd(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	// DEL is best-effort and succeeds even if the endpoint does not exist.
+	assert.NoError(t, plugin.Del(newTestArgs(t, testContainerID)))
+	assert.Equal(t, []string{fake.OpDeleteEndpoint}, ops(nb.Calls()))
+}
+
+func TestInterleavedContainers(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	require.NoError(t, plugin.Add(newTestArgs(t, "container1")))
+	require.NoError(t, plugin.Add(newTestArgs(t, "container2")))
+	require.NoError(t, plugin.Del(newTestArgs(t, "container1")))
+
+	assert.False(t, nb.HasEndpoint("container1"))
+	assert.True(t, nb.HasEndpoint("container2"))
+}
+
+func TestExplainMakesNoChanges(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.Explain = true
+
+	assert.NoError(t, plugin.Add(newTestArgs(t, testContainerID)))
+	assert.NoError(t, plugin.Del(newTestArgs(t, testContainerID)))
+	assert.Empty(t, nb.Calls())
+}
+
+func TestConsecutiveNetworkFailureCounter(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	nb.Failures[fake.OpFindOrCreateNetwork] = fmt.Errorf("hns unavailable")
+	assert.Error(t, plugin.Add(newTestArgs(t, testContainerID)))
+	assert.Error(t, plugin.Add(newTestArgs(t, testContainerID)))
+
+	counters, err := state.LoadCounters(plugin.StateDirPath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), counters[state.CounterConsecutiveNetworkFailures])
+
+	delete(nb.Failures, fake.OpFindOrCreateNetwork)
+	assert.NoError(t, plugin.Add(newTestArgs(t, testContainerID)))
+
+	counters, err = state.LoadCounters(plugin.StateDirPath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), counters[state.CounterConsecutiveNetworkFailures])
+}
+
+// withIPAddressPool replaces the IP address in the network configuration with an IP address pool.
+func withIPAddressPool(t *testing.T, args *cniSkel.CmdArgs, pool ...string) *cniSkel.CmdArgs {
+	var netConfig map[string]interface{}
+	require.NoError(t, json.Unmarshal(args.StdinData, &netConfig))
+
+	delete(netConfig, "ipAddress")
+	netConfig["secondaryIPAddresses"] = pool
+
+	var err error
+	args.StdinData, err = json.Marshal(netConfig)
+	require.NoError(t, err)
+
+	return args
+}
+
+func TestAddAllocatesFromIPAddressPool(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	pool := []string{"10.0.1.20/24", "10.0.1.21/24"}
+
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container2"), pool...)))
+
+	// The pool is exhausted.
+	assert.Error(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container3"), pool...)))
+	assert.False(t, nb.HasEndpoint("container3"))
+
+	// Deleting a container returns its IP address to the pool.
+	require.NoError(t, plugin.Del(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container3"), pool...)))
+	assert.True(t, nb.HasEndpoint("container3"))
+}
+
+func TestAddWithoutIPAddress(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	assert.Error(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, testContainerID))))
+	assert.Empty(t, nb.Calls())
+}
+
+func TestAddWithDHCP(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	address, err := vpc.GetIPAddressFromString("10.0.1.42/24")
+	require.NoError(t, err)
+	nb.DHCPLease = &dhcp.Lease{
+		Address:    address,
+		Router:     net.ParseIP("10.0.1.1"),
+		DNSServers: []string{"10.0.0.2"},
+	}
+
+	args := newTestArgs(t, testContainerID)
+	var netConfig map[string]interface{}
+	require.NoError(t, json.Unmarshal(args.StdinData, &netConfig))
+	delete(netConfig, "ipAddress")
+	delete(netConfig, "gatewayIPAddress")
+	netConfig["bridgeType"] = "L2"
+	netConfig["ipAddressMode"] = "dhcp"
+	args.StdinData, err = json.Marshal(netConfig)
+	require.NoError(t, err)
+
+	result, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+	require.Len(t, result.IPs, 1)
+	assert.Equal(t, "10.0.1.42/24", result.IPs[0].Address.String())
+	assert.Equal(t, "10.0.1.1", result.IPs[0].Gateway.String())
+	assert.Equal(t, []string{"10.0.0.2"}, result.DNS.Nameservers)
+
+	require.NoError(t, plugin.Del(args))
+	assert.False(t, nb.HasEndpoint(testContainerID))
+}
+
+func TestFetchExtraPrefixes(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	plugin.instanceTag = func(key string) (string, error) {
+		assert.Equal(t, "extra-prefixes", key)
+		return "10.2.0.0/16,10.3.0.0/16", nil
+	}
+
+	_, prefix, _ := net.ParseCIDR("10.1.0.0/16")
+	netConfig := &config.NetConfig{
+		IPFamily:         vpc.IPFamilyIPv4,
+		ExtraPrefixes:    []*net.IPNet{prefix},
+		ExtraPrefixesTag: "extra-prefixes",
+	}
+	require.NoError(t, plugin.fetchExtraPrefixes(netConfig))
+	require.Len(t, netConfig.ExtraPrefixes, 3)
+	assert.Equal(t, "10.3.0.0/16", netConfig.ExtraPrefixes[2].String())
+
+	// Tags with invalid prefixes fail.
+	plugin.instanceTag = func(key string) (string, error) {
+		return "10.2.0.0", nil
+	}
+	assert.Error(t, plugin.fetchExtraPrefixes(netConfig))
+}
+
+func TestOwnerIsolation(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	pool := []string{"10.0.1.20/24", "10.0.1.21/24"}
+	ecsArgs := withNetConfig(t, withIPAddressPool(t, newTestArgs(t, testContainerID), pool...),
+		map[string]interface{}{"ownerID": "ecs"})
+	eksArgs := withNetConfig(t, withIPAddressPool(t, newTestArgs(t, testContainerID), pool...),
+		map[string]interface{}{"ownerID": "eks"})
+
+	require.NoError(t, plugin.Add(ecsArgs))
+
+	// Another CNI stack neither reuses nor releases the allocation.
+	assert.Error(t, plugin.Add(eksArgs))
+	require.NoError(t, plugin.Del(eksArgs))
+
+	allocations, err := ipam.NewPool(plugin.StateDirPath, testNetworkName, nil).Allocations()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{testContainerID: "10.0.1.20/24"}, allocations)
+
+	require.NoError(t, plugin.Del(ecsArgs))
+	assert.False(t, nb.HasEndpoint(testContainerID))
+
+	allocations, err = ipam.NewPool(plugin.StateDirPath, testNetworkName, nil).Allocations()
+	require.NoError(t, err)
+	assert.Empty(t, allocations)
+}
+
+func TestAddExcludedAdapter(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	path := filepath.Join(plugin.StateDirPath, "excluded-adapters.json")
+	data := fmt.Sprintf(`{"names":["%s"]}`, interfaces[0].Name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+
+	args := withNetConfig(t, newTestArgs(t, testContainerID),
+		map[string]interface{}{"excludedAdaptersFile": path})
+	assert.Error(t, plugin.Add(args))
+	assert.False(t, nb.HasNetwork(testNetworkName))
+	assert.False(t, nb.HasEndpoint(testContainerID))
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"path/filepath"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// GC is the CNI GC command handler. It deletes the endpoints of the network in the given
+// configuration whose containers are not in the list of valid attachments, e.g. endpoints
+// leaked when the agent crashed or a container exited uncleanly. Orphaned endpoints are
+// deleted like DEL commands would, which also deletes the network if it becomes unused.
+func (plugin *Plugin) GC(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args, false)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing GC with netconfig: %+v.", netConfig)
+
+	attachments, err := cni.ValidAttachments(args.StdinData)
+	if err != nil {
+		log.Errorf("Failed to parse valid attachments: %v.", err)
+		return err
+	}
+
+	err = plugin.initState()
+	if err != nil {
+		return err
+	}
+
+	records, err := plugin.listEndpoints()
+	if err != nil {
+		log.Errorf("Failed to list endpoints: %v.", err)
+		return err
+	}
+
+	var returnedErr error
+	for _, record := range records {
+		if record.NetworkName != netConfig.Name || record.OwnerID != netConfig.OwnerID ||
+			record.ContainerID == "" || attachments.HasContainer(record.ContainerID) {
+			continue
+		}
+
+		for _, orphanArgs := range plugin.orphanArgs(args, &record) {
+			log.Infof("Deleting orphaned endpoint of container %s interface %s.",
+				orphanArgs.ContainerID, orphanArgs.IfName)
+
+			// DEL commands change the network configuration, so parse it again for each.
+			orphanConfig, err := config.New(orphanArgs, false)
+			if err != nil {
+				return err
+			}
+			err = plugin.del(orphanArgs, orphanConfig)
+			plugin.audit("GC", orphanArgs, orphanConfig, err)
+			if err != nil {
+				log.Errorf("Failed to delete orphaned endpoint of container %s: %v.",
+					orphanArgs.ContainerID, err)
+				returnedErr = err
+			}
+		}
+	}
+
+	return returnedErr
+}
+
+// orphanArgs returns the arguments of the DEL commands that delete the given orphaned endpoint.
+// The cached results of the container provide its full ID and interface names, as container IDs
+// recovered from endpoint names may be truncated.
+func (plugin *Plugin) orphanArgs(args *cniSkel.CmdArgs, record *network.EndpointRecord) []*cniSkel.CmdArgs {
+	newArgs := func(containerID string, ifName string) *cniSkel.CmdArgs {
+		return &cniSkel.CmdArgs{
+			ContainerID: containerID,
+			IfName:      ifName,
+			Args:        args.Args,
+			Path:        args.Path,
+			StdinData:   args.StdinData,
+		}
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(plugin.StateDirPath, resultsDirName, record.ContainerID+"*.json"))
+
+	var orphans []*cniSkel.CmdArgs
+	for _, path := range paths {
+		var cached cachedResult
+		found, err := state.ReadJSONFile(path, &cached)
+		if err != nil || !found || cached.ContainerID == "" {
+			continue
+		}
+		orphans = append(orphans, newArgs(cached.ContainerID, cached.IfName))
+	}
+
+	if len(orphans) == 0 {
+		orphans = append(orphans, newArgs(record.ContainerID, ""))
+	}
+
+	return orphans
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"os"
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGC(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	otherArgs := withNetConfig(t, newTestArgs(t, "container3"), map[string]interface{}{"name": "other"})
+	for _, args := range []*cniSkel.CmdArgs{newTestArgs(t, "container1"), newTestArgs(t, "container2"), otherArgs} {
+		_, err := captureResult(t, func() error { return plugin.Add(args) })
+		require.NoError(t, err)
+	}
+
+	gcArgs := withNetConfig(t, newTestArgs(t, ""), map[string]interface{}{
+		"cni.dev/valid-attachments": []map[string]string{{"containerID": "container1", "ifname": testIfName}},
+	})
+	require.NoError(t, plugin.GC(gcArgs))
+
+	assert.True(t, nb.HasEndpoint("container1"))
+	assert.False(t, nb.HasEndpoint("container2"))
+	// Endpoints of other networks are left alone.
+	assert.True(t, nb.HasEndpoint("container3"))
+
+	_, err := os.Stat(plugin.resultPath(newTestArgs(t, "container2")))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGCMissingAttachments(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	_, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, "container1")) })
+	require.NoError(t, err)
+
+	assert.Error(t, plugin.GC(newTestArgs(t, "")))
+	assert.True(t, nb.HasEndpoint("container1"))
+}
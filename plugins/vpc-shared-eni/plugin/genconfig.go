@@ -0,0 +1,168 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// genConfigCNIVersion is the CNI spec version of generated network configuration lists.
+	genConfigCNIVersion = "0.3.1"
+)
+
+// generatedConfList is a network configuration list generated by the genconfig subcommand.
+type generatedConfList struct {
+	CNIVersion string                `json:"cniVersion"`
+	Name       string                `json:"name"`
+	Plugins    []generatedPluginConf `json:"plugins"`
+}
+
+// generatedPluginConf is the network configuration of the plugin in a generated list.
+type generatedPluginConf struct {
+	Type             string       `json:"type"`
+	ENIMACAddress    string       `json:"eniMACAddress"`
+	ENIIPAddress     string       `json:"eniIPAddress"`
+	VPCCIDRs         []string     `json:"vpcCIDRs"`
+	GatewayIPAddress string       `json:"gatewayIPAddress,omitempty"`
+	ZoneType         string       `json:"zoneType,omitempty"`
+	BridgeType       string       `json:"bridgeType"`
+	IPFamily         string       `json:"ipFamily,omitempty"`
+	IPAddressPool    []string     `json:"secondaryIPAddresses,omitempty"`
+	DNS              cniTypes.DNS `json:"dns"`
+}
+
+// GenerateConfig writes a network configuration list for an ENI of the instance, derived from
+// the instance metadata and validated by the network configuration parser, to w.
+func (plugin *Plugin) GenerateConfig(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet(pluginName+" genconfig", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	eniMAC := flags.String("eni-mac", "", "MAC address of the shared ENI, detected if empty")
+	name := flags.String("name", "vpc", "name of the network")
+	bridgeType := flags.String("bridge-type", config.BridgeTypeL3, "bridge type, L2 or L3")
+	ipFamily := flags.String("ip-family", vpc.IPFamilyIPv4, "IP address family, ipv4 or ipv6")
+	zoneType := flags.String("zone-type", "",
+		"zone type, availability-zone, local-zone, wavelength-zone or outpost, detected if empty")
+	secondaryIPs := flags.Bool("secondary-ips", true,
+		"allocates container addresses from the secondary IP addresses of the ENI")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	var macAddress net.HardwareAddr
+	if *eniMAC != "" {
+		macAddress, err = net.ParseMAC(*eniMAC)
+		if err != nil {
+			return fmt.Errorf("invalid ENI MAC address %s", *eniMAC)
+		}
+	} else {
+		macAddress, err = config.DetectENIMACAddress()
+		if err != nil {
+			return err
+		}
+	}
+
+	metadata, err := config.GetENIMetadata(macAddress, *ipFamily, *zoneType)
+	if err != nil {
+		return err
+	}
+
+	conf := generatedPluginConf{
+		Type:             pluginName,
+		ENIMACAddress:    macAddress.String(),
+		ENIIPAddress:     metadata.IPAddress,
+		VPCCIDRs:         metadata.VPCCIDRs,
+		GatewayIPAddress: metadata.Gateway,
+		BridgeType:       *bridgeType,
+		DNS:              cniTypes.DNS{Nameservers: []string{metadata.DNSServer}},
+	}
+	if *ipFamily != vpc.IPFamilyIPv4 {
+		conf.IPFamily = *ipFamily
+	}
+	if metadata.ZoneType != config.ZoneTypeAvailabilityZone {
+		conf.ZoneType = metadata.ZoneType
+	}
+	if *secondaryIPs {
+		if len(metadata.SecondaryIPAddresses) == 0 {
+			return fmt.Errorf("ENI %s has no secondary IP addresses", macAddress)
+		}
+		conf.IPAddressPool = metadata.SecondaryIPAddresses
+	}
+
+	confList := generatedConfList{
+		CNIVersion: genConfigCNIVersion,
+		Name:       *name,
+		Plugins:    []generatedPluginConf{conf},
+	}
+
+	err = validateConfList(&confList)
+	if err != nil {
+		return fmt.Errorf("generated invalid network configuration: %v", err)
+	}
+
+	data, err := json.MarshalIndent(&confList, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// validateConfList parses the network configuration of each plugin in the list, as the runtime
+// passes it to the plugin.
+func validateConfList(confList *generatedConfList) error {
+	for _, conf := range confList.Plugins {
+		data, err := json.Marshal(&conf)
+		if err != nil {
+			return err
+		}
+
+		// The runtime injects the name and version of the list into each plugin configuration.
+		var netConf map[string]interface{}
+		err = json.Unmarshal(data, &netConf)
+		if err != nil {
+			return err
+		}
+		netConf["cniVersion"] = confList.CNIVersion
+		netConf["name"] = confList.Name
+
+		data, err = json.Marshal(netConf)
+		if err != nil {
+			return err
+		}
+
+		_, err = config.New(&cniSkel.CmdArgs{StdinData: data}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerTestMetadata registers an instance metadata handler serving the given resources.
+func registerTestMetadata(metadata map[string]string) {
+	config.RegisterMetadataHandler(func(path string) (string, error) {
+		value, ok := metadata[path]
+		if !ok {
+			return "", fmt.Errorf("not found")
+		}
+		return value, nil
+	})
+}
+
+func newTestMetadata() map[string]string {
+	return map[string]string{
+		"network/interfaces/macs/":                                         "0a:00:00:00:00:01/\n0a:12:34:56:78:9a/",
+		"network/interfaces/macs/0a:00:00:00:00:01/device-number":          "0",
+		"network/interfaces/macs/0a:12:34:56:78:9a/device-number":          "1",
+		"network/interfaces/macs/0a:12:34:56:78:9a/local-ipv4s":            "10.0.1.10\n10.0.1.20\n10.0.1.21",
+		"network/interfaces/macs/0a:12:34:56:78:9a/subnet-ipv4-cidr-block": "10.0.1.0/24",
+		"network/interfaces/macs/0a:12:34:56:78:9a/vpc-ipv4-cidr-blocks":   "10.0.0.0/16",
+		"placement/availability-zone":                                      "us-west-2a",
+	}
+}
+
+func TestGenerateConfig(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	registerTestMetadata(newTestMetadata())
+	defer config.RegisterMetadataHandler(nil)
+
+	expected := `{
+		"cniVersion": "0.3.1",
+		"name": "vpc",
+		"plugins": [{
+			"type": "vpc-shared-eni",
+			"eniMACAddress": "0a:12:34:56:78:9a",
+			"eniIPAddress": "10.0.1.10/24",
+			"vpcCIDRs": ["10.0.0.0/16"],
+			"gatewayIPAddress": "10.0.1.1",
+			"bridgeType": "L3",
+			"secondaryIPAddresses": ["10.0.1.20/24", "10.0.1.21/24"],
+			"dns": {"nameservers": ["10.0.0.2"]}
+		}]
+	}`
+
+	// The ENI is detected, or given by its MAC address.
+	for _, args := range [][]string{nil, {"-eni-mac", "0A:12:34:56:78:9A"}} {
+		var out strings.Builder
+		require.NoError(t, plugin.GenerateConfig(args, &out))
+		assert.JSONEq(t, expected, out.String())
+	}
+}
+
+func TestGenerateConfigOutsideRegion(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	metadata := newTestMetadata()
+	metadata["placement/availability-zone"] = "us-west-2-lax-1a"
+	registerTestMetadata(metadata)
+	defer config.RegisterMetadataHandler(nil)
+
+	// Local Zones use the link-local DNS server.
+	var out strings.Builder
+	require.NoError(t, plugin.GenerateConfig([]string{"-secondary-ips=false"}, &out))
+	assert.JSONEq(t, `{
+		"cniVersion": "0.3.1",
+		"name": "vpc",
+		"plugins": [{
+			"type": "vpc-shared-eni",
+			"eniMACAddress": "0a:12:34:56:78:9a",
+			"eniIPAddress": "10.0.1.10/24",
+			"vpcCIDRs": ["10.0.0.0/16"],
+			"gatewayIPAddress": "10.0.1.1",
+			"zoneType": "local-zone",
+			"bridgeType": "L3",
+			"dns": {"nameservers": ["169.254.169.253"]}
+		}]
+	}`, out.String())
+
+	// Outposts cannot be detected, and leave the gateway to the plugin.
+	out.Reset()
+	require.NoError(t, plugin.GenerateConfig([]string{"-secondary-ips=false", "-zone-type", "outpost"}, &out))
+	assert.JSONEq(t, `{
+		"cniVersion": "0.3.1",
+		"name": "vpc",
+		"plugins": [{
+			"type": "vpc-shared-eni",
+			"eniMACAddress": "0a:12:34:56:78:9a",
+			"eniIPAddress": "10.0.1.10/24",
+			"vpcCIDRs": ["10.0.0.0/16"],
+			"zoneType": "outpost",
+			"bridgeType": "L3",
+			"dns": {"nameservers": ["169.254.169.253"]}
+		}]
+	}`, out.String())
+}
+
+func TestGenerateConfigFails(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		metadata func(metadata map[string]string)
+	}{
+		{
+			name: "unknown flag",
+			args: []string{"-unknown"},
+		},
+		{
+			name: "invalid MAC address",
+			args: []string{"-eni-mac", "invalid"},
+		},
+		{
+			name: "invalid bridge type",
+			args: []string{"-bridge-type", "L4"},
+		},
+		{
+			name: "invalid zone type",
+			args: []string{"-zone-type", "region"},
+		},
+		{
+			name: "no secondary ENI",
+			metadata: func(metadata map[string]string) {
+				metadata["network/interfaces/macs/"] = "0a:00:00:00:00:01/"
+			},
+		},
+		{
+			name: "no secondary IP addresses",
+			metadata: func(metadata map[string]string) {
+				metadata["network/interfaces/macs/0a:12:34:56:78:9a/local-ipv4s"] = "10.0.1.10"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, _ := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+			metadata := newTestMetadata()
+			if test.metadata != nil {
+				test.metadata(metadata)
+			}
+			registerTestMetadata(metadata)
+			defer config.RegisterMetadataHandler(nil)
+
+			var out strings.Builder
+			assert.Error(t, plugin.GenerateConfig(test.args, &out))
+			assert.Empty(t, out.String())
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// MigrateEndpoint moves the endpoint of an existing container from the network in the old
+// network configuration to the network in the new one, e.g. after the shared ENI or subnet
+// changed, without replacing the container. The endpoint keeps its IP address if the new
+// network configuration can carry it, and the new CNI result is written to stdout.
+func (plugin *Plugin) MigrateEndpoint(fromArgs *cniSkel.CmdArgs, toArgs *cniSkel.CmdArgs) error {
+	fromConfig, err := config.New(fromArgs, false)
+	if err != nil {
+		return fmt.Errorf("failed to parse old netconfig: %v", err)
+	}
+
+	toConfig, err := config.New(toArgs, true)
+	if err != nil {
+		return fmt.Errorf("failed to parse new netconfig: %v", err)
+	}
+
+	err = plugin.initState()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Migrating endpoint of container %s from network %s to network %s.",
+		toArgs.ContainerID, fromConfig.Name, toConfig.Name)
+
+	// Preserve the IP address if the new network configuration does not assign one itself.
+	var preserved *net.IPNet
+	if toConfig.IPAddress == nil {
+		ipAddress := plugin.endpointIPAddress(fromArgs.ContainerID, fromConfig)
+		if ipAddress != nil {
+			preserved = preservedIPAddress(toConfig, ipAddress)
+		}
+	}
+
+	// Fail before deleting the endpoint if the new network cannot address it.
+	if toConfig.IPAddress == nil && preserved == nil && toConfig.IPAddressPool == nil && toConfig.IPAM.Type == "" &&
+		toConfig.IPAddressMode != config.IPAddressModeDHCP {
+		return fmt.Errorf("missing required parameter IPAddress")
+	}
+
+	err = plugin.del(fromArgs, fromConfig)
+	if err != nil {
+		return fmt.Errorf("failed to delete endpoint from network %s: %v", fromConfig.Name, err)
+	}
+
+	if preserved != nil {
+		if toConfig.IPAddressPool != nil && !plugin.Explain {
+			err = plugin.reserveIPAddress(toArgs.ContainerID, toConfig, preserved)
+			if err != nil {
+				return err
+			}
+		}
+		log.Infof("Preserving IP address %s of container %s.", preserved, toArgs.ContainerID)
+		toConfig.IPAddress = preserved
+	}
+
+	err = plugin.add(toArgs, toConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create endpoint on network %s: %v", toConfig.Name, err)
+	}
+
+	log.Infof("Migrated endpoint of container %s to network %s.", toArgs.ContainerID, toConfig.Name)
+	return nil
+}
+
+// preservedIPAddress returns the given IP address with the prefix length of the network with
+// the given network configuration, or nil if endpoints on the network cannot keep it.
+func preservedIPAddress(netConfig *config.NetConfig, ipAddress *net.IPNet) *net.IPNet {
+	// Addresses assigned by an IPAM plugin or DHCP cannot be chosen by the plugin.
+	if netConfig.IPAM.Type != "" || netConfig.IPAddressMode == config.IPAddressModeDHCP {
+		return nil
+	}
+
+	if vpc.ValidateIPFamily(netConfig.IPFamily, ipAddress.IP) != nil {
+		return nil
+	}
+
+	// The address must be one of the secondary IP addresses of the new ENI, if they are known.
+	if netConfig.IPAddressPool != nil {
+		for _, address := range netConfig.IPAddressPool {
+			if address.IP.Equal(ipAddress.IP) {
+				return address
+			}
+		}
+		return nil
+	}
+
+	// The address must be in the subnet of the new ENI, if it is known.
+	if netConfig.ENIIPAddress != nil {
+		_, subnet, _ := net.ParseCIDR(netConfig.ENIIPAddress.String())
+		if !subnet.Contains(ipAddress.IP) {
+			return nil
+		}
+		return &net.IPNet{IP: ipAddress.IP, Mask: subnet.Mask}
+	}
+
+	return ipAddress
+}
+
+// endpointIPAddress returns the IP address of the container's endpoint on the network with the
+// given network configuration, or nil if it is not known.
+func (plugin *Plugin) endpointIPAddress(containerID string, netConfig *config.NetConfig) *net.IPNet {
+	if netConfig.IPAddress != nil {
+		return netConfig.IPAddress
+	}
+
+	if netConfig.IPAddressPool != nil {
+		pool := ipam.NewPool(plugin.StateDirPath, netConfig.Name, netConfig.IPAddressPool)
+		pool.SetOwner(netConfig.OwnerID)
+		allocations, err := pool.Allocations()
+		if err == nil && allocations[containerID] != "" {
+			ipAddress, err := vpc.GetIPAddressFromString(allocations[containerID])
+			if err == nil {
+				return ipAddress
+			}
+		}
+	}
+
+	// The address may have been assigned by an IPAM plugin or the pool state may have been lost.
+	return plugin.findEndpointIPAddress(netConfig.Name, containerID, netConfig.OwnerID)
+}
+
+// reserveIPAddress allocates the given IP address to the container in the IP address pool of
+// the network with the given network configuration.
+func (plugin *Plugin) reserveIPAddress(containerID string, netConfig *config.NetConfig, ipAddress *net.IPNet) error {
+	pool := ipam.NewPool(plugin.StateDirPath, netConfig.Name, netConfig.IPAddressPool)
+	pool.SetOwner(netConfig.OwnerID)
+	err := pool.SetReservations(map[string]*net.IPNet{containerID: ipAddress})
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.AllocateReserved(containerID, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to allocate IP address %s: %v", ipAddress, err)
+	}
+
+	return nil
+}
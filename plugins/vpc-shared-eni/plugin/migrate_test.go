@@ -0,0 +1,111 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withNetConfig sets the given fields in the network configuration.
+func withNetConfig(t *testing.T, args *cniSkel.CmdArgs, fields map[string]interface{}) *cniSkel.CmdArgs {
+	var netConfig map[string]interface{}
+	require.NoError(t, json.Unmarshal(args.StdinData, &netConfig))
+
+	for key, value := range fields {
+		if value == nil {
+			delete(netConfig, key)
+		} else {
+			netConfig[key] = value
+		}
+	}
+
+	var err error
+	args.StdinData, err = json.Marshal(netConfig)
+	require.NoError(t, err)
+
+	return args
+}
+
+// migrateEndpoint migrates an endpoint and returns the CNI result written to stdout.
+func migrateEndpoint(t *testing.T, plugin *Plugin, fromArgs, toArgs *cniSkel.CmdArgs) (*cniTypesCurrent.Result, error) {
+	return captureResult(t, func() error { return plugin.MigrateEndpoint(fromArgs, toArgs) })
+}
+
+func TestMigrateEndpointPreservesIPAddress(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	fromArgs := withIPAddressPool(t, newTestArgs(t, testContainerID), "10.0.1.20/24", "10.0.1.21/24")
+	require.NoError(t, plugin.Add(fromArgs))
+
+	// The first free address in the new pool differs from the address of the endpoint.
+	toArgs := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{
+		"name":                 "vpc2",
+		"ipAddress":            nil,
+		"secondaryIPAddresses": []string{"10.0.1.21/24", "10.0.1.20/24"},
+	})
+	result, err := migrateEndpoint(t, plugin, fromArgs, toArgs)
+	require.NoError(t, err)
+	require.Len(t, result.IPs, 1)
+	assert.Equal(t, "10.0.1.20/24", result.IPs[0].Address.String())
+
+	assert.Equal(t,
+		[]string{fake.OpFindOrCreateNetwork, fake.OpFindOrCreateEndpoint,
+			fake.OpDeleteEndpoint, fake.OpFindOrCreateNetwork, fake.OpFindOrCreateEndpoint},
+		ops(nb.Calls()))
+	assert.True(t, nb.HasNetwork("vpc2"))
+
+	// The address moved from the old pool to the new one.
+	allocations, err := ipam.NewPool(plugin.StateDirPath, testNetworkName, nil).Allocations()
+	require.NoError(t, err)
+	assert.Empty(t, allocations)
+
+	allocations, err = ipam.NewPool(plugin.StateDirPath, "vpc2", nil).Allocations()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{testContainerID: "10.0.1.20/24"}, allocations)
+}
+
+func TestMigrateEndpointToNewSubnet(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	fromArgs := newTestArgs(t, testContainerID)
+	require.NoError(t, plugin.Add(fromArgs))
+
+	// The address is not in the subnet of the new ENI, which has no addresses to allocate.
+	toArgs := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{
+		"eniIPAddress":     "10.0.2.10/24",
+		"ipAddress":        nil,
+		"gatewayIPAddress": "10.0.2.1",
+	})
+	err := plugin.MigrateEndpoint(fromArgs, toArgs)
+	assert.Error(t, err)
+	assert.True(t, nb.HasEndpoint(testContainerID))
+
+	// The endpoint is addressed from the pool of the new ENI.
+	toArgs = withIPAddressPool(t, toArgs, "10.0.2.20/24")
+	result, err := migrateEndpoint(t, plugin, fromArgs, toArgs)
+	require.NoError(t, err)
+	require.Len(t, result.IPs, 1)
+	assert.Equal(t, "10.0.2.20/24", result.IPs[0].Address.String())
+}
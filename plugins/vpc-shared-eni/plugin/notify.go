@@ -0,0 +1,109 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+const (
+	// notifyTimeout bounds the time spent delivering an endpoint notification, so that a stuck
+	// listener does not hold up CNI commands.
+	notifyTimeout = time.Second
+)
+
+// endpointNotification is the message sent to the notification socket after an endpoint is
+// attached to or detached from a container.
+type endpointNotification struct {
+	Event       string `json:"event"`
+	ContainerID string `json:"containerID"`
+	IfName      string `json:"ifName"`
+	// EndpointID is the ID of the endpoint object in the host network stack, if it has one.
+	EndpointID string `json:"endpointID,omitempty"`
+	// Endpoint is the name of the host-side network resource of the endpoint.
+	Endpoint string `json:"endpoint"`
+	// Compartment is the network namespace or compartment of the container.
+	Compartment string       `json:"compartment"`
+	MACAddress  string       `json:"macAddress,omitempty"`
+	IPAddress   string       `json:"ipAddress,omitempty"`
+	Gateway     string       `json:"gateway,omitempty"`
+	Pod         *podMetadata `json:"pod,omitempty"`
+}
+
+// notify sends a notification of an endpoint change to the configured notification socket, so
+// that the ECS agent can track attachment state without polling the host network stack itself.
+// Notifications are best-effort, and failures are logged and ignored.
+func (plugin *Plugin) notify(event string, args *cniSkel.CmdArgs, netConfig *config.NetConfig, ep *network.Endpoint) {
+	if plugin.Explain || netConfig.NotifySocket == "" {
+		return
+	}
+
+	n := endpointNotification{
+		Event:       event,
+		ContainerID: args.ContainerID,
+		IfName:      args.IfName,
+		EndpointID:  ep.ID,
+		Endpoint:    network.EndpointName(ep),
+		Compartment: args.Netns,
+		Pod:         newPodMetadata(netConfig),
+	}
+	if ep.NamespaceID != "" {
+		n.Compartment = ep.NamespaceID
+	}
+	if ep.MACAddress != nil {
+		n.MACAddress = ep.MACAddress.String()
+	}
+	if ep.IPAddress != nil {
+		n.IPAddress = ep.IPAddress.String()
+	}
+	if netConfig.GatewayIPAddress != nil {
+		n.Gateway = netConfig.GatewayIPAddress.String()
+	}
+
+	err := sendNotification(netConfig.NotifySocket, &n)
+	if err != nil {
+		log.Errorf("Failed to send %s notification to %s, ignoring: %v.", event, netConfig.NotifySocket, err)
+	}
+}
+
+// sendNotification writes a notification as a line of JSON to the unix domain socket at the
+// given path. Unix domain sockets are available on Windows as well.
+func sendNotification(socketPath string, n *endpointNotification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, notifyTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(notifyTimeout))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
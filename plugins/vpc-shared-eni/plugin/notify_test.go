@@ -0,0 +1,76 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	socketPath := filepath.Join(plugin.StateDirPath, "notify.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	notifications := make(chan endpointNotification, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			var n endpointNotification
+			if json.NewDecoder(bufio.NewReader(conn)).Decode(&n) == nil {
+				notifications <- n
+			}
+			conn.Close()
+		}
+	}()
+
+	args := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{"notifySocket": socketPath})
+	_, err = captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+	require.NoError(t, plugin.Del(args))
+
+	for _, event := range []string{"ADD", "DEL"} {
+		n := <-notifications
+		assert.Equal(t, event, n.Event)
+		assert.Equal(t, testContainerID, n.ContainerID)
+		assert.Equal(t, testIfName, n.IfName)
+		assert.Equal(t, testNetNS, n.Compartment)
+		assert.Equal(t, "10.0.1.20/24", n.IPAddress)
+		assert.Equal(t, "10.0.1.1", n.Gateway)
+	}
+}
+
+func TestNotifyWithoutListener(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	// Notifications are best-effort and do not fail CNI commands.
+	socketPath := filepath.Join(plugin.StateDirPath, "notify.sock")
+	args := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{"notifySocket": socketPath})
+	_, err := captureResult(t, func() error { return plugin.Add(args) })
+	assert.NoError(t, err)
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"sync"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+)
+
+// parallel runs the given independent steps concurrently, one goroutine per step, and waits for
+// all of them to complete. It returns the error of the first failed step in argument order.
+// A panic in a step is returned as a cni.PanicError, so that the command fails and rolls back
+// as usual, and the plugin writes a crash report.
+func parallel(steps ...func() error) error {
+	errs := make([]error, len(steps))
+
+	var wg sync.WaitGroup
+	wg.Add(len(steps))
+	for i, step := range steps {
+		go func(i int, step func() error) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = cni.NewPanicError(r)
+				}
+			}()
+			errs[i] = step()
+		}(i, step)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
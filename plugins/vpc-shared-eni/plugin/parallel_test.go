@@ -0,0 +1,65 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelRunsAllSteps(t *testing.T) {
+	var count int32
+	step := func() error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	}
+
+	assert.NoError(t, parallel(step, step, step))
+	assert.Equal(t, int32(3), count)
+}
+
+func TestParallelReturnsFirstError(t *testing.T) {
+	var count int32
+	fail := func(msg string) func() error {
+		return func() error {
+			atomic.AddInt32(&count, 1)
+			return fmt.Errorf(msg)
+		}
+	}
+
+	err := parallel(func() error { return nil }, fail("first"), fail("second"))
+	assert.EqualError(t, err, "first")
+	assert.Equal(t, int32(2), count)
+}
+
+func TestParallelRecoversPanic(t *testing.T) {
+	var count int32
+	step := func() error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	}
+
+	err := parallel(step, func() error { panic("boom") }, step)
+	panicErr, ok := err.(*cni.PanicError)
+	require.True(t, ok)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), "TestParallelRecoversPanic")
+	assert.Equal(t, int32(2), count)
+}
@@ -14,9 +14,19 @@
 package plugin
 
 import (
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-plugins/agent"
 	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/health"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/imds"
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
 	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
 
+	log "github.com/cihub/seelog"
 	cniVersion "github.com/containernetworking/cni/pkg/version"
 )
 
@@ -30,13 +40,21 @@ const (
 
 var (
 	// specVersions is the set of CNI spec versions supported by this plugin.
-	specVersions = cniVersion.PluginSupports("0.3.0", "0.3.1")
+	specVersions = cniVersion.PluginSupports(config.SpecVersions...)
 )
 
 // Plugin represents a vpc-shared-eni CNI plugin.
 type Plugin struct {
 	*cni.Plugin
-	nb network.Builder
+	nb            network.Builder
+	listEndpoints func() ([]network.EndpointRecord, error)
+	checkEndpoint func(ep *network.Endpoint) error
+	probeEndpoint func(ep *network.Endpoint) error
+	checkStatus   func() error
+	instanceTag   func(key string) (string, error)
+	healthChecks  func(stateDir string) []health.Check
+	// sandboxes are the synthetic sandboxes of a soak test, by network namespace.
+	sandboxes map[string]*network.Sandbox
 }
 
 // NewPlugin creates a new Plugin object.
@@ -49,7 +67,135 @@ func NewPlugin() (*Plugin, error) {
 		return nil, err
 	}
 
-	plugin.nb = &network.BridgeBuilder{}
+	// Only network builder operations and endpoint checks run with privileges.
+	plugin.SeparatePrivileges = true
+
+	nb := network.NewBridgeBuilder(plugin.StateDirPath)
+	plugin.nb = &privilegedBuilder{nb}
+	plugin.listEndpoints = network.ListEndpoints
+	plugin.checkEndpoint = privileged(network.CheckEndpoint)
+	plugin.probeEndpoint = privileged(nb.ProbeEndpoint)
+	plugin.checkStatus = func() error { return cni.Privileged(nb.CheckStatus) }
+	metadata := imds.NewCachedClient()
+	plugin.instanceTag = metadata.GetInstanceTag
+	config.RegisterMetadataHandler(metadata.GetMetadata)
+	plugin.healthChecks = health.DefaultChecks
 
 	return plugin, nil
 }
+
+// builder returns the network builder for the CNI command being executed.
+// In explain mode, the returned builder only plans operations without executing them.
+// If a node agent is configured, operations are delegated to it.
+func (plugin *Plugin) builder(netConfig *config.NetConfig) network.Builder {
+	if plugin.Explain {
+		return &network.ExplainBuilder{}
+	}
+
+	if netConfig.AgentSocket != "" {
+		return agent.NewBuilder(netConfig.AgentSocket)
+	}
+
+	return plugin.nb
+}
+
+// lockNetwork acquires the lock of the network on the given shared ENI, which serializes
+// network builder operations of plugin processes on the same ENI, and returns a function that
+// releases it. Operations on different ENIs also wait for one of the node-wide slots limiting
+// concurrent operations, if configured. No lock is needed in explain mode, or if operations are
+// delegated to an agent.
+func (plugin *Plugin) lockNetwork(netConfig *config.NetConfig, sharedENI *eni.ENI) (func(), error) {
+	if plugin.Explain || netConfig.AgentSocket != "" {
+		return func() {}, nil
+	}
+
+	unlock, err := state.LockNetwork(plugin.StateDirPath, sharedENI.GetMACAddress().String())
+	if err != nil {
+		log.Errorf("Failed to lock network %s: %v.", netConfig.Name, err)
+		return nil, err
+	}
+
+	if netConfig.MaxConcurrentOps == 0 {
+		return unlock, nil
+	}
+
+	// Wait for a slot while holding the network lock, so that slots are only held by
+	// operations ready to run.
+	release, err := state.AcquireSlot(plugin.StateDirPath, netConfig.MaxConcurrentOps)
+	if err != nil {
+		log.Errorf("Failed to acquire slot for network %s: %v.", netConfig.Name, err)
+		unlock()
+		return nil, err
+	}
+
+	return func() {
+		release()
+		unlock()
+	}, nil
+}
+
+// recordNetworkResult updates the persistent counter of consecutive network builder failures.
+func (plugin *Plugin) recordNetworkResult(opErr error) {
+	if plugin.Explain {
+		return
+	}
+
+	err := state.UpdateCounters(plugin.StateDirPath, func(counters state.Counters) {
+		if opErr != nil {
+			counters[state.CounterConsecutiveNetworkFailures]++
+		} else {
+			counters[state.CounterConsecutiveNetworkFailures] = 0
+		}
+	})
+	if err != nil {
+		log.Errorf("Failed to update counters: %v.", err)
+	}
+}
+
+// initState sets the key signing the state files of the plugin, if the host has one, and
+// upgrades state files written by older plugin versions. Signing is disabled if the host has
+// no key.
+func (plugin *Plugin) initState() error {
+	key, err := state.LoadHostSigningKey()
+	if err != nil {
+		log.Errorf("Failed to load state signing key: %v.", err)
+		return err
+	}
+
+	state.SetSigningKey(key)
+
+	err = state.Migrate(plugin.StateDirPath, stateSchemas())
+	if err != nil {
+		log.Errorf("Failed to migrate state files: %v.", err)
+		return err
+	}
+
+	return nil
+}
+
+// AdoptUnsignedState signs the state files written before the host's signing key was set, so
+// that they are trusted from then on.
+func (plugin *Plugin) AdoptUnsignedState() error {
+	key, err := state.LoadHostSigningKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("no state signing key in %s", state.GetSigningKeyFile())
+	}
+
+	state.SetSigningKey(key)
+
+	return state.AdoptUnsignedFiles(plugin.StateDirPath, stateSchemas())
+}
+
+// stateSchemas returns the schemas of all state files in the plugin state directory.
+func stateSchemas() []state.FileSchema {
+	schemas := []state.FileSchema{
+		state.CountersSchema,
+		ipam.PoolSchema,
+		resultsSchema,
+	}
+
+	return append(schemas, network.StateSchemas()...)
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/backoff"
+	"github.com/aws/amazon-vpc-cni-plugins/health"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// Prewarm prepares the host for the first container on the network with the given network
+// configuration, e.g. at instance boot. It validates the health of the host network stack,
+// fetches the instance metadata and pre-creates the container network of the shared ENI, which
+// also primes the HNS lookup cache on Windows. No container endpoint is created.
+func (plugin *Plugin) Prewarm(args *cniSkel.CmdArgs) error {
+	netConfig, err := config.New(args, false)
+	if err != nil {
+		return fmt.Errorf("failed to parse netconfig: %v", err)
+	}
+
+	log.Infof("Prewarming network %s with netconfig: %+v.", netConfig.Name, netConfig)
+	backoff.SetDefault(netConfig.Backoff)
+	network.SetHNSCallTimeout(netConfig.HNSCallTimeout.Min, netConfig.HNSCallTimeout.Max)
+
+	err = plugin.initState()
+	if err != nil {
+		return err
+	}
+
+	report := health.Run(plugin.healthChecks(plugin.StateDirPath))
+	if !report.Healthy {
+		return fmt.Errorf("health check failed: %+v", report.Results)
+	}
+
+	var sharedENI, standbyENI *eni.ENI
+	err = parallel(
+		func() error {
+			return plugin.fetchExtraPrefixesIfTagged(netConfig)
+		},
+		func() error {
+			var err error
+			sharedENI, standbyENI, err = findENIs(netConfig)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := plugin.lockNetwork(netConfig, sharedENI)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// The network is in use again if it was marked for deletion.
+	plugin.unmarkNetwork(netConfig)
+
+	nb := plugin.builder(netConfig)
+	err = nb.FindOrCreateNetwork(newNetwork(netConfig, sharedENI, standbyENI))
+	plugin.recordNetworkResult(err)
+	if err != nil {
+		return fmt.Errorf("failed to create network %s: %v", netConfig.Name, err)
+	}
+
+	// In explain mode, output the planned operations.
+	if eb, ok := nb.(*network.ExplainBuilder); ok {
+		return eb.Print(os.Stdout)
+	}
+
+	log.Infof("Prewarmed network %s.", netConfig.Name)
+	plugin.reapNetworks(netConfig)
+
+	return nil
+}
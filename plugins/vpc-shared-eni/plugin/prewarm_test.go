@@ -0,0 +1,78 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/health"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withHealth returns health checks that report the given error.
+func withHealth(err error) func(stateDir string) []health.Check {
+	return func(stateDir string) []health.Check {
+		return []health.Check{{Name: "test", Probe: func() error { return err }}}
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthErr   error
+		networkErr  error
+		expectError bool
+		expectOps   []string
+	}{
+		{
+			name:      "healthy",
+			expectOps: []string{fake.OpFindOrCreateNetwork},
+		},
+		{
+			name:        "unhealthy",
+			healthErr:   fmt.Errorf("hns unavailable"),
+			expectError: true,
+		},
+		{
+			name:        "network failure",
+			networkErr:  fmt.Errorf("hns timeout"),
+			expectError: true,
+			expectOps:   []string{fake.OpFindOrCreateNetwork},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, nb := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+			plugin.healthChecks = withHealth(test.healthErr)
+			if test.networkErr != nil {
+				nb.Failures[fake.OpFindOrCreateNetwork] = test.networkErr
+			}
+
+			err := plugin.Prewarm(newTestArgs(t, ""))
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, nb.HasNetwork(testNetworkName))
+			}
+			assert.Equal(t, test.expectOps, ops(nb.Calls()))
+		})
+	}
+}
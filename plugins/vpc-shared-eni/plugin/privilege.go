@@ -0,0 +1,62 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+)
+
+// privilegedBuilder is a network builder that runs the operations of another network builder
+// with the capabilities retained for privileged sections.
+type privilegedBuilder struct {
+	network.Builder
+}
+
+// FindOrCreateNetwork finds or creates a container network with privileges.
+func (pb *privilegedBuilder) FindOrCreateNetwork(nw *network.Network) error {
+	return cni.Privileged(func() error {
+		return pb.Builder.FindOrCreateNetwork(nw)
+	})
+}
+
+// DeleteNetwork deletes a container network with privileges.
+func (pb *privilegedBuilder) DeleteNetwork(nw *network.Network) error {
+	return cni.Privileged(func() error {
+		return pb.Builder.DeleteNetwork(nw)
+	})
+}
+
+// FindOrCreateEndpoint finds or creates a container endpoint with privileges.
+func (pb *privilegedBuilder) FindOrCreateEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	return cni.Privileged(func() error {
+		return pb.Builder.FindOrCreateEndpoint(nw, ep)
+	})
+}
+
+// DeleteEndpoint deletes a container endpoint with privileges.
+func (pb *privilegedBuilder) DeleteEndpoint(nw *network.Network, ep *network.Endpoint) error {
+	return cni.Privileged(func() error {
+		return pb.Builder.DeleteEndpoint(nw, ep)
+	})
+}
+
+// privileged returns an endpoint function that runs the given one with privileges.
+func privileged(fn func(ep *network.Endpoint) error) func(ep *network.Endpoint) error {
+	return func(ep *network.Endpoint) error {
+		return cni.Privileged(func() error {
+			return fn(ep)
+		})
+	}
+}
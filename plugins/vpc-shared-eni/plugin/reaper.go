@@ -0,0 +1,81 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	log "github.com/cihub/seelog"
+)
+
+// reaper returns the reaper of networks marked for deletion using the given network builder.
+func (plugin *Plugin) reaper(nb network.Builder) *network.Reaper {
+	return &network.Reaper{
+		StateDir:      plugin.StateDirPath,
+		Builder:       nb,
+		ListEndpoints: plugin.listEndpoints,
+	}
+}
+
+// deleteNetworkIfUnused deletes the network after the deletion of one of its endpoints, or marks
+// it for deletion, according to the network deletion mode. Must be called with the network lock held.
+func (plugin *Plugin) deleteNetworkIfUnused(netConfig *config.NetConfig, nb network.Builder, nw *network.Network) {
+	var err error
+
+	switch netConfig.NetworkDeletion {
+	case config.NetworkDeletionImmediate:
+		_, err = plugin.reaper(nb).DeleteIfUnused(nw)
+	case config.NetworkDeletionDeferred:
+		if plugin.Explain {
+			return
+		}
+		log.Infof("Marking network %s for deletion.", nw.Name)
+		err = network.MarkForDeletion(plugin.StateDirPath, nw)
+	}
+
+	if err != nil {
+		log.Errorf("Failed to delete network %s, ignoring: %v.", nw.Name, err)
+	}
+}
+
+// unmarkNetwork clears the deletion mark of the network in the given network configuration.
+func (plugin *Plugin) unmarkNetwork(netConfig *config.NetConfig) {
+	if plugin.Explain {
+		return
+	}
+
+	err := network.UnmarkForDeletion(plugin.StateDirPath, netConfig.Name, netConfig.OwnerID)
+	if err != nil {
+		log.Errorf("Failed to clear deletion mark of network %s, ignoring: %v.", netConfig.Name, err)
+	}
+}
+
+// reapNetworks completes the deferred deletion of networks other than the one in the given
+// network configuration, which is in use.
+func (plugin *Plugin) reapNetworks(netConfig *config.NetConfig) {
+	if plugin.Explain || netConfig.AgentSocket != "" {
+		return
+	}
+
+	deleted, err := plugin.reaper(plugin.nb).Reap(func(name string, ownerID string) bool {
+		return name == netConfig.Name && ownerID == netConfig.OwnerID
+	})
+	if err != nil {
+		log.Errorf("Failed to delete networks marked for deletion, ignoring: %v.", err)
+	}
+	if len(deleted) != 0 {
+		log.Infof("Deleted networks marked for deletion: %v.", deleted)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withNetworkDeletion returns CNI arguments for a network with the given network deletion mode.
+func withNetworkDeletion(t *testing.T, containerID string, networkName string, mode string) *cniSkel.CmdArgs {
+	return withNetConfig(t, newTestArgs(t, containerID), map[string]interface{}{
+		"name":            networkName,
+		"networkDeletion": mode,
+	})
+}
+
+// countOps returns the number of calls to the given operation.
+func countOps(calls []fake.Call, op string) int {
+	count := 0
+	for _, call := range calls {
+		if call.Op == op {
+			count++
+		}
+	}
+	return count
+}
+
+func TestNetworkDeletionKeep(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container1", "vpc", "keep")))
+	require.NoError(t, plugin.Del(withNetworkDeletion(t, "container1", "vpc", "keep")))
+
+	assert.True(t, nb.HasNetwork("vpc"))
+	assert.Zero(t, countOps(nb.Calls(), fake.OpDeleteNetwork))
+}
+
+func TestNetworkDeletionImmediate(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container1", "vpc", "immediate")))
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container2", "vpc", "immediate")))
+
+	// The network is deleted with its last endpoint.
+	require.NoError(t, plugin.Del(withNetworkDeletion(t, "container1", "vpc", "immediate")))
+	assert.True(t, nb.HasNetwork("vpc"))
+
+	require.NoError(t, plugin.Del(withNetworkDeletion(t, "container2", "vpc", "immediate")))
+	assert.False(t, nb.HasNetwork("vpc"))
+}
+
+func TestNetworkDeletionDeferred(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container1", "vpc", "deferred")))
+	require.NoError(t, plugin.Del(withNetworkDeletion(t, "container1", "vpc", "deferred")))
+
+	// DEL only marks the network for deletion.
+	assert.True(t, nb.HasNetwork("vpc"))
+	assert.Zero(t, countOps(nb.Calls(), fake.OpDeleteNetwork))
+
+	// The next ADD on another network completes the deletion.
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container2", "vpc2", "deferred")))
+	assert.False(t, nb.HasNetwork("vpc"))
+	assert.True(t, nb.HasNetwork("vpc2"))
+
+	// Deletions are completed once.
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container3", "vpc2", "deferred")))
+	assert.Equal(t, 1, countOps(nb.Calls(), fake.OpDeleteNetwork))
+}
+
+func TestNetworkDeletionDeferredReused(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container1", "vpc", "deferred")))
+	require.NoError(t, plugin.Del(withNetworkDeletion(t, "container1", "vpc", "deferred")))
+
+	// Adding an endpoint to the network clears its deletion mark.
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container2", "vpc", "deferred")))
+	require.NoError(t, plugin.Add(withNetworkDeletion(t, "container3", "vpc2", "deferred")))
+
+	assert.True(t, nb.HasNetwork("vpc"))
+	assert.Zero(t, countOps(nb.Calls(), fake.OpDeleteNetwork))
+}
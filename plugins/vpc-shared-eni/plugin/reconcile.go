@@ -0,0 +1,104 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	log "github.com/cihub/seelog"
+)
+
+// ReconcileState rebuilds the IP address pool state of all container networks from the
+// endpoints found in the live network configuration, so that DEL and CHECK commands for
+// existing containers keep working after the state files are lost or corrupted.
+func (plugin *Plugin) ReconcileState() error {
+	records, err := plugin.listEndpoints()
+	if err != nil {
+		return fmt.Errorf("failed to list endpoints: %v", err)
+	}
+
+	// Allocations are restored to the CNI stacks that own the endpoints.
+	type poolOwner struct {
+		networkName string
+		ownerID     string
+	}
+
+	allocations := make(map[poolOwner]map[string]string)
+	truncated := make(map[poolOwner]map[string]bool)
+	for _, record := range records {
+		if record.IPAddress == nil {
+			continue
+		}
+		key := poolOwner{networkName: record.NetworkName, ownerID: record.OwnerID}
+		if allocations[key] == nil {
+			allocations[key] = make(map[string]string)
+			truncated[key] = make(map[string]bool)
+		}
+		allocations[key][record.ContainerID] = record.IPAddress.String()
+		if record.Truncated {
+			truncated[key][record.ContainerID] = true
+		}
+	}
+
+	for key, networkAllocations := range allocations {
+		pool := ipam.NewPool(plugin.StateDirPath, key.networkName, nil)
+		pool.SetOwner(key.ownerID)
+		restored, err := pool.Restore(networkAllocations, truncated[key])
+		if err != nil {
+			return fmt.Errorf("failed to restore IP address pool of network %s: %v", key.networkName, err)
+		}
+		log.Infof("Restored %d of %d IP address allocations in network %s.",
+			restored, len(networkAllocations), key.networkName)
+	}
+
+	return nil
+}
+
+// findEndpointIPAddress searches the live network configuration for the IP address of the
+// given container's endpoint owned by the given CNI stack. Returns nil if the endpoint is not found.
+func (plugin *Plugin) findEndpointIPAddress(networkName string, containerID string, ownerID string) *net.IPNet {
+	record, err := plugin.findEndpoint(networkName, containerID, ownerID)
+	if err != nil {
+		log.Errorf("Failed to list endpoints: %v.", err)
+		return nil
+	}
+	if record == nil {
+		return nil
+	}
+
+	return record.IPAddress
+}
+
+// findEndpoint searches the live network configuration for the given container's endpoint
+// owned by the given CNI stack. Returns nil if the endpoint is not found.
+func (plugin *Plugin) findEndpoint(networkName string, containerID string, ownerID string) (*network.EndpointRecord, error) {
+	records, err := plugin.listEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, record := range records {
+		if record.NetworkName == networkName &&
+			record.OwnerID == ownerID &&
+			ipam.MatchContainerID(containerID, record.ContainerID, record.Truncated) {
+			return &records[i], nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/ipam"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withEndpoints makes the plugin see the given live endpoints.
+func withEndpoints(plugin *Plugin, records ...network.EndpointRecord) {
+	plugin.listEndpoints = func() ([]network.EndpointRecord, error) {
+		return records, nil
+	}
+}
+
+func newTestEndpointRecord(t *testing.T, containerID string, address string) network.EndpointRecord {
+	ip, ipNet, err := net.ParseCIDR(address)
+	require.NoError(t, err)
+	ipNet.IP = ip
+
+	return network.EndpointRecord{
+		NetworkName: testNetworkName,
+		ContainerID: containerID,
+		IPAddress:   ipNet,
+	}
+}
+
+func TestReconcileStateAfterCorruption(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	pool := []string{"10.0.1.20/24", "10.0.1.21/24"}
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+
+	// Corrupt the pool state and rebuild it from the live endpoint.
+	path := filepath.Join(plugin.StateDirPath, "ipam-"+testNetworkName+".json")
+	require.NoError(t, ioutil.WriteFile(path, []byte("{garbage"), 0600))
+	withEndpoints(plugin, newTestEndpointRecord(t, "container1", "10.0.1.20/24"))
+	require.NoError(t, plugin.ReconcileState())
+
+	allocations, err := ipam.NewPool(plugin.StateDirPath, testNetworkName, nil).Allocations()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"container1": "10.0.1.20/24"}, allocations)
+
+	// The restored address is not handed out again.
+	require.NoError(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container2"), pool...)))
+	assert.Error(t, plugin.Add(withIPAddressPool(t, newTestArgs(t, "container3"), pool...)))
+	assert.False(t, nb.HasEndpoint("container3"))
+}
+
+func TestDelRecoversIPAddressFromLiveEndpoint(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	// The pool state was lost, but the endpoint, named after a truncated container ID, is live.
+	record := newTestEndpointRecord(t, "contai", "10.0.1.21/24")
+	record.Truncated = true
+	withEndpoints(plugin, record)
+
+	assert.Equal(t, "10.0.1.21/24", plugin.findEndpointIPAddress(testNetworkName, "container1", "").String())
+	assert.Nil(t, plugin.findEndpointIPAddress("other", "container1", ""))
+
+	// Container IDs that are not truncated are matched exactly.
+	withEndpoints(plugin, newTestEndpointRecord(t, "c1", "10.0.1.21/24"))
+	assert.Nil(t, plugin.findEndpointIPAddress(testNetworkName, "c10", ""))
+	withEndpoints(plugin, record)
+
+	pool := []string{"10.0.1.20/24", "10.0.1.21/24"}
+	assert.NoError(t, plugin.Del(withIPAddressPool(t, newTestArgs(t, "container1"), pool...)))
+	assert.Len(t, nb.Calls(), 1)
+}
@@ -0,0 +1,284 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+)
+
+const (
+	// resultsDirName is the name of the state directory keeping the results of ADD commands.
+	resultsDirName = "results"
+
+	// fullCheckInterval is how long CHECK commands trust the last full check of an endpoint and
+	// only probe that it still exists.
+	fullCheckInterval = time.Minute
+)
+
+// resultsSchema is the schema of the cached results in the state directory.
+var resultsSchema = state.FileSchema{
+	Name:    "results",
+	Pattern: filepath.Join(resultsDirName, "*.json"),
+}
+
+// cachedResult is the result of a successful ADD command, kept until the matching DEL command.
+type cachedResult struct {
+	// ConfigHash identifies the network configuration and arguments of the ADD command.
+	ConfigHash string
+	Result     *cniTypesCurrent.Result
+	// CheckedAt is when the endpoint was last created or fully checked.
+	CheckedAt time.Time
+	// ContainerID, IfName and EndpointName map the container interface to its host-side
+	// endpoint, and Pod to its Kubernetes pod, for the list-endpoints debug command.
+	ContainerID  string
+	IfName       string
+	EndpointName string
+	Pod          *podMetadata `json:",omitempty"`
+	// Tap is how virtual machines attach to TAP and macvtap endpoints.
+	Tap *tapAttachment `json:",omitempty"`
+}
+
+// resultPath returns the path of the cached result of the given container interface.
+// Returns an empty string if the container ID cannot be used in a file name.
+func (plugin *Plugin) resultPath(args *cniSkel.CmdArgs) string {
+	name := fmt.Sprintf("%s-%s.json", args.ContainerID, args.IfName)
+	if args.ContainerID == "" || filepath.Base(name) != name {
+		return ""
+	}
+
+	return filepath.Join(plugin.StateDirPath, resultsDirName, name)
+}
+
+// configHash returns a hash identifying the network configuration and arguments of a command.
+func configHash(args *cniSkel.CmdArgs) string {
+	hash := sha256.New()
+	for _, field := range []string{string(args.StdinData), args.Netns, args.Args} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// addFromCache writes the result of an identical previous ADD command to stdout, if the
+// endpoint it created is still connected. This lets runtimes retry ADD commands cheaply.
+// Returns false if the full ADD command needs to run.
+func (plugin *Plugin) addFromCache(args *cniSkel.CmdArgs, netConfig *config.NetConfig) bool {
+	path := plugin.resultPath(args)
+	if plugin.Explain || path == "" {
+		return false
+	}
+
+	var cached cachedResult
+	found, err := state.ReadJSONFile(path, &cached)
+	if err != nil {
+		log.Errorf("Failed to read cached result, ignoring: %v.", err)
+		return false
+	}
+	if !found || cached.ConfigHash != configHash(args) || cached.Result == nil || len(cached.Result.IPs) == 0 {
+		return false
+	}
+
+	ep := cachedEndpoint(args, netConfig, &cached)
+	err = plugin.checkEndpoint(ep)
+	if err != nil {
+		log.Infof("Cached result of container %s is stale: %v.", args.ContainerID, err)
+		return false
+	}
+
+	log.Infof("Writing cached CNI result to stdout: %+v", cached.Result)
+	err = printResult(cached.Result, cached.Tap, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print cached result for CNI ADD command: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// check verifies that the container is still connected as recorded by its ADD command. The
+// endpoint is fully checked at most once per fullCheckInterval. In between, the cached result
+// and a lightweight existence probe suffice, so that storms of CHECK commands do not overload
+// the network stack.
+func (plugin *Plugin) check(args *cniSkel.CmdArgs, netConfig *config.NetConfig) error {
+	path := plugin.resultPath(args)
+	if path == "" {
+		return fmt.Errorf("invalid container ID %s", args.ContainerID)
+	}
+
+	var cached cachedResult
+	found, err := state.ReadJSONFile(path, &cached)
+	if err != nil {
+		log.Errorf("Failed to read cached result: %v.", err)
+		return err
+	}
+	if !found || cached.Result == nil || len(cached.Result.IPs) == 0 {
+		return fmt.Errorf("container %s interface %s was not added", args.ContainerID, args.IfName)
+	}
+
+	ep := cachedEndpoint(args, netConfig, &cached)
+	if time.Since(cached.CheckedAt) < fullCheckInterval {
+		err = plugin.probeEndpoint(ep)
+		if err == nil {
+			return nil
+		}
+		log.Infof("Endpoint of container %s failed probe: %v.", args.ContainerID, err)
+	}
+
+	err = plugin.checkEndpoint(ep)
+	if err != nil {
+		log.Errorf("Endpoint of container %s failed check: %v.", args.ContainerID, err)
+		return err
+	}
+
+	if !plugin.Explain {
+		// Do not recreate the cached result if a DEL command removed it meanwhile.
+		var current cachedResult
+		err = state.UpdateJSONFile(path, &current, func() error {
+			if current.Result == nil {
+				return fmt.Errorf("cached result was removed")
+			}
+			current.CheckedAt = time.Now()
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Failed to update cached result, ignoring: %v.", err)
+		}
+	}
+
+	return nil
+}
+
+// cachedEndpoint returns the endpoint described by the cached result of an ADD command.
+func cachedEndpoint(args *cniSkel.CmdArgs, netConfig *config.NetConfig, cached *cachedResult) *network.Endpoint {
+	return &network.Endpoint{
+		ContainerID: args.ContainerID,
+		NetNSName:   args.Netns,
+		IfName:      args.IfName,
+		IPAddress:   &cached.Result.IPs[0].Address,
+
+		SandboxIsolation: netConfig.Sandbox.Isolation,
+		ManagedNamespace: netConfig.Sandbox.ManagedNamespace,
+		OwnerID:          netConfig.OwnerID,
+	}
+}
+
+// cacheResult keeps the result of a successful ADD command for repeated ADD commands.
+func (plugin *Plugin) cacheResult(
+	args *cniSkel.CmdArgs,
+	netConfig *config.NetConfig,
+	result *cniTypesCurrent.Result,
+	tap *tapAttachment) {
+
+	path := plugin.resultPath(args)
+	if plugin.Explain || path == "" {
+		return
+	}
+
+	var cached cachedResult
+	err := state.UpdateJSONFile(path, &cached, func() error {
+		cached = cachedResult{
+			ConfigHash:   configHash(args),
+			Result:       result,
+			CheckedAt:    time.Now(),
+			ContainerID:  args.ContainerID,
+			IfName:       args.IfName,
+			EndpointName: endpointName(args, netConfig),
+			Pod:          newPodMetadata(netConfig),
+			Tap:          tap,
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Failed to cache result, ignoring: %v.", err)
+	}
+}
+
+// forgetResult removes the cached result of an ADD command.
+func (plugin *Plugin) forgetResult(args *cniSkel.CmdArgs) {
+	path := plugin.resultPath(args)
+	if plugin.Explain || path == "" {
+		return
+	}
+
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to remove cached result, ignoring: %v.", err)
+	}
+}
+
+// endpointListing describes a container endpoint in the output of the list-endpoints command.
+type endpointListing struct {
+	ContainerID string       `json:"containerID"`
+	IfName      string       `json:"ifName"`
+	IPAddress   string       `json:"ipAddress,omitempty"`
+	Endpoint    string       `json:"endpoint,omitempty"`
+	Pod         *podMetadata `json:"pod,omitempty"`
+}
+
+// ListEndpoints writes the endpoints of the containers with cached results to w, one JSON
+// object per line, so that operators can map host-side endpoints back to containers and pods.
+func (plugin *Plugin) ListEndpoints(w io.Writer) error {
+	paths, err := filepath.Glob(filepath.Join(plugin.StateDirPath, resultsDirName, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	encoder := json.NewEncoder(w)
+	for _, path := range paths {
+		var cached cachedResult
+		found, err := state.ReadJSONFile(path, &cached)
+		if err != nil {
+			log.Errorf("Failed to read cached result %s, skipping: %v.", path, err)
+			continue
+		}
+		if !found {
+			continue
+		}
+
+		listing := endpointListing{
+			ContainerID: cached.ContainerID,
+			IfName:      cached.IfName,
+			Endpoint:    cached.EndpointName,
+			Pod:         cached.Pod,
+		}
+		if cached.Result != nil && len(cached.Result.IPs) != 0 {
+			listing.IPAddress = cached.Result.IPs[0].Address.String()
+		}
+
+		err = encoder.Encode(&listing)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
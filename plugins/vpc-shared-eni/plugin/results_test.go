@@ -0,0 +1,272 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network/fake"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkFakeEndpoint returns an endpoint checker backed by the given fake network builder.
+func checkFakeEndpoint(nb *fake.Builder) func(ep *network.Endpoint) error {
+	return func(ep *network.Endpoint) error {
+		if !nb.HasEndpoint(ep.ContainerID) {
+			return fmt.Errorf("endpoint %s not found", ep.ContainerID)
+		}
+		return nil
+	}
+}
+
+func TestAddFromCache(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.checkEndpoint = checkFakeEndpoint(nb)
+
+	first, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+	require.NoError(t, err)
+	second, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, []string{fake.OpFindOrCreateNetwork, fake.OpFindOrCreateEndpoint}, ops(nb.Calls()))
+}
+
+func TestAddFromCacheMiss(t *testing.T) {
+	tests := []struct {
+		name   string
+		check  func(ep *network.Endpoint) error
+		modify func(plugin *Plugin)
+	}{
+		{
+			name:  "stale endpoint",
+			check: func(ep *network.Endpoint) error { return fmt.Errorf("veth link is down") },
+		},
+		{
+			name: "deleted container",
+			modify: func(plugin *Plugin) {
+				require.NoError(t, plugin.Del(newTestArgs(t, testContainerID)))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, nb := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+			plugin.checkEndpoint = checkFakeEndpoint(nb)
+			if test.check != nil {
+				plugin.checkEndpoint = test.check
+			}
+
+			_, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+			require.NoError(t, err)
+			if test.modify != nil {
+				test.modify(plugin)
+			}
+			_, err = captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+			require.NoError(t, err)
+
+			assert.Contains(t, ops(nb.Calls())[2:], fake.OpFindOrCreateEndpoint)
+		})
+	}
+}
+
+func TestAddFromCacheChangedConfig(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.checkEndpoint = checkFakeEndpoint(nb)
+
+	_, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+	require.NoError(t, err)
+
+	args := newTestArgs(t, testContainerID)
+	withNetConfig(t, args, map[string]interface{}{"ipAddress": "10.0.1.21/24"})
+	result, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+
+	assert.Equal(t, "10.0.1.21/24", result.IPs[0].Address.String())
+	assert.Len(t, nb.Calls(), 4)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		stale     bool
+		probeErr  error
+		fullCheck bool
+	}{
+		{name: "fresh"},
+		{name: "stale", stale: true, fullCheck: true},
+		{name: "failed probe", probeErr: fmt.Errorf("endpoint not cached"), fullCheck: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, nb := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+
+			var probed, checked int
+			plugin.probeEndpoint = func(ep *network.Endpoint) error {
+				probed++
+				return test.probeErr
+			}
+			plugin.checkEndpoint = func(ep *network.Endpoint) error {
+				checked++
+				return checkFakeEndpoint(nb)(ep)
+			}
+
+			args := newTestArgs(t, testContainerID)
+			_, err := captureResult(t, func() error { return plugin.Add(args) })
+			require.NoError(t, err)
+			if test.stale {
+				path := plugin.resultPath(args)
+				var cached cachedResult
+				require.NoError(t, state.UpdateJSONFile(path, &cached, func() error {
+					cached.CheckedAt = time.Now().Add(-fullCheckInterval)
+					return nil
+				}))
+			}
+
+			require.NoError(t, plugin.Check(args))
+			assert.Equal(t, test.fullCheck, checked == 1)
+			assert.Len(t, nb.Calls(), 2)
+
+			// A full check is trusted by the next CHECK command.
+			probed = 0
+			require.NoError(t, plugin.Check(args))
+			assert.Equal(t, 1, probed)
+		})
+	}
+}
+
+func TestCheckNotAdded(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.checkEndpoint = checkFakeEndpoint(nb)
+
+	args := newTestArgs(t, testContainerID)
+	assert.Error(t, plugin.Check(args))
+
+	_, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+	require.NoError(t, plugin.Del(args))
+	assert.Error(t, plugin.Check(args))
+}
+
+func TestCheckSignedResults(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	defer state.SetSigningKey(nil)
+	plugin.checkEndpoint = checkFakeEndpoint(nb)
+
+	keyFile := filepath.Join(plugin.StateDirPath, "state.key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(strings.Repeat("k", 32)), 0600))
+	os.Setenv("VPC_CNI_STATE_KEY_FILE", keyFile)
+	defer os.Unsetenv("VPC_CNI_STATE_KEY_FILE")
+
+	args1 := newTestArgs(t, "container1")
+	args2 := newTestArgs(t, "container2")
+	for _, args := range []*cniSkel.CmdArgs{args1, args2} {
+		_, err := captureResult(t, func() error { return plugin.Add(args) })
+		require.NoError(t, err)
+	}
+	require.NoError(t, plugin.Check(args2))
+
+	// The cached result of one container cannot be passed off as that of another.
+	data, err := ioutil.ReadFile(plugin.resultPath(args1))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(plugin.resultPath(args2), data, 0600))
+	assert.Error(t, plugin.Check(args2))
+}
+
+func TestAdoptUnsignedState(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	defer state.SetSigningKey(nil)
+	plugin.checkEndpoint = checkFakeEndpoint(nb)
+
+	// State is written before the host has a signing key.
+	args := newTestArgs(t, testContainerID)
+	_, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(plugin.StateDirPath, "state.key")
+	os.Setenv("VPC_CNI_STATE_KEY_FILE", keyFile)
+	defer os.Unsetenv("VPC_CNI_STATE_KEY_FILE")
+	assert.Error(t, plugin.AdoptUnsignedState())
+
+	// Unsigned state is rejected until the operator adopts it.
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(strings.Repeat("k", 32)), 0600))
+	assert.Error(t, plugin.Check(args))
+	require.NoError(t, plugin.AdoptUnsignedState())
+	assert.NoError(t, plugin.Check(args))
+}
+
+func TestListEndpoints(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	args := newTestArgs(t, testContainerID)
+	args.Args = "K8S_POD_NAMESPACE=team-a;K8S_POD_NAME=pod-1;K8S_POD_INFRA_CONTAINER_ID=infra1"
+	_, err := captureResult(t, func() error { return plugin.Add(args) })
+	require.NoError(t, err)
+
+	// Container IDs and interface names with dashes are listed as recorded.
+	dashArgs := newTestArgs(t, "container-with-dashes")
+	dashArgs.IfName = "eth-1"
+	plugin.cacheResult(dashArgs, &config.NetConfig{}, &cniTypesCurrent.Result{}, nil)
+
+	var out strings.Builder
+	require.NoError(t, plugin.ListEndpoints(&out))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var listing endpointListing
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &listing))
+	assert.Equal(t, "container-with-dashes", listing.ContainerID)
+	assert.Equal(t, "eth-1", listing.IfName)
+
+	assert.JSONEq(t, fmt.Sprintf(`{"containerID":"container1", "ifName":"eth0", "ipAddress":"10.0.1.20/24",
+	  "endpoint":"%s", "pod":{"namespace":"team-a", "name":"pod-1", "infraContainerID":"infra1"}}`,
+		endpointName(args, &config.NetConfig{Kubernetes: config.KubernetesConfig{PodInfraContainerID: "infra1"}})),
+		lines[1])
+}
+
+func TestInitStateNewerVersion(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	versionsPath := filepath.Join(plugin.StateDirPath, state.VersionsFileName)
+	require.NoError(t, ioutil.WriteFile(versionsPath, []byte(`{"results":99}`), 0600))
+
+	_, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+	assert.Error(t, err)
+}
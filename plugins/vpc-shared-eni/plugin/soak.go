@@ -0,0 +1,72 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+)
+
+// CreateSandbox creates a synthetic sandbox for soak tests and returns its network namespace.
+func (plugin *Plugin) CreateSandbox(name string) (string, error) {
+	sandbox, err := network.NewSandbox(name)
+	if err != nil {
+		return "", err
+	}
+
+	if plugin.sandboxes == nil {
+		plugin.sandboxes = make(map[string]*network.Sandbox)
+	}
+	plugin.sandboxes[sandbox.NetNS()] = sandbox
+
+	return sandbox.NetNS(), nil
+}
+
+// DeleteSandbox deletes a sandbox created by CreateSandbox.
+func (plugin *Plugin) DeleteSandbox(netns string) error {
+	sandbox, ok := plugin.sandboxes[netns]
+	if !ok {
+		return fmt.Errorf("sandbox %s not found", netns)
+	}
+
+	delete(plugin.sandboxes, netns)
+	return sandbox.Delete()
+}
+
+// SoakFaults returns the faults that soak tests can inject on this platform.
+func (plugin *Plugin) SoakFaults() []string {
+	return network.SoakFaults()
+}
+
+// InjectFault injects the named fault into the network stack of a sandbox.
+func (plugin *Plugin) InjectFault(fault string, netns string) error {
+	sandbox, ok := plugin.sandboxes[netns]
+	if !ok {
+		return fmt.Errorf("sandbox %s not found", netns)
+	}
+
+	return sandbox.InjectFault(fault)
+}
+
+// CountEndpoints returns the number of container endpoints on the host, found in the live
+// network inventory rather than in plugin state, so that soak tests detect leaked endpoints.
+func (plugin *Plugin) CountEndpoints() (int, error) {
+	endpoints, err := plugin.listEndpoints()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(endpoints), nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountEndpoints(t *testing.T) {
+	plugin, nb := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.listEndpoints = nb.ListEndpoints
+
+	_, err := captureResult(t, func() error { return plugin.Add(newTestArgs(t, "container1")) })
+	require.NoError(t, err)
+	_, err = captureResult(t, func() error { return plugin.Add(newTestArgs(t, "container2")) })
+	require.NoError(t, err)
+
+	count, err := plugin.CountEndpoints()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestUnknownSandbox(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	assert.Error(t, plugin.DeleteSandbox("/var/run/netns/unknown"))
+	assert.Error(t, plugin.InjectFault("delete-sandbox", "/var/run/netns/unknown"))
+}
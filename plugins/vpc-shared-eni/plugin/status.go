@@ -0,0 +1,112 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/network/eni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// readinessCheck is the result of a check of a component the plugin needs to connect containers.
+type readinessCheck struct {
+	name string
+	err  error
+	// code is the CNI error code reported if the check failed.
+	code uint
+}
+
+// Status is the CNI STATUS command handler. It reports whether the plugin is ready to connect
+// containers to the network in the given configuration. All components are checked, and the
+// failed checks are listed in the details of the error.
+func (plugin *Plugin) Status(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args, false)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing STATUS with netconfig: %+v.", netConfig)
+
+	// Containers are connected by the agent if one is configured.
+	var checks []readinessCheck
+	if netConfig.AgentSocket == "" {
+		checks = append(checks, readinessCheck{
+			name: "network service",
+			err:  plugin.checkStatus(),
+			code: cni.ErrCodeNotAvailable,
+		})
+	}
+
+	// Existing containers lose connectivity if an ENI disappears.
+	sharedENI, err := eni.NewENI(netConfig.ENIName, netConfig.ENIMACAddress)
+	if err == nil {
+		err = sharedENI.AttachToLink()
+	}
+	checks = append(checks, readinessCheck{
+		name: "ENI",
+		err:  err,
+		code: cni.ErrCodeNotAvailableLimitedConnectivity,
+	})
+
+	if netConfig.StandbyENIName != "" || netConfig.StandbyENIMACAddress != nil {
+		var standbyENI *eni.ENI
+		standbyENI, err = eni.NewENI(netConfig.StandbyENIName, netConfig.StandbyENIMACAddress)
+		if err == nil {
+			err = standbyENI.AttachToLink()
+		}
+		checks = append(checks, readinessCheck{
+			name: "standby ENI",
+			err:  err,
+			code: cni.ErrCodeNotAvailable,
+		})
+	}
+
+	return readinessError(checks)
+}
+
+// readinessError returns the CNI error reporting the failed readiness checks, or nil if all
+// checks passed. The error code is the most severe code of the failed checks.
+func readinessError(checks []readinessCheck) error {
+	var failed []string
+	var code uint
+	for _, check := range checks {
+		if check.err == nil {
+			continue
+		}
+		log.Errorf("Readiness check %s failed: %v.", check.name, check.err)
+		failed = append(failed, fmt.Sprintf("%s: %v", check.name, check.err))
+		if check.code > code {
+			code = check.code
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &cniTypes.Error{
+		Code:    code,
+		Msg:     "plugin is not ready",
+		Details: strings.Join(failed, "; "),
+	}
+}
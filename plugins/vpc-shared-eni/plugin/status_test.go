@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusReady(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	plugin.checkStatus = func() error { return nil }
+
+	assert.NoError(t, plugin.Status(newTestArgs(t, "")))
+}
+
+func TestStatusNotReady(t *testing.T) {
+	serviceErr := errors.New("service not running")
+
+	tests := []struct {
+		name          string
+		serviceErr    error
+		fields        map[string]interface{}
+		expectCode    uint
+		expectDetails string
+	}{
+		{"network service", serviceErr, nil, cni.ErrCodeNotAvailable,
+			"network service: service not running"},
+		{"missing ENI", nil, map[string]interface{}{"eniName": "vpcmissing0"},
+			cni.ErrCodeNotAvailableLimitedConnectivity, "ENI: "},
+		{"missing ENI and network service", serviceErr, map[string]interface{}{"eniName": "vpcmissing0"},
+			cni.ErrCodeNotAvailableLimitedConnectivity, "network service: service not running; ENI: "},
+		{"missing standby ENI", nil, map[string]interface{}{"standbyENIName": "vpcmissing1", "agentSocket": "/tmp/agent.sock"},
+			cni.ErrCodeNotAvailable, "standby ENI: "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, _ := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+			plugin.checkStatus = func() error { return test.serviceErr }
+
+			err := plugin.Status(withNetConfig(t, newTestArgs(t, ""), test.fields))
+			require.Error(t, err)
+
+			cniErr, ok := err.(*cniTypes.Error)
+			require.True(t, ok, "error is not a CNI error: %v", err)
+			assert.Equal(t, test.expectCode, cniErr.Code)
+			assert.Equal(t, "plugin is not ready", cniErr.Msg)
+			assert.Contains(t, cniErr.Details, test.expectDetails)
+		})
+	}
+}
+
+func TestStatusWithAgent(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	// The agent connects containers, so the network service of the plugin is not checked.
+	plugin.checkStatus = func() error { return errors.New("service not running") }
+	args := withNetConfig(t, newTestArgs(t, ""), map[string]interface{}{"agentSocket": "/tmp/agent.sock"})
+
+	assert.NoError(t, plugin.Status(args))
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cni"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// tapResultKey is the key of the TAP attachment in CNI results. Runtimes that do not expect
+// it ignore unknown keys.
+const tapResultKey = "tap"
+
+// tapAttachment describes how a virtual machine monitor, such as Firecracker or the one of a
+// Kata Containers sandbox, attaches to a TAP or macvtap endpoint in the sandbox.
+type tapAttachment struct {
+	// IfName is the name of the TAP or macvtap link in the sandbox.
+	IfName string `json:"ifName"`
+	// Type is the interface type of the endpoint, either tap or macvtap.
+	Type string `json:"type"`
+	// Device is the path of the character device opened to get the file descriptor of the
+	// link. TAP links are attached by name through the TUNSETIFF ioctl on the clone device.
+	Device  string `json:"device"`
+	Sandbox string `json:"sandbox"`
+	// MACAddress is the MAC address the virtual machine's interface is expected to use.
+	// Empty for TAP links, whose frames carry the virtual machine's own MAC address.
+	MACAddress string `json:"mac,omitempty"`
+	// UserID is the user allowed to open the device.
+	UserID int `json:"uid"`
+}
+
+// newTapAttachment returns the TAP attachment of an endpoint, or nil for veth endpoints.
+func newTapAttachment(ep *network.Endpoint, ifName string, sandbox string, uid int) *tapAttachment {
+	if ep.TapDevice == "" {
+		return nil
+	}
+
+	tap := &tapAttachment{
+		IfName:  ifName,
+		Type:    ep.IfType,
+		Device:  ep.TapDevice,
+		Sandbox: sandbox,
+		UserID:  uid,
+	}
+	if ep.IfType == config.IfTypeMacvtap {
+		tap.MACAddress = ep.MACAddress.String()
+	}
+
+	return tap
+}
+
+// printResult writes a CNI result in the given version to stdout, along with the TAP
+// attachment of the endpoint if there is one.
+func printResult(result cniTypes.Result, tap *tapAttachment, cniVersion string) error {
+	if tap == nil {
+		return cni.PrintResult(result, cniVersion)
+	}
+
+	data, err := cni.MarshalResult(result, cniVersion)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	fields[tapResultKey], err = json.Marshal(tap)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(fields, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
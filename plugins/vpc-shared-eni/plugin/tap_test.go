@@ -0,0 +1,82 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tapResult is a CNI result with a TAP attachment.
+type tapResult struct {
+	Interfaces []struct {
+		Name string `json:"name"`
+		Mac  string `json:"mac"`
+	} `json:"interfaces"`
+	Tap *tapAttachment `json:"tap"`
+}
+
+func TestAddReturnsTapAttachment(t *testing.T) {
+	for _, ifType := range []string{config.IfTypeTAP, config.IfTypeMacvtap} {
+		t.Run(ifType, func(t *testing.T) {
+			plugin, _ := newTestPlugin(t)
+			defer cleanupTestPlugin(plugin)
+
+			args := withNetConfig(t, newTestArgs(t, testContainerID), map[string]interface{}{
+				"interfaceType": ifType,
+				"tapUserID":     "1000",
+			})
+
+			// Repeated ADD commands return the cached attachment.
+			for i := 0; i < 2; i++ {
+				output, err := captureOutput(t, func() error { return plugin.Add(args) })
+				require.NoError(t, err)
+
+				var result tapResult
+				require.NoError(t, json.Unmarshal(output, &result))
+				require.NotNil(t, result.Tap)
+				require.Len(t, result.Interfaces, 1)
+
+				assert.Equal(t, testIfName, result.Tap.IfName)
+				assert.Equal(t, ifType, result.Tap.Type)
+				assert.Equal(t, testNetNS, result.Tap.Sandbox)
+				assert.Equal(t, 1000, result.Tap.UserID)
+				if ifType == config.IfTypeTAP {
+					assert.Equal(t, "/dev/net/tun", result.Tap.Device)
+					assert.Empty(t, result.Tap.MACAddress)
+				} else {
+					assert.Equal(t, "/dev/tap1", result.Tap.Device)
+					assert.Equal(t, result.Interfaces[0].Mac, result.Tap.MACAddress)
+				}
+			}
+		})
+	}
+}
+
+func TestAddReturnsNoTapAttachmentForVeth(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	output, err := captureOutput(t, func() error { return plugin.Add(newTestArgs(t, testContainerID)) })
+	require.NoError(t, err)
+
+	var result tapResult
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Nil(t, result.Tap)
+}
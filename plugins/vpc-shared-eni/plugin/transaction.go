@@ -0,0 +1,68 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+// transaction tracks the compensating actions of the completed steps of a command, so that a
+// failed command does not leave partially configured networking behind. Steps may complete
+// concurrently.
+type transaction struct {
+	mu            sync.Mutex
+	compensations []compensation
+}
+
+// compensation is the action that undoes a completed step.
+type compensation struct {
+	step string
+	undo func() error
+}
+
+// onRollback registers the action that undoes the given step.
+func (tx *transaction) onRollback(step string, undo func() error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.compensations = append(tx.compensations, compensation{step: step, undo: undo})
+}
+
+// rollback undoes the registered steps in reverse order. Failures are logged and do not stop
+// the rollback. Each step is undone at most once.
+func (tx *transaction) rollback() {
+	tx.mu.Lock()
+	compensations := tx.compensations
+	tx.compensations = nil
+	tx.mu.Unlock()
+
+	for i := len(compensations) - 1; i >= 0; i-- {
+		c := compensations[i]
+		log.Infof("Rolling back step: %s.", c.step)
+		err := c.undo()
+		if err != nil {
+			log.Errorf("Failed to roll back step %s, ignoring: %v.", c.step, err)
+		}
+	}
+}
+
+// rollbackIfFailed rolls back the transaction if the error is set. It is meant to be deferred
+// with a pointer to the named error result of a command.
+func (tx *transaction) rollbackIfFailed(err *error) {
+	if *err != nil {
+		tx.rollback()
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionRollsBackInReverseOrder(t *testing.T) {
+	var undone []string
+	tx := &transaction{}
+	for _, step := range []string{"first", "second", "third"} {
+		step := step
+		tx.onRollback(step, func() error {
+			undone = append(undone, step)
+			if step == "second" {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		})
+	}
+
+	err := fmt.Errorf("failed")
+	tx.rollbackIfFailed(&err)
+	assert.Equal(t, []string{"third", "second", "first"}, undone)
+
+	// Steps are undone only once.
+	tx.rollback()
+	assert.Len(t, undone, 3)
+}
+
+func TestTransactionKeepsStepsOnSuccess(t *testing.T) {
+	undone := false
+	tx := &transaction{}
+	tx.onRollback("step", func() error {
+		undone = true
+		return nil
+	})
+
+	var err error
+	tx.rollbackIfFailed(&err)
+	assert.False(t, undone)
+}
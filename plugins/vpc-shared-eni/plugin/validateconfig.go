@@ -0,0 +1,28 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+)
+
+// ConfigSchema returns the JSON schema of the network configuration embedded in the plugin.
+func (plugin *Plugin) ConfigSchema() string {
+	return config.Schema
+}
+
+// ValidateConfig validates the constraints between fields of the network configuration offline.
+func (plugin *Plugin) ValidateConfig(netConfig []byte) error {
+	return config.Validate(netConfig)
+}
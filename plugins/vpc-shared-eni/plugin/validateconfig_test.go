@@ -0,0 +1,84 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+
+	tests := []struct {
+		name         string
+		config       string
+		expectErrors []string
+	}{
+		{"valid", `{"cniVersion": "0.3.1", "name": "vpc", "plugins": [{
+			"type": "vpc-shared-eni", "eniName": "eth1", "eniIPAddress": "10.0.1.10/24",
+			"gatewayIPAddress": "10.0.1.1", "vpcCIDRs": ["10.0.0.0/16"], "backoff": {"maxAttempts": 3}}]}`, nil},
+		{"metadata derived", `{"cniVersion": "0.3.1", "name": "vpc", "plugins": [{
+			"type": "vpc-shared-eni", "eniMACAddress": "0a:12:34:56:78:9a", "imdsDerivedConfig": true}]}`, nil},
+		{"types and ranges", `{"cniVersion": "0.3.1", "name": "vpc", "plugins": [{
+			"type": "vpc-shared-eni", "eniName": "eth1", "bridgeType": "l2", "gatewayIPAddress": "10.0.1",
+			"maxConcurrentOperations": -1, "backoff": {"maxInterval": "1 minute"}, "eniMacAddress": "x"}]}`, []string{
+			`plugins[0].backoff.maxInterval: "1 minute" is not a valid duration`,
+			`plugins[0].bridgeType: "l2" is not one of "L2", "L3"`,
+			`plugins[0].eniMacAddress: unknown field, did you mean eniMACAddress?`,
+			`plugins[0].gatewayIPAddress: "10.0.1" is not a valid IP address`,
+			`plugins[0].maxConcurrentOperations: -1 is less than the minimum 0`}},
+		{"cross-field", `{"cniVersion": "0.3.1", "name": "vpc", "plugins": [{
+			"type": "vpc-shared-eni", "eniName": "eth1", "ipAddressMode": "dhcp"}]}`, []string{
+			"plugins[0]: ipAddressMode dhcp requires BridgeType L2 and IPFamily ipv4"}},
+		{"metadata derived fields", `{"cniVersion": "0.3.1", "name": "vpc", "plugins": [{
+			"type": "vpc-shared-eni", "eniMACAddress": "0a:12:34:56:78:9a", "imdsDerivedConfig": true,
+			"vpcCIDRs": ["10.0.0.0/16"]}]}`, []string{
+			"plugins[0]: imdsDerivedConfig does not allow eniIPAddress, vpcCIDRs, gatewayIPAddress " +
+				"or dns nameservers in the network configuration"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs, err := plugin.ValidateNetConfig(plugin, []byte(test.config))
+			require.NoError(t, err)
+
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			assert.Equal(t, test.expectErrors, messages)
+		})
+	}
+}
+
+func TestValidateGeneratedConfig(t *testing.T) {
+	plugin, _ := newTestPlugin(t)
+	defer cleanupTestPlugin(plugin)
+	registerTestMetadata(newTestMetadata())
+	defer config.RegisterMetadataHandler(nil)
+
+	var out strings.Builder
+	require.NoError(t, plugin.GenerateConfig([]string{"-secondary-ips"}, &out))
+
+	errs, err := plugin.ValidateNetConfig(plugin, []byte(out.String()))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+}
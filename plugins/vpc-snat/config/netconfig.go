@@ -0,0 +1,106 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// NetConfig defines the network configuration for the vpc-snat plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	VPCCIDRs      []net.IPNet
+	HostIPAddress net.IP
+	RandomFully   bool
+	PrevResult    *cniTypesCurrent.Result
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-snat plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	VPCCIDRs      []string               `json:"vpcCIDRs"`
+	HostIPAddress string                 `json:"hostIPAddress"`
+	RandomFully   bool                   `json:"randomizeSNAT"`
+	PrevResult    map[string]interface{} `json:"prevResult,omitempty"`
+}
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Validate if all the required fields are present.
+	if len(config.VPCCIDRs) == 0 {
+		return nil, fmt.Errorf("missing required parameter vpcCIDRs")
+	}
+
+	netConfig := NetConfig{
+		NetConf:     config.NetConf,
+		RandomFully: config.RandomFully,
+	}
+
+	// Parse the VPC CIDR blocks, which are reached without translation.
+	for _, cidrString := range config.VPCCIDRs {
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil || cidr.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid VPCCIDR %s", cidrString)
+		}
+		netConfig.VPCCIDRs = append(netConfig.VPCCIDRs, *cidr)
+	}
+
+	// Parse the optional host IP address. Defaults to the host's primary IP address.
+	if config.HostIPAddress != "" {
+		netConfig.HostIPAddress = net.ParseIP(config.HostIPAddress)
+		if netConfig.HostIPAddress == nil || netConfig.HostIPAddress.To4() == nil {
+			return nil, fmt.Errorf("invalid hostIPAddress %s", config.HostIPAddress)
+		}
+	}
+
+	if config.PrevResult != nil {
+		// Plugin was called as part of a chain. Parse the previous result to pass forward.
+		prevResBytes, err := json.Marshal(config.PrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize prevResult: %v", err)
+		}
+
+		prevRes, err := cniVersion.NewResult(config.CNIVersion, prevResBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+		}
+
+		netConfig.PrevResult, err = cniTypesCurrent.NewResultFromResult(prevRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+		}
+	} else {
+		// Plugin was called stand-alone.
+		netConfig.PrevResult = &cniTypesCurrent.Result{}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
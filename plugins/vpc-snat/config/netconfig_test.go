@@ -0,0 +1,75 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// All required fields.
+		`{"vpcCIDRs":["10.0.0.0/16"]}`,
+		// With optional fields.
+		`{"vpcCIDRs":["10.0.0.0/16", "100.64.0.0/16"], "hostIPAddress":"10.0.0.5", "randomizeSNAT":true}`,
+		// Chained.
+		`{"cniVersion":"0.3.1", "vpcCIDRs":["10.0.0.0/16"],
+		  "prevResult":{"cniVersion":"0.3.1", "ips":[{"version":"4", "address":"10.0.1.20/24"}]}}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing VPC CIDR blocks.
+		`{"hostIPAddress":"10.0.0.5"}`,
+		// Invalid VPC CIDR block.
+		`{"vpcCIDRs":["10.0.0.0"]}`,
+		// IPv6 VPC CIDR block.
+		`{"vpcCIDRs":["2600:1f14::/56"]}`,
+		// Invalid host IP address.
+		`{"vpcCIDRs":["10.0.0.0/16"], "hostIPAddress":"2600:1f14::5"}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestPrevResult tests that the previous result is parsed.
+func TestPrevResult(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[2])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	require.Len(t, netConfig.PrevResult.IPs, 1)
+	assert.Equal(t, "10.0.1.20/24", netConfig.PrevResult.IPs[0].Address.String())
+}
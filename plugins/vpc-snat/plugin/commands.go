@@ -0,0 +1,232 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-snat/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// chainNameFormat is the format of the names of per-task SNAT chains.
+	chainNameFormat = "VPC-SNAT-%s"
+
+	// natTable and postroutingChain are the iptables table and chain that SNAT rules are in.
+	natTable         = "nat"
+	postroutingChain = "POSTROUTING"
+
+	// internetProbeAddress is a public IP address used to find the host's default route.
+	internetProbeAddress = "8.8.8.8"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Find the task's IPv4 addresses.
+	var addresses []net.IP
+	for _, ipConfig := range netConfig.PrevResult.IPs {
+		if ipConfig.Address.IP.To4() != nil {
+			addresses = append(addresses, ipConfig.Address.IP)
+		}
+	}
+
+	if len(addresses) == 0 {
+		log.Errorf("No IPv4 address found in prevResult %+v.", netConfig.PrevResult)
+		return fmt.Errorf("missing IPv4 address in prevResult")
+	}
+
+	// Find the host IP address to translate to.
+	hostIPAddress := netConfig.HostIPAddress
+	if hostIPAddress == nil {
+		hostIPAddress, err = getHostIPAddress()
+		if err != nil {
+			log.Errorf("Failed to find host IP address: %v.", err)
+			return err
+		}
+	}
+
+	err = setupSNAT(args.ContainerID, addresses, netConfig, hostIPAddress)
+	if err != nil {
+		log.Errorf("Failed to set up SNAT rules: %v.", err)
+		return err
+	}
+
+	// Pass through the previous result.
+	log.Infof("Writing CNI result to stdout: %+v", netConfig.PrevResult)
+
+	return cniTypes.PrintResult(netConfig.PrevResult, netConfig.CNIVersion)
+}
+
+// Del is the CNI DEL command handler.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	err = deleteSNAT(args.ContainerID)
+	if err != nil {
+		log.Errorf("Failed to delete SNAT rules: %v.", err)
+		return err
+	}
+
+	return nil
+}
+
+// chainName returns the name of the SNAT chain of a task.
+func chainName(containerID string) string {
+	if len(containerID) > 12 {
+		containerID = containerID[:12]
+	}
+	return fmt.Sprintf(chainNameFormat, containerID)
+}
+
+// getHostIPAddress returns the source IP address of the host's default route.
+func getHostIPAddress() (net.IP, error) {
+	routes, err := netlink.RouteGet(net.ParseIP(internetProbeAddress))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range routes {
+		if route.Src != nil {
+			return route.Src, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no default route with a source address")
+}
+
+// setupSNAT creates a chain that translates traffic to non-VPC destinations to the host IP
+// address, and jumps to it from POSTROUTING for each task address.
+func setupSNAT(
+	containerID string,
+	addresses []net.IP,
+	netConfig *config.NetConfig,
+	hostIPAddress net.IP) error {
+
+	ipt, err := iptables.New()
+	if err != nil {
+		return err
+	}
+
+	chain := chainName(containerID)
+
+	// ClearChain creates the chain if it does not exist, which makes ADD idempotent.
+	err = ipt.ClearChain(natTable, chain)
+	if err != nil {
+		return err
+	}
+
+	// Traffic to VPC destinations keeps the task address.
+	for _, cidr := range netConfig.VPCCIDRs {
+		err = ipt.Append(natTable, chain, "-d", cidr.String(), "-j", "RETURN")
+		if err != nil {
+			return err
+		}
+	}
+
+	rule := []string{"-j", "SNAT", "--to-source", hostIPAddress.String()}
+	if netConfig.RandomFully && ipt.HasRandomFully() {
+		rule = append(rule, "--random-fully")
+	}
+
+	err = ipt.Append(natTable, chain, rule...)
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		log.Infof("Translating egress traffic from %s to %s.", address, hostIPAddress)
+		err = ipt.AppendUnique(natTable, postroutingChain, "-s", address.String(), "-j", chain)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteSNAT deletes the jump rules to the SNAT chain of a task and the chain itself.
+func deleteSNAT(containerID string) error {
+	ipt, err := iptables.New()
+	if err != nil {
+		return err
+	}
+
+	chain := chainName(containerID)
+
+	// The task addresses are not known on DEL. Find the jump rules by their target.
+	rules, err := ipt.List(natTable, postroutingChain)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		if len(fields) < 4 || fields[0] != "-A" || fields[len(fields)-1] != chain {
+			continue
+		}
+
+		log.Infof("Deleting SNAT rule %s.", rule)
+		err = ipt.Delete(natTable, postroutingChain, fields[2:]...)
+		if err != nil {
+			return err
+		}
+	}
+
+	chains, err := ipt.ListChains(natTable)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range chains {
+		if existing != chain {
+			continue
+		}
+
+		log.Infof("Deleting SNAT chain %s.", chain)
+		err = ipt.ClearChain(natTable, chain)
+		if err != nil {
+			return err
+		}
+
+		return ipt.DeleteChain(natTable, chain)
+	}
+
+	return nil
+}
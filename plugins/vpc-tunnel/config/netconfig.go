@@ -0,0 +1,196 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
+)
+
+// NetConfig defines the network configuration for the vpc-tunnel plugin.
+type NetConfig struct {
+	cniTypes.NetConf
+	TunnelType           string
+	DestinationIPAddress net.IP
+	VNI                  uint32
+	DestinationPort      uint16
+	IPAddresses          []net.IPNet
+	MTU                  int
+	InterfaceName        string
+	PrevResult           *cniTypesCurrent.Result
+}
+
+// netConfigJSON defines the network configuration JSON file format for the vpc-tunnel plugin.
+type netConfigJSON struct {
+	cniTypes.NetConf
+	TunnelType           string                 `json:"tunnelType"`
+	DestinationIPAddress string                 `json:"destinationIPAddress"`
+	VNI                  string                 `json:"vni"`
+	DestinationPort      string                 `json:"destinationPort"`
+	IPAddresses          []string               `json:"ipAddresses"`
+	MTU                  string                 `json:"mtu"`
+	InterfaceName        string                 `json:"interfaceName"`
+	PrevResult           map[string]interface{} `json:"prevResult,omitempty"`
+}
+
+const (
+	// Supported tunnel types.
+	TunnelTypeGENEVE = "geneve"
+	TunnelTypeVXLAN  = "vxlan"
+
+	// DefaultDestinationPort is the IANA assigned UDP port for GENEVE.
+	DefaultDestinationPort = 6081
+
+	// DefaultVXLANDestinationPort is the IANA assigned UDP port for VXLAN.
+	DefaultVXLANDestinationPort = 4789
+
+	// maxVNI is the largest valid 24-bit GENEVE or VXLAN virtual network identifier.
+	maxVNI = 1<<24 - 1
+
+	// gwlbMaxPacketSize is the largest packet size, including GENEVE encapsulation, supported by
+	// Gateway Load Balancer.
+	gwlbMaxPacketSize = 8500
+
+	// geneveOverhead is the size of the outer IPv4, UDP, GENEVE and inner Ethernet headers.
+	// The VXLAN header has the same size as the GENEVE header without options.
+	geneveOverhead = 20 + 8 + 8 + 14
+
+	// DefaultMTU is the default MTU of tunnel interfaces.
+	DefaultMTU = gwlbMaxPacketSize - geneveOverhead
+
+	// interfaceNameFormat is the format of default GENEVE interface names.
+	interfaceNameFormat = "gnv%d"
+
+	// vxlanInterfaceNameFormat is the format of default VXLAN interface names.
+	vxlanInterfaceNameFormat = "vxlan%d"
+)
+
+// New creates a new NetConfig object by parsing the given CNI arguments.
+func New(args *cniSkel.CmdArgs) (*NetConfig, error) {
+	// Parse network configuration.
+	var config netConfigJSON
+	err := json.Unmarshal(args.StdinData, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse network config: %v", err)
+	}
+
+	// Validate if all the required fields are present.
+	if config.DestinationIPAddress == "" {
+		return nil, fmt.Errorf("missing required parameter destinationIPAddress")
+	}
+	if config.VNI == "" {
+		return nil, fmt.Errorf("missing required parameter vni")
+	}
+
+	netConfig := NetConfig{
+		NetConf:         config.NetConf,
+		TunnelType:      TunnelTypeGENEVE,
+		DestinationPort: DefaultDestinationPort,
+		MTU:             DefaultMTU,
+		InterfaceName:   config.InterfaceName,
+	}
+
+	// Parse the optional tunnel type.
+	switch config.TunnelType {
+	case "", TunnelTypeGENEVE:
+	case TunnelTypeVXLAN:
+		netConfig.TunnelType = TunnelTypeVXLAN
+		netConfig.DestinationPort = DefaultVXLANDestinationPort
+	default:
+		return nil, fmt.Errorf("invalid tunnelType %s", config.TunnelType)
+	}
+
+	// Parse the tunnel destination IP address.
+	netConfig.DestinationIPAddress = net.ParseIP(config.DestinationIPAddress)
+	if netConfig.DestinationIPAddress == nil || netConfig.DestinationIPAddress.To4() == nil {
+		return nil, fmt.Errorf("invalid destinationIPAddress %s", config.DestinationIPAddress)
+	}
+
+	// Parse the virtual network identifier.
+	vni, err := strconv.ParseUint(config.VNI, 10, 32)
+	if err != nil || vni > maxVNI {
+		return nil, fmt.Errorf("invalid vni %s", config.VNI)
+	}
+	netConfig.VNI = uint32(vni)
+
+	// Parse the optional destination port.
+	if config.DestinationPort != "" {
+		port, err := strconv.ParseUint(config.DestinationPort, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid destinationPort %s", config.DestinationPort)
+		}
+		netConfig.DestinationPort = uint16(port)
+	}
+
+	// Parse the optional tunnel interface IP addresses.
+	for _, ipAddress := range config.IPAddresses {
+		address, err := vpc.GetIPAddressFromString(ipAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPAddress %s", ipAddress)
+		}
+		netConfig.IPAddresses = append(netConfig.IPAddresses, *address)
+	}
+
+	// Parse the optional MTU.
+	if config.MTU != "" {
+		netConfig.MTU, err = strconv.Atoi(config.MTU)
+		if err != nil || netConfig.MTU < 68 || netConfig.MTU > gwlbMaxPacketSize-geneveOverhead {
+			return nil, fmt.Errorf("invalid mtu %s", config.MTU)
+		}
+	}
+
+	// Derive the interface name from the VNI if none is specified.
+	if netConfig.InterfaceName == "" {
+		if netConfig.TunnelType == TunnelTypeVXLAN {
+			netConfig.InterfaceName = fmt.Sprintf(vxlanInterfaceNameFormat, netConfig.VNI)
+		} else {
+			netConfig.InterfaceName = fmt.Sprintf(interfaceNameFormat, netConfig.VNI)
+		}
+	}
+
+	if config.PrevResult != nil {
+		// Plugin was called as part of a chain. Parse the previous result to pass forward.
+		prevResBytes, err := json.Marshal(config.PrevResult)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize prevResult: %v", err)
+		}
+
+		prevRes, err := cniVersion.NewResult(config.CNIVersion, prevResBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+		}
+
+		netConfig.PrevResult, err = cniTypesCurrent.NewResultFromResult(prevRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert result to current version: %v", err)
+		}
+	} else {
+		// Plugin was called stand-alone.
+		netConfig.PrevResult = &cniTypesCurrent.Result{}
+	}
+
+	// Validation complete. Return the parsed NetConfig object.
+	log.Debugf("Created NetConfig: %+v", netConfig)
+	return &netConfig, nil
+}
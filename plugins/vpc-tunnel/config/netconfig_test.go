@@ -0,0 +1,98 @@
+// +build !integration,!e2e
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validConfigs = []string{
+		// All required fields.
+		`{"destinationIPAddress":"10.0.2.5", "vni":"4242"}`,
+		// With optional fields.
+		`{"destinationIPAddress":"10.0.2.5", "vni":"16777215", "destinationPort":"6082",
+		  "ipAddresses":["169.254.100.2/30"], "mtu":"1500", "interfaceName":"gwlb0"}`,
+		// VXLAN tunnel.
+		`{"tunnelType":"vxlan", "destinationIPAddress":"10.0.2.5", "vni":"4242"}`,
+	}
+
+	invalidConfigs = []string{
+		// Missing destination IP address.
+		`{"vni":"4242"}`,
+		// Missing VNI.
+		`{"destinationIPAddress":"10.0.2.5"}`,
+		// VNI out of range.
+		`{"destinationIPAddress":"10.0.2.5", "vni":"16777216"}`,
+		// IPv6 destination IP address.
+		`{"destinationIPAddress":"2001:db8::1", "vni":"4242"}`,
+		// Invalid destination port.
+		`{"destinationIPAddress":"10.0.2.5", "vni":"4242", "destinationPort":"0"}`,
+		// MTU too large for Gateway Load Balancer.
+		`{"destinationIPAddress":"10.0.2.5", "vni":"4242", "mtu":"9001"}`,
+		// Invalid IP address.
+		`{"destinationIPAddress":"10.0.2.5", "vni":"4242", "ipAddresses":["169.254.100.2"]}`,
+		// Invalid tunnel type.
+		`{"tunnelType":"gre", "destinationIPAddress":"10.0.2.5", "vni":"4242"}`,
+	}
+)
+
+// TestValidConfigs tests that valid configs succeed.
+func TestValidConfigs(t *testing.T) {
+	for _, config := range validConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.NoError(t, err, config)
+	}
+}
+
+// TestInvalidConfigs tests that invalid configs fail.
+func TestInvalidConfigs(t *testing.T) {
+	for _, config := range invalidConfigs {
+		args := &skel.CmdArgs{StdinData: []byte(config)}
+		_, err := New(args)
+		assert.Error(t, err, config)
+	}
+}
+
+// TestDefaults tests that optional fields are set to their defaults.
+func TestDefaults(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[0])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.Equal(t, TunnelTypeGENEVE, netConfig.TunnelType)
+	assert.Equal(t, uint32(4242), netConfig.VNI)
+	assert.Equal(t, uint16(DefaultDestinationPort), netConfig.DestinationPort)
+	assert.Equal(t, DefaultMTU, netConfig.MTU)
+	assert.Equal(t, "gnv4242", netConfig.InterfaceName)
+}
+
+// TestVXLANDefaults tests that optional fields of VXLAN tunnels are set to their defaults.
+func TestVXLANDefaults(t *testing.T) {
+	args := &skel.CmdArgs{StdinData: []byte(validConfigs[2])}
+	netConfig, err := New(args)
+	require.NoError(t, err)
+
+	assert.Equal(t, TunnelTypeVXLAN, netConfig.TunnelType)
+	assert.Equal(t, uint16(DefaultVXLANDestinationPort), netConfig.DestinationPort)
+	assert.Equal(t, DefaultMTU, netConfig.MTU)
+	assert.Equal(t, "vxlan4242", netConfig.InterfaceName)
+}
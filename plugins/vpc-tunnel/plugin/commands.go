@@ -0,0 +1,251 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/command"
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-tunnel/config"
+
+	log "github.com/cihub/seelog"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// ipCommand is the name of the iproute2 command used for creating GENEVE links, which the
+	// netlink library does not support.
+	ipCommand = "ip"
+)
+
+// Add is the CNI ADD command handler.
+func (plugin *Plugin) Add(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing ADD with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Find the target network namespace.
+	log.Infof("Searching for netns %s.", args.Netns)
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		log.Errorf("Failed to find netns %s: %v.", args.Netns, err)
+		return err
+	}
+
+	var macAddress net.HardwareAddr
+	err = ns.Run(func() error {
+		// Pin the route to the tunnel destination before creating the tunnel, so that
+		// encapsulated traffic and health check replies keep using the underlay interface
+		// even if routes through the tunnel are added later.
+		err := plugin.addDestinationRoute(netConfig.DestinationIPAddress)
+		if err != nil {
+			return err
+		}
+
+		macAddress, err = plugin.createTunnelLink(netConfig)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to setup %s tunnel: %v.", netConfig.TunnelType, err)
+		return err
+	}
+
+	// Append the tunnel interface to the previous result.
+	result := netConfig.PrevResult
+	result.Interfaces = append(result.Interfaces, &cniTypesCurrent.Interface{
+		Name:    netConfig.InterfaceName,
+		Mac:     macAddress.String(),
+		Sandbox: args.Netns,
+	})
+	ifIndex := len(result.Interfaces) - 1
+	for _, ipAddress := range netConfig.IPAddresses {
+		result.IPs = append(result.IPs, &cniTypesCurrent.IPConfig{
+			Version:   vpc.GetIPVersion(ipAddress.IP),
+			Interface: cniTypesCurrent.Int(ifIndex),
+			Address:   ipAddress,
+		})
+	}
+
+	// Output CNI result.
+	log.Infof("Writing CNI result to stdout: %+v", result)
+	err = cniTypes.PrintResult(result, netConfig.CNIVersion)
+	if err != nil {
+		log.Errorf("Failed to print result for CNI ADD command: %v", err)
+	}
+
+	return err
+}
+
+// Del is the CNI DEL command handler.
+// CNI DEL command can be called by the orchestrator multiple times for the same interface,
+// and thus must be best-effort and idempotent.
+func (plugin *Plugin) Del(args *cniSkel.CmdArgs) error {
+	// Parse network configuration.
+	netConfig, err := config.New(args)
+	if err != nil {
+		log.Errorf("Failed to parse netconfig from args: %v.", err)
+		return err
+	}
+
+	log.Infof("Executing DEL with netconfig: %+v ContainerID:%v Netns:%v IfName:%v Args:%v.",
+		netConfig, args.ContainerID, args.Netns, args.IfName, args.Args)
+
+	// Search for the target network namespace.
+	ns, err := netns.GetNetNS(args.Netns)
+	if err != nil {
+		// The network namespace may have been deleted already, along with the tunnel.
+		log.Infof("Failed to find netns %s, ignoring: %v.", args.Netns, err)
+		return nil
+	}
+
+	err = ns.Run(func() error {
+		link, err := netlink.LinkByName(netConfig.InterfaceName)
+		if err != nil {
+			log.Infof("Tunnel link %s not found, ignoring: %v.", netConfig.InterfaceName, err)
+			return nil
+		}
+
+		log.Infof("Deleting tunnel link %s.", netConfig.InterfaceName)
+		return netlink.LinkDel(link)
+	})
+	if err != nil {
+		log.Errorf("Failed to delete tunnel link: %v.", err)
+	}
+
+	return err
+}
+
+// createTunnelLink creates and configures a GENEVE or VXLAN link in the current network
+// namespace. Returns the MAC address of the link.
+func (plugin *Plugin) createTunnelLink(netConfig *config.NetConfig) (net.HardwareAddr, error) {
+	name := netConfig.InterfaceName
+
+	// Create the link unless it already exists from a previous ADD.
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		log.Infof("Creating %s link %s VNI %d remote %s port %d.", netConfig.TunnelType, name,
+			netConfig.VNI, netConfig.DestinationIPAddress, netConfig.DestinationPort)
+		if netConfig.TunnelType == config.TunnelTypeVXLAN {
+			err = plugin.addVXLANLink(netConfig)
+		} else {
+			err = plugin.addGENEVELink(netConfig)
+		}
+		if err != nil {
+			log.Errorf("Failed to create %s link: %v.", netConfig.TunnelType, err)
+			return nil, err
+		}
+
+		link, err = netlink.LinkByName(name)
+		if err != nil {
+			log.Errorf("Failed to find tunnel link %s: %v.", name, err)
+			return nil, err
+		}
+	}
+
+	// Set the link MTU to leave room for encapsulation.
+	log.Infof("Setting tunnel link %s MTU to %d octets.", name, netConfig.MTU)
+	err = netlink.LinkSetMTU(link, netConfig.MTU)
+	if err != nil {
+		log.Errorf("Failed to set tunnel link MTU: %v.", err)
+		return nil, err
+	}
+
+	// Assign IP addresses to the link.
+	for _, ipAddress := range netConfig.IPAddresses {
+		address := &netlink.Addr{IPNet: &net.IPNet{IP: ipAddress.IP, Mask: ipAddress.Mask}}
+		log.Infof("Assigning IP address %v to tunnel link %s.", address, name)
+		err = netlink.AddrReplace(link, address)
+		if err != nil {
+			log.Errorf("Failed to assign IP address to tunnel link: %v.", err)
+			return nil, err
+		}
+	}
+
+	// Set the link operational state up.
+	err = netlink.LinkSetUp(link)
+	if err != nil {
+		log.Errorf("Failed to set tunnel link state up: %v.", err)
+		return nil, err
+	}
+
+	return link.Attrs().HardwareAddr, nil
+}
+
+// addGENEVELink adds a GENEVE link in the current network namespace.
+func (plugin *Plugin) addGENEVELink(netConfig *config.NetConfig) error {
+	_, err := command.Run(ipCommand, "link", "add", netConfig.InterfaceName, "type", "geneve",
+		"id", strconv.FormatUint(uint64(netConfig.VNI), 10),
+		"remote", netConfig.DestinationIPAddress.String(),
+		"dstport", strconv.Itoa(int(netConfig.DestinationPort)))
+	return err
+}
+
+// addVXLANLink adds a VXLAN link in the current network namespace. Learning is disabled, as
+// all traffic is sent to the single remote tunnel endpoint.
+func (plugin *Plugin) addVXLANLink(netConfig *config.NetConfig) error {
+	la := netlink.NewLinkAttrs()
+	la.Name = netConfig.InterfaceName
+	vxlanLink := &netlink.Vxlan{
+		LinkAttrs: la,
+		VxlanId:   int(netConfig.VNI),
+		Group:     netConfig.DestinationIPAddress,
+		Port:      int(netConfig.DestinationPort),
+		Learning:  false,
+	}
+
+	return netlink.LinkAdd(vxlanLink)
+}
+
+// addDestinationRoute adds a host route to the tunnel destination through the interface and
+// gateway currently used to reach it.
+func (plugin *Plugin) addDestinationRoute(destination net.IP) error {
+	routes, err := netlink.RouteGet(destination)
+	if err == nil && len(routes) == 0 {
+		err = fmt.Errorf("no route to %s", destination)
+	}
+	if err != nil {
+		log.Errorf("Failed to find route to tunnel destination %s: %v.", destination, err)
+		return err
+	}
+
+	route := &netlink.Route{
+		LinkIndex: routes[0].LinkIndex,
+		Dst:       &net.IPNet{IP: destination, Mask: net.CIDRMask(32, 32)},
+		Gw:        routes[0].Gw,
+	}
+	if route.Gw == nil {
+		route.Scope = netlink.SCOPE_LINK
+	}
+
+	log.Infof("Adding IP route %+v to tunnel destination.", route)
+	err = netlink.RouteReplace(route)
+	if err != nil {
+		log.Errorf("Failed to add IP route to tunnel destination: %v.", err)
+	}
+
+	return err
+}
@@ -0,0 +1,355 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package schema validates JSON documents, such as network configurations, against a JSON schema.
+// It supports the subset of JSON schema keywords needed to describe network configurations, and
+// reports every violation with the path of the offending value.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Value formats.
+const (
+	FormatIP       = "ip"
+	FormatCIDR     = "cidr"
+	FormatMAC      = "mac"
+	FormatDuration = "duration"
+)
+
+// Schema is a JSON schema.
+type Schema struct {
+	Description          string             `json:"description,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Format               string             `json:"format,omitempty"`
+
+	additionalSchema *Schema
+	noAdditional     bool
+	pattern          *regexp.Regexp
+}
+
+// Types is the list of JSON types a value may have. It is given as a string or an array.
+type Types []string
+
+// UnmarshalJSON unmarshals a type or a list of types.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*t = Types{name}
+		return nil
+	}
+
+	var names []string
+	err := json.Unmarshal(data, &names)
+	if err != nil {
+		return err
+	}
+	*t = names
+
+	return nil
+}
+
+// Error is a violation of a schema.
+type Error struct {
+	// Path is the path of the offending value, e.g. "plugins[0].mtu".
+	Path    string
+	Message string
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Parse parses a JSON schema.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("schema: failed to parse schema: %v", err)
+	}
+
+	err = s.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// compile checks the schema and prepares it for validation.
+func (s *Schema) compile() error {
+	for _, t := range s.Type {
+		switch t {
+		case "object", "array", "string", "integer", "number", "boolean", "null":
+		default:
+			return fmt.Errorf("schema: invalid type %s", t)
+		}
+	}
+
+	switch s.Format {
+	case "", FormatIP, FormatCIDR, FormatMAC, FormatDuration:
+	default:
+		return fmt.Errorf("schema: invalid format %s", s.Format)
+	}
+
+	if s.Pattern != "" {
+		var err error
+		s.pattern, err = regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("schema: invalid pattern %s: %v", s.Pattern, err)
+		}
+	}
+
+	// Additional properties are allowed, denied, or must match a schema.
+	if len(s.AdditionalProperties) != 0 {
+		var allowed bool
+		if json.Unmarshal(s.AdditionalProperties, &allowed) == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additionalSchema = &Schema{}
+			err := json.Unmarshal(s.AdditionalProperties, s.additionalSchema)
+			if err != nil {
+				return fmt.Errorf("schema: invalid additionalProperties: %v", err)
+			}
+		}
+	}
+
+	for _, sub := range append([]*Schema{s.Items, s.additionalSchema}, s.propertySchemas()...) {
+		if sub == nil {
+			continue
+		}
+		err := sub.compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// propertySchemas returns the schemas of the properties.
+func (s *Schema) propertySchemas() []*Schema {
+	var schemas []*Schema
+	for _, sub := range s.Properties {
+		schemas = append(schemas, sub)
+	}
+	return schemas
+}
+
+// Validate validates the given JSON document and returns all violations of the schema.
+func (s *Schema) Validate(data []byte) []error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return []error{&Error{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	return s.ValidateValue("", value)
+}
+
+// ValidateValue validates a value decoded with json.Decoder.UseNumber at the given path, and
+// returns all violations of the schema.
+func (s *Schema) ValidateValue(path string, value interface{}) []error {
+	var errs []error
+	fail := func(format string, a ...interface{}) {
+		errs = append(errs, &Error{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if len(s.Type) != 0 && !s.hasType(value) {
+		fail("expected %s, found %s", strings.Join(s.Type, " or "), typeOf(value))
+		return errs
+	}
+
+	if len(s.Enum) != 0 && !s.inEnum(value) {
+		var values []string
+		for _, v := range s.Enum {
+			values = append(values, fmt.Sprintf("%q", v))
+		}
+		fail("%s is not one of %s", format(value), strings.Join(values, ", "))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required field %s", name)
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			sub, ok := s.Properties[name]
+			if !ok {
+				sub = s.additionalSchema
+			}
+			if sub != nil {
+				errs = append(errs, sub.ValidateValue(joinPath(path, name), v[name])...)
+			} else if s.noAdditional {
+				errs = append(errs, &Error{Path: joinPath(path, name), Message: s.unknownField(name)})
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.Items.ValidateValue(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("%s is less than the minimum %v", v, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("%s is greater than the maximum %v", v, *s.Maximum)
+		}
+
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			fail("%q is shorter than %d characters", v, *s.MinLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("%q does not match %s", v, s.Pattern)
+		}
+		if s.Format != "" && !isFormat(s.Format, v) {
+			fail("%q is not a valid %s", v, formatNames[s.Format])
+		}
+	}
+
+	return errs
+}
+
+// hasType returns whether the value has one of the types of the schema.
+func (s *Schema) hasType(value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range s.Type {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// inEnum returns whether the value is one of the values enumerated by the schema.
+func (s *Schema) inEnum(value interface{}) bool {
+	for _, v := range s.Enum {
+		if format(v) == format(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownField returns the message for a field that is not in the schema, suggesting the
+// known field that differs only in case.
+func (s *Schema) unknownField(name string) string {
+	for known := range s.Properties {
+		if strings.EqualFold(known, name) {
+			return fmt.Sprintf("unknown field, did you mean %s?", known)
+		}
+	}
+	return "unknown field"
+}
+
+// formatNames are the descriptions of value formats in error messages.
+var formatNames = map[string]string{
+	FormatIP:       "IP address",
+	FormatCIDR:     "CIDR block",
+	FormatMAC:      "MAC address",
+	FormatDuration: "duration",
+}
+
+// isFormat returns whether the string has the given format.
+func isFormat(f string, s string) bool {
+	var err error
+	switch f {
+	case FormatIP:
+		if net.ParseIP(s) == nil {
+			return false
+		}
+	case FormatCIDR:
+		_, _, err = net.ParseCIDR(s)
+	case FormatMAC:
+		_, err = net.ParseMAC(s)
+	case FormatDuration:
+		_, err = time.ParseDuration(s)
+	}
+	return err == nil
+}
+
+// typeOf returns the JSON type of a value decoded with json.Decoder.UseNumber.
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// format formats a value as JSON for comparisons and error messages.
+func format(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// joinPath returns the path of a field of the object at the given path.
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// sortedKeys returns the sorted keys of an object, so that errors are reported in a stable order.
+func sortedKeys(object map[string]interface{}) []string {
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"mode": {"type": "string", "enum": ["L2", "L3"]},
+		"mtu": {"type": "integer", "minimum": 68, "maximum": 9001},
+		"gateway": {"type": "string", "format": "ip"},
+		"cidrs": {"type": "array", "items": {"type": "string", "format": "cidr"}},
+		"owner": {"type": "string", "pattern": "^[a-z]+$"},
+		"timeout": {"type": ["string", "null"], "format": "duration"},
+		"groups": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "string"}}}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		doc          string
+		expectErrors []string
+	}{
+		{"valid", `{"name": "net", "mode": "L2", "mtu": 1500, "gateway": "10.0.0.1", "cidrs": ["10.0.0.0/16"],
+			"owner": "abc", "timeout": "1s", "groups": {"sg-1": ["sg-2"]}}`, nil},
+		{"null", `{"name": "net", "timeout": null}`, nil},
+		{"missing required", `{}`, []string{"missing required field name"}},
+		{"wrong type", `{"name": 1}`, []string{"name: expected string, found integer"}},
+		{"empty string", `{"name": ""}`, []string{`name: "" is shorter than 1 characters`}},
+		{"enum", `{"name": "net", "mode": "L4"}`, []string{`mode: "L4" is not one of "L2", "L3"`}},
+		{"not integer", `{"name": "net", "mtu": 1500.5}`, []string{"mtu: expected integer, found number"}},
+		{"range", `{"name": "net", "mtu": 10000}`, []string{"mtu: 10000 is greater than the maximum 9001"}},
+		{"format", `{"name": "net", "gateway": "10.0.0", "cidrs": ["10.0.0.0/16", "10.1.0.0"]}`, []string{
+			`cidrs[1]: "10.1.0.0" is not a valid CIDR block`,
+			`gateway: "10.0.0" is not a valid IP address`}},
+		{"pattern", `{"name": "net", "owner": "ABC"}`, []string{`owner: "ABC" does not match ^[a-z]+$`}},
+		{"additional schema", `{"name": "net", "groups": {"sg-1": [1]}}`, []string{
+			"groups.sg-1[0]: expected string, found integer"}},
+		{"unknown field", `{"name": "net", "MTU": 1500, "foo": 1}`, []string{
+			"MTU: unknown field, did you mean mtu?", "foo: unknown field"}},
+		{"invalid JSON", `{"name": `, []string{"invalid JSON: unexpected EOF"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var messages []string
+			for _, err := range s.Validate([]byte(test.doc)) {
+				messages = append(messages, err.Error())
+			}
+			assert.Equal(t, test.expectErrors, messages)
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		`{"type": "text"}`,
+		`{"format": "uuid"}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": {"type": "text"}}}`,
+		`{"additionalProperties": 1}`,
+	} {
+		_, err := Parse([]byte(s))
+		assert.Error(t, err, s)
+	}
+}
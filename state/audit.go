@@ -0,0 +1,74 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// AuditFileName is the name of the audit log file in the state directory of a plugin.
+	AuditFileName = "audit.log"
+
+	// maxAuditFileSize is the size after which the audit log is rotated. One previous file is
+	// kept, with the suffix auditRotatedSuffix.
+	maxAuditFileSize   = 4 << 20
+	auditRotatedSuffix = ".1"
+)
+
+// AppendAuditRecord appends the given record to the audit log in the given directory, as a line
+// of JSON. Records of all plugin processes are serialized by the lock of the audit log.
+func AppendAuditRecord(dir string, record interface{}) error {
+	path := filepath.Join(dir, AuditFileName)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode audit record: %v", err)
+	}
+
+	err = os.MkdirAll(dir, dirPerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to create directory %s: %v", dir, err)
+	}
+
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	info, err := os.Stat(path)
+	if err == nil && info.Size() >= maxAuditFileSize {
+		err = os.Rename(path, path+auditRotatedSuffix)
+		if err != nil {
+			return fmt.Errorf("state: failed to rotate audit log %s: %v", path, err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to open audit log %s: %v", path, err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("state: failed to write audit log %s: %v", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendAuditRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	type record struct {
+		Command string
+	}
+	require.NoError(t, AppendAuditRecord(dir, record{Command: "ADD"}))
+	require.NoError(t, AppendAuditRecord(dir, record{Command: "DEL"}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, AuditFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"Command\":\"ADD\"}\n{\"Command\":\"DEL\"}\n", string(data))
+}
+
+func TestAppendAuditRecordRotates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, AuditFileName)
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Repeat("x", maxAuditFileSize)), 0600))
+	require.NoError(t, AppendAuditRecord(dir, "ADD"))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "\"ADD\"\n", string(data))
+
+	info, err := os.Stat(path + auditRotatedSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, int64(maxAuditFileSize), info.Size())
+}
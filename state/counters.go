@@ -0,0 +1,136 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// CountersCommand is the option for plugin to print the persistent counters.
+	CountersCommand = "counters"
+
+	// MetricsCommand is the option for plugin to print the persistent counters as metrics.
+	MetricsCommand = "metrics"
+
+	// Names of the persistent counters.
+	CounterConsecutiveNetworkFailures = "consecutiveNetworkFailures"
+	CounterAttachRetries              = "attachRetries"
+	CounterGCReclaimed                = "gcReclaimed"
+	CounterENIFailovers               = "eniFailovers"
+	CounterRejectedConnections        = "rejectedConnections"
+
+	// countersFileName is the name of the file storing the counters in the state directory.
+	countersFileName = "counters.json"
+)
+
+// CountersSchema is the schema of the counters file in a state directory.
+var CountersSchema = FileSchema{Name: "counters", Pattern: countersFileName}
+
+// Counters is a set of named counters persisted across plugin invocations on a node.
+type Counters map[string]uint64
+
+// LoadCounters loads the counters from the given state directory.
+func LoadCounters(dir string) (Counters, error) {
+	counters := make(Counters)
+
+	_, err := ReadJSONFile(filepath.Join(dir, countersFileName), &counters)
+	if err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// UpdateCounters atomically applies the given update to the counters in the state directory.
+func UpdateCounters(dir string, update func(Counters)) error {
+	path := filepath.Join(dir, countersFileName)
+	counters := make(Counters)
+
+	// Start over rather than failing forever on a corrupt counters file. Other errors, such as
+	// a failure to read the file, are returned by the update.
+	if _, err := ReadJSONFile(path, &counters); IsCorrupt(err) {
+		os.Remove(path)
+	}
+
+	return UpdateJSONFile(path, &counters, func() error {
+		update(counters)
+		return nil
+	})
+}
+
+// IncrementCounter increments the named counter in the state directory.
+func IncrementCounter(dir string, name string) error {
+	return UpdateCounters(dir, func(counters Counters) {
+		counters[name]++
+	})
+}
+
+// ResetCounter resets the named counter in the state directory.
+func ResetCounter(dir string, name string) error {
+	return UpdateCounters(dir, func(counters Counters) {
+		counters[name] = 0
+	})
+}
+
+// String returns a JSON representation of the counters.
+func (counters Counters) String() (string, error) {
+	data, err := json.Marshal(counters)
+	if err != nil {
+		return "", fmt.Errorf("state: failed to marshal counters: %v", err)
+	}
+
+	return string(data), nil
+}
+
+// WriteMetrics writes the counters in Prometheus text exposition format.
+func (counters Counters) WriteMetrics(w io.Writer, pluginName string) error {
+	var names []string
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, err := fmt.Fprintf(w, "vpc_cni_%s{plugin=%q} %d\n",
+			toSnakeCase(name), pluginName, counters[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// toSnakeCase converts a camel case name to snake case.
+func toSnakeCase(name string) string {
+	var buf []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				buf = append(buf, '_')
+			}
+			c += 'a' - 'A'
+		}
+		buf = append(buf, c)
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountersUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	counters, err := LoadCounters(dir)
+	require.NoError(t, err)
+	assert.Empty(t, counters)
+
+	require.NoError(t, IncrementCounter(dir, CounterAttachRetries))
+	require.NoError(t, IncrementCounter(dir, CounterAttachRetries))
+	require.NoError(t, IncrementCounter(dir, CounterGCReclaimed))
+	require.NoError(t, ResetCounter(dir, CounterGCReclaimed))
+
+	counters, err = LoadCounters(dir)
+	require.NoError(t, err)
+	assert.Equal(t, Counters{CounterAttachRetries: 2, CounterGCReclaimed: 0}, counters)
+
+	// The lock of the counters file is released.
+	unlock, err := acquireLock(filepath.Join(dir, countersFileName+lockFileSuffix), 0)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestCountersUpdateCorruptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Corrupt counters files are reset.
+	path := filepath.Join(dir, countersFileName)
+	require.NoError(t, ioutil.WriteFile(path, []byte("{garbage"), filePerm))
+	require.NoError(t, IncrementCounter(dir, CounterAttachRetries))
+
+	counters, err := LoadCounters(dir)
+	require.NoError(t, err)
+	assert.Equal(t, Counters{CounterAttachRetries: 1}, counters)
+
+	// Counters files that cannot be read are kept.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, dirPerm))
+	assert.Error(t, IncrementCounter(dir, CounterAttachRetries))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestCountersConcurrentUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, IncrementCounter(dir, CounterAttachRetries))
+		}()
+	}
+	wg.Wait()
+
+	counters, err := LoadCounters(dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), counters[CounterAttachRetries])
+}
+
+func TestCountersWriteMetrics(t *testing.T) {
+	counters := Counters{
+		CounterGCReclaimed:                3,
+		CounterConsecutiveNetworkFailures: 1,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, counters.WriteMetrics(&buf, "vpc-shared-eni"))
+	assert.Equal(t,
+		"vpc_cni_consecutive_network_failures{plugin=\"vpc-shared-eni\"} 1\n"+
+			"vpc_cni_gc_reclaimed{plugin=\"vpc-shared-eni\"} 3\n",
+		buf.String())
+}
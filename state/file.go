@@ -0,0 +1,134 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// fileLockTimeout is the maximum time to wait for the lock of a state file.
+	fileLockTimeout = 5 * time.Second
+
+	// lockFileSuffix is the suffix of lock file names.
+	lockFileSuffix = ".lock"
+)
+
+// ReadJSONFile decodes the given JSON state file into v. It returns false if the file does not exist.
+// If a signing key is set, it returns an error if the signature of the file is invalid.
+func ReadJSONFile(path string, v interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("state: failed to read file %s: %v", path, err)
+	}
+
+	data, _, err = verifyData(path, "", data)
+	if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return false, corruptFileErrorf("state: failed to parse file %s: %v", path, err)
+	}
+
+	return true, nil
+}
+
+// UpdateJSONFile atomically updates the given JSON state file. It locks the file against
+// concurrent updates by other plugin processes, decodes its contents into v, calls update and,
+// if update succeeds, encodes v back to the file, signed if a signing key is set.
+func UpdateJSONFile(path string, v interface{}, update func() error) error {
+	err := os.MkdirAll(filepath.Dir(path), dirPerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to create directory %s: %v", filepath.Dir(path), err)
+	}
+
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = ReadJSONFile(path, v)
+	if err != nil {
+		return err
+	}
+
+	err = update()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode file %s: %v", path, err)
+	}
+
+	data, _ = signData(path, "", data)
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a file by replacing it with a fully written temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("state: failed to create file: %v", err)
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("state: failed to write file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// corruptFileError is the error returned for state files that fail signature verification or
+// cannot be parsed, as opposed to state files that cannot be accessed.
+type corruptFileError struct {
+	msg string
+}
+
+// corruptFileErrorf returns a corruptFileError with the given formatted message.
+func corruptFileErrorf(format string, args ...interface{}) error {
+	return &corruptFileError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the description of the error.
+func (e *corruptFileError) Error() string {
+	return e.msg
+}
+
+// IsCorrupt returns whether the given error reports a state file that failed signature
+// verification or could not be parsed.
+func IsCorrupt(err error) bool {
+	_, ok := err.(*corruptFileError)
+	return ok
+}
@@ -0,0 +1,439 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+const (
+	// journalFileSuffix is the suffix of the journal file names of journaled state files.
+	journalFileSuffix = ".journal"
+
+	// journalCompactUpdates is the number of updates in a journal after which it is folded into
+	// the state file.
+	journalCompactUpdates = 256
+)
+
+// journalRecord is a change to a journaled state file. Path is the keys of the changed value
+// through nested JSON objects.
+type journalRecord struct {
+	Path    []string        `json:"p"`
+	Value   json.RawMessage `json:"v,omitempty"`
+	Deleted bool            `json:"d,omitempty"`
+}
+
+// journalHeader is the first line of a journal. Base is the hash of the state file the journal
+// applies to, so that a journal left behind by a crash after the state file was replaced, e.g.
+// by compaction, is not replayed on the new state file.
+type journalHeader struct {
+	Base string `json:"base"`
+}
+
+// journal is the contents of a journaled state file.
+type journal struct {
+	tree    map[string]interface{}
+	found   bool
+	hasFile bool
+	base    string
+	updates int
+	size    int64
+	hmac    string
+}
+
+// ReadJournaledFile decodes the given journaled state file into v, which must encode to a JSON
+// object. It returns false if the file does not exist.
+func ReadJournaledFile(path string, v interface{}) (bool, error) {
+	_, err := os.Stat(filepath.Dir(path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	// The journal may be folded into the state file concurrently.
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	j, err := loadJournal(path)
+	if err != nil {
+		return false, err
+	}
+
+	return j.found, decodeTree(j.tree, v)
+}
+
+// UpdateJournaledFile is like UpdateJSONFile for state that encodes to a JSON object, such as a
+// map with many entries. Instead of rewriting the whole file, it appends the changed values to a
+// journal next to the file, and folds the journal into the file periodically. Files written by
+// UpdateJSONFile are valid journaled state files.
+func UpdateJournaledFile(path string, v interface{}, update func() error) error {
+	err := os.MkdirAll(filepath.Dir(path), dirPerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to create directory %s: %v", filepath.Dir(path), err)
+	}
+
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	j, err := loadJournal(path)
+	if err != nil {
+		return err
+	}
+
+	err = decodeTree(j.tree, v)
+	if err != nil {
+		return err
+	}
+
+	err = update()
+	if err != nil {
+		return err
+	}
+
+	tree, err := encodeTree(v)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode file %s: %v", path, err)
+	}
+
+	records, err := diffTree(nil, j.tree, tree, nil)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode file %s: %v", path, err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	// The state file is always written first, so that it can be found by name.
+	if !j.hasFile || j.updates >= journalCompactUpdates {
+		return compactJournal(path, tree)
+	}
+
+	return appendJournal(path, j, records)
+}
+
+// RemoveJournal removes the journal of the given journaled state file, e.g. after the state
+// file was moved aside.
+func RemoveJournal(path string) error {
+	err := os.Remove(path + journalFileSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("state: failed to remove file %s: %v", path+journalFileSuffix, err)
+	}
+
+	return nil
+}
+
+// loadJournal reads a journaled state file and replays its journal. A partially written last
+// update, left behind by a crashed process, is ignored, as is a journal of a previous version of
+// the state file.
+func loadJournal(path string) (*journal, error) {
+	return loadJournalWithKey(getSigningKey(), path)
+}
+
+// loadJournalWithKey is like loadJournal with the given signing key. If key is nil, the state
+// file and journal are not verified.
+func loadJournalWithKey(key []byte, path string) (*journal, error) {
+	j := &journal{tree: make(map[string]interface{})}
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		j.found = true
+		j.hasFile = true
+		j.base = hashData(data)
+		data, _, err = verifyDataWithKey(key, path, "", data)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeJSON(data, &j.tree)
+		if err != nil {
+			return nil, corruptFileErrorf("state: failed to parse file %s: %v", path, err)
+		}
+		if j.tree == nil {
+			j.tree = make(map[string]interface{})
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("state: failed to read file %s: %v", path, err)
+	}
+
+	// The journal is mapped rather than read, as it may grow to hundreds of updates. It is not
+	// truncated while mapped, since all access is serialized by the state file lock.
+	journalPath := path + journalFileSuffix
+	data, unmap, err := mapFile(journalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return j, nil
+		}
+		return nil, fmt.Errorf("state: failed to read file %s: %v", journalPath, err)
+	}
+	defer unmap()
+
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			break
+		}
+
+		// Journal updates are signed in a chain, so that they cannot be reordered.
+		line, mac, err := verifyDataWithKey(key, journalPath, j.hmac, data[:end])
+		if err != nil {
+			return nil, err
+		}
+
+		// Every journal starts with a header.
+		if j.size == 0 {
+			if !bytes.HasPrefix(line, []byte("{")) {
+				return nil, corruptFileErrorf("state: missing header in file %s", journalPath)
+			}
+			var header journalHeader
+			err = json.Unmarshal(line, &header)
+			if err != nil {
+				return nil, corruptFileErrorf("state: failed to parse file %s: %v", journalPath, err)
+			}
+			if header.Base != j.base {
+				// The next update replaces the stale journal.
+				return j, nil
+			}
+			j.size += int64(end + 1)
+			j.hmac = mac
+			data = data[end+1:]
+			continue
+		}
+
+		var records []journalRecord
+		err = json.Unmarshal(line, &records)
+		if err != nil {
+			return nil, corruptFileErrorf("state: failed to parse file %s: %v", journalPath, err)
+		}
+
+		for _, record := range records {
+			err = j.apply(record)
+			if err != nil {
+				return nil, corruptFileErrorf("state: failed to parse file %s: %v", journalPath, err)
+			}
+		}
+
+		j.found = true
+		j.updates++
+		j.size += int64(end + 1)
+		j.hmac = mac
+		data = data[end+1:]
+	}
+
+	return j, nil
+}
+
+// apply applies a journal record to the journal contents.
+func (j *journal) apply(record journalRecord) error {
+	if len(record.Path) == 0 {
+		return fmt.Errorf("empty path in journal record")
+	}
+
+	parent := j.tree
+	for _, key := range record.Path[:len(record.Path)-1] {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			parent[key] = child
+		}
+		parent = child
+	}
+
+	key := record.Path[len(record.Path)-1]
+	if record.Deleted {
+		delete(parent, key)
+		return nil
+	}
+
+	var value interface{}
+	err := decodeJSON(record.Value, &value)
+	if err != nil {
+		return err
+	}
+	parent[key] = value
+
+	return nil
+}
+
+// appendJournal appends one update with the given records to the given journal. A new journal
+// starts with a header identifying the state file it applies to.
+func appendJournal(path string, j *journal, records []journalRecord) error {
+	journalPath := path + journalFileSuffix
+	var header []byte
+	prevHMAC := j.hmac
+	if j.size == 0 {
+		data, err := json.Marshal(journalHeader{Base: j.base})
+		if err != nil {
+			return fmt.Errorf("state: failed to encode file %s: %v", path, err)
+		}
+		header, prevHMAC = signData(journalPath, "", data)
+		header = append(header, '\n')
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode file %s: %v", path, err)
+	}
+
+	data, _ = signData(journalPath, prevHMAC, data)
+	data = append(header, append(data, '\n')...)
+
+	file, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to open file %s: %v", journalPath, err)
+	}
+
+	// Drop a partially written update left behind by a crashed process.
+	err = file.Truncate(j.size)
+	if err == nil {
+		_, err = file.WriteAt(data, j.size)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("state: failed to write file %s: %v", journalPath, err)
+	}
+
+	return nil
+}
+
+// compactJournal folds the journal into the state file. The journal applies to the previous
+// state file only, so a crash before it is removed is harmless.
+func compactJournal(path string, tree map[string]interface{}) error {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode file %s: %v", path, err)
+	}
+
+	data, _ = signData(path, "", data)
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return err
+	}
+
+	return RemoveJournal(path)
+}
+
+// hashData returns the hash identifying the given state file contents.
+func hashData(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// diffTree appends the records that change before into after to records. Nested objects are
+// compared key by key, so that changing one entry of a large map results in one small record.
+func diffTree(path []string, before, after map[string]interface{}, records []journalRecord) ([]journalRecord, error) {
+	for _, key := range sortedKeys(before) {
+		if _, ok := after[key]; !ok {
+			records = append(records, journalRecord{Path: appendPath(path, key), Deleted: true})
+		}
+	}
+
+	for _, key := range sortedKeys(after) {
+		value := after[key]
+		old, ok := before[key]
+		if ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+
+		oldObject, oldIsObject := old.(map[string]interface{})
+		object, isObject := value.(map[string]interface{})
+		if oldIsObject && isObject {
+			var err error
+			records, err = diffTree(appendPath(path, key), oldObject, object, records)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, journalRecord{Path: appendPath(path, key), Value: data})
+	}
+
+	return records, nil
+}
+
+// encodeTree encodes v as a generic JSON object.
+func encodeTree(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]interface{}
+	err = decodeJSON(data, &tree)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		tree = make(map[string]interface{})
+	}
+
+	return tree, nil
+}
+
+// decodeTree decodes a generic JSON object into v.
+func decodeTree(tree map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("state: failed to encode state: %v", err)
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("state: failed to decode state: %v", err)
+	}
+
+	return nil
+}
+
+// decodeJSON decodes JSON data into v, keeping numbers exact.
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// appendPath returns a copy of path with key appended.
+func appendPath(path []string, key string) []string {
+	return append(append([]string(nil), path...), key)
+}
+
+// sortedKeys returns the keys of the given object in order.
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,216 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJournalState is a journaled state with nested maps.
+type testJournalState struct {
+	Entries map[string]string `json:"entries"`
+	Count   int               `json:"count"`
+}
+
+func newTestJournal(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+
+	return filepath.Join(dir, "test.json"), func() { os.RemoveAll(dir) }
+}
+
+// setEntry sets an entry of the test state in the given journaled state file.
+func setEntry(t *testing.T, path string, key string, value string) {
+	var s testJournalState
+	require.NoError(t, UpdateJournaledFile(path, &s, func() error {
+		if s.Entries == nil {
+			s.Entries = make(map[string]string)
+		}
+		if value == "" {
+			delete(s.Entries, key)
+		} else {
+			s.Entries[key] = value
+		}
+		s.Count++
+		return nil
+	}))
+}
+
+func TestJournaledFile(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	var s testJournalState
+	found, err := ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	setEntry(t, path, "a", "1")
+	setEntry(t, path, "b", "2")
+	setEntry(t, path, "a", "")
+
+	s = testJournalState{}
+	found, err = ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, testJournalState{Entries: map[string]string{"b": "2"}, Count: 3}, s)
+
+	// Updates after the first append only the changed entries to the journal, which starts
+	// with a header.
+	data, err := ioutil.ReadFile(path + journalFileSuffix)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], `{"base":`))
+	assert.Equal(t, `[{"p":["count"],"v":3},{"p":["entries","a"],"d":true}]`, lines[2])
+}
+
+func TestJournaledFileFromJSONFile(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	var s testJournalState
+	require.NoError(t, UpdateJSONFile(path, &s, func() error {
+		s.Entries = map[string]string{"a": "1"}
+		return nil
+	}))
+	setEntry(t, path, "b", "2")
+
+	s = testJournalState{}
+	_, err := ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, s.Entries)
+}
+
+func TestJournaledFilePartialUpdate(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	setEntry(t, path, "a", "1")
+
+	// Leave a partially written update behind.
+	file, err := os.OpenFile(path+journalFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerm)
+	require.NoError(t, err)
+	_, err = file.WriteString(`[{"p":["entries","b"],"v":`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	var s testJournalState
+	_, err = ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, s.Entries)
+
+	setEntry(t, path, "c", "3")
+	s = testJournalState{}
+	_, err = ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "c": "3"}, s.Entries)
+}
+
+func TestJournaledFileWithoutHeader(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(path+journalFileSuffix, []byte(`[{"p":["count"],"v":1}]`+"\n"), filePerm)
+	require.NoError(t, err)
+
+	var s testJournalState
+	_, err = ReadJournaledFile(path, &s)
+	assert.True(t, IsCorrupt(err))
+}
+
+func TestJournaledFileCompaction(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	// The first update writes the state file, the next ones the journal.
+	updates := journalCompactUpdates + 2
+	for i := 0; i < updates; i++ {
+		setEntry(t, path, fmt.Sprintf("%d", i), "x")
+	}
+
+	_, err := os.Stat(path + journalFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	var s testJournalState
+	_, err = ReadJSONFile(path, &s)
+	require.NoError(t, err)
+	assert.Len(t, s.Entries, updates)
+	assert.Equal(t, updates, s.Count)
+}
+
+func TestJournaledFileCompactionCrash(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	setEntry(t, path, "a", "1")
+	setEntry(t, path, "b", "2")
+	setEntry(t, path, "a", "")
+	journal, err := ioutil.ReadFile(path + journalFileSuffix)
+	require.NoError(t, err)
+
+	// Crash after the compacted state file is written, but before the journal is removed.
+	j, err := loadJournal(path)
+	require.NoError(t, err)
+	require.NoError(t, compactJournal(path, j.tree))
+	require.NoError(t, ioutil.WriteFile(path+journalFileSuffix, journal, filePerm))
+
+	// The state file is updated concurrently, e.g. by a plugin version without journals.
+	var s testJournalState
+	require.NoError(t, UpdateJSONFile(path, &s, func() error {
+		s.Entries["a"] = "3"
+		return nil
+	}))
+
+	// The stale journal is neither replayed nor extended.
+	s = testJournalState{}
+	_, err = ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "3", "b": "2"}, s.Entries)
+
+	setEntry(t, path, "c", "4")
+	s = testJournalState{}
+	_, err = ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "3", "b": "2", "c": "4"}, s.Entries)
+
+	data, err := ioutil.ReadFile(path + journalFileSuffix)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 2)
+}
+
+func TestJournaledFileMovedAside(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	setEntry(t, path, "a", "1")
+	setEntry(t, path, "b", "2")
+
+	// Crash after the state file is moved aside, but before the journal is removed.
+	require.NoError(t, os.Rename(path, path+".corrupt"))
+
+	var s testJournalState
+	found, err := ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, s.Entries)
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// lockRetryInterval is the interval between attempts to acquire a lock.
+	lockRetryInterval = 10 * time.Millisecond
+
+	// networkLockTimeout is the maximum time to wait for the lock of a network. Operations on
+	// the same network are queued behind each other, and each may take seconds.
+	networkLockTimeout = 2 * time.Minute
+
+	// networkLocksDirName is the name of the state directory keeping network lock files.
+	networkLocksDirName = "locks"
+)
+
+// LockNetwork acquires the lock of the network on the ENI with the given MAC address, shared by
+// all plugin processes, and returns a function that releases it. Operations on networks of
+// different ENIs proceed concurrently. The lock is held as long as its owner process runs.
+func LockNetwork(dir string, macAddress string) (func(), error) {
+	path, err := networkLockPath(dir, macAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return acquireLock(path, networkLockTimeout)
+}
+
+// TryLockNetwork is like LockNetwork, but fails instead of waiting if the lock is held.
+func TryLockNetwork(dir string, macAddress string) (func(), error) {
+	path, err := networkLockPath(dir, macAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return acquireLock(path, 0)
+}
+
+// networkLockPath returns the path of the lock file of the network on the given ENI.
+func networkLockPath(dir string, macAddress string) (string, error) {
+	lockDir := GetLockDir(dir)
+	err := os.MkdirAll(lockDir, dirPerm)
+	if err != nil {
+		return "", fmt.Errorf("state: failed to create directory %s: %v", lockDir, err)
+	}
+
+	name := strings.Replace(macAddress, ":", "", -1) + lockFileSuffix
+	return filepath.Join(lockDir, name), nil
+}
+
+// acquireLock acquires an exclusive lock shared by all plugin processes on the given lock file,
+// waiting up to timeout for it to be released. The lock is held on an open handle of the file,
+// so the operating system releases it when the owner process exits, and the lock file itself
+// is never removed. It returns a function that releases the lock.
+func acquireLock(path string, timeout time.Duration) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return nil, fmt.Errorf("state: failed to open lock file %s: %v", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("state: failed to lock %s: %v", path, err)
+		}
+		if locked {
+			return func() {
+				unlockFile(file)
+				file.Close()
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("state: timed out waiting for lock %s", path)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	unlock, err := LockNetwork(dir, "02:00:00:00:00:01")
+	require.NoError(t, err)
+
+	// Networks of other ENIs are not serialized.
+	unlockOther, err := LockNetwork(dir, "02:00:00:00:00:02")
+	require.NoError(t, err)
+	unlockOther()
+
+	// Operations on the same network wait for the lock.
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := LockNetwork(dir, "02:00:00:00:00:01")
+		if err == nil {
+			unlock()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = TryLockNetwork(dir, "02:00:00:00:00:01")
+	assert.Error(t, err)
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+}
+
+func TestLockNetworkAbandoned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A process that exits while holding the lock releases it.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockNetworkHelperProcess$")
+	cmd.Env = append(os.Environ(), lockHelperDirEnv+"="+dir)
+	require.NoError(t, cmd.Run())
+
+	unlock, err := TryLockNetwork(dir, "02:00:00:00:00:01")
+	require.NoError(t, err)
+	unlock()
+
+	// The lock file is kept, so that all processes lock the same file.
+	path := filepath.Join(dir, networkLocksDirName, "020000000001"+lockFileSuffix)
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+// lockHelperDirEnv is the environment variable passing the state directory to the helper process.
+const lockHelperDirEnv = "STATE_TEST_LOCK_DIR"
+
+// TestLockNetworkHelperProcess acquires a network lock and exits without releasing it, when run
+// as a helper process by TestLockNetworkAbandoned.
+func TestLockNetworkHelperProcess(t *testing.T) {
+	dir := os.Getenv(lockHelperDirEnv)
+	if dir == "" {
+		return
+	}
+
+	_, err := LockNetwork(dir, "02:00:00:00:00:01")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// lockfileFailImmediately makes LockFileEx fail instead of waiting for a held lock.
+	lockfileFailImmediately = 0x1
+	// lockfileExclusiveLock makes LockFileEx place an exclusive lock.
+	lockfileExclusiveLock = 0x2
+
+	// errorLockViolation is the error returned by LockFileEx if the range is locked.
+	errorLockViolation syscall.Errno = 33
+)
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	// procLockFileEx locks a byte range of a file.
+	procLockFileEx = kernel32.NewProc("LockFileEx")
+	// procUnlockFileEx unlocks a byte range of a file.
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// tryLockFile places an exclusive lock on the first byte of the given file without waiting.
+// It returns false if another file handle holds the lock.
+func tryLockFile(file *os.File) (bool, error) {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(
+		file.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately,
+		0, 1, 0,
+		uintptr(unsafe.Pointer(&overlapped)))
+	if r != 0 {
+		return true, nil
+	}
+	if err == errorLockViolation {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// unlockFile releases the lock on the given file.
+func unlockFile(file *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(
+		file.Fd(),
+		0, 1, 0,
+		uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// VersionsFileName is the name of the file recording the schema versions of the state files
+	// in a state directory.
+	VersionsFileName = "versions.json"
+)
+
+// Migration upgrades the contents of a state file at the given path to the next schema version.
+// A crash may interrupt a migration after some files were upgraded, so migrations must accept
+// contents that are already upgraded.
+type Migration func(path string, data []byte) ([]byte, error)
+
+// FileSchema describes the schema versions of a kind of state file.
+type FileSchema struct {
+	// Name identifies the kind of state file in the versions file.
+	Name string
+	// Pattern is the glob pattern of the paths of the state files relative to the state directory.
+	Pattern string
+	// Journaled is whether the state files are written by UpdateJournaledFile.
+	Journaled bool
+	// Migrations upgrade the state files from each schema version to the next. Files written
+	// before schema versioning have version 0, and the current version is len(Migrations).
+	Migrations []Migration
+}
+
+// Version returns the current schema version.
+func (schema *FileSchema) Version() int {
+	return len(schema.Migrations)
+}
+
+// Migrate upgrades the state files in the given directory to the current schema versions, so
+// that a newer plugin does not misinterpret records written by an older one, e.g. after an
+// in-place upgrade on a host with running containers. It only reads the versions file if all
+// state files are current. It returns an error if state files were written by a newer version,
+// which this version could misinterpret. If a signing key is set, it returns an error if the
+// versions file is not signed, e.g. because the state files were written before the key was set.
+// Such state files must be adopted with AdoptUnsignedFiles.
+func Migrate(dir string, schemas []FileSchema) error {
+	path := filepath.Join(dir, VersionsFileName)
+	versions := make(map[string]int)
+	_, err := ReadJSONFile(path, &versions)
+	if err != nil {
+		return err
+	}
+
+	current, err := checkVersions(versions, schemas)
+	if err != nil || current {
+		return err
+	}
+
+	// Migrations run at most once, by the first plugin process holding the lock.
+	return UpdateJSONFile(path, &versions, func() error {
+		current, err := checkVersions(versions, schemas)
+		if err != nil || current {
+			return err
+		}
+
+		for _, schema := range schemas {
+			version := versions[schema.Name]
+			if version == schema.Version() {
+				continue
+			}
+
+			paths, err := filepath.Glob(filepath.Join(dir, schema.Pattern))
+			if err != nil {
+				return fmt.Errorf("state: invalid pattern %s: %v", schema.Pattern, err)
+			}
+			sort.Strings(paths)
+
+			for _, statePath := range paths {
+				err = migrateFile(statePath, &schema, version)
+				if err != nil {
+					return err
+				}
+			}
+
+			versions[schema.Name] = schema.Version()
+		}
+
+		return nil
+	})
+}
+
+// checkVersions returns whether the recorded schema versions are current, or an error if any
+// is newer than the current version.
+func checkVersions(versions map[string]int, schemas []FileSchema) (bool, error) {
+	current := true
+	for _, schema := range schemas {
+		version := versions[schema.Name]
+		if version > schema.Version() {
+			return false, fmt.Errorf("state: %s files have schema version %d, newer than supported version %d",
+				schema.Name, version, schema.Version())
+		}
+		if version < schema.Version() {
+			current = false
+		}
+	}
+
+	return current, nil
+}
+
+// migrateFile upgrades a state file from the given schema version to the current version.
+func migrateFile(path string, schema *FileSchema, version int) error {
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var data []byte
+	if schema.Journaled {
+		// Fold the journal into the file first, so that no records in the old schema are
+		// replayed on the upgraded file.
+		j, err := loadJournal(path)
+		if err != nil {
+			return err
+		}
+		if !j.found {
+			return nil
+		}
+		err = compactJournal(path, j.tree)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("state: failed to read file %s: %v", path, err)
+	}
+
+	data, _, err = verifyData(path, "", data)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range schema.Migrations[version:] {
+		data, err = migration(path, data)
+		if err != nil {
+			return fmt.Errorf("state: failed to migrate file %s: %v", path, err)
+		}
+	}
+
+	if !json.Valid(data) {
+		return fmt.Errorf("state: migration of file %s produced invalid JSON", path)
+	}
+
+	data, _ = signData(path, "", data)
+	return writeFileAtomic(path, data)
+}
+
+// AdoptUnsignedFiles signs the unsigned state files in the given directory with the signing key,
+// which must be set. Signed state files are trusted only if their signatures are valid, so state
+// files written before the key was set are rejected until they are adopted. Unsigned files are
+// indistinguishable from tampered ones, so adoption is an explicit operator action, and is never
+// performed by CNI commands. Files with invalid signatures are left as they are.
+func AdoptUnsignedFiles(dir string, schemas []FileSchema) error {
+	if getSigningKey() == nil {
+		return fmt.Errorf("state: cannot adopt unsigned files without a signing key")
+	}
+
+	err := os.MkdirAll(dir, dirPerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to create directory %s: %v", dir, err)
+	}
+
+	path := filepath.Join(dir, VersionsFileName)
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, schema := range schemas {
+		paths, err := filepath.Glob(filepath.Join(dir, schema.Pattern))
+		if err != nil {
+			return fmt.Errorf("state: invalid pattern %s: %v", schema.Pattern, err)
+		}
+
+		for _, statePath := range paths {
+			err = signFile(statePath, schema.Journaled)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The versions file is locked already.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("state: failed to read file %s: %v", path, err)
+	}
+
+	if _, signed := parseSignedData(data); signed {
+		return nil
+	}
+
+	data, _ = signData(path, "", data)
+	return writeFileAtomic(path, data)
+}
+
+// signFile signs the given state file if it is not signed. The journal of a journaled state
+// file is folded into the signed file.
+func signFile(path string, journaled bool) error {
+	unlock, err := acquireLock(path+lockFileSuffix, fileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("state: failed to read file %s: %v", path, err)
+	}
+
+	if _, signed := parseSignedData(data); signed {
+		return nil
+	}
+
+	if journaled {
+		j, err := loadJournalWithKey(nil, path)
+		if err != nil {
+			return err
+		}
+		return compactJournal(path, j.tree)
+	}
+
+	data, _ = signData(path, "", data)
+	return writeFileAtomic(path, data)
+}
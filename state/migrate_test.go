@@ -0,0 +1,211 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// renameField returns a migration renaming a field of a JSON object, which accepts contents
+// that are already migrated, and counts its calls.
+func renameField(from string, to string, calls *int) Migration {
+	return func(path string, data []byte) ([]byte, error) {
+		*calls++
+		return bytes.Replace(data, []byte(`"`+from+`"`), []byte(`"`+to+`"`), -1), nil
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Files written before schema versioning.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "results"), dirPerm))
+	for _, name := range []string{"a.json", "b.json"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "results", name), []byte(`{"Addr":"10.0.1.20"}`), filePerm))
+	}
+
+	var calls int
+	schemas := []FileSchema{
+		{Name: "results", Pattern: "results/*.json", Migrations: []Migration{renameField("Addr", "Address", &calls)}},
+		{Name: "counters", Pattern: countersFileName},
+	}
+
+	require.NoError(t, Migrate(dir, schemas))
+	assert.Equal(t, 2, calls)
+
+	for _, name := range []string{"a.json", "b.json"} {
+		var v map[string]string
+		_, err = ReadJSONFile(filepath.Join(dir, "results", name), &v)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"Address": "10.0.1.20"}, v)
+	}
+
+	var versions map[string]int
+	_, err = ReadJSONFile(filepath.Join(dir, VersionsFileName), &versions)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"results": 1}, versions)
+
+	// Files are migrated only once.
+	require.NoError(t, Migrate(dir, schemas))
+	assert.Equal(t, 2, calls)
+
+	// Only newer migrations run on files of an older version.
+	var newCalls int
+	schemas[0].Migrations = append(schemas[0].Migrations, renameField("Address", "IPAddress", &newCalls))
+	require.NoError(t, Migrate(dir, schemas))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, newCalls)
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, VersionsFileName), []byte(`{"results":2}`), filePerm))
+
+	var calls int
+	schemas := []FileSchema{
+		{Name: "results", Pattern: "results/*.json", Migrations: []Migration{renameField("Addr", "Address", &calls)}},
+	}
+	assert.Error(t, Migrate(dir, schemas))
+}
+
+func TestMigrateJournaledFile(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	setEntry(t, path, "a", "1")
+	setEntry(t, path, "b", "2")
+	_, err := os.Stat(path + journalFileSuffix)
+	require.NoError(t, err)
+
+	var calls int
+	schemas := []FileSchema{
+		{Name: "test", Pattern: "test.json", Journaled: true, Migrations: []Migration{renameField("entries", "items", &calls)}},
+	}
+	require.NoError(t, Migrate(filepath.Dir(path), schemas))
+	assert.Equal(t, 1, calls)
+
+	// The journal is folded into the migrated file.
+	_, err = os.Stat(path + journalFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	var v struct {
+		Items map[string]string `json:"items"`
+		Count int               `json:"count"`
+	}
+	_, err = ReadJournaledFile(path, &v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, v.Items)
+	assert.Equal(t, 2, v.Count)
+}
+
+func TestMigrateSignedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	SetSigningKey(testSigningKey)
+	defer SetSigningKey(nil)
+
+	path := filepath.Join(dir, "test.json")
+	v := map[string]string{}
+	require.NoError(t, UpdateJSONFile(path, &v, func() error {
+		v["Addr"] = "10.0.1.20"
+		return nil
+	}))
+
+	var calls int
+	schemas := []FileSchema{
+		{Name: "test", Pattern: "test.json", Migrations: []Migration{renameField("Addr", "Address", &calls)}},
+	}
+
+	// Signed files are not migrated without the key, which would drop their signatures.
+	SetSigningKey(nil)
+	assert.Error(t, Migrate(dir, schemas))
+
+	// Migrated files remain signed.
+	SetSigningKey(testSigningKey)
+	require.NoError(t, Migrate(dir, schemas))
+	v = map[string]string{}
+	_, err = ReadJSONFile(path, &v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Address": "10.0.1.20"}, v)
+}
+
+func TestAdoptUnsignedFiles(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+	dir := filepath.Dir(path)
+
+	// State files are written before a signing key is set.
+	setEntry(t, path, "a", "1")
+	setEntry(t, path, "b", "2")
+	countersPath := filepath.Join(dir, countersFileName)
+	require.NoError(t, IncrementCounter(dir, CounterAttachRetries))
+
+	SetSigningKey(testSigningKey)
+	defer SetSigningKey(nil)
+
+	schemas := []FileSchema{
+		CountersSchema,
+		{Name: "test", Pattern: "test.json", Journaled: true},
+	}
+
+	// Unsigned state files are rejected until they are adopted.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, VersionsFileName), []byte(`{}`), filePerm))
+	assert.Error(t, Migrate(dir, schemas))
+	_, err := LoadCounters(dir)
+	assert.Error(t, err)
+
+	require.NoError(t, AdoptUnsignedFiles(dir, schemas))
+	require.NoError(t, Migrate(dir, schemas))
+
+	var s testJournalState
+	_, err = ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, s.Entries)
+
+	counters, err := LoadCounters(dir)
+	require.NoError(t, err)
+	assert.Equal(t, Counters{CounterAttachRetries: 1}, counters)
+
+	// Unsigned files written after the state files were signed are rejected.
+	require.NoError(t, ioutil.WriteFile(countersPath, []byte(`{"attachRetries":5}`), filePerm))
+	require.NoError(t, Migrate(dir, schemas))
+	_, err = LoadCounters(dir)
+	assert.Error(t, err)
+
+	// Unsigned versions files are not trusted, even if they were deleted and recreated.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, VersionsFileName), []byte(`{}`), filePerm))
+	assert.Error(t, Migrate(dir, schemas))
+}
+
+func TestAdoptUnsignedFilesWithoutKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Error(t, AdoptUnsignedFiles(dir, []FileSchema{CountersSchema}))
+}
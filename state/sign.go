@@ -0,0 +1,183 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// minSigningKeySize is the minimum size of state signing keys in bytes.
+	minSigningKeySize = 32
+)
+
+var (
+	// signingKey is the key of the HMAC signatures of state files. State files are not signed
+	// if nil.
+	signingKey      []byte
+	signingKeyMutex sync.RWMutex
+)
+
+// signedData is the envelope of signed state data.
+type signedData struct {
+	Data json.RawMessage `json:"data"`
+	HMAC string          `json:"hmac"`
+}
+
+// SetSigningKey sets the key used to sign state files and verify their signatures. State files
+// written with a key are integrity-protected against tampering, e.g. to trick commands into
+// operating on the resources of another container. If key is nil, state files are not signed,
+// and signed state files cannot be read.
+func SetSigningKey(key []byte) {
+	signingKeyMutex.Lock()
+	defer signingKeyMutex.Unlock()
+	signingKey = key
+}
+
+// getSigningKey returns the key used to sign state files.
+func getSigningKey() []byte {
+	signingKeyMutex.RLock()
+	defer signingKeyMutex.RUnlock()
+	return signingKey
+}
+
+// LoadSigningKey reads a state signing key from a file that must not be accessible by other
+// users.
+func LoadSigningKey(path string) ([]byte, error) {
+	key, err := ReadSecretFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("state: failed to read signing key: %v", err)
+	}
+
+	if len(key) < minSigningKeySize {
+		return nil, fmt.Errorf("state: signing key in %s is shorter than %d bytes", path, minSigningKeySize)
+	}
+
+	return key, nil
+}
+
+// LoadHostSigningKey reads the host's state signing key from the file returned by
+// GetSigningKeyFile. It returns a nil key if the host has no key file at the default path.
+func LoadHostSigningKey() ([]byte, error) {
+	path := GetSigningKeyFile()
+	if os.Getenv(envSigningKeyFile) == "" {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	return LoadSigningKey(path)
+}
+
+// ReadSecretFile reads a secret, without surrounding whitespace, from a file that must not be
+// accessible by other users.
+func ReadSecretFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkKeyFilePerm(info)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret file %s: %v", path, err)
+	}
+
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSpace(secret), nil
+}
+
+// signData signs data stored in the file at the given path, chained to the signature of the
+// previous data in the same file, if any. It returns the signed data and its signature.
+func signData(path string, prevHMAC string, data []byte) ([]byte, string) {
+	key := getSigningKey()
+	if key == nil {
+		return data, ""
+	}
+
+	mac := computeHMAC(key, path, prevHMAC, data)
+
+	// The envelope is assembled verbatim, so that the signed bytes are read back unchanged.
+	var buf bytes.Buffer
+	buf.WriteString(`{"data":`)
+	buf.Write(data)
+	buf.WriteString(`,"hmac":"`)
+	buf.WriteString(mac)
+	buf.WriteString(`"}`)
+
+	return buf.Bytes(), mac
+}
+
+// verifyData verifies signed data read from the file at the given path. It returns the data
+// without the envelope and its signature.
+func verifyData(path string, prevHMAC string, data []byte) ([]byte, string, error) {
+	return verifyDataWithKey(getSigningKey(), path, prevHMAC, data)
+}
+
+// verifyDataWithKey is like verifyData with the given signing key. If key is nil, only unsigned
+// data is accepted, so that signed state is never trusted without verification.
+func verifyDataWithKey(key []byte, path string, prevHMAC string, data []byte) ([]byte, string, error) {
+	envelope, signed := parseSignedData(data)
+	if key == nil {
+		if signed {
+			return nil, "", fmt.Errorf("state: file %s is signed, but no signing key is set", path)
+		}
+		return data, "", nil
+	}
+
+	if !signed {
+		return nil, "", corruptFileErrorf("state: file %s is not signed", path)
+	}
+
+	mac := computeHMAC(key, path, prevHMAC, envelope.Data)
+	if !hmac.Equal([]byte(mac), []byte(envelope.HMAC)) {
+		return nil, "", corruptFileErrorf("state: invalid signature in file %s", path)
+	}
+
+	return envelope.Data, envelope.HMAC, nil
+}
+
+// parseSignedData returns the envelope of signed data, and whether the data is signed.
+func parseSignedData(data []byte) (*signedData, bool) {
+	var envelope signedData
+	err := json.Unmarshal(data, &envelope)
+	return &envelope, err == nil && len(envelope.Data) != 0 && envelope.HMAC != ""
+}
+
+// computeHMAC returns the signature of data in the file at the given path. The file name is
+// signed as well, so that signed files cannot be swapped, e.g. the cached results of two
+// containers.
+func computeHMAC(key []byte, path string, prevHMAC string, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(filepath.Base(path)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(prevHMAC))
+	mac.Write([]byte{0})
+	mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
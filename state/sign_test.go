@@ -0,0 +1,149 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSigningKey = []byte(strings.Repeat("k", minSigningKeySize))
+
+func TestSignedJSONFile(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	SetSigningKey(testSigningKey)
+	defer SetSigningKey(nil)
+
+	v := map[string]string{}
+	require.NoError(t, UpdateJSONFile(path, &v, func() error {
+		v["container1"] = "10.0.1.20"
+		return nil
+	}))
+
+	v = map[string]string{}
+	found, err := ReadJSONFile(path, &v)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10.0.1.20", v["container1"])
+
+	// Signed files cannot be moved to another name.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	otherPath := filepath.Join(filepath.Dir(path), "other.json")
+	require.NoError(t, ioutil.WriteFile(otherPath, data, 0600))
+	_, err = ReadJSONFile(otherPath, &v)
+	assert.Error(t, err)
+
+	// Tampered files are detected.
+	tampered := bytes.Replace(data, []byte("10.0.1.20"), []byte("10.0.1.21"), 1)
+	require.NoError(t, ioutil.WriteFile(path, tampered, 0600))
+	_, err = ReadJSONFile(path, &v)
+	assert.Error(t, err)
+
+	// Unsigned files are rejected.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"container1":"10.0.1.21"}`), 0600))
+	_, err = ReadJSONFile(path, &v)
+	assert.Error(t, err)
+
+	// Signed files are not read without a key, which would skip verification.
+	SetSigningKey(nil)
+	_, err = ReadJSONFile(otherPath, &v)
+	assert.Error(t, err)
+	assert.False(t, IsCorrupt(err))
+}
+
+func TestSignedJournaledFile(t *testing.T) {
+	path, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	SetSigningKey(testSigningKey)
+	defer SetSigningKey(nil)
+
+	setEntry(t, path, "a", "1")
+	setEntry(t, path, "b", "2")
+	setEntry(t, path, "a", "")
+
+	var s testJournalState
+	_, err := ReadJournaledFile(path, &s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"b": "2"}, s.Entries)
+
+	// Journal updates cannot be reordered.
+	journalPath := path + journalFileSuffix
+	data, err := ioutil.ReadFile(journalPath)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	require.Len(t, lines, 4)
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte(lines[0]+lines[2]+lines[1]), 0600))
+	_, err = ReadJournaledFile(path, &s)
+	assert.Error(t, err)
+
+	// Unsigned journal updates are rejected.
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte(lines[0]+lines[1]+`[{"p":["count"],"v":0}]`+"\n"), 0600))
+	_, err = ReadJournaledFile(path, &s)
+	assert.Error(t, err)
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key")
+	require.NoError(t, ioutil.WriteFile(path, append(testSigningKey, '\n'), 0600))
+	key, err := LoadSigningKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, testSigningKey, key)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("short"), 0600))
+	_, err = LoadSigningKey(path)
+	assert.Error(t, err)
+
+	_, err = LoadSigningKey(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestLoadHostSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv(envStateDir, dir)
+	defer os.Unsetenv(envStateDir)
+
+	// Signing is disabled on hosts without a key file.
+	key, err := LoadHostSigningKey()
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, signingKeyFileName), testSigningKey, 0600))
+	key, err = LoadHostSigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, testSigningKey, key)
+
+	// Custom key files must exist.
+	os.Setenv(envSigningKeyFile, filepath.Join(dir, "missing"))
+	defer os.Unsetenv(envSigningKeyFile)
+	_, err = LoadHostSigningKey()
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// slotTimeout is the maximum time to wait for a free slot.
+	slotTimeout = 2 * time.Minute
+
+	// slotsDirName is the name of the state directory keeping slot lock files.
+	slotsDirName = "slots"
+)
+
+// AcquireSlot acquires one of limit slots shared by all plugin processes on the node, and
+// returns a function that releases it. This bounds the number of concurrent operations, e.g. on
+// a host networking service that degrades under load. Slots are locks on slot files, which the
+// operating system releases when the owner process exits.
+func AcquireSlot(dir string, limit int) (func(), error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("state: invalid slot limit %d", limit)
+	}
+
+	slotsDir := filepath.Join(dir, slotsDirName)
+	err := os.MkdirAll(slotsDir, dirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("state: failed to create directory %s: %v", slotsDir, err)
+	}
+
+	// Open all slot files once, starting at a different slot in each process to spread contention.
+	first := os.Getpid() % limit
+	files := make([]*os.File, 0, limit)
+	closeFiles := func(keep *os.File) {
+		for _, file := range files {
+			if file != keep {
+				file.Close()
+			}
+		}
+	}
+
+	for i := 0; i < limit; i++ {
+		path := filepath.Join(slotsDir, fmt.Sprintf("%d%s", (first+i)%limit, lockFileSuffix))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, filePerm)
+		if err != nil {
+			closeFiles(nil)
+			return nil, fmt.Errorf("state: failed to open slot file %s: %v", path, err)
+		}
+		files = append(files, file)
+	}
+
+	deadline := time.Now().Add(slotTimeout)
+	for {
+		for _, file := range files {
+			locked, err := tryLockFile(file)
+			if err != nil {
+				closeFiles(nil)
+				return nil, fmt.Errorf("state: failed to lock slot %s: %v", file.Name(), err)
+			}
+			if locked {
+				closeFiles(file)
+				return func() {
+					unlockFile(file)
+					file.Close()
+				}, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			closeFiles(nil)
+			return nil, fmt.Errorf("state: timed out waiting for one of %d slots", limit)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireSlot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = AcquireSlot(dir, 0)
+	assert.Error(t, err)
+
+	// Up to the limit, slots are acquired without waiting.
+	release1, err := AcquireSlot(dir, 2)
+	require.NoError(t, err)
+	release2, err := AcquireSlot(dir, 2)
+	require.NoError(t, err)
+	release2()
+
+	// Past the limit, operations wait for a free slot.
+	release2, err = AcquireSlot(dir, 2)
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := AcquireSlot(dir, 2)
+		if err == nil {
+			release()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("slot acquired past the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slot not acquired after release")
+	}
+	release2()
+}
+
+func TestAcquireSlotAbandoned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A process that exits while holding the only slot releases it.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAcquireSlotHelperProcess$")
+	cmd.Env = append(os.Environ(), slotHelperDirEnv+"="+dir)
+	require.NoError(t, cmd.Run())
+
+	release, err := AcquireSlot(dir, 1)
+	require.NoError(t, err)
+	release()
+}
+
+// slotHelperDirEnv is the environment variable passing the state directory to the helper process.
+const slotHelperDirEnv = "STATE_TEST_SLOT_DIR"
+
+// TestAcquireSlotHelperProcess acquires a slot and exits without releasing it, when run as a
+// helper process by TestAcquireSlotAbandoned.
+func TestAcquireSlotHelperProcess(t *testing.T) {
+	dir := os.Getenv(slotHelperDirEnv)
+	if dir == "" {
+		return
+	}
+
+	_, err := AcquireSlot(dir, 1)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// Environment variables for custom state, lock and cache directories.
+	envStateDir = "VPC_CNI_STATE_DIR"
+	envLockDir  = "VPC_CNI_LOCK_DIR"
+	envCacheDir = "VPC_CNI_CACHE_DIR"
+
+	// envSigningKeyFile is the environment variable for a custom state signing key file.
+	envSigningKeyFile = "VPC_CNI_STATE_KEY_FILE"
+
+	// signingKeyFileName is the name of the default state signing key file in the state root
+	// directory.
+	signingKeyFileName = "state.key"
+
+	// Permissions used for state directories and files.
+	dirPerm  = 0700
+	filePerm = 0600
+)
+
+var (
+	// effectiveRootDir is the default root directory, or its fallback if it is not writable.
+	effectiveRootDir     string
+	effectiveRootDirOnce sync.Once
+)
+
+// GetDir returns the effective state directory for the given plugin.
+func GetDir(pluginName string) string {
+	rootDir := os.Getenv(envStateDir)
+	if rootDir == "" {
+		rootDir = getDefaultRootDir()
+	}
+
+	return filepath.Join(rootDir, pluginName)
+}
+
+// GetSigningKeyFile returns the path of the host's state signing key file. The key is host-level
+// configuration shared by all plugins and the node agent, rather than part of network
+// configurations, so that a network configuration cannot disable verification of signed state.
+func GetSigningKeyFile() string {
+	path := os.Getenv(envSigningKeyFile)
+	if path == "" {
+		return filepath.Join(GetDir(""), signingKeyFileName)
+	}
+
+	return path
+}
+
+// GetLockDir returns the effective directory of lock files for the given state directory.
+// Lock files can be kept apart from state, for instance on a tmpfs, since they are meaningless
+// after a reboot.
+func GetLockDir(dir string) string {
+	lockDir := os.Getenv(envLockDir)
+	if lockDir == "" {
+		return filepath.Join(dir, networkLocksDirName)
+	}
+
+	return lockDir
+}
+
+// GetCacheDir returns the effective directory of the given node-wide cache.
+func GetCacheDir(cacheName string) string {
+	cacheDir := os.Getenv(envCacheDir)
+	if cacheDir == "" {
+		return GetDir(cacheName)
+	}
+
+	return filepath.Join(cacheDir, cacheName)
+}
+
+// getDefaultRootDir returns the default root directory for plugin state. Hosts with a read-only
+// root filesystem, such as Bottlerocket or hardened Windows images, may not allow creating the
+// default directory, in which case state is kept in a per-OS fallback directory instead. The
+// directory is chosen without writing to the filesystem, since every plugin invocation resolves
+// it. State directories are created by the first state update.
+func getDefaultRootDir() string {
+	effectiveRootDirOnce.Do(func() {
+		effectiveRootDir = defaultRootDir
+		if !canWriteDir(defaultRootDir) {
+			effectiveRootDir = fallbackRootDir
+		}
+	})
+
+	return effectiveRootDir
+}
+
+// canWriteDir returns whether the given directory is writable, or can be created in its nearest
+// existing ancestor directory, without writing to the filesystem.
+func canWriteDir(dir string) bool {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			return info.IsDir() && isWritableDir(dir)
+		}
+
+		parent := filepath.Dir(dir)
+		if !os.IsNotExist(err) || parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// CheckWritable verifies that the given state directory exists, or can be created,
+// and that files can be written to it. It writes to the directory, so it runs only where
+// state must be writable, such as in health checks and ADD commands.
+func CheckWritable(dir string) error {
+	err := os.MkdirAll(dir, dirPerm)
+	if err != nil {
+		return fmt.Errorf("state: failed to create directory %s: %v", dir, err)
+	}
+
+	file, err := ioutil.TempFile(dir, ".probe")
+	if err != nil {
+		return fmt.Errorf("state: failed to write to directory %s: %v", dir, err)
+	}
+
+	name := file.Name()
+	file.Close()
+	os.Remove(name)
+
+	return nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// defaultRootDir is the default root directory for plugin state on Linux.
+	defaultRootDir = "/var/lib/amazon-vpc-cni-plugins"
+
+	// fallbackRootDir is the root directory for plugin state on hosts where the default root
+	// directory is not writable. Bottlerocket, for instance, keeps /var/lib writable, but other
+	// hardened images only allow writes to /run.
+	fallbackRootDir = "/run/amazon-vpc-cni-plugins"
+)
+
+// isWritableDir returns whether the calling process may create files in the given directory.
+// Read-only filesystems are reported as not writable.
+func isWritableDir(dir string) bool {
+	return unix.Access(dir, unix.W_OK) == nil
+}
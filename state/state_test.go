@@ -0,0 +1,74 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDir(t *testing.T) {
+	os.Setenv(envStateDir, "/tmp/state")
+	defer os.Unsetenv(envStateDir)
+
+	assert.Equal(t, filepath.Join("/tmp/state", "plugin"), GetDir("plugin"))
+}
+
+func TestGetLockDir(t *testing.T) {
+	assert.Equal(t, filepath.Join("/tmp/state", networkLocksDirName), GetLockDir("/tmp/state"))
+
+	os.Setenv(envLockDir, "/tmp/locks")
+	defer os.Unsetenv(envLockDir)
+
+	assert.Equal(t, "/tmp/locks", GetLockDir("/tmp/state"))
+}
+
+func TestGetCacheDir(t *testing.T) {
+	os.Setenv(envStateDir, "/tmp/state")
+	defer os.Unsetenv(envStateDir)
+
+	assert.Equal(t, filepath.Join("/tmp/state", "imds"), GetCacheDir("imds"))
+
+	os.Setenv(envCacheDir, "/tmp/cache")
+	defer os.Unsetenv(envCacheDir)
+
+	assert.Equal(t, filepath.Join("/tmp/cache", "imds"), GetCacheDir("imds"))
+}
+
+func TestCanWriteDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.True(t, canWriteDir(dir))
+
+	// Missing directories can be created in their nearest existing ancestor.
+	missing := filepath.Join(dir, "a", "b")
+	assert.True(t, canWriteDir(missing))
+
+	// The check does not create directories.
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Directories cannot be created under regular files.
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, filePerm))
+	assert.False(t, canWriteDir(file))
+	assert.False(t, canWriteDir(filepath.Join(file, "a")))
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// fileAddFile and fileAddSubdirectory are the access rights for creating files and
+	// directories in a directory.
+	fileAddFile         = 0x2
+	fileAddSubdirectory = 0x4
+)
+
+var (
+	// defaultRootDir is the default root directory for plugin state on Windows. It follows the
+	// ProgramData known folder, which images may relocate off the system drive.
+	defaultRootDir = filepath.Join(getProgramDataDir(), "Amazon", "VPC-CNI-Plugins")
+
+	// fallbackRootDir is the root directory for plugin state on hosts where the default root
+	// directory is not writable, such as hardened images with a locked down ProgramData.
+	fallbackRootDir = filepath.Join(os.TempDir(), "Amazon", "VPC-CNI-Plugins")
+)
+
+// getProgramDataDir returns the path of the ProgramData known folder.
+func getProgramDataDir() string {
+	dir := os.Getenv("ProgramData")
+	if dir == "" {
+		dir = `C:\ProgramData`
+	}
+
+	return dir
+}
+
+// isWritableDir returns whether the calling process may create files in the given directory.
+// Opening the directory with the access rights for creating files and directories checks them
+// against its ACL without writing to it.
+func isWritableDir(dir string) bool {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return false
+	}
+
+	handle, err := syscall.CreateFile(
+		path,
+		fileAddFile|fileAddSubdirectory,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_FLAG_BACKUP_SEMANTICS,
+		0)
+	if err != nil {
+		return false
+	}
+	syscall.CloseHandle(handle)
+
+	return true
+}
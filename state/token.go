@@ -0,0 +1,58 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// envDebugToken is the environment variable in which callers of debug commands pass the
+	// debug authorization token.
+	envDebugToken = "VPC_CNI_DEBUG_TOKEN"
+	// envDebugTokenFile is the environment variable overriding the path of the debug token file.
+	envDebugTokenFile = "VPC_CNI_DEBUG_TOKEN_FILE"
+
+	// DebugTokenFileName is the name of the debug token file in the state root directory.
+	DebugTokenFileName = "debug.token"
+)
+
+// AuthorizeDebugCommand returns an error unless the caller of a state-mutating debug command
+// passed the debug token provisioned on the host. The token file is readable only by
+// administrators, which prevents unprivileged local processes from tearing down task
+// networking through debug commands. Debug commands are refused if no token is provisioned.
+func AuthorizeDebugCommand(command string) error {
+	path := os.Getenv(envDebugTokenFile)
+	if path == "" {
+		path = filepath.Join(GetDir(""), DebugTokenFileName)
+	}
+
+	token, err := ReadSecretFile(path)
+	if err != nil {
+		return fmt.Errorf("state: debug command %s refused, no debug token: %v", command, err)
+	}
+	if len(token) == 0 {
+		return fmt.Errorf("state: debug command %s refused, debug token file %s is empty", command, path)
+	}
+
+	presented := []byte(os.Getenv(envDebugToken))
+	if subtle.ConstantTimeCompare(presented, token) != 1 {
+		return fmt.Errorf("state: debug command %s refused, invalid debug token in %s", command, envDebugToken)
+	}
+
+	return nil
+}
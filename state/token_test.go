@@ -0,0 +1,56 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizeDebugCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer os.Unsetenv(envStateDir)
+	defer os.Unsetenv(envDebugToken)
+	os.Setenv(envStateDir, dir)
+
+	// Refused without a provisioned token.
+	os.Setenv(envDebugToken, "")
+	assert.Error(t, AuthorizeDebugCommand("prewarm"))
+
+	err = ioutil.WriteFile(filepath.Join(dir, DebugTokenFileName), []byte("s3cr3t-token\n"), 0600)
+	require.NoError(t, err)
+
+	for token, authorized := range map[string]bool{
+		"":              false,
+		"s3cr3t":        false,
+		"s3cr3t-token!": false,
+		"s3cr3t-token":  true,
+	} {
+		os.Setenv(envDebugToken, token)
+		err = AuthorizeDebugCommand("prewarm")
+		if authorized {
+			assert.NoError(t, err, token)
+		} else {
+			assert.Error(t, err, token)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// +build e2e_test
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-plugins/network/netns"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// eniName is the name of the dummy link standing in for the ENI.
+	eniName = networkName + "eni"
+
+	nsName = networkName + "ns"
+)
+
+func TestAddDel(t *testing.T) {
+	r := newRunner(t)
+	defer r.close(t)
+
+	setupENI(t)
+	defer cleanupLinks(t)
+
+	targetNS, err := netns.NewNetNS(nsName)
+	require.NoError(t, err, "Unable to create the container network namespace")
+	defer targetNS.Close()
+
+	netConf := []byte(fmt.Sprintf(netConfJSONFormat,
+		networkName, eniName, eniIPAddress, containerIPAddress, gatewayIPAddress))
+
+	result, err := r.add(netConf, targetNS.GetPath())
+	require.NoError(t, err, "Unable to execute ADD command")
+	requireResult(t, result)
+
+	// Verify the container interface and connectivity to the host through the bridge.
+	err = targetNS.Run(func() error {
+		link, err := netlink.LinkByName(ifName)
+		require.NoError(t, err, "Unable to find container interface")
+
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		require.NoError(t, err)
+		require.Len(t, addrs, 1)
+		assert.Equal(t, containerIPAddress, addrs[0].IPNet.String())
+		return nil
+	})
+	require.NoError(t, err)
+
+	eniIP, _, _ := net.ParseCIDR(eniIPAddress)
+	output, err := exec.Command("ip", "netns", "exec", nsName,
+		"ping", "-c", "3", "-W", "2", eniIP.String()).CombinedOutput()
+	assert.NoError(t, err, "Container cannot reach the ENI: %s", output)
+
+	// A repeated ADD is idempotent.
+	_, err = r.add(netConf, targetNS.GetPath())
+	require.NoError(t, err, "Unable to execute repeated ADD command")
+
+	err = r.del(netConf, targetNS.GetPath())
+	require.NoError(t, err, "Unable to execute DEL command")
+
+	// Verify that the endpoint was cleaned up.
+	err = targetNS.Run(func() error {
+		_, err := netlink.LinkByName(ifName)
+		assert.Error(t, err, "Container interface was not deleted")
+		return nil
+	})
+	require.NoError(t, err)
+
+	containerIP, _, _ := net.ParseCIDR(containerIPAddress)
+	routes, err := netlink.RouteGet(containerIP)
+	if err == nil {
+		for _, route := range routes {
+			link, err := netlink.LinkByIndex(route.LinkIndex)
+			if err == nil {
+				assert.False(t, strings.HasPrefix(link.Attrs().Name, networkName+"br"),
+					"Route to the container was not deleted")
+			}
+		}
+	}
+
+	// A repeated DEL succeeds.
+	err = r.del(netConf, targetNS.GetPath())
+	assert.NoError(t, err, "Unable to execute repeated DEL command")
+}
+
+// setupENI creates a disposable dummy link to stand in for the ENI.
+func setupENI(t *testing.T) {
+	la := netlink.NewLinkAttrs()
+	la.Name = eniName
+	err := netlink.LinkAdd(&netlink.Dummy{LinkAttrs: la})
+	require.NoError(t, err, "Unable to create dummy ENI link")
+
+	link, err := netlink.LinkByName(eniName)
+	require.NoError(t, err)
+
+	address, err := netlink.ParseAddr(eniIPAddress)
+	require.NoError(t, err)
+	err = netlink.AddrAdd(link, address)
+	require.NoError(t, err, "Unable to assign IP address to dummy ENI link")
+
+	err = netlink.LinkSetUp(link)
+	require.NoError(t, err, "Unable to set dummy ENI link up")
+}
+
+// cleanupLinks deletes all links created for and by the test.
+func cleanupLinks(t *testing.T) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		t.Logf("Unable to list links: %v", err)
+		return
+	}
+
+	// Host veth names are derived from the container ID, which shares the network name prefix.
+	for _, link := range links {
+		name := link.Attrs().Name
+		if strings.HasPrefix(name, networkName) || strings.HasPrefix(name, "veth"+networkName) {
+			err = netlink.LinkDel(link)
+			if err != nil {
+				t.Logf("Unable to delete link %s: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// +build e2e_test
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package e2e contains end-to-end tests that drive the vpc-shared-eni plugin binary against
+// the live host network stack, using disposable adapters in place of real ENIs. The tests
+// create and remove real network configuration, and are meant to validate releases on
+// dedicated test instances.
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	cniTypesCurrent "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// pluginName is the name of the plugin under test.
+	pluginName = "vpc-shared-eni"
+
+	// networkName is the name of the test network. All links created by the tests are
+	// prefixed with it, so that they can be cleaned up reliably.
+	networkName = "vpce2e"
+
+	containerID = "vpce2e0123456789"
+	ifName      = "eth0"
+
+	// Addresses of the disposable adapter standing in for the ENI, and of the container.
+	eniIPAddress       = "172.31.250.10/24"
+	containerIPAddress = "172.31.250.20/24"
+	gatewayIPAddress   = "172.31.250.1"
+
+	netConfJSONFormat = `
+{
+	"type": "vpc-shared-eni",
+	"cniVersion": "0.3.1",
+	"name": "%s",
+	"eniName": "%s",
+	"eniIPAddress": "%s",
+	"ipAddress": "%s",
+	"gatewayIPAddress": "%s",
+	"bridgeType": "L3"
+}
+`
+)
+
+// runner invokes the plugin under test.
+type runner struct {
+	pluginPath  string
+	logDir      string
+	containerID string
+}
+
+// newRunner finds the plugin under test and creates a directory for the plugin logs.
+func newRunner(t *testing.T) *runner {
+	pluginPath, err := invoke.FindInPath(pluginName, []string{os.Getenv("CNI_PATH")})
+	require.NoError(t, err, "Unable to find %s plugin in path", pluginName)
+
+	logDir, err := ioutil.TempDir("", pluginName+"-e2e-test-")
+	require.NoError(t, err, "Unable to create directory for storing test logs")
+
+	os.Setenv("VPC_CNI_LOG_FILE", fmt.Sprintf("%s/%s.log", logDir, pluginName))
+	t.Logf("Using %s for test logs", logDir)
+
+	return &runner{
+		pluginPath:  pluginPath,
+		logDir:      logDir,
+		containerID: containerID,
+	}
+}
+
+// close removes the plugin logs, unless the test failed or logs are to be preserved.
+func (r *runner) close(t *testing.T) {
+	os.Unsetenv("VPC_CNI_LOG_FILE")
+
+	preserve, _ := strconv.ParseBool(os.Getenv("ECS_PRESERVE_E2E_TEST_LOGS"))
+	if !t.Failed() && !preserve {
+		os.RemoveAll(r.logDir)
+	}
+}
+
+// add executes the CNI ADD command and returns its result.
+func (r *runner) add(netConf []byte, netNS string) (*cniTypesCurrent.Result, error) {
+	res, err := invoke.ExecPluginWithResult(r.pluginPath, netConf, r.args("ADD", netNS))
+	if err != nil {
+		return nil, err
+	}
+
+	return cniTypesCurrent.NewResultFromResult(res)
+}
+
+// del executes the CNI DEL command.
+func (r *runner) del(netConf []byte, netNS string) error {
+	return invoke.ExecPluginWithoutResult(r.pluginPath, netConf, r.args("DEL", netNS))
+}
+
+// args returns the arguments for invoking a CNI command.
+func (r *runner) args(command string, netNS string) *invoke.Args {
+	return &invoke.Args{
+		Command:     command,
+		ContainerID: r.containerID,
+		NetNS:       netNS,
+		IfName:      ifName,
+		Path:        os.Getenv("CNI_PATH"),
+	}
+}
+
+// requireResult verifies the result of an ADD command.
+func requireResult(t *testing.T, result *cniTypesCurrent.Result) {
+	require.Len(t, result.IPs, 1)
+	require.Equal(t, containerIPAddress, result.IPs[0].Address.String())
+	require.Equal(t, gatewayIPAddress, result.IPs[0].Gateway.String())
+}
@@ -0,0 +1,137 @@
+// +build e2e_test
+
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Microsoft/hcsshim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// switchName is the name of the internal Hyper-V switch whose host adapter stands in for the ENI.
+	switchName = networkName + "eni"
+
+	// eniName is the name of the host adapter of the internal switch.
+	eniName = "vEthernet (" + switchName + ")"
+
+	// defaultImage is the container image used when E2E_WINDOWS_IMAGE is not set.
+	defaultImage = "mcr.microsoft.com/windows/nanoserver:1809"
+)
+
+func TestAddDel(t *testing.T) {
+	r := newRunner(t)
+	defer r.close(t)
+
+	setupENI(t)
+	defer cleanupENI(t)
+
+	// Start a container without networking to attach the endpoint to.
+	image := os.Getenv("E2E_WINDOWS_IMAGE")
+	if image == "" {
+		image = defaultImage
+	}
+	output, err := exec.Command("docker", "run", "-d", "--network", "none",
+		image, "ping", "-t", "localhost").Output()
+	require.NoError(t, err, "Unable to start container")
+	r.containerID = strings.TrimSpace(string(output))
+	defer exec.Command("docker", "rm", "-f", r.containerID).Run()
+
+	netConf := []byte(fmt.Sprintf(netConfJSONFormat,
+		networkName, eniName, eniIPAddress, containerIPAddress, gatewayIPAddress))
+
+	result, err := r.add(netConf, "none")
+	require.NoError(t, err, "Unable to execute ADD command")
+	requireResult(t, result)
+
+	// Verify the HNS endpoint and connectivity to the host through the bridge.
+	endpointName := "cid-" + r.containerID
+	endpoint, err := hcsshim.GetHNSEndpointByName(endpointName)
+	require.NoError(t, err, "Unable to find HNS endpoint")
+	assert.Equal(t, containerIPAddress, fmt.Sprintf("%s/%d", endpoint.IPAddress, endpoint.PrefixLength))
+
+	eniIP, _, _ := net.ParseCIDR(eniIPAddress)
+	output, err = exec.Command("docker", "exec", r.containerID,
+		"ping", "-n", "3", eniIP.String()).CombinedOutput()
+	assert.NoError(t, err, "Container cannot reach the ENI: %s", output)
+
+	// A repeated ADD is idempotent.
+	_, err = r.add(netConf, "none")
+	require.NoError(t, err, "Unable to execute repeated ADD command")
+
+	err = r.del(netConf, "none")
+	require.NoError(t, err, "Unable to execute DEL command")
+
+	// Verify that the endpoint was cleaned up.
+	_, err = hcsshim.GetHNSEndpointByName(endpointName)
+	assert.Error(t, err, "HNS endpoint was not deleted")
+
+	// A repeated DEL succeeds.
+	err = r.del(netConf, "none")
+	assert.NoError(t, err, "Unable to execute repeated DEL command")
+}
+
+// setupENI creates a disposable internal Hyper-V switch whose host adapter stands in for the ENI.
+func setupENI(t *testing.T) {
+	ip, ipNet, _ := net.ParseCIDR(eniIPAddress)
+	prefixLength, _ := ipNet.Mask.Size()
+
+	err := powershell(
+		fmt.Sprintf("New-VMSwitch -Name '%s' -SwitchType Internal", switchName),
+		fmt.Sprintf("New-NetIPAddress -InterfaceAlias '%s' -IPAddress %s -PrefixLength %d",
+			eniName, ip, prefixLength))
+	require.NoError(t, err, "Unable to create internal switch")
+}
+
+// cleanupENI deletes the HNS networks created by the plugin on the test adapter, and the switch.
+func cleanupENI(t *testing.T) {
+	networks, err := hcsshim.HNSListNetworkRequest("GET", "", "")
+	if err != nil {
+		t.Logf("Unable to list HNS networks: %v", err)
+	}
+
+	for _, network := range networks {
+		if strings.HasPrefix(network.Name, networkName+"br") {
+			_, err = network.Delete()
+			if err != nil {
+				t.Logf("Unable to delete HNS network %s: %v", network.Name, err)
+			}
+		}
+	}
+
+	err = powershell(fmt.Sprintf("Remove-VMSwitch -Name '%s' -Force", switchName))
+	if err != nil {
+		t.Logf("Unable to delete internal switch: %v", err)
+	}
+}
+
+// powershell runs the given PowerShell commands.
+func powershell(commands ...string) error {
+	output, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command",
+		strings.Join(commands, "; ")).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+
+	return nil
+}
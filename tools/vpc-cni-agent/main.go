@@ -0,0 +1,130 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/aws/amazon-vpc-cni-plugins/agent"
+	"github.com/aws/amazon-vpc-cni-plugins/cleanup"
+	"github.com/aws/amazon-vpc-cni-plugins/logger"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// daemonName is the name of the daemon.
+	daemonName = "vpc-cni-agent"
+
+	// logFilePath is the path to the daemon's log file.
+	logFilePath = "/var/log/vpc-cni-agent.log"
+
+	// reapPluginName is the name of the plugin whose networks marked for deletion are reaped.
+	reapPluginName = "vpc-shared-eni"
+)
+
+// vpc-cni-agent [-socket path] [-max-retries n] [-retry-interval duration] [-max-retry-interval duration]
+// [-health-check-interval duration] [-failure-threshold n] [-reap-networks] [-reap-interval duration]
+// [-reconcile-runtime cri|docker] [-allowed-peers id,...] [-state-key-file path]
+func main() {
+	// Parse arguments.
+	var printVersion, reapNetworks bool
+	var reconcileRuntime, allowedPeers, stateKeyFile string
+	var config agent.Config
+	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
+	flag.StringVar(&config.SocketPath, "socket", agent.DefaultSocketPath, "path of the unix domain socket")
+	flag.IntVar(&config.MaxRetries, "max-retries", agent.DefaultMaxRetries, "number of times a failed operation is retried")
+	flag.DurationVar(&config.RetryInterval, "retry-interval", agent.DefaultRetryInterval, "interval before the first retry")
+	flag.DurationVar(&config.MaxRetryInterval, "max-retry-interval", agent.DefaultMaxRetryInterval, "cap of the exponentially increasing interval between retries")
+	flag.DurationVar(&config.HealthCheckInterval, "health-check-interval", agent.DefaultHealthCheckInterval, "interval between health checks of ENIs with a standby ENI")
+	flag.IntVar(&config.FailureThreshold, "failure-threshold", agent.DefaultFailureThreshold, "number of failed health checks that trigger failover to the standby ENI")
+	flag.BoolVar(&reapNetworks, "reap-networks", false, "deletes the networks that "+reapPluginName+" marked for deletion")
+	flag.DurationVar(&config.ReapInterval, "reap-interval", agent.DefaultReapInterval, "interval between deletions of networks marked for deletion")
+	flag.StringVar(&reconcileRuntime, "reconcile-runtime", "", "container runtime queried on startup to clean up resources of dead sandboxes, cri or docker")
+	flag.StringVar(&allowedPeers, "allowed-peers", "", "comma-separated user IDs (Linux) or security identifiers (Windows) of the processes allowed to connect")
+	flag.StringVar(&stateKeyFile, "state-key-file", "", "path of the key file for signing state files, instead of the host's key file")
+	flag.Parse()
+
+	if printVersion {
+		versionInfo, _ := version.String()
+		fmt.Println(versionInfo)
+		os.Exit(0)
+	}
+
+	logger.Setup(logFilePath)
+	defer log.Flush()
+
+	config.StateDir = state.GetDir(daemonName)
+	if reapNetworks {
+		config.ReapStateDir = state.GetDir(reapPluginName)
+	}
+	err := os.MkdirAll(config.StateDir, 0700)
+	if err != nil {
+		log.Errorf("Failed to create state directory %s: %v.", config.StateDir, err)
+		os.Exit(1)
+	}
+
+	// The agent shares state with plugins, so it uses the host's signing key by default.
+	var key []byte
+	if stateKeyFile != "" {
+		key, err = state.LoadSigningKey(stateKeyFile)
+	} else {
+		key, err = state.LoadHostSigningKey()
+	}
+	if err != nil {
+		log.Errorf("Failed to load state signing key: %v.", err)
+		os.Exit(1)
+	}
+	state.SetSigningKey(key)
+
+	if allowedPeers != "" {
+		config.AllowedPeers = strings.Split(allowedPeers, ",")
+	}
+
+	if reconcileRuntime != "" {
+		config.Reconcile = &cleanup.Config{
+			Runtime:      reconcileRuntime,
+			StateRootDir: state.GetDir(""),
+			MinAge:       cleanup.DefaultMinAge,
+		}
+		config.Reconcile.BootTime, err = cleanup.BootTime()
+		if err != nil {
+			log.Errorf("Failed to find boot time, ignoring: %v.", err)
+		}
+	}
+
+	log.Infof("Starting %s with config: %+v.", daemonName, config)
+	a := agent.NewAgent(config, &network.BridgeBuilder{})
+	err = a.Start()
+	if err != nil {
+		log.Errorf("Failed to start agent: %v.", err)
+		os.Exit(1)
+	}
+
+	// Run until terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	log.Infof("Received signal %v, stopping.", sig)
+	a.Stop()
+}
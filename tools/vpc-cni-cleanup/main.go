@@ -0,0 +1,136 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/cleanup"
+	"github.com/aws/amazon-vpc-cni-plugins/logger"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// toolName is the name of the tool.
+	toolName = "vpc-cni-cleanup"
+
+	// logFilePath is the path to the tool's log file.
+	logFilePath = "/var/log/vpc-cni-cleanup.log"
+
+	// defaultInterval is the default interval between cleanup runs.
+	defaultInterval = 10 * time.Minute
+)
+
+// vpc-cni-cleanup [-runtime cri|docker] [-min-age duration] [-interval duration] [-once] [-boot] [-dry-run] [-owner-id id]
+func main() {
+	// Parse arguments.
+	var printVersion, once, boot, dryRun bool
+	var runtime, ownerID string
+	var minAge, interval time.Duration
+	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
+	flag.StringVar(&runtime, "runtime", cleanup.RuntimeCRI, "container runtime to query for live sandboxes, cri or docker")
+	flag.DurationVar(&minAge, "min-age", cleanup.DefaultMinAge, "minimum age of state before it is considered orphaned")
+	flag.DurationVar(&interval, "interval", defaultInterval, "interval between cleanup runs")
+	flag.BoolVar(&once, "once", false, "runs cleanup once and exits")
+	flag.BoolVar(&boot, "boot", false, "runs cleanup once on boot and exits, removing state from before the boot regardless of its age")
+	flag.BoolVar(&dryRun, "dry-run", false, "logs orphans without removing them")
+	flag.StringVar(&ownerID, "owner-id", "", "ID of the CNI stack whose resources are cleaned up")
+	flag.Parse()
+
+	if printVersion {
+		versionInfo, _ := version.String()
+		fmt.Println(versionInfo)
+		os.Exit(0)
+	}
+
+	logger.Setup(logFilePath)
+	defer log.Flush()
+
+	var err error
+	config := &cleanup.Config{
+		Runtime:      runtime,
+		StateRootDir: state.GetDir(""),
+		MinAge:       minAge,
+		DryRun:       dryRun,
+		OwnerID:      ownerID,
+	}
+
+	if boot {
+		config.BootTime, err = cleanup.BootTime()
+		if err != nil {
+			log.Errorf("Failed to find boot time: %v.", err)
+			os.Exit(1)
+		}
+		once = true
+	}
+
+	// One-off cleanup runs, as opposed to the service and the boot-time run, require the debug
+	// token unless they only report orphans.
+	if once && !boot && !dryRun {
+		err = state.AuthorizeDebugCommand(toolName)
+		if err != nil {
+			log.Errorf("Unauthorized cleanup: %v.", err)
+			os.Exit(1)
+		}
+	}
+
+	if once {
+		err = run(config)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	log.Infof("Starting %s with runtime %s.", toolName, runtime)
+
+	// Run periodically, on SIGHUP, and until terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run(config)
+
+		select {
+		case <-ticker.C:
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				log.Infof("Received signal %v, stopping.", sig)
+				return
+			}
+		}
+	}
+}
+
+// run runs cleanup once.
+func run(config *cleanup.Config) error {
+	report, err := cleanup.Run(config)
+	if err != nil {
+		log.Errorf("Failed to clean up: %v.", err)
+		return err
+	}
+
+	log.Infof("Cleaned up orphans %s.", report)
+	return nil
+}
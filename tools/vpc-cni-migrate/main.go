@@ -0,0 +1,81 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config"
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+)
+
+// vpc-cni-migrate [-in path] [-out path] [-strict]
+//
+// Converts vpc-bridge and older vpc-shared-eni network configuration files to equivalent
+// vpc-shared-eni network configuration. Dropped options are reported on stderr.
+func main() {
+	// Parse arguments.
+	var printVersion, strict bool
+	var inPath, outPath string
+	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
+	flag.StringVar(&inPath, "in", "", "path of the network configuration file to convert, stdin if empty")
+	flag.StringVar(&outPath, "out", "", "path of the converted network configuration file, stdout if empty")
+	flag.BoolVar(&strict, "strict", false, "fails if any option is not supported, instead of dropping it")
+	flag.Parse()
+
+	if printVersion {
+		versionInfo, _ := version.String()
+		fmt.Println(versionInfo)
+		os.Exit(0)
+	}
+
+	var data []byte
+	var err error
+	if inPath == "" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(inPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read network config: %v\n", err)
+		os.Exit(1)
+	}
+
+	converted, warnings, err := config.ConvertLegacyConfig(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert network config: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if strict && len(warnings) != 0 {
+		os.Exit(1)
+	}
+
+	converted = append(converted, '\n')
+	if outPath == "" {
+		_, err = os.Stdout.Write(converted)
+	} else {
+		err = ioutil.WriteFile(outPath, converted, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write network config: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build !disablekubeapi
+
+package main
+
+import (
+	// Retrieve missing pod configuration from the Kubernetes API server in vpc-shared-eni. Build
+	// with the disablekubeapi tag to leave the Kubernetes client out of the binary.
+	_ "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/config/kubeapi"
+)
@@ -0,0 +1,31 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-plugins/multicall"
+)
+
+// executableName is the name of the multi-call executable.
+const executableName = "vpc-cni-plugins"
+
+// main is the entry point for the multi-call executable linking all plugins. It runs the plugin
+// it is invoked as through a link, or the plugin named by its first argument.
+func main() {
+	executable := multicall.New(executableName)
+	registerPlugins(executable)
+	os.Exit(executable.Main(os.Args))
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/multicall"
+	appmesh "github.com/aws/amazon-vpc-cni-plugins/plugins/aws-appmesh/plugin"
+	serviceconnect "github.com/aws/amazon-vpc-cni-plugins/plugins/ecs-serviceconnect/plugin"
+	egressv6 "github.com/aws/amazon-vpc-cni-plugins/plugins/egress-v6/plugin"
+	brancheni "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-branch-eni/plugin"
+	branchpateni "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-branch-pat-eni/plugin"
+	bridge "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-bridge/plugin"
+	efa "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-efa/plugin"
+	ipam "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-ipam/plugin"
+	mirror "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-mirror/plugin"
+	multiinterface "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-multi-interface/plugin"
+	sharedeni "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/plugin"
+	snat "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-snat/plugin"
+	tunnel "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-tunnel/plugin"
+)
+
+// registerPlugins links the Linux plugins into the executable.
+func registerPlugins(e *multicall.Executable) {
+	e.Register("aws-appmesh", func() (multicall.Plugin, error) { return appmesh.NewPlugin() })
+	e.Register("ecs-serviceconnect", func() (multicall.Plugin, error) { return serviceconnect.NewPlugin() })
+	e.Register("egress-v6", func() (multicall.Plugin, error) { return egressv6.NewPlugin() })
+	e.Register("vpc-branch-eni", func() (multicall.Plugin, error) { return brancheni.NewPlugin() })
+	e.Register("vpc-branch-pat-eni", func() (multicall.Plugin, error) { return branchpateni.NewPlugin() })
+	e.Register("vpc-bridge", func() (multicall.Plugin, error) { return bridge.NewPlugin() })
+	e.Register("vpc-efa", func() (multicall.Plugin, error) { return efa.NewPlugin() })
+	e.Register("vpc-ipam", func() (multicall.Plugin, error) { return ipam.NewPlugin() })
+	e.Register("vpc-mirror", func() (multicall.Plugin, error) { return mirror.NewPlugin() })
+	e.Register("vpc-multi-interface", func() (multicall.Plugin, error) { return multiinterface.NewPlugin() })
+	e.Register("vpc-shared-eni", func() (multicall.Plugin, error) { return sharedeni.NewPlugin() })
+	e.Register("vpc-snat", func() (multicall.Plugin, error) { return snat.NewPlugin() })
+	e.Register("vpc-tunnel", func() (multicall.Plugin, error) { return tunnel.NewPlugin() })
+}
@@ -0,0 +1,28 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"github.com/aws/amazon-vpc-cni-plugins/multicall"
+	appmesh "github.com/aws/amazon-vpc-cni-plugins/plugins/aws-appmesh/plugin"
+	serviceconnect "github.com/aws/amazon-vpc-cni-plugins/plugins/ecs-serviceconnect/plugin"
+	sharedeni "github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/plugin"
+)
+
+// registerPlugins links the Windows plugins into the executable.
+func registerPlugins(e *multicall.Executable) {
+	e.Register("aws-appmesh", func() (multicall.Plugin, error) { return appmesh.NewPlugin() })
+	e.Register("ecs-serviceconnect", func() (multicall.Plugin, error) { return serviceconnect.NewPlugin() })
+	e.Register("vpc-shared-eni", func() (multicall.Plugin, error) { return sharedeni.NewPlugin() })
+}
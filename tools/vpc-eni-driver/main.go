@@ -0,0 +1,80 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/amazon-vpc-cni-plugins/libnetwork"
+	"github.com/aws/amazon-vpc-cni-plugins/logger"
+	"github.com/aws/amazon-vpc-cni-plugins/plugins/vpc-shared-eni/network"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// daemonName is the name of the daemon.
+	daemonName = "vpc-eni-driver"
+
+	// logFilePath is the path to the daemon's log file.
+	logFilePath = "/var/log/vpc-eni-driver.log"
+)
+
+// vpc-eni-driver [-socket path]
+func main() {
+	// Parse arguments.
+	var printVersion bool
+	var config libnetwork.Config
+	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
+	flag.StringVar(&config.SocketPath, "socket", libnetwork.DefaultSocketPath, "path of the unix domain socket Docker discovers the driver on")
+	flag.Parse()
+
+	if printVersion {
+		versionInfo, _ := version.String()
+		fmt.Println(versionInfo)
+		os.Exit(0)
+	}
+
+	logger.Setup(logFilePath)
+	defer log.Flush()
+
+	config.StateDir = state.GetDir(daemonName)
+	err := os.MkdirAll(config.StateDir, 0700)
+	if err != nil {
+		log.Errorf("Failed to create state directory %s: %v.", config.StateDir, err)
+		os.Exit(1)
+	}
+
+	log.Infof("Starting %s with config: %+v.", daemonName, config)
+	d := libnetwork.NewDriver(config, &network.BridgeBuilder{})
+	err = d.Start()
+	if err != nil {
+		log.Errorf("Failed to start driver: %v.", err)
+		os.Exit(1)
+	}
+
+	// Run until terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	log.Infof("Received signal %v, stopping.", sig)
+	d.Stop()
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/aws/amazon-vpc-cni-plugins/ipamd"
+	"github.com/aws/amazon-vpc-cni-plugins/logger"
+	"github.com/aws/amazon-vpc-cni-plugins/network/ec2"
+	"github.com/aws/amazon-vpc-cni-plugins/network/imds"
+	"github.com/aws/amazon-vpc-cni-plugins/network/vpc"
+	"github.com/aws/amazon-vpc-cni-plugins/state"
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// daemonName is the name of the daemon.
+	daemonName = "vpc-ipamd"
+
+	// logFilePath is the path to the daemon's log file.
+	logFilePath = "/var/log/vpc-ipamd.log"
+)
+
+// vpc-ipamd [-eni-mac mac] [-prefix-delegation] [-ipv6] [-warm-ip-target n] [-max-ips n] [-socket path]
+func main() {
+	// Parse arguments.
+	var printVersion, prefixDelegation, ipv6 bool
+	var eniMAC, socketPath string
+	var warmIPTarget, maxIPs int
+	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
+	flag.StringVar(&eniMAC, "eni-mac", "", "MAC address of the ENI, defaults to the primary ENI")
+	flag.BoolVar(&prefixDelegation, "prefix-delegation", false, "allocates from prefixes delegated to the ENI")
+	flag.BoolVar(&ipv6, "ipv6", false, "allocates IPv6 addresses, requires prefix delegation")
+	flag.IntVar(&warmIPTarget, "warm-ip-target", ipamd.DefaultWarmIPTarget, "number of free IP addresses to keep")
+	flag.IntVar(&maxIPs, "max-ips", 0, "maximum number of secondary IP addresses on the ENI")
+	flag.StringVar(&socketPath, "socket", ipamd.DefaultSocketPath, "path of the unix domain socket")
+	flag.Parse()
+
+	if printVersion {
+		versionInfo, _ := version.String()
+		fmt.Println(versionInfo)
+		os.Exit(0)
+	}
+
+	logger.Setup(logFilePath)
+	defer log.Flush()
+
+	config, ec2Client, err := newConfig(eniMAC, ipv6)
+	if err != nil {
+		log.Errorf("Failed to discover ENI configuration: %v.", err)
+		os.Exit(1)
+	}
+
+	config.PrefixDelegation = prefixDelegation
+	config.WarmIPTarget = warmIPTarget
+	config.MaxIPs = maxIPs
+	config.SocketPath = socketPath
+	config.StateDir = state.GetDir(daemonName)
+
+	err = os.MkdirAll(config.StateDir, 0700)
+	if err != nil {
+		log.Errorf("Failed to create state directory %s: %v.", config.StateDir, err)
+		os.Exit(1)
+	}
+
+	log.Infof("Starting %s for ENI %s with config: %+v.", daemonName, config.ENIID, config)
+	daemon := ipamd.NewDaemon(*config, ec2Client)
+	err = daemon.Start()
+	if err != nil {
+		log.Errorf("Failed to start daemon: %v.", err)
+		os.Exit(1)
+	}
+
+	// Run until terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	log.Infof("Received signal %v, stopping.", sig)
+	daemon.Stop()
+}
+
+// newConfig discovers the ENI configuration from instance metadata and creates an EC2 client.
+func newConfig(eniMAC string, ipv6 bool) (*ipamd.Config, *ec2.Client, error) {
+	client := imds.NewClient()
+
+	var err error
+	if eniMAC == "" {
+		eniMAC, err = client.GetMetadata("mac")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	prefix := "network/interfaces/macs/" + eniMAC + "/"
+
+	eniID, err := client.GetMetadata(prefix + "interface-id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subnetResource, prefixResource := "subnet-ipv4-cidr-block", "ipv4-prefix"
+	if ipv6 {
+		subnetResource, prefixResource = "subnet-ipv6-cidr-blocks", "ipv6-prefix"
+	}
+
+	subnetCIDRs, err := client.GetMetadata(prefix + subnetResource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subnet, err := vpc.NewSubnetFromString(strings.Fields(subnetCIDRs)[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The first address is the primary IP address of the ENI, which is not allocated.
+	var addresses []net.IP
+	if !ipv6 {
+		localIPs, err := client.GetMetadata(prefix + "local-ipv4s")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, address := range strings.Fields(localIPs) {
+			if i > 0 {
+				addresses = append(addresses, net.ParseIP(address))
+			}
+		}
+	}
+
+	// Find the prefixes already delegated to the ENI. The resource is missing if there are none.
+	var prefixes []*net.IPNet
+	delegated, err := client.GetMetadata(prefix + prefixResource)
+	if err == nil {
+		for _, cidr := range strings.Fields(delegated) {
+			_, delegatedPrefix, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, nil, err
+			}
+			prefixes = append(prefixes, delegatedPrefix)
+		}
+	}
+
+	config := &ipamd.Config{
+		ENIID:     eniID,
+		Subnet:    &subnet.Prefix,
+		Gateway:   subnet.Gateways[0],
+		Addresses: addresses,
+		Prefixes:  prefixes,
+	}
+
+	ec2Client, err := ec2.NewInstanceClient(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, ec2Client, nil
+}
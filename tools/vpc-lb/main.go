@@ -0,0 +1,115 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-plugins/logger"
+	"github.com/aws/amazon-vpc-cni-plugins/network/lb"
+	"github.com/aws/amazon-vpc-cni-plugins/version"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// toolName is the name of the tool.
+	toolName = "vpc-lb"
+
+	// logFilePath is the path to the tool's log file.
+	logFilePath = "/var/log/vpc-lb.log"
+
+	// defaultSyncInterval is the default interval between service map syncs.
+	defaultSyncInterval = 10 * time.Second
+)
+
+// vpc-lb -service-map path [-interval duration] [-once]
+func main() {
+	// Parse arguments.
+	var printVersion, once bool
+	var serviceMapPath string
+	var interval time.Duration
+	flag.BoolVar(&printVersion, version.Command, false, "prints version and exits")
+	flag.StringVar(&serviceMapPath, "service-map", "", "path of the service map file written by the orchestrator")
+	flag.DurationVar(&interval, "interval", defaultSyncInterval, "interval between service map syncs")
+	flag.BoolVar(&once, "once", false, "syncs the service map once and exits")
+	flag.Parse()
+
+	if printVersion {
+		versionInfo, _ := version.String()
+		fmt.Println(versionInfo)
+		os.Exit(0)
+	}
+
+	if serviceMapPath == "" {
+		fmt.Fprintln(os.Stderr, "Missing required argument -service-map.")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	logger.Setup(logFilePath)
+	defer log.Flush()
+
+	if once {
+		err := sync(serviceMapPath)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	log.Infof("Starting %s with service map %s.", toolName, serviceMapPath)
+
+	// Sync periodically, on SIGHUP, and until terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sync(serviceMapPath)
+
+		select {
+		case <-ticker.C:
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				log.Infof("Received signal %v, stopping.", sig)
+				return
+			}
+		}
+	}
+}
+
+// sync loads the service map and programs the load balancer.
+func sync(serviceMapPath string) error {
+	services, err := lb.Load(serviceMapPath)
+	if err != nil {
+		log.Errorf("Failed to load service map: %v.", err)
+		return err
+	}
+
+	err = lb.Sync(services)
+	if err != nil {
+		log.Errorf("Failed to sync %d services: %v.", len(services), err)
+		return err
+	}
+
+	log.Debugf("Synced %d services.", len(services))
+	return nil
+}